@@ -0,0 +1,15 @@
+//go:build ignore
+
+// go run block_history.go sync -chain=bor -from=76000000
+// go run block_history.go sync -chain=heimdall -base="https://tendermint-api.polygon.technology"
+// go run block_history.go sync -chain=bor -from=76000000 -restart
+// go run block_history.go export -chain=bor -range=76000000..77000000 -format=csv -out=bor.csv
+// go run block_history.go export -chain=heimdall -range=2025-09-01T00:00:00Z..2025-10-01T00:00:00Z -format=jsonl
+// go run block_history.go import -chain=bor -network=137 -in=provider-dump.csv
+// go run block_history.go compact -keep=1y
+
+package main
+
+import "github.com/pratikspatil024/chain-utils/internal/blockhistory"
+
+func main() { blockhistory.Main() }
@@ -0,0 +1,387 @@
+// Package blocktime is the block-time math of the calculators as a library,
+// so Go services can embed it instead of shelling out to go run:
+//
+//	src := blocktime.NewBorRPC("https://polygon-rpc.com", nil)
+//	calc, err := blocktime.NewCalculator(src, blocktime.WithLookbacks(40000, 280000))
+//	if err != nil { ... }
+//	p, err := calc.Predict(ctx, target)
+//	fmt.Println(p.Height)
+//
+// Averages, predictions and ETAs are computed the way the scripts compute
+// them: from the head block's timestamp, over block lookbacks below it, with
+// the shortest lookback's average driving predictions by default.
+package blocktime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Block is a height and the time it was produced.
+type Block struct {
+	Height int64
+	Time   time.Time
+}
+
+// Source reads blocks from a chain. NewBorRPC and NewTendermint read Bor
+// and Heimdall; services and tests can inject their own.
+type Source interface {
+	Head(ctx context.Context) (Block, error)
+	Block(ctx context.Context, height int64) (Block, error)
+}
+
+// Cache keeps blocks a Calculator has read, so repeated averages over the
+// same history do not refetch it. Only blocks at least ReorgDepth below the
+// head are put. Implementations must be safe for concurrent use.
+type Cache interface {
+	Get(height int64) (Block, bool)
+	Put(b Block)
+}
+
+// Average is the mean block time over Lookback blocks ending at To.
+type Average struct {
+	Lookback int64
+	From, To Block
+	Seconds  float64
+}
+
+// Estimator turns the averages of a Calculator's lookbacks, in the order
+// they were given, into the block time predictions use.
+type Estimator func(avgs []Average) (float64, error)
+
+// Prediction is the height expected at a point in time.
+type Prediction struct {
+	Head      Block
+	BlockTime float64 // seconds per block the prediction used
+	At        time.Time
+	Height    int64
+}
+
+// ETA is when a height is expected. For a height at or below the head,
+// Reached is set and At is when the block was produced.
+type ETA struct {
+	Head      Block
+	BlockTime float64
+	Height    int64
+	At        time.Time
+	Reached   bool
+	// Remaining is At less the Calculator's clock; negative once reached.
+	Remaining time.Duration
+}
+
+// ReorgDepth is how far below the head a block must be before it is cached,
+// the calculators' bound for an RPC without the "finalized" tag.
+const ReorgDepth = 1024
+
+// DefaultLookbacks are the Bor average calculator's lookbacks.
+var DefaultLookbacks = []int64{40000, 280000, 560000, 1120000}
+
+// Calculator computes averages, predictions and ETAs from a Source.
+type Calculator struct {
+	src       Source
+	lookbacks []int64
+	estimator Estimator
+	cache     Cache
+	now       func() time.Time
+	rounding  Rounding
+}
+
+// Option configures a Calculator.
+type Option func(*Calculator)
+
+// WithLookbacks sets the block lookbacks averaged below the head. The
+// default is DefaultLookbacks.
+func WithLookbacks(lookbacks ...int64) Option {
+	return func(c *Calculator) { c.lookbacks = append([]int64(nil), lookbacks...) }
+}
+
+// WithEstimator sets how the lookback averages become the block time used
+// for predictions and ETAs. The default is ShortestLookback.
+func WithEstimator(e Estimator) Option {
+	return func(c *Calculator) { c.estimator = e }
+}
+
+// WithCache sets where blocks below the head are kept between calls. The
+// default keeps none.
+func WithCache(cache Cache) Option {
+	return func(c *Calculator) { c.cache = cache }
+}
+
+// WithClock sets the clock ETA.Remaining is measured against. The default
+// is time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(c *Calculator) { c.now = now }
+}
+
+// WithRounding sets how a fractional block count is rounded to a height:
+// Nearest (the default, as on Bor), Floor (as on Heimdall), Ceil or Trunc.
+func WithRounding(r Rounding) Option {
+	return func(c *Calculator) { c.rounding = r }
+}
+
+// NewCalculator returns a Calculator reading from src.
+func NewCalculator(src Source, opts ...Option) (*Calculator, error) {
+	if src == nil {
+		return nil, errors.New("blocktime: nil Source")
+	}
+	c := &Calculator{
+		src:       src,
+		lookbacks: DefaultLookbacks,
+		estimator: ShortestLookback,
+		now:       time.Now,
+		rounding:  Nearest,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if len(c.lookbacks) == 0 {
+		return nil, errors.New("blocktime: no lookbacks")
+	}
+	for _, lb := range c.lookbacks {
+		if lb < 1 {
+			return nil, fmt.Errorf("blocktime: lookback %d, want a positive number of blocks", lb)
+		}
+	}
+	if c.estimator == nil || c.now == nil {
+		return nil, errors.New("blocktime: nil estimator or clock")
+	}
+	if _, err := c.rounding.Round(new(big.Rat)); err != nil {
+		return nil, fmt.Errorf("blocktime: %w", err)
+	}
+	return c, nil
+}
+
+// Averages returns the average block time over each lookback below the
+// current head.
+func (c *Calculator) Averages(ctx context.Context) ([]Average, error) {
+	head, err := c.src.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get head: %w", err)
+	}
+	return c.averages(ctx, head)
+}
+
+func (c *Calculator) averages(ctx context.Context, head Block) ([]Average, error) {
+	avgs := make([]Average, 0, len(c.lookbacks))
+	for _, lb := range c.lookbacks {
+		if head.Height-lb < 0 {
+			return nil, fmt.Errorf("lookback %d reaches below genesis from head %d", lb, head.Height)
+		}
+		from, err := c.block(ctx, head, head.Height-lb)
+		if err != nil {
+			return nil, fmt.Errorf("get block %d: %w", head.Height-lb, err)
+		}
+		if !head.Time.After(from.Time) {
+			return nil, fmt.Errorf("block %d (%s) is not later than block %d (%s)", head.Height, head.Time.Format(time.RFC3339), from.Height, from.Time.Format(time.RFC3339))
+		}
+		avgs = append(avgs, Average{Lookback: lb, From: from, To: head, Seconds: head.Time.Sub(from.Time).Seconds() / float64(lb)})
+	}
+	return avgs, nil
+}
+
+// BlockTime returns the estimator's block time over the current lookbacks.
+func (c *Calculator) BlockTime(ctx context.Context) (float64, Block, error) {
+	head, err := c.src.Head(ctx)
+	if err != nil {
+		return 0, Block{}, fmt.Errorf("get head: %w", err)
+	}
+	avg, err := c.blockTime(ctx, head)
+	return avg, head, err
+}
+
+func (c *Calculator) blockTime(ctx context.Context, head Block) (float64, error) {
+	avgs, err := c.averages(ctx, head)
+	if err != nil {
+		return 0, err
+	}
+	avg, err := c.estimator(avgs)
+	if err != nil {
+		return 0, fmt.Errorf("estimate block time: %w", err)
+	}
+	if avg <= 0 || math.IsNaN(avg) || math.IsInf(avg, 0) {
+		return 0, fmt.Errorf("estimator returned block time %v", avg)
+	}
+	return avg, nil
+}
+
+// Predict returns the height expected at t: the head height plus the
+// rounded number of blocks between the head's timestamp and t. A t before
+// the head predicts a past height, never below 0.
+func (c *Calculator) Predict(ctx context.Context, t time.Time) (Prediction, error) {
+	avg, head, err := c.BlockTime(ctx)
+	if err != nil {
+		return Prediction{}, err
+	}
+	_, blocks, err := Blocks(t.Sub(head.Time), avg, c.rounding)
+	if err != nil {
+		return Prediction{}, err
+	}
+	return Prediction{Head: head, BlockTime: avg, At: t, Height: max(head.Height+blocks.Int64(), 0)}, nil
+}
+
+// ETA returns when height is expected at the estimated block time. A height
+// already produced is looked up instead.
+func (c *Calculator) ETA(ctx context.Context, height int64) (ETA, error) {
+	head, err := c.src.Head(ctx)
+	if err != nil {
+		return ETA{}, fmt.Errorf("get head: %w", err)
+	}
+	if height <= head.Height {
+		b, err := c.block(ctx, head, height)
+		if err != nil {
+			return ETA{}, fmt.Errorf("get block %d: %w", height, err)
+		}
+		return ETA{Head: head, Height: height, At: b.Time, Reached: true, Remaining: b.Time.Sub(c.now())}, nil
+	}
+	avg, err := c.blockTime(ctx, head)
+	if err != nil {
+		return ETA{}, err
+	}
+	at := head.Time.Add(Span(height-head.Height, avg))
+	return ETA{Head: head, BlockTime: avg, Height: height, At: at, Remaining: at.Sub(c.now())}, nil
+}
+
+// Rounding is how a fractional block count becomes a whole one.
+type Rounding string
+
+// The roundings, as the scripts' -rounding flag names them.
+const (
+	Nearest Rounding = "nearest" // halves away from zero, like math.Round
+	Floor   Rounding = "floor"
+	Ceil    Rounding = "ceil"
+	Trunc   Rounding = "trunc"
+)
+
+// Round rounds x to an integer.
+func (r Rounding) Round(x *big.Rat) (*big.Int, error) {
+	floor := func(x *big.Rat) *big.Int {
+		// Rat denominators are always positive, so Euclidean division floors.
+		return new(big.Int).Div(x.Num(), x.Denom())
+	}
+	switch r {
+	case Floor:
+		return floor(x), nil
+	case Ceil:
+		return new(big.Int).Neg(floor(new(big.Rat).Neg(x))), nil
+	case Trunc:
+		return new(big.Int).Quo(x.Num(), x.Denom()), nil
+	case Nearest:
+		half := big.NewRat(1, 2)
+		if x.Sign() < 0 {
+			return new(big.Int).Neg(floor(new(big.Rat).Add(new(big.Rat).Neg(x), half))), nil
+		}
+		return floor(new(big.Rat).Add(x, half)), nil
+	default:
+		return nil, fmt.Errorf("unknown rounding mode %q (use nearest, floor, ceil or trunc)", string(r))
+	}
+}
+
+// Blocks returns the number of blocks of avg seconds in d, exactly and
+// rounded by r. The division is done in rational arithmetic, so long
+// horizons don't accumulate float64 error and the same inputs always give
+// the same height. The average is taken at its shortest decimal form (2.15
+// is 43/20, not the nearest binary float).
+func Blocks(d time.Duration, avg float64, r Rounding) (*big.Rat, *big.Int, error) {
+	a, err := nanosPerBlock(avg)
+	if err != nil {
+		return nil, nil, err
+	}
+	exact := new(big.Rat).Quo(new(big.Rat).SetInt64(int64(d)), a)
+	rounded, err := r.Round(exact)
+	if err != nil {
+		return nil, nil, err
+	}
+	return exact, rounded, nil
+}
+
+// Span returns how long n blocks of avg seconds take, to the nearest
+// nanosecond, with avg taken at its shortest decimal form as in Blocks. A
+// span beyond what a Duration holds is clamped to it. An avg that is not a
+// positive number gives 0.
+func Span(n int64, avg float64) time.Duration {
+	a, err := nanosPerBlock(avg)
+	if err != nil {
+		return 0
+	}
+	ns, _ := Nearest.Round(a.Mul(a, new(big.Rat).SetInt64(n)))
+	switch {
+	case ns.IsInt64():
+		return time.Duration(ns.Int64())
+	case ns.Sign() > 0:
+		return math.MaxInt64
+	default:
+		return math.MinInt64
+	}
+}
+
+// nanosPerBlock is avg seconds per block as an exact count of nanoseconds.
+func nanosPerBlock(avg float64) (*big.Rat, error) {
+	if avg <= 0 || math.IsNaN(avg) || math.IsInf(avg, 0) {
+		return nil, fmt.Errorf("average block time must be a positive number, got %v", avg)
+	}
+	a, ok := new(big.Rat).SetString(strconv.FormatFloat(avg, 'f', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("invalid average block time %v", avg)
+	}
+	return a.Mul(a, big.NewRat(int64(time.Second), 1)), nil
+}
+
+// block reads height through the cache, caching it once it is ReorgDepth
+// below head.
+func (c *Calculator) block(ctx context.Context, head Block, height int64) (Block, error) {
+	if c.cache != nil {
+		if b, ok := c.cache.Get(height); ok {
+			return b, nil
+		}
+	}
+	b, err := c.src.Block(ctx, height)
+	if err != nil {
+		return Block{}, err
+	}
+	if c.cache != nil && head.Height-height >= ReorgDepth {
+		c.cache.Put(b)
+	}
+	return b, nil
+}
+
+// ShortestLookback uses the first lookback's average, as the calculators do.
+func ShortestLookback(avgs []Average) (float64, error) {
+	if len(avgs) == 0 {
+		return 0, errors.New("no averages")
+	}
+	return avgs[0].Seconds, nil
+}
+
+// Fixed ignores the averages and always uses seconds, like -avg.
+func Fixed(seconds float64) Estimator {
+	return func([]Average) (float64, error) { return seconds, nil }
+}
+
+// MemoryCache is a Cache for the life of the process.
+type MemoryCache struct {
+	mu     sync.Mutex
+	blocks map[int64]Block
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{blocks: make(map[int64]Block)}
+}
+
+func (m *MemoryCache) Get(height int64) (Block, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.blocks[height]
+	return b, ok
+}
+
+func (m *MemoryCache) Put(b Block) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blocks[b.Height] = b
+}
@@ -0,0 +1,331 @@
+package blocktime
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var genesis = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// chain is a Source whose block h was produced at genesis plus h times
+// interval, with head as its latest block.
+type chain struct {
+	head     int64
+	interval time.Duration
+
+	mu    sync.Mutex
+	reads map[int64]int
+	fail  error
+}
+
+func newChain(head int64, interval time.Duration) *chain {
+	return &chain{head: head, interval: interval, reads: make(map[int64]int)}
+}
+
+func (c *chain) at(h int64) Block {
+	return Block{Height: h, Time: genesis.Add(time.Duration(h) * c.interval)}
+}
+
+func (c *chain) Head(ctx context.Context) (Block, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail != nil {
+		return Block{}, c.fail
+	}
+	return c.at(c.head), nil
+}
+
+func (c *chain) Block(ctx context.Context, height int64) (Block, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reads[height]++
+	if height > c.head {
+		return Block{}, errors.New("block not produced yet")
+	}
+	return c.at(height), nil
+}
+
+func TestAverages(t *testing.T) {
+	src := newChain(1_000_000, 2*time.Second)
+	calc, err := NewCalculator(src, WithLookbacks(1000, 40000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	avgs, err := calc.Averages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(avgs) != 2 {
+		t.Fatalf("got %d averages, want 2", len(avgs))
+	}
+	for i, want := range []int64{1000, 40000} {
+		a := avgs[i]
+		if a.Lookback != want || a.From.Height != 1_000_000-want || a.To.Height != 1_000_000 || a.Seconds != 2 {
+			t.Errorf("average %d = %+v, want lookback %d from %d to 1000000 at 2s", i, a, want, 1_000_000-want)
+		}
+	}
+}
+
+func TestAveragesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  *chain
+		want string
+	}{
+		{"below genesis", newChain(500, 2*time.Second), "reaches below genesis"},
+		{"timestamps not increasing", newChain(5000, 0), "is not later than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calc, err := NewCalculator(tt.src, WithLookbacks(1000))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := calc.Averages(context.Background()); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Averages error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	src := newChain(5000, 2*time.Second)
+	src.fail = errors.New("HTTP 429")
+	calc, _ := NewCalculator(src, WithLookbacks(1000))
+	if _, err := calc.Averages(context.Background()); !errors.Is(err, src.fail) {
+		t.Fatalf("Averages error = %v, want the source's error wrapped", err)
+	}
+}
+
+func TestPredict(t *testing.T) {
+	head := genesis.Add(1_000_000 * 2 * time.Second)
+	tests := []struct {
+		name     string
+		interval time.Duration
+		round    Rounding
+		at       time.Time
+		want     int64
+	}{
+		{"one hour ahead", 2 * time.Second, Nearest, head.Add(time.Hour), 1_001_800},
+		{"in the past", 2 * time.Second, Nearest, head.Add(-time.Hour), 998_200},
+		{"before genesis", 2 * time.Second, Nearest, genesis.Add(-time.Hour), 0},
+		// 22.575s at 2.15s a block is exactly 10.5 blocks, which must not
+		// be nudged either way by float division
+		{"half block rounds up", 2150 * time.Millisecond, Nearest, genesis.Add(1_000_000*2150*time.Millisecond + 22575*time.Millisecond), 1_000_011},
+		{"half block floors", 2150 * time.Millisecond, Floor, genesis.Add(1_000_000*2150*time.Millisecond + 22575*time.Millisecond), 1_000_010},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calc, err := NewCalculator(newChain(1_000_000, tt.interval), WithLookbacks(100), WithRounding(tt.round))
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := calc.Predict(context.Background(), tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Height != tt.want {
+				t.Errorf("Predict(%s) = %d, want %d", tt.at.Format(time.RFC3339Nano), p.Height, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	tests := []struct {
+		delta time.Duration
+		avg   float64
+		mode  Rounding
+		exact string
+		want  int64
+	}{
+		{time.Hour, 2, Nearest, "1800.000", 1800},
+		{time.Hour, 1.3, Floor, "2769.231", 2769},
+		{time.Hour, 1.3, Ceil, "2769.231", 2770},
+		{22575 * time.Millisecond, 2.15, Nearest, "10.500", 11},
+		{22575 * time.Millisecond, 2.15, Floor, "10.500", 10},
+		{22575 * time.Millisecond, 2.15, Trunc, "10.500", 10},
+		{-22575 * time.Millisecond, 2.15, Nearest, "-10.500", -11},
+		{-22575 * time.Millisecond, 2.15, Floor, "-10.500", -11},
+		{-22575 * time.Millisecond, 2.15, Ceil, "-10.500", -10},
+		{-22575 * time.Millisecond, 2.15, Trunc, "-10.500", -10},
+		// a year at 2.1s, where float64 division drifts
+		{365 * 24 * time.Hour, 2.1, Nearest, "15017142.857", 15017143},
+	}
+	for _, tt := range tests {
+		exact, rounded, err := Blocks(tt.delta, tt.avg, tt.mode)
+		if err != nil {
+			t.Errorf("Blocks(%s, %v, %s): %v", tt.delta, tt.avg, tt.mode, err)
+			continue
+		}
+		if exact.FloatString(3) != tt.exact || rounded.Cmp(big.NewInt(tt.want)) != 0 {
+			t.Errorf("Blocks(%s, %v, %s) = %s, %s, want %s, %d", tt.delta, tt.avg, tt.mode, exact.FloatString(3), rounded, tt.exact, tt.want)
+		}
+	}
+	for _, avg := range []float64{0, -2, math.NaN(), math.Inf(1)} {
+		if _, _, err := Blocks(time.Hour, avg, Nearest); err == nil {
+			t.Errorf("Blocks with avg %v succeeded", avg)
+		}
+	}
+	if _, _, err := Blocks(time.Hour, 2, "bankers"); err == nil {
+		t.Error("Blocks with an unknown rounding mode succeeded")
+	}
+}
+
+func TestSpan(t *testing.T) {
+	tests := []struct {
+		n    int64
+		avg  float64
+		want time.Duration
+	}{
+		{100, 2, 200 * time.Second},
+		{-100, 2, -200 * time.Second},
+		// 2.1s is not exact in binary; 987,654,321 blocks of it are
+		// 2,074,074,074.1s, which float64 multiplication misses by 256ns
+		{987_654_321, 2.1, 2_074_074_074*time.Second + 100*time.Millisecond},
+		{3, 1.0000000003, 3*time.Second + 1}, // 0.9ns rounds up
+		{math.MaxInt64, 2, math.MaxInt64},
+		{100, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := Span(tt.n, tt.avg); got != tt.want {
+			t.Errorf("Span(%d, %v) = %v, want %v", tt.n, tt.avg, got, tt.want)
+		}
+	}
+}
+
+func TestPredictEstimator(t *testing.T) {
+	src := newChain(1_000_000, 2*time.Second)
+	head := src.at(1_000_000).Time
+
+	calc, _ := NewCalculator(src, WithLookbacks(100), WithEstimator(Fixed(4)))
+	p, err := calc.Predict(context.Background(), head.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.BlockTime != 4 || p.Height != 1_000_900 {
+		t.Errorf("Predict with Fixed(4) = %d at %vs, want 1000900 at 4s", p.Height, p.BlockTime)
+	}
+
+	for _, bad := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		calc, _ := NewCalculator(src, WithLookbacks(100), WithEstimator(Fixed(bad)))
+		if _, err := calc.Predict(context.Background(), head); err == nil {
+			t.Errorf("Predict with Fixed(%v) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestETA(t *testing.T) {
+	src := newChain(1_000_000, 2*time.Second)
+	head := src.at(1_000_000).Time
+	now := head.Add(30 * time.Second)
+	calc, err := NewCalculator(src, WithLookbacks(100), WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eta, err := calc.ETA(context.Background(), 1_000_100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eta.Reached || !eta.At.Equal(head.Add(200*time.Second)) || eta.Remaining != 170*time.Second {
+		t.Errorf("ETA(1000100) = %+v, want at head+200s with 170s remaining", eta)
+	}
+
+	eta, err = calc.ETA(context.Background(), 999_990)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !eta.Reached || !eta.At.Equal(src.at(999_990).Time) || eta.Remaining != -50*time.Second {
+		t.Errorf("ETA(999990) = %+v, want reached at the block's own time, 50s ago", eta)
+	}
+}
+
+func TestCache(t *testing.T) {
+	src := newChain(1_000_000, 2*time.Second)
+	calc, err := NewCalculator(src, WithLookbacks(100, 40000), WithCache(NewMemoryCache()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if _, err := calc.Averages(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 100 blocks below the head could still be reorged away, so it is read
+	// every time; 40000 below is final and read once
+	if n := src.reads[1_000_000-100]; n != 3 {
+		t.Errorf("block within ReorgDepth read %d times, want 3", n)
+	}
+	if n := src.reads[1_000_000-40000]; n != 1 {
+		t.Errorf("block below ReorgDepth read %d times, want 1", n)
+	}
+}
+
+func TestNewCalculatorErrors(t *testing.T) {
+	src := newChain(1000, time.Second)
+	tests := []struct {
+		name string
+		src  Source
+		opts []Option
+	}{
+		{"nil source", nil, nil},
+		{"no lookbacks", src, []Option{WithLookbacks()}},
+		{"zero lookback", src, []Option{WithLookbacks(100, 0)}},
+		{"nil estimator", src, []Option{WithEstimator(nil)}},
+		{"nil clock", src, []Option{WithClock(nil)}},
+		{"unknown rounding", src, []Option{WithRounding("bankers")}},
+	}
+	for _, tt := range tests {
+		if _, err := NewCalculator(tt.src, tt.opts...); err == nil {
+			t.Errorf("%s: NewCalculator succeeded, want an error", tt.name)
+		}
+	}
+}
+
+// BenchmarkAverages measures the calculator's own work for the exporter's
+// default lookbacks, with blocks read from memory.
+func BenchmarkAverages(b *testing.B) {
+	calc, err := NewCalculator(newChain(1_000_000, 2*time.Second), WithLookbacks(1000, 10000, 100000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := calc.Averages(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkAveragesCached is BenchmarkAverages with lookback blocks below
+// ReorgDepth answered from a MemoryCache.
+func BenchmarkAveragesCached(b *testing.B) {
+	calc, err := NewCalculator(newChain(1_000_000, 2*time.Second), WithLookbacks(1000, 10000, 100000), WithCache(NewMemoryCache()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := calc.Averages(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMemoryCache(b *testing.B) {
+	m := NewMemoryCache()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var h int64
+		for pb.Next() {
+			h++
+			m.Put(Block{Height: h % 10000, Time: genesis})
+			m.Get(h % 10000)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package blocktime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+)
+
+const httpTimeout = 20 * time.Second
+
+// BorRPC is a Source over a Bor (or any EVM) JSON-RPC endpoint.
+type BorRPC struct {
+	rpc *ethrpc.Client
+	err error // from ethrpc.New, returned by every call
+}
+
+// NewBorRPC reads blocks from the JSON-RPC endpoint at url, retrying
+// failed calls as ethrpc does. A nil client gets one with a 20s timeout.
+func NewBorRPC(url string, client *http.Client) *BorRPC {
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+	rpc, err := ethrpc.New(url, ethrpc.WithHTTPClient(client))
+	return &BorRPC{rpc: rpc, err: err}
+}
+
+func (r *BorRPC) Head(ctx context.Context) (Block, error) {
+	return r.block(ctx, "latest")
+}
+
+func (r *BorRPC) Block(ctx context.Context, height int64) (Block, error) {
+	return r.block(ctx, fmt.Sprintf("0x%x", height))
+}
+
+func (r *BorRPC) block(ctx context.Context, tag string) (Block, error) {
+	if r.err != nil {
+		return Block{}, r.err
+	}
+	h, err := r.rpc.HeaderByTag(ctx, tag)
+	if err != nil {
+		return Block{}, err
+	}
+	return Block{Height: int64(h.Number), Time: h.Time}, nil
+}
+
+// Tendermint is a Source over Heimdall's Tendermint (CometBFT) API.
+type Tendermint struct {
+	base   string
+	client *http.Client
+}
+
+// NewTendermint reads blocks from the Tendermint API at base (e.g.
+// https://tendermint-api.polygon.technology). A nil client gets one with a
+// 20s timeout.
+func NewTendermint(base string, client *http.Client) *Tendermint {
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+	return &Tendermint{base: strings.TrimRight(base, "/"), client: client}
+}
+
+func (t *Tendermint) Head(ctx context.Context) (Block, error) {
+	var resp struct {
+		Result struct {
+			SyncInfo struct {
+				LatestBlockHeight string    `json:"latest_block_height"`
+				LatestBlockTime   time.Time `json:"latest_block_time"`
+			} `json:"sync_info"`
+		} `json:"result"`
+	}
+	if err := t.get(ctx, "/status", &resp); err != nil {
+		return Block{}, err
+	}
+	h, err := strconv.ParseInt(resp.Result.SyncInfo.LatestBlockHeight, 10, 64)
+	if err != nil {
+		return Block{}, fmt.Errorf("latest height: %w", err)
+	}
+	return Block{Height: h, Time: resp.Result.SyncInfo.LatestBlockTime.UTC()}, nil
+}
+
+func (t *Tendermint) Block(ctx context.Context, height int64) (Block, error) {
+	var resp struct {
+		Result struct {
+			Block struct {
+				Header struct {
+					Time time.Time `json:"time"`
+				} `json:"header"`
+			} `json:"block"`
+		} `json:"result"`
+	}
+	if err := t.get(ctx, fmt.Sprintf("/block?height=%d", height), &resp); err != nil {
+		return Block{}, err
+	}
+	bt := resp.Result.Block.Header.Time
+	if bt.IsZero() {
+		return Block{}, fmt.Errorf("no time for block %d", height)
+	}
+	return Block{Height: height, Time: bt.UTC()}, nil
+}
+
+func (t *Tendermint) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.base+path, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(t.client, req, out)
+}
+
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d for %s", resp.StatusCode, req.URL)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
@@ -0,0 +1,172 @@
+package blocktime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// borNode serves eth_getBlockByNumber for a chain with a 2s block time and
+// head 1,000,000. Blocks below pruned answer the way a pruned node does.
+func borNode(t testing.TB, pruned int64, before func(w http.ResponseWriter) bool) *httptest.Server {
+	t.Helper()
+	src := newChain(1_000_000, 2*time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if before != nil && before(w) {
+			return
+		}
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params []any           `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "eth_getBlockByNumber" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		h := src.head
+		if tag := req.Params[0].(string); tag != "latest" {
+			h, _ = strconv.ParseInt(strings.TrimPrefix(tag, "0x"), 16, 64)
+		}
+		resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		if h < pruned {
+			resp["error"] = map[string]any{"code": -32000, "message": "header not found"}
+		} else {
+			b := src.at(h)
+			resp["result"] = map[string]string{"number": fmt.Sprintf("0x%x", h), "timestamp": fmt.Sprintf("0x%x", b.Time.Unix())}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBorRPC(t *testing.T) {
+	srv := borNode(t, 0, nil)
+	calc, err := NewCalculator(NewBorRPC(srv.URL, nil), WithLookbacks(1000, 40000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	avgs, err := calc.Averages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avgs[0].Seconds != 2 || avgs[1].Seconds != 2 || avgs[1].From.Height != 960_000 {
+		t.Errorf("Averages = %+v, want 2s over both lookbacks", avgs)
+	}
+}
+
+// BenchmarkBorRPC measures Averages against a local node, where the time
+// goes to requests and their decode rather than the network.
+func BenchmarkBorRPC(b *testing.B) {
+	srv := borNode(b, 0, nil)
+	calc, err := NewCalculator(NewBorRPC(srv.URL, nil), WithLookbacks(1000, 10000, 100000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := calc.Averages(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBorRPCRateLimited(t *testing.T) {
+	var calls atomic.Int64
+	srv := borNode(t, 0, func(w http.ResponseWriter) bool {
+		if calls.Add(1) == 1 {
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return true
+		}
+		return false
+	})
+	head, err := NewBorRPC(srv.URL, nil).Head(context.Background())
+	if err != nil {
+		t.Fatalf("Head after a 429: %v", err)
+	}
+	if head.Height != 1_000_000 || calls.Load() != 2 {
+		t.Errorf("Head = %d after %d requests, want 1000000 after 2", head.Height, calls.Load())
+	}
+}
+
+func TestBorRPCPruned(t *testing.T) {
+	srv := borNode(t, 990_000, nil)
+	calc, _ := NewCalculator(NewBorRPC(srv.URL, nil), WithLookbacks(1000, 40000))
+	_, err := calc.Averages(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "get block 960000") || !strings.Contains(err.Error(), "header not found") {
+		t.Fatalf("Averages error = %v, want the pruned block and the node's message", err)
+	}
+}
+
+func TestBorRPCMalformed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"number":"0xf4240","timestamp":"yesterday"}}`)
+	}))
+	defer srv.Close()
+	if _, err := NewBorRPC(srv.URL, nil).Head(context.Background()); err == nil || !strings.Contains(err.Error(), "timestamp") {
+		t.Fatalf("Head error = %v, want the bad timestamp named", err)
+	}
+}
+
+func TestBorRPCBadURL(t *testing.T) {
+	if _, err := NewBorRPC("polygon-rpc.com", nil).Head(context.Background()); err == nil {
+		t.Fatal("Head on a URL without a scheme succeeded")
+	}
+}
+
+// tendermintNode serves /status and /block with a 1.5s block time and head
+// 500,000, and answers heights below pruned as a pruned node does.
+func tendermintNode(t *testing.T, pruned int64) *httptest.Server {
+	t.Helper()
+	src := newChain(500_000, 1500*time.Millisecond)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			b := src.at(src.head)
+			fmt.Fprintf(w, `{"result":{"sync_info":{"latest_block_height":"%d","latest_block_time":"%s"}}}`, b.Height, b.Time.Format(time.RFC3339Nano))
+		case "/block":
+			h, _ := strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+			if h < pruned {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, `{"error":{"code":-32603,"message":"Internal error","data":"height %d is not available, lowest height is %d"}}`, h, pruned)
+				return
+			}
+			fmt.Fprintf(w, `{"result":{"block":{"header":{"time":"%s"}}}}`, src.at(h).Time.Format(time.RFC3339Nano))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTendermint(t *testing.T) {
+	srv := tendermintNode(t, 0)
+	calc, err := NewCalculator(NewTendermint(srv.URL+"/", nil), WithLookbacks(1000), WithRounding(Floor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := calc.Predict(context.Background(), newChain(500_000, 1500*time.Millisecond).at(500_000).Time.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.BlockTime != 1.5 || p.Height != 502_400 {
+		t.Errorf("Predict = %d at %vs, want 502400 at 1.5s", p.Height, p.BlockTime)
+	}
+}
+
+func TestTendermintPruned(t *testing.T) {
+	srv := tendermintNode(t, 499_500)
+	calc, _ := NewCalculator(NewTendermint(srv.URL, nil), WithLookbacks(1000))
+	if _, err := calc.Averages(context.Background()); err == nil || !strings.Contains(err.Error(), "HTTP 500") {
+		t.Fatalf("Averages error = %v, want the pruned node's HTTP 500", err)
+	}
+}
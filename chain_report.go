@@ -0,0 +1,11 @@
+//go:build ignore
+
+// go run chain_report.go -config=chains.json
+// go run chain_report.go -config=chains.json -target="2025-12-03T21:49:11Z" -format=json > report.json
+// go run chain_report.go -config=chains.json -format=json -out="-,reports/{time}.json,s3://chain-reports/daily/{time}.json"
+
+package main
+
+import "github.com/pratikspatil024/chain-utils/internal/chainreport"
+
+func main() { chainreport.Main() }
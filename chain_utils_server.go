@@ -0,0 +1,29 @@
+//go:build ignore
+
+// go run chain_utils_server.go
+// go run chain_utils_server.go -listen=":8080" -rpc="https://polygon-rpc.com" -base="https://tendermint-api.polygon.technology"
+// go run chain_utils_server.go -targets="bor:78000000,heimdall:30000000" -refresh=30s
+// go run chain_utils_server.go -targets="bor:78000000" -slack-webhook="https://hooks.slack.com/services/..." -alert-thresholds=7d,24h,1h,0
+// go run chain_utils_server.go -targets="bor:78000000" -config=chain-utils.json
+// go run chain_utils_server.go -statsd=127.0.0.1:8125 -otlp-endpoint=http://localhost:4318
+// go run chain_utils_server.go -network=amoy -rpc="https://rpc-amoy.polygon.technology" -metrics-prefix=chainutils_amoy
+// go run chain_utils_server.go -targets="bor:78000000" -webhook="https://internal.example/fork-eta"
+// go run chain_utils_server.go -targets="bor:78000000" -every=6h -notify-min-move=15m -ledger="$HOME/.chain-utils/predictions.jsonl"
+//
+// Endpoints (all GET, JSON responses unless noted):
+//   /v1/bor/avg?lookbacks=40000,280000
+//   /v1/bor/predict?target=2025-10-07T14:00:00Z[&avg=2.15]
+//   /v1/bor/eta?height=78000000
+//   /v1/heimdall/avg?lookbacks=10000,100000
+//   /v1/heimdall/predict?target=2025-10-07T14:00:00Z[&avg=1.3]
+//   /v1/heimdall/eta?height=30000000
+//   /metrics (Prometheus text format, refreshed every -refresh)
+//   /v1/dashboard (data behind the HTML dashboard served at /)
+//   /v1/stream (Server-Sent Events: head, eta, reestimate)
+//   /healthz, /readyz, /startupz (probes)
+
+package main
+
+import "github.com/pratikspatil024/chain-utils/internal/server"
+
+func main() { server.Main() }
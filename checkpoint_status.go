@@ -0,0 +1,13 @@
+//go:build ignore
+
+// go run checkpoint_status.go -l1-rpc="https://ethereum-rpc.publicnode.com"
+// go run checkpoint_status.go -l1-rpc="$ETH_RPC" -heimdall-rest=""
+// go run checkpoint_status.go -l1-rpc="$ETH_RPC" -height=78000000
+// go run checkpoint_status.go -l1-rpc="$ETH_RPC" -history
+// go run checkpoint_status.go -l1-rpc="$SEPOLIA_RPC" -root-chain=0x... -heimdall-rest="https://heimdall-api-amoy.polygon.technology"
+
+package main
+
+import "github.com/pratikspatil024/chain-utils/internal/checkpointstatus"
+
+func main() { checkpointstatus.Main() }
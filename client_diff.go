@@ -0,0 +1,11 @@
+//go:build ignore
+
+// go run client_diff.go -rpc="https://polygon-rpc.com,https://polygon-bor-rpc.publicnode.com"
+// go run client_diff.go -rpc="$BOR_RPC,$ERIGON_RPC" -heights=78000000,78500000
+// go run client_diff.go -rpc="$BOR_RPC,$ERIGON_RPC" -lookbacks=0,40000,1120000 -fields=hash,timestamp
+
+package main
+
+import "github.com/pratikspatil024/chain-utils/internal/clientdiff"
+
+func main() { clientdiff.Main() }
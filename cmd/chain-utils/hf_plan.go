@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/blocktime"
+	"github.com/pratikspatil024/chain-utils/pkg/human"
+)
+
+// planWindows is how many windows each chain's lookback is split into; the
+// spread of their averages gives the confidence window, as in the Heimdall
+// estimator.
+const planWindows = 10
+
+// chainPlan is one chain's half of an hf-plan.
+type chainPlan struct {
+	Chain           string    `json:"chain"`
+	HeadHeight      int64     `json:"head_height"`
+	HeadTime        time.Time `json:"head_time"`
+	Lookback        int64     `json:"lookback"`
+	AvgBlockTime    float64   `json:"avg_block_time_seconds"`
+	StdDevBlockTime float64   `json:"stddev_block_time_seconds"`
+	PredictedHeight int64     `json:"predicted_height"`
+	LowHeight       int64     `json:"low_height"`
+	HighHeight      int64     `json:"high_height"`
+}
+
+// hfPlan runs "chain-utils hf-plan", which predicts both chains' heights at
+// one target time. It takes no chain, so main hands it the arguments after
+// the command name.
+func hfPlan(args []string) {
+	fs := flag.NewFlagSet("hf-plan", flag.ExitOnError)
+	rpc := fs.String("rpc", chains[0].endpoint, chains[0].help)
+	base := fs.String("base", chains[1].endpoint, chains[1].help)
+	timeout := fs.Duration("timeout", 15*time.Second, "HTTP request timeout")
+	targetStr := fs.String("target", "", "Target time in RFC3339 or RFC3339Nano (UTC)")
+	borLookback := fs.Int64("bor-lookback", chains[0].lookbacks[0], "Bor blocks the average and its spread are measured over")
+	hmLookback := fs.Int64("heimdall-lookback", chains[1].lookbacks[0], "Heimdall blocks the average and its spread are measured over")
+	confidence := fs.Float64("confidence", 0.9, "Probability the height window covers, between 0 and 1")
+	format := fs.String("format", "text", "Output format: text or json")
+	replay := fs.String("replay", "", replayHelp)
+	fs.Parse(args)
+
+	if *format != "text" && *format != "json" {
+		failf("unknown -format %q (use text or json)", *format)
+	}
+	if *targetStr == "" {
+		failf("-target is required")
+	}
+	target, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(*targetStr))
+	if err != nil {
+		failf("unsupported time format %q (use RFC3339/RFC3339Nano, e.g. 2025-10-07T14:00:00Z)", *targetStr)
+	}
+	target = target.UTC()
+	if !(*confidence > 0 && *confidence < 1) {
+		failf("-confidence must be between 0 and 1, got %v", *confidence)
+	}
+	for _, lb := range []int64{*borLookback, *hmLookback} {
+		if lb < 2*planWindows {
+			failf("-bor-lookback and -heimdall-lookback must be at least %d blocks", 2*planWindows)
+		}
+	}
+
+	fix := loadReplay(*replay)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	endpoints := []string{*rpc, *base}
+	lookbacks := []int64{*borLookback, *hmLookback}
+	plans := make([]chainPlan, len(chains))
+	for i, c := range chains {
+		src := c.source(strings.TrimRight(endpoints[i], "/"), c.client(fix, *timeout))
+		p, err := planChain(ctx, src, lookbacks[i], target, *confidence, c.rounding)
+		if err != nil {
+			failf("%s: %v", c.name, err)
+		}
+		p.Chain = c.name
+		plans[i] = p
+	}
+
+	e := &env{format: *format, out: os.Stdout}
+	err = e.emit(struct {
+		TargetTime time.Time   `json:"target_time"`
+		Confidence float64     `json:"confidence"`
+		Chains     []chainPlan `json:"chains"`
+	}{target, *confidence, plans}, func(w io.Writer) {
+		pct := strconv.FormatFloat(*confidence*100, 'f', -1, 64)
+		fmt.Fprintf(w, "Target time : %s (UTC)\n", target.Format(time.RFC3339))
+		for _, p := range plans {
+			fmt.Fprintf(w, "\n%s\n", strings.ToUpper(p.Chain[:1])+p.Chain[1:])
+			fmt.Fprintf(w, "  Current block    : %s — %s (UTC)\n", human.Commas(p.HeadHeight), p.HeadTime.Format(time.RFC3339))
+			fmt.Fprintf(w, "  Avg block        : %.6f s (σ %.4f s, last %s blocks)\n", p.AvgBlockTime, p.StdDevBlockTime, human.Commas(p.Lookback))
+			fmt.Fprintf(w, "  Predicted height : %s\n", human.Commas(p.PredictedHeight))
+			fmt.Fprintf(w, "  %-16s : %s – %s (±%s blocks)\n", pct+"% window", human.Commas(p.LowHeight), human.Commas(p.HighHeight), human.Commas(p.HighHeight-p.PredictedHeight))
+		}
+	})
+	if err != nil {
+		failf("%v", err)
+	}
+}
+
+// planChain measures the average block time and its per-block spread over
+// lookback blocks below src's head and predicts the height at target.
+//
+// The number of blocks produced in T seconds is T/avg on average, with a
+// standard deviation of σ·sqrt(T/avg³) when block times are independent, so
+// the window widens with the square root of the distance to target.
+func planChain(ctx context.Context, src blocktime.Source, lookback int64, target time.Time, confidence float64, rounding string) (chainPlan, error) {
+	head, err := src.Head(ctx)
+	if err != nil {
+		return chainPlan{}, fmt.Errorf("get head: %w", err)
+	}
+	if !target.After(head.Time) {
+		return chainPlan{}, fmt.Errorf("target %s is not after the head block %d (%s); use hf-block for past times",
+			target.Format(time.RFC3339), head.Height, head.Time.Format(time.RFC3339))
+	}
+	windowSize := lookback / planWindows
+	sampled := planWindows * windowSize
+	if head.Height-sampled < 0 {
+		return chainPlan{}, fmt.Errorf("lookback %d reaches below genesis from head %d", lookback, head.Height)
+	}
+
+	// times[i] is the block time at head - i*windowSize
+	times := make([]time.Time, planWindows+1)
+	times[0] = head.Time
+	for i := 1; i <= planWindows; i++ {
+		b, err := src.Block(ctx, head.Height-int64(i)*windowSize)
+		if err != nil {
+			return chainPlan{}, fmt.Errorf("get block %d: %w", head.Height-int64(i)*windowSize, err)
+		}
+		times[i] = b.Time
+	}
+	if !head.Time.After(times[planWindows]) {
+		return chainPlan{}, errors.New("not enough history for an average")
+	}
+
+	avg := head.Time.Sub(times[planWindows]).Seconds() / float64(sampled)
+	var sumSq float64
+	for i := 0; i < planWindows; i++ {
+		w := times[i].Sub(times[i+1]).Seconds() / float64(windowSize)
+		sumSq += (w - avg) * (w - avg)
+	}
+	// A window average of n blocks has variance sigma^2/n, so scale back up
+	// to a per-block standard deviation
+	stdDev := math.Sqrt(sumSq/float64(planWindows-1)) * math.Sqrt(float64(windowSize))
+
+	_, blocks, err := blocktime.Blocks(target.Sub(head.Time), avg, blocktime.Rounding(rounding))
+	if err != nil {
+		return chainPlan{}, err
+	}
+	height := head.Height + blocks.Int64()
+	secs := target.Sub(head.Time).Seconds()
+	z := math.Sqrt2 * math.Erfinv(confidence)
+	margin := int64(math.Ceil(z * stdDev * math.Sqrt(secs/(avg*avg*avg))))
+	return chainPlan{
+		HeadHeight:      head.Height,
+		HeadTime:        head.Time,
+		Lookback:        sampled,
+		AvgBlockTime:    avg,
+		StdDevBlockTime: stdDev,
+		PredictedHeight: height,
+		LowHeight:       height - margin,
+		HighHeight:      height + margin,
+	}, nil
+}
@@ -0,0 +1,370 @@
+// Command chain-utils is the repository's scripts as one installable
+// binary:
+//
+//	go install github.com/pratikspatil024/chain-utils/cmd/chain-utils@latest
+//	chain-utils bor avg-blocktime -windows=24h,7d
+//	chain-utils bor hf-block -target=2025-10-07T14:00:00Z -avg=2.15
+//	chain-utils heimdall hf-block -target=2025-09-16T14:00:00Z
+//	chain-utils heimdall eta -height=30000000 -format=json
+//	chain-utils bor watch -height=80000000 -interval=15s
+//	chain-utils hf-plan -target=2025-10-07T14:00:00Z
+//	chain-utils serve -listen=:8080
+//	chain-utils self-update
+//
+// Most commands are a script: the binary hands the arguments after the
+// command name to the script's package under internal/, so a command takes
+// exactly the flags of "go run <script>.go". The commands no script covers
+// (bor eta, watch and hf-plan) are built on the blocktime package; they
+// share the -timeout, -lookbacks, -format and -replay flags, plus the
+// chain's endpoint flag (-rpc on Bor, -base on Heimdall). self-update
+// replaces the binary with a newer release, for hosts without Go.
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/blocktime"
+	"github.com/pratikspatil024/chain-utils/fixtures"
+	"github.com/pratikspatil024/chain-utils/internal/accuracy"
+	"github.com/pratikspatil024/chain-utils/internal/blockhistory"
+	"github.com/pratikspatil024/chain-utils/internal/boravg"
+	"github.com/pratikspatil024/chain-utils/internal/borhf"
+	"github.com/pratikspatil024/chain-utils/internal/chainreport"
+	"github.com/pratikspatil024/chain-utils/internal/checkpointstatus"
+	"github.com/pratikspatil024/chain-utils/internal/clientdiff"
+	"github.com/pratikspatil024/chain-utils/internal/ethhf"
+	"github.com/pratikspatil024/chain-utils/internal/finalitycheck"
+	"github.com/pratikspatil024/chain-utils/internal/heimdallavg"
+	"github.com/pratikspatil024/chain-utils/internal/heimdalleta"
+	"github.com/pratikspatil024/chain-utils/internal/heimdallhf"
+	"github.com/pratikspatil024/chain-utils/internal/networkcompare"
+	"github.com/pratikspatil024/chain-utils/internal/server"
+	"github.com/pratikspatil024/chain-utils/internal/snapshotat"
+	"github.com/pratikspatil024/chain-utils/internal/zkevmavg"
+	"github.com/pratikspatil024/chain-utils/pkg/human"
+)
+
+// chain is what differs between the chains the commands run against.
+type chain struct {
+	name      string
+	flag      string // endpoint flag name
+	help      string
+	endpoint  string // default endpoint
+	lookbacks []int64
+	rounding  string // default -rounding, as in the chain's hf script
+	source    func(endpoint string, client *http.Client) blocktime.Source
+	replay    func(f *fixtures.Fixture) (http.RoundTripper, error) // answers as the chain from a -replay fixture
+}
+
+var chains = []chain{
+	{
+		name: "bor", flag: "rpc", help: "Polygon (Bor) JSON-RPC endpoint", endpoint: "https://polygon-rpc.com",
+		lookbacks: blocktime.DefaultLookbacks, rounding: "nearest",
+		source: func(u string, c *http.Client) blocktime.Source { return blocktime.NewBorRPC(u, c) },
+		replay: fixtures.NewBorRPC,
+	},
+	{
+		name: "heimdall", flag: "base", help: "Base URL for the Tendermint RPC-compatible API", endpoint: "https://tendermint-api.polygon.technology",
+		lookbacks: []int64{10_000, 100_000, 1_000_000, 1_500_000}, rounding: "floor",
+		source: func(u string, c *http.Client) blocktime.Source { return blocktime.NewTendermint(u, c) },
+		replay: fixtures.NewTendermint,
+	},
+}
+
+// command is one verb, run for whichever chain it was invoked on.
+type command struct {
+	name  string
+	about string
+	flags func(fs *flag.FlagSet) func(ctx context.Context, env *env) error
+}
+
+var commands = []command{
+	{name: "eta", about: "time a height is expected (or was produced)", flags: eta},
+	{name: "watch", about: "live countdown to a height or time, re-estimated every -interval", flags: watch},
+}
+
+// script is a command that runs one of the repository's scripts.
+type script struct {
+	name   string // one or two words, e.g. "bor hf-block"
+	source string // the script it runs
+	main   func()
+}
+
+// scripts are matched before commands, so "heimdall eta" runs the Heimdall
+// estimator while "bor eta", which no script covers, falls through to eta.
+var scripts = []script{
+	{"bor avg-blocktime", "bor_average_blocktime_calculator.go", boravg.Main},
+	{"bor hf-block", "bor_hf_block_calculator.go", borhf.Main},
+	{"heimdall avg-blocktime", "heimdall_average_blocktime_calculator.go", heimdallavg.Main},
+	{"heimdall hf-block", "heimdall_hf_block_calculator.go", heimdallhf.Main},
+	{"heimdall eta", "heimdall_block_time_estimator.go", heimdalleta.Main},
+	{"eth hf-slot", "eth_hf_slot_calculator.go", ethhf.Main},
+	{"zkevm avg-blocktime", "zkevm_blocktime_calculator.go", zkevmavg.Main},
+	{"serve", "chain_utils_server.go", server.Main},
+	// exporter was the binary's own /metrics; the server serves the same
+	// series, so it is kept as a name for serve
+	{"exporter", "chain_utils_server.go", server.Main},
+	{"block-history", "block_history.go", blockhistory.Main},
+	{"chain-report", "chain_report.go", chainreport.Main},
+	{"checkpoint-status", "checkpoint_status.go", checkpointstatus.Main},
+	{"client-diff", "client_diff.go", clientdiff.Main},
+	{"finality-check", "finality_check.go", finalitycheck.Main},
+	{"network-compare", "network_compare.go", networkcompare.Main},
+	{"snapshot-at", "snapshot_at.go", snapshotat.Main},
+	{"prediction-accuracy", "prediction_accuracy_report.go", accuracy.Main},
+}
+
+// findScript returns the script args start with, or nil.
+func findScript(args []string) *script {
+	for i, s := range scripts {
+		words := strings.Fields(s.name)
+		if len(args) >= len(words) && slices.Equal(args[:len(words)], words) {
+			return &scripts[i]
+		}
+	}
+	return nil
+}
+
+// env is what every command gets after the shared flags are parsed.
+type env struct {
+	chain  chain
+	src    blocktime.Source
+	opts   []blocktime.Option
+	format string
+	out    io.Writer
+}
+
+func main() {
+	if s := findScript(os.Args[1:]); s != nil {
+		name := "chain-utils " + s.name
+		rest := os.Args[1+len(strings.Fields(s.name)):]
+		// The scripts parse flag.CommandLine from os.Args, so they are
+		// handed the arguments as if they had been run on their own
+		os.Args = append([]string{name}, rest...)
+		flag.CommandLine = flag.NewFlagSet(name, flag.ExitOnError)
+		s.main()
+		return
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "hf-plan" {
+		hfPlan(os.Args[2:])
+		return
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "self-update" {
+		selfUpdate(os.Args[2:])
+		return
+	}
+	if len(os.Args) < 3 {
+		usage()
+	}
+	var c *chain
+	for i := range chains {
+		if chains[i].name == os.Args[1] {
+			c = &chains[i]
+		}
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == os.Args[2] {
+			cmd = &commands[i]
+		}
+	}
+	if c == nil || cmd == nil {
+		usage()
+	}
+
+	fs := flag.NewFlagSet(c.name+" "+cmd.name, flag.ExitOnError)
+	endpoint := fs.String(c.flag, c.endpoint, c.help)
+	timeout := fs.Duration("timeout", 15*time.Second, "HTTP request timeout")
+	lookbacksStr := fs.String("lookbacks", joinInts(c.lookbacks), "Comma-separated block lookbacks averaged below the head")
+	format := fs.String("format", "text", "Output format: text or json")
+	replay := fs.String("replay", "", replayHelp)
+	run := cmd.flags(fs)
+	fs.Parse(os.Args[3:])
+
+	if *format != "text" && *format != "json" {
+		failf("unknown -format %q (use text or json)", *format)
+	}
+	lookbacks, err := parseLookbacks(*lookbacksStr)
+	if err != nil {
+		failf("-lookbacks: %v", err)
+	}
+	e := &env{
+		chain:  *c,
+		src:    c.source(strings.TrimRight(*endpoint, "/"), c.client(loadReplay(*replay), *timeout)),
+		opts:   []blocktime.Option{blocktime.WithLookbacks(lookbacks...)},
+		format: *format,
+		out:    os.Stdout,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, e); err != nil {
+		failf("%v", err)
+	}
+}
+
+// replayHelp is the usage of every command's -replay flag.
+const replayHelp = "Answer from a recorded dataset instead of the network: builtin:mainnet, builtin:amoy or a fixture file"
+
+// loadReplay loads the -replay fixture, or returns nil when spec is empty.
+func loadReplay(spec string) *fixtures.Fixture {
+	if spec == "" {
+		return nil
+	}
+	f, err := fixtures.Load(spec)
+	if err != nil {
+		failf("-replay: %v", err)
+	}
+	fmt.Fprintln(os.Stderr, f.Banner(spec))
+	return f
+}
+
+// client returns the HTTP client c's source talks through: one answering
+// from fix when it is set, else the network.
+func (c chain) client(fix *fixtures.Fixture, timeout time.Duration) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if fix != nil {
+		rt, err := c.replay(fix)
+		if err != nil {
+			failf("-replay: %v", err)
+		}
+		client.Transport = rt
+	}
+	return client
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: chain-utils <command> [flags]")
+	fmt.Fprintln(os.Stderr, "       chain-utils <chain> <command> [flags]")
+	fmt.Fprintln(os.Stderr, "       chain-utils hf-plan -target=<time> [flags]")
+	fmt.Fprintln(os.Stderr, "       chain-utils self-update [flags]")
+	fmt.Fprintln(os.Stderr, "\nscripts:")
+	for _, s := range scripts {
+		fmt.Fprintf(os.Stderr, "  %-24s %s\n", s.name, s.source)
+	}
+	fmt.Fprintln(os.Stderr, "\nchain commands (chains:", strings.Join(chainNames(), ", ")+"):")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-24s %s\n", c.name, c.about)
+	}
+	fmt.Fprintln(os.Stderr, "\nrun a command with -h for its flags")
+	os.Exit(2)
+}
+
+// chainNames returns the chains the <chain> commands run against.
+func chainNames() []string {
+	names := make([]string, len(chains))
+	for i, c := range chains {
+		names[i] = c.name
+	}
+	return names
+}
+
+func eta(fs *flag.FlagSet) func(context.Context, *env) error {
+	height := fs.Int64("height", -1, "Height whose arrival is estimated")
+	avg := fs.Float64("avg", 0, "Average block time in seconds (default: measured over the shortest -lookbacks)")
+	return func(ctx context.Context, e *env) error {
+		if *height < 0 {
+			return fmt.Errorf("-height is required")
+		}
+		calc, err := e.calculator(*avg, "")
+		if err != nil {
+			return err
+		}
+		t, err := calc.ETA(ctx, *height)
+		if err != nil {
+			return err
+		}
+		return e.emit(struct {
+			Chain        string    `json:"chain"`
+			HeadHeight   int64     `json:"head_height"`
+			HeadTime     time.Time `json:"head_time"`
+			Height       int64     `json:"height"`
+			Reached      bool      `json:"reached"`
+			At           time.Time `json:"at"`
+			InSeconds    float64   `json:"in_seconds"`
+			AvgBlockTime float64   `json:"avg_block_time_seconds,omitempty"`
+		}{e.chain.name, t.Head.Height, t.Head.Time, t.Height, t.Reached, t.At, t.Remaining.Seconds(), t.BlockTime}, func(w io.Writer) {
+			fmt.Fprintf(w, "Current block : %s — %s (UTC)\n", human.Commas(t.Head.Height), t.Head.Time.Format(time.RFC3339))
+			if t.Reached {
+				fmt.Fprintf(w, "Block %s was produced at %s (UTC), %s ago\n", human.Commas(t.Height), t.At.Format(time.RFC3339), human.DHMS(-t.Remaining))
+				return
+			}
+			fmt.Fprintf(w, "Avg block     : %.6f s\n", t.BlockTime)
+			fmt.Fprintf(w, "\nBlock %s expected at %s (UTC), in %s\n", human.Commas(t.Height), t.At.Format(time.RFC3339), human.DHMS(t.Remaining))
+		})
+	}
+}
+
+// calculator returns a Calculator predicting at a fixed avg when it is
+// set, and rounding block counts by rounding or the chain's default.
+func (e *env) calculator(avg float64, rounding string) (*blocktime.Calculator, error) {
+	if math.IsNaN(avg) || math.IsInf(avg, 0) || avg < 0 {
+		return nil, fmt.Errorf("-avg must be a positive number of seconds per block, got %v", avg)
+	}
+	round := blocktime.Rounding(cmp.Or(rounding, e.chain.rounding))
+	if _, err := round.Round(new(big.Rat)); err != nil {
+		return nil, fmt.Errorf("-rounding: %w", err)
+	}
+	opts := append(slices.Clone(e.opts), blocktime.WithRounding(round))
+	if avg > 0 {
+		opts = append(opts, blocktime.WithEstimator(blocktime.Fixed(avg)))
+	}
+	return blocktime.NewCalculator(e.src, opts...)
+}
+
+// emit writes v as indented JSON under -format=json, else calls text.
+func (e *env) emit(v any, text func(w io.Writer)) error {
+	if e.format == "json" {
+		enc := json.NewEncoder(e.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	text(e.out)
+	return nil
+}
+
+func parseLookbacks(s string) ([]int64, error) {
+	var out []int64
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.ReplaceAll(p, "_", ""), 10, 64)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid lookback %q, want a positive number of blocks", p)
+		}
+		out = append(out, n)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no lookbacks")
+	}
+	return out, nil
+}
+
+func joinInts(v []int64) string {
+	parts := make([]string, len(v))
+	for i, n := range v {
+		parts[i] = strconv.FormatInt(n, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func failf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", a...)
+	os.Exit(1)
+}
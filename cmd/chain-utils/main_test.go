@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the commands end to end through their
+// arguments and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("CHAIN_UTILS_RUN_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// genesisTime is block 0 of both test chains. Bor blocks come every 2s up
+// to borHead, Heimdall blocks every second up to heimdallHead.
+const (
+	genesisTime  = 1_700_000_000
+	borHead      = 1_000_000
+	heimdallHead = 500_000
+)
+
+func at(seconds int64) time.Time { return time.Unix(genesisTime+seconds, 0).UTC() }
+
+type borNode struct{}
+
+func (borNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params []any           `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	if req.Method == "eth_getBlockByNumber" {
+		h := int64(borHead)
+		if tag := req.Params[0].(string); tag != "latest" {
+			h, _ = strconv.ParseInt(strings.TrimPrefix(tag, "0x"), 16, 64)
+		}
+		resp["result"] = map[string]string{"number": fmt.Sprintf("0x%x", h), "timestamp": fmt.Sprintf("0x%x", at(2*h).Unix())}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+type heimdallNode struct{}
+
+func (heimdallNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/status":
+		fmt.Fprintf(w, `{"result":{"sync_info":{"latest_block_height":"%d","latest_block_time":%q}}}`, heimdallHead, at(heimdallHead).Format(time.RFC3339Nano))
+	case "/block":
+		h, _ := strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+		fmt.Fprintf(w, `{"result":{"block":{"header":{"time":%q}}}}`, at(h).Format(time.RFC3339Nano))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newServer(t *testing.T, h http.Handler) string {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs chain-utils with args and returns its stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "CHAIN_UTILS_RUN_MAIN=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+func TestETA(t *testing.T) {
+	bor := newServer(t, borNode{})
+
+	// 100 blocks past the head at 2s are 200s after it
+	stdout, stderr, err := run(t, "bor", "eta", "-rpc="+bor, "-lookbacks=1000", "-height=1000100")
+	if err != nil {
+		t.Fatalf("bor eta: %v\n%s", err, stderr)
+	}
+	for _, s := range []string{
+		"Current block : 1,000,000 — " + at(2_000_000).Format(time.RFC3339),
+		"Avg block     : 2.000000 s",
+		"Block 1,000,100 expected at " + at(2_000_200).Format(time.RFC3339),
+	} {
+		if !strings.Contains(stdout, s) {
+			t.Errorf("stdout lacks %q:\n%s", s, stdout)
+		}
+	}
+
+	// A block below the head was produced at its own time
+	stdout, stderr, err = run(t, "bor", "eta", "-rpc="+bor, "-lookbacks=1000", "-height=500", "-format=json")
+	if err != nil {
+		t.Fatalf("bor eta -format=json: %v\n%s", err, stderr)
+	}
+	var got struct {
+		Chain   string    `json:"chain"`
+		Height  int64     `json:"height"`
+		Reached bool      `json:"reached"`
+		At      time.Time `json:"at"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("%v\n%s", err, stdout)
+	}
+	if got.Chain != "bor" || got.Height != 500 || !got.Reached || !got.At.Equal(at(1000)) {
+		t.Errorf("got %+v", got)
+	}
+
+	// A replay answers from the recorded fixture and says so on stderr
+	_, stderr, err = run(t, "bor", "eta", "-replay=builtin:mainnet", "-height=1")
+	if err != nil || !strings.Contains(stderr, "replaying builtin:mainnet recorded") {
+		t.Errorf("-replay: %v\n%s", err, stderr)
+	}
+}
+
+func TestHFPlan(t *testing.T) {
+	bor, heimdall := newServer(t, borNode{}), newServer(t, heimdallNode{})
+
+	// Both chains tick evenly, so each window is one height: 100 more Bor
+	// blocks, and 1,500,200 more Heimdall blocks from its earlier head
+	target := at(2_000_200).Format(time.RFC3339)
+	stdout, stderr, err := run(t, "hf-plan", "-rpc="+bor, "-base="+heimdall, "-target="+target, "-bor-lookback=1000", "-heimdall-lookback=1000", "-format=json")
+	if err != nil {
+		t.Fatalf("hf-plan: %v\n%s", err, stderr)
+	}
+	var plan struct {
+		Confidence float64     `json:"confidence"`
+		Chains     []chainPlan `json:"chains"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &plan); err != nil {
+		t.Fatalf("%v\n%s", err, stdout)
+	}
+	want := map[string]int64{"bor": 1_000_100, "heimdall": 2_000_200}
+	if plan.Confidence != 0.9 || len(plan.Chains) != 2 {
+		t.Fatalf("plan %+v", plan)
+	}
+	for _, p := range plan.Chains {
+		if p.PredictedHeight != want[p.Chain] || p.LowHeight != p.PredictedHeight || p.HighHeight != p.PredictedHeight || p.Lookback != 1000 {
+			t.Errorf("%s = %+v, want height %d", p.Chain, p, want[p.Chain])
+		}
+	}
+
+	stdout, stderr, err = run(t, "hf-plan", "-rpc="+bor, "-base="+heimdall, "-target="+target, "-bor-lookback=1000", "-heimdall-lookback=1000", "-confidence=0.5")
+	if err != nil {
+		t.Fatalf("hf-plan text: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Predicted height : 1,000,100") || !strings.Contains(stdout, "50% window       : 2,000,200 – 2,000,200 (±0 blocks)") {
+		t.Errorf("stdout:\n%s", stdout)
+	}
+
+	// A target before a head is refused for that chain
+	if _, stderr, err := run(t, "hf-plan", "-rpc="+bor, "-base="+heimdall, "-target="+at(1_000_000).Format(time.RFC3339), "-bor-lookback=1000", "-heimdall-lookback=1000"); err == nil || !strings.Contains(stderr, "bor: target "+at(1_000_000).Format(time.RFC3339)+" is not after the head block 1000000") {
+		t.Errorf("past target: %v\n%s", err, stderr)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	bor := newServer(t, borNode{})
+
+	// Output that isn't a terminal gets one record per poll, and a height
+	// already produced ends the watch after the first
+	done := make(chan struct{})
+	var stdout, stderr string
+	var err error
+	go func() {
+		stdout, stderr, err = run(t, "bor", "watch", "-rpc="+bor, "-lookbacks=1000", "-height=999000", "-format=json")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("watch of a reached height did not exit")
+	}
+	if err != nil {
+		t.Fatalf("watch: %v\n%s", err, stderr)
+	}
+	var s watchState
+	if err := json.Unmarshal([]byte(stdout), &s); err != nil {
+		t.Fatalf("%v\n%s", err, stdout)
+	}
+	if s.Chain != "bor" || !s.Reached || s.TargetHeight != 999_000 || s.HeadHeight != borHead || !s.TargetTime.Equal(at(1_998_000)) {
+		t.Errorf("got %+v", s)
+	}
+}
+
+func TestScripts(t *testing.T) {
+	// A script is handed the arguments after its name, under its own name
+	_, stderr, err := run(t, "prediction-accuracy", "-h")
+	if err != nil || !strings.Contains(stderr, "Usage of chain-utils prediction-accuracy:") || !strings.Contains(stderr, "-ledger") {
+		t.Errorf("prediction-accuracy -h: %v\n%s", err, stderr)
+	}
+	ledger := filepath.Join(t.TempDir(), "ledger.jsonl")
+	if err := os.WriteFile(ledger, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, err := run(t, "prediction-accuracy", "-ledger="+ledger, "-format=yaml"); err == nil || !strings.Contains(stderr, `unknown format "yaml"`) {
+		t.Errorf("prediction-accuracy -format=yaml: %v\n%s", err, stderr)
+	}
+
+	// Anything else is a usage error listing every command
+	for _, args := range [][]string{nil, {"bor"}, {"polygon", "eta"}, {"bor", "hf-slot"}} {
+		_, stderr, err := run(t, args...)
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) || exit.ExitCode() != 2 {
+			t.Errorf("%v: %v, want exit 2", args, err)
+		}
+		for _, s := range []string{"usage: chain-utils <command> [flags]", "block-history", "bor_hf_block_calculator.go", "watch"} {
+			if !strings.Contains(stderr, s) {
+				t.Errorf("%v: usage lacks %q:\n%s", args, s, stderr)
+			}
+		}
+	}
+}
+
+func TestInput(t *testing.T) {
+	bor := newServer(t, borNode{})
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"bor", "eta", "-rpc=" + bor}, "-height is required"},
+		{[]string{"bor", "eta", "-rpc=" + bor, "-height=1", "-format=yaml"}, `unknown -format "yaml"`},
+		{[]string{"bor", "eta", "-rpc=" + bor, "-height=1", "-lookbacks=0"}, `-lookbacks: invalid lookback "0"`},
+		{[]string{"bor", "eta", "-rpc=" + bor, "-height=1", "-lookbacks=,"}, "-lookbacks: no lookbacks"},
+		{[]string{"bor", "eta", "-rpc=" + bor, "-height=1", "-avg=-2"}, "-avg must be a positive number"},
+		{[]string{"bor", "eta", "-height=1", "-replay=builtin:mumbai"}, "-replay:"},
+		{[]string{"bor", "watch", "-rpc=" + bor}, "pass one of -height or -target"},
+		{[]string{"bor", "watch", "-rpc=" + bor, "-height=1", "-target=2025-01-01T00:00:00Z"}, "pass one of -height or -target"},
+		{[]string{"bor", "watch", "-rpc=" + bor, "-target=tomorrow"}, `unsupported time format "tomorrow"`},
+		{[]string{"bor", "watch", "-rpc=" + bor, "-height=1", "-interval=500ms"}, "-interval must be at least 1s"},
+		{[]string{"hf-plan"}, "-target is required"},
+		{[]string{"hf-plan", "-target=2025-10-07"}, `unsupported time format "2025-10-07"`},
+		{[]string{"hf-plan", "-target=2025-10-07T14:00:00Z", "-confidence=1"}, "-confidence must be between 0 and 1"},
+		{[]string{"hf-plan", "-target=2025-10-07T14:00:00Z", "-bor-lookback=19"}, "must be at least 20 blocks"},
+	}
+	for _, tt := range tests {
+		if _, stderr, err := run(t, tt.args...); err == nil || !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: %v\n%s", tt.args, err, stderr)
+		}
+	}
+}
+
+// releaseServer serves a GitHub-style release v2.0.0 of this platform's
+// binary, its checksums.txt and, with a key, checksums.txt.sig.
+type releaseServer struct {
+	binary []byte // what the asset serves
+	sums   []byte // checksums.txt
+	key    ed25519.PrivateKey
+	assets []string
+}
+
+func newReleaseServer(t *testing.T, binary []byte, key ed25519.PrivateKey) (*releaseServer, string) {
+	sum := sha256.Sum256(binary)
+	rs := &releaseServer{
+		binary: binary,
+		sums:   []byte(fmt.Sprintf("%x  chain-utils_other_arch\n%x  %s\n", sha256.Sum256(nil), sum, assetName())),
+		key:    key,
+		assets: []string{assetName(), "checksums.txt"},
+	}
+	if key != nil {
+		rs.assets = append(rs.assets, "checksums.txt.sig")
+	}
+	return rs, newServer(t, rs)
+}
+
+func (rs *releaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/releases/latest", "/releases/tags/v2.0.0":
+		var assets []map[string]string
+		for _, a := range rs.assets {
+			assets = append(assets, map[string]string{"name": a, "browser_download_url": "http://" + r.Host + "/download/" + a})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"tag_name": "v2.0.0", "assets": assets})
+	case "/download/" + assetName():
+		w.Write(rs.binary)
+	case "/download/checksums.txt":
+		w.Write(rs.sums)
+	case "/download/checksums.txt.sig":
+		w.Write(ed25519.Sign(rs.key, rs.sums))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestSelfUpdate(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	pubkey := "-pubkey=" + base64.StdEncoding.EncodeToString(pub)
+	install := func(t *testing.T) string {
+		t.Helper()
+		exe := filepath.Join(t.TempDir(), "chain-utils")
+		if err := os.WriteFile(exe, []byte("old binary"), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		return exe
+	}
+	// untouched checks that a refused update left exe and its directory
+	// as they were
+	untouched := func(t *testing.T, exe string) {
+		t.Helper()
+		if b, _ := os.ReadFile(exe); string(b) != "old binary" {
+			t.Errorf("binary is now %q", b)
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(exe)); len(entries) != 1 {
+			t.Errorf("update left %d files behind", len(entries)-1)
+		}
+	}
+
+	t.Run("signed", func(t *testing.T) {
+		_, u := newReleaseServer(t, []byte("new binary"), priv)
+		exe := install(t)
+		stdout, stderr, err := run(t, "self-update", "-releases="+u+"/releases", "-path="+exe, pubkey)
+		if err != nil {
+			t.Fatalf("self-update: %v\n%s", err, stderr)
+		}
+		if want := "to v2.0.0 (checksum and signature verified)"; !strings.Contains(stdout, want) {
+			t.Errorf("stdout lacks %q:\n%s", want, stdout)
+		}
+		info, _ := os.Stat(exe)
+		if b, _ := os.ReadFile(exe); string(b) != "new binary" || info.Mode().Perm() != 0o751 {
+			t.Errorf("binary is %q, mode %v", b, info.Mode())
+		}
+		// -check compares with the running binary, an unversioned build
+		if stdout, _, err := run(t, "self-update", "-releases="+u+"/releases", "-path="+exe, pubkey, "-check"); err == nil || !strings.Contains(stdout, "chain-utils v2.0.0 is available") {
+			t.Errorf("-check: %v\n%s", err, stdout)
+		}
+	})
+
+	t.Run("checksum only", func(t *testing.T) {
+		_, u := newReleaseServer(t, []byte("new binary"), nil)
+		exe := install(t)
+		stdout, stderr, err := run(t, "self-update", "-releases="+u+"/releases", "-path="+exe, "-version=v2.0.0")
+		if err != nil || !strings.Contains(stdout, "(checksum verified)") {
+			t.Fatalf("self-update: %v\n%s%s", err, stdout, stderr)
+		}
+	})
+
+	tests := []struct {
+		name  string
+		setup func(rs *releaseServer)
+		args  []string
+		want  string
+	}{
+		{"tampered binary", func(rs *releaseServer) { rs.binary = []byte("evil binary") }, []string{pubkey}, "download has SHA-256"},
+		{"tampered checksums", func(rs *releaseServer) {
+			rs.binary = []byte("evil binary")
+			sum := sha256.Sum256(rs.binary)
+			rs.sums = []byte(fmt.Sprintf("%x  %s\n", sum, assetName()))
+		}, []string{"-pubkey=" + base64.StdEncoding.EncodeToString(func() []byte { p, _, _ := ed25519.GenerateKey(nil); return p }())}, "checksums.txt.sig does not match the release key"},
+		{"unsigned release", func(rs *releaseServer) { rs.assets = rs.assets[:2] }, []string{pubkey}, "refusing an unsigned release"},
+		{"no checksums", func(rs *releaseServer) { rs.assets = rs.assets[:1] }, nil, "refusing an unverified binary"},
+		{"no build", func(rs *releaseServer) { rs.assets = rs.assets[1:] }, nil, "has no " + runtime.GOOS + "/" + runtime.GOARCH + " build"},
+		{"no checksum line", func(rs *releaseServer) { rs.sums = []byte("00  chain-utils_other_arch\n") }, nil, "checksums.txt has no checksum for " + assetName()},
+		{"unknown tag", func(rs *releaseServer) {}, []string{"-version=v9.9.9"}, "HTTP 404"},
+		{"bad key", func(rs *releaseServer) {}, []string{"-pubkey=abc"}, "-pubkey: not a base64 ed25519 public key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, u := newReleaseServer(t, []byte("new binary"), priv)
+			tt.setup(rs)
+			exe := install(t)
+			args := append([]string{"self-update", "-releases=" + u + "/releases", "-path=" + exe}, tt.args...)
+			if _, stderr, err := run(t, args...); err == nil || !strings.Contains(stderr, tt.want) {
+				t.Errorf("%v: %v\n%s", tt.args, err, stderr)
+			}
+			untouched(t, exe)
+		})
+	}
+}
+
+func TestParseLookbacks(t *testing.T) {
+	got, err := parseLookbacks(" 1_000, ,40000 ")
+	if err != nil || joinInts(got) != "1000,40000" {
+		t.Errorf("parseLookbacks = %v, %v", got, err)
+	}
+	if s := findScript([]string{"heimdall", "eta", "-height=1"}); s == nil || s.source != "heimdall_block_time_estimator.go" {
+		t.Errorf("heimdall eta found %+v", s)
+	}
+	if s := findScript([]string{"bor", "eta"}); s != nil {
+		t.Errorf("bor eta found script %s", s.source)
+	}
+}
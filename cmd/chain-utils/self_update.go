@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// version is the release this binary was built as, set by the release
+// build with -ldflags "-X main.version=v1.2.3". A go install @version
+// build reports its module version instead.
+var version = ""
+
+// releaseKey is the base64 ed25519 public key the release build signs
+// checksums.txt with, set with -ldflags "-X main.releaseKey=...". When it
+// is set, self-update refuses a release without a valid signature.
+var releaseKey = ""
+
+// releasesURL is the GitHub releases API of this repository.
+const releasesURL = "https://api.github.com/repos/pratikspatil024/chain-utils/releases"
+
+// release is the part of a GitHub release self-update reads.
+type release struct {
+	Tag    string `json:"tag_name"`
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r *release) asset(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// assetName is the release asset built for this platform, e.g.
+// chain-utils_linux_amd64.
+func assetName() string {
+	name := "chain-utils_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// currentVersion is version, else the module version go install recorded,
+// else "dev".
+func currentVersion() string {
+	if version != "" {
+		return version
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		return bi.Main.Version
+	}
+	return "dev"
+}
+
+// selfUpdate runs "chain-utils self-update", which replaces the binary with
+// a release's build for this platform once its SHA-256 matches the
+// release's checksums.txt, and, with a release key, once checksums.txt
+// carries a valid signature. Ops hosts without a Go toolchain update this
+// way.
+func selfUpdate(args []string) {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	endpoint := fs.String("releases", releasesURL, "GitHub releases API to update from, e.g. a mirror's")
+	tag := fs.String("version", "", "Release tag to install (default: the latest release)")
+	check := fs.Bool("check", false, "Only report whether a newer release exists; exit 1 if one does")
+	force := fs.Bool("force", false, "Reinstall even when the release is the running version")
+	pubkey := fs.String("pubkey", releaseKey, "Base64 ed25519 key checksums.txt must be signed with (default: the key built in; empty checks the checksum only)")
+	path := fs.String("path", "", "Binary to replace (default: this one)")
+	timeout := fs.Duration("timeout", 5*time.Minute, "Time allowed for the whole update")
+	fs.Parse(args)
+
+	var key ed25519.PublicKey
+	if *pubkey != "" {
+		b, err := base64.StdEncoding.DecodeString(*pubkey)
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			failf("-pubkey: not a base64 ed25519 public key")
+		}
+		key = b
+	}
+	exe := *path
+	if exe == "" {
+		var err error
+		if exe, err = os.Executable(); err != nil {
+			failf("find this binary: %v", err)
+		}
+	}
+	// Replace the file a symlink such as /usr/local/bin/chain-utils points
+	// at, not the link
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	client := &http.Client{}
+	u := strings.TrimRight(*endpoint, "/") + "/latest"
+	if *tag != "" {
+		u = strings.TrimRight(*endpoint, "/") + "/tags/" + *tag
+	}
+	body, err := download(ctx, client, u, 1<<20)
+	if err != nil {
+		failf("check release: %v", err)
+	}
+	var rel release
+	if err := json.Unmarshal(body, &rel); err != nil || rel.Tag == "" {
+		failf("check release: %s is not a GitHub release", u)
+	}
+
+	cur := currentVersion()
+	if *check {
+		if rel.Tag == cur {
+			fmt.Printf("chain-utils %s is the latest release\n", cur)
+			return
+		}
+		fmt.Printf("chain-utils %s is available (running %s)\n", rel.Tag, cur)
+		os.Exit(1)
+	}
+	if rel.Tag == cur && !*force {
+		fmt.Printf("chain-utils %s is already installed\n", cur)
+		return
+	}
+
+	name := assetName()
+	assetURL, sumsURL := rel.asset(name), rel.asset("checksums.txt")
+	if assetURL == "" {
+		failf("release %s has no %s build (%s)", rel.Tag, runtime.GOOS+"/"+runtime.GOARCH, name)
+	}
+	if sumsURL == "" {
+		failf("release %s has no checksums.txt; refusing an unverified binary", rel.Tag)
+	}
+	sums, err := download(ctx, client, sumsURL, 1<<20)
+	if err != nil {
+		failf("download checksums.txt: %v", err)
+	}
+	if key != nil {
+		sigURL := rel.asset("checksums.txt.sig")
+		if sigURL == "" {
+			failf("release %s has no checksums.txt.sig; refusing an unsigned release", rel.Tag)
+		}
+		sig, err := download(ctx, client, sigURL, 1<<10)
+		if err != nil {
+			failf("download checksums.txt.sig: %v", err)
+		}
+		if err := verifySignature(key, sums, sig); err != nil {
+			failf("release %s: %v", rel.Tag, err)
+		}
+	}
+	want, err := checksumOf(sums, name)
+	if err != nil {
+		failf("release %s: %v", rel.Tag, err)
+	}
+	if err := replaceBinary(ctx, client, assetURL, want, exe); err != nil {
+		failf("update %s: %v", exe, err)
+	}
+	how := "checksum verified"
+	if key != nil {
+		how = "checksum and signature verified"
+	}
+	fmt.Printf("updated %s from %s to %s (%s)\n", exe, cur, rel.Tag, how)
+}
+
+// download GETs u, failing on a non-200 answer or a body over limit bytes.
+func download(ctx context.Context, client *http.Client, u string, limit int64) ([]byte, error) {
+	resp, err := get(ctx, client, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("%s is over %d bytes", u, limit)
+	}
+	return b, nil
+}
+
+func get(ctx context.Context, client *http.Client, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json, application/octet-stream")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: HTTP %d", u, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// verifySignature checks sig, a raw or base64 ed25519 signature as
+// openssl pkeyutl -sign writes it, over checksums.txt.
+func verifySignature(key ed25519.PublicKey, sums, sig []byte) error {
+	if len(sig) != ed25519.SignatureSize {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil || len(b) != ed25519.SignatureSize {
+			return errors.New("checksums.txt.sig is not an ed25519 signature")
+		}
+		sig = b
+	}
+	if !ed25519.Verify(key, sums, sig) {
+		return errors.New("checksums.txt.sig does not match the release key")
+	}
+	return nil
+}
+
+// checksumOf returns name's SHA-256 from checksums.txt, in sha256sum's
+// "<hex>  <name>" format.
+func checksumOf(sums []byte, name string) ([]byte, error) {
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("checksums.txt: bad checksum for %s", name)
+		}
+		return sum, nil
+	}
+	return nil, fmt.Errorf("checksums.txt has no checksum for %s", name)
+}
+
+// replaceBinary downloads the new binary next to exe, so the final rename
+// stays on one filesystem, and renames it over exe only once its SHA-256
+// is want. A failed update leaves exe as it was.
+func replaceBinary(ctx context.Context, client *http.Client, u string, want []byte, exe string) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".chain-utils-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	resp, err := get(ctx, client, u)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	resp.Body.Close()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		return fmt.Errorf("download has SHA-256 %x, checksums.txt says %x", got, want)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0o111); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		// A running .exe cannot be replaced, only renamed out of the way
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), exe)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/pkg/human"
+)
+
+// watchState is what one poll of the watch command learned.
+type watchState struct {
+	Chain        string    `json:"chain"`
+	PolledAt     time.Time `json:"polled_at"`
+	HeadHeight   int64     `json:"head_height"`
+	HeadTime     time.Time `json:"head_time"`
+	AvgBlockTime float64   `json:"avg_block_time_seconds"`
+	TargetHeight int64     `json:"target_height"`
+	TargetTime   time.Time `json:"target_time"`
+	BlocksLeft   int64     `json:"blocks_left"`
+	Reached      bool      `json:"reached"`
+}
+
+func watch(fs *flag.FlagSet) func(context.Context, *env) error {
+	height := fs.Int64("height", -1, "Height to count down to")
+	targetStr := fs.String("target", "", "Time in RFC3339 to count down to, with the height expected then")
+	interval := fs.Duration("interval", 10*time.Second, "How often the chain is polled")
+	avg := fs.Float64("avg", 0, "Average block time in seconds (default: measured over the shortest -lookbacks at every poll)")
+	return func(ctx context.Context, e *env) error {
+		var target time.Time
+		switch {
+		case (*height >= 0) == (*targetStr != ""):
+			return fmt.Errorf("pass one of -height or -target")
+		case *targetStr != "":
+			var err error
+			if target, err = time.Parse(time.RFC3339Nano, strings.TrimSpace(*targetStr)); err != nil {
+				return fmt.Errorf("unsupported time format %q (use RFC3339/RFC3339Nano, e.g. 2025-10-07T14:00:00Z)", *targetStr)
+			}
+		}
+		if *interval < time.Second {
+			return fmt.Errorf("-interval must be at least 1s, got %s", *interval)
+		}
+		calc, err := e.calculator(*avg, "")
+		if err != nil {
+			return err
+		}
+		poll := func() (watchState, error) {
+			if *height >= 0 {
+				t, err := calc.ETA(ctx, *height)
+				if err != nil {
+					return watchState{}, err
+				}
+				return watchState{e.chain.name, time.Now().UTC(), t.Head.Height, t.Head.Time, t.BlockTime, t.Height, t.At, t.Height - t.Head.Height, t.Reached}, nil
+			}
+			p, err := calc.Predict(ctx, target)
+			if err != nil {
+				return watchState{}, err
+			}
+			return watchState{e.chain.name, time.Now().UTC(), p.Head.Height, p.Head.Time, p.BlockTime, p.Height, p.At.UTC(), p.Height - p.Head.Height, !p.At.After(p.Head.Time)}, nil
+		}
+
+		// JSON and non-terminal output get one record per poll; a terminal
+		// gets a display redrawn every second between polls
+		redraw := e.format == "text" && isTerminal(e.out)
+		var s watchState
+		var pollErr error
+		next := time.Now()
+		tick := time.NewTicker(time.Second)
+		defer tick.Stop()
+		for {
+			if !time.Now().Before(next) {
+				next = time.Now().Add(*interval)
+				if st, err := poll(); err != nil {
+					pollErr = err
+				} else {
+					s, pollErr = st, nil
+				}
+				if redraw && pollErr != nil && s.PolledAt.IsZero() {
+					fmt.Fprintf(os.Stderr, "error: %v\n", pollErr)
+				}
+				if !redraw {
+					if pollErr != nil {
+						fmt.Fprintf(os.Stderr, "error: %v\n", pollErr)
+					} else if e.format == "json" {
+						json.NewEncoder(e.out).Encode(s)
+					} else {
+						printWatch(e.out, s, pollErr)
+						fmt.Fprintln(e.out)
+					}
+				}
+				if s.Reached && pollErr == nil {
+					if redraw {
+						fmt.Fprint(e.out, "\033[H\033[2J")
+						printWatch(e.out, s, nil)
+					}
+					return nil
+				}
+			}
+			if redraw && !s.PolledAt.IsZero() {
+				fmt.Fprint(e.out, "\033[H\033[2J")
+				printWatch(e.out, s, pollErr)
+				fmt.Fprintf(e.out, "\nNext poll in %ds. Ctrl-C to stop.\n", int(time.Until(next).Seconds()+0.5))
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-tick.C:
+			}
+		}
+	}
+}
+
+// printWatch renders one state, counting down to its target from now.
+func printWatch(w io.Writer, s watchState, pollErr error) {
+	fmt.Fprintf(w, "Current block : %s — %s (UTC)\n", human.Commas(s.HeadHeight), s.HeadTime.Format(time.RFC3339))
+	if s.Reached {
+		fmt.Fprintf(w, "Target        : block %s at %s (UTC) — reached\n", human.Commas(s.TargetHeight), s.TargetTime.Format(time.RFC3339))
+		return
+	}
+	fmt.Fprintf(w, "Target        : block %s at %s (UTC)\n", human.Commas(s.TargetHeight), s.TargetTime.Format(time.RFC3339))
+	fmt.Fprintf(w, "Avg block     : %.6f s\n", s.AvgBlockTime)
+	fmt.Fprintf(w, "Blocks left   : %s\n", human.Commas(s.BlocksLeft))
+	fmt.Fprintf(w, "Countdown     : %s\n", human.DHMS(max(time.Until(s.TargetTime), 0)))
+	if pollErr != nil {
+		fmt.Fprintf(w, "\nLast poll failed (%v); showing the poll of %s\n", pollErr, s.PolledAt.Format(time.RFC3339))
+	}
+}
+
+// isTerminal reports whether w is a terminal the display can be redrawn on.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,12 @@
+//go:build ignore
+
+// go run eth_hf_slot_calculator.go -target="2025-12-03T21:49:11Z"
+// go run eth_hf_slot_calculator.go -rpc="https://ethereum-sepolia-rpc.publicnode.com" -network=sepolia -target="2025-10-14T07:36:00Z"
+// go run eth_hf_slot_calculator.go -target="2025-12-03T21:49:11Z" -sample=7200 -confidence=0.95
+// go run eth_hf_slot_calculator.go -target="2025-12-03T20:00:00Z" -beacon="https://ethereum-beacon-api.publicnode.com" -window=4h
+
+package main
+
+import "github.com/pratikspatil024/chain-utils/internal/ethhf"
+
+func main() { ethhf.Main() }
@@ -0,0 +1,11 @@
+//go:build ignore
+
+// go run finality_check.go
+// go run finality_check.go -rpc="https://polygon-rpc.com,https://polygon-bor-rpc.publicnode.com" -max-lag=32
+// go run finality_check.go -rpc="$AMOY_RPC" -heimdall-rest="https://heimdall-api-amoy.polygon.technology"
+
+package main
+
+import "github.com/pratikspatil024/chain-utils/internal/finalitycheck"
+
+func main() { finalitycheck.Main() }
@@ -0,0 +1,244 @@
+// Package fixtures holds the small per-network datasets behind -replay, and
+// the HTTP transports that answer Bor JSON-RPC and Heimdall's Tendermint API
+// from them, so every tool can be tried without network access or API keys:
+//
+//	f, err := fixtures.Load("builtin:amoy")
+//	if err != nil { ... }
+//	rt, err := fixtures.NewBorRPC(f)
+//	client := &http.Client{Transport: rt}
+//
+// Record a fixture from live endpoints with
+// `go run fixtures/record_fixtures.go -network=amoy`.
+package fixtures
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+)
+
+// builtin are the datasets Load reads for builtin:<network>.
+//
+//go:embed *.json
+var builtin embed.FS
+
+// Fixture is a small dataset of one network: a sparse set of Bor and
+// Heimdall blocks, the last of each being its head. Heights between two
+// listed blocks get interpolated times, so every lookback and search works.
+type Fixture struct {
+	Network    string    `json:"network"`
+	Note       string    `json:"note"`
+	RecordedAt time.Time `json:"recorded_at"`
+	Bor        struct {
+		ChainID      uint64     `json:"chain_id"`
+		FinalizedLag int64      `json:"finalized_lag"`
+		Blocks       [][2]int64 `json:"blocks"` // height, unix seconds
+	} `json:"bor"`
+	Heimdall struct {
+		Network string     `json:"network"`
+		Blocks  [][2]int64 `json:"blocks"` // height, unix milliseconds
+	} `json:"heimdall"`
+}
+
+// Load reads builtin:<network> or a fixture file.
+func Load(spec string) (*Fixture, error) {
+	var raw []byte
+	var err error
+	if name, ok := strings.CutPrefix(spec, "builtin:"); ok {
+		if raw, err = builtin.ReadFile(name + ".json"); err != nil {
+			return nil, fmt.Errorf("no builtin fixture %q (use builtin:mainnet or builtin:amoy)", name)
+		}
+	} else if raw, err = os.ReadFile(spec); err != nil {
+		return nil, err
+	}
+	var f Fixture
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", spec, err)
+	}
+	return &f, nil
+}
+
+// Banner is the line a tool prints on stderr when it starts replaying spec.
+func (f *Fixture) Banner(spec string) string {
+	return fmt.Sprintf("replaying %s recorded %s, shifted so its head is now. %s", spec, f.RecordedAt.Format(time.DateOnly), f.Note)
+}
+
+// interpolate returns the time of height h from blocks (sorted by height),
+// and false when h is above the head. Heights below the first block are
+// extrapolated at the fixture's overall rate, so searches that start at
+// genesis still work.
+func interpolate(blocks [][2]int64, h int64) (int64, bool) {
+	i := sort.Search(len(blocks), func(i int) bool { return blocks[i][0] >= h })
+	switch {
+	case i == len(blocks) || h < 0:
+		return 0, false
+	case blocks[i][0] == h:
+		return blocks[i][1], true
+	case i == 0:
+		i = len(blocks) - 1
+	}
+	lo, hi := blocks[i-1], blocks[i]
+	if h < lo[0] {
+		lo, hi = blocks[0], blocks[len(blocks)-1]
+	}
+	return lo[1] + (hi[1]-lo[1])*(h-lo[0])/(hi[0]-lo[0]), true
+}
+
+// response wraps a JSON body as an HTTP response to req.
+func response(req *http.Request, status int, v any) *http.Response {
+	b, _ := json.Marshal(v)
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(b)),
+		Request:    req,
+	}
+}
+
+// borRPC answers Bor JSON-RPC from a fixture, with every time shifted so
+// that the fixture's head was produced when it was created.
+type borRPC struct {
+	f     *Fixture
+	shift int64
+}
+
+// NewBorRPC returns a transport answering Bor JSON-RPC from f: the chain id,
+// the head and blocks by number or tag. Other methods fail as not available.
+func NewBorRPC(f *Fixture) (http.RoundTripper, error) {
+	if len(f.Bor.Blocks) == 0 {
+		return nil, fmt.Errorf("fixture %s has no Bor blocks", f.Network)
+	}
+	head := f.Bor.Blocks[len(f.Bor.Blocks)-1]
+	return &borRPC{f: f, shift: time.Now().Unix() - head[1]}, nil
+}
+
+func (r *borRPC) RoundTrip(req *http.Request) (*http.Response, error) {
+	var call struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &call); err != nil {
+		return response(req, http.StatusBadRequest, map[string]any{"error": "replay only answers single JSON-RPC calls"}), nil
+	}
+	resp := map[string]any{"jsonrpc": "2.0", "id": call.ID}
+	blocks := r.f.Bor.Blocks
+	head := blocks[len(blocks)-1][0]
+	switch call.Method {
+	case "eth_chainId":
+		resp["result"] = fmt.Sprintf("0x%x", r.f.Bor.ChainID)
+	case "eth_blockNumber":
+		resp["result"] = fmt.Sprintf("0x%x", head)
+	case "eth_getBlockByNumber":
+		var tag string
+		if len(call.Params) > 0 {
+			json.Unmarshal(call.Params[0], &tag)
+		}
+		var h int64
+		switch tag {
+		case "latest", "pending":
+			h = head
+		case "finalized", "safe":
+			h = head - r.f.Bor.FinalizedLag
+		case "earliest":
+			h = blocks[0][0]
+		default:
+			n, err := ethrpc.HexToUint64(tag)
+			if err != nil {
+				resp["error"] = map[string]any{"code": -32602, "message": fmt.Sprintf("invalid block number %q", tag)}
+				break
+			}
+			h = int64(n)
+		}
+		if resp["error"] != nil {
+			break
+		}
+		ts, ok := interpolate(blocks, h)
+		if !ok {
+			resp["result"] = nil
+			break
+		}
+		resp["result"] = map[string]string{
+			"number":     fmt.Sprintf("0x%x", h),
+			"hash":       r.hash(h),
+			"parentHash": r.hash(h - 1),
+			"timestamp":  fmt.Sprintf("0x%x", ts+r.shift),
+		}
+	default:
+		resp["error"] = map[string]any{"code": -32601, "message": fmt.Sprintf("the method %s is not available when replaying", call.Method)}
+	}
+	return response(req, http.StatusOK, resp), nil
+}
+
+// hash is a stable stand-in block hash, so parent links still line up.
+func (r *borRPC) hash(h int64) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/bor/%d", r.f.Network, h)))
+	return "0x" + hex.EncodeToString(sum[:])
+}
+
+// tendermint answers Heimdall's Tendermint API from a fixture, with every
+// time shifted so that the fixture's head was produced when it was created.
+type tendermint struct {
+	f     *Fixture
+	shift int64 // milliseconds
+}
+
+// NewTendermint returns a transport answering Heimdall's Tendermint /status
+// and /block from f. Other paths answer 404.
+func NewTendermint(f *Fixture) (http.RoundTripper, error) {
+	if len(f.Heimdall.Blocks) == 0 {
+		return nil, fmt.Errorf("fixture %s has no Heimdall blocks", f.Network)
+	}
+	head := f.Heimdall.Blocks[len(f.Heimdall.Blocks)-1]
+	return &tendermint{f: f, shift: time.Now().UnixMilli() - head[1]}, nil
+}
+
+func (r *tendermint) RoundTrip(req *http.Request) (*http.Response, error) {
+	blocks := r.f.Heimdall.Blocks
+	at := func(ms int64) string { return time.UnixMilli(ms + r.shift).UTC().Format(time.RFC3339Nano) }
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/status"):
+		head := blocks[len(blocks)-1]
+		return response(req, http.StatusOK, map[string]any{"result": map[string]any{
+			"node_info": map[string]string{"network": r.f.Heimdall.Network},
+			"sync_info": map[string]string{
+				"latest_block_height":   strconv.FormatInt(head[0], 10),
+				"latest_block_time":     at(head[1]),
+				"earliest_block_height": strconv.FormatInt(blocks[0][0], 10),
+			},
+		}}), nil
+	case strings.HasSuffix(req.URL.Path, "/block"):
+		h, err := strconv.ParseInt(req.URL.Query().Get("height"), 10, 64)
+		if err != nil {
+			return response(req, http.StatusBadRequest, map[string]any{"error": "invalid height"}), nil
+		}
+		ms, ok := interpolate(blocks, h)
+		if !ok {
+			return response(req, http.StatusInternalServerError, map[string]any{"error": fmt.Sprintf("height %d is not in the replayed fixture", h)}), nil
+		}
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s/heimdall/%d", r.f.Network, h)))
+		return response(req, http.StatusOK, map[string]any{"result": map[string]any{
+			"block_id": map[string]string{"hash": strings.ToUpper(hex.EncodeToString(sum[:]))},
+			"block":    map[string]any{"header": map[string]string{"height": strconv.FormatInt(h, 10), "time": at(ms)}},
+		}}), nil
+	}
+	return response(req, http.StatusNotFound, map[string]any{"error": req.URL.Path + " is not available when replaying"}), nil
+}
@@ -0,0 +1,148 @@
+package fixtures
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+)
+
+func TestLoad(t *testing.T) {
+	for _, name := range []string{"amoy", "mainnet"} {
+		f, err := Load("builtin:" + name)
+		if err != nil {
+			t.Fatalf("Load(builtin:%s): %v", name, err)
+		}
+		if f.Network != name || len(f.Bor.Blocks) == 0 || len(f.Heimdall.Blocks) == 0 {
+			t.Errorf("builtin:%s = network %q with %d Bor and %d Heimdall blocks", name, f.Network, len(f.Bor.Blocks), len(f.Heimdall.Blocks))
+		}
+	}
+	if _, err := Load("builtin:sepolia"); err == nil || !strings.Contains(err.Error(), "use builtin:mainnet or builtin:amoy") {
+		t.Errorf("Load(builtin:sepolia) error = %v, want the builtin fixtures named", err)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	blocks := [][2]int64{{100, 1000}, {200, 1200}, {300, 1300}}
+	tests := []struct {
+		h    int64
+		want int64
+		ok   bool
+	}{
+		{100, 1000, true},
+		{150, 1100, true},
+		{250, 1250, true},
+		{300, 1300, true},
+		{0, 850, true}, // below the first block, at the overall 1.5 blocks/s
+		{301, 0, false},
+		{-1, 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := interpolate(blocks, tt.h); got != tt.want || ok != tt.ok {
+			t.Errorf("interpolate(%d) = %d, %v, want %d, %v", tt.h, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBorRPC(t *testing.T) {
+	f, err := Load("builtin:amoy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := NewBorRPC(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ethrpc.New("http://replay.invalid", ethrpc.WithHTTPClient(&http.Client{Transport: rt}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if id, err := c.ChainID(ctx); err != nil || id != f.Bor.ChainID {
+		t.Errorf("ChainID = %d, %v, want %d", id, err, f.Bor.ChainID)
+	}
+	head, err := c.HeaderByTag(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := uint64(f.Bor.Blocks[len(f.Bor.Blocks)-1][0]); head.Number != want {
+		t.Errorf("head = %d, want %d", head.Number, want)
+	}
+	// the head is shifted to now
+	if age := time.Since(head.Time); age < -time.Second || age > time.Minute {
+		t.Errorf("head is %s old, want just produced", age)
+	}
+	fin, err := c.HeaderByTag(ctx, "finalized")
+	if err != nil || head.Number-fin.Number != uint64(f.Bor.FinalizedLag) {
+		t.Errorf("finalized = %d, %v, want %d below the head", fin.Number, err, f.Bor.FinalizedLag)
+	}
+	var r json.RawMessage
+	if err := c.Call(ctx, &r, "eth_getLogs"); err == nil || !strings.Contains(err.Error(), "not available when replaying") {
+		t.Errorf("eth_getLogs error = %v, want it unavailable", err)
+	}
+}
+
+func TestTendermint(t *testing.T) {
+	f, err := Load("builtin:mainnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := NewTendermint(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rt}
+	head := f.Heimdall.Blocks[len(f.Heimdall.Blocks)-1][0]
+	get := func(path string, out any) int {
+		t.Helper()
+		resp, err := client.Get("http://replay.invalid" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatalf("decode %s: %v", path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+	var status struct {
+		Result struct {
+			NodeInfo struct {
+				Network string `json:"network"`
+			} `json:"node_info"`
+			SyncInfo struct {
+				Height string `json:"latest_block_height"`
+			} `json:"sync_info"`
+		} `json:"result"`
+	}
+	get("/status", &status)
+	if status.Result.NodeInfo.Network != f.Heimdall.Network || status.Result.SyncInfo.Height != strconv.FormatInt(head, 10) {
+		t.Errorf("/status = %+v, want %s at %d", status.Result, f.Heimdall.Network, head)
+	}
+	var block struct {
+		Result struct {
+			Block struct {
+				Header struct {
+					Height string `json:"height"`
+				} `json:"header"`
+			} `json:"block"`
+		} `json:"result"`
+	}
+	below := strconv.FormatInt(head-1000, 10)
+	if code := get("/block?height="+below, &block); code != http.StatusOK || block.Result.Block.Header.Height != below {
+		t.Errorf("/block?height=%s = %d %+v", below, code, block.Result)
+	}
+	if code := get("/block?height="+strconv.FormatInt(head+1, 10), nil); code != http.StatusInternalServerError {
+		t.Errorf("/block above the head = %d, want 500", code)
+	}
+	if code := get("/checkpoints/latest", nil); code != http.StatusNotFound {
+		t.Errorf("/checkpoints/latest = %d, want 404", code)
+	}
+}
@@ -0,0 +1,136 @@
+// Package accuracy is prediction_accuracy_report.go: it scores the
+// predictions recorded in the ledger against the blocks that arrived.
+package accuracy
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"sort"
+
+	"github.com/pratikspatil024/chain-utils/pkg/ledger"
+)
+
+type accuracyRow struct {
+	Network    string  `json:"network"`
+	Chain      string  `json:"chain"`
+	Estimator  string  `json:"estimator"`
+	Realized   int     `json:"realized"`
+	Pending    int     `json:"pending"`
+	MAEMinutes float64 `json:"mean_abs_error_minutes"`
+	BiasMinute float64 `json:"bias_minutes"`
+	MaxMinutes float64 `json:"max_abs_error_minutes"`
+}
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	ledgerPath := flag.String("ledger", ledger.DefaultPath(), "Prediction ledger: a JSON-lines file, or a postgres:// URL")
+	format := flag.String("format", "text", "Output format: text or json")
+	flag.Parse()
+	failJSON = *format == "json"
+
+	entries, err := ledger.Read(*ledgerPath)
+	if err != nil {
+		failf("read ledger: %v", err)
+	}
+	rows := summarize(entries)
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rows); err != nil {
+			failf("encode report: %v", err)
+		}
+	case "text":
+		where := *ledgerPath
+		if u, err := url.Parse(where); err == nil && u.User != nil {
+			where = u.Redacted()
+		}
+		fmt.Printf("Ledger        : %s (%d predictions)\n\n", where, len(entries))
+		fmt.Printf("%-12s %-10s %-24s %8s %8s %10s %10s %10s\n", "network", "chain", "estimator", "realized", "pending", "MAE (min)", "bias (min)", "max (min)")
+		for _, r := range rows {
+			fmt.Printf("%-12s %-10s %-24s %8d %8d %10.2f %+10.2f %10.2f\n",
+				r.Network, r.Chain, r.Estimator, r.Realized, r.Pending, r.MAEMinutes, r.BiasMinute, r.MaxMinutes)
+		}
+		fmt.Printf("\nbias > 0 means predictions were later than the actual arrival.\n")
+	default:
+		failf("unknown format %q (use text or json)", *format)
+	}
+}
+
+// summarize groups entries per network, chain and estimator and computes
+// the error statistics of the realized ones, in minutes. Bor and Heimdall
+// predictions share a network name but not their errors.
+func summarize(entries []ledger.Entry) []accuracyRow {
+	type key struct{ network, chain, estimator string }
+	groups := make(map[key]*accuracyRow)
+	sums := make(map[key][2]float64) // abs error, signed error
+	for _, e := range entries {
+		k := key{e.Network, e.Chain, e.Estimator}
+		r, ok := groups[k]
+		if !ok {
+			r = &accuracyRow{Network: e.Network, Chain: e.Chain, Estimator: e.Estimator}
+			groups[k] = r
+		}
+		if e.ActualTime == nil {
+			r.Pending++
+			continue
+		}
+		errMin := e.PredictedTime.Sub(*e.ActualTime).Minutes()
+		s := sums[k]
+		s[0] += math.Abs(errMin)
+		s[1] += errMin
+		sums[k] = s
+		r.Realized++
+		r.MaxMinutes = math.Max(r.MaxMinutes, math.Abs(errMin))
+	}
+
+	rows := make([]accuracyRow, 0, len(groups))
+	for k, r := range groups {
+		if r.Realized > 0 {
+			r.MAEMinutes = sums[k][0] / float64(r.Realized)
+			r.BiasMinute = sums[k][1] / float64(r.Realized)
+		}
+		rows = append(rows, *r)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Network != rows[j].Network {
+			return rows[i].Network < rows[j].Network
+		}
+		if rows[i].Chain != rows[j].Chain {
+			return rows[i].Chain < rows[j].Chain
+		}
+		return rows[i].MAEMinutes < rows[j].MAEMinutes
+	})
+	return rows
+}
+
+// failJSON is set by -format=json: failures are then printed on stdout as
+// JSON, in the calculators' failure shape, instead of as text on stderr.
+// The report reads only the local ledger, so every failure is an input
+// error that a rerun won't fix.
+var failJSON bool
+
+func failf(format string, a ...any) {
+	msg := fmt.Sprintf(format, a...)
+	if !failJSON {
+		fmt.Fprintf(os.Stderr, "error: %s\n", msg)
+		os.Exit(1)
+	}
+	type failure struct {
+		Code      string `json:"code"`
+		Category  string `json:"category"`
+		Message   string `json:"message"`
+		Retryable bool   `json:"retryable"`
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(struct {
+		Error failure `json:"error"`
+	}{failure{Code: "invalid_input", Category: "input", Message: msg}})
+	os.Exit(1)
+}
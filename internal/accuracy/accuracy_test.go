@@ -0,0 +1,136 @@
+package accuracy
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/pkg/ledger"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the report end to end through its flags
+// and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("ACCURACY_REPORT_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// run runs prediction_accuracy_report.go with args and returns its stdout
+// and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "ACCURACY_REPORT_RUN_MAIN=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// writeLedger writes lines to a ledger file, one JSON value each.
+func writeLedger(t *testing.T, lines ...any) string {
+	t.Helper()
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, l := range lines {
+		if err := enc.Encode(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "predictions.jsonl")
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReport(t *testing.T) {
+	at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	predict := func(chain, estimator string, target int64, minutes float64) ledger.Entry {
+		return ledger.Entry{RecordedAt: at, Network: "mainnet", Chain: chain, Estimator: estimator, TargetHeight: target,
+			PredictedTime: at.Add(time.Duration(minutes * float64(time.Minute)))}
+	}
+	actual := func(chain string, target int64, minutes float64) ledger.Actual {
+		return ledger.Actual{RecordedAt: at, Network: "mainnet", Chain: chain, TargetHeight: target,
+			ActualTime: at.Add(time.Duration(minutes * float64(time.Minute))), Realized: true}
+	}
+	// The average estimator was 4 minutes late on block 100 and 2 early on
+	// block 200: MAE 3, bias +1, max 4. The window estimator was 1 minute
+	// late on 100 and is waiting for 300. Heimdall predicted the same
+	// height on the same network, but its block 100 hasn't come.
+	path := writeLedger(t,
+		predict("bor", "average", 100, 64),
+		predict("bor", "window", 100, 61),
+		predict("bor", "average", 200, 118),
+		predict("bor", "window", 300, 180),
+		predict("heimdall", "average", 100, 10),
+		actual("bor", 100, 60),
+		actual("bor", 200, 120),
+	)
+
+	stdout, stderr, err := run(t, "-ledger="+path, "-format=json")
+	if err != nil {
+		t.Fatalf("report: %v\n%s", err, stderr)
+	}
+	var rows []accuracyRow
+	if err := json.Unmarshal([]byte(stdout), &rows); err != nil {
+		t.Fatalf("%v\n%s", err, stdout)
+	}
+	want := []accuracyRow{
+		{Network: "mainnet", Chain: "bor", Estimator: "window", Realized: 1, Pending: 1, MAEMinutes: 1, BiasMinute: 1, MaxMinutes: 1},
+		{Network: "mainnet", Chain: "bor", Estimator: "average", Realized: 2, MAEMinutes: 3, BiasMinute: 1, MaxMinutes: 4},
+		{Network: "mainnet", Chain: "heimdall", Estimator: "average", Pending: 1},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("rows %+v, want %+v", rows, want)
+	}
+	for i := range want {
+		got := rows[i]
+		if got.Chain != want[i].Chain || got.Estimator != want[i].Estimator || got.Realized != want[i].Realized || got.Pending != want[i].Pending ||
+			math.Abs(got.MAEMinutes-want[i].MAEMinutes) > 1e-9 || math.Abs(got.BiasMinute-want[i].BiasMinute) > 1e-9 || math.Abs(got.MaxMinutes-want[i].MaxMinutes) > 1e-9 {
+			t.Errorf("row %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	stdout, _, err = run(t, "-ledger="+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"(5 predictions)", "average                         2        0       3.00      +1.00       4.00", "bias > 0 means"} {
+		if !strings.Contains(stdout, s) {
+			t.Errorf("text report lacks %q:\n%s", s, stdout)
+		}
+	}
+}
+
+func TestReportFailures(t *testing.T) {
+	// A missing ledger in JSON mode fails on stdout in the calculators' shape
+	stdout, _, err := run(t, "-ledger="+filepath.Join(t.TempDir(), "none.jsonl"), "-format=json")
+	if err == nil {
+		t.Fatal("missing ledger accepted")
+	}
+	var f struct {
+		Error struct {
+			Code, Message string
+			Retryable     bool
+		}
+	}
+	if err := json.Unmarshal([]byte(stdout), &f); err != nil || f.Error.Code != "invalid_input" || !strings.Contains(f.Error.Message, "read ledger") || f.Error.Retryable {
+		t.Errorf("failure %+v (%v):\n%s", f, err, stdout)
+	}
+
+	path := writeLedger(t)
+	if _, stderr, err := run(t, "-ledger="+path, "-format=yaml"); err == nil || !strings.Contains(stderr, `unknown format "yaml"`) {
+		t.Errorf("-format=yaml: %v\n%s", err, stderr)
+	}
+}
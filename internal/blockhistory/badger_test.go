@@ -0,0 +1,7 @@
+//go:build badger
+
+package blockhistory
+
+import "testing"
+
+func TestBadgerStore(t *testing.T) { testDatabaseStore(t, "badger") }
@@ -0,0 +1,7 @@
+//go:build bbolt
+
+package blockhistory
+
+import "testing"
+
+func TestBoltStore(t *testing.T) { testDatabaseStore(t, "bbolt") }
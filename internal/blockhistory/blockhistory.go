@@ -0,0 +1,1485 @@
+// Package blockhistory is block_history.go: it keeps a local history of
+// block heights and times that can be synced, exported, imported and
+// compacted.
+package blockhistory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/pkg/blockstore"
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+	"github.com/pratikspatil024/chain-utils/pkg/fetch"
+	"github.com/pratikspatil024/chain-utils/pkg/retry"
+)
+
+const (
+	defaultRPC  = "https://polygon-rpc.com"
+	defaultBase = "https://tendermint-api.polygon.technology"
+
+	// reorgSafetyDepth bounds syncing when the RPC has no "finalized" tag.
+	reorgSafetyDepth = 1024
+	maxRetries       = 3
+	retryBackoff     = 600 * time.Millisecond
+
+	// defaultRetryBudget is -retry-budget's default: enough to ride out a
+	// few dropped requests, not a flapping endpoint.
+	defaultRetryBudget = 20
+
+	// initialWorkers is where the adaptive concurrency of sync starts.
+	initialWorkers = 4
+
+	// blockchainMaxRange is the most block metas Tendermint's /blockchain
+	// returns per request.
+	blockchainMaxRange = 20
+)
+
+// sample is one stored block. On disk it uses the same JSON-lines layout as
+// the average calculators' header cache, so both read and write one store.
+type sample struct {
+	Height   int64
+	Hash     string
+	Time     time.Time
+	Proposer string
+}
+
+type borLine struct {
+	Height    uint64 `json:"height"`
+	Hash      string `json:"hash,omitempty"`
+	Timestamp uint64 `json:"timestamp"`
+}
+
+type heimdallLine struct {
+	Height   int64     `json:"height"`
+	Hash     string    `json:"hash,omitempty"`
+	Time     time.Time `json:"time"`
+	Proposer string    `json:"proposer,omitempty"`
+}
+
+// exportRow is one exported block. BlockTime is the gap to the previous
+// height, or zero when that block is not in the store.
+type exportRow struct {
+	Network   string    `json:"network"`
+	Height    int64     `json:"height"`
+	Hash      string    `json:"hash"`
+	Time      time.Time `json:"time"`
+	Unix      int64     `json:"unix"`
+	BlockTime float64   `json:"block_time_seconds"`
+	Producer  string    `json:"producer,omitempty"`
+}
+
+// writeParquet writes export rows as one Parquet file. It is set by
+// parquet.go, which is only compiled in with -tags parquet.
+var writeParquet func(w io.Writer, rows []exportRow) error
+
+// retries is the run's retry budget, shared by every request.
+var retries = retry.NewBudget(defaultRetryBudget, freeRetry)
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch os.Args[1] {
+	case "sync":
+		runSync(ctx, os.Args[2:])
+	case "export":
+		runExport(os.Args[2:])
+	case "import":
+		runImport(os.Args[2:])
+	case "compact":
+		runCompact(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: go run block_history.go sync|export|import|compact [flags]")
+	fmt.Fprintln(os.Stderr, "run a command with -h for its flags")
+	os.Exit(2)
+}
+
+// runSync pulls every finalized block from -from up to the finalized head
+// into the local store. Progress is checkpointed after every chunk, so an
+// interrupted or repeated run resumes past the last fully synced height and
+// only fetches what is missing or new.
+func runSync(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	chain := fs.String("chain", "bor", "Chain to sync: bor or heimdall")
+	rpcURL := fs.String("rpc", defaultRPC, "Polygon (Bor) JSON-RPC endpoint")
+	base := fs.String("base", defaultBase, "Base URL for the Tendermint RPC-compatible API")
+	from := fs.Int64("from", -1, "First height to sync (default: resume from the saved checkpoint)")
+	restart := fs.Bool("restart", false, "Discard the saved checkpoint and re-scan the whole range from -from")
+	stores := addStoreFlags(fs)
+	batch := fs.Int("batch", 100, "Blocks per request: a JSON-RPC batch on Bor, a /blockchain range of at most 20 on Heimdall")
+	workers := fs.Int("workers", 0, "Concurrent requests, or 0 to adapt them to each endpoint's throttling up to -max-workers")
+	maxWorkers := fs.Int("max-workers", 32, "Most concurrent requests per endpoint when -workers is 0")
+	timeout := fs.Duration("timeout", 20*time.Second, "HTTP request timeout")
+	retryBudget := fs.Int("retry-budget", defaultRetryBudget, "Retries the whole run may spend across all requests before failing fast (0 never retries)")
+	fs.Parse(args)
+
+	// The sync checkpoint lives under -cache-dir whatever the backend
+	if *stores.dir == "" {
+		failf("-cache-dir is required")
+	}
+	if err := stores.check(); err != nil {
+		failf("%v", err)
+	}
+	if *retryBudget < 0 {
+		failf("-retry-budget must not be negative")
+	}
+	retries = retry.NewBudget(*retryBudget, freeRetry)
+
+	if *batch < 1 || *workers < 0 || *maxWorkers < 1 {
+		failf("-batch and -max-workers must be positive, -workers must not be negative")
+	}
+	inFlight := *workers
+	if *workers == 0 {
+		limits = newEndpointLimits(min(initialWorkers, *maxWorkers), *maxWorkers)
+		inFlight = *maxWorkers
+	}
+	if *restart && *from < 0 {
+		failf("-restart needs -from to know where the re-scan starts")
+	}
+	client := &http.Client{Transport: &limitedTransport{next: pooledTransport(inFlight), timeout: *timeout}}
+
+	var (
+		network    string
+		lo, hi     int64
+		fetchRange func(ctx context.Context, heights []int64) ([]sample, error)
+	)
+	switch *chain {
+	case "bor":
+		var chainID string
+		if err := ethrpc.Call(ctx, client, *rpcURL, "eth_chainId", nil, &chainID, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+			failf("get chain id: %v", err)
+		}
+		id, err := strconv.ParseUint(trimHex(chainID), 16, 64)
+		if err != nil {
+			failf("parse chain id %q: %v", chainID, err)
+		}
+		network = strconv.FormatUint(id, 10)
+		if hi, err = borFinalized(ctx, client, *rpcURL); err != nil {
+			failf("get finalized height: %v", err)
+		}
+		fetchRange = func(ctx context.Context, heights []int64) ([]sample, error) {
+			return borBlocks(ctx, client, *rpcURL, heights)
+		}
+	case "heimdall":
+		var sr struct {
+			Result struct {
+				NodeInfo struct {
+					Network string `json:"network"`
+				} `json:"node_info"`
+				SyncInfo struct {
+					LatestBlockHeight string `json:"latest_block_height"`
+					EarliestBlockH    string `json:"earliest_block_height"`
+				} `json:"sync_info"`
+			} `json:"result"`
+		}
+		if err := getJSON(ctx, client, *base+"/status", &sr); err != nil {
+			failf("get status: %v", err)
+		}
+		if sr.Result.NodeInfo.Network == "" {
+			failf("status response has no network id")
+		}
+		network = sr.Result.NodeInfo.Network
+		var err error
+		if hi, err = strconv.ParseInt(sr.Result.SyncInfo.LatestBlockHeight, 10, 64); err != nil {
+			failf("parse latest height: %v", err)
+		}
+		if lo, err = strconv.ParseInt(sr.Result.SyncInfo.EarliestBlockH, 10, 64); err != nil {
+			failf("parse earliest height: %v", err)
+		}
+		*batch = min(*batch, blockchainMaxRange)
+		if err := getJSON(ctx, client, fmt.Sprintf("%s/blockchain?minHeight=%d&maxHeight=%d", *base, hi, hi), new(json.RawMessage)); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: /blockchain unavailable (%v); fetching one block per request\n", err)
+			*batch = 1
+		}
+		fetchRange = func(ctx context.Context, heights []int64) ([]sample, error) {
+			if len(heights) == 1 {
+				b, err := heimdallBlock(ctx, client, *base, heights[0])
+				if err != nil {
+					return nil, err
+				}
+				return []sample{b}, nil
+			}
+			return heimdallBlocks(ctx, client, *base, heights)
+		}
+	default:
+		failf("unknown -chain %q (use bor or heimdall)", *chain)
+	}
+
+	st, err := stores.open(*chain, network)
+	if err != nil {
+		failf("open store: %v", err)
+	}
+	defer st.close()
+
+	cpPath := stores.checkpointPath(st)
+	cp, err := loadCheckpoint(cpPath)
+	if err != nil {
+		failf("read checkpoint: %v", err)
+	}
+	if *restart {
+		if err := os.Remove(cpPath); err != nil && !os.IsNotExist(err) {
+			failf("remove checkpoint: %v", err)
+		}
+		cp = nil
+	}
+	start := *from
+	switch {
+	case cp != nil && (start < 0 || start >= cp.From && start <= cp.HighWater+1):
+		fmt.Printf("Checkpoint    : %d → %d synced as of %s; resuming\n", cp.From, cp.HighWater, cp.UpdatedAt.Format(time.RFC3339))
+		start = cp.HighWater + 1
+	case start < 0:
+		failf("no sync checkpoint for %s; pass -from to choose where history starts", st)
+	default:
+		if start < lo {
+			fmt.Fprintf(os.Stderr, "warning: -from %d is below the earliest height served (%d)\n", start, lo)
+			start = lo
+		}
+		cp = &syncCheckpoint{From: start, HighWater: start - 1}
+	}
+
+	var todo []int64
+	for h := start; h <= hi; h++ {
+		if _, ok := st.samples[h]; !ok {
+			todo = append(todo, h)
+		}
+	}
+	fmt.Printf("Store         : %s (%d blocks)\n", st, len(st.samples))
+	fmt.Printf("Sync range    : %d → %d (%d missing)\n", start, hi, len(todo))
+
+	began := time.Now()
+	reported := began
+	synced := 0
+	chunk := *batch * inFlight
+	for i := 0; i < len(todo); i += chunk {
+		end := min(i+chunk, len(todo))
+		got, err := fetchParallel(ctx, todo[i:end], *batch, inFlight, fetchRange)
+		if err := st.add(got); err != nil {
+			failf("write store: %v", err)
+		}
+		synced += len(got)
+
+		// Everything below the first height still missing is now stored
+		for k := i; k < end; k++ {
+			if _, ok := st.samples[todo[k]]; !ok {
+				break
+			}
+			cp.HighWater = hi
+			if k+1 < len(todo) {
+				cp.HighWater = todo[k+1] - 1
+			}
+		}
+		if err := cp.save(cpPath); err != nil {
+			failf("write checkpoint: %v", err)
+		}
+		if err != nil {
+			failf("sync stopped at height %d after %d blocks: %v (rerun to resume)", cp.HighWater+1, synced, err)
+		}
+		if time.Since(reported) >= time.Second {
+			reported = time.Now()
+			rate := fmt.Sprintf("%.0f blocks/s", float64(synced)/time.Since(began).Seconds())
+			if limits != nil {
+				rate += ", concurrency " + limits.current()
+			}
+			fmt.Fprintf(os.Stderr, "\r%d/%d blocks (%s)   ", synced, len(todo), rate)
+		}
+	}
+	if reported != began {
+		fmt.Fprintln(os.Stderr)
+	}
+	cp.HighWater = max(cp.HighWater, hi)
+	if err := cp.save(cpPath); err != nil {
+		failf("write checkpoint: %v", err)
+	}
+	fmt.Printf("Synced        : %d blocks in %s; store now holds %d\n", synced, time.Since(began).Round(time.Millisecond), len(st.samples))
+	if limits != nil {
+		fmt.Printf("Concurrency   : %s\n", limits.summary())
+	}
+}
+
+// syncCheckpoint is the high-water mark of a sync job: every height from
+// From through HighWater is in the store.
+type syncCheckpoint struct {
+	From      int64     `json:"from"`
+	HighWater int64     `json:"high_water"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func loadCheckpoint(path string) (*syncCheckpoint, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp syncCheckpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// save writes the checkpoint atomically, so a crash never leaves it claiming
+// more than the store holds.
+func (cp *syncCheckpoint) save(path string) error {
+	cp.UpdatedAt = time.Now().UTC()
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// runExport dumps stored blocks in a height or time range for analysis in
+// pandas, Spark and similar tools. It reads only the local store.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	chain := fs.String("chain", "bor", "Chain to export: bor or heimdall")
+	network := fs.String("network", "", "Network id of the store, e.g. 137 or heimdallv2-137 (default: the only file store for -chain; required with a database -cache-backend)")
+	rangeStr := fs.String("range", "", "Heights LO..HI or RFC3339 times T1..T2; either end may be empty (default: everything)")
+	format := fs.String("format", "csv", "Output format: csv, jsonl or parquet")
+	outPath := fs.String("out", "", "Output file (default: stdout)")
+	stores := addStoreFlags(fs)
+	fs.Parse(args)
+
+	switch *format {
+	case "csv", "jsonl":
+	case "parquet":
+		if writeParquet == nil {
+			failf("this build has no parquet encoder; rebuild with -tags parquet")
+		}
+	default:
+		failf("unknown -format %q (use csv, jsonl or parquet)", *format)
+	}
+	st, err := stores.open(*chain, *network)
+	if err != nil {
+		failf("open store: %v", err)
+	}
+	defer st.close()
+	inRange, err := parseRange(*rangeStr)
+	if err != nil {
+		failf("parse -range: %v", err)
+	}
+
+	heights := make([]int64, 0, len(st.samples))
+	for h, s := range st.samples {
+		if inRange(s) {
+			heights = append(heights, h)
+		}
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+	out := os.Stdout
+	if *outPath != "" {
+		if out, err = os.Create(*outPath); err != nil {
+			failf("create output: %v", err)
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+	var cw *csv.Writer
+	if *format == "csv" {
+		cw = csv.NewWriter(w)
+		cw.Write([]string{"network", "height", "hash", "time", "unix", "block_time_seconds", "producer"})
+	}
+	enc := json.NewEncoder(w)
+	var rows []exportRow
+	for _, h := range heights {
+		s := st.samples[h]
+		row := exportRow{Network: st.name, Height: h, Hash: s.Hash, Time: s.Time, Unix: s.Time.Unix(), Producer: s.Proposer}
+		if prev, ok := st.samples[h-1]; ok {
+			row.BlockTime = s.Time.Sub(prev.Time).Seconds()
+		}
+		switch {
+		case *format == "parquet":
+			rows = append(rows, row)
+		case cw != nil:
+			cw.Write([]string{row.Network, strconv.FormatInt(row.Height, 10), row.Hash, row.Time.Format(time.RFC3339Nano),
+				strconv.FormatInt(row.Unix, 10), strconv.FormatFloat(row.BlockTime, 'f', -1, 64), row.Producer})
+		default:
+			if err := enc.Encode(row); err != nil {
+				failf("write output: %v", err)
+			}
+		}
+	}
+	if *format == "parquet" {
+		if err := writeParquet(w, rows); err != nil {
+			failf("write output: %v", err)
+		}
+	}
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			failf("write output: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		failf("write output: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "exported %d blocks from %s\n", len(heights), st)
+}
+
+// runImport prepopulates the store from a (height, timestamp) dump, such as
+// a data provider export or a teammate's `export` output. Heights already
+// stored are kept; a dump that disagrees with them is reported.
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	chain := fs.String("chain", "bor", "Chain the dump belongs to: bor or heimdall")
+	network := fs.String("network", "", "Network id of the store, e.g. 137 or heimdallv2-137 (default: the only file store for -chain; required with a database -cache-backend)")
+	inPath := fs.String("in", "-", "Dump to import: CSV with a header row, a JSON array or JSON lines (- for stdin)")
+	stores := addStoreFlags(fs)
+	fs.Parse(args)
+
+	if *chain != "bor" && *chain != "heimdall" {
+		failf("unknown -chain %q (use bor or heimdall)", *chain)
+	}
+	in := os.Stdin
+	var err error
+	if *inPath != "-" {
+		if in, err = os.Open(*inPath); err != nil {
+			failf("open dump: %v", err)
+		}
+		defer in.Close()
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		failf("read dump: %v", err)
+	}
+	samples, err := parseDump(data)
+	if err != nil {
+		failf("parse dump: %v", err)
+	}
+
+	st, err := stores.open(*chain, *network)
+	if err != nil {
+		failf("open store: %v", err)
+	}
+	defer st.close()
+	before, conflicts := len(st.samples), 0
+	for _, s := range samples {
+		if have, ok := st.samples[s.Height]; ok && !have.Time.Equal(s.Time) {
+			if conflicts < 5 {
+				fmt.Fprintf(os.Stderr, "warning: height %d: dump has %s, store has %s; keeping the store\n", s.Height, s.Time.Format(time.RFC3339), have.Time.Format(time.RFC3339))
+			}
+			conflicts++
+		}
+	}
+	if err := st.add(samples); err != nil {
+		failf("write store: %v", err)
+	}
+	fmt.Printf("Store         : %s\n", st)
+	fmt.Printf("Imported      : %d new blocks of %d in the dump (%d conflicts)\n", len(st.samples)-before, len(samples), conflicts)
+}
+
+// runCompact rewrites each store without duplicate, superseded or unreadable
+// lines, optionally dropping blocks older than -keep, and reports what every
+// store covers afterwards. Only finalized blocks are ever written to a store,
+// so there are no provisional entries on disk to prune.
+func runCompact(args []string) {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	keepStr := fs.String("keep", "", "Drop blocks older than this age, e.g. 1y, 90d or 720h (default: keep everything)")
+	network := fs.String("network", "", "Only compact stores for this network id, e.g. 137 or heimdallv2-137 (default: all)")
+	dryRun := fs.Bool("dry-run", false, "Report what would change without rewriting anything")
+	cacheDir := fs.String("cache-dir", defaultCacheDir(), "Directory of the local block store")
+	fs.Parse(args)
+
+	var cutoff time.Time
+	if *keepStr != "" {
+		keep, err := parseAge(*keepStr)
+		if err != nil {
+			failf("parse -keep: %v", err)
+		}
+		cutoff = time.Now().Add(-keep)
+	}
+	var paths []string
+	for _, chain := range []string{"bor", "heimdall"} {
+		pattern := chain + "-*.jsonl"
+		if *network != "" {
+			pattern = chain + "-" + *network + ".jsonl"
+		}
+		matches, _ := filepath.Glob(filepath.Join(*cacheDir, pattern))
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 0 {
+		failf("no stores in %s", *cacheDir)
+	}
+
+	var before, after int64
+	for i, path := range paths {
+		chain, _, _ := strings.Cut(filepath.Base(path), "-")
+		c, err := compactStore(path, chain, cutoff, *dryRun)
+		if err != nil {
+			failf("compact %s: %v", path, err)
+		}
+		before += c.sizeBefore
+		after += c.sizeAfter
+		if i > 0 {
+			fmt.Println()
+		}
+		c.print(*keepStr)
+	}
+	verb := "Reclaimed"
+	if *dryRun {
+		verb = "Would free"
+	}
+	fmt.Printf("\n%s %s across %d stores (%s → %s)\n", verb, formatBytes(before-after), len(paths), formatBytes(before), formatBytes(after))
+}
+
+// compaction summarizes one compacted store.
+type compaction struct {
+	path                  string
+	sizeBefore, sizeAfter int64
+	duplicates, bad       int
+	pruned                int
+	kept                  []sample
+	checkpoint            *syncCheckpoint
+}
+
+// compactStore rewrites path sorted by height with one line per block. The
+// last line for a height wins, as when the store is loaded. The new file
+// replaces the old one atomically, and the rewrite is abandoned if anything
+// appended to the store meanwhile.
+func compactStore(path, chain string, cutoff time.Time, dryRun bool) (compaction, error) {
+	c := compaction{path: path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return c, err
+	}
+	c.sizeBefore = info.Size()
+	f, err := os.Open(path)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+
+	st := &store{path: path, chain: chain}
+	latest := make(map[int64]sample)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		s, ok := st.decode(sc.Bytes())
+		if !ok {
+			c.bad++
+			continue
+		}
+		if _, dup := latest[s.Height]; dup {
+			c.duplicates++
+		}
+		latest[s.Height] = s
+	}
+	if err := sc.Err(); err != nil {
+		return c, err
+	}
+	for _, s := range latest {
+		if !cutoff.IsZero() && s.Time.Before(cutoff) {
+			c.pruned++
+			continue
+		}
+		c.kept = append(c.kept, s)
+	}
+	sort.Slice(c.kept, func(i, j int) bool { return c.kept[i].Height < c.kept[j].Height })
+
+	var buf bytes.Buffer
+	for _, s := range c.kept {
+		buf.Write(st.encode(s))
+	}
+	c.sizeAfter = int64(buf.Len())
+
+	cpPath := strings.TrimSuffix(path, ".jsonl") + ".sync.json"
+	if c.checkpoint, err = loadCheckpoint(cpPath); err != nil {
+		return c, err
+	}
+	// A checkpoint must not claim heights that were just pruned
+	cpChanged := false
+	if cp := c.checkpoint; cp != nil && c.pruned > 0 {
+		switch {
+		case len(c.kept) == 0 || c.kept[len(c.kept)-1].Height < cp.From:
+			c.checkpoint, cpChanged = nil, true
+		case c.kept[0].Height > cp.From:
+			cp.From, cpChanged = c.kept[0].Height, true
+			if cp.From > cp.HighWater {
+				c.checkpoint = nil
+			}
+		}
+	}
+	if dryRun || (c.duplicates == 0 && c.bad == 0 && c.pruned == 0 && c.sizeAfter == c.sizeBefore) {
+		return c, nil
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return c, err
+	}
+	if now, err := os.Stat(path); err != nil || now.Size() != info.Size() || !now.ModTime().Equal(info.ModTime()) {
+		os.Remove(tmp)
+		return c, errors.New("store changed while compacting (is a sync or calculator running?); rerun when it is idle")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return c, err
+	}
+	if cpChanged {
+		if c.checkpoint == nil {
+			err = os.Remove(cpPath)
+		} else {
+			err = c.checkpoint.save(cpPath)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return c, fmt.Errorf("update checkpoint: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func (c compaction) print(keep string) {
+	fmt.Printf("Store         : %s\n", c.path)
+	fmt.Printf("Size          : %s → %s\n", formatBytes(c.sizeBefore), formatBytes(c.sizeAfter))
+	removed := fmt.Sprintf("%d duplicate, %d unreadable", c.duplicates, c.bad)
+	if keep != "" {
+		removed += fmt.Sprintf(", %d older than %s", c.pruned, keep)
+	}
+	fmt.Printf("Blocks        : %d (removed %s)\n", len(c.kept), removed)
+	if len(c.kept) == 0 {
+		return
+	}
+	first, last := c.kept[0], c.kept[len(c.kept)-1]
+	span := last.Height - first.Height + 1
+	gaps := 0
+	for i := 1; i < len(c.kept); i++ {
+		if c.kept[i].Height != c.kept[i-1].Height+1 {
+			gaps++
+		}
+	}
+	fmt.Printf("Heights       : %d → %d (%.2f%% covered, %d gaps)\n", first.Height, last.Height, 100*float64(len(c.kept))/float64(span), gaps)
+	fmt.Printf("Time          : %s → %s\n", first.Time.Format(time.RFC3339), last.Time.Format(time.RFC3339))
+	if cp := c.checkpoint; cp != nil {
+		fmt.Printf("Checkpoint    : %d → %d synced\n", cp.From, cp.HighWater)
+	}
+}
+
+// parseAge parses a duration that may also use d (day), w (week) and
+// y (365-day year) units.
+func parseAge(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour, "y": 365 * 24 * time.Hour}
+	var d time.Duration
+	if unit, ok := units[s[len(s)-1:]]; ok {
+		n, err := strconv.ParseFloat(s[:len(s)-1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		d = time.Duration(n * float64(unit))
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("age %q must be positive", s)
+	}
+	return d, nil
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// parseDump reads (height, timestamp) pairs from CSV, a JSON array or JSON
+// lines. The timestamp may be named timestamp, time or unix, and may be unix
+// seconds (decimal or 0x-hex) or RFC3339; other columns are ignored.
+func parseDump(data []byte) ([]sample, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("empty dump")
+	}
+	var records []map[string]any
+	switch data[0] {
+	case '[':
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, err
+		}
+	case '{':
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for dec.More() {
+			var m map[string]any
+			if err := dec.Decode(&m); err != nil {
+				return nil, fmt.Errorf("record %d: %w", len(records)+1, err)
+			}
+			records = append(records, m)
+		}
+	default:
+		rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows[1:] {
+			m := make(map[string]any, len(row))
+			for i, col := range rows[0] {
+				if i < len(row) {
+					m[strings.ToLower(strings.TrimSpace(col))] = row[i]
+				}
+			}
+			records = append(records, m)
+		}
+	}
+
+	out := make([]sample, 0, len(records))
+	for i, m := range records {
+		h, err := dumpInt(m["height"])
+		if err != nil {
+			return nil, fmt.Errorf("record %d: height: %w", i+1, err)
+		}
+		var t time.Time
+		for _, key := range []string{"timestamp", "time", "unix"} {
+			if v, ok := m[key]; ok && v != "" {
+				if t, err = dumpTime(v); err != nil {
+					return nil, fmt.Errorf("record %d: %s: %w", i+1, key, err)
+				}
+				break
+			}
+		}
+		if t.IsZero() {
+			return nil, fmt.Errorf("record %d: no timestamp, time or unix field", i+1)
+		}
+		hash, _ := m["hash"].(string)
+		producer, _ := m["producer"].(string)
+		out = append(out, sample{Height: h, Hash: hash, Time: t, Proposer: producer})
+	}
+	return out, nil
+}
+
+func dumpInt(v any) (int64, error) {
+	switch x := v.(type) {
+	case float64:
+		return int64(x), nil
+	case string:
+		if strings.HasPrefix(x, "0x") || strings.HasPrefix(x, "0X") {
+			return strconv.ParseInt(x[2:], 16, 64)
+		}
+		return strconv.ParseInt(strings.TrimSpace(x), 10, 64)
+	default:
+		return 0, fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+func dumpTime(v any) (time.Time, error) {
+	if str, ok := v.(string); ok && strings.Contains(str, "T") {
+		return time.Parse(time.RFC3339Nano, str)
+	}
+	sec, err := dumpInt(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// findStore resolves the store file for chain, picking the only one present
+// when network is empty.
+func findStore(dir, chain, network string) (string, error) {
+	if network != "" {
+		return filepath.Join(dir, chain+"-"+network+".jsonl"), nil
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, chain+"-*.jsonl"))
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no %s store in %s; run sync first or name the network with -network", chain, dir)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("several %s stores in %s; pick one with -network", chain, dir)
+	}
+}
+
+// parseRange parses LO..HI as heights, or as RFC3339 times when either end
+// contains a 'T'. An empty string or empty end is unbounded.
+func parseRange(s string) (func(sample) bool, error) {
+	if s == "" {
+		return func(sample) bool { return true }, nil
+	}
+	lo, hi, ok := strings.Cut(s, "..")
+	if !ok {
+		return nil, fmt.Errorf("%q is not LO..HI", s)
+	}
+	if strings.Contains(lo, "T") || strings.Contains(hi, "T") {
+		var from, to time.Time
+		var err error
+		if lo != "" {
+			if from, err = time.Parse(time.RFC3339, lo); err != nil {
+				return nil, err
+			}
+		}
+		if hi != "" {
+			if to, err = time.Parse(time.RFC3339, hi); err != nil {
+				return nil, err
+			}
+		}
+		return func(b sample) bool {
+			return (lo == "" || !b.Time.Before(from)) && (hi == "" || !b.Time.After(to))
+		}, nil
+	}
+	from, to := int64(0), int64(-1)
+	var err error
+	if lo != "" {
+		if from, err = strconv.ParseInt(lo, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if hi != "" {
+		if to, err = strconv.ParseInt(hi, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	return func(b sample) bool { return b.Height >= from && (to < 0 || b.Height <= to) }, nil
+}
+
+// fetchParallel splits heights into batches and fetches them with up to
+// workers requests in flight. The first failed batch stops the batches not
+// yet started, but every sample fetched is returned with its error, so
+// progress is never thrown away.
+func fetchParallel(ctx context.Context, heights []int64, batch, workers int, fetchBatch func(context.Context, []int64) ([]sample, error)) ([]sample, error) {
+	var (
+		mu  sync.Mutex
+		out []sample
+	)
+	g := fetch.NewGroup(ctx, workers)
+	for i := 0; i < len(heights); i += batch {
+		part := heights[i:min(i+batch, len(heights))]
+		g.Go(func(ctx context.Context) error {
+			got, err := fetchBatch(ctx, part)
+			mu.Lock()
+			out = append(out, got...)
+			mu.Unlock()
+			return err
+		})
+	}
+	err := g.Wait()
+	sort.Slice(out, func(i, j int) bool { return out[i].Height < out[j].Height })
+	return out, err
+}
+
+// store is one network's block store: by default the JSON-lines file also
+// used as the average calculators' header cache, else a database backend
+// of pkg/blockstore holding the same blocks.
+type store struct {
+	path    string // file path, or the database's DSN
+	chain   string
+	name    string // network key, e.g. bor-137
+	backend string
+	f       *os.File
+	db      blockstore.Store
+	samples map[int64]sample
+}
+
+func defaultCacheDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".chain-utils", "cache")
+}
+
+// storeFlags are the flags that pick the store a command works on.
+type storeFlags struct {
+	dir, backend, dsn *string
+}
+
+func addStoreFlags(fs *flag.FlagSet) storeFlags {
+	return storeFlags{
+		dir:     fs.String("cache-dir", defaultCacheDir(), "Directory of the local block store shared with the average calculators"),
+		backend: fs.String("cache-backend", "file", "Block store backend: file (JSON lines per network under -cache-dir), sqlite, bbolt, badger or postgres"),
+		dsn:     fs.String("store", "", "Database of -cache-backend: a path, or a postgres:// URL, which implies -cache-backend=postgres (default: blocks.<backend> under -cache-dir)"),
+	}
+}
+
+// check validates the flags before anything is fetched.
+func (sf storeFlags) check() error {
+	// -store postgres://... names its backend by itself
+	if b := blockstore.BackendOf(*sf.dsn); b != "" && *sf.backend != b {
+		if *sf.backend != "file" {
+			return fmt.Errorf("-store is a %s URL, but -cache-backend is %s", b, *sf.backend)
+		}
+		*sf.backend = b
+	}
+	if *sf.backend == "file" {
+		if *sf.dsn != "" {
+			return fmt.Errorf("-store needs a database -cache-backend")
+		}
+		return nil
+	}
+	if !slices.Contains(blockstore.Known(), *sf.backend) {
+		return fmt.Errorf("unknown -cache-backend %q (use file, %s)", *sf.backend, strings.Join(blockstore.Known(), ", "))
+	}
+	if err := blockstore.Available(*sf.backend); err != nil {
+		return fmt.Errorf("-cache-backend: %w", err)
+	}
+	if *sf.dsn == "" && blockstore.Server(*sf.backend) {
+		return fmt.Errorf("-store is required with -cache-backend=%s", *sf.backend)
+	}
+	if *sf.dir == "" && *sf.dsn == "" {
+		return fmt.Errorf("-cache-dir or -store is required")
+	}
+	return nil
+}
+
+// open opens the store of chain's network, e.g. 137 or heimdallv2-137. An
+// empty network picks the only file store of chain under -cache-dir.
+func (sf storeFlags) open(chain, network string) (*store, error) {
+	if err := sf.check(); err != nil {
+		return nil, err
+	}
+	if *sf.backend == "file" {
+		path, err := findStore(*sf.dir, chain, network)
+		if err != nil {
+			return nil, err
+		}
+		return openStore(path, chain)
+	}
+	if network == "" {
+		return nil, fmt.Errorf("-network is required with -cache-backend=%s", *sf.backend)
+	}
+	dsn := *sf.dsn
+	if dsn == "" {
+		dsn = blockstore.DefaultPath(*sf.dir, *sf.backend)
+	}
+	name := chain + "-" + network
+	db, err := blockstore.Open(*sf.backend, dsn, name)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := db.Load(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("load %s: %w", name, err)
+	}
+	st := &store{path: dsn, chain: chain, name: name, backend: *sf.backend, db: db, samples: make(map[int64]sample, len(blocks))}
+	for _, b := range blocks {
+		st.samples[b.Height] = sample(b)
+	}
+	return st, nil
+}
+
+// checkpointPath is where sync keeps the store's checkpoint: next to a file
+// store, or under -cache-dir, named after the network and backend, for a
+// database.
+func (sf storeFlags) checkpointPath(st *store) string {
+	if st.db == nil {
+		return strings.TrimSuffix(st.path, ".jsonl") + ".sync.json"
+	}
+	return filepath.Join(*sf.dir, st.name+"."+st.backend+".sync.json")
+}
+
+// String names the store in reports, without a DSN's password.
+func (st *store) String() string {
+	if st.db == nil {
+		return st.path
+	}
+	return fmt.Sprintf("%s in %s %s", st.name, st.backend, blockstore.Redact(st.path))
+}
+
+func openStore(path, chain string) (*store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	st := &store{path: path, chain: chain, name: strings.TrimSuffix(filepath.Base(path), ".jsonl"), backend: "file", f: f, samples: make(map[int64]sample)}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if s, ok := st.decode(sc.Bytes()); ok {
+			st.samples[s.Height] = s
+		}
+	}
+	return st, sc.Err()
+}
+
+func (st *store) decode(line []byte) (sample, bool) {
+	if st.chain == "bor" {
+		var l borLine
+		if json.Unmarshal(line, &l) != nil {
+			return sample{}, false
+		}
+		return sample{Height: int64(l.Height), Hash: l.Hash, Time: time.Unix(int64(l.Timestamp), 0).UTC()}, true
+	}
+	var l heimdallLine
+	if json.Unmarshal(line, &l) != nil {
+		return sample{}, false
+	}
+	return sample{Height: l.Height, Hash: l.Hash, Time: l.Time, Proposer: l.Proposer}, true
+}
+
+func (st *store) encode(s sample) []byte {
+	var line []byte
+	if st.chain == "bor" {
+		line, _ = json.Marshal(borLine{Height: uint64(s.Height), Hash: s.Hash, Timestamp: uint64(s.Time.Unix())})
+	} else {
+		line, _ = json.Marshal(heimdallLine{Height: s.Height, Hash: s.Hash, Time: s.Time, Proposer: s.Proposer})
+	}
+	return append(line, '\n')
+}
+
+// add stores samples not yet stored in a single write or transaction.
+func (st *store) add(samples []sample) error {
+	var buf bytes.Buffer
+	var blocks []blockstore.Block
+	for _, s := range samples {
+		if _, ok := st.samples[s.Height]; ok {
+			continue
+		}
+		st.samples[s.Height] = s
+		if st.db != nil {
+			blocks = append(blocks, blockstore.Block(s))
+		} else {
+			buf.Write(st.encode(s))
+		}
+	}
+	if st.db != nil {
+		return st.db.Add(context.Background(), blocks)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	_, err := st.f.Write(buf.Bytes())
+	return err
+}
+
+func (st *store) close() {
+	if st.db != nil {
+		st.db.Close()
+		return
+	}
+	st.f.Close()
+}
+
+// borFinalized returns the block carrying the "finalized" tag, or a
+// conservative distance below head when the endpoint does not support it.
+func borFinalized(ctx context.Context, client *http.Client, rpcURL string) (int64, error) {
+	var b *struct {
+		Number string `json:"number"`
+	}
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_getBlockByNumber", []any{"finalized", false}, &b, ethrpc.WithRetryGate(retries.Spend)); err == nil && b != nil {
+		if h, err := strconv.ParseInt(trimHex(b.Number), 16, 64); err == nil {
+			return h, nil
+		}
+	}
+	var head string
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_blockNumber", nil, &head, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+		return 0, err
+	}
+	h, err := strconv.ParseInt(trimHex(head), 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	return max(h-reorgSafetyDepth, 0), nil
+}
+
+// borBlocks fetches headers for heights in one JSON-RPC batch request.
+func borBlocks(ctx context.Context, client *http.Client, rpcURL string, heights []int64) ([]sample, error) {
+	c, err := ethrpc.New(rpcURL, ethrpc.WithHTTPClient(client), ethrpc.WithRetries(ethrpc.CallRetries), ethrpc.WithRetryGate(retries.Spend))
+	if err != nil {
+		return nil, err
+	}
+	type header struct {
+		Hash      string `json:"hash"`
+		Timestamp string `json:"timestamp"`
+	}
+	blocks := make([]*header, len(heights))
+	calls := make([]ethrpc.BatchElem, len(heights))
+	for i, h := range heights {
+		calls[i] = ethrpc.BatchElem{Method: "eth_getBlockByNumber", Params: []any{fmt.Sprintf("0x%x", h), false}, Result: &blocks[i]}
+	}
+	if err := c.BatchCall(ctx, calls); err != nil {
+		return nil, fmt.Errorf("batch %d-%d: %w", heights[0], heights[len(heights)-1], err)
+	}
+	out := make([]sample, len(heights))
+	for i, call := range calls {
+		if call.Error != nil {
+			return nil, fmt.Errorf("block %d: %w", heights[i], call.Error)
+		}
+		if blocks[i] == nil {
+			return nil, fmt.Errorf("block %d: missing from batch response", heights[i])
+		}
+		ts, err := strconv.ParseInt(trimHex(blocks[i].Timestamp), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse timestamp of block %d: %w", heights[i], err)
+		}
+		out[i] = sample{Height: heights[i], Hash: blocks[i].Hash, Time: time.Unix(ts, 0).UTC()}
+	}
+	return out, nil
+}
+
+// heimdallBlocks fetches the headers of the ascending heights with one
+// /blockchain request. Heights the answer lacks (it holds at most
+// blockchainMaxRange blocks, counted down from the highest) are fetched one
+// at a time from /block.
+func heimdallBlocks(ctx context.Context, client *http.Client, base string, heights []int64) ([]sample, error) {
+	var br struct {
+		Result struct {
+			BlockMetas []struct {
+				BlockID struct {
+					Hash string `json:"hash"`
+				} `json:"block_id"`
+				Header struct {
+					Height          string `json:"height"`
+					Time            string `json:"time"`
+					ProposerAddress string `json:"proposer_address"`
+				} `json:"header"`
+			} `json:"block_metas"`
+		} `json:"result"`
+	}
+	url := fmt.Sprintf("%s/blockchain?minHeight=%d&maxHeight=%d", base, heights[0], heights[len(heights)-1])
+	var lastErr error
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if attempt > 0 {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err := retries.Spend(lastErr); err != nil {
+				return nil, err
+			}
+			time.Sleep(retryBackoff * time.Duration(attempt))
+		}
+		if lastErr = getJSON(ctx, client, url, &br); lastErr == nil {
+			break
+		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("blocks %d-%d failed after %d attempts: %v", heights[0], heights[len(heights)-1], maxRetries, lastErr)
+	}
+
+	got := make(map[int64]sample, len(br.Result.BlockMetas))
+	for _, m := range br.Result.BlockMetas {
+		h, err := strconv.ParseInt(m.Header.Height, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse block meta height %q: %w", m.Header.Height, err)
+		}
+		t, err := time.Parse(time.RFC3339Nano, m.Header.Time)
+		if err != nil {
+			return nil, fmt.Errorf("parse time of block %d: %w", h, err)
+		}
+		got[h] = sample{Height: h, Hash: m.BlockID.Hash, Time: t, Proposer: m.Header.ProposerAddress}
+	}
+	out := make([]sample, 0, len(heights))
+	for _, h := range heights {
+		s, ok := got[h]
+		if !ok {
+			var err error
+			if s, err = heimdallBlock(ctx, client, base, h); err != nil {
+				return out, err
+			}
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func heimdallBlock(ctx context.Context, client *http.Client, base string, height int64) (sample, error) {
+	var br struct {
+		Result struct {
+			BlockID struct {
+				Hash string `json:"hash"`
+			} `json:"block_id"`
+			Block struct {
+				Header struct {
+					Time            string `json:"time"`
+					ProposerAddress string `json:"proposer_address"`
+				} `json:"header"`
+			} `json:"block"`
+		} `json:"result"`
+	}
+	var lastErr error
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if attempt > 0 {
+			if ctx.Err() != nil {
+				return sample{}, ctx.Err()
+			}
+			if err := retries.Spend(lastErr); err != nil {
+				return sample{}, err
+			}
+			time.Sleep(retryBackoff * time.Duration(attempt))
+		}
+		if lastErr = getJSON(ctx, client, fmt.Sprintf("%s/block?height=%d", base, height), &br); lastErr != nil {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, br.Result.Block.Header.Time)
+		if err != nil {
+			return sample{}, fmt.Errorf("parse time of block %d: %w", height, err)
+		}
+		return sample{Height: height, Hash: br.Result.BlockID.Hash, Time: t, Proposer: br.Result.Block.Header.ProposerAddress}, nil
+	}
+	return sample{}, fmt.Errorf("block %d failed after %d attempts: %v", height, maxRetries, lastErr)
+}
+
+// aimdLimit is one endpoint's adaptive concurrency limit. Each success
+// raises it by 1/limit, so by about one request per round of limit
+// requests. A throttled request (HTTP 429 or 503, or a timeout) halves it
+// (additive increase, multiplicative decrease), at most once per round: a
+// burst of failures from requests sent before the cut counts once.
+type aimdLimit struct {
+	mu       sync.Mutex
+	limit    float64
+	max      float64
+	inflight int
+	cut      time.Time // when the limit was last halved
+	wake     chan struct{}
+
+	peak float64
+	cuts int
+}
+
+// endpointLimits holds the aimdLimit of each host a run talks to. A nil
+// *endpointLimits, when -workers fixes the concurrency, limits nothing.
+type endpointLimits struct {
+	mu       sync.Mutex
+	start    int
+	max      int
+	byHost   map[string]*aimdLimit
+	hostList []string
+}
+
+// limits is set by sync when -workers is 0.
+var limits *endpointLimits
+
+func newEndpointLimits(start, max int) *endpointLimits {
+	return &endpointLimits{start: start, max: max, byHost: make(map[string]*aimdLimit)}
+}
+
+// acquire waits until the host of rawURL has a free slot and takes it. The
+// returned func gives the slot back and adjusts the limit by the request's
+// outcome.
+func (l *endpointLimits) acquire(ctx context.Context, rawURL string) (func(error), error) {
+	if l == nil {
+		return func(error) {}, nil
+	}
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	l.mu.Lock()
+	a, ok := l.byHost[host]
+	if !ok {
+		a = &aimdLimit{limit: float64(l.start), max: float64(l.max), peak: float64(l.start), wake: make(chan struct{})}
+		l.byHost[host] = a
+		l.hostList = append(l.hostList, host)
+	}
+	l.mu.Unlock()
+
+	for {
+		a.mu.Lock()
+		if a.inflight < int(a.limit) {
+			a.inflight++
+			sent := time.Now()
+			a.mu.Unlock()
+			return func(err error) { a.release(sent, err) }, nil
+		}
+		wake := a.wake
+		a.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (a *aimdLimit) release(sent time.Time, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.inflight--
+	switch {
+	case err == nil:
+		a.limit = min(a.max, a.limit+1/a.limit)
+		a.peak = max(a.peak, a.limit)
+	case throttled(err) && sent.After(a.cut):
+		a.limit = max(1, a.limit/2)
+		a.cut = time.Now()
+		a.cuts++
+	}
+	close(a.wake)
+	a.wake = make(chan struct{})
+}
+
+// freeRetry makes retries after throttling free under adaptive
+// concurrency, where throttling is how the limit finds the endpoint's
+// capacity. Each call still gives up after its attempts.
+func freeRetry(err error) bool {
+	return limits != nil && throttled(err)
+}
+
+// throttled reports whether err is the endpoint pushing back on load,
+// rather than a bad request or answer.
+func throttled(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var he *ethrpc.HTTPError
+	cat := retry.Category(err)
+	return cat == "rate limited" || cat == "timeout" || errors.As(err, &he) && he.StatusCode == http.StatusServiceUnavailable
+}
+
+// current is the concurrency each host has settled at, e.g.
+// "polygon-rpc.com 12".
+func (l *endpointLimits) current() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	parts := make([]string, len(l.hostList))
+	for i, h := range l.hostList {
+		a := l.byHost[h]
+		a.mu.Lock()
+		parts[i] = fmt.Sprintf("%s %d", h, int(a.limit))
+		a.mu.Unlock()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// summary describes each host's limit over the run, e.g. "polygon-rpc.com:
+// settled at 12 in flight (peak 24, halved 3 times)".
+func (l *endpointLimits) summary() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	parts := make([]string, len(l.hostList))
+	for i, h := range l.hostList {
+		a := l.byHost[h]
+		a.mu.Lock()
+		parts[i] = fmt.Sprintf("%s: settled at %d in flight (peak %d, halved %d times)", h, int(a.limit), int(a.peak), a.cuts)
+		a.mu.Unlock()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// pooledTransport keeps an idle connection per worker. The default
+// transport keeps two per host, so with more workers most requests would
+// dial (and TLS-handshake) a fresh connection and then drop it.
+func pooledTransport(workers int) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = workers
+	t.MaxIdleConns = max(t.MaxIdleConns, workers)
+	return t
+}
+
+// limitedTransport sends each request, JSON-RPC and REST alike, in a slot of
+// limits, holding it until the answer is read so the limit sees how the
+// request went. It bounds each request by timeout, if set, itself: an http.Client
+// timeout reaches a transport as a bare cancellation, which the limit could
+// not tell from the run being stopped.
+type limitedTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done, err := limits.acquire(req.Context(), req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if t.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+	}
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		done(err)
+		return nil, err
+	}
+	body := &limitedBody{ReadCloser: resp.Body, release: func(err error) {
+		cancel()
+		done(err)
+	}}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body.err = &ethrpc.HTTPError{StatusCode: resp.StatusCode}
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// limitedBody gives its request's slot back when closed, with the first
+// error the answer ran into.
+type limitedBody struct {
+	io.ReadCloser
+	release func(error)
+	err     error
+	once    sync.Once
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.release(b.err) })
+	return err
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%w for %s", &ethrpc.HTTPError{StatusCode: resp.StatusCode}, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func trimHex(s string) string {
+	if len(s) > 1 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		return s[2:]
+	}
+	return s
+}
+
+func failf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", a...)
+	os.Exit(1)
+}
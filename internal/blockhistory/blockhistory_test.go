@@ -0,0 +1,587 @@
+package blockhistory
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the commands end to end through their
+// flags and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("BLOCK_HISTORY_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// genesisTime is block 0 of the test chains; Bor blocks come every 2s and
+// Heimdall blocks every second.
+const genesisTime = 1_700_000_000
+
+func borTime(h int64) time.Time      { return time.Unix(genesisTime+2*h, 0).UTC() }
+func heimdallTime(h int64) time.Time { return time.Unix(genesisTime+h, 0).UTC() }
+
+// borNode is a Bor JSON-RPC endpoint (chain id 137) answering single and
+// batch requests.
+type borNode struct {
+	mu        sync.Mutex
+	finalized int64
+	failFrom  int64 // blocks from here on answer a JSON-RPC error by number, when set
+	capacity  int   // requests in flight beyond this are rate limited, when set
+	inflight  int
+	limited   int
+	fetched   map[int64]int // eth_getBlockByNumber calls per height
+}
+
+type rpcReq struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params []any           `json:"params"`
+}
+
+func (n *borNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	n.inflight++
+	over := n.capacity > 0 && n.inflight > n.capacity
+	if over {
+		n.limited++
+	}
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		n.inflight--
+		n.mu.Unlock()
+	}()
+	if over {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+		return
+	}
+	if n.capacity > 0 {
+		time.Sleep(2 * time.Millisecond) // long enough for requests to overlap
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body[0] == '[' {
+		var reqs []rpcReq
+		json.Unmarshal(body, &reqs)
+		out := make([]map[string]any, len(reqs))
+		for i, req := range reqs {
+			out[i] = n.answer(req)
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	var req rpcReq
+	json.Unmarshal(body, &req)
+	json.NewEncoder(w).Encode(n.answer(req))
+}
+
+func (n *borNode) answer(req rpcReq) map[string]any {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "eth_chainId":
+		resp["result"] = "0x89"
+	case "eth_blockNumber":
+		resp["result"] = fmt.Sprintf("0x%x", n.finalized+10)
+	case "eth_getBlockByNumber":
+		tag, _ := req.Params[0].(string)
+		h := n.finalized
+		if tag != "finalized" {
+			h, _ = strconv.ParseInt(strings.TrimPrefix(tag, "0x"), 16, 64)
+			if n.fetched == nil {
+				n.fetched = make(map[int64]int)
+			}
+			n.fetched[h]++
+		}
+		if tag != "finalized" && n.failFrom > 0 && h >= n.failFrom {
+			resp["error"] = map[string]any{"code": -32000, "message": "header not found"}
+			return resp
+		}
+		resp["result"] = map[string]string{"number": fmt.Sprintf("0x%x", h), "hash": fmt.Sprintf("0x%064x", h), "timestamp": fmt.Sprintf("0x%x", borTime(h).Unix())}
+	default:
+		resp["error"] = map[string]any{"code": -32601, "message": "method not found"}
+	}
+	return resp
+}
+
+// fetchedBelow reports how many blocks below h were fetched.
+func (n *borNode) fetchedBelow(h int64) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	c := 0
+	for height := range n.fetched {
+		if height < h {
+			c++
+		}
+	}
+	return c
+}
+
+// heimdallNode is a Tendermint RPC endpoint of network heimdall-test.
+type heimdallNode struct {
+	head, earliest int64
+
+	mu          sync.Mutex
+	rangeCalls  int
+	singleCalls int
+}
+
+func (n *heimdallNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	meta := func(h int64) string {
+		return fmt.Sprintf(`{"block_id":{"hash":"%064X"},"header":{"height":"%d","time":"%s","proposer_address":"P%d"}}`, h, h, heimdallTime(h).Format(time.RFC3339Nano), h%3)
+	}
+	switch r.URL.Path {
+	case "/status":
+		fmt.Fprintf(w, `{"result":{"node_info":{"network":"heimdall-test"},"sync_info":{"latest_block_height":"%d","earliest_block_height":"%d"}}}`, n.head, n.earliest)
+	case "/blockchain":
+		n.mu.Lock()
+		n.rangeCalls++
+		n.mu.Unlock()
+		lo, _ := strconv.ParseInt(q.Get("minHeight"), 10, 64)
+		hi, _ := strconv.ParseInt(q.Get("maxHeight"), 10, 64)
+		// Tendermint answers at most 20 metas, counted down from maxHeight
+		var metas []string
+		for h := hi; h >= lo && len(metas) < 20; h-- {
+			metas = append(metas, meta(h))
+		}
+		fmt.Fprintf(w, `{"result":{"block_metas":[%s]}}`, strings.Join(metas, ","))
+	case "/block":
+		n.mu.Lock()
+		n.singleCalls++
+		n.mu.Unlock()
+		h, _ := strconv.ParseInt(q.Get("height"), 10, 64)
+		fmt.Fprintf(w, `{"result":{"block_id":{"hash":"%064X"},"block":{"header":{"time":"%s","proposer_address":"P%d"}}}}`, h, heimdallTime(h).Format(time.RFC3339Nano), h%3)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newServer(t *testing.T, h http.Handler) string {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs block_history.go with args and returns its stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "BLOCK_HISTORY_RUN_MAIN=1", "HOME="+t.TempDir())
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// storeHeights reads the heights a store file holds, in file order.
+func storeHeights(t *testing.T, path string) []int64 {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []int64
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var l struct {
+			Height int64 `json:"height"`
+		}
+		if line == "" || json.Unmarshal([]byte(line), &l) != nil {
+			continue
+		}
+		out = append(out, l.Height)
+	}
+	return out
+}
+
+func readCheckpoint(t *testing.T, path string) syncCheckpoint {
+	t.Helper()
+	cp, err := loadCheckpoint(path)
+	if err != nil || cp == nil {
+		t.Fatalf("checkpoint %s: %v, %v", path, cp, err)
+	}
+	return *cp
+}
+
+func TestSyncBor(t *testing.T) {
+	node := &borNode{finalized: 300}
+	url := newServer(t, node)
+	dir := t.TempDir()
+	store := filepath.Join(dir, "bor-137.jsonl")
+
+	stdout, stderr, err := run(t, "sync", "-chain=bor", "-rpc="+url, "-cache-dir="+dir, "-from=100", "-batch=10", "-workers=2")
+	if err != nil {
+		t.Fatalf("sync: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Synced        : 201 blocks") {
+		t.Errorf("stdout:\n%s", stdout)
+	}
+	if got := storeHeights(t, store); len(got) != 201 || got[0] != 100 || got[200] != 300 {
+		t.Fatalf("store holds %d heights (%v…), want 100 → 300", len(got), got[:min(len(got), 3)])
+	}
+	if cp := readCheckpoint(t, filepath.Join(dir, "bor-137.sync.json")); cp.From != 100 || cp.HighWater != 300 {
+		t.Errorf("checkpoint %+v, want 100 → 300", cp)
+	}
+
+	// A later run without -from resumes past the checkpoint and only
+	// fetches the new blocks
+	node.mu.Lock()
+	node.finalized, node.fetched = 350, nil
+	node.mu.Unlock()
+	stdout, stderr, err = run(t, "sync", "-chain=bor", "-rpc="+url, "-cache-dir="+dir, "-batch=10", "-workers=2")
+	if err != nil {
+		t.Fatalf("resume: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "resuming") || !strings.Contains(stdout, "Synced        : 50 blocks") {
+		t.Errorf("stdout:\n%s", stdout)
+	}
+	if n := node.fetchedBelow(301); n != 0 {
+		t.Errorf("resume fetched %d blocks that were already synced", n)
+	}
+	if cp := readCheckpoint(t, filepath.Join(dir, "bor-137.sync.json")); cp.HighWater != 350 {
+		t.Errorf("checkpoint %+v, want high water 350", cp)
+	}
+}
+
+func TestSyncResumesAfterFailure(t *testing.T) {
+	node := &borNode{finalized: 300, failFrom: 200}
+	url := newServer(t, node)
+	dir := t.TempDir()
+
+	_, stderr, err := run(t, "sync", "-chain=bor", "-rpc="+url, "-cache-dir="+dir, "-from=100", "-batch=10", "-workers=1")
+	if err == nil {
+		t.Fatal("sync succeeded with blocks failing")
+	}
+	if !strings.Contains(stderr, "sync stopped at height 200") || !strings.Contains(stderr, "rerun to resume") {
+		t.Errorf("stderr:\n%s", stderr)
+	}
+	if cp := readCheckpoint(t, filepath.Join(dir, "bor-137.sync.json")); cp.HighWater != 199 {
+		t.Errorf("checkpoint %+v, want high water 199", cp)
+	}
+
+	node.mu.Lock()
+	node.failFrom, node.fetched = 0, nil
+	node.mu.Unlock()
+	stdout, stderr, err := run(t, "sync", "-chain=bor", "-rpc="+url, "-cache-dir="+dir, "-batch=10", "-workers=1")
+	if err != nil {
+		t.Fatalf("resume: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Sync range    : 200 → 300 (101 missing)") {
+		t.Errorf("stdout:\n%s", stdout)
+	}
+	if n := node.fetchedBelow(200); n != 0 {
+		t.Errorf("resume refetched %d stored blocks", n)
+	}
+	if got := storeHeights(t, filepath.Join(dir, "bor-137.jsonl")); len(got) != 201 {
+		t.Errorf("store holds %d blocks, want 201", len(got))
+	}
+
+	// -restart without -from is refused rather than guessing
+	if _, stderr, err := run(t, "sync", "-chain=bor", "-rpc="+url, "-cache-dir="+dir, "-restart"); err == nil || !strings.Contains(stderr, "-restart needs -from") {
+		t.Errorf("-restart without -from: %v\n%s", err, stderr)
+	}
+}
+
+func TestSyncHeimdall(t *testing.T) {
+	node := &heimdallNode{head: 1000, earliest: 900}
+	url := newServer(t, node)
+	dir := t.TempDir()
+
+	stdout, stderr, err := run(t, "sync", "-chain=heimdall", "-base="+url, "-cache-dir="+dir, "-from=850", "-workers=2")
+	if err != nil {
+		t.Fatalf("sync: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stderr, "-from 850 is below the earliest height served (900)") {
+		t.Errorf("no warning about -from:\n%s", stderr)
+	}
+	if !strings.Contains(stdout, "Synced        : 101 blocks") {
+		t.Errorf("stdout:\n%s", stdout)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "heimdall-heimdall-test.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte(`{"height":950,"hash":"`)) || !bytes.Contains(b, []byte(`"proposer":"P2"`)) {
+		t.Errorf("store lacks block 950 with its proposer:\n%.300s", b)
+	}
+	// 900 → 1000 in ranges of 20 is five /blockchain requests and block
+	// 1000 on its own from /block, plus the /blockchain probe
+	if node.singleCalls != 1 || node.rangeCalls != 6 {
+		t.Errorf("%d /blockchain and %d /block requests, want 6 and 1", node.rangeCalls, node.singleCalls)
+	}
+}
+
+func TestSyncAdaptsConcurrency(t *testing.T) {
+	node := &borNode{finalized: 1999, capacity: 3}
+	url := newServer(t, node)
+	dir := t.TempDir()
+
+	stdout, stderr, err := run(t, "sync", "-chain=bor", "-rpc="+url, "-cache-dir="+dir, "-from=0", "-batch=5", "-max-workers=16", "-retry-budget=0")
+	if err != nil {
+		t.Fatalf("sync: %v\n%s", err, stderr)
+	}
+	if got := storeHeights(t, filepath.Join(dir, "bor-137.jsonl")); len(got) != 2000 {
+		t.Errorf("store holds %d blocks, want 2000", len(got))
+	}
+	// Throttled retries are free under AIMD, so a zero budget still
+	// finishes, and the limit was cut to what the node admits
+	m := regexp.MustCompile(`settled at (\d+) in flight \(peak (\d+), halved (\d+) times\)`).FindStringSubmatch(stdout)
+	if m == nil {
+		t.Fatalf("no concurrency summary:\n%s", stdout)
+	}
+	settled, _ := strconv.Atoi(m[1])
+	halved, _ := strconv.Atoi(m[3])
+	if node.limited == 0 || halved == 0 {
+		t.Errorf("limited %d requests, halved %d times; want the limit probed and cut", node.limited, halved)
+	}
+	if settled < 1 || settled > 16 {
+		t.Errorf("settled at %d, want 1-16", settled)
+	}
+
+	// A fixed -workers has no adaptive limit: the same throttling spends
+	// the budget and fails fast
+	dir2 := t.TempDir()
+	_, stderr, err = run(t, "sync", "-chain=bor", "-rpc="+url, "-cache-dir="+dir2, "-from=0", "-batch=5", "-workers=8", "-retry-budget=0")
+	if err == nil || !strings.Contains(stderr, "retry budget exhausted") {
+		t.Errorf("fixed workers: %v\n%s", err, stderr)
+	}
+}
+
+// writeBorStore writes a Bor store holding heights, in order.
+func writeBorStore(t *testing.T, path string, heights ...int64) {
+	t.Helper()
+	var b bytes.Buffer
+	for _, h := range heights {
+		fmt.Fprintf(&b, `{"height":%d,"hash":"0x%x","timestamp":%d}`+"\n", h, h, borTime(h).Unix())
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	writeBorStore(t, filepath.Join(dir, "bor-137.jsonl"), 10, 11, 12, 14, 15)
+
+	stdout, stderr, err := run(t, "export", "-chain=bor", "-cache-dir="+dir, "-range=11..14")
+	if err != nil {
+		t.Fatalf("export: %v\n%s", err, stderr)
+	}
+	rows, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"network", "height", "hash", "time", "unix", "block_time_seconds", "producer"},
+		{"bor-137", "11", "0xb", borTime(11).Format(time.RFC3339Nano), strconv.FormatInt(borTime(11).Unix(), 10), "2", ""},
+		{"bor-137", "12", "0xc", borTime(12).Format(time.RFC3339Nano), strconv.FormatInt(borTime(12).Unix(), 10), "2", ""},
+		// 13 is missing, so 14 has no gap to measure
+		{"bor-137", "14", "0xe", borTime(14).Format(time.RFC3339Nano), strconv.FormatInt(borTime(14).Unix(), 10), "0", ""},
+	}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Errorf("csv:\n%v\nwant:\n%v", rows, want)
+	}
+
+	// A time range, as JSON lines into a file
+	out := filepath.Join(dir, "out.jsonl")
+	r := borTime(14).Format(time.RFC3339) + ".."
+	if _, stderr, err := run(t, "export", "-chain=bor", "-cache-dir="+dir, "-range="+r, "-format=jsonl", "-out="+out); err != nil {
+		t.Fatalf("export: %v\n%s", err, stderr)
+	}
+	b, _ := os.ReadFile(out)
+	var heights []int64
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var row exportRow
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			t.Fatal(err)
+		}
+		heights = append(heights, row.Height)
+		if row.Height == 15 && row.BlockTime != 2 {
+			t.Errorf("block 15: block time %v, want 2", row.BlockTime)
+		}
+	}
+	if fmt.Sprint(heights) != "[14 15]" {
+		t.Errorf("exported %v, want [14 15]", heights)
+	}
+
+	if _, stderr, err := run(t, "export", "-chain=heimdall", "-cache-dir="+dir); err == nil || !strings.Contains(stderr, "no heimdall store") {
+		t.Errorf("missing store: %v\n%s", err, stderr)
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bor-137.jsonl")
+	writeBorStore(t, path, 10)
+
+	dump := filepath.Join(dir, "dump.csv")
+	os.WriteFile(dump, []byte(fmt.Sprintf("Height,Timestamp,Extra\n10,%d,x\n11,0x%x,y\n12,%s,z\n",
+		borTime(10).Unix()+1, borTime(11).Unix(), borTime(12).Format(time.RFC3339))), 0o644)
+	stdout, stderr, err := run(t, "import", "-chain=bor", "-cache-dir="+dir, "-in="+dump)
+	if err != nil {
+		t.Fatalf("import: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Imported      : 2 new blocks of 3 in the dump (1 conflicts)") {
+		t.Errorf("stdout:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "height 10: dump has") {
+		t.Errorf("no conflict warning:\n%s", stderr)
+	}
+	st, err := openStore(path, "bor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.close()
+	if got := st.samples[10].Time; !got.Equal(borTime(10)) {
+		t.Errorf("block 10 = %s, want the stored %s kept", got, borTime(10))
+	}
+	if got := st.samples[12].Time; !got.Equal(borTime(12)) {
+		t.Errorf("block 12 = %s, want %s", got, borTime(12))
+	}
+
+	// JSON lines, importing into a named network's new store
+	jl := filepath.Join(dir, "dump.jsonl")
+	os.WriteFile(jl, []byte(`{"height":5,"time":"2023-11-14T22:13:30Z"}`+"\n"+`{"height":6,"unix":1700000012}`+"\n"), 0o644)
+	if stdout, stderr, err := run(t, "import", "-chain=bor", "-network=80002", "-cache-dir="+dir, "-in="+jl); err != nil || !strings.Contains(stdout, "2 new blocks of 2") {
+		t.Errorf("jsonl import: %v\n%s%s", err, stdout, stderr)
+	}
+
+	os.WriteFile(jl, []byte(`{"height":7}`), 0o644)
+	if _, stderr, err := run(t, "import", "-chain=bor", "-network=80002", "-cache-dir="+dir, "-in="+jl); err == nil || !strings.Contains(stderr, "record 1: no timestamp, time or unix field") {
+		t.Errorf("dump without times: %v\n%s", err, stderr)
+	}
+}
+
+func TestStoreFlags(t *testing.T) {
+	dir := t.TempDir()
+	writeBorStore(t, filepath.Join(dir, "bor-137.jsonl"), 1, 2)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"export", "-cache-dir=" + dir, "-cache-backend=leveldb"}, `unknown -cache-backend "leveldb" (use file, badger, bbolt, postgres, sqlite)`},
+		{[]string{"export", "-cache-dir=" + dir, "-cache-backend=sqlite", "-store=postgres://chain:secret@db/chain"}, "-store is a postgres URL, but -cache-backend is sqlite"},
+		{[]string{"export", "-cache-dir=" + dir, "-store=/tmp/blocks.db"}, "-store needs a database -cache-backend"},
+		{[]string{"sync", "-cache-dir=", "-from=1"}, "-cache-dir is required"},
+	}
+	for _, tt := range tests {
+		if _, stderr, err := run(t, tt.args...); err == nil || !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: %v\n%s", tt.args, err, stderr)
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bor-137.jsonl")
+	now := time.Now().UTC()
+	line := func(h int64, at time.Time) string {
+		return fmt.Sprintf(`{"height":%d,"timestamp":%d}`+"\n", h, at.Unix())
+	}
+	// Two old blocks, a duplicate and an unreadable line, out of order
+	content := line(3, now.Add(-time.Hour)) + line(1, now.Add(-72*time.Hour)) + "not json\n" +
+		line(2, now.Add(-48*time.Hour)) + line(3, now.Add(-30*time.Minute)) + line(4, now.Add(-time.Minute))
+	os.WriteFile(path, []byte(content), 0o644)
+	cpPath := filepath.Join(dir, "bor-137.sync.json")
+	(&syncCheckpoint{From: 1, HighWater: 4}).save(cpPath)
+
+	stdout, stderr, err := run(t, "compact", "-cache-dir="+dir, "-keep=1d", "-dry-run")
+	if err != nil {
+		t.Fatalf("dry run: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Blocks        : 2 (removed 1 duplicate, 1 unreadable, 2 older than 1d)") || !strings.Contains(stdout, "Would free") {
+		t.Errorf("dry run stdout:\n%s", stdout)
+	}
+	if b, _ := os.ReadFile(path); string(b) != content {
+		t.Error("dry run rewrote the store")
+	}
+
+	if _, stderr, err := run(t, "compact", "-cache-dir="+dir, "-keep=1d"); err != nil {
+		t.Fatalf("compact: %v\n%s", err, stderr)
+	}
+	// The last line for a height wins, and the rest come out sorted
+	want := line(3, now.Add(-30*time.Minute)) + line(4, now.Add(-time.Minute))
+	if b, _ := os.ReadFile(path); string(b) != want {
+		t.Errorf("store:\n%s\nwant:\n%s", b, want)
+	}
+	// The checkpoint no longer claims the pruned heights
+	if cp := readCheckpoint(t, cpPath); cp.From != 3 || cp.HighWater != 4 {
+		t.Errorf("checkpoint %+v, want 3 → 4", cp)
+	}
+
+	if _, stderr, err := run(t, "compact", "-cache-dir="+t.TempDir()); err == nil || !strings.Contains(stderr, "no stores in") {
+		t.Errorf("empty dir: %v\n%s", err, stderr)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	at := func(h int64) sample { return sample{Height: h, Time: borTime(h)} }
+	tests := []struct {
+		spec string
+		in   []int64
+		out  []int64
+	}{
+		{"", []int64{0, 5}, nil},
+		{"10..20", []int64{10, 20}, []int64{9, 21}},
+		{"10..", []int64{10, 1 << 40}, []int64{9}},
+		{"..20", []int64{0, 20}, []int64{21}},
+		{borTime(10).Format(time.RFC3339) + ".." + borTime(20).Format(time.RFC3339), []int64{10, 20}, []int64{9, 21}},
+	}
+	for _, tt := range tests {
+		match, err := parseRange(tt.spec)
+		if err != nil {
+			t.Errorf("parseRange(%q): %v", tt.spec, err)
+			continue
+		}
+		for _, h := range tt.in {
+			if !match(at(h)) {
+				t.Errorf("%q excludes %d", tt.spec, h)
+			}
+		}
+		for _, h := range tt.out {
+			if match(at(h)) {
+				t.Errorf("%q includes %d", tt.spec, h)
+			}
+		}
+	}
+	for _, bad := range []string{"10", "a..b", "2025-01-01..x"} {
+		if _, err := parseRange(bad); err == nil {
+			t.Errorf("parseRange(%q) accepted", bad)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for in, want := range map[string]time.Duration{"1y": 365 * 24 * time.Hour, "90d": 90 * 24 * time.Hour, "2w": 14 * 24 * time.Hour, "720h": 720 * time.Hour, "1.5d": 36 * time.Hour} {
+		if got, err := parseAge(in); err != nil || got != want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"0d", "-1h", "xd", "soon"} {
+		if _, err := parseAge(bad); err == nil {
+			t.Errorf("parseAge(%q) accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+//go:build parquet
+
+package blockhistory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestExportParquet(t *testing.T) {
+	dir := t.TempDir()
+	at := time.Date(2025, 10, 7, 14, 0, 0, 250_000_000, time.UTC)
+	lines := `{"height":7,"hash":"0x7","time":"` + at.Format(time.RFC3339Nano) + `","proposer":"0xaa"}` + "\n" +
+		`{"height":8,"hash":"0x8","time":"` + at.Add(1500*time.Millisecond).Format(time.RFC3339Nano) + `","proposer":"0xbb"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "heimdall-heimdallv2-137.jsonl"), []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeBorStore(t, filepath.Join(dir, "bor-137.jsonl"), 10, 11)
+
+	read := func(chain string) []parquetRow {
+		t.Helper()
+		out := filepath.Join(dir, chain+".parquet")
+		if _, stderr, err := run(t, "export", "-chain="+chain, "-cache-dir="+dir, "-format=parquet", "-out="+out); err != nil {
+			t.Fatalf("export %s: %v\n%s", chain, err, stderr)
+		}
+		rows, err := parquet.ReadFile[parquetRow](out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	// Heimdall rows carry the proposer and sub-second times
+	want := []parquetRow{
+		{Network: "heimdall-heimdallv2-137", Height: 7, Hash: "0x7", Time: at, Unix: at.Unix(), Producer: "0xaa"},
+		{Network: "heimdall-heimdallv2-137", Height: 8, Hash: "0x8", Time: at.Add(1500 * time.Millisecond), Unix: at.Unix() + 1, BlockTime: 1.5, Producer: "0xbb"},
+	}
+	checkRows(t, read("heimdall"), want)
+
+	// Bor rows have no producer
+	want = []parquetRow{
+		{Network: "bor-137", Height: 10, Hash: "0xa", Time: borTime(10), Unix: borTime(10).Unix()},
+		{Network: "bor-137", Height: 11, Hash: "0xb", Time: borTime(11), Unix: borTime(11).Unix(), BlockTime: 2},
+	}
+	checkRows(t, read("bor"), want)
+
+	// and leave it null in the file, as they do a gap with no previous
+	// block
+	f, err := os.Open(filepath.Join(dir, "bor.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, _ := f.Stat()
+	pf, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := pf.Schema()
+	for _, name := range []string{"producer", "block_time_seconds"} {
+		if f, ok := schema.Lookup(name); !ok || !f.Node.Optional() {
+			t.Errorf("column %s is not nullable", name)
+		}
+	}
+}
+
+func checkRows(t *testing.T, got, want []parquetRow) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("read %d rows, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g := got[i]
+		if !g.Time.Equal(want[i].Time) {
+			t.Errorf("row %d time %s, want %s", i, g.Time, want[i].Time)
+		}
+		g.Time = want[i].Time
+		if g != want[i] {
+			t.Errorf("row %d = %+v, want %+v", i, g, want[i])
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build sqlite
+
+package blockhistory
+
+import "testing"
+
+func TestSQLiteStore(t *testing.T) { testDatabaseStore(t, "sqlite") }
@@ -0,0 +1,60 @@
+//go:build sqlite || bbolt || badger
+
+package blockhistory
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func hash(h int64) string { return fmt.Sprintf("0x%064x", h) }
+
+// testDatabaseStore syncs into the database backend, resumes and exports.
+func testDatabaseStore(t *testing.T, backend string) {
+	node := &borNode{finalized: 300}
+	url := newServer(t, node)
+	dir := t.TempDir()
+	db := filepath.Join(dir, "blocks."+backend)
+
+	stdout, stderr, err := run(t, "sync", "-chain=bor", "-rpc="+url, "-cache-dir="+dir, "-cache-backend="+backend, "-from=100", "-batch=10", "-workers=2")
+	if err != nil {
+		t.Fatalf("sync: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Store         : bor-137 in "+backend+" "+db+" (0 blocks)") || !strings.Contains(stdout, "Synced        : 201 blocks") {
+		t.Errorf("stdout:\n%s", stdout)
+	}
+	if cp := readCheckpoint(t, filepath.Join(dir, "bor-137."+backend+".sync.json")); cp.From != 100 || cp.HighWater != 300 {
+		t.Errorf("checkpoint %+v, want 100 → 300", cp)
+	}
+
+	// The rerun finds everything in the database and only fetches new blocks
+	node.mu.Lock()
+	node.finalized, node.fetched = 320, nil
+	node.mu.Unlock()
+	stdout, stderr, err = run(t, "sync", "-chain=bor", "-rpc="+url, "-cache-dir="+dir, "-cache-backend="+backend, "-from=100", "-batch=10", "-workers=2")
+	if err != nil {
+		t.Fatalf("resume: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "(201 blocks)") || !strings.Contains(stdout, "Synced        : 20 blocks") || node.fetchedBelow(301) != 0 {
+		t.Errorf("stdout:\n%s", stdout)
+	}
+
+	stdout, stderr, err = run(t, "export", "-chain=bor", "-network=137", "-cache-dir="+dir, "-cache-backend="+backend, "-range=299..301")
+	if err != nil {
+		t.Fatalf("export: %v\n%s", err, stderr)
+	}
+	want := "network,height,hash,time,unix,block_time_seconds,producer\n" +
+		"bor-137,299," + hash(299) + "," + borTime(299).Format("2006-01-02T15:04:05Z07:00") + ",1700000598,2,\n" +
+		"bor-137,300," + hash(300) + "," + borTime(300).Format("2006-01-02T15:04:05Z07:00") + ",1700000600,2,\n" +
+		"bor-137,301," + hash(301) + "," + borTime(301).Format("2006-01-02T15:04:05Z07:00") + ",1700000602,2,\n"
+	if stdout != want {
+		t.Errorf("export:\n%s\nwant\n%s", stdout, want)
+	}
+
+	// A database holds every network, so export and import name theirs
+	if _, stderr, err := run(t, "export", "-chain=bor", "-cache-dir="+dir, "-cache-backend="+backend); err == nil || !strings.Contains(stderr, "-network is required with -cache-backend="+backend) {
+		t.Errorf("export without -network: %v\n%s", err, stderr)
+	}
+}
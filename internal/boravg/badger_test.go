@@ -0,0 +1,10 @@
+//go:build badger
+
+package boravg
+
+import "testing"
+
+func TestBadgerCache(t *testing.T) {
+	testDatabaseCache(t, "badger")
+	testKVCache(t, "badger")
+}
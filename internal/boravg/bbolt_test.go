@@ -0,0 +1,10 @@
+//go:build bbolt
+
+package boravg
+
+import "testing"
+
+func TestBoltCache(t *testing.T) {
+	testDatabaseCache(t, "bbolt")
+	testKVCache(t, "bbolt")
+}
@@ -0,0 +1,2202 @@
+// Package boravg is bor_average_blocktime_calculator.go: it measures the
+// average Bor block time over lookbacks, windows and ranges.
+package boravg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/fixtures"
+	"github.com/pratikspatil024/chain-utils/pkg/blockstore"
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+	"github.com/pratikspatil024/chain-utils/pkg/fetch"
+	"github.com/pratikspatil024/chain-utils/pkg/human"
+	"github.com/pratikspatil024/chain-utils/pkg/retry"
+	"github.com/pratikspatil024/chain-utils/registry"
+)
+
+const (
+	defaultRPC  = "https://polygon-rpc.com"
+	jsonrpcVer  = "2.0"
+	httpTimeout = 20 * time.Second
+
+	// reorgSafetyDepth bounds caching when the RPC has no "finalized" tag.
+	reorgSafetyDepth = 1024
+
+	// defaultRetryBudget is -retry-budget's default: enough to ride out a
+	// few dropped requests, not a flapping endpoint.
+	defaultRetryBudget = 20
+
+	// defaultConcurrency is -concurrency's default, which bounds the block
+	// requests in flight at once.
+	defaultConcurrency = 4
+)
+
+type block struct {
+	Number     string `json:"number"`
+	Hash       string `json:"hash"`
+	ParentHash string `json:"parentHash"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// headers caches finalized block headers across runs; nil disables caching.
+var headers *blockCache
+
+// memo dedupes identical block lookups within one run; see cachedCall.
+var memo = newRPCMemo()
+
+// links turns referenced heights into explorer URLs; zero prints none.
+var links explorerURLs
+
+// offline is set by -local-only: every answer comes from headers and any
+// network access is an error.
+var offline bool
+
+// retries is the run's retry budget, shared by every request.
+var retries = retry.NewBudget(defaultRetryBudget, nil)
+
+// strictJSON is set by -strict; see ethrpc.WithStrict.
+var strictJSON bool
+
+// csvMode is set by -format=csv: the report is collected in csvRows and
+// written as CSV instead of printed.
+var (
+	csvMode bool
+	csvRows []avgRow
+)
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	rpcURL := flag.String("rpc", defaultRPC, "Polygon (Bor) JSON-RPC endpoint, or several comma-separated ones to fail over between")
+	windowsStr := flag.String("windows", "", "Comma-separated wall-clock windows (e.g. 24h,7d,30d) used instead of fixed block lookbacks")
+	fromHeight := flag.Int64("from-height", -1, "First anchor height for an exact two-anchor average")
+	toHeight := flag.Int64("to-height", -1, "Second anchor height (default: latest block)")
+	fromTime := flag.String("from-time", "", "First anchor time (RFC3339); resolved to the first block at or after it")
+	toTime := flag.String("to-time", "", "Second anchor time (RFC3339); default: latest block")
+	asOfHeight := flag.Int64("as-of-height", -1, "Pin the report to this block instead of the latest one (reproducible output)")
+	asOfTime := flag.String("as-of-time", "", "Pin the report to the last block at or before this time (RFC3339)")
+	watch := flag.Duration("watch", 0, "Recompute the report every interval (e.g. 30s) until interrupted")
+	cacheDir := flag.String("cache-dir", defaultCacheDir(), "Directory for the local cache of finalized block headers (empty disables it)")
+	cacheBackend := flag.String("cache-backend", "file", "Header cache backend: file (persisted under -cache-dir), sqlite (one database for every network), bbolt or badger (key-value stores that also keep near-head headers for -cache-head-ttl), postgres (a server a team shares, see -store), memory (this process only, e.g. with -watch) or none")
+	storeDSN := flag.String("store", "", "Database of a database -cache-backend: a path, or a postgres:// URL, which implies -cache-backend=postgres (default: blocks.<backend> under -cache-dir)")
+	headTTL := flag.Duration("cache-head-ttl", 15*time.Second, "How long headers above the finalized height may be reused before refetching (0 disables)")
+	maxMB := flag.Int64("cache-max-mb", 0, "Shrink the cache file to this many megabytes, keeping the newest heights (0 means unlimited)")
+	maxRecent := flag.Int("cache-max-recent", 4096, "Headers above the finalized height kept in memory; the least recently used are evicted")
+	maxHeadAge := flag.Duration("max-head-age", time.Minute, "Flag the head block when its timestamp is further than this from the local clock (0 disables)")
+	strictTime := flag.Bool("strict-time", false, "Fail instead of warning when block timestamps are implausible")
+	strict := flag.Bool("strict", false, "Reject provider responses with unexpected envelope fields, or blocks missing a field the math reads, instead of decoding what is there")
+	localOnly := flag.Bool("local-only", false, "Answer purely from the synced store under -cache-dir, without network access; fails when a needed height is missing")
+	localNetwork := flag.String("local-network", "", "Chain id of the store read by -local-only, when -cache-dir holds several")
+	heimdallREST := flag.String("heimdall-rest", "", "Heimdall REST API (e.g. https://heimdall-api.polygon.technology) whose latest milestone marks finality when the RPC lacks the \"finalized\" tag")
+	chainName := flag.String("chain", "", "Run against this registry chain (e.g. gnosis, bsc) instead of Bor; -rpc defaults to its public endpoint")
+	chainID := flag.Uint64("chain-id", 0, "Run against the registry chain with this chain id (e.g. 100)")
+	registry := flag.String("registry", defaultRegistryPath(), "JSON file of extra registry chains (e.g. devnets) for -chain and -chain-id; skipped when the default file is absent")
+	registryFile := flag.String("registry-file", "", "Registry (chains and Bor hardforks, as registry/registry.json) used instead of the embedded one, e.g. a newer copy on an air-gapped machine")
+	chainlist := flag.Bool("chainlist", false, "Use the first answering public endpoint for the chain (Bor, or -chain/-chain-id) from the embedded chainlist snapshot instead of -rpc")
+	explorer := flag.String("explorer", "polygonscan", "Explorer linked for referenced blocks: polygonscan, oklink, a URL template with %d, or empty for none")
+	network := flag.String("network", "mainnet", "Network the -explorer links and the -provider endpoint point at: mainnet or amoy")
+	replayPath := flag.String("replay", "", "Answer from a recorded dataset instead of the network: builtin:mainnet, builtin:amoy or a fixture file")
+	provider := flag.String("provider", "", "Hosted RPC provider to use instead of -rpc: alchemy, infura, quicknode or ankr (needs -key)")
+	providerKey := flag.String("key", "", "API key for -provider; for quicknode <endpoint-name>/<token>")
+	providerSecret := flag.String("key-secret", "", "Infura API key secret, sent as basic auth when the key requires it")
+	format := flag.String("format", "text", "Output format: text, or csv with one row per lookback, window or anchor pair")
+	outPath := flag.String("out", "", "Write the CSV rows to this file instead of stdout (implies -format=csv)")
+	concurrency := flag.Int("concurrency", defaultConcurrency, "Block requests in flight at once; each is retried on its own")
+	retryBudget := flag.Int("retry-budget", defaultRetryBudget, "Retries the whole run may spend across all requests before failing fast (0 never retries)")
+	flag.Parse()
+	strictJSON = *strict
+
+	if *retryBudget < 0 {
+		fmt.Fprintln(os.Stderr, "error: -retry-budget must not be negative")
+		os.Exit(1)
+	}
+	retries = retry.NewBudget(*retryBudget, nil)
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "error: -concurrency must be at least 1")
+		os.Exit(1)
+	}
+
+	if *outPath != "" && !flagSet("format") {
+		*format = "csv"
+	}
+	switch {
+	case *format != "text" && *format != "csv":
+		fmt.Fprintf(os.Stderr, "error: unknown -format %q (use text or csv)\n", *format)
+		os.Exit(1)
+	case *outPath != "" && *format != "csv":
+		fmt.Fprintln(os.Stderr, "error: -out writes CSV and cannot be combined with -format=text")
+		os.Exit(1)
+	case *format == "csv" && *watch > 0:
+		fmt.Fprintln(os.Stderr, "error: -format=csv writes one report and cannot be combined with -watch")
+		os.Exit(1)
+	}
+	csvMode = *format == "csv"
+
+	windows, err := parseWindows(*windowsStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: parse windows: %v\n", err)
+		os.Exit(1)
+	}
+	if err := loadBaseRegistry(*registryFile); err != nil {
+		fmt.Fprintf(os.Stderr, "error: -registry-file: %v\n", err)
+		os.Exit(1)
+	}
+	if *registry != "" {
+		if err := loadRegistry(*registry, flagSet("registry")); err != nil {
+			fmt.Fprintf(os.Stderr, "error: -registry: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	chain, useChain, err := lookupChain(*chainName, *chainID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	var replayer http.RoundTripper
+	if *replayPath != "" {
+		if useChain || *chainlist || *provider != "" || *localOnly {
+			fmt.Fprintf(os.Stderr, "error: -replay cannot be combined with -chain, -chain-id, -chainlist, -provider or -local-only\n")
+			os.Exit(1)
+		}
+		fix, err := fixtures.Load(*replayPath)
+		if err == nil {
+			replayer, err = fixtures.NewBorRPC(fix)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -replay: %v\n", err)
+			os.Exit(1)
+		}
+		// Live explorer pages would show unrelated blocks
+		if !flagSet("explorer") {
+			*explorer = ""
+		}
+		// Replayed headers must not end up in the stored cache of the live chain
+		if *cacheBackend != "none" {
+			*cacheBackend = "memory"
+		}
+		fmt.Fprintln(os.Stderr, fix.Banner(*replayPath))
+	}
+	if useChain {
+		if !flagSet("rpc") {
+			*rpcURL = chain.RPC
+		}
+		if *localNetwork == "" {
+			*localNetwork = strconv.FormatUint(chain.ChainID, 10)
+		}
+		if !flagSet("heimdall-rest") {
+			*heimdallREST = chain.HeimdallREST
+		}
+		if !flagSet("explorer") {
+			*explorer = ""
+			if chain.Explorer != "" {
+				*explorer = chain.Explorer + "/block/%d"
+			}
+		}
+	}
+	if links, err = resolveExplorer(*explorer, *network); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	client := &http.Client{Timeout: httpTimeout, Transport: replayer}
+	if endpoints := splitEndpoints(*rpcURL); len(endpoints) > 1 && !*localOnly {
+		if *replayPath != "" || *chainlist || *provider != "" {
+			fmt.Fprintf(os.Stderr, "error: several -rpc endpoints cannot be combined with -replay, -chainlist or -provider\n")
+			os.Exit(1)
+		}
+		f, err := newFailoverRPC(endpoints, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -rpc: %v\n", err)
+			os.Exit(1)
+		}
+		client.Transport, *rpcURL = f, endpoints[0]
+	}
+	if *chainlist && !*localOnly {
+		if flagSet("rpc") {
+			fmt.Fprintf(os.Stderr, "error: -chainlist and -rpc are mutually exclusive\n")
+			os.Exit(1)
+		}
+		id := uint64(137)
+		if useChain {
+			id = chain.ChainID
+		}
+		if *rpcURL, err = resolveChainlistRPC(context.Background(), client, id); err != nil {
+			fmt.Fprintf(os.Stderr, "error: -chainlist: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *provider != "" && !*localOnly {
+		if flagSet("rpc") || *chainlist || useChain {
+			fmt.Fprintf(os.Stderr, "error: -provider cannot be combined with -rpc, -chainlist, -chain or -chain-id\n")
+			os.Exit(1)
+		}
+		u, auth, err := resolveProvider(*provider, *network, *providerKey, *providerSecret)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		*rpcURL, rpcAuth[u] = u, auth
+		secrets = append(secrets, *providerKey, *providerSecret)
+		// quicknode puts the two halves of its key in different URL parts
+		secrets = append(secrets, strings.Split(*providerKey, "/")...)
+		// A wrong key or network shows up here rather than mid-report
+		c, _, _ := lookupChain(map[string]string{"mainnet": "polygon", "amoy": "amoy"}[*network], 0)
+		if err := checkChainID(context.Background(), client, *rpcURL, c); err != nil {
+			fmt.Fprintf(os.Stderr, "error: -provider %s: %v\n", *provider, err)
+			os.Exit(1)
+		}
+	}
+	if useChain && !*chainlist && !*localOnly {
+		if err := checkChainID(context.Background(), client, *rpcURL, chain); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	backend := *cacheBackend
+	// -store postgres://... names its backend by itself
+	if b := blockstore.BackendOf(*storeDSN); b != "" && backend != b {
+		if backend != "file" {
+			fmt.Fprintf(os.Stderr, "error: -store is a %s URL, but -cache-backend is %s\n", b, backend)
+			os.Exit(1)
+		}
+		backend = b
+	}
+	database := backend != "file" && backend != "memory" && backend != "none"
+	if database {
+		if !slices.Contains(blockstore.Known(), backend) {
+			fmt.Fprintf(os.Stderr, "error: unknown -cache-backend %q (use file, %s, memory or none)\n", backend, strings.Join(blockstore.Known(), ", "))
+			os.Exit(1)
+		}
+		if err := blockstore.Available(backend); err != nil {
+			fmt.Fprintf(os.Stderr, "error: -cache-backend: %v\n", err)
+			os.Exit(1)
+		}
+		if *storeDSN == "" && blockstore.Server(backend) {
+			fmt.Fprintf(os.Stderr, "error: -store is required with -cache-backend=%s\n", backend)
+			os.Exit(1)
+		}
+		if *storeDSN == "" && *cacheDir != "" {
+			*storeDSN = blockstore.DefaultPath(*cacheDir, backend)
+		}
+	}
+	if *localOnly {
+		backend = "local"
+	}
+	switch backend {
+	case "local":
+		var err error
+		if database {
+			if *localNetwork == "" {
+				err = fmt.Errorf("-local-network is required with -cache-backend=%s", *cacheBackend)
+			} else {
+				headers, err = loadStoreCache(*cacheBackend, *storeDSN, "bor-"+*localNetwork)
+			}
+		} else {
+			var path string
+			if path, err = localStorePath(*cacheDir, "bor", *localNetwork); err == nil {
+				headers, err = loadBlockCache(path)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -local-only: %v\n", err)
+			os.Exit(1)
+		}
+		offline = true
+	case "none":
+	case "memory":
+		headers = newBlockCache(nil, *headTTL, *maxRecent)
+	default:
+		if (!database && *cacheDir == "") || (database && *storeDSN == "") {
+			break
+		}
+		var chainID string
+		if err := cachedCall(context.Background(), client, *rpcURL, "eth_chainId", []interface{}{}, &chainID); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: cache disabled: get chain id: %v\n", err)
+		} else if id, err := ethrpc.HexToUint64(chainID); err == nil {
+			name := fmt.Sprintf("bor-%d", id)
+			if database {
+				headers, err = openStoreCache(backend, *storeDSN, name, *headTTL, *maxRecent)
+			} else {
+				headers, err = openBlockCache(filepath.Join(*cacheDir, name+".jsonl"), *headTTL, *maxRecent, *maxMB<<20)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: cache disabled: %v\n", err)
+			}
+		}
+	}
+	defer headers.close()
+	if !offline {
+		if n, err := getLatestBlockNumber(context.Background(), client, *rpcURL); err == nil {
+			finalityFrom = probeFinality(context.Background(), client, *rpcURL, *heimdallREST, n)
+		}
+	}
+
+	run := func(ctx context.Context) error {
+		memo.reset()
+		retries = retry.NewBudget(*retryBudget, nil)
+		if useChain && !csvMode {
+			fmt.Printf("Chain: %s (chain id %d, nominal %g s%s)\n", chain.Name, chain.ChainID, chain.BlockTime, chainLabel(chain))
+		}
+
+		// 1) latest block n
+		n, err := getLatestBlockNumber(ctx, client, *rpcURL)
+		if err != nil {
+			return fmt.Errorf("get latest block number: %w", err)
+		}
+		fin, finBy := finalizedHeight(ctx, client, *rpcURL, *heimdallREST, n)
+		headers.setFinalized(fin)
+		revalidateTip(ctx, client, *rpcURL)
+		pinned := *asOfHeight >= 0 || *asOfTime != ""
+		if n, err = resolveAsOf(ctx, client, *rpcURL, n, *asOfHeight, *asOfTime); err != nil {
+			return err
+		}
+
+		// Two explicit anchors replace the lookback report entirely
+		if *fromHeight >= 0 || *fromTime != "" {
+			return runAnchors(ctx, client, *rpcURL, n, *fromHeight, *toHeight, *fromTime, *toTime)
+		}
+
+		// 2) targets {n, n-40000, n-280000, n-560000, n-1120000}
+		targets := []target{
+			{kind: "relative", delta: 0},
+			{kind: "relative", delta: -40000},
+			{kind: "relative", delta: -280000},
+			{kind: "relative", delta: -560000},
+			{kind: "relative", delta: -1120000},
+		}
+		if len(windows) > 0 {
+			targets = targets[:1]
+		}
+
+		// Resolve valid heights (skip negatives/future)
+		var heights []uint64
+		for _, t := range targets {
+			if h, ok := t.resolve(n); ok {
+				heights = append(heights, h)
+			}
+		}
+
+		// Fetch timestamps
+		type info struct {
+			height    uint64
+			timestamp uint64
+		}
+		infos := make(map[uint64]info)
+		fetchErrs := make(map[uint64]error)
+		var mu sync.Mutex
+		g := fetch.NewGroup(ctx, *concurrency)
+		for _, h := range heights {
+			g.Go(func(ctx context.Context) error {
+				ts, err := getBlockTimestamp(ctx, client, *rpcURL, h)
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if errors.Is(err, retry.ErrExhausted) {
+					return err
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					fetchErrs[h] = err
+					return nil
+				}
+				infos[h] = info{height: h, timestamp: ts}
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		for _, h := range heights {
+			if err := fetchErrs[h]; err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to fetch block %d: %v\n", h, err)
+			}
+		}
+
+		// Ensure n present
+		nTS, ok := func() (uint64, bool) {
+			if x, ok := infos[n]; ok {
+				return x.timestamp, true
+			}
+			ts, err := getBlockTimestamp(ctx, client, *rpcURL, n)
+			if err != nil {
+				return 0, false
+			}
+			infos[n] = info{height: n, timestamp: ts}
+			return ts, true
+		}()
+		if !ok {
+			return fmt.Errorf("failed to fetch latest block %d timestamp", n)
+		}
+		samples := make(map[uint64]time.Time, len(infos))
+		for h, x := range infos {
+			samples[h] = time.Unix(int64(x.timestamp), 0)
+		}
+		headAge := *maxHeadAge
+		if offline || pinned {
+			// A stored or pinned head is old by design
+			headAge = 0
+		}
+		if err := flagImplausible(checkTimestamps(n, samples, headAge), *strictTime); err != nil {
+			return err
+		}
+
+		// 5) Pretty header for current block
+		if !csvMode {
+			fmt.Printf("Current block: %s — %s (UTC)\n",
+				human.CommasUint(n),
+				isoTime(infos[n].timestamp),
+			)
+			printLink(n)
+			// The live finality boundary says nothing about a pinned head,
+			// and would make two pinned runs differ
+			if !pinned {
+				fmt.Printf("Finalized    : %s (%s)\n", human.CommasUint(fin), finBy)
+			}
+		}
+
+		// 6) Pretty per-reference output
+		for _, t := range targets {
+			h, ok := t.resolve(n)
+			if !ok || h == n {
+				continue
+			}
+			src, ok := infos[h]
+			if !ok {
+				continue
+			}
+			// First line: Δ<blocks> from <h> (<iso>) → <n>
+			deltaLabel := fmt.Sprintf("Δ%d", int64(n)-int64(h)) // no commas to match the inspiration
+			printReference(deltaLabel, h, src.timestamp, n, nTS)
+		}
+
+		// 7) Wall-clock windows: find the first block at or after each window start
+		for _, w := range windows {
+			start := int64(nTS) - int64(w.d.Seconds())
+			if start < 0 {
+				start = 0
+			}
+			h, ts, err := findBlockAtOrAfter(ctx, client, *rpcURL, uint64(start), 0, n)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: window %s: %v\n", w.label, err)
+				continue
+			}
+			if h == n {
+				fmt.Fprintf(os.Stderr, "warning: window %s: no block before head\n", w.label)
+				continue
+			}
+			printReference(w.label, h, ts, n, nTS)
+		}
+		return nil
+	}
+
+	if err := runWatch(*watch, run); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if csvMode {
+		if err := writeCSV(*outPath, csvRows); err != nil {
+			fmt.Fprintf(os.Stderr, "error: write CSV: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// avgRow is one row of -format=csv: the average over the blocks from From
+// to To. Lookback is the block count, or the window (e.g. 7d) it came from.
+type avgRow struct {
+	Lookback string
+	From, To uint64
+	Elapsed  int64 // seconds
+	Avg      float64
+}
+
+// writeCSV writes rows under a header line to path, or to stdout when path
+// is empty. A file is replaced whole, so an archive never holds half a
+// report.
+func writeCSV(path string, rows []avgRow) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"lookback", "from_height", "to_height", "elapsed_seconds", "avg_block_time"})
+	for _, r := range rows {
+		w.Write([]string{r.Lookback, strconv.FormatUint(r.From, 10), strconv.FormatUint(r.To, 10), strconv.FormatInt(r.Elapsed, 10), strconv.FormatFloat(r.Avg, 'f', 6, 64)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if path == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// runWatch calls run once, or with a positive interval keeps calling it on
+// that interval until interrupted. Failures inside the loop are reported and
+// retried on the next tick instead of exiting.
+func runWatch(interval time.Duration, run func(context.Context) error) error {
+	if interval <= 0 {
+		return run(context.Background())
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		fmt.Printf("=== %s ===\n", time.Now().UTC().Format(time.RFC3339))
+		if err := run(ctx); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+		fmt.Println()
+	}
+}
+
+// checkTimestamps reports what a healthy endpoint never returns: a head
+// block further than maxAge from the local clock (0 skips this), or sampled
+// timestamps that do not increase with height.
+func checkTimestamps(head uint64, samples map[uint64]time.Time, maxAge time.Duration) error {
+	var problems []string
+	if t, ok := samples[head]; ok && maxAge > 0 {
+		switch age := time.Since(t); {
+		case age < -maxAge:
+			problems = append(problems, fmt.Sprintf("head block %d is %s in the future", head, (-age).Round(time.Second)))
+		case age > maxAge:
+			problems = append(problems, fmt.Sprintf("head block %d is %s old", head, age.Round(time.Second)))
+		}
+	}
+	heights := make([]uint64, 0, len(samples))
+	for h := range samples {
+		heights = append(heights, h)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	for i := 1; i < len(heights); i++ {
+		lo, hi := heights[i-1], heights[i]
+		if !samples[hi].After(samples[lo]) {
+			problems = append(problems, fmt.Sprintf("block %d (%s) is not later than block %d (%s)", hi, samples[hi].UTC().Format(time.RFC3339), lo, samples[lo].UTC().Format(time.RFC3339)))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// flagImplausible warns loudly about implausible timestamps, or returns
+// them as the error when strict.
+func flagImplausible(err error, strict bool) error {
+	if err == nil {
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("implausible block timestamps: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "WARNING: implausible block timestamps: %v\n", err)
+	fmt.Fprintf(os.Stderr, "WARNING: the endpoint or the local clock is wrong and the numbers below may be too; -strict-time makes this an error\n")
+	return nil
+}
+
+// resolveAsOf pins the head used by the report to -as-of-height or to the
+// last block at or before -as-of-time, so reruns produce identical output.
+func resolveAsOf(ctx context.Context, client *http.Client, rpcURL string, latest uint64, asOfHeight int64, asOfTime string) (uint64, error) {
+	switch {
+	case asOfHeight >= 0 && asOfTime != "":
+		return 0, errors.New("-as-of-height and -as-of-time are mutually exclusive")
+	case asOfHeight >= 0:
+		if uint64(asOfHeight) > latest {
+			return 0, fmt.Errorf("-as-of-height %d is beyond the latest block %d", asOfHeight, latest)
+		}
+		return uint64(asOfHeight), nil
+	case asOfTime != "":
+		t, err := parseTime(asOfTime)
+		if err != nil {
+			return 0, fmt.Errorf("parse -as-of-time: %w", err)
+		}
+		if t.Unix() < 0 {
+			return 0, fmt.Errorf("-as-of-time %s is before genesis", asOfTime)
+		}
+		h, hTS, err := findBlockAtOrAfter(ctx, client, rpcURL, uint64(t.Unix())+1, 0, latest)
+		if err != nil {
+			return 0, err
+		}
+		if hTS <= uint64(t.Unix()) {
+			return 0, fmt.Errorf("-as-of-time %s is not before the latest block %d", asOfTime, latest)
+		}
+		if h == 0 {
+			return 0, fmt.Errorf("-as-of-time %s is before genesis", asOfTime)
+		}
+		return h - 1, nil
+	default:
+		return latest, nil
+	}
+}
+
+// runAnchors prints the exact average between two explicit blocks, given
+// either as heights or as times resolved by binary search.
+func runAnchors(ctx context.Context, client *http.Client, rpcURL string, n uint64, fromH, toH int64, fromT, toT string) error {
+	resolve := func(name string, h int64, ts string) (uint64, uint64, error) {
+		switch {
+		case h >= 0 && ts != "":
+			return 0, 0, fmt.Errorf("-%s-height and -%s-time are mutually exclusive", name, name)
+		case h >= 0:
+			if uint64(h) > n {
+				return 0, 0, fmt.Errorf("-%s-height %d is beyond the latest block %d", name, h, n)
+			}
+			hTS, err := getBlockTimestamp(ctx, client, rpcURL, uint64(h))
+			if err != nil {
+				return 0, 0, fmt.Errorf("fetch block %d: %w", h, err)
+			}
+			return uint64(h), hTS, nil
+		case ts != "":
+			t, err := parseTime(ts)
+			if err != nil {
+				return 0, 0, fmt.Errorf("parse -%s-time: %w", name, err)
+			}
+			if t.Unix() < 0 {
+				t = time.Unix(0, 0)
+			}
+			return findBlockAtOrAfter(ctx, client, rpcURL, uint64(t.Unix()), 0, n)
+		default:
+			hTS, err := getBlockTimestamp(ctx, client, rpcURL, n)
+			if err != nil {
+				return 0, 0, fmt.Errorf("fetch latest block %d: %w", n, err)
+			}
+			return n, hTS, nil
+		}
+	}
+
+	a, aTS, err := resolve("from", fromH, fromT)
+	if err != nil {
+		return err
+	}
+	b, bTS, err := resolve("to", toH, toT)
+	if err != nil {
+		return err
+	}
+	if a == b {
+		return fmt.Errorf("anchors resolve to the same block %d", a)
+	}
+	if a > b {
+		a, aTS, b, bTS = b, bTS, a, aTS
+	}
+
+	blockDiff := b - a
+	secDiff := int64(bTS) - int64(aTS)
+	avg := float64(secDiff) / float64(blockDiff)
+
+	if csvMode {
+		csvRows = append(csvRows, avgRow{Lookback: strconv.FormatUint(blockDiff, 10), From: a, To: b, Elapsed: secDiff, Avg: avg})
+		return nil
+	}
+	fmt.Printf("From block : %s — %s (UTC)\n", human.CommasUint(a), isoTime(aTS))
+	printLink(a)
+	fmt.Printf("To block   : %s — %s (UTC)\n", human.CommasUint(b), isoTime(bTS))
+	printLink(b)
+	fmt.Printf("\n  blocks     : %s\n", human.CommasUint(blockDiff))
+	fmt.Printf("  elapsed    : %s (%d s)\n", human.DHMS(time.Duration(secDiff)*time.Second), secDiff)
+	fmt.Printf("  avg block  : %.6f s/block  (%.3f ms)\n", avg, avg*1000.0)
+	printThroughput(avg)
+	return nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("unsupported time format %q (use RFC3339, e.g. 2025-10-07T14:00:00Z)", s)
+}
+
+func printReference(label string, h, hTS, n, nTS uint64) {
+	blockDiff := int64(n) - int64(h)
+	secDiff := int64(nTS) - int64(hTS)
+	avg := math.NaN()
+	if blockDiff != 0 {
+		avg = float64(secDiff) / float64(blockDiff)
+	}
+	if csvMode {
+		csvRows = append(csvRows, avgRow{Lookback: strings.TrimPrefix(label, "Δ"), From: h, To: n, Elapsed: secDiff, Avg: avg})
+		return
+	}
+
+	fmt.Printf("\n%-10s from height %s (%s)  \u2192  %s\n",
+		label,
+		human.CommasUint(h),
+		isoTime(hTS),
+		human.CommasUint(n),
+	)
+	printLink(h)
+
+	// Second line: elapsed (as 0d Xh Ym Zs, always showing units)
+	fmt.Printf("  elapsed    : %s\n", human.DHMS(time.Duration(secDiff)*time.Second))
+
+	// Third line: avg block time (seconds + milliseconds)
+	fmt.Printf("  avg block  : %.6f s/block  (%.3f ms)\n",
+		avg,
+		avg*1000.0,
+	)
+
+	// Fourth line: the same rate as blocks per hour/day
+	printThroughput(avg)
+}
+
+// printLink prints the explorer link of height below the line naming it.
+func printLink(height uint64) {
+	if u := links.url(height, false); u != "" {
+		fmt.Printf("  explorer   : %s\n", u)
+	}
+}
+
+// printThroughput prints the blocks/hour and blocks/day equivalent of an
+// average block time, the figure fork docs and capacity plans usually quote.
+func printThroughput(avgSeconds float64) {
+	fmt.Printf("  throughput : %.1f blocks/h  (%.0f blocks/day)\n", 3600/avgSeconds, 86400/avgSeconds)
+}
+
+// window is one -windows entry: its length, and the label it was given
+// as, which the report echoes rather than a normalized form.
+type window struct {
+	label string
+	d     time.Duration
+}
+
+// parseWindows parses a comma-separated list of durations. On top of
+// time.ParseDuration units it accepts "d" (days) and "w" (weeks).
+func parseWindows(s string) ([]window, error) {
+	var out []window
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var d time.Duration
+		switch {
+		case strings.HasSuffix(part, "d") || strings.HasSuffix(part, "w"):
+			n, err := strconv.ParseFloat(part[:len(part)-1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid window %q", part)
+			}
+			unit := 24 * time.Hour
+			if strings.HasSuffix(part, "w") {
+				unit *= 7
+			}
+			d = time.Duration(n * float64(unit))
+		default:
+			var err error
+			if d, err = time.ParseDuration(part); err != nil {
+				return nil, fmt.Errorf("invalid window %q", part)
+			}
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("window %q must be positive", part)
+		}
+		out = append(out, window{label: part, d: d})
+	}
+	return out, nil
+}
+
+// findBlockAtOrAfter binary-searches [lo, hi] for the first block whose
+// timestamp is >= ts. hi is returned if no earlier block qualifies.
+func findBlockAtOrAfter(ctx context.Context, client *http.Client, rpcURL string, ts, lo, hi uint64) (uint64, uint64, error) {
+	if offline {
+		// Search only the stored range, and refuse to silently clamp to it
+		if low := headers.lowest(); low > lo {
+			lo = low
+			if b, _ := headers.get(low); b.Timestamp > ts {
+				return 0, 0, fmt.Errorf("%s is before the first block in the local store (%s at %s)", isoTime(ts), human.CommasUint(low), isoTime(b.Timestamp))
+			}
+		}
+	}
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		midTS, err := getBlockTimestamp(ctx, client, rpcURL, mid)
+		if err != nil {
+			return 0, 0, err
+		}
+		if midTS >= ts {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	hTS, err := getBlockTimestamp(ctx, client, rpcURL, lo)
+	if err != nil {
+		return 0, 0, err
+	}
+	return lo, hTS, nil
+}
+
+type target struct {
+	kind  string // "relative" or "absolute"
+	delta int64  // for relative
+	value uint64 // for absolute
+}
+
+func (t target) resolve(n uint64) (uint64, bool) {
+	switch t.kind {
+	case "relative":
+		if t.delta >= 0 {
+			return n + uint64(t.delta), true
+		}
+		d := uint64(-t.delta)
+		if d > n {
+			return 0, false
+		}
+		return n - d, true
+	case "absolute":
+		if t.value > n {
+			return 0, false
+		}
+		return t.value, true
+	default:
+		return 0, false
+	}
+}
+
+// explorerURLs are the block page templates of an explorer on one network.
+// Countdown, when set, is used for heights not produced yet.
+type explorerURLs struct {
+	Block     string
+	Countdown string
+}
+
+// blockExplorers maps an -explorer preset to its templates per network.
+var blockExplorers = map[string]map[string]explorerURLs{
+	"polygonscan": {
+		"mainnet": {Block: "https://polygonscan.com/block/%d", Countdown: "https://polygonscan.com/block/countdown/%d"},
+		"amoy":    {Block: "https://amoy.polygonscan.com/block/%d", Countdown: "https://amoy.polygonscan.com/block/countdown/%d"},
+	},
+	"oklink": {
+		"mainnet": {Block: "https://www.oklink.com/polygon/block/%d"},
+		"amoy":    {Block: "https://www.oklink.com/amoy/block/%d"},
+	},
+}
+
+// resolveExplorer turns -explorer into templates for network. The flag is a
+// preset name, a URL template with one %d for the height, or empty for no
+// links.
+func resolveExplorer(name, network string) (explorerURLs, error) {
+	switch {
+	case name == "":
+		return explorerURLs{}, nil
+	case strings.Count(name, "%d") == 1:
+		return explorerURLs{Block: name}, nil
+	}
+	byNetwork, ok := blockExplorers[name]
+	if !ok {
+		return explorerURLs{}, fmt.Errorf("unknown -explorer %q (use polygonscan, oklink or a URL template with %%d)", name)
+	}
+	u, ok := byNetwork[network]
+	if !ok {
+		return explorerURLs{}, fmt.Errorf("-explorer %s has no links for network %q", name, network)
+	}
+	return u, nil
+}
+
+// url links height, or returns "" when links are disabled.
+func (e explorerURLs) url(height uint64, future bool) string {
+	if future && e.Countdown != "" {
+		return fmt.Sprintf(e.Countdown, height)
+	}
+	if e.Block == "" {
+		return ""
+	}
+	return fmt.Sprintf(e.Block, height)
+}
+
+// evmChain is an entry of the embedded chain registry that -chain and
+// -chain-id select, so the calculator works against any EVM JSON-RPC.
+type evmChain struct {
+	Key       string  `json:"key"`
+	Name      string  `json:"name"`
+	ChainID   uint64  `json:"chain_id"`
+	RPC       string  `json:"rpc"`
+	BlockTime float64 `json:"block_time"` // nominal seconds per block
+	Explorer  string  `json:"explorer,omitempty"`
+	// Fixed marks chains whose protocol produces a block every BlockTime
+	// seconds exactly, so predictions need no historical average.
+	Fixed bool `json:"fixed,omitempty"`
+	// HeimdallREST is the Heimdall REST API of a Bor network, whose
+	// milestones mark finality when the RPC lacks the "finalized" tag.
+	HeimdallREST string `json:"heimdall_rest,omitempty"`
+}
+
+// builtinRegistry is the embedded chain registry and Bor hardfork table, so
+// one file works on an air-gapped machine; -registry-file replaces it with
+// a newer copy without rebuilding.
+var builtinRegistry = registry.JSON
+
+// registryFile is the layout of the embedded registry and -registry-file.
+type registryFile struct {
+	Chains    []evmChain `json:"chains"`
+	Hardforks []hardfork `json:"hardforks"`
+}
+
+// hardfork is a known Bor upgrade and the block it activates at. The table
+// copies bor's chain configs; a node's own config is authoritative.
+type hardfork struct {
+	Network string `json:"network"` // as -network, e.g. mainnet or amoy
+	Name    string `json:"name"`
+	Block   uint64 `json:"block"`
+}
+
+// chainRegistry and hardforks are the registry in use, set by
+// loadBaseRegistry.
+var (
+	chainRegistry []evmChain
+	hardforks     []hardfork
+)
+
+// loadBaseRegistry loads the registry from path, or the embedded one when
+// path is empty. Unlike the chains -registry adds, the file replaces the
+// embedded registry entirely.
+func loadBaseRegistry(path string) error {
+	b, name := builtinRegistry, "embedded registry"
+	if path != "" {
+		var err error
+		if b, err = os.ReadFile(path); err != nil {
+			return err
+		}
+		name = path
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var reg registryFile
+	if err := dec.Decode(&reg); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	for i, c := range reg.Chains {
+		var err error
+		if reg.Chains[i], err = checkChain(name, i, c); err != nil {
+			return err
+		}
+	}
+	for i, f := range reg.Hardforks {
+		if f.Network == "" || f.Name == "" || f.Block == 0 {
+			return fmt.Errorf("%s: hardfork %d needs a network, a name and a block", name, i)
+		}
+	}
+	chainRegistry, hardforks = reg.Chains, reg.Hardforks
+	return nil
+}
+
+func defaultRegistryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".chain-utils", "chains.json")
+}
+
+// loadRegistry adds the chains listed in the JSON file at path to
+// chainRegistry, so devnets and other networks without a built-in entry
+// work with -chain and -chain-id. An entry with the key or chain id of an
+// existing one replaces it. A missing file is only an error when required.
+func loadRegistry(path string, required bool) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var chains []evmChain
+	if err := dec.Decode(&chains); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for i, c := range chains {
+		c, err := checkChain(path, i, c)
+		if err != nil {
+			return err
+		}
+		replaced := false
+		for j, r := range chainRegistry {
+			if strings.EqualFold(r.Key, c.Key) || r.ChainID == c.ChainID {
+				chainRegistry[j], replaced = c, true
+				break
+			}
+		}
+		if !replaced {
+			chainRegistry = append(chainRegistry, c)
+		}
+	}
+	return nil
+}
+
+// checkChain validates entry i of a registry file at path, naming it after
+// its key when it has no name.
+func checkChain(path string, i int, c evmChain) (evmChain, error) {
+	switch {
+	case c.Key == "":
+		return c, fmt.Errorf("%s: entry %d has no key", path, i)
+	case c.ChainID == 0:
+		return c, fmt.Errorf("%s: %s has no chain_id", path, c.Key)
+	case c.RPC == "":
+		return c, fmt.Errorf("%s: %s has no rpc", path, c.Key)
+	case c.BlockTime <= 0:
+		return c, fmt.Errorf("%s: %s needs a positive block_time", path, c.Key)
+	}
+	if c.Name == "" {
+		c.Name = c.Key
+	}
+	return c, nil
+}
+
+// lookupChain returns the registry entry named by -chain or numbered by
+// -chain-id. ok is false when neither flag is set.
+func lookupChain(name string, id uint64) (c evmChain, ok bool, err error) {
+	if name == "" && id == 0 {
+		return evmChain{}, false, nil
+	}
+	for _, c := range chainRegistry {
+		if (name == "" || strings.EqualFold(c.Key, name)) && (id == 0 || c.ChainID == id) {
+			return c, true, nil
+		}
+	}
+	keys := make([]string, len(chainRegistry))
+	for i, c := range chainRegistry {
+		keys[i] = c.Key
+	}
+	if name != "" && id != 0 {
+		return evmChain{}, false, fmt.Errorf("-chain %q and -chain-id %d name different chains", name, id)
+	}
+	if name != "" {
+		return evmChain{}, false, fmt.Errorf("unknown -chain %q (known: %s)", name, strings.Join(keys, ", "))
+	}
+	return evmChain{}, false, fmt.Errorf("chain id %d is not in the registry (known: %s)", id, strings.Join(keys, ", "))
+}
+
+func chainLabel(c evmChain) string {
+	var s string
+	if c.Fixed {
+		s += ", fixed"
+	}
+	if c.Explorer != "" {
+		s += ", " + c.Explorer
+	}
+	return s
+}
+
+// checkChainID fails when the endpoint does not serve the selected chain.
+func checkChainID(ctx context.Context, client *http.Client, rpcURL string, c evmChain) error {
+	var hex string
+	if err := cachedCall(ctx, client, rpcURL, "eth_chainId", []interface{}{}, &hex); err != nil {
+		return fmt.Errorf("get chain id: %w", err)
+	}
+	id, err := ethrpc.HexToUint64(hex)
+	if err != nil {
+		return fmt.Errorf("parse chain id: %w", err)
+	}
+	if id != c.ChainID {
+		return fmt.Errorf("endpoint %s serves chain id %d, but %s is chain id %d", redact(rpcURL), id, c.Name, c.ChainID)
+	}
+	return nil
+}
+
+// chainlistSnapshotDate is when chainlistRPCs was copied from the chainlist
+// registry (chainlist.org). -chainlist warns once it is older than
+// chainlistMaxAge, as public endpoints come and go.
+const (
+	chainlistSnapshotDate = "2026-10-01"
+	chainlistMaxAge       = 90 * 24 * time.Hour
+)
+
+// chainlistRPCs are the keyless public HTTPS endpoints of the registry
+// chains, in the order -chainlist tries them.
+var chainlistRPCs = map[uint64][]string{
+	137:      {"https://polygon-rpc.com", "https://polygon-bor-rpc.publicnode.com", "https://polygon.drpc.org", "https://1rpc.io/matic"},
+	80002:    {"https://rpc-amoy.polygon.technology", "https://polygon-amoy-bor-rpc.publicnode.com", "https://polygon-amoy.drpc.org"},
+	1:        {"https://ethereum-rpc.publicnode.com", "https://eth.drpc.org", "https://1rpc.io/eth", "https://cloudflare-eth.com"},
+	11155111: {"https://ethereum-sepolia-rpc.publicnode.com", "https://sepolia.drpc.org", "https://rpc.sepolia.org"},
+	100:      {"https://rpc.gnosischain.com", "https://gnosis-rpc.publicnode.com", "https://gnosis.drpc.org"},
+	56:       {"https://bsc-dataseed.bnbchain.org", "https://bsc-rpc.publicnode.com", "https://bsc.drpc.org"},
+	43114:    {"https://api.avax.network/ext/bc/C/rpc", "https://avalanche-c-chain-rpc.publicnode.com", "https://avalanche.drpc.org"},
+	42161:    {"https://arb1.arbitrum.io/rpc", "https://arbitrum-one-rpc.publicnode.com", "https://arbitrum.drpc.org"},
+	10:       {"https://mainnet.optimism.io", "https://optimism-rpc.publicnode.com", "https://optimism.drpc.org"},
+	8453:     {"https://mainnet.base.org", "https://base-rpc.publicnode.com", "https://base.drpc.org"},
+	1101:     {"https://zkevm-rpc.com", "https://polygon-zkevm.drpc.org"},
+	2442:     {"https://rpc.cardona.zkevm-rpc.com"},
+}
+
+// resolveChainlistRPC returns the first snapshot endpoint for chainID that
+// answers eth_chainId with it, warning when the snapshot is stale.
+func resolveChainlistRPC(ctx context.Context, client *http.Client, chainID uint64) (string, error) {
+	if taken, err := time.Parse(time.DateOnly, chainlistSnapshotDate); err == nil && time.Since(taken) > chainlistMaxAge {
+		fmt.Fprintf(os.Stderr, "warning: the embedded chainlist snapshot is from %s; its endpoints may be outdated, pass -rpc if none answers\n", chainlistSnapshotDate)
+	}
+	urls, ok := chainlistRPCs[chainID]
+	if !ok {
+		return "", fmt.Errorf("the chainlist snapshot has no endpoints for chain id %d", chainID)
+	}
+	var errs []string
+	for _, u := range urls {
+		probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		var hex string
+		err := cachedCall(probeCtx, client, u, "eth_chainId", []interface{}{}, &hex)
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", u, err))
+			continue
+		}
+		if id, err := ethrpc.HexToUint64(hex); err != nil || id != chainID {
+			errs = append(errs, fmt.Sprintf("%s: serves chain id %s", u, hex))
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "using public RPC %s (chainlist snapshot of %s)\n", u, chainlistSnapshotDate)
+		return u, nil
+	}
+	return "", fmt.Errorf("no chainlist endpoint for chain id %d answered:\n  %s", chainID, strings.Join(errs, "\n  "))
+}
+
+// rpcProviders are the Polygon endpoints of hosted RPC providers per
+// network, so -provider and -key replace a hand-built -rpc URL. %s is the
+// API key; QuickNode's -key is "<endpoint-name>/<token>" since each of its
+// endpoints has its own subdomain.
+var rpcProviders = map[string]map[string]string{
+	"alchemy": {
+		"mainnet": "https://polygon-mainnet.g.alchemy.com/v2",
+		"amoy":    "https://polygon-amoy.g.alchemy.com/v2",
+	},
+	"infura": {
+		"mainnet": "https://polygon-mainnet.infura.io/v3/%s",
+		"amoy":    "https://polygon-amoy.infura.io/v3/%s",
+	},
+	"quicknode": {
+		"mainnet": "https://%s.matic.quiknode.pro/%s/",
+		"amoy":    "https://%s.matic-amoy.quiknode.pro/%s/",
+	},
+	"ankr": {
+		"mainnet": "https://rpc.ankr.com/polygon/%s",
+		"amoy":    "https://rpc.ankr.com/polygon_amoy/%s",
+	},
+}
+
+// rpcAuth holds the headers sent to a provider endpoint, keyed by its URL
+// so they never leak to any other endpoint.
+var rpcAuth = map[string]http.Header{}
+
+// resolveProvider expands -provider for network. Alchemy takes the key as a
+// bearer token instead of in the URL; Infura's optional API key secret is
+// sent as basic auth.
+func resolveProvider(name, network, key, secret string) (string, http.Header, error) {
+	byNetwork, ok := rpcProviders[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown -provider %q (use alchemy, infura, quicknode or ankr)", name)
+	}
+	tmpl, ok := byNetwork[network]
+	if !ok {
+		return "", nil, fmt.Errorf("-provider %s has no endpoint for network %q (use mainnet or amoy)", name, network)
+	}
+	if key == "" {
+		return "", nil, fmt.Errorf("-provider %s needs -key", name)
+	}
+	h := http.Header{}
+	switch name {
+	case "alchemy":
+		h.Set("Authorization", "Bearer "+key)
+		return tmpl, h, nil
+	case "quicknode":
+		endpoint, token, ok := strings.Cut(key, "/")
+		if !ok || endpoint == "" || token == "" {
+			return "", nil, fmt.Errorf("-provider quicknode needs -key=<endpoint-name>/<token>")
+		}
+		return fmt.Sprintf(tmpl, endpoint, token), h, nil
+	case "infura":
+		if secret != "" {
+			h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(":"+secret)))
+		}
+	}
+	return fmt.Sprintf(tmpl, key), h, nil
+}
+
+// flagSet reports whether the named flag was passed on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// staleBlocks is how far an endpoint's head may trail the best head of a
+// multi-endpoint -rpc before requests stop going to it.
+const staleBlocks = 32
+
+// failoverCooldown is how long an endpoint that failed is tried only after
+// the others.
+const failoverCooldown = 30 * time.Second
+
+// failoverRPC spreads JSON-RPC requests over the endpoints of a
+// comma-separated -rpc. Requests go round-robin; one that fails, is
+// rate-limited (HTTP 429) or gets a 5xx moves on to the next endpoint
+// within the same attempt, and the failed endpoint goes to the back of the
+// line for failoverCooldown. Head queries go to every endpoint at once and
+// are answered from the highest head, and endpoints trailing it by more
+// than staleBlocks are only tried once the others fail.
+type failoverRPC struct {
+	next      http.RoundTripper
+	endpoints []*url.URL
+
+	mu     sync.Mutex
+	turn   int
+	heads  []uint64    // last head each endpoint reported, 0 when unknown
+	lagged []bool      // whether each endpoint was stale at the last head query
+	down   []time.Time // when each endpoint last failed
+}
+
+// splitEndpoints splits a comma-separated -rpc.
+func splitEndpoints(s string) []string {
+	var out []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func newFailoverRPC(endpoints []string, next http.RoundTripper) (*failoverRPC, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	f := &failoverRPC{next: next, heads: make([]uint64, len(endpoints)), lagged: make([]bool, len(endpoints)), down: make([]time.Time, len(endpoints))}
+	for _, e := range endpoints {
+		u, err := url.Parse(e)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("endpoint %q is not an http(s) URL", clip(e))
+		}
+		f.endpoints = append(f.endpoints, u)
+	}
+	return f, nil
+}
+
+func (f *failoverRPC) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	var call struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	_ = json.Unmarshal(body, &call)
+	if call.Method == "eth_blockNumber" || (call.Method == "eth_getBlockByNumber" && len(call.Params) > 0 && string(call.Params[0]) == `"latest"`) {
+		return f.head(req, body)
+	}
+
+	var lastResp *http.Response
+	var lastErr error
+	for _, i := range f.order() {
+		resp, err := f.send(req, body, i)
+		if err == nil && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			return resp, err
+		}
+		if lastResp != nil {
+			lastResp.Body.Close()
+		}
+		lastResp, lastErr = resp, err
+		f.mu.Lock()
+		f.down[i] = time.Now()
+		f.mu.Unlock()
+		fmt.Fprintf(os.Stderr, "warning: %s: %s; failing over\n", f.endpoints[i].Host, failoverReason(resp, err))
+	}
+	return lastResp, lastErr
+}
+
+// head sends a head query to every endpoint and answers with the highest
+// head, so a lagging endpoint never moves the reported head back.
+func (f *failoverRPC) head(req *http.Request, body []byte) (*http.Response, error) {
+	type answer struct {
+		resp   *http.Response
+		raw    []byte
+		height uint64
+		err    error
+	}
+	answers := make([]answer, len(f.endpoints))
+	var wg sync.WaitGroup
+	for i := range f.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a := &answers[i]
+			if a.resp, a.err = f.send(req, body, i); a.err != nil {
+				return
+			}
+			a.raw, a.err = io.ReadAll(a.resp.Body)
+			a.resp.Body.Close()
+			if a.err != nil || a.resp.StatusCode != http.StatusOK {
+				return
+			}
+			var env struct {
+				Result json.RawMessage `json:"result"`
+			}
+			var hex string
+			if json.Unmarshal(a.raw, &env) != nil || json.Unmarshal(env.Result, &hex) != nil {
+				var b struct {
+					Number string `json:"number"`
+				}
+				if json.Unmarshal(env.Result, &b) != nil {
+					return
+				}
+				hex = b.Number
+			}
+			a.height, _ = ethrpc.HexToUint64(hex)
+		}()
+	}
+	wg.Wait()
+
+	best := -1
+	f.mu.Lock()
+	for i, a := range answers {
+		if a.height > 0 {
+			f.heads[i] = a.height
+			if best < 0 || a.height > answers[best].height {
+				best = i
+			}
+		}
+	}
+	if best >= 0 {
+		// Warn once when an endpoint falls behind, not on every head query
+		for i, a := range answers {
+			stale := a.height > 0 && a.height+staleBlocks < answers[best].height
+			if stale && !f.lagged[i] {
+				fmt.Fprintf(os.Stderr, "warning: %s is %d blocks behind %s; using it only if the others fail\n",
+					f.endpoints[i].Host, answers[best].height-a.height, f.endpoints[best].Host)
+			}
+			f.lagged[i] = stale
+		}
+	}
+	f.mu.Unlock()
+	if best < 0 {
+		// No endpoint reported a head; pass an answer on so the caller
+		// sees the failure
+		for _, a := range answers {
+			if a.err == nil {
+				a.resp.Body = io.NopCloser(bytes.NewReader(a.raw))
+				return a.resp, nil
+			}
+		}
+		return nil, answers[len(answers)-1].err
+	}
+	resp := answers[best].resp
+	resp.Body = io.NopCloser(bytes.NewReader(answers[best].raw))
+	return resp, nil
+}
+
+// order returns the endpoints to try for one request: the healthy ones
+// from the next round-robin turn, then those that failed recently, then the
+// stale ones.
+func (f *failoverRPC) order() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	top := slices.Max(f.heads)
+	var healthy, failed, stale []int
+	for k := range f.endpoints {
+		i := (f.turn + k) % len(f.endpoints)
+		switch {
+		case f.heads[i] > 0 && f.heads[i]+staleBlocks < top:
+			stale = append(stale, i)
+		case time.Since(f.down[i]) < failoverCooldown:
+			failed = append(failed, i)
+		default:
+			healthy = append(healthy, i)
+		}
+	}
+	f.turn++
+	return slices.Concat(healthy, failed, stale)
+}
+
+// send sends req with body to endpoint i.
+func (f *failoverRPC) send(req *http.Request, body []byte, i int) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL = f.endpoints[i]
+	r.Host = ""
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return f.next.RoundTrip(r)
+}
+
+// failoverReason describes why a request to an endpoint was given up on.
+func failoverReason(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("HTTP %d", resp.StatusCode)
+}
+
+func getLatestBlockNumber(ctx context.Context, client *http.Client, rpcURL string) (uint64, error) {
+	if offline {
+		return headers.highest(), nil
+	}
+	var hex string
+	if err := cachedCall(ctx, client, rpcURL, "eth_blockNumber", []interface{}{}, &hex); err != nil {
+		return 0, err
+	}
+	return ethrpc.HexToUint64(hex)
+}
+
+func getBlockTimestamp(ctx context.Context, client *http.Client, rpcURL string, height uint64) (uint64, error) {
+	if b, ok := headers.get(height); ok {
+		return b.Timestamp, nil
+	}
+	if offline {
+		return 0, fmt.Errorf("block %d is not in the local store; fetch it with block_history.go sync -from=%d", height, height)
+	}
+	b, parent, err := fetchBlock(ctx, client, rpcURL, height)
+	if err != nil {
+		return 0, err
+	}
+	if height > 0 {
+		verifyParent(ctx, client, rpcURL, height, parent)
+	}
+	headers.put(b)
+	return b.Timestamp, nil
+}
+
+// fetchBlock fetches a block header from the RPC, bypassing the cache, and
+// returns it with its parent hash.
+func fetchBlock(ctx context.Context, client *http.Client, rpcURL string, height uint64) (cachedBlock, string, error) {
+	hexHeight := fmt.Sprintf("0x%x", height)
+	params := []interface{}{hexHeight, false}
+	var respBlock *block
+	if err := cachedCall(ctx, client, rpcURL, "eth_getBlockByNumber", params, &respBlock); err != nil {
+		return cachedBlock{}, "", err
+	}
+	if respBlock == nil || respBlock.Timestamp == "" {
+		return cachedBlock{}, "", fmt.Errorf("empty block/timestamp for height %d", height)
+	}
+	ts, err := ethrpc.HexToUint64(respBlock.Timestamp)
+	if err != nil {
+		return cachedBlock{}, "", err
+	}
+	return cachedBlock{Height: height, Hash: respBlock.Hash, Timestamp: ts}, respBlock.ParentHash, nil
+}
+
+// verifyParent compares the parent hash of a freshly fetched block with the
+// provisional cache entry below it. A mismatch means the chain reorged after
+// that entry was cached: walk back, refetching, until a cached hash matches
+// again, and replace every provisional entry above that fork point so stale
+// near-head timestamps never reach the statistics.
+func verifyParent(ctx context.Context, client *http.Client, rpcURL string, height uint64, parent string) {
+	h, want := height-1, parent
+	var refetched []cachedBlock
+	for {
+		c, ok := headers.provisional(h)
+		if !ok || c.Hash == "" || c.Hash == want {
+			break
+		}
+		b, p, err := fetchBlock(ctx, client, rpcURL, h)
+		if err != nil {
+			// Can't tell how deep the reorg goes; h is stale either way.
+			fmt.Fprintf(os.Stderr, "warning: refetch block %d after reorg: %v\n", h, err)
+			headers.invalidateAbove(h - 1)
+			break
+		}
+		refetched = append(refetched, b)
+		if h == 0 {
+			break
+		}
+		h, want = h-1, p
+	}
+	if len(refetched) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: reorg detected below block %d; replaced %d cached blocks down to %d\n", height, len(refetched), refetched[len(refetched)-1].Height)
+	headers.invalidateAbove(refetched[len(refetched)-1].Height - 1)
+	for _, b := range refetched {
+		headers.put(b)
+	}
+}
+
+// revalidateTip refetches the highest provisional cache entry. Blocks fetched
+// later in a run are checked against their parents, but a watch loop that
+// finds everything cached would otherwise never notice a reorg.
+func revalidateTip(ctx context.Context, client *http.Client, rpcURL string) {
+	tip, ok := headers.provisionalTip()
+	if !ok {
+		return
+	}
+	b, parent, err := fetchBlock(ctx, client, rpcURL, tip.Height)
+	if err != nil || b.Hash == tip.Hash {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: reorg detected at block %d; dropping cached blocks from there on\n", tip.Height)
+	headers.invalidateAbove(tip.Height - 1)
+	verifyParent(ctx, client, rpcURL, tip.Height, parent)
+	headers.put(b)
+}
+
+// finalityMethods are the ways finalizedHeight learns the finalized block,
+// most precise first. Not every provider serves the "finalized" or "safe"
+// tag, and each unsupported call costs a round of retries, so
+// probeFinality picks the first one that works once at startup.
+var finalityMethods = []string{"finalized", "safe", "milestone", "depth"}
+
+// finalityFrom indexes the finalityMethods probeFinality settled on.
+var finalityFrom int
+
+func probeFinality(ctx context.Context, client *http.Client, rpcURL, restBase string, head uint64) int {
+	for i, m := range finalityMethods {
+		if _, err := finalizedBy(ctx, client, rpcURL, restBase, m, head); err == nil {
+			return i
+		}
+	}
+	return len(finalityMethods) - 1
+}
+
+// finalizedHeight returns the finalized block and how it was learned: the
+// RPC's "finalized" or "safe" tag, the end of the latest Heimdall milestone
+// when restBase is set, or a conservative distance below head. It starts
+// from the method probeFinality chose and falls through to the next one
+// when that stops working.
+func finalizedHeight(ctx context.Context, client *http.Client, rpcURL, restBase string, head uint64) (uint64, string) {
+	if offline {
+		// Everything in the synced store is finalized
+		return head, "local store"
+	}
+	for i := finalityFrom; i < len(finalityMethods); i++ {
+		m := finalityMethods[i]
+		h, err := finalizedBy(ctx, client, rpcURL, restBase, m, head)
+		if err == nil {
+			return h, finalityLabel(m)
+		}
+		if i == finalityFrom || m == "milestone" && restBase != "" {
+			fmt.Fprintf(os.Stderr, "warning: finality from %s: %v\n", finalityLabel(m), err)
+		}
+	}
+	return 0, finalityLabel("depth")
+}
+
+func finalizedBy(ctx context.Context, client *http.Client, rpcURL, restBase, method string, head uint64) (uint64, error) {
+	switch method {
+	case "finalized", "safe":
+		var respBlock *block
+		if err := cachedCall(ctx, client, rpcURL, "eth_getBlockByNumber", []interface{}{method, false}, &respBlock); err != nil {
+			return 0, err
+		}
+		if respBlock == nil {
+			return 0, fmt.Errorf("no %q block", method)
+		}
+		return ethrpc.HexToUint64(respBlock.Number)
+	case "milestone":
+		if restBase == "" {
+			return 0, errors.New("no -heimdall-rest")
+		}
+		h, err := latestMilestone(ctx, client, restBase)
+		if err != nil {
+			return 0, err
+		}
+		return min(h, head), nil
+	default:
+		if head < reorgSafetyDepth {
+			return 0, nil
+		}
+		return head - reorgSafetyDepth, nil
+	}
+}
+
+func finalityLabel(method string) string {
+	switch method {
+	case "finalized", "safe":
+		return fmt.Sprintf("%q tag", method)
+	case "milestone":
+		return "Heimdall milestone"
+	default:
+		return fmt.Sprintf("%d blocks below head, as neither tag nor -heimdall-rest answered", reorgSafetyDepth)
+	}
+}
+
+func latestMilestone(ctx context.Context, client *http.Client, restBase string) (uint64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(restBase, "/")+"/milestones/latest", nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("HTTP %d for %s", resp.StatusCode, req.URL)
+	}
+	type milestone struct {
+		EndBlock json.Number `json:"end_block"`
+	}
+	var out struct {
+		Milestone milestone `json:"milestone"`
+		Result    milestone `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, err
+	}
+	end := out.Milestone.EndBlock
+	if end == "" {
+		end = out.Result.EndBlock
+	}
+	return strconv.ParseUint(end.String(), 10, 64)
+}
+
+// blockCache keeps (height, hash, timestamp) of finalized blocks forever,
+// persisted to an append-only JSON-lines file per network when f is set, so
+// repeated runs and binary searches don't refetch immutable history from
+// rate-limited RPCs. Blocks above the finalized height can still reorg and
+// are only kept in memory for headTTL, at most maxRecent of them. A nil
+// *blockCache is a valid, disabled cache. With db set, finalized blocks
+// are persisted to that database backend instead of a file; a key-value
+// backend also keeps the provisional entries until they expire, so the
+// next run within headTTL reuses them.
+type blockCache struct {
+	mu        sync.Mutex
+	f         *os.File
+	db        blockstore.Store
+	entries   map[uint64]cachedBlock
+	recent    map[uint64]recentBlock
+	headTTL   time.Duration
+	maxRecent int
+	finalized uint64
+}
+
+type recentBlock struct {
+	cachedBlock
+	expires time.Time
+	used    time.Time
+}
+
+type cachedBlock struct {
+	Height    uint64 `json:"height"`
+	Hash      string `json:"hash,omitempty"`
+	Timestamp uint64 `json:"timestamp"`
+}
+
+func defaultCacheDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".chain-utils", "cache")
+}
+
+func newBlockCache(f *os.File, headTTL time.Duration, maxRecent int) *blockCache {
+	return &blockCache{f: f, entries: make(map[uint64]cachedBlock), recent: make(map[uint64]recentBlock), headTTL: headTTL, maxRecent: maxRecent}
+}
+
+func openBlockCache(path string, headTTL time.Duration, maxRecent int, maxBytes int64) (*blockCache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	c := newBlockCache(f, headTTL, maxRecent)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var b cachedBlock
+		if json.Unmarshal(sc.Bytes(), &b) == nil {
+			c.entries[b.Height] = b
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return c, err
+	}
+	if maxBytes > 0 {
+		if err := c.shrink(path, maxBytes); err != nil {
+			c.close()
+			return nil, fmt.Errorf("shrink %s: %w", path, err)
+		}
+	}
+	return c, nil
+}
+
+// openStoreCache opens the cache of network (e.g. bor-137) in the database
+// backend at dsn, loading every block it holds.
+func openStoreCache(backend, dsn, network string, headTTL time.Duration, maxRecent int) (*blockCache, error) {
+	db, err := blockstore.Open(backend, dsn, network)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := db.Load(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("load %s: %w", network, err)
+	}
+	c := newBlockCache(nil, headTTL, maxRecent)
+	c.db = db
+	for _, b := range blocks {
+		c.entries[uint64(b.Height)] = cachedBlock{Height: uint64(b.Height), Hash: b.Hash, Timestamp: uint64(b.Time.Unix())}
+	}
+	if kv, ok := db.(blockstore.Expiring); ok && headTTL > 0 && maxRecent > 0 {
+		recent, err := kv.LoadRecent(context.Background())
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("load %s: %w", network, err)
+		}
+		// An entry kept by a run with a longer -cache-head-ttl expires on
+		// this run's terms
+		now := time.Now()
+		for _, r := range recent {
+			b := cachedBlock{Height: uint64(r.Height), Hash: r.Hash, Timestamp: uint64(r.Time.Unix())}
+			c.recent[b.Height] = recentBlock{cachedBlock: b, expires: minTime(r.Expires, now.Add(headTTL)), used: now}
+		}
+		c.evictRecent()
+	}
+	return c, nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// loadStoreCache reads network's blocks from the database backend at dsn,
+// for -local-only runs; the database is closed again once they are read.
+func loadStoreCache(backend, dsn, network string) (*blockCache, error) {
+	c, err := openStoreCache(backend, dsn, network, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	c.db.Close()
+	c.db = nil
+	if len(c.entries) == 0 {
+		return nil, fmt.Errorf("%s holds no %s blocks", blockstore.Redact(dsn), network)
+	}
+	return c, nil
+}
+
+// loadBlockCache reads a store file without opening it for writing, for
+// -local-only runs on read-only or air-gapped hosts.
+func loadBlockCache(path string) (*blockCache, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := newBlockCache(nil, 0, 0)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		var b cachedBlock
+		if json.Unmarshal(sc.Bytes(), &b) == nil {
+			c.entries[b.Height] = b
+		}
+	}
+	if len(c.entries) == 0 {
+		return nil, fmt.Errorf("%s holds no blocks", path)
+	}
+	return c, sc.Err()
+}
+
+// localStorePath picks the store read by -local-only: the named network, or
+// the only one of this chain under dir.
+func localStorePath(dir, chain, network string) (string, error) {
+	if network != "" {
+		return filepath.Join(dir, chain+"-"+network+".jsonl"), nil
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, chain+"-*.jsonl"))
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no %s store in %s; sync one with block_history.go sync", chain, dir)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("several %s stores in %s; pick one with -local-network", chain, dir)
+	}
+}
+
+// lowest returns the lowest stored height.
+func (c *blockCache) lowest() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lo, first := uint64(0), true
+	for h := range c.entries {
+		if first || h < lo {
+			lo, first = h, false
+		}
+	}
+	return lo
+}
+
+// highest returns the highest stored height.
+func (c *blockCache) highest() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var hi uint64
+	for h := range c.entries {
+		hi = max(hi, h)
+	}
+	return hi
+}
+
+// setFinalized moves the finality boundary. Provisional entries that are now
+// at or below it are dropped rather than promoted: their hash was never
+// checked against the finalized chain, so they are refetched before being
+// cached for good.
+func (c *blockCache) setFinalized(h uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.finalized = h
+	var drop []uint64
+	for k := range c.recent {
+		if k <= h {
+			drop = append(drop, k)
+		}
+	}
+	c.dropRecent(drop...)
+}
+
+// shrink rewrites the cache file to at most maxBytes when it has grown past
+// that, keeping the newest heights: old history is the cheapest to refetch
+// and the least likely to be asked for again.
+func (c *blockCache) shrink(path string, maxBytes int64) error {
+	st, err := c.f.Stat()
+	if err != nil || st.Size() <= maxBytes {
+		return err
+	}
+	heights := make([]uint64, 0, len(c.entries))
+	for h := range c.entries {
+		heights = append(heights, h)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] > heights[j] })
+	var lines [][]byte
+	var size int64
+	for _, h := range heights {
+		line, _ := json.Marshal(c.entries[h])
+		if size+int64(len(line))+1 > maxBytes {
+			delete(c.entries, h)
+			continue
+		}
+		size += int64(len(line)) + 1
+		lines = append(lines, line)
+	}
+	var buf bytes.Buffer
+	for i := len(lines) - 1; i >= 0; i-- {
+		buf.Write(lines[i])
+		buf.WriteByte('\n')
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	c.f.Close()
+	c.f, err = os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o644)
+	return err
+}
+
+func (c *blockCache) get(h uint64) (cachedBlock, bool) {
+	if c == nil {
+		return cachedBlock{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, ok := c.entries[h]; ok {
+		return b, true
+	}
+	if r, ok := c.recent[h]; ok {
+		if now := time.Now(); now.Before(r.expires) {
+			r.used = now
+			c.recent[h] = r
+			return r.cachedBlock, true
+		}
+		c.dropRecent(h)
+	}
+	return cachedBlock{}, false
+}
+
+// provisional returns an unexpired cache entry above the finalized height.
+func (c *blockCache) provisional(h uint64) (cachedBlock, bool) {
+	if c == nil {
+		return cachedBlock{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.recent[h]
+	if !ok || !time.Now().Before(r.expires) {
+		return cachedBlock{}, false
+	}
+	return r.cachedBlock, true
+}
+
+// provisionalTip returns the highest unexpired provisional entry.
+func (c *blockCache) provisionalTip() (cachedBlock, bool) {
+	if c == nil {
+		return cachedBlock{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var tip recentBlock
+	found := false
+	for h, r := range c.recent {
+		if time.Now().Before(r.expires) && (!found || h > tip.Height) {
+			tip, found = r, true
+		}
+	}
+	return tip.cachedBlock, found
+}
+
+// evictRecent drops the least recently used provisional entries beyond
+// maxRecent. Callers hold c.mu.
+func (c *blockCache) evictRecent() {
+	for len(c.recent) > c.maxRecent {
+		var oldest uint64
+		first := true
+		for h, r := range c.recent {
+			if first || r.used.Before(c.recent[oldest].used) {
+				oldest, first = h, false
+			}
+		}
+		c.dropRecent(oldest)
+	}
+}
+
+// dropRecent forgets the provisional entries at heights, in the database
+// too when it keeps them. Callers hold c.mu.
+func (c *blockCache) dropRecent(heights ...uint64) {
+	for _, h := range heights {
+		delete(c.recent, h)
+	}
+	kv, ok := c.db.(blockstore.Expiring)
+	if !ok || len(heights) == 0 {
+		return
+	}
+	hs := make([]int64, len(heights))
+	for i, h := range heights {
+		hs[i] = int64(h)
+	}
+	if err := kv.DropRecent(context.Background(), hs); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: write cache: %v\n", err)
+	}
+}
+
+// invalidateAbove drops every provisional entry above the fork height.
+// Finalized entries cannot reorg and are kept.
+func (c *blockCache) invalidateAbove(fork uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var drop []uint64
+	for h := range c.recent {
+		if h > fork {
+			drop = append(drop, h)
+		}
+	}
+	c.dropRecent(drop...)
+}
+
+func (c *blockCache) put(b cachedBlock) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b.Height > c.finalized {
+		if c.headTTL > 0 && c.maxRecent > 0 {
+			now := time.Now()
+			r := recentBlock{cachedBlock: b, expires: now.Add(c.headTTL), used: now}
+			c.recent[b.Height] = r
+			if kv, ok := c.db.(blockstore.Expiring); ok {
+				blk := blockstore.Block{Height: int64(b.Height), Hash: b.Hash, Time: time.Unix(int64(b.Timestamp), 0).UTC()}
+				if err := kv.PutRecent(context.Background(), blockstore.Recent{Block: blk, Expires: r.expires}); err != nil {
+					fmt.Fprintf(os.Stderr, "warning: write cache: %v\n", err)
+				}
+			}
+			c.evictRecent()
+		}
+		return
+	}
+	if _, ok := c.entries[b.Height]; ok {
+		return
+	}
+	c.entries[b.Height] = b
+	if c.db != nil {
+		blk := blockstore.Block{Height: int64(b.Height), Hash: b.Hash, Time: time.Unix(int64(b.Timestamp), 0).UTC()}
+		if err := c.db.Add(context.Background(), []blockstore.Block{blk}); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: write cache: %v\n", err)
+		}
+		return
+	}
+	if c.f == nil {
+		return
+	}
+	line, _ := json.Marshal(b)
+	if _, err := c.f.Write(append(line, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: write cache: %v\n", err)
+	}
+}
+
+func (c *blockCache) close() {
+	if c == nil {
+		return
+	}
+	if c.f != nil {
+		c.f.Close()
+	}
+	if c.db != nil {
+		c.db.Close()
+	}
+}
+
+// rpcMemo remembers eth_getBlockByNumber results for explicit heights within
+// a single run, so the head block or a binary-search midpoint is only fetched
+// once per run even with the header cache disabled. It is reset at the start
+// of every run, so -watch still sees new data.
+type rpcMemo struct {
+	mu      sync.Mutex
+	results map[string]any
+}
+
+func newRPCMemo() *rpcMemo {
+	return &rpcMemo{results: make(map[string]any)}
+}
+
+func (m *rpcMemo) reset() {
+	m.mu.Lock()
+	m.results = make(map[string]any)
+	m.mu.Unlock()
+}
+
+// key returns the memo key of a call, or "" when its result may change
+// within a run (tags such as "latest" or "finalized", other methods).
+func (m *rpcMemo) key(method string, params []interface{}) string {
+	if method != "eth_getBlockByNumber" || len(params) == 0 {
+		return ""
+	}
+	if tag, ok := params[0].(string); !ok || !strings.HasPrefix(tag, "0x") {
+		return ""
+	}
+	b, _ := json.Marshal(params)
+	return method + string(b)
+}
+
+// cachedCall calls method on rpcURL with ethrpc.Call. Answers memo keeps
+// are served from it, and -local-only refuses the call.
+func cachedCall[T any](ctx context.Context, client *http.Client, rpcURL, method string, params []interface{}, out *T) error {
+	if offline {
+		return fmt.Errorf("rpc %s: network access disabled by -local-only", method)
+	}
+	key := memo.key(method, params)
+	if key != "" {
+		memo.mu.Lock()
+		v, ok := memo.results[key]
+		memo.mu.Unlock()
+		if r, isT := v.(T); ok && isT {
+			*out = r
+			return nil
+		}
+	}
+	var result T
+	if err := ethrpc.Call(ctx, client, rpcURL, method, params, &result, rpcOptions(rpcURL)...); err != nil {
+		// transport errors quote the URL, which holds a -provider key
+		return redactErr(err)
+	}
+	*out = result
+	if key != "" {
+		memo.mu.Lock()
+		memo.results[key] = result
+		memo.mu.Unlock()
+	}
+	return nil
+}
+
+// rpcOptions are the ethrpc options every call to rpcURL takes on top of
+// ethrpc.Call's retry policy: the run's retry budget, the provider's
+// headers from rpcAuth and -strict decoding.
+func rpcOptions(rpcURL string) []ethrpc.Option {
+	opts := []ethrpc.Option{ethrpc.WithRetryGate(retries.Spend)}
+	for k, vs := range rpcAuth[rpcURL] {
+		for _, v := range vs {
+			opts = append(opts, ethrpc.WithHeader(k, v))
+		}
+	}
+	if strictJSON {
+		opts = append(opts, ethrpc.WithStrict())
+	}
+	return opts
+}
+
+// secrets are the -provider credentials, kept out of errors.
+var secrets []string
+
+// redact replaces every secret in v.
+func redact(v string) string {
+	for _, sec := range secrets {
+		if sec != "" {
+			v = strings.ReplaceAll(v, sec, "REDACTED")
+		}
+	}
+	return v
+}
+
+// redactedError is err with the secrets redacted from its message; errors.Is
+// and errors.As still see err.
+type redactedError struct{ err error }
+
+func (e redactedError) Error() string { return redact(e.err.Error()) }
+func (e redactedError) Unwrap() error { return e.err }
+
+// redactErr wraps err in a redactedError once a -provider key is set.
+func redactErr(err error) error {
+	if err == nil || len(secrets) == 0 {
+		return err
+	}
+	return redactedError{err}
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+func isoTime(unixSec uint64) string {
+	return time.Unix(int64(unixSec), 0).UTC().Format(time.RFC3339)
+}
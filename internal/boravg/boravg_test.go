@@ -0,0 +1,347 @@
+package boravg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/pkg/retry"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the calculator end to end through its
+// flags and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("BOR_AVERAGE_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// genesisTime is block 0 of the test chain. Blocks come every 3s up to
+// height 1,000,000 and every 2s after it.
+const genesisTime = 1_700_000_000
+
+func blockTime(h uint64) uint64 {
+	if h <= 1_000_000 {
+		return genesisTime + 3*h
+	}
+	return genesisTime + 3_000_000 + 2*(h-1_000_000)
+}
+
+// borNode is a Bor JSON-RPC endpoint over the test chain.
+type borNode struct {
+	head     uint64
+	pruned   uint64          // blocks below answer as on a pruned node
+	bad      map[uint64]bool // blocks whose timestamp is not hex
+	fork     uint64          // blocks from here on hash as the "b" branch
+	every429 int             // every nth request is rate limited
+
+	mu    sync.Mutex
+	calls int
+	reads map[uint64]int
+}
+
+func (n *borNode) hash(h uint64) string {
+	branch := "a"
+	if n.fork > 0 && h >= n.fork {
+		branch = "b"
+	}
+	return fmt.Sprintf("0x%s%063x", branch, h)
+}
+
+func (n *borNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params []any           `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if n.every429 > 0 && n.calls%n.every429 == 0 {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+		return
+	}
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "eth_blockNumber":
+		resp["result"] = fmt.Sprintf("0x%x", n.head)
+	case "eth_chainId":
+		resp["result"] = "0x89"
+	case "eth_getBlockByNumber":
+		h := n.head
+		switch tag := req.Params[0].(string); tag {
+		case "latest":
+		case "finalized", "safe":
+			h = n.head - 100
+		default:
+			h, _ = strconv.ParseUint(strings.TrimPrefix(tag, "0x"), 16, 64)
+		}
+		n.reads[h]++
+		switch {
+		case h > n.head:
+			resp["result"] = nil
+		case h < n.pruned:
+			resp["error"] = map[string]any{"code": -32000, "message": "header not found"}
+		default:
+			ts := fmt.Sprintf("0x%x", blockTime(h))
+			if n.bad[h] {
+				ts = "yesterday"
+			}
+			parent := ""
+			if h > 0 {
+				parent = n.hash(h - 1)
+			}
+			resp["result"] = map[string]string{"number": fmt.Sprintf("0x%x", h), "hash": n.hash(h), "parentHash": parent, "timestamp": ts}
+		}
+	default:
+		resp["error"] = map[string]any{"code": -32601, "message": "method not found"}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func newBorNode(t *testing.T, n *borNode) string {
+	t.Helper()
+	n.reads = make(map[uint64]int)
+	srv := httptest.NewServer(n)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs the calculator with args and returns its stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-cache-dir=", "-explorer=", "-max-head-age=0"}, args...)...)
+	cmd.Env = append(os.Environ(), "BOR_AVERAGE_RUN_MAIN=1", "HOME="+t.TempDir())
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+const healthyCSV = `lookback,from_height,to_height,elapsed_seconds,avg_block_time
+40000,1960000,2000000,80000,2.000000
+280000,1720000,2000000,560000,2.000000
+560000,1440000,2000000,1120000,2.000000
+1120000,880000,2000000,2360000,2.107143
+`
+
+func TestAverages(t *testing.T) {
+	url := newBorNode(t, &borNode{head: 2_000_000})
+	stdout, stderr, err := run(t, "-rpc="+url, "-format=csv")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if stdout != healthyCSV {
+		t.Errorf("got\n%s\nwant\n%s", stdout, healthyCSV)
+	}
+}
+
+func TestAveragesText(t *testing.T) {
+	url := newBorNode(t, &borNode{head: 2_000_000})
+	stdout, stderr, err := run(t, "-rpc="+url)
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	for _, want := range []string{
+		"Current block: 2,000,000 — 2024-01-11T19:06:40Z (UTC)",
+		`Finalized    : 1,999,900 ("finalized" tag)`,
+		"Δ1120000   from height 880,000 (2023-12-15T11:33:20Z)  →  2,000,000",
+		"  elapsed    : 27d 7h 33m 20s",
+		"  avg block  : 2.107143 s/block  (2107.143 ms)",
+		"  throughput : 1708.5 blocks/h  (41003 blocks/day)",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestAveragesRateLimited(t *testing.T) {
+	node := &borNode{head: 2_000_000, every429: 3}
+	url := newBorNode(t, node)
+	stdout, stderr, err := run(t, "-rpc="+url, "-format=csv", "-concurrency=1")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if stdout != healthyCSV {
+		t.Errorf("got\n%s\nwant\n%s", stdout, healthyCSV)
+	}
+}
+
+func TestAveragesRetryBudget(t *testing.T) {
+	url := newBorNode(t, &borNode{head: 2_000_000, every429: 1})
+	_, stderr, err := run(t, "-rpc="+url, "-retry-budget=1")
+	if err == nil || !strings.Contains(stderr, "retry budget exhausted: 1 retries spent, failures seen: 2 rate limited") {
+		t.Fatalf("run error = %v, want the spent budget reported:\n%s", err, stderr)
+	}
+}
+
+func TestAveragesPruned(t *testing.T) {
+	url := newBorNode(t, &borNode{head: 2_000_000, pruned: 1_500_000})
+	stdout, stderr, err := run(t, "-rpc="+url, "-format=csv")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	want := "lookback,from_height,to_height,elapsed_seconds,avg_block_time\n40000,1960000,2000000,80000,2.000000\n280000,1720000,2000000,560000,2.000000\n"
+	if stdout != want {
+		t.Errorf("got\n%s\nwant\n%s", stdout, want)
+	}
+	for _, h := range []string{"1440000", "880000"} {
+		if !strings.Contains(stderr, "warning: failed to fetch block "+h) || !strings.Contains(stderr, "header not found") {
+			t.Errorf("stderr does not warn about pruned block %s:\n%s", h, stderr)
+		}
+	}
+}
+
+func TestAveragesMalformed(t *testing.T) {
+	url := newBorNode(t, &borNode{head: 2_000_000, bad: map[uint64]bool{1_720_000: true}})
+	stdout, stderr, err := run(t, "-rpc="+url, "-format=csv")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if strings.Contains(stdout, "1720000") || !strings.Contains(stdout, "560000,1440000") {
+		t.Errorf("the malformed block should be skipped and the rest reported:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "warning: failed to fetch block 1720000") {
+		t.Errorf("stderr does not warn about the malformed block:\n%s", stderr)
+	}
+
+	url = newBorNode(t, &borNode{head: 2_000_000, bad: map[uint64]bool{2_000_000: true}})
+	if _, stderr, err := run(t, "-rpc="+url); err == nil || !strings.Contains(stderr, "failed to fetch latest block 2000000 timestamp") {
+		t.Errorf("run error = %v, want a malformed head to fail the run:\n%s", err, stderr)
+	}
+}
+
+func TestProviderKeyRedacted(t *testing.T) {
+	// The proxy refuses the connection, so the run fails on an error that
+	// quotes the provider URL
+	t.Setenv("HTTPS_PROXY", "http://127.0.0.1:1")
+	_, stderr, err := run(t, "-provider=infura", "-key=SECRETKEY123", "-key-secret=SECRETSECRET456")
+	if err == nil || !strings.Contains(stderr, "https://polygon-mainnet.infura.io/v3/REDACTED") {
+		t.Errorf("run error = %v, want the endpoint with its key redacted:\n%s", err, stderr)
+	}
+	if strings.Contains(stderr, "SECRET") {
+		t.Errorf("stderr leaks the provider key:\n%s", stderr)
+	}
+}
+
+func TestAnchors(t *testing.T) {
+	url := newBorNode(t, &borNode{head: 2_000_000})
+	stdout, stderr, err := run(t, "-rpc="+url, "-format=csv", "-from-height=999000", "-to-height=1001000")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if want := "999000,1001000,5000,2.500000"; !strings.Contains(stdout, want) {
+		t.Errorf("got\n%s\nwant a row ending %s", stdout, want)
+	}
+}
+
+func TestAsOfTime(t *testing.T) {
+	url := newBorNode(t, &borNode{head: 2_000_000})
+	at := time.Unix(int64(blockTime(1_500_000))+1, 0).UTC().Format(time.RFC3339)
+	stdout, stderr, err := run(t, "-rpc="+url, "-format=csv", "-as-of-time="+at)
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if want := "40000,1460000,1500000,80000,2.000000"; !strings.Contains(stdout, want) {
+		t.Errorf("got\n%s\nwant the report pinned to block 1500000", stdout)
+	}
+	// The live finalized height would differ between two pinned runs
+	stdout, stderr, err = run(t, "-rpc="+url, "-as-of-height=1500000")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Current block: 1,500,000") || strings.Contains(stdout, "Finalized") {
+		t.Errorf("a pinned report should leave out the live finalized height:\n%s", stdout)
+	}
+}
+
+func TestReorg(t *testing.T) {
+	node := &borNode{head: 2_000_000}
+	url := newBorNode(t, node)
+	client := &http.Client{Timeout: 5 * time.Second}
+	retries = retry.NewBudget(defaultRetryBudget, nil)
+	headers = newBlockCache(nil, time.Hour, 100)
+	defer func() { headers = nil }()
+	headers.setFinalized(1_999_000)
+	ctx := context.Background()
+
+	for h := uint64(1_999_990); h <= 1_999_995; h++ {
+		if _, err := getBlockTimestamp(ctx, client, url, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Before the next run the chain reorgs from 1,999,993: the cached
+	// 1,999,993-1,999,995 are now on the orphaned branch
+	node.mu.Lock()
+	node.fork = 1_999_993
+	node.mu.Unlock()
+	memo.reset()
+	if _, err := getBlockTimestamp(ctx, client, url, 1_999_996); err != nil {
+		t.Fatal(err)
+	}
+	for h := uint64(1_999_990); h <= 1_999_996; h++ {
+		b, ok := headers.provisional(h)
+		if !ok || b.Hash != node.hash(h) {
+			t.Errorf("cached block %d = %+v, %v, want hash %s", h, b, ok, node.hash(h))
+		}
+	}
+	if a, b := node.reads[1_999_993], node.reads[1_999_992]; a != 2 || b != 1 {
+		t.Errorf("blocks 1999993 and 1999992 read %d and %d times, want the first refetched and the walk to stop at the fork", a, b)
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []window
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"24h, 7d,2w", []window{{"24h", 24 * time.Hour}, {"7d", 7 * 24 * time.Hour}, {"2w", 14 * 24 * time.Hour}}, false},
+		{"1.5d", []window{{"1.5d", 36 * time.Hour}}, false},
+		{"90m", []window{{"90m", 90 * time.Minute}}, false},
+		{"0d", nil, true},
+		{"-1h", nil, true},
+		{"xd", nil, true},
+		{"soon", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseWindows(tt.in)
+		if (err != nil) != tt.wantErr || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseWindows(%q) = %v, %v, want %v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckTimestamps(t *testing.T) {
+	at := func(s int64) time.Time { return time.Unix(s, 0) }
+	if err := checkTimestamps(3, map[uint64]time.Time{1: at(10), 2: at(12), 3: at(14)}, 0); err != nil {
+		t.Errorf("increasing timestamps: %v", err)
+	}
+	err := checkTimestamps(3, map[uint64]time.Time{1: at(10), 2: at(12), 3: at(12)}, 0)
+	if err == nil || !strings.Contains(err.Error(), "block 3") {
+		t.Errorf("repeated timestamp: error = %v, want block 3 flagged", err)
+	}
+	err = checkTimestamps(3, map[uint64]time.Time{3: time.Now().Add(-time.Hour)}, time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "old") {
+		t.Errorf("stale head: error = %v, want it flagged", err)
+	}
+}
@@ -0,0 +1,57 @@
+//go:build bbolt || badger
+
+package boravg
+
+import (
+	"strings"
+	"testing"
+)
+
+// testKVCache checks that a key-value backend keeps the blocks above the
+// finalized height (1,999,900 on the mock) for -cache-head-ttl, so a rerun
+// within it reuses them and only refetches the highest one.
+func testKVCache(t *testing.T, backend string) {
+	node := &borNode{head: 2_000_000}
+	url := newBorNode(t, node)
+	dir := t.TempDir()
+	args := []string{"-rpc=" + url, "-cache-dir=" + dir, "-cache-backend=" + backend, "-format=csv", "-from-height=1999950", "-to-height=1999990"}
+	const want = "lookback,from_height,to_height,elapsed_seconds,avg_block_time\n40,1999950,1999990,80,2.000000\n"
+	var stderr string
+	rerun := func(name string, extra ...string) map[uint64]int {
+		t.Helper()
+		node.mu.Lock()
+		node.reads = make(map[uint64]int)
+		node.mu.Unlock()
+		var stdout string
+		var err error
+		stdout, stderr, err = run(t, append(args, extra...)...)
+		if err != nil || stdout != want {
+			t.Fatalf("%s: %v\n%s%s", name, err, stdout, stderr)
+		}
+		return node.reads
+	}
+
+	rerun("first run", "-cache-head-ttl=1m")
+	if reads := rerun("second run", "-cache-head-ttl=1m"); reads[1_999_950] != 0 || reads[1_999_990] != 1 {
+		t.Errorf("second run reads = %v, want the near-head anchor from the store and the tip refetched", reads)
+	}
+	// A run with a shorter TTL holds the kept entries to it
+	if reads := rerun("short TTL", "-cache-head-ttl=1ns"); reads[1_999_950] != 1 {
+		t.Errorf("short TTL reads = %v, want the near-head anchor refetched", reads)
+	}
+
+	// A reorg under the kept tip is caught by refetching it, and the
+	// replacement is kept in its place
+	rerun("refill", "-cache-head-ttl=1m")
+	node.mu.Lock()
+	node.fork = 1_999_960
+	node.mu.Unlock()
+	rerun("after reorg", "-cache-head-ttl=1m")
+	if !strings.Contains(stderr, "reorg detected at block 1999990") {
+		t.Errorf("after reorg: no reorg warning\n%s", stderr)
+	}
+	rerun("on the new branch", "-cache-head-ttl=1m")
+	if strings.Contains(stderr, "reorg detected") {
+		t.Errorf("the kept tip is still from the orphaned branch:\n%s", stderr)
+	}
+}
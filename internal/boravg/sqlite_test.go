@@ -0,0 +1,7 @@
+//go:build sqlite
+
+package boravg
+
+import "testing"
+
+func TestSQLiteCache(t *testing.T) { testDatabaseCache(t, "sqlite") }
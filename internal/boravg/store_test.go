@@ -0,0 +1,46 @@
+//go:build sqlite || bbolt || badger
+
+package boravg
+
+import (
+	"strings"
+	"testing"
+)
+
+// testDatabaseCache runs a pinned report against a database backend twice,
+// then offline.
+func testDatabaseCache(t *testing.T, backend string) {
+	node := &borNode{head: 2_000_000}
+	url := newBorNode(t, node)
+	dir := t.TempDir()
+	args := []string{"-rpc=" + url, "-cache-dir=" + dir, "-cache-backend=" + backend, "-format=csv", "-as-of-height=1500000"}
+	const want = "40000,1460000,1500000,80000,2.000000"
+
+	stdout, stderr, err := run(t, args...)
+	if err != nil || !strings.Contains(stdout, want) {
+		t.Fatalf("first run: %v\n%s%s", err, stdout, stderr)
+	}
+	// Every block of a pinned report is finalized, so the second run
+	// reads them all from the database
+	node.mu.Lock()
+	node.reads = make(map[uint64]int)
+	node.mu.Unlock()
+	stdout, stderr, err = run(t, args...)
+	if err != nil || !strings.Contains(stdout, want) {
+		t.Fatalf("second run: %v\n%s%s", err, stdout, stderr)
+	}
+	for _, h := range []uint64{1_500_000, 1_460_000, 1_220_000, 940_000, 380_000} {
+		if n := node.reads[h]; n != 0 {
+			t.Errorf("block %d fetched %d times with it in the cache", h, n)
+		}
+	}
+
+	// -local-only answers from the database without the endpoint
+	stdout, stderr, err = run(t, "-rpc=http://127.0.0.1:1", "-cache-dir="+dir, "-cache-backend="+backend, "-local-only", "-local-network=137", "-format=csv")
+	if err != nil || !strings.Contains(stdout, "40000,1460000,1500000,80000,2.000000") {
+		t.Errorf("-local-only: %v\n%s%s", err, stdout, stderr)
+	}
+	if _, stderr, err := run(t, "-cache-dir="+dir, "-cache-backend="+backend, "-local-only"); err == nil || !strings.Contains(stderr, "-local-network is required with -cache-backend="+backend) {
+		t.Errorf("-local-only without -local-network: %v\n%s", err, stderr)
+	}
+}
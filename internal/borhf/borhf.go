@@ -0,0 +1,2384 @@
+// Package borhf is bor_hf_block_calculator.go: it predicts the Bor block a
+// hardfork time lands on.
+package borhf
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"embed"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/blocktime"
+	"github.com/pratikspatil024/chain-utils/fixtures"
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+	"github.com/pratikspatil024/chain-utils/pkg/fetch"
+	"github.com/pratikspatil024/chain-utils/pkg/human"
+	"github.com/pratikspatil024/chain-utils/pkg/ledger"
+	"github.com/pratikspatil024/chain-utils/registry"
+)
+
+const (
+	toolName    = "bor_hf_block_calculator.go"
+	defaultRPC  = "https://polygon-rpc.com"
+	jsonrpcVer  = "2.0"
+	httpTimeout = 20 * time.Second
+
+	// defaultLookback is about a week of blocks at 2 s, the window the
+	// block time is measured over when -avg is not given
+	defaultLookback = 302400
+
+	// sampleConcurrency bounds the -sample block requests in flight at once
+	sampleConcurrency = 8
+)
+
+type block struct {
+	Number    string `json:"number"`
+	Timestamp string `json:"timestamp"`
+}
+
+// strictJSON is set by -strict; see ethrpc.WithStrict.
+var strictJSON bool
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	// You can change defaults or pass flags.
+	rpcURL := flag.String("rpc", defaultRPC, "Polygon (Bor) JSON-RPC endpoint, or several comma-separated ones to fail over between")
+	targetStr := flag.String("target", "2025-10-07T14:00:00.00000000Z", "Target time in RFC3339 or RFC3339Nano (UTC)")
+	avgSecs := flag.Float64("avg", 0, "Average block time in seconds (e.g., 2.15), overriding the one measured over -lookback")
+	sample := flag.Uint64("sample", 200, "Recent block intervals whose spread and average give the P5/P95 height range around the prediction (0 disables it)")
+	lookback := flag.Uint64("lookback", defaultLookback, "Blocks below the head the average block time is measured over when -avg is not given (default about a week; on -chain, a week at its nominal block time)")
+	rounding := flag.String("rounding", "nearest", "Rounding of the estimated block count: nearest, floor, ceil or trunc")
+	maxHeadAge := flag.Duration("max-head-age", time.Minute, "Warn when the head block is older (or further in the future) than this")
+	strictTime := flag.Bool("strict-time", false, "Fail instead of warning when the head block timestamp is implausible")
+	strict := flag.Bool("strict", false, "Reject provider responses with unexpected envelope fields, or blocks missing a field the math reads, instead of decoding what is there")
+	ntpServer := flag.String("ntp", "", "Optional NTP server (e.g. pool.ntp.org) used to correct the local clock for the skew check")
+	asOfHeight := flag.Int64("as-of-height", -1, "Pin the report to this block instead of the latest one (reproducible output)")
+	asOfTime := flag.String("as-of-time", "", "Pin the report to the last block at or before this time (RFC3339)")
+	watch := flag.Duration("watch", 0, "Recompute the prediction every interval (e.g. 30s) until interrupted")
+	ledgerPath := flag.String("ledger", ledger.DefaultPath(), "Prediction ledger each unpinned prediction is appended to: a JSON-lines file, or a postgres:// URL shared by a team (empty disables it)")
+	network := flag.String("network", "mainnet", "Network name recorded in the ledger; also selects the -provider endpoint (mainnet or amoy)")
+	provider := flag.String("provider", "", "Hosted RPC provider to use instead of -rpc: alchemy, infura, quicknode or ankr (needs -key)")
+	providerKey := flag.String("key", "", "API key for -provider; for quicknode <endpoint-name>/<token>")
+	providerSecret := flag.String("key-secret", "", "Infura API key secret, sent as basic auth when the key requires it")
+	snapshotPath := flag.String("snapshot", "", "Write the report, the raw RPC responses and the tool version and flags to this .tar.gz for later audit")
+	chainName := flag.String("chain", "", "Run against this registry chain (e.g. gnosis, bsc) instead of Bor; -rpc and -avg default to its endpoint and nominal block time")
+	chainID := flag.Uint64("chain-id", 0, "Run against the registry chain with this chain id (e.g. 100)")
+	registry := flag.String("registry", defaultRegistryPath(), "JSON file of extra registry chains (e.g. devnets) for -chain and -chain-id; skipped when the default file is absent")
+	registryFile := flag.String("registry-file", "", "Registry (chains and Bor hardforks, as registry/registry.json) used instead of the embedded one, e.g. a newer copy on an air-gapped machine")
+	chainlist := flag.Bool("chainlist", false, "Use the first answering public endpoint for the chain (Bor, or -chain/-chain-id) from the embedded chainlist snapshot instead of -rpc")
+	fixedSample := flag.Uint64("fixed-sample", 100, "On a fixed-block-time registry chain, recent blocks checked against the nominal block time")
+	fixedTolerance := flag.Float64("fixed-tolerance", 0.01, "Relative deviation of the -fixed-sample average from the nominal block time that triggers a warning")
+	explorer := flag.String("explorer", "polygonscan", "Explorer linked for the current and predicted blocks: polygonscan, oklink, a URL template with %d, or empty for none")
+	replayPath := flag.String("replay", "", "Answer from a recorded dataset instead of the network: builtin:mainnet, builtin:amoy or a fixture file")
+	maxHorizon := flag.Duration("max-horizon", defaultMaxHorizon, "Reject targets further than this from now, most often a mistyped year (0 disables the check)")
+	targetsFile := flag.String("targets-file", "", "YAML or JSON file of labelled target times and heights (e.g. a release's fork calendar) predicted together instead of -target")
+	format := flag.String("format", "text", "Output format of the prediction, a -targets-file and failures: text or json")
+	forks := flag.Bool("forks", false, "List the -network's known Bor hardforks from the registry with each one's activation time, mined or estimated, instead of predicting -target")
+	repl := flag.Bool("repl", false, "Read queries (predict, eta, avg, ...) from stdin against one warm client instead of predicting -target once; type help for the commands")
+	lang := flag.String("lang", "", "Language of the report, e.g. en or es (default: from LC_ALL, LC_MESSAGES or LANG, else en)")
+	flag.Parse()
+	strictJSON = *strict
+	failJSON = *format == "json"
+	if err := loadCatalog(*lang); err != nil {
+		failf("-lang: %v", err)
+	}
+	if _, err := blocktime.Rounding(*rounding).Round(new(big.Rat)); err != nil {
+		failf("-rounding: %v", err)
+	}
+
+	if err := loadBaseRegistry(*registryFile); err != nil {
+		failf("-registry-file: %v", err)
+	}
+	if *registry != "" {
+		if err := loadRegistry(*registry, flagSet("registry")); err != nil {
+			failf("-registry: %v", err)
+		}
+	}
+	chain, useChain, err := lookupChain(*chainName, *chainID)
+	if err != nil {
+		failf("%v", err)
+	}
+	var replayer http.RoundTripper
+	if *replayPath != "" {
+		if useChain || *chainlist || *provider != "" {
+			failf("-replay cannot be combined with -chain, -chain-id, -chainlist or -provider")
+		}
+		fix, err := fixtures.Load(*replayPath)
+		if err == nil {
+			replayer, err = fixtures.NewBorRPC(fix)
+		}
+		if err != nil {
+			failf("-replay: %v", err)
+		}
+		// Live explorer pages would show unrelated blocks
+		if !flagSet("explorer") {
+			*explorer = ""
+		}
+		// Replayed predictions say nothing about the live chain
+		*ledgerPath = ""
+		fmt.Fprintln(os.Stderr, fix.Banner(*replayPath))
+	}
+	ledgerChain := "bor"
+	if useChain {
+		if !flagSet("rpc") {
+			*rpcURL = chain.RPC
+		}
+		// A fixed-block-time chain is predicted from its nominal block
+		// time; others are measured like Bor
+		if chain.Fixed && !flagSet("avg") {
+			*avgSecs = chain.BlockTime
+		}
+		if !flagSet("lookback") {
+			*lookback = uint64(7 * 24 * time.Hour / time.Duration(chain.BlockTime*float64(time.Second)))
+		}
+		ledgerChain = chain.Key
+		if !flagSet("explorer") {
+			*explorer = ""
+			if chain.Explorer != "" {
+				*explorer = chain.Explorer + "/block/%d"
+			}
+		}
+	}
+	links, err := resolveExplorer(*explorer, *network)
+	if err != nil {
+		failf("%v", err)
+	}
+
+	if *repl && (*watch > 0 || *snapshotPath != "" || *targetsFile != "" || *forks || *asOfHeight >= 0 || *asOfTime != "") {
+		failf("-repl cannot be combined with -watch, -snapshot, -targets-file, -forks or -as-of")
+	}
+	if *snapshotPath != "" && *watch > 0 {
+		failf("-snapshot records a single run and cannot be combined with -watch")
+	}
+	if *snapshotPath != "" {
+		var err error
+		if recorder, err = startSnapshot(); err != nil {
+			failf("start snapshot: %v", err)
+		}
+	}
+
+	// Parse target time once, it does not change between runs
+	target, err := parseTarget(*targetStr)
+	if err != nil {
+		failf("parse target time: %v", err)
+	}
+	if err := checkHorizon(target, time.Now(), *maxHorizon); err != nil {
+		failf("%v", err)
+	}
+	if *format != "text" && *format != "json" {
+		failf("unknown -format %q (use text or json)", *format)
+	}
+	var calendar []calendarTarget
+	if *targetsFile != "" {
+		if flagSet("target") {
+			failf("-target and -targets-file are mutually exclusive")
+		}
+		if calendar, err = loadTargets(*targetsFile); err != nil {
+			failf("-targets-file: %v", err)
+		}
+		for _, t := range calendar {
+			if err := checkHorizon(t.at, time.Now(), *maxHorizon); t.Height == nil && err != nil {
+				failf("-targets-file: target %s: %v", t.Label, err)
+			}
+		}
+	}
+	if *forks {
+		if flagSet("target") || *targetsFile != "" || useChain {
+			failf("-forks cannot be combined with -target, -targets-file, -chain or -chain-id")
+		}
+		for _, f := range hardforks {
+			if f.Network == *network {
+				calendar = append(calendar, calendarTarget{Label: f.Name, Height: &f.Block})
+			}
+		}
+		if calendar == nil {
+			failf("the registry lists no hardforks for -network=%s", *network)
+		}
+	}
+	ref, refName := 2.0, "Polygon PoS's nominal block time"
+	if useChain {
+		ref, refName = chain.BlockTime, chain.Name+"'s nominal block time"
+	}
+	if flagSet("avg") || *avgSecs != 0 {
+		if err := checkAvg(*avgSecs, ref, refName); err != nil {
+			failf("%v", err)
+		}
+	}
+	if *lookback == 0 {
+		failf("-lookback must be a positive number of blocks")
+	}
+
+	client := &http.Client{Timeout: httpTimeout, Transport: replayer}
+	if endpoints := splitEndpoints(*rpcURL); len(endpoints) > 1 {
+		if *replayPath != "" || *chainlist || *provider != "" {
+			failf("several -rpc endpoints cannot be combined with -replay, -chainlist or -provider")
+		}
+		f, err := newFailoverRPC(endpoints, nil)
+		if err != nil {
+			failf("-rpc: %v", err)
+		}
+		client.Transport, *rpcURL = f, endpoints[0]
+	}
+	if *chainlist {
+		if flagSet("rpc") {
+			failf("-chainlist and -rpc are mutually exclusive")
+		}
+		id := uint64(137)
+		if useChain {
+			id = chain.ChainID
+		}
+		failEndpoint = "chainlist"
+		if *rpcURL, err = resolveChainlistRPC(context.Background(), client, id); err != nil {
+			failf("-chainlist: %v", err)
+		}
+	}
+	if *provider != "" {
+		if flagSet("rpc") || *chainlist || useChain {
+			failf("-provider cannot be combined with -rpc, -chainlist, -chain or -chain-id")
+		}
+		u, auth, err := resolveProvider(*provider, *network, *providerKey, *providerSecret)
+		if err != nil {
+			failf("%v", err)
+		}
+		*rpcURL, rpcAuth[u] = u, auth
+		secrets = append(secrets, *providerKey, *providerSecret)
+		// quicknode puts the two halves of its key in different URL parts
+		secrets = append(secrets, strings.Split(*providerKey, "/")...)
+		failEndpoint = redact(u)
+		// A wrong key or network shows up here rather than mid-prediction
+		c, _, _ := lookupChain(map[string]string{"mainnet": "polygon", "amoy": "amoy"}[*network], 0)
+		if err := checkChainID(context.Background(), client, *rpcURL, c); err != nil {
+			failf("-provider %s: %v", *provider, err)
+		}
+	}
+	failEndpoint = redact(*rpcURL)
+	if useChain && !*chainlist {
+		if err := checkChainID(context.Background(), client, *rpcURL, chain); err != nil {
+			failf("%v", err)
+		}
+	}
+
+	run := func(ctx context.Context) error {
+		// 1) Fetch current block height and timestamp
+		n, err := getLatestBlockNumber(ctx, client, *rpcURL)
+		if err != nil {
+			return fmt.Errorf("get latest block number: %w", err)
+		}
+		pinned := *asOfHeight >= 0 || *asOfTime != ""
+		if n, err = resolveAsOf(ctx, client, *rpcURL, n, *asOfHeight, *asOfTime); err != nil {
+			return err
+		}
+		curTS, err := getBlockTimestamp(ctx, client, *rpcURL, n)
+		if err != nil {
+			return fmt.Errorf("get timestamp for current block %d: %w", n, err)
+		}
+		now := time.Unix(int64(curTS), 0).UTC()
+		if !pinned {
+			// A pinned head is old by design
+			if err := flagImplausible(checkClockSkew(now, *maxHeadAge, *ntpServer), *strictTime); err != nil {
+				return err
+			}
+		}
+
+		// 3) Calculate time delta
+		delta := target.Sub(now)
+		deltaSeconds := delta.Seconds()
+
+		// 4) Estimate number of blocks. A fixed-block-time chain is predicted
+		// from its nominal block time, which a small sample only validates;
+		// without -avg, any other chain's is measured over -lookback.
+		avg := *avgSecs
+		fixed := useChain && chain.Fixed && !flagSet("avg")
+		var measured float64
+		var sampled uint64
+		switch {
+		case fixed:
+			if measured, err = checkFixedBlockTime(ctx, client, *rpcURL, n, curTS, chain.BlockTime, *fixedSample, *fixedTolerance); err != nil {
+				return err
+			}
+		case avg == 0:
+			if avg, sampled, err = measureBlockTime(ctx, client, *rpcURL, n, curTS, *lookback); err != nil {
+				return err
+			}
+		}
+		// Record predictions and settle earlier ones that are now verifiable
+		record := func(height int64, at time.Time) {
+			if pinned || *ledgerPath == "" || !at.After(now) {
+				return
+			}
+			estimator := "fixed-avg"
+			switch {
+			case fixed:
+				estimator = "fixed-block-time"
+			case sampled > 0:
+				estimator = "recent-mean"
+			}
+			e := ledger.Entry{
+				RecordedAt:    time.Now().UTC(),
+				Network:       *network,
+				Chain:         ledgerChain,
+				Estimator:     estimator,
+				TargetHeight:  height,
+				PredictedTime: at.UTC(),
+				Inputs:        &ledger.Inputs{HeadHeight: int64(n), HeadTime: now, AvgBlockTime: avg, Rounding: *rounding},
+			}
+			blockTime := func(h int64) (time.Time, error) {
+				ts, err := getBlockTimestamp(ctx, client, *rpcURL, uint64(h))
+				return time.Unix(int64(ts), 0), err
+			}
+			if err := ledger.Record(*ledgerPath, e, int64(n), blockTime); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: record prediction: %v\n", err)
+			}
+		}
+
+		if calendar != nil {
+			blockTime := func(h uint64) (time.Time, error) {
+				ts, err := getBlockTimestamp(ctx, client, *rpcURL, h)
+				return time.Unix(int64(ts), 0), err
+			}
+			rep, err := predictCalendar(calendar, n, now, avg, *rounding, links, blockTime)
+			if err != nil {
+				return err
+			}
+			// Only predicted heights are ledger predictions; the arrival
+			// times of given heights are estimates of another kind
+			for _, r := range rep.Targets {
+				if r.Kind == "time" {
+					record(int64(r.Height), r.Time)
+				}
+			}
+			return printCalendar(rep, *format)
+		}
+
+		blocksExact, blocksRounded, err := blocktime.Blocks(delta, avg, blocktime.Rounding(*rounding))
+		if err != nil {
+			return fmt.Errorf("estimate blocks: %w", err)
+		}
+
+		// 5) Predicted height
+		predicted := new(big.Int).Add(new(big.Int).SetUint64(n), blocksRounded)
+		if predicted.Sign() < 0 {
+			predicted.SetInt64(0)
+		}
+
+		// 6) Report
+		rep := targetReport{
+			HeadHeight:   n,
+			HeadTime:     now,
+			HeadExplorer: links.url(n, false),
+			TargetTime:   target,
+		}
+		if useChain {
+			rep.Chain, rep.ChainID, rep.chain = chain.Name, chain.ChainID, &chain
+		}
+		if !target.After(now) {
+			// The chain has passed the target, so the answer is exact
+			if rep.Reached, err = findPastTarget(ctx, client, *rpcURL, target, n, links); err != nil {
+				return err
+			}
+			return printTarget(rep, *format)
+		}
+		rep.AvgBlockTime, rep.AvgSource = avg, "fixed-avg"
+		switch {
+		case fixed:
+			rep.AvgSource, rep.MeasuredAvg, rep.SampledBlocks = "fixed-block-time", measured, *fixedSample
+		case sampled > 0:
+			rep.AvgSource, rep.SampledBlocks = "recent-mean", sampled
+		}
+		rep.DeltaSeconds = deltaSeconds
+		rep.DeltaBlocks, rep.Rounding, rep.exact = blocksRounded.Int64(), *rounding, blocksExact
+		rep.DeltaBlocksExact, _ = blocksExact.Float64()
+		rep.PredictedHeight = predicted.Uint64()
+		rep.PredictedExplorer = links.url(predicted.Uint64(), predicted.Uint64() > n)
+		if *sample > 0 && n > 0 {
+			recent, stdDev, intervals, err := intervalSpread(ctx, client, *rpcURL, n, *sample)
+			if err != nil {
+				return err
+			}
+			// The block count over delta has a standard deviation of
+			// sigma*sqrt(delta/avg^3) when block times are independent.
+			// That is only jitter, so the heights the recent and the
+			// lookback averages give apart are added in quadrature.
+			z := math.Sqrt2 * math.Erfinv(0.9)
+			jitter := z * stdDev * math.Sqrt(deltaSeconds/(avg*avg*avg))
+			var drift float64
+			if recent > 0 {
+				drift = math.Abs(deltaSeconds/recent - deltaSeconds/avg)
+			}
+			margin := uint64(math.Ceil(math.Hypot(jitter, drift)))
+			p := predicted.Uint64()
+			rep.Spread = &heightSpread{P5: p - min(margin, p), P95: p + margin, StdDev: stdDev, Intervals: intervals, RecentAvg: recent, DriftBlocks: uint64(math.Ceil(drift))}
+		}
+		if err := printTarget(rep, *format); err != nil {
+			return err
+		}
+
+		record(predicted.Int64(), target)
+		return nil
+	}
+
+	if *repl {
+		s := &replSession{client: client, rpcURL: *rpcURL, avg: *avgSecs, lookback: *lookback, rounding: *rounding, links: links, ref: ref, refName: refName, maxHorizon: *maxHorizon}
+		if err := runREPL(os.Stdin, s); err != nil {
+			failf("read queries: %v", err)
+		}
+		return
+	}
+	err = runWatch(*watch, run)
+	if recorder != nil {
+		if serr := recorder.write(*snapshotPath, err); serr != nil {
+			failf("write snapshot: %v", serr)
+		}
+		fmt.Fprintf(os.Stderr, "snapshot written to %s\n", *snapshotPath)
+	}
+	if err != nil {
+		failf("%v", err)
+	}
+}
+
+// runWatch calls run once, or with a positive interval keeps calling it on
+// that interval until interrupted. Failures inside the loop are reported and
+// retried on the next tick instead of exiting.
+func runWatch(interval time.Duration, run func(context.Context) error) error {
+	if interval <= 0 {
+		return run(context.Background())
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		fmt.Printf("=== %s ===\n", time.Now().UTC().Format(time.RFC3339))
+		if err := run(ctx); err != nil && ctx.Err() == nil {
+			printFailure(err, err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+		fmt.Println()
+	}
+}
+
+// replSession is the state -repl keeps between queries: one client and the
+// timestamps of final blocks, so follow-up queries cost a request or two.
+type replSession struct {
+	client   *http.Client
+	rpcURL   string
+	avg      float64 // 0 measures it over lookback at each query
+	lookback uint64
+	rounding string
+	links    explorerURLs
+
+	ref        float64 // nominal block time avg= is checked against
+	refName    string
+	maxHorizon time.Duration
+}
+
+// replHelp lists the -repl commands.
+const replHelp = `Commands:
+  predict <time> [avg=S] [rounding=M]   height at an RFC3339 time
+  eta <height> [avg=S]                  time of a height (mined, or estimated)
+  avg [window=D | blocks=N]             measured average over a window (default 24h) or a block count
+  head                                  the current block
+  set avg=S | rounding=M                change the defaults of predict and eta (avg=measured to measure it again)
+  help, quit`
+
+// runREPL answers queries read from in until quit or end of input. A failed
+// query is reported and the session goes on.
+func runREPL(in io.Reader, s *replSession) error {
+	memo = &timestampMemo{ts: map[uint64]uint64{}}
+	fmt.Printf("Querying %s. Type help for the commands.\n", redact(s.rpcURL))
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Print("> ")
+		if !sc.Scan() {
+			fmt.Println()
+			return sc.Err()
+		}
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "exit" {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		err := s.exec(ctx, fields[0], fields[1:])
+		cancel()
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+		}
+	}
+}
+
+// exec runs one command with its arguments, positional ones first, then
+// key=value options.
+func (s *replSession) exec(ctx context.Context, cmd string, args []string) error {
+	var pos []string
+	opts := map[string]string{}
+	for _, a := range args {
+		if k, v, ok := strings.Cut(a, "="); ok {
+			opts[k] = v
+		} else {
+			pos = append(pos, a)
+		}
+	}
+	avg, rounding := s.avg, s.rounding
+	for k, v := range opts {
+		var err error
+		switch k {
+		case "avg":
+			if v == "measured" && cmd == "set" {
+				avg = 0
+			} else if avg, err = strconv.ParseFloat(v, 64); err == nil {
+				err = checkAvg(avg, s.ref, s.refName)
+			}
+		case "rounding":
+			_, err = blocktime.Rounding(v).Round(new(big.Rat))
+			rounding = v
+		case "window", "blocks":
+			if cmd != "avg" {
+				err = fmt.Errorf("%s= only applies to avg", k)
+			}
+		default:
+			err = fmt.Errorf("unknown option %s=", k)
+		}
+		if err != nil {
+			return fmt.Errorf("%s=%s: %w", k, v, err)
+		}
+	}
+
+	switch cmd {
+	case "help":
+		fmt.Println(replHelp)
+		return nil
+	case "set":
+		if len(opts) == 0 || len(pos) > 0 {
+			return errors.New("usage: set avg=S | rounding=M")
+		}
+		s.avg, s.rounding = avg, rounding
+		if s.avg == 0 {
+			fmt.Printf("avg measured over the last %s blocks, rounding %s\n", human.CommasUint(s.lookback), s.rounding)
+		} else {
+			fmt.Printf("avg %.6f s, rounding %s\n", s.avg, s.rounding)
+		}
+		return nil
+	}
+
+	head, headTime, err := s.head(ctx)
+	if err != nil {
+		return err
+	}
+	if avg == 0 && (cmd == "predict" || cmd == "eta") {
+		if avg, _, err = measureBlockTime(ctx, s.client, s.rpcURL, head, uint64(headTime.Unix()), s.lookback); err != nil {
+			return err
+		}
+	}
+	switch cmd {
+	case "head":
+		fmt.Printf("block %s at %s\n", human.CommasUint(head), headTime.Format(time.RFC3339))
+	case "predict":
+		if len(pos) != 1 {
+			return errors.New("usage: predict <time> [avg=S] [rounding=M]")
+		}
+		// Typed interactively, so a near miss such as 14:00Z is read as
+		// suggested; the reply shows the time it was taken as
+		t, err := parseTarget(pos[0])
+		if alt := suggestTime(pos[0]); err != nil && alt != "" {
+			t, err = parseTarget(alt)
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkHorizon(t, time.Now(), s.maxHorizon); err != nil {
+			return err
+		}
+		rep, err := predictCalendar([]calendarTarget{{Label: pos[0], at: t}}, head, headTime, avg, rounding, s.links, s.blockTime(ctx))
+		if err != nil {
+			return err
+		}
+		r := rep.Targets[0]
+		fmt.Printf("block %s at %s (%s from block %s, avg %.6f s, rounded %s)\n", human.CommasUint(r.Height), t.Format(time.RFC3339), signedDHMS(r.InSeconds), human.CommasUint(head), avg, rounding)
+		if r.Explorer != "" {
+			fmt.Println(r.Explorer)
+		}
+	case "eta":
+		if len(pos) != 1 {
+			return errors.New("usage: eta <height> [avg=S]")
+		}
+		h, err := strconv.ParseUint(strings.ReplaceAll(pos[0], ",", ""), 10, 64)
+		if err != nil {
+			return fmt.Errorf("height %q is not a block number", pos[0])
+		}
+		rep, err := predictCalendar([]calendarTarget{{Label: pos[0], Height: &h}}, head, headTime, avg, rounding, s.links, s.blockTime(ctx))
+		if err != nil {
+			return err
+		}
+		r := rep.Targets[0]
+		how := fmt.Sprintf("estimated at avg %.6f s", avg)
+		if r.Mined {
+			how = "mined"
+		}
+		fmt.Printf("block %s at %s (%s, %s from block %s)\n", human.CommasUint(h), r.Time.Format(time.RFC3339), how, signedDHMS(r.InSeconds), human.CommasUint(head))
+	case "avg":
+		return s.average(ctx, head, headTime, opts)
+	default:
+		return fmt.Errorf("unknown command %q; type help", cmd)
+	}
+	return nil
+}
+
+// average measures the average block time over opts' window or block count
+// ending at head.
+func (s *replSession) average(ctx context.Context, head uint64, headTime time.Time, opts map[string]string) error {
+	var from uint64
+	switch {
+	case opts["window"] != "" && opts["blocks"] != "":
+		return errors.New("pass window= or blocks=, not both")
+	case opts["blocks"] != "":
+		n, err := strconv.ParseUint(opts["blocks"], 10, 64)
+		if err != nil || n == 0 || n >= head {
+			return fmt.Errorf("blocks=%s: want a block count between 1 and %d", opts["blocks"], head-1)
+		}
+		from = head - n
+	default:
+		window := cmp.Or(opts["window"], "24h")
+		d, err := parseWindow(window)
+		if err != nil {
+			return err
+		}
+		since := headTime.Add(-d)
+		if since.Unix() < 0 {
+			return fmt.Errorf("window=%s reaches before genesis", window)
+		}
+		if from, _, err = findBlockAtOrAfter(ctx, s.client, s.rpcURL, uint64(since.Unix()), 0, head); err != nil {
+			return err
+		}
+		if from == head {
+			return fmt.Errorf("window=%s holds no block before the head", window)
+		}
+	}
+	fromTime, err := s.blockTime(ctx)(from)
+	if err != nil {
+		return err
+	}
+	elapsed := headTime.Sub(fromTime)
+	fmt.Printf("avg %.6f s over %s blocks (%s to %s, %s)\n", elapsed.Seconds()/float64(head-from), human.CommasUint(head-from), human.CommasUint(from), human.CommasUint(head), human.DHMS(elapsed))
+	return nil
+}
+
+func (s *replSession) head(ctx context.Context) (uint64, time.Time, error) {
+	n, err := getLatestBlockNumber(ctx, s.client, s.rpcURL)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("get latest block number: %w", err)
+	}
+	memo.setHead(n)
+	t, err := s.blockTime(ctx)(n)
+	return n, t, err
+}
+
+func (s *replSession) blockTime(ctx context.Context) func(uint64) (time.Time, error) {
+	return func(h uint64) (time.Time, error) {
+		ts, err := getBlockTimestamp(ctx, s.client, s.rpcURL, h)
+		return time.Unix(int64(ts), 0).UTC(), err
+	}
+}
+
+// parseWindow reads a duration, also in days or weeks (e.g. 7d, 2w).
+func parseWindow(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if n, ferr := strconv.ParseFloat(strings.TrimRight(s, "dw"), 64); err != nil && ferr == nil && len(s) > 1 {
+		unit := 24 * time.Hour
+		if strings.HasSuffix(s, "w") {
+			unit *= 7
+		}
+		d, err = time.Duration(n*float64(unit)), nil
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q (e.g. 6h, 7d or 2w)", s)
+	}
+	return d, nil
+}
+
+// signedDHMS formats seconds relative to the head, e.g. +1d 2h 0m 0s.
+func signedDHMS(secs float64) string {
+	sign := "+"
+	if secs < 0 {
+		sign = "-"
+	}
+	return sign + human.DHMS(time.Duration(math.Abs(secs)*float64(time.Second)))
+}
+
+// reorgSafeDepth is how far below the head a block's timestamp is
+// remembered by the -repl memo.
+const reorgSafeDepth = 128
+
+// timestampMemo remembers block timestamps for -repl. Only blocks
+// reorgSafeDepth below the last seen head are kept, so a reorg near the
+// tip never serves a stale time.
+type timestampMemo struct {
+	mu   sync.Mutex
+	head uint64
+	ts   map[uint64]uint64
+}
+
+// memo is set by -repl; getBlockTimestamp consults it when non-nil.
+var memo *timestampMemo
+
+func (m *timestampMemo) setHead(h uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.head = max(m.head, h)
+}
+
+func (m *timestampMemo) get(h uint64) (uint64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ts, ok := m.ts[h]
+	return ts, ok
+}
+
+func (m *timestampMemo) put(h, ts uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if h+reorgSafeDepth <= m.head {
+		m.ts[h] = ts
+	}
+}
+
+// calendarTarget is one entry of a -targets-file: a labelled target time,
+// whose height is predicted, or target height, whose arrival is estimated.
+type calendarTarget struct {
+	Label  string  `json:"label"`
+	Time   string  `json:"time,omitempty"`
+	Height *uint64 `json:"height,omitempty"`
+
+	at time.Time // Time, parsed
+}
+
+// calendarRow is the prediction for one calendarTarget.
+type calendarRow struct {
+	Label     string    `json:"label"`
+	Kind      string    `json:"kind"`  // "time" or "height"
+	Mined     bool      `json:"mined"` // a given height the chain already has; Time is its timestamp
+	Height    uint64    `json:"height"`
+	Time      time.Time `json:"time"`
+	InSeconds float64   `json:"in_seconds"` // negative for targets behind the head
+	Explorer  string    `json:"explorer,omitempty"`
+}
+
+// calendarReport is the -targets-file output.
+type calendarReport struct {
+	HeadHeight   uint64        `json:"head_height"`
+	HeadTime     time.Time     `json:"head_time"`
+	AvgBlockTime float64       `json:"avg_block_time_seconds"`
+	Rounding     string        `json:"rounding"`
+	Targets      []calendarRow `json:"targets"`
+}
+
+// loadTargets reads a -targets-file. JSON (a list, or an object with a
+// "targets" list) is decoded as such; anything else is read as the YAML
+// subset a fork calendar needs, a list of flat mappings:
+//
+//	targets:
+//	  - label: Rio
+//	    time: 2025-10-07T14:00:00Z
+//	  - label: Madhugiri
+//	    height: 80000000
+func loadTargets(path string) ([]calendarTarget, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var targets []calendarTarget
+	switch trimmed := bytes.TrimSpace(data); {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		err = json.Unmarshal(trimmed, &targets)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var doc struct {
+			Targets []calendarTarget `json:"targets"`
+		}
+		err = json.Unmarshal(trimmed, &doc)
+		targets = doc.Targets
+	default:
+		targets, err = parseTargetsYAML(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s: no targets listed", path)
+	}
+	for i := range targets {
+		t := &targets[i]
+		if t.Label == "" {
+			t.Label = fmt.Sprintf("#%d", i+1)
+		}
+		switch {
+		case (t.Time == "") == (t.Height == nil):
+			return nil, fmt.Errorf("%s: target %s needs exactly one of time and height", path, t.Label)
+		case t.Time != "":
+			if t.at, err = parseTarget(t.Time); err != nil {
+				return nil, fmt.Errorf("%s: target %s: %w", path, t.Label, err)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// parseTargetsYAML reads the YAML subset documented on loadTargets: an
+// optional top-level "targets:" key over a list of "key: value" mappings,
+// with # comments and optionally quoted values.
+func parseTargetsYAML(s string) ([]calendarTarget, error) {
+	var targets []calendarTarget
+	var cur *calendarTarget
+	for i, line := range strings.Split(s, "\n") {
+		if j := strings.Index(line, "#"); j == 0 || j > 0 && line[j-1] == ' ' {
+			line = line[:j]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || line == "targets:" || line == "---" {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "-"); ok {
+			targets = append(targets, calendarTarget{})
+			cur = &targets[len(targets)-1]
+			if line = strings.TrimSpace(rest); line == "" {
+				continue
+			}
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || cur == nil {
+			return nil, fmt.Errorf("line %d: want \"- key: value\" entries, got %q", i+1, clip(line))
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		switch strings.TrimSpace(key) {
+		case "label":
+			cur.Label = value
+		case "time":
+			cur.Time = value
+		case "height":
+			h, err := strconv.ParseUint(strings.ReplaceAll(value, "_", ""), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: height %q is not a block number", i+1, clip(value))
+			}
+			cur.Height = &h
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %q (use label, time or height)", i+1, clip(key))
+		}
+	}
+	return targets, nil
+}
+
+// predictCalendar computes every target of a -targets-file from one head and
+// average: heights at target times by the same rounding as -target, and
+// arrival times of target heights at the average block time. Heights the
+// chain already has are looked up with blockTime instead.
+func predictCalendar(targets []calendarTarget, head uint64, headTime time.Time, avg float64, rounding string, links explorerURLs, blockTime func(uint64) (time.Time, error)) (calendarReport, error) {
+	rep := calendarReport{HeadHeight: head, HeadTime: headTime, AvgBlockTime: avg, Rounding: rounding}
+	for _, t := range targets {
+		row := calendarRow{Label: t.Label}
+		if t.Height == nil {
+			_, blocks, err := blocktime.Blocks(t.at.Sub(headTime), avg, blocktime.Rounding(rounding))
+			if err != nil {
+				return rep, fmt.Errorf("target %s: %w", t.Label, err)
+			}
+			predicted := new(big.Int).Add(new(big.Int).SetUint64(head), blocks)
+			if predicted.Sign() < 0 {
+				predicted.SetInt64(0)
+			}
+			row.Kind, row.Height, row.Time = "time", predicted.Uint64(), t.at
+		} else if row.Kind, row.Height = "height", *t.Height; row.Height <= head {
+			at, err := blockTime(row.Height)
+			if err != nil {
+				return rep, fmt.Errorf("target %s: get block %d: %w", t.Label, row.Height, err)
+			}
+			row.Time, row.Mined = at.UTC(), true
+		} else {
+			row.Time = headTime.Add(blocktime.Span(int64(row.Height-head), avg)).UTC()
+		}
+		row.InSeconds = row.Time.Sub(headTime).Seconds()
+		row.Explorer = links.url(row.Height, row.Height > head)
+		rep.Targets = append(rep.Targets, row)
+	}
+	return rep, nil
+}
+
+// printCalendar writes rep as a table, or as JSON for -format=json.
+func printCalendar(rep calendarReport, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	fmt.Printf("%s%s — %s (UTC)\n", field("current_block", 14), human.CommasUint(rep.HeadHeight), rep.HeadTime.Format(time.RFC3339))
+	fmt.Printf("%s%.6f s (%s)\n\n", field("avg_block", 14), rep.AvgBlockTime, msg("heights_rounded", rep.Rounding))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", msg("col_label"), msg("col_given"), msg("col_height"), msg("col_time"), msg("col_from_head"), msg("col_explorer"))
+	for _, r := range rep.Targets {
+		height, at := human.CommasUint(r.Height), r.Time.Format(time.RFC3339)
+		switch {
+		case r.Kind == "time":
+			height += " (" + msg("predicted") + ")"
+		case r.Mined:
+			at += " (" + msg("mined") + ")"
+		default:
+			at += " (" + msg("estimated") + ")"
+		}
+		sign := "+"
+		if r.InSeconds < 0 {
+			sign = "-"
+		}
+		in := sign + human.DHMS(time.Duration(math.Abs(r.InSeconds)*float64(time.Second)))
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Label, msg("given_"+r.Kind), height, at, in, r.Explorer)
+	}
+	return tw.Flush()
+}
+
+// resolveAsOf pins the head used by the report to -as-of-height or to the
+// last block at or before -as-of-time, so reruns produce identical output.
+func resolveAsOf(ctx context.Context, client *http.Client, rpcURL string, latest uint64, asOfHeight int64, asOfTime string) (uint64, error) {
+	switch {
+	case asOfHeight >= 0 && asOfTime != "":
+		return 0, errors.New("-as-of-height and -as-of-time are mutually exclusive")
+	case asOfHeight >= 0:
+		if uint64(asOfHeight) > latest {
+			return 0, fmt.Errorf("-as-of-height %d is beyond the latest block %d", asOfHeight, latest)
+		}
+		return uint64(asOfHeight), nil
+	case asOfTime != "":
+		t, err := parseTarget(asOfTime)
+		if err != nil {
+			return 0, fmt.Errorf("parse -as-of-time: %w", err)
+		}
+		if t.Unix() < 0 {
+			return 0, fmt.Errorf("-as-of-time %s is before genesis", asOfTime)
+		}
+		h, hTS, err := findBlockAtOrAfter(ctx, client, rpcURL, uint64(t.Unix())+1, 0, latest)
+		if err != nil {
+			return 0, err
+		}
+		if hTS <= uint64(t.Unix()) {
+			return 0, fmt.Errorf("-as-of-time %s is not before the latest block %d", asOfTime, latest)
+		}
+		if h == 0 {
+			return 0, fmt.Errorf("-as-of-time %s is before genesis", asOfTime)
+		}
+		return h - 1, nil
+	default:
+		return latest, nil
+	}
+}
+
+// targetReport is the -target output.
+type targetReport struct {
+	Chain        string    `json:"chain,omitempty"` // a registry chain; empty on Bor
+	ChainID      uint64    `json:"chain_id,omitempty"`
+	HeadHeight   uint64    `json:"head_height"`
+	HeadTime     time.Time `json:"head_time"`
+	HeadExplorer string    `json:"head_explorer,omitempty"`
+	TargetTime   time.Time `json:"target_time"`
+	// Reached is set instead of the prediction when the head has passed
+	// the target
+	Reached *pastTarget `json:"reached,omitempty"`
+
+	AvgBlockTime      float64       `json:"avg_block_time_seconds,omitempty"`
+	AvgSource         string        `json:"avg_source,omitempty"` // the ledger's estimator name
+	MeasuredAvg       float64       `json:"measured_avg_block_time_seconds,omitempty"`
+	SampledBlocks     uint64        `json:"sampled_blocks,omitempty"`
+	DeltaSeconds      float64       `json:"delta_seconds,omitempty"`
+	DeltaBlocks       int64         `json:"delta_blocks,omitempty"`
+	DeltaBlocksExact  float64       `json:"delta_blocks_exact,omitempty"`
+	Rounding          string        `json:"rounding,omitempty"`
+	PredictedHeight   uint64        `json:"predicted_height,omitempty"`
+	PredictedExplorer string        `json:"predicted_explorer,omitempty"`
+	Spread            *heightSpread `json:"spread,omitempty"`
+
+	chain *evmChain
+	exact *big.Rat
+}
+
+// heightSpread is the 90% range of the predicted height, from the spread of
+// recent block intervals widened by how far the height the recent average
+// gives is from the predicted one.
+type heightSpread struct {
+	P5          uint64  `json:"p5_height"`
+	P95         uint64  `json:"p95_height"`
+	StdDev      float64 `json:"interval_stddev_seconds"`
+	Intervals   uint64  `json:"intervals"`
+	RecentAvg   float64 `json:"recent_avg_block_time_seconds"`
+	DriftBlocks uint64  `json:"avg_drift_blocks"`
+}
+
+// pastTarget is the first block at or after a target the head has passed,
+// and the block before it.
+type pastTarget struct {
+	Height         uint64     `json:"height"`
+	Time           time.Time  `json:"time"`
+	Explorer       string     `json:"explorer,omitempty"`
+	PreviousHeight *uint64    `json:"previous_height,omitempty"` // nil when Height is genesis
+	PreviousTime   *time.Time `json:"previous_time,omitempty"`
+}
+
+// findPastTarget finds the first block at or after target, a time the head
+// has passed, and the block before it, by binary search instead of
+// extrapolated from an average.
+func findPastTarget(ctx context.Context, client *http.Client, rpcURL string, target time.Time, head uint64, links explorerURLs) (*pastTarget, error) {
+	// Block times are whole seconds, so 14:00:00.5 is first reached at :01
+	ts := target.Unix()
+	if target.Nanosecond() > 0 {
+		ts++
+	}
+	if ts < 0 {
+		ts = 0
+	}
+	h, hTS, err := findBlockAtOrAfter(ctx, client, rpcURL, uint64(ts), 0, head)
+	if err != nil {
+		return nil, fmt.Errorf("search for the block at %s: %w", target.Format(time.RFC3339), err)
+	}
+	p := &pastTarget{Height: h, Time: time.Unix(int64(hTS), 0).UTC(), Explorer: links.url(h, false)}
+	if h == 0 {
+		return p, nil
+	}
+	prevTS, err := getBlockTimestamp(ctx, client, rpcURL, h-1)
+	if err != nil {
+		return nil, fmt.Errorf("get timestamp for block %d: %w", h-1, err)
+	}
+	prev, prevTime := h-1, time.Unix(int64(prevTS), 0).UTC()
+	p.PreviousHeight, p.PreviousTime = &prev, &prevTime
+	return p, nil
+}
+
+// printTarget prints rep as format, text or json.
+func printTarget(rep targetReport, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	if c := rep.chain; c != nil {
+		fmt.Printf("%s%s (%s)\n", field("chain", 14), c.Name, msg("chain_details", c.ChainID, c.BlockTime, chainLabel(*c)))
+	}
+	fmt.Printf("%s%s — %s (UTC)\n", field("current_block", 14), human.CommasUint(rep.HeadHeight), rep.HeadTime.Format(time.RFC3339))
+	if rep.HeadExplorer != "" {
+		fmt.Printf("  %s%s\n", field("explorer", 12), rep.HeadExplorer)
+	}
+	fmt.Printf("%s%s (UTC)\n", field("target_time", 14), rep.TargetTime.Format(time.RFC3339))
+	if p := rep.Reached; p != nil {
+		fmt.Printf("\n%s:\n", msg("first_at_target"))
+		fmt.Printf("  %s%s — %s (%s)\n", field("height", 12), human.CommasUint(p.Height), p.Time.Format(time.RFC3339), msg("after_target", human.DHMS(p.Time.Sub(rep.TargetTime))))
+		if p.Explorer != "" {
+			fmt.Printf("  %s%s\n", field("explorer", 12), p.Explorer)
+		}
+		if p.PreviousHeight != nil {
+			fmt.Printf("  %s%s — %s (%s)\n", field("previous", 12), human.CommasUint(*p.PreviousHeight), p.PreviousTime.Format(time.RFC3339), msg("before_target", human.DHMS(rep.TargetTime.Sub(*p.PreviousTime))))
+		}
+		return nil
+	}
+	switch rep.AvgSource {
+	case "fixed-block-time":
+		fmt.Printf("%s%.6f s (%s)\n", field("avg_block", 14), rep.AvgBlockTime, msg("avg_fixed", rep.SampledBlocks, rep.MeasuredAvg))
+	case "recent-mean":
+		fmt.Printf("%s%.6f s (%s)\n", field("avg_block", 14), rep.AvgBlockTime, msg("avg_measured", human.CommasUint(rep.SampledBlocks)))
+	default:
+		fmt.Printf("%s%.6f s\n", field("avg_block", 14), rep.AvgBlockTime)
+	}
+
+	delta := time.Duration(rep.DeltaSeconds * float64(time.Second))
+	fmt.Printf("\n%s+%s (%s s)\n", field("delta_time", 14), human.DHMS(delta), human.CommasUint(uint64(rep.DeltaSeconds)))
+	fmt.Printf("%s+%s (%s) — %s (%s)\n", field("delta_blocks", 14), human.Commas(rep.DeltaBlocks), msg("rounded", rep.Rounding), rep.exact.FloatString(3), msg("exact"))
+
+	fmt.Printf("\n%s:\n", msg("predicted_at_target"))
+	fmt.Printf("  %s%s\n", field("height", 12), human.CommasUint(rep.PredictedHeight))
+	if rep.PredictedExplorer != "" {
+		fmt.Printf("  %s%s\n", field("explorer", 12), rep.PredictedExplorer)
+	}
+	if sp := rep.Spread; sp != nil {
+		fmt.Printf("  %s%s / %s / %s (%s)\n", field("percentiles", 12), human.CommasUint(sp.P5), human.CommasUint(rep.PredictedHeight), human.CommasUint(sp.P95), msg("spread", sp.StdDev, human.CommasUint(sp.Intervals), sp.RecentAvg, human.CommasUint(sp.DriftBlocks)))
+	}
+	return nil
+}
+
+// findBlockAtOrAfter binary-searches [lo, hi] for the first block whose
+// timestamp is >= ts. hi is returned if no earlier block qualifies.
+func findBlockAtOrAfter(ctx context.Context, client *http.Client, rpcURL string, ts, lo, hi uint64) (uint64, uint64, error) {
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		midTS, err := getBlockTimestamp(ctx, client, rpcURL, mid)
+		if err != nil {
+			return 0, 0, err
+		}
+		if midTS >= ts {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	hTS, err := getBlockTimestamp(ctx, client, rpcURL, lo)
+	if err != nil {
+		return 0, 0, err
+	}
+	return lo, hTS, nil
+}
+
+// defaultMaxHorizon bounds how far -target may lie from now; hardforks are
+// scheduled months, not decades, ahead. avgPlausibleFactor bounds how far
+// -avg may stray from the chain's nominal block time.
+const (
+	defaultMaxHorizon  = 2 * 365 * 24 * time.Hour
+	avgPlausibleFactor = 10.0
+)
+
+func parseTarget(s string) (time.Time, error) {
+	// RFC3339Nano also accepts times without fractional seconds
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s))
+	var pe *time.ParseError
+	switch {
+	case errors.As(err, &pe) && pe.Message != "":
+		// Well formed but out of range, e.g. a +25:00 offset or day 32
+		return time.Time{}, fmt.Errorf("invalid time %q%s", clip(s), pe.Message)
+	case err != nil:
+		if alt := suggestTime(s); alt != "" {
+			return time.Time{}, fmt.Errorf("unsupported time format %q; did you mean %s? (use RFC3339/RFC3339Nano)", clip(s), alt)
+		}
+		return time.Time{}, fmt.Errorf("unsupported time format %q (use RFC3339/RFC3339Nano, e.g. 2025-10-07T14:00:00Z)", clip(s))
+	}
+	// Durations saturate about 292 years out, which would skew every delta
+	if y := t.UTC().Year(); y < 1970 || y > 2200 {
+		return time.Time{}, fmt.Errorf("time %q is outside the years 1970-2200", clip(s))
+	}
+	return t.UTC(), nil
+}
+
+// suggestTime returns the RFC3339 time a near miss most likely means, e.g.
+// a missing zone, a space for the T or Unix seconds, or "" when s looks
+// like no time. Times without a zone are taken as UTC, as everywhere else.
+func suggestTime(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339Nano)
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case n >= 1e9 && n < 1e10:
+			return time.Unix(n, 0).UTC().Format(time.RFC3339)
+		case n >= 1e12 && n < 1e13:
+			return time.UnixMilli(n).UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return ""
+}
+
+// checkHorizon rejects a target further than limit from now, most often a
+// mistyped year, and suggests the same date in the nearest year that fits.
+func checkHorizon(target, now time.Time, limit time.Duration) error {
+	d := target.Sub(now)
+	if limit <= 0 || d.Abs() <= limit {
+		return nil
+	}
+	msg := fmt.Sprintf("target %s is %.0f days from now, beyond -max-horizon (%.0f days)", target.Format(time.RFC3339), d.Abs().Hours()/24, limit.Hours()/24)
+	alt := target.AddDate(now.Year()-target.Year(), 0, 0)
+	for _, y := range []int{-1, 1} {
+		if c := alt.AddDate(y, 0, 0); c.Sub(now).Abs() < alt.Sub(now).Abs() {
+			alt = c
+		}
+	}
+	if alt.Sub(now) <= limit {
+		msg += fmt.Sprintf("; did you mean -target=%s?", alt.Format(time.RFC3339))
+	}
+	return errors.New(msg + " Raise -max-horizon if the date is right")
+}
+
+// checkAvg rejects an -avg that is not a positive number of seconds, or is
+// more than avgPlausibleFactor off ref (what, e.g. "Polygon PoS's nominal
+// block time"), so a value in milliseconds or a typo fails with the likely
+// intended value instead of predicting a height orders of magnitude off.
+func checkAvg(avg, ref float64, what string) error {
+	if math.IsNaN(avg) || math.IsInf(avg, 0) || avg <= 0 {
+		if ref > 0 {
+			return fmt.Errorf("-avg must be a positive number of seconds per block, got %v; %s is %gs, e.g. -avg=%g", avg, what, ref, ref)
+		}
+		return fmt.Errorf("-avg must be a positive number of seconds per block, got %v", avg)
+	}
+	plausible := func(v float64) bool { return v >= ref/avgPlausibleFactor && v <= ref*avgPlausibleFactor }
+	if ref <= 0 || plausible(avg) {
+		return nil
+	}
+	if plausible(avg / 1000) {
+		return fmt.Errorf("-avg=%v is over %gx %s of %gs and looks like milliseconds; did you mean -avg=%g?", avg, avgPlausibleFactor, what, ref, avg/1000)
+	}
+	return fmt.Errorf("-avg=%v is more than %gx off %s of %gs; check the units, or pass e.g. -avg=%g", avg, avgPlausibleFactor, what, ref, ref)
+}
+
+// explorerURLs are the block page templates of an explorer on one network.
+// Countdown, when set, is used for heights not produced yet.
+type explorerURLs struct {
+	Block     string
+	Countdown string
+}
+
+// blockExplorers maps an -explorer preset to its templates per network.
+var blockExplorers = map[string]map[string]explorerURLs{
+	"polygonscan": {
+		"mainnet": {Block: "https://polygonscan.com/block/%d", Countdown: "https://polygonscan.com/block/countdown/%d"},
+		"amoy":    {Block: "https://amoy.polygonscan.com/block/%d", Countdown: "https://amoy.polygonscan.com/block/countdown/%d"},
+	},
+	"oklink": {
+		"mainnet": {Block: "https://www.oklink.com/polygon/block/%d"},
+		"amoy":    {Block: "https://www.oklink.com/amoy/block/%d"},
+	},
+}
+
+// resolveExplorer turns -explorer into templates for network. The flag is a
+// preset name, a URL template with one %d for the height, or empty for no
+// links.
+func resolveExplorer(name, network string) (explorerURLs, error) {
+	switch {
+	case name == "":
+		return explorerURLs{}, nil
+	case strings.Count(name, "%d") == 1:
+		return explorerURLs{Block: name}, nil
+	}
+	byNetwork, ok := blockExplorers[name]
+	if !ok {
+		return explorerURLs{}, fmt.Errorf("unknown -explorer %q (use polygonscan, oklink or a URL template with %%d)", name)
+	}
+	u, ok := byNetwork[network]
+	if !ok {
+		return explorerURLs{}, fmt.Errorf("-explorer %s has no links for network %q", name, network)
+	}
+	return u, nil
+}
+
+// url links height, or returns "" when links are disabled.
+func (e explorerURLs) url(height uint64, future bool) string {
+	if future && e.Countdown != "" {
+		return fmt.Sprintf(e.Countdown, height)
+	}
+	if e.Block == "" {
+		return ""
+	}
+	return fmt.Sprintf(e.Block, height)
+}
+
+// evmChain is an entry of the embedded chain registry that -chain and
+// -chain-id select, so the calculator works against any EVM JSON-RPC.
+type evmChain struct {
+	Key       string  `json:"key"`
+	Name      string  `json:"name"`
+	ChainID   uint64  `json:"chain_id"`
+	RPC       string  `json:"rpc"`
+	BlockTime float64 `json:"block_time"` // nominal seconds per block
+	Explorer  string  `json:"explorer,omitempty"`
+	// Fixed marks chains whose protocol produces a block every BlockTime
+	// seconds exactly, so predictions need no historical average.
+	Fixed bool `json:"fixed,omitempty"`
+	// HeimdallREST is the Heimdall REST API of a Bor network, whose
+	// milestones mark finality when the RPC lacks the "finalized" tag.
+	HeimdallREST string `json:"heimdall_rest,omitempty"`
+}
+
+// builtinRegistry is the embedded chain registry and Bor hardfork table, so
+// one file works on an air-gapped machine; -registry-file replaces it with
+// a newer copy without rebuilding.
+var builtinRegistry = registry.JSON
+
+// registryFile is the layout of the embedded registry and -registry-file.
+type registryFile struct {
+	Chains    []evmChain `json:"chains"`
+	Hardforks []hardfork `json:"hardforks"`
+}
+
+// hardfork is a known Bor upgrade and the block it activates at. The table
+// copies bor's chain configs; a node's own config is authoritative.
+type hardfork struct {
+	Network string `json:"network"` // as -network, e.g. mainnet or amoy
+	Name    string `json:"name"`
+	Block   uint64 `json:"block"`
+}
+
+// chainRegistry and hardforks are the registry in use, set by
+// loadBaseRegistry.
+var (
+	chainRegistry []evmChain
+	hardforks     []hardfork
+)
+
+// loadBaseRegistry loads the registry from path, or the embedded one when
+// path is empty. Unlike the chains -registry adds, the file replaces the
+// embedded registry entirely.
+func loadBaseRegistry(path string) error {
+	b, name := builtinRegistry, "embedded registry"
+	if path != "" {
+		var err error
+		if b, err = os.ReadFile(path); err != nil {
+			return err
+		}
+		name = path
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var reg registryFile
+	if err := dec.Decode(&reg); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	for i, c := range reg.Chains {
+		var err error
+		if reg.Chains[i], err = checkChain(name, i, c); err != nil {
+			return err
+		}
+	}
+	for i, f := range reg.Hardforks {
+		if f.Network == "" || f.Name == "" || f.Block == 0 {
+			return fmt.Errorf("%s: hardfork %d needs a network, a name and a block", name, i)
+		}
+	}
+	chainRegistry, hardforks = reg.Chains, reg.Hardforks
+	return nil
+}
+
+func defaultRegistryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".chain-utils", "chains.json")
+}
+
+// loadRegistry adds the chains listed in the JSON file at path to
+// chainRegistry, so devnets and other networks without a built-in entry
+// work with -chain and -chain-id. An entry with the key or chain id of an
+// existing one replaces it. A missing file is only an error when required.
+func loadRegistry(path string, required bool) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var chains []evmChain
+	if err := dec.Decode(&chains); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for i, c := range chains {
+		c, err := checkChain(path, i, c)
+		if err != nil {
+			return err
+		}
+		replaced := false
+		for j, r := range chainRegistry {
+			if strings.EqualFold(r.Key, c.Key) || r.ChainID == c.ChainID {
+				chainRegistry[j], replaced = c, true
+				break
+			}
+		}
+		if !replaced {
+			chainRegistry = append(chainRegistry, c)
+		}
+	}
+	return nil
+}
+
+// checkChain validates entry i of a registry file at path, naming it after
+// its key when it has no name.
+func checkChain(path string, i int, c evmChain) (evmChain, error) {
+	switch {
+	case c.Key == "":
+		return c, fmt.Errorf("%s: entry %d has no key", path, i)
+	case c.ChainID == 0:
+		return c, fmt.Errorf("%s: %s has no chain_id", path, c.Key)
+	case c.RPC == "":
+		return c, fmt.Errorf("%s: %s has no rpc", path, c.Key)
+	case c.BlockTime <= 0:
+		return c, fmt.Errorf("%s: %s needs a positive block_time", path, c.Key)
+	}
+	if c.Name == "" {
+		c.Name = c.Key
+	}
+	return c, nil
+}
+
+// lookupChain returns the registry entry named by -chain or numbered by
+// -chain-id. ok is false when neither flag is set.
+func lookupChain(name string, id uint64) (c evmChain, ok bool, err error) {
+	if name == "" && id == 0 {
+		return evmChain{}, false, nil
+	}
+	for _, c := range chainRegistry {
+		if (name == "" || strings.EqualFold(c.Key, name)) && (id == 0 || c.ChainID == id) {
+			return c, true, nil
+		}
+	}
+	keys := make([]string, len(chainRegistry))
+	for i, c := range chainRegistry {
+		keys[i] = c.Key
+	}
+	if name != "" && id != 0 {
+		return evmChain{}, false, fmt.Errorf("-chain %q and -chain-id %d name different chains", name, id)
+	}
+	if name != "" {
+		return evmChain{}, false, fmt.Errorf("unknown -chain %q (known: %s)", name, strings.Join(keys, ", "))
+	}
+	return evmChain{}, false, fmt.Errorf("chain id %d is not in the registry (known: %s)", id, strings.Join(keys, ", "))
+}
+
+// checkFixedBlockTime averages the sample blocks below head and warns when
+// that strays from the nominal block time by more than tolerance, which
+// means the fixed-block-time assumption no longer holds.
+func checkFixedBlockTime(ctx context.Context, client *http.Client, rpcURL string, head, headTS uint64, nominal float64, sample uint64, tolerance float64) (float64, error) {
+	if min(sample, head) == 0 {
+		return nominal, nil
+	}
+	measured, sample, err := measureBlockTime(ctx, client, rpcURL, head, headTS, sample)
+	if err != nil {
+		return 0, err
+	}
+	if dev := math.Abs(measured-nominal) / nominal; dev > tolerance {
+		fmt.Fprintf(os.Stderr, "warning: the last %d blocks averaged %.6f s, %.2f%% off the fixed %.6f s block time; pass -avg to override\n", sample, measured, 100*dev, nominal)
+	}
+	return measured, nil
+}
+
+// intervalSpread returns the mean and standard deviation of the last n block
+// intervals up to head, or all of them on a younger chain, and how many
+// intervals they were taken over.
+func intervalSpread(ctx context.Context, client *http.Client, rpcURL string, head, n uint64) (float64, float64, uint64, error) {
+	n = min(n, head)
+	ts := make([]uint64, n+1)
+	g := fetch.NewGroup(ctx, sampleConcurrency)
+	for i := range ts {
+		g.Go(func(ctx context.Context) (err error) {
+			ts[i], err = getBlockTimestamp(ctx, client, rpcURL, head-uint64(i))
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return 0, 0, 0, fmt.Errorf("sample block intervals: %w", err)
+	}
+	if n < 2 {
+		return 0, 0, n, nil
+	}
+	mean := float64(int64(ts[0])-int64(ts[n])) / float64(n)
+	var sumSq float64
+	for i := uint64(0); i < n; i++ {
+		d := float64(int64(ts[i])-int64(ts[i+1])) - mean
+		sumSq += d * d
+	}
+	return mean, math.Sqrt(sumSq / float64(n-1)), n, nil
+}
+
+// measureBlockTime returns the average block time over the last lookback
+// blocks up to head, or all of them on a younger chain, and the number of
+// blocks it was measured over.
+func measureBlockTime(ctx context.Context, client *http.Client, rpcURL string, head, headTS, lookback uint64) (float64, uint64, error) {
+	lookback = min(lookback, head)
+	if lookback == 0 {
+		return 0, 0, errors.New("no blocks below the head to measure the block time over; pass -avg")
+	}
+	fromTS, err := getBlockTimestamp(ctx, client, rpcURL, head-lookback)
+	if err != nil {
+		return 0, 0, fmt.Errorf("get timestamp for block %d: %w", head-lookback, err)
+	}
+	if fromTS >= headTS {
+		return 0, 0, fmt.Errorf("implausible block timestamps: block %d (%d) is not older than head %d (%d)", head-lookback, fromTS, head, headTS)
+	}
+	return float64(int64(headTS)-int64(fromTS)) / float64(lookback), lookback, nil
+}
+
+func chainLabel(c evmChain) string {
+	var s string
+	if c.Fixed {
+		s += ", fixed"
+	}
+	if c.Explorer != "" {
+		s += ", " + c.Explorer
+	}
+	return s
+}
+
+// checkChainID fails when the endpoint does not serve the selected chain.
+func checkChainID(ctx context.Context, client *http.Client, rpcURL string, c evmChain) error {
+	var hex string
+	if err := redactErr(ethrpc.Call(ctx, client, rpcURL, "eth_chainId", []interface{}{}, &hex, rpcOptions(rpcURL)...)); err != nil {
+		return fmt.Errorf("get chain id: %w", err)
+	}
+	id, err := ethrpc.HexToUint64(hex)
+	if err != nil {
+		return fmt.Errorf("parse chain id: %w", err)
+	}
+	if id != c.ChainID {
+		return fmt.Errorf("endpoint %s serves chain id %d, but %s is chain id %d", redact(rpcURL), id, c.Name, c.ChainID)
+	}
+	return nil
+}
+
+// chainlistSnapshotDate is when chainlistRPCs was copied from the chainlist
+// registry (chainlist.org). -chainlist warns once it is older than
+// chainlistMaxAge, as public endpoints come and go.
+const (
+	chainlistSnapshotDate = "2026-10-01"
+	chainlistMaxAge       = 90 * 24 * time.Hour
+)
+
+// chainlistRPCs are the keyless public HTTPS endpoints of the registry
+// chains, in the order -chainlist tries them.
+var chainlistRPCs = map[uint64][]string{
+	137:      {"https://polygon-rpc.com", "https://polygon-bor-rpc.publicnode.com", "https://polygon.drpc.org", "https://1rpc.io/matic"},
+	80002:    {"https://rpc-amoy.polygon.technology", "https://polygon-amoy-bor-rpc.publicnode.com", "https://polygon-amoy.drpc.org"},
+	1:        {"https://ethereum-rpc.publicnode.com", "https://eth.drpc.org", "https://1rpc.io/eth", "https://cloudflare-eth.com"},
+	11155111: {"https://ethereum-sepolia-rpc.publicnode.com", "https://sepolia.drpc.org", "https://rpc.sepolia.org"},
+	100:      {"https://rpc.gnosischain.com", "https://gnosis-rpc.publicnode.com", "https://gnosis.drpc.org"},
+	56:       {"https://bsc-dataseed.bnbchain.org", "https://bsc-rpc.publicnode.com", "https://bsc.drpc.org"},
+	43114:    {"https://api.avax.network/ext/bc/C/rpc", "https://avalanche-c-chain-rpc.publicnode.com", "https://avalanche.drpc.org"},
+	42161:    {"https://arb1.arbitrum.io/rpc", "https://arbitrum-one-rpc.publicnode.com", "https://arbitrum.drpc.org"},
+	10:       {"https://mainnet.optimism.io", "https://optimism-rpc.publicnode.com", "https://optimism.drpc.org"},
+	8453:     {"https://mainnet.base.org", "https://base-rpc.publicnode.com", "https://base.drpc.org"},
+	1101:     {"https://zkevm-rpc.com", "https://polygon-zkevm.drpc.org"},
+	2442:     {"https://rpc.cardona.zkevm-rpc.com"},
+}
+
+// resolveChainlistRPC returns the first snapshot endpoint for chainID that
+// answers eth_chainId with it, warning when the snapshot is stale.
+func resolveChainlistRPC(ctx context.Context, client *http.Client, chainID uint64) (string, error) {
+	if taken, err := time.Parse(time.DateOnly, chainlistSnapshotDate); err == nil && time.Since(taken) > chainlistMaxAge {
+		fmt.Fprintf(os.Stderr, "warning: the embedded chainlist snapshot is from %s; its endpoints may be outdated, pass -rpc if none answers\n", chainlistSnapshotDate)
+	}
+	urls, ok := chainlistRPCs[chainID]
+	if !ok {
+		return "", fmt.Errorf("the chainlist snapshot has no endpoints for chain id %d", chainID)
+	}
+	var errs []string
+	for _, u := range urls {
+		probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		var hex string
+		err := redactErr(ethrpc.Call(probeCtx, client, u, "eth_chainId", []interface{}{}, &hex, rpcOptions(u)...))
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", u, err))
+			continue
+		}
+		if id, err := ethrpc.HexToUint64(hex); err != nil || id != chainID {
+			errs = append(errs, fmt.Sprintf("%s: serves chain id %s", u, hex))
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "using public RPC %s (chainlist snapshot of %s)\n", u, chainlistSnapshotDate)
+		return u, nil
+	}
+	return "", fmt.Errorf("no chainlist endpoint for chain id %d answered:\n  %s", chainID, strings.Join(errs, "\n  "))
+}
+
+// rpcProviders are the Polygon endpoints of hosted RPC providers per
+// network, so -provider and -key replace a hand-built -rpc URL. %s is the
+// API key; QuickNode's -key is "<endpoint-name>/<token>" since each of its
+// endpoints has its own subdomain.
+var rpcProviders = map[string]map[string]string{
+	"alchemy": {
+		"mainnet": "https://polygon-mainnet.g.alchemy.com/v2",
+		"amoy":    "https://polygon-amoy.g.alchemy.com/v2",
+	},
+	"infura": {
+		"mainnet": "https://polygon-mainnet.infura.io/v3/%s",
+		"amoy":    "https://polygon-amoy.infura.io/v3/%s",
+	},
+	"quicknode": {
+		"mainnet": "https://%s.matic.quiknode.pro/%s/",
+		"amoy":    "https://%s.matic-amoy.quiknode.pro/%s/",
+	},
+	"ankr": {
+		"mainnet": "https://rpc.ankr.com/polygon/%s",
+		"amoy":    "https://rpc.ankr.com/polygon_amoy/%s",
+	},
+}
+
+// rpcAuth holds the headers sent to a provider endpoint, keyed by its URL
+// so they never leak to any other endpoint.
+var rpcAuth = map[string]http.Header{}
+
+// resolveProvider expands -provider for network. Alchemy takes the key as a
+// bearer token instead of in the URL; Infura's optional API key secret is
+// sent as basic auth.
+func resolveProvider(name, network, key, secret string) (string, http.Header, error) {
+	byNetwork, ok := rpcProviders[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown -provider %q (use alchemy, infura, quicknode or ankr)", name)
+	}
+	tmpl, ok := byNetwork[network]
+	if !ok {
+		return "", nil, fmt.Errorf("-provider %s has no endpoint for network %q (use mainnet or amoy)", name, network)
+	}
+	if key == "" {
+		return "", nil, fmt.Errorf("-provider %s needs -key", name)
+	}
+	h := http.Header{}
+	switch name {
+	case "alchemy":
+		h.Set("Authorization", "Bearer "+key)
+		return tmpl, h, nil
+	case "quicknode":
+		endpoint, token, ok := strings.Cut(key, "/")
+		if !ok || endpoint == "" || token == "" {
+			return "", nil, fmt.Errorf("-provider quicknode needs -key=<endpoint-name>/<token>")
+		}
+		return fmt.Sprintf(tmpl, endpoint, token), h, nil
+	case "infura":
+		if secret != "" {
+			h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(":"+secret)))
+		}
+	}
+	return fmt.Sprintf(tmpl, key), h, nil
+}
+
+// flagSet reports whether the named flag was passed on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// staleBlocks is how far an endpoint's head may trail the best head of a
+// multi-endpoint -rpc before requests stop going to it.
+const staleBlocks = 32
+
+// failoverCooldown is how long an endpoint that failed is tried only after
+// the others.
+const failoverCooldown = 30 * time.Second
+
+// failoverRPC spreads JSON-RPC requests over the endpoints of a
+// comma-separated -rpc. Requests go round-robin; one that fails, is
+// rate-limited (HTTP 429) or gets a 5xx moves on to the next endpoint
+// within the same attempt, and the failed endpoint goes to the back of the
+// line for failoverCooldown. Head queries go to every endpoint at once and
+// are answered from the highest head, and endpoints trailing it by more
+// than staleBlocks are only tried once the others fail.
+type failoverRPC struct {
+	next      http.RoundTripper
+	endpoints []*url.URL
+
+	mu     sync.Mutex
+	turn   int
+	heads  []uint64    // last head each endpoint reported, 0 when unknown
+	lagged []bool      // whether each endpoint was stale at the last head query
+	down   []time.Time // when each endpoint last failed
+}
+
+// splitEndpoints splits a comma-separated -rpc.
+func splitEndpoints(s string) []string {
+	var out []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func newFailoverRPC(endpoints []string, next http.RoundTripper) (*failoverRPC, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	f := &failoverRPC{next: next, heads: make([]uint64, len(endpoints)), lagged: make([]bool, len(endpoints)), down: make([]time.Time, len(endpoints))}
+	for _, e := range endpoints {
+		u, err := url.Parse(e)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("endpoint %q is not an http(s) URL", clip(e))
+		}
+		f.endpoints = append(f.endpoints, u)
+	}
+	return f, nil
+}
+
+func (f *failoverRPC) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	var call struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	_ = json.Unmarshal(body, &call)
+	if call.Method == "eth_blockNumber" || (call.Method == "eth_getBlockByNumber" && len(call.Params) > 0 && string(call.Params[0]) == `"latest"`) {
+		return f.head(req, body)
+	}
+
+	var lastResp *http.Response
+	var lastErr error
+	for _, i := range f.order() {
+		resp, err := f.send(req, body, i)
+		if err == nil && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			return resp, err
+		}
+		if lastResp != nil {
+			lastResp.Body.Close()
+		}
+		lastResp, lastErr = resp, err
+		f.mu.Lock()
+		f.down[i] = time.Now()
+		f.mu.Unlock()
+		fmt.Fprintf(os.Stderr, "warning: %s: %s; failing over\n", f.endpoints[i].Host, failoverReason(resp, err))
+	}
+	return lastResp, lastErr
+}
+
+// head sends a head query to every endpoint and answers with the highest
+// head, so a lagging endpoint never moves the reported head back.
+func (f *failoverRPC) head(req *http.Request, body []byte) (*http.Response, error) {
+	type answer struct {
+		resp   *http.Response
+		raw    []byte
+		height uint64
+		err    error
+	}
+	answers := make([]answer, len(f.endpoints))
+	var wg sync.WaitGroup
+	for i := range f.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a := &answers[i]
+			if a.resp, a.err = f.send(req, body, i); a.err != nil {
+				return
+			}
+			a.raw, a.err = io.ReadAll(a.resp.Body)
+			a.resp.Body.Close()
+			if a.err != nil || a.resp.StatusCode != http.StatusOK {
+				return
+			}
+			var env struct {
+				Result json.RawMessage `json:"result"`
+			}
+			var hex string
+			if json.Unmarshal(a.raw, &env) != nil || json.Unmarshal(env.Result, &hex) != nil {
+				var b struct {
+					Number string `json:"number"`
+				}
+				if json.Unmarshal(env.Result, &b) != nil {
+					return
+				}
+				hex = b.Number
+			}
+			a.height, _ = ethrpc.HexToUint64(hex)
+		}()
+	}
+	wg.Wait()
+
+	best := -1
+	f.mu.Lock()
+	for i, a := range answers {
+		if a.height > 0 {
+			f.heads[i] = a.height
+			if best < 0 || a.height > answers[best].height {
+				best = i
+			}
+		}
+	}
+	if best >= 0 {
+		// Warn once when an endpoint falls behind, not on every head query
+		for i, a := range answers {
+			stale := a.height > 0 && a.height+staleBlocks < answers[best].height
+			if stale && !f.lagged[i] {
+				fmt.Fprintf(os.Stderr, "warning: %s is %d blocks behind %s; using it only if the others fail\n",
+					f.endpoints[i].Host, answers[best].height-a.height, f.endpoints[best].Host)
+			}
+			f.lagged[i] = stale
+		}
+	}
+	f.mu.Unlock()
+	if best < 0 {
+		// No endpoint reported a head; pass an answer on so the caller
+		// sees the failure
+		for _, a := range answers {
+			if a.err == nil {
+				a.resp.Body = io.NopCloser(bytes.NewReader(a.raw))
+				return a.resp, nil
+			}
+		}
+		return nil, answers[len(answers)-1].err
+	}
+	resp := answers[best].resp
+	resp.Body = io.NopCloser(bytes.NewReader(answers[best].raw))
+	return resp, nil
+}
+
+// order returns the endpoints to try for one request: the healthy ones
+// from the next round-robin turn, then those that failed recently, then the
+// stale ones.
+func (f *failoverRPC) order() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	top := slices.Max(f.heads)
+	var healthy, failed, stale []int
+	for k := range f.endpoints {
+		i := (f.turn + k) % len(f.endpoints)
+		switch {
+		case f.heads[i] > 0 && f.heads[i]+staleBlocks < top:
+			stale = append(stale, i)
+		case time.Since(f.down[i]) < failoverCooldown:
+			failed = append(failed, i)
+		default:
+			healthy = append(healthy, i)
+		}
+	}
+	f.turn++
+	return slices.Concat(healthy, failed, stale)
+}
+
+// send sends req with body to endpoint i.
+func (f *failoverRPC) send(req *http.Request, body []byte, i int) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL = f.endpoints[i]
+	r.Host = ""
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return f.next.RoundTrip(r)
+}
+
+// failoverReason describes why a request to an endpoint was given up on.
+func failoverReason(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("HTTP %d", resp.StatusCode)
+}
+
+func getLatestBlockNumber(ctx context.Context, client *http.Client, rpcURL string) (uint64, error) {
+	var hex string
+	if err := redactErr(ethrpc.Call(ctx, client, rpcURL, "eth_blockNumber", []interface{}{}, &hex, rpcOptions(rpcURL)...)); err != nil {
+		return 0, err
+	}
+	return ethrpc.HexToUint64(hex)
+}
+
+func getBlockTimestamp(ctx context.Context, client *http.Client, rpcURL string, height uint64) (ts uint64, err error) {
+	if memo != nil {
+		if ts, ok := memo.get(height); ok {
+			return ts, nil
+		}
+		defer func() {
+			if err == nil {
+				memo.put(height, ts)
+			}
+		}()
+	}
+	hexHeight := fmt.Sprintf("0x%x", height)
+	params := []interface{}{hexHeight, false}
+	var respBlock *block
+	if err := redactErr(ethrpc.Call(ctx, client, rpcURL, "eth_getBlockByNumber", params, &respBlock, rpcOptions(rpcURL)...)); err != nil {
+		return 0, err
+	}
+	if respBlock == nil || respBlock.Timestamp == "" {
+		return 0, fmt.Errorf("empty block/timestamp for height %d", height)
+	}
+	return ethrpc.HexToUint64(respBlock.Timestamp)
+}
+
+// rpcOptions are the ethrpc options every call to rpcURL takes on top of
+// ethrpc.Call's retry policy: the provider's headers from rpcAuth, -strict
+// decoding and the -snapshot recorder. Callers pass the error through
+// redactErr, as transport errors quote the URL, which holds a -provider key.
+func rpcOptions(rpcURL string) []ethrpc.Option {
+	opts := []ethrpc.Option{ethrpc.WithObserver(func(req, resp []byte) {
+		recorder.record(string(req), resp)
+	})}
+	for k, vs := range rpcAuth[rpcURL] {
+		for _, v := range vs {
+			opts = append(opts, ethrpc.WithHeader(k, v))
+		}
+	}
+	if strictJSON {
+		opts = append(opts, ethrpc.WithStrict())
+	}
+	return opts
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+func absInt64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// checkClockSkew compares the head block time against the local clock (or an
+// NTP-corrected clock when ntpServer is set) and returns an error when they
+// are further than maxAge apart.
+func checkClockSkew(head time.Time, maxAge time.Duration, ntpServer string) error {
+	now := time.Now()
+	if ntpServer != "" {
+		offset, err := ntpOffset(ntpServer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: ntp query to %s failed: %v (using local clock)\n", ntpServer, err)
+		} else {
+			if offset.Abs() > time.Second {
+				fmt.Fprintf(os.Stderr, "warning: local clock is off by %s according to %s\n", offset.Round(time.Millisecond), ntpServer)
+			}
+			now = now.Add(offset)
+		}
+	}
+	age := now.Sub(head)
+	switch {
+	case age < -maxAge:
+		return fmt.Errorf("head block timestamp is %s in the future; the endpoint or the local clock is wrong", (-age).Round(time.Second))
+	case age > maxAge:
+		return fmt.Errorf("head block is %s old; the endpoint may be lagging and predictions will be off", age.Round(time.Second))
+	}
+	return nil
+}
+
+// flagImplausible warns loudly about an implausible head timestamp, or
+// returns it as the error when strict.
+func flagImplausible(err error, strict bool) error {
+	if err == nil {
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("implausible block timestamp: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "WARNING: implausible block timestamp: %v\n", err)
+	fmt.Fprintf(os.Stderr, "WARNING: the prediction below may be wrong; -strict-time makes this an error\n")
+	return nil
+}
+
+// ntpOffset performs a single SNTP query and returns how far the local clock
+// is behind the server.
+func ntpOffset(server string) (time.Duration, error) {
+	server = ntpAddr(server)
+	conn, err := net.DialTimeout("udp", server, 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return 0, err
+	}
+
+	req := make([]byte, 48)
+	req[0] = 0x1B // LI=0, VN=3, Mode=3 (client)
+	t1 := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 48)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return 0, err
+	}
+	t4 := time.Now()
+
+	// A kiss-o'-death packet has stratum 0 and no usable time, and a reply
+	// from anything but a server, or without a transmit timestamp, is not
+	// an answer to this query.
+	if mode := resp[0] & 0x7; mode != 4 {
+		return 0, fmt.Errorf("reply has mode %d, want 4 (server)", mode)
+	}
+	if resp[1] == 0 {
+		return 0, fmt.Errorf("kiss-o'-death reply (stratum 0, code %q)", resp[12:16])
+	}
+	if binary.BigEndian.Uint64(resp[40:]) == 0 {
+		return 0, fmt.Errorf("reply has no transmit timestamp")
+	}
+
+	t2 := ntpTime(binary.BigEndian.Uint32(resp[32:]), binary.BigEndian.Uint32(resp[36:]))
+	t3 := ntpTime(binary.BigEndian.Uint32(resp[40:]), binary.BigEndian.Uint32(resp[44:]))
+	return (t2.Sub(t1) + t3.Sub(t4)) / 2, nil
+}
+
+// ntpAddr adds the NTP port to a server given without one, which may be an
+// IPv6 address such as ::1 or [::1].
+func ntpAddr(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), "123")
+}
+
+func ntpTime(sec, frac uint32) time.Time {
+	const ntpEpochOffset = 2208988800 // seconds between 1900 and 1970
+	nsec := (int64(frac) * 1e9) >> 32
+	return time.Unix(int64(sec)-ntpEpochOffset, nsec)
+}
+
+// failJSON is set by -format=json: failures are then printed on stdout as
+// a JSON failure, for orchestration, instead of as text on stderr.
+var failJSON bool
+
+// failEndpoint is the endpoint the run talks to. It is set once requests
+// start, so a failure without one is an input error.
+var failEndpoint string
+
+// failure describes an error for machines: a stable code, its category,
+// the endpoint involved and whether rerunning the same command may succeed.
+type failure struct {
+	Code      string `json:"code"`
+	Category  string `json:"category"` // input, network, provider, data or runtime
+	Message   string `json:"message"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	Retryable bool   `json:"retryable"`
+}
+
+// newFailure classifies err, whose text is msg, met talking to endpoint.
+// Most errors reach here flattened into text, so the text is matched too.
+func newFailure(err error, msg, endpoint string) failure {
+	f := failure{Message: msg, Endpoint: endpoint}
+	var ne net.Error
+	lower := strings.ToLower(msg)
+	has := func(subs ...string) bool {
+		for _, s := range subs {
+			if strings.Contains(lower, s) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case endpoint == "":
+		f.Code, f.Category = "invalid_input", "input"
+	case has("retry budget exhausted"):
+		f.Code, f.Category, f.Retryable = "retry_budget_exhausted", "network", true
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout(), has("timeout", "deadline exceeded"):
+		f.Code, f.Category, f.Retryable = "timeout", "network", true
+	case has("http 429", "too many requests", "rate limit"):
+		f.Code, f.Category, f.Retryable = "rate_limited", "provider", true
+	case has("http 5"):
+		f.Code, f.Category, f.Retryable = "server_error", "provider", true
+	case has("http 4"):
+		f.Code, f.Category = "request_rejected", "provider"
+	case has("implausible"):
+		// A stale head or a lagging node usually catches up
+		f.Code, f.Category, f.Retryable = "implausible_data", "data", true
+	case has("strict:", "invalid character", "cannot unmarshal", "unexpected end of json"):
+		f.Code, f.Category = "malformed_response", "provider"
+	case errors.As(err, &ne), has("connection refused", "connection reset", "no such host", "eof"):
+		f.Code, f.Category, f.Retryable = "unreachable", "network", true
+	default:
+		f.Code, f.Category = "failed", "runtime"
+	}
+	return f
+}
+
+// printFailure reports a failure of the run: as JSON on stdout under
+// -format=json, otherwise as text on stderr.
+func printFailure(err error, msg string) {
+	if !failJSON {
+		fmt.Fprintf(os.Stderr, "error: %s\n", msg)
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(struct {
+		Error failure `json:"error"`
+	}{newFailure(err, msg, failEndpoint)})
+}
+
+func failf(format string, a ...any) {
+	// The last error among the arguments is the one to classify
+	var err error
+	for _, v := range a {
+		if e, ok := v.(error); ok {
+			err = e
+		}
+	}
+	printFailure(err, fmt.Sprintf(format, a...))
+	os.Exit(1)
+}
+
+// auditSnapshot captures what a single run printed and every upstream
+// response it was computed from, so -snapshot archives can be audited later.
+type auditSnapshot struct {
+	mu        sync.Mutex
+	started   time.Time
+	exchanges []exchange
+	stdout    *os.File
+	pipe      *os.File
+	done      chan struct{}
+	report    bytes.Buffer
+}
+
+type exchange struct {
+	At       time.Time       `json:"at"`
+	Request  string          `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// recorder is set while a -snapshot run is captured; nil records nothing.
+var recorder *auditSnapshot
+
+// secrets are the -provider credentials, kept out of snapshots and errors.
+var secrets []string
+
+// redact replaces every secret in v.
+func redact(v string) string {
+	for _, sec := range secrets {
+		if sec != "" {
+			v = strings.ReplaceAll(v, sec, "REDACTED")
+		}
+	}
+	return v
+}
+
+// redactedError is err with the secrets redacted from its message; errors.Is
+// and errors.As still see err.
+type redactedError struct{ err error }
+
+func (e redactedError) Error() string { return redact(e.err.Error()) }
+func (e redactedError) Unwrap() error { return e.err }
+
+// redactErr wraps err in a redactedError once a -provider key is set.
+func redactErr(err error) error {
+	if err == nil || len(secrets) == 0 {
+		return err
+	}
+	return redactedError{err}
+}
+
+// startSnapshot tees stdout into the snapshot until write is called.
+func startSnapshot() (*auditSnapshot, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	s := &auditSnapshot{started: time.Now().UTC(), stdout: os.Stdout, pipe: w, done: make(chan struct{})}
+	os.Stdout = w
+	go func() {
+		io.Copy(io.MultiWriter(s.stdout, &s.report), r)
+		close(s.done)
+	}()
+	return s, nil
+}
+
+func (s *auditSnapshot) record(request string, response []byte) {
+	if s == nil {
+		return
+	}
+	raw := json.RawMessage(bytes.Clone(response))
+	if !json.Valid(raw) {
+		raw, _ = json.Marshal(string(response))
+	}
+	s.mu.Lock()
+	s.exchanges = append(s.exchanges, exchange{At: time.Now().UTC(), Request: request, Response: raw})
+	s.mu.Unlock()
+}
+
+// write restores stdout and stores the report, the raw responses and the
+// tool version and configuration in a gzipped tarball at path.
+func (s *auditSnapshot) write(path string, runErr error) error {
+	os.Stdout = s.stdout
+	s.pipe.Close()
+	<-s.done
+
+	flags := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) { flags[f.Name] = redact(f.Value.String()) })
+	args := make([]string, len(os.Args)-1)
+	for i, a := range os.Args[1:] {
+		args[i] = redact(a)
+	}
+	meta := map[string]any{
+		"tool":        toolName,
+		"go_version":  runtime.Version(),
+		"args":        args,
+		"flags":       flags,
+		"started_at":  s.started,
+		"finished_at": time.Now().UTC(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		meta["version"] = bi.Main.Version
+		for _, kv := range bi.Settings {
+			if kv.Key == "vcs.revision" {
+				meta["revision"] = kv.Value
+			}
+		}
+	}
+	if runErr != nil {
+		meta["error"] = runErr.Error()
+	}
+	metaJSON, _ := json.MarshalIndent(meta, "", "  ")
+	s.mu.Lock()
+	respJSON, _ := json.MarshalIndent(s.exchanges, "", "  ")
+	s.mu.Unlock()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{"report.txt", s.report.Bytes()},
+		{"responses.json", respJSON},
+		{"meta.json", metaJSON},
+	} {
+		hdr := &tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.data)), ModTime: s.started.Truncate(time.Second)}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// locales are the message catalogs of the report, one JSON file of message
+// id to text per language. en.json is the reference: a translation may
+// leave messages out, which then read in English, but may not add ids or
+// change the formatting verbs of a message.
+//
+//go:embed locales/*.json
+var locales embed.FS
+
+// catalog is the -lang catalog, loaded by loadCatalog.
+var catalog map[string]string
+
+// verbRE matches the fmt verbs a translation must keep, in order.
+var verbRE = regexp.MustCompile(`%[-+# 0-9.*]*[a-zA-Z%]`)
+
+// loadCatalog loads the catalog of lang over the English one. An empty
+// lang is taken from LC_ALL, LC_MESSAGES or LANG, falling back to English
+// when no catalog matches.
+func loadCatalog(lang string) error {
+	en, err := readLocale("en")
+	if err != nil {
+		return err
+	}
+	catalog = en
+	explicit := lang != ""
+	if !explicit {
+		for _, v := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+			if lang = os.Getenv(v); lang != "" {
+				break
+			}
+		}
+		// e.g. es_ES.UTF-8
+		lang, _, _ = strings.Cut(lang, ".")
+		lang, _, _ = strings.Cut(lang, "_")
+	}
+	if lang == "" || lang == "en" || lang == "C" || lang == "POSIX" {
+		return nil
+	}
+	tr, err := readLocale(lang)
+	if errors.Is(err, fs.ErrNotExist) {
+		if !explicit {
+			return nil
+		}
+		names, _ := fs.Glob(locales, "locales/*.json")
+		for i, n := range names {
+			names[i] = strings.TrimSuffix(path.Base(n), ".json")
+		}
+		return fmt.Errorf("no catalog for %q (available: %s)", lang, strings.Join(names, ", "))
+	}
+	if err != nil {
+		return err
+	}
+	for id, s := range tr {
+		ref, ok := en[id]
+		if !ok {
+			return fmt.Errorf("locales/%s.json: unknown message %q", lang, id)
+		}
+		if !slices.Equal(verbRE.FindAllString(ref, -1), verbRE.FindAllString(s, -1)) {
+			return fmt.Errorf("locales/%s.json: message %q must use the verbs of %q", lang, id, ref)
+		}
+		catalog[id] = s
+	}
+	return nil
+}
+
+func readLocale(lang string) (map[string]string, error) {
+	data, err := locales.ReadFile("locales/" + lang + ".json")
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("locales/%s.json: %w", lang, err)
+	}
+	return m, nil
+}
+
+// msg returns the message id in the -lang catalog, formatted with a.
+func msg(id string, a ...any) string {
+	s, ok := catalog[id]
+	if !ok {
+		s = id
+	}
+	if len(a) == 0 {
+		return s
+	}
+	return fmt.Sprintf(s, a...)
+}
+
+// field is the report label of message id padded to width, then ": ", so
+// the values line up whatever the language (fmt pads by runes).
+func field(id string, width int) string {
+	return fmt.Sprintf("%-*s: ", width, msg(id))
+}
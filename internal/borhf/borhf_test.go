@@ -0,0 +1,423 @@
+package borhf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the calculator end to end through its
+// flags and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("BOR_HF_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// genesisTime is block 0 of the test chain. Blocks come every 3s up to
+// height 1,000,000 and every 2s after it, so the head, 2,000,000, is at
+// 2024-01-11T19:06:40Z.
+const genesisTime = 1_700_000_000
+
+func blockTime(h uint64) uint64 {
+	if h <= 1_000_000 {
+		return genesisTime + 3*h
+	}
+	return genesisTime + 3_000_000 + 2*(h-1_000_000)
+}
+
+// borNode is a Bor JSON-RPC endpoint over the test chain.
+type borNode struct {
+	head     uint64
+	pruned   uint64          // blocks below answer as on a pruned node
+	bad      map[uint64]bool // blocks whose timestamp is not hex
+	every429 int             // every nth request is rate limited
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (n *borNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params []any           `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if n.every429 > 0 && n.calls%n.every429 == 0 {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+		return
+	}
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "eth_blockNumber":
+		resp["result"] = fmt.Sprintf("0x%x", n.head)
+	case "eth_chainId":
+		resp["result"] = "0x89"
+	case "eth_getBlockByNumber":
+		h := n.head
+		if tag := req.Params[0].(string); tag != "latest" {
+			h, _ = strconv.ParseUint(strings.TrimPrefix(tag, "0x"), 16, 64)
+		}
+		switch {
+		case h > n.head:
+			resp["result"] = nil
+		case h < n.pruned:
+			resp["error"] = map[string]any{"code": -32000, "message": "header not found"}
+		default:
+			ts := fmt.Sprintf("0x%x", blockTime(h))
+			if n.bad[h] {
+				ts = "yesterday"
+			}
+			resp["result"] = map[string]string{"number": fmt.Sprintf("0x%x", h), "timestamp": ts}
+		}
+	default:
+		resp["error"] = map[string]any{"code": -32601, "message": "method not found"}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func newBorNode(t *testing.T, n *borNode) string {
+	t.Helper()
+	srv := httptest.NewServer(n)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs the calculator pinned to the test chain's head and returns its
+// stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	base := []string{"-as-of-height=2000000", "-max-horizon=0", "-ledger=", "-explorer=", "-registry="}
+	cmd := exec.Command(os.Args[0], append(base, args...)...)
+	cmd.Env = append(os.Environ(), "BOR_HF_RUN_MAIN=1", "HOME="+t.TempDir(), "LANG=C")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// predicted returns the height the report predicts.
+func predicted(t *testing.T, stdout string) string {
+	t.Helper()
+	for _, line := range strings.Split(stdout, "\n") {
+		if f := strings.Fields(line); len(f) == 3 && f[0] == "height" {
+			return f[2]
+		}
+	}
+	t.Fatalf("no predicted height in:\n%s", stdout)
+	return ""
+}
+
+func TestPredict(t *testing.T) {
+	url := newBorNode(t, &borNode{head: 2_000_000})
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"measured over a week", []string{"-target=2024-01-11T20:06:40Z"}, "2,001,800"},
+		// the lookback reaches into the 3s blocks: 1,100,000 blocks in
+		// 2,300,000s average 2.090909s
+		{"measured over a longer lookback", []string{"-target=2024-01-11T20:06:40Z", "-lookback=1100000"}, "2,001,722"},
+		// a lookback beyond genesis measures the whole chain: 2,000,000
+		// blocks in 5,000,000s
+		{"lookback beyond genesis", []string{"-target=2024-01-11T20:06:40Z", "-lookback=3000000"}, "2,001,440"},
+		{"fixed average", []string{"-target=2024-01-11T20:06:40Z", "-avg=2.5"}, "2,001,440"},
+		// 22.575s at 2.15s a block is exactly 10.5 blocks
+		{"half block rounds up", []string{"-target=2024-01-11T19:07:02.575Z", "-avg=2.15"}, "2,000,011"},
+		{"half block floors", []string{"-target=2024-01-11T19:07:02.575Z", "-avg=2.15", "-rounding=floor"}, "2,000,010"},
+		{"half block ceils", []string{"-target=2024-01-11T19:07:02.575Z", "-avg=2.15", "-rounding=ceil"}, "2,000,011"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := run(t, append([]string{"-rpc=" + url}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("run: %v\n%s", err, stderr)
+			}
+			if got := predicted(t, stdout); got != tt.want {
+				t.Errorf("predicted %s, want %s:\n%s", got, tt.want, stdout)
+			}
+		})
+	}
+}
+
+func TestPredictReport(t *testing.T) {
+	url := newBorNode(t, &borNode{head: 2_000_000})
+	stdout, stderr, err := run(t, "-rpc="+url, "-target=2024-01-11T20:06:40Z", "-sample=50")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	for _, want := range []string{
+		"Current block : 2,000,000 — 2024-01-11T19:06:40Z (UTC)",
+		"Target time : 2024-01-11T20:06:40Z (UTC)",
+		"Avg block : 2.000000 s (measured over the last 302,400 blocks)",
+		"Δtime : +0d 1h 0m 0s (3,600 s)",
+		"Estimated Δblk: +1,800 (rounded nearest) — 1800.000 (exact)",
+		"P5/P50/P95 : 2,001,800 / 2,001,800 / 2,001,800 (σ 0.000 s over the last 50 block intervals averaging 2.000 s, ±0 blocks from that average)",
+	} {
+		if !strings.Contains(strings.Join(strings.Fields(stdout), " "), strings.Join(strings.Fields(want), " ")) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestPredictPastTarget(t *testing.T) {
+	url := newBorNode(t, &borNode{head: 2_000_000})
+	// block 1,999,000 is at 19:06:40 less 2,000s, i.e. 18:33:20
+	stdout, stderr, err := run(t, "-rpc="+url, "-target=2024-01-11T18:33:19.5Z")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	for _, want := range []string{"1,999,000 — 2024-01-11T18:33:20Z", "1,998,999 — 2024-01-11T18:33:18Z"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestPredictJSON(t *testing.T) {
+	url := newBorNode(t, &borNode{head: 2_000_000})
+	decode := func(args ...string) targetReport {
+		t.Helper()
+		stdout, stderr, err := run(t, append([]string{"-rpc=" + url, "-format=json"}, args...)...)
+		if err != nil {
+			t.Fatalf("run: %v\n%s", err, stderr)
+		}
+		var rep targetReport
+		if err := json.Unmarshal([]byte(stdout), &rep); err != nil {
+			t.Fatalf("decode report: %v\n%s", err, stdout)
+		}
+		return rep
+	}
+	rep := decode("-target=2024-01-11T20:06:40Z", "-sample=50")
+	if rep.HeadHeight != 2_000_000 || rep.PredictedHeight != 2_001_800 || rep.DeltaBlocks != 1800 || rep.AvgSource != "recent-mean" || rep.SampledBlocks != 302_400 || rep.Rounding != "nearest" {
+		t.Errorf("report = %+v, want 2,001,800 predicted from the measured average", rep)
+	}
+	if rep.Spread == nil || rep.Spread.P5 != 2_001_800 || rep.Spread.P95 != 2_001_800 || rep.Spread.Intervals != 50 {
+		t.Errorf("spread = %+v, want 2,001,800 either way over 50 intervals", rep.Spread)
+	}
+	// -avg=2.5 predicts 1,440 blocks where the recent 2 s average gives
+	// 1,800, so the range reaches 360 blocks either way
+	rep = decode("-target=2024-01-11T20:06:40Z", "-sample=50", "-avg=2.5")
+	if sp := rep.Spread; rep.PredictedHeight != 2_001_440 || sp == nil || sp.P5 != 2_001_080 || sp.P95 != 2_001_800 || sp.RecentAvg != 2 || sp.DriftBlocks != 360 {
+		t.Errorf("spread = %+v, want 2,001,440 ±360 from the recent average", rep.Spread)
+	}
+
+	rep = decode("-target=2024-01-11T18:33:19.5Z")
+	if p := rep.Reached; p == nil || p.Height != 1_999_000 || p.PreviousHeight == nil || *p.PreviousHeight != 1_998_999 || rep.PredictedHeight != 0 {
+		t.Errorf("report = %+v, want block 1,999,000 reached and nothing predicted", rep)
+	}
+}
+
+func TestPredictRateLimited(t *testing.T) {
+	url := newBorNode(t, &borNode{head: 2_000_000, every429: 2})
+	stdout, stderr, err := run(t, "-rpc="+url, "-target=2024-01-11T20:06:40Z", "-sample=0")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if got := predicted(t, stdout); got != "2,001,800" {
+		t.Errorf("predicted %s, want 2,001,800", got)
+	}
+}
+
+func TestPredictFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		node *borNode
+		args []string
+		want string
+	}{
+		{"pruned lookback", &borNode{head: 2_000_000, pruned: 1_800_000}, nil, "header not found"},
+		{"malformed head", &borNode{head: 2_000_000, bad: map[uint64]bool{2_000_000: true}}, nil, "get timestamp for current block 2000000"},
+		{"pruned sample", &borNode{head: 2_000_000, pruned: 1_999_990}, []string{"-avg=2", "-sample=50"}, "sample block intervals"},
+		// every request is rate limited, so the flag must be checked first
+		{"bad rounding", &borNode{head: 2_000_000, every429: 1}, []string{"-rounding=up"}, `-rounding: unknown rounding mode "up"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := newBorNode(t, tt.node)
+			_, stderr, err := run(t, append([]string{"-rpc=" + url, "-target=2024-01-11T20:06:40Z"}, tt.args...)...)
+			if err == nil || !strings.Contains(stderr, tt.want) {
+				t.Errorf("run error = %v, want stderr containing %q:\n%s", err, tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestProviderKeyRedacted(t *testing.T) {
+	// The proxy refuses the connection, so the run fails on an error that
+	// quotes the provider URL
+	t.Setenv("HTTPS_PROXY", "http://127.0.0.1:1")
+	stdout, _, err := run(t, "-provider=quicknode", "-key=my-endpoint/SECRETTOKEN123", "-target=2024-01-11T20:06:40Z", "-format=json")
+	if err == nil || !strings.Contains(stdout, "https://REDACTED.matic.quiknode.pro/REDACTED/") {
+		t.Errorf("run error = %v, want the endpoint with its key redacted:\n%s", err, stdout)
+	}
+	if strings.Contains(stdout, "SECRET") || strings.Contains(stdout, "my-endpoint") {
+		t.Errorf("output leaks the provider key:\n%s", stdout)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		in, want, wantErr string
+	}{
+		{"2025-10-07T14:00:00Z", "2025-10-07T14:00:00Z", ""},
+		{" 2025-10-07T16:00:00+02:00 ", "2025-10-07T14:00:00Z", ""},
+		{"2025-10-07T14:00:00.25Z", "2025-10-07T14:00:00.25Z", ""},
+		{"2025-10-07 14:00", "", "did you mean 2025-10-07T14:00:00Z?"},
+		{"1759845600", "", "did you mean 2025-10-07T14:00:00Z?"},
+		{"2025-10-32T14:00:00Z", "", "day out of range"},
+		{"2025-10-07T14:00:00+25:00", "", "invalid time"},
+		{"2300-01-01T00:00:00Z", "", "outside the years 1970-2200"},
+		{"next tuesday", "", "unsupported time format"},
+	}
+	for _, tt := range tests {
+		got, err := parseTarget(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseTarget(%q) error = %v, want one containing %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got.Format(time.RFC3339Nano) != tt.want {
+			t.Errorf("parseTarget(%q) = %s, %v, want %s", tt.in, got.Format(time.RFC3339Nano), err, tt.want)
+		}
+	}
+}
+
+func TestCheckHorizon(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := checkHorizon(now.AddDate(1, 0, 0), now, defaultMaxHorizon); err != nil {
+		t.Errorf("a year out: %v", err)
+	}
+	err := checkHorizon(time.Date(2052, 10, 7, 14, 0, 0, 0, time.UTC), now, defaultMaxHorizon)
+	if err == nil || !strings.Contains(err.Error(), "did you mean -target=2025-10-07T14:00:00Z?") {
+		t.Errorf("mistyped year: error = %v, want the same date this year suggested", err)
+	}
+}
+
+// FuzzParseTarget checks that -target either yields a UTC time within the
+// years the deltas handle, which reads back as itself, or fails; and that a
+// suggested spelling parses as well.
+func FuzzParseTarget(f *testing.F) {
+	for _, s := range []string{"2025-12-03T21:49:11Z", " 2025-12-03T22:49:11.5+01:00 ", "2025-12-03 21:49:11", "2025-12-03", "1764798551", "1764798551000", "2025-12-32T00:00:00Z", "2025-12-03T21:49:11+25:00", "0001-01-01", "9999-12-31T23:59:59-23:59", "soon", ""} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		got, err := parseTarget(s)
+		if err != nil {
+			msg := err.Error()
+			if _, rest, ok := strings.Cut(msg, "did you mean "); ok {
+				alt, _, _ := strings.Cut(rest, "? ")
+				if _, err := parseTarget(alt); err != nil && !strings.Contains(err.Error(), "outside the years") {
+					t.Errorf("parseTarget(%q) suggests %q, which fails: %v", s, alt, err)
+				}
+			}
+			return
+		}
+		if got.Location() != time.UTC || got.Year() < 1970 || got.Year() > 2200 {
+			t.Errorf("parseTarget(%q) = %v", s, got)
+		}
+		if back, err := parseTarget(got.Format(time.RFC3339Nano)); err != nil || !back.Equal(got) {
+			t.Errorf("parseTarget(%q) = %v, which reads back as %v, %v", s, got, back, err)
+		}
+	})
+}
+
+// ntpReply answers one SNTP query on a local UDP socket with a reply from a
+// server whose clock is 10s ahead, after edit changes it, and returns the
+// socket's address.
+func ntpReply(t *testing.T, network, addr string, edit func(resp []byte)) string {
+	t.Helper()
+	conn, err := net.ListenPacket(network, addr)
+	if err != nil {
+		t.Skipf("listen %s: %v", addr, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		req := make([]byte, 48)
+		_, from, err := conn.ReadFrom(req)
+		if err != nil {
+			return
+		}
+		resp := make([]byte, 48)
+		resp[0], resp[1] = 0x24, 2 // LI=0, VN=4, Mode=4 (server), stratum 2
+		now := time.Now().Add(10 * time.Second)
+		sec := uint32(now.Unix() + 2208988800)
+		frac := uint32((uint64(now.Nanosecond()) << 32) / 1e9)
+		for _, off := range []int{32, 40} {
+			binary.BigEndian.PutUint32(resp[off:], sec)
+			binary.BigEndian.PutUint32(resp[off+4:], frac)
+		}
+		edit(resp)
+		conn.WriteTo(resp, from)
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestNTPOffset(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		addr    string
+		edit    func(resp []byte)
+		wantErr string
+	}{
+		{"ipv4", "udp4", "127.0.0.1:0", func([]byte) {}, ""},
+		{"ipv6", "udp6", "[::1]:0", func([]byte) {}, ""},
+		{"kiss-o'-death", "udp4", "127.0.0.1:0", func(resp []byte) { resp[1] = 0; copy(resp[12:], "RATE") }, `kiss-o'-death reply (stratum 0, code "RATE")`},
+		{"client mode", "udp4", "127.0.0.1:0", func(resp []byte) { resp[0] = 0x23 }, "reply has mode 3, want 4 (server)"},
+		{"no transmit timestamp", "udp4", "127.0.0.1:0", func(resp []byte) { clear(resp[40:]) }, "reply has no transmit timestamp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, err := ntpOffset(ntpReply(t, tt.network, tt.addr, tt.edit))
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ntpOffset error = %v, want %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Errorf("ntpOffset: %v", err)
+			case offset < 9*time.Second || offset > 11*time.Second:
+				t.Errorf("ntpOffset = %v, want about 10s", offset)
+			}
+		})
+	}
+}
+
+func TestNTPAddr(t *testing.T) {
+	for in, want := range map[string]string{
+		"pool.ntp.org":       "pool.ntp.org:123",
+		"pool.ntp.org:1123":  "pool.ntp.org:1123",
+		"192.0.2.1":          "192.0.2.1:123",
+		"2001:db8::1":        "[2001:db8::1]:123",
+		"[2001:db8::1]":      "[2001:db8::1]:123",
+		"[2001:db8::1]:1123": "[2001:db8::1]:1123",
+	} {
+		if got := ntpAddr(in); got != want {
+			t.Errorf("ntpAddr(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,918 @@
+// Package chainreport is chain_report.go: it reports heads, block times and
+// target estimates for every chain in a config.
+package chainreport
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/blocktime"
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+	"github.com/pratikspatil024/chain-utils/pkg/fetch"
+	"github.com/pratikspatil024/chain-utils/pkg/human"
+	"github.com/pratikspatil024/chain-utils/pkg/retry"
+)
+
+const (
+	httpTimeout = 20 * time.Second
+
+	// defaultRetryBudget is -retry-budget's default: enough to ride out a
+	// few dropped requests, not a flapping endpoint.
+	defaultRetryBudget = 20
+
+	// fetchConcurrency bounds the block requests in flight per chain.
+	fetchConcurrency = 4
+)
+
+// defaultLookbacks are the averaging windows per chain kind when the config
+// sets none: the calculators' shortest two, and about a day on Ethereum.
+var defaultLookbacks = map[string][]int64{
+	"bor":      {40000, 280000},
+	"heimdall": {10000, 100000},
+	"evm":      {7200},
+}
+
+// reportConfig is the -config file.
+type reportConfig struct {
+	// Target, when set, adds every chain's predicted height at that time.
+	// -target overrides it.
+	Target string        `json:"target"`
+	Chains []chainConfig `json:"chains"`
+}
+
+// chainConfig is one chain of the report. Bor and other EVM chains are read
+// over JSON-RPC (RPC), Heimdall over its Tendermint API (Base).
+type chainConfig struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"` // bor, heimdall or evm
+	RPC  string `json:"rpc"`
+	Base string `json:"base"`
+	// HeimdallREST gives a Bor chain milestone finality when its RPC serves
+	// neither the "finalized" nor the "safe" tag.
+	HeimdallREST string  `json:"heimdall_rest"`
+	Lookbacks    []int64 `json:"lookbacks"`
+	// Heights are target heights whose arrival is estimated.
+	Heights []int64 `json:"heights"`
+}
+
+type block struct {
+	Number    string `json:"number"`
+	Timestamp string `json:"timestamp"`
+}
+
+type statusResp struct {
+	Result struct {
+		SyncInfo struct {
+			LatestBlockHeight string `json:"latest_block_height"`
+			LatestBlockTime   string `json:"latest_block_time"`
+		} `json:"sync_info"`
+	} `json:"result"`
+}
+
+type blockResp struct {
+	Result struct {
+		Block struct {
+			Header struct {
+				Time string `json:"time"`
+			} `json:"header"`
+		} `json:"block"`
+	} `json:"result"`
+}
+
+// report is the output document.
+type report struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	Target      *time.Time    `json:"target,omitempty"`
+	Chains      []chainReport `json:"chains"`
+}
+
+type chainReport struct {
+	Name     string    `json:"name"`
+	Kind     string    `json:"kind"`
+	Endpoint string    `json:"endpoint"`
+	ChainID  uint64    `json:"chain_id,omitempty"`
+	Head     int64     `json:"head"`
+	HeadTime time.Time `json:"head_time"`
+	Averages []average `json:"averages"`
+	// Finalized is only set for JSON-RPC chains with a finality source;
+	// FinalizedBy names it.
+	Finalized         *int64   `json:"finalized,omitempty"`
+	FinalizedBy       string   `json:"finalized_by,omitempty"`
+	FinalityLag       *int64   `json:"finality_lag_blocks,omitempty"`
+	FinalityLagSecs   *float64 `json:"finality_lag_seconds,omitempty"`
+	PredictedAtTarget *int64   `json:"predicted_height_at_target,omitempty"`
+	ETAs              []eta    `json:"etas,omitempty"`
+	Error             string   `json:"error,omitempty"`
+	// Failure classifies Error for orchestration
+	Failure *failure `json:"failure,omitempty"`
+}
+
+type average struct {
+	Lookback int64   `json:"lookback"`
+	Seconds  float64 `json:"seconds"`
+}
+
+type eta struct {
+	Height  int64      `json:"height"`
+	Reached bool       `json:"reached"`
+	ETA     *time.Time `json:"eta,omitempty"`
+}
+
+// source reads one chain: its head and the time of any block.
+type source struct {
+	head   func(ctx context.Context) (int64, time.Time, error)
+	timeAt func(ctx context.Context, h int64) (time.Time, error)
+}
+
+// retries is the run's retry budget, shared by every request.
+var retries = retry.NewBudget(defaultRetryBudget, nil)
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	configPath := flag.String("config", "", "JSON file listing the chains to report on (required)")
+	targetStr := flag.String("target", "", "Target time in RFC3339 (UTC); overrides the config's target")
+	format := flag.String("format", "text", "Output format: text or json")
+	out := flag.String("out", "-", "Comma-separated report destinations: - (stdout), a file path, s3://bucket/key (credentials and endpoint from the AWS_* environment) or an http(s) URL the report is POSTed to; {time} in a path or key becomes the report time")
+	retryBudget := flag.Int("retry-budget", defaultRetryBudget, "Retries the whole run may spend across all requests before failing fast (0 never retries)")
+	flag.Parse()
+	failJSON = *format == "json"
+
+	if *retryBudget < 0 {
+		failf("-retry-budget must not be negative")
+	}
+	retries = retry.NewBudget(*retryBudget, nil)
+
+	if *configPath == "" {
+		failf("-config is required")
+	}
+	if *format != "text" && *format != "json" {
+		failf("unknown -format %q (use text or json)", *format)
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		failf("%v", err)
+	}
+	if *targetStr != "" {
+		cfg.Target = *targetStr
+	}
+	rep := report{GeneratedAt: time.Now().UTC()}
+	client := &http.Client{Timeout: httpTimeout}
+	// Destinations are checked before any chain is measured
+	var writers []reportWriter
+	for _, spec := range strings.Split(*out, ",") {
+		w, err := parseOut(spec, rep.GeneratedAt, client)
+		if err != nil {
+			failf("-out: %v", err)
+		}
+		writers = append(writers, w)
+	}
+	if cfg.Target != "" {
+		t, err := parseTarget(cfg.Target)
+		if err != nil {
+			failf("parse target time: %v", err)
+		}
+		rep.Target = &t
+	}
+
+	ctx := context.Background()
+	for _, c := range cfg.Chains {
+		cr := measure(ctx, client, c, rep.Target)
+		rep.Chains = append(rep.Chains, cr)
+	}
+
+	var buf bytes.Buffer
+	contentType := "text/plain; charset=utf-8"
+	if *format == "json" {
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			failf("encode: %v", err)
+		}
+		contentType = "application/json"
+	} else {
+		printText(&buf, rep)
+	}
+	// One failed destination doesn't keep the report from the others
+	writeFailed := false
+	for _, w := range writers {
+		if err := w.WriteReport(ctx, buf.Bytes(), contentType); err != nil {
+			failEndpoint = w.String()
+			printFailure(err, fmt.Sprintf("write report to %s: %v", w, err))
+			writeFailed = true
+		}
+	}
+
+	// Under -format=json the report already carries each chain's failure
+	failed := false
+	for _, c := range rep.Chains {
+		if c.Error != "" && !failJSON {
+			fmt.Fprintf(os.Stderr, "error: %s: %s\n", c.Name, c.Error)
+		}
+		failed = failed || c.Error != ""
+	}
+	if failed || writeFailed {
+		os.Exit(1)
+	}
+}
+
+// loadConfig reads and validates the -config file, filling in the default
+// lookbacks per kind.
+func loadConfig(path string) (reportConfig, error) {
+	var cfg reportConfig
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(cfg.Chains) == 0 {
+		return cfg, fmt.Errorf("%s: no chains", path)
+	}
+	seen := make(map[string]bool)
+	for i := range cfg.Chains {
+		c := &cfg.Chains[i]
+		if c.Name == "" {
+			return cfg, fmt.Errorf("%s: chain %d has no name", path, i+1)
+		}
+		if seen[c.Name] {
+			return cfg, fmt.Errorf("%s: chain %q is listed twice", path, c.Name)
+		}
+		seen[c.Name] = true
+		switch c.Kind {
+		case "bor", "evm":
+			if c.RPC == "" {
+				return cfg, fmt.Errorf("%s: %s needs rpc", path, c.Name)
+			}
+		case "heimdall":
+			if c.HeimdallREST != "" {
+				return cfg, fmt.Errorf("%s: %s: heimdall_rest is for bor chains", path, c.Name)
+			}
+			if c.Base == "" {
+				return cfg, fmt.Errorf("%s: %s needs base", path, c.Name)
+			}
+			c.Base = strings.TrimRight(c.Base, "/")
+		default:
+			return cfg, fmt.Errorf("%s: %s has unknown kind %q (use bor, heimdall or evm)", path, c.Name, c.Kind)
+		}
+		if len(c.Lookbacks) == 0 {
+			c.Lookbacks = defaultLookbacks[c.Kind]
+		}
+		for _, lb := range c.Lookbacks {
+			if lb < 1 {
+				return cfg, fmt.Errorf("%s: %s has lookback %d, want a positive number of blocks", path, c.Name, lb)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// measure computes every configured metric of one chain. Errors end up in
+// the chain's entry so one bad endpoint doesn't lose the rest of the report.
+func measure(ctx context.Context, client *http.Client, c chainConfig, target *time.Time) chainReport {
+	cr := chainReport{Name: c.Name, Kind: c.Kind, Endpoint: c.RPC}
+	var src source
+	if c.Kind == "heimdall" {
+		cr.Endpoint = c.Base
+		src = heimdallSource(client, c.Base)
+	} else {
+		src = evmSource(client, c.RPC)
+	}
+	err := func() error {
+		if c.Kind != "heimdall" {
+			var hex string
+			if err := ethrpc.Call(ctx, client, c.RPC, "eth_chainId", []interface{}{}, &hex, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+				return fmt.Errorf("get chain id: %w", err)
+			}
+			id, err := ethrpc.HexToUint64(hex)
+			if err != nil {
+				return fmt.Errorf("parse chain id: %w", err)
+			}
+			cr.ChainID = id
+		}
+		head, headTime, err := src.head(ctx)
+		if err != nil {
+			return fmt.Errorf("get head: %w", err)
+		}
+		cr.Head, cr.HeadTime = head, headTime
+
+		fromTimes := make([]time.Time, len(c.Lookbacks))
+		g := fetch.NewGroup(ctx, fetchConcurrency)
+		for i, lb := range c.Lookbacks {
+			g.Go(func(ctx context.Context) (err error) {
+				from := max(head-lb, 1)
+				if fromTimes[i], err = src.timeAt(ctx, from); err != nil {
+					return fmt.Errorf("get block %d: %w", from, err)
+				}
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		for i, lb := range c.Lookbacks {
+			from, fromTime := max(head-lb, 1), fromTimes[i]
+			if head == from || !headTime.After(fromTime) {
+				return fmt.Errorf("not enough history for a %d-block average", lb)
+			}
+			cr.Averages = append(cr.Averages, average{Lookback: lb, Seconds: headTime.Sub(fromTime).Seconds() / float64(head-from)})
+		}
+
+		if c.Kind != "heimdall" {
+			if fin, finTime, by, err := finalizedBlock(ctx, client, c); err == nil {
+				lag, lagSecs := head-fin, headTime.Sub(finTime).Seconds()
+				cr.Finalized, cr.FinalityLag, cr.FinalityLagSecs, cr.FinalizedBy = &fin, &lag, &lagSecs, by
+			}
+		}
+
+		// Predictions use the shortest lookback, as the calculators do
+		avg := cr.Averages[0].Seconds
+		if target != nil {
+			// Heimdall's calculator floors, the others round to nearest
+			rounding := blocktime.Nearest
+			if c.Kind == "heimdall" {
+				rounding = blocktime.Floor
+			}
+			_, blocks, err := blocktime.Blocks(target.Sub(headTime), avg, rounding)
+			if err != nil {
+				return err
+			}
+			h := head + blocks.Int64()
+			cr.PredictedAtTarget = &h
+		}
+		for _, h := range c.Heights {
+			e := eta{Height: h, Reached: h <= head}
+			if !e.Reached {
+				t := headTime.Add(blocktime.Span(h-head, avg))
+				e.ETA = &t
+			}
+			cr.ETAs = append(cr.ETAs, e)
+		}
+		return nil
+	}()
+	if err != nil {
+		f := newFailure(err, err.Error(), cr.Endpoint)
+		cr.Error, cr.Failure = f.Message, &f
+	}
+	return cr
+}
+
+// reportWriter delivers the rendered report to one -out destination.
+type reportWriter interface {
+	WriteReport(ctx context.Context, body []byte, contentType string) error
+	String() string
+}
+
+// parseOut turns one -out destination into its writer: "-" is stdout,
+// s3:// an object in S3-compatible storage, http(s):// a POST, and anything
+// else a local file. {time} in a file path or object key is replaced by the
+// report time, so scheduled runs archive side by side.
+func parseOut(spec string, at time.Time, client *http.Client) (reportWriter, error) {
+	spec = strings.ReplaceAll(strings.TrimSpace(spec), "{time}", at.UTC().Format("20060102T150405Z"))
+	switch {
+	case spec == "":
+		return nil, errors.New("empty destination")
+	case spec == "-":
+		return stdoutWriter{}, nil
+	case strings.HasPrefix(spec, "s3://"):
+		return newS3Writer(spec, client)
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return httpWriter{client: client, url: spec}, nil
+	}
+	return fileWriter{path: spec}, nil
+}
+
+type stdoutWriter struct{}
+
+func (stdoutWriter) WriteReport(_ context.Context, body []byte, _ string) error {
+	_, err := os.Stdout.Write(body)
+	return err
+}
+
+func (stdoutWriter) String() string { return "stdout" }
+
+// fileWriter replaces the file atomically, so a reader never sees half a
+// report, creating missing parent directories.
+type fileWriter struct{ path string }
+
+func (w fileWriter) WriteReport(_ context.Context, body []byte, _ string) error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), filepath.Base(w.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), w.path)
+}
+
+func (w fileWriter) String() string { return w.path }
+
+// httpWriter POSTs the report, e.g. to a webhook or an archiving service.
+type httpWriter struct {
+	client *http.Client
+	url    string
+}
+
+func (w httpWriter) WriteReport(ctx context.Context, body []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return doUpload(w.client, req)
+}
+
+func (w httpWriter) String() string { return w.url }
+
+// s3Writer PUTs the report as an object into S3 or S3-compatible storage
+// (MinIO, Cloudflare R2, ...), configured through the standard AWS
+// environment variables. Requests are path-style, which every
+// S3-compatible store accepts, and signed with Signature Version 4.
+type s3Writer struct {
+	client            *http.Client
+	endpoint          *url.URL
+	region            string
+	bucket, key       string
+	accessKey, secret string
+	sessionToken      string
+}
+
+func newS3Writer(spec string, client *http.Client) (*s3Writer, error) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(spec, "s3://"), "/")
+	if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return nil, fmt.Errorf("%s: want s3://bucket/key", spec)
+	}
+	w := &s3Writer{
+		client:       client,
+		bucket:       bucket,
+		key:          key,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secret:       os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		region:       cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+	}
+	if w.accessKey == "" || w.secret == "" {
+		return nil, fmt.Errorf("%s: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY", spec)
+	}
+	endpoint := cmp.Or(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL"), "https://s3."+w.region+".amazonaws.com")
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%s: invalid S3 endpoint %q", spec, endpoint)
+	}
+	w.endpoint = u
+	return w, nil
+}
+
+func (w *s3Writer) WriteReport(ctx context.Context, body []byte, contentType string) error {
+	u := *w.endpoint
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + w.bucket + "/" + w.key
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	signV4(req, body, w.region, "s3", w.accessKey, w.secret, w.sessionToken, time.Now())
+	return doUpload(w.client, req)
+}
+
+func (w *s3Writer) String() string { return "s3://" + w.bucket + "/" + w.key }
+
+// doUpload sends req and turns a non-2xx answer into an error carrying the
+// start of the response body, where stores explain the rejection.
+func doUpload(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, clip(strings.TrimSpace(string(msg))))
+	}
+	return nil
+}
+
+// signV4 signs req with AWS Signature Version 4 over the host, the
+// x-amz-* headers it sets and every header already on req.
+func signV4(req *http.Request, body []byte, region, service, accessKey, secret, sessionToken string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		awsEscapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	canonSum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonSum[:])
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{day, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+", SignedHeaders="+signed+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// awsEscapePath percent-encodes every byte of p but the unreserved ones
+// and "/", as SigV4 canonical URIs require.
+func awsEscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, strings.ReplaceAll(url.QueryEscape(k), "+", "%20")+"="+strings.ReplaceAll(url.QueryEscape(v), "+", "%20"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func printText(w io.Writer, rep report) {
+	fmt.Fprintf(w, "Generated     : %s\n", rep.GeneratedAt.Format(time.RFC3339))
+	if rep.Target != nil {
+		fmt.Fprintf(w, "Target time   : %s (UTC)\n", rep.Target.Format(time.RFC3339))
+	}
+	for _, c := range rep.Chains {
+		fmt.Fprintf(w, "\n== %s (%s) ==\n", c.Name, c.Kind)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "Endpoint\t%s\n", c.Endpoint)
+		if c.Error != "" {
+			fmt.Fprintf(tw, "Error\t%s\n", c.Error)
+			tw.Flush()
+			continue
+		}
+		if c.ChainID != 0 {
+			fmt.Fprintf(tw, "Chain id\t%d\n", c.ChainID)
+		}
+		fmt.Fprintf(tw, "Head\t%s at %s\n", human.Commas(c.Head), c.HeadTime.Format(time.RFC3339))
+		for _, a := range c.Averages {
+			fmt.Fprintf(tw, "Avg (last %s)\t%.6f s\n", human.Commas(a.Lookback), a.Seconds)
+		}
+		if c.Finalized != nil {
+			fmt.Fprintf(tw, "Finalized\t%s (%s blocks, %s behind head, by %s)\n", human.Commas(*c.Finalized), human.Commas(*c.FinalityLag), time.Duration(*c.FinalityLagSecs*float64(time.Second)), c.FinalizedBy)
+		}
+		if c.PredictedAtTarget != nil {
+			fmt.Fprintf(tw, "Height at target\t%s\n", human.Commas(*c.PredictedAtTarget))
+		}
+		for _, e := range c.ETAs {
+			if e.Reached {
+				fmt.Fprintf(tw, "ETA %s\treached\n", human.Commas(e.Height))
+				continue
+			}
+			fmt.Fprintf(tw, "ETA %s\t%s (in %s)\n", human.Commas(e.Height), e.ETA.Format(time.RFC3339), human.DHMS(time.Until(*e.ETA)))
+		}
+		tw.Flush()
+	}
+}
+
+func evmSource(client *http.Client, rpcURL string) source {
+	return source{
+		head: func(ctx context.Context) (int64, time.Time, error) {
+			return getEVMBlock(ctx, client, rpcURL, "latest")
+		},
+		timeAt: func(ctx context.Context, h int64) (time.Time, error) {
+			_, t, err := getEVMBlock(ctx, client, rpcURL, fmt.Sprintf("0x%x", h))
+			return t, err
+		},
+	}
+}
+
+func heimdallSource(client *http.Client, base string) source {
+	return source{
+		head: func(ctx context.Context) (int64, time.Time, error) {
+			var sr statusResp
+			if err := getJSON(ctx, client, base+"/status", &sr); err != nil {
+				return 0, time.Time{}, fmt.Errorf("status: %w", err)
+			}
+			h, err := strconv.ParseInt(sr.Result.SyncInfo.LatestBlockHeight, 10, 64)
+			if err != nil {
+				return 0, time.Time{}, fmt.Errorf("parse latest height: %w", err)
+			}
+			t, err := time.Parse(time.RFC3339Nano, sr.Result.SyncInfo.LatestBlockTime)
+			if err != nil {
+				return 0, time.Time{}, fmt.Errorf("parse latest time: %w", err)
+			}
+			return h, t.UTC(), nil
+		},
+		timeAt: func(ctx context.Context, h int64) (time.Time, error) {
+			var br blockResp
+			if err := getJSON(ctx, client, fmt.Sprintf("%s/block?height=%d", base, h), &br); err != nil {
+				return time.Time{}, err
+			}
+			t, err := time.Parse(time.RFC3339Nano, br.Result.Block.Header.Time)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("parse time of block %d: %w", h, err)
+			}
+			return t.UTC(), nil
+		},
+	}
+}
+
+// finalizedBlock returns the finalized block of a JSON-RPC chain and what
+// marked it: the "finalized" tag, else the "safe" tag, else for Bor the
+// end of the latest milestone on c.HeimdallREST.
+func finalizedBlock(ctx context.Context, client *http.Client, c chainConfig) (int64, time.Time, string, error) {
+	var errs []error
+	for _, tag := range []string{"finalized", "safe"} {
+		h, t, err := getEVMBlock(ctx, client, c.RPC, tag)
+		if err == nil {
+			return h, t, tag + " tag", nil
+		}
+		errs = append(errs, fmt.Errorf("%s tag: %w", tag, err))
+	}
+	if c.Kind == "bor" && c.HeimdallREST != "" {
+		var resp struct {
+			Milestone struct {
+				EndBlock json.Number `json:"end_block"`
+			} `json:"milestone"`
+			Result struct {
+				EndBlock json.Number `json:"end_block"`
+			} `json:"result"`
+		}
+		err := getJSON(ctx, client, strings.TrimRight(c.HeimdallREST, "/")+"/milestones/latest", &resp)
+		end := resp.Milestone.EndBlock
+		if end == "" {
+			end = resp.Result.EndBlock
+		}
+		var h int64
+		if err == nil {
+			h, err = end.Int64()
+		}
+		if err == nil {
+			var t time.Time
+			if h, t, err = getEVMBlock(ctx, client, c.RPC, fmt.Sprintf("0x%x", h)); err == nil {
+				return h, t, "Heimdall milestone", nil
+			}
+		}
+		errs = append(errs, fmt.Errorf("milestone: %w", err))
+	}
+	return 0, time.Time{}, "", errors.Join(errs...)
+}
+
+func getEVMBlock(ctx context.Context, client *http.Client, rpcURL, tag string) (int64, time.Time, error) {
+	var b *block
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_getBlockByNumber", []interface{}{tag, false}, &b, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+		return 0, time.Time{}, err
+	}
+	if b == nil || b.Number == "" || b.Timestamp == "" {
+		return 0, time.Time{}, fmt.Errorf("empty block/timestamp for %s", tag)
+	}
+	h, err := ethrpc.HexToUint64(b.Number)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	ts, err := ethrpc.HexToUint64(b.Timestamp)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return int64(h), time.Unix(int64(ts), 0).UTC(), nil
+}
+
+func parseTarget(s string) (time.Time, error) {
+	// RFC3339Nano also accepts times without fractional seconds
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s))
+	var pe *time.ParseError
+	switch {
+	case errors.As(err, &pe) && pe.Message != "":
+		// Well formed but out of range, e.g. a +25:00 offset or day 32
+		return time.Time{}, fmt.Errorf("invalid time %q%s", clip(s), pe.Message)
+	case err != nil:
+		if alt := suggestTime(s); alt != "" {
+			return time.Time{}, fmt.Errorf("unsupported time format %q; did you mean %s? (use RFC3339/RFC3339Nano)", clip(s), alt)
+		}
+		return time.Time{}, fmt.Errorf("unsupported time format %q (use RFC3339/RFC3339Nano, e.g. 2025-10-07T14:00:00Z)", clip(s))
+	}
+	// Durations saturate about 292 years out, which would skew every delta
+	if y := t.UTC().Year(); y < 1970 || y > 2200 {
+		return time.Time{}, fmt.Errorf("time %q is outside the years 1970-2200", clip(s))
+	}
+	return t.UTC(), nil
+}
+
+// suggestTime returns the RFC3339 time a near miss most likely means, e.g.
+// a missing zone, a space for the T or Unix seconds, or "" when s looks
+// like no time. Times without a zone are taken as UTC, as everywhere else.
+func suggestTime(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339Nano)
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case n >= 1e9 && n < 1e10:
+			return time.Unix(n, 0).UTC().Format(time.RFC3339)
+		case n >= 1e12 && n < 1e13:
+			return time.UnixMilli(n).UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return ""
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(client, req, out)
+}
+
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d for %s", resp.StatusCode, req.URL)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+// failJSON is set by -format=json: failures are then printed on stdout as
+// a JSON failure, for orchestration, instead of as text on stderr.
+var failJSON bool
+
+// failEndpoint is the endpoint the run talks to. It is set once requests
+// start, so a failure without one is an input error.
+var failEndpoint string
+
+// failure describes an error for machines: a stable code, its category,
+// the endpoint involved and whether rerunning the same command may succeed.
+type failure struct {
+	Code      string `json:"code"`
+	Category  string `json:"category"` // input, network, provider, data or runtime
+	Message   string `json:"message"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	Retryable bool   `json:"retryable"`
+}
+
+// newFailure classifies err, whose text is msg, met talking to endpoint.
+// Most errors reach here flattened into text, so the text is matched too.
+func newFailure(err error, msg, endpoint string) failure {
+	f := failure{Message: msg, Endpoint: endpoint}
+	var ne net.Error
+	lower := strings.ToLower(msg)
+	has := func(subs ...string) bool {
+		for _, s := range subs {
+			if strings.Contains(lower, s) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case endpoint == "":
+		f.Code, f.Category = "invalid_input", "input"
+	case has("retry budget exhausted"):
+		f.Code, f.Category, f.Retryable = "retry_budget_exhausted", "network", true
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout(), has("timeout", "deadline exceeded"):
+		f.Code, f.Category, f.Retryable = "timeout", "network", true
+	case has("http 429", "too many requests", "rate limit"):
+		f.Code, f.Category, f.Retryable = "rate_limited", "provider", true
+	case has("http 5"):
+		f.Code, f.Category, f.Retryable = "server_error", "provider", true
+	case has("http 4"):
+		f.Code, f.Category = "request_rejected", "provider"
+	case has("implausible"):
+		// A stale head or a lagging node usually catches up
+		f.Code, f.Category, f.Retryable = "implausible_data", "data", true
+	case has("strict:", "invalid character", "cannot unmarshal", "unexpected end of json"):
+		f.Code, f.Category = "malformed_response", "provider"
+	case errors.As(err, &ne), has("connection refused", "connection reset", "no such host", "eof"):
+		f.Code, f.Category, f.Retryable = "unreachable", "network", true
+	default:
+		f.Code, f.Category = "failed", "runtime"
+	}
+	return f
+}
+
+// printFailure reports a failure of the run: as JSON on stdout under
+// -format=json, otherwise as text on stderr.
+func printFailure(err error, msg string) {
+	if !failJSON {
+		fmt.Fprintf(os.Stderr, "error: %s\n", msg)
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(struct {
+		Error failure `json:"error"`
+	}{newFailure(err, msg, failEndpoint)})
+}
+
+func failf(format string, a ...any) {
+	// The last error among the arguments is the one to classify
+	var err error
+	for _, v := range a {
+		if e, ok := v.(error); ok {
+			err = e
+		}
+	}
+	printFailure(err, fmt.Sprintf(format, a...))
+	os.Exit(1)
+}
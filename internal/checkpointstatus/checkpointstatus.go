@@ -0,0 +1,599 @@
+// Package checkpointstatus is checkpoint_status.go: it shows the latest Bor
+// checkpoint on L1 and how far it lags the Bor head.
+package checkpointstatus
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/blocktime"
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+	"github.com/pratikspatil024/chain-utils/pkg/human"
+)
+
+const (
+	// mainnetRootChain is the RootChainProxy that Heimdall submits Polygon PoS
+	// checkpoints to on Ethereum mainnet.
+	mainnetRootChain = "0x86E4Dc95c7FBdBf52e33D563BbDB00823894C287"
+	defaultRESTBase  = "https://heimdall-api.polygon.technology"
+	defaultBorRPC    = "https://polygon-rpc.com"
+	httpTimeout      = 20 * time.Second
+
+	// maxPages stops a paginated Heimdall query whose server keeps returning
+	// a next_key; mainnet's full checkpoint history is well under this many
+	// pages at any sane -page-size.
+	maxPages = 100000
+
+	// maxDeposits is the RootChain header block id stride: checkpoint n is
+	// stored under header block n*maxDeposits.
+	maxDeposits = 10000
+
+	// RootChain function selectors (first 4 bytes of keccak256 of the signature)
+	selCurrentHeaderBlock = "0xec7e4855" // currentHeaderBlock()
+	selGetLastChildBlock  = "0xb87e1b66" // getLastChildBlock()
+	selHeaderBlocks       = "0x41539d4a" // headerBlocks(uint256)
+)
+
+// l1Checkpoint is a checkpoint as recorded by the RootChain contract.
+type l1Checkpoint struct {
+	Number     int64
+	StartBlock int64
+	EndBlock   int64
+	CreatedAt  time.Time
+	Proposer   string
+	Root       string
+}
+
+// heimdallCheckpoint is the same checkpoint as acknowledged by Heimdall.
+type heimdallCheckpoint struct {
+	Number   int64
+	EndBlock int64
+	Time     time.Time
+}
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	l1RPC := flag.String("l1-rpc", "", "Ethereum JSON-RPC endpoint the RootChain contract is read from (required)")
+	rootChain := flag.String("root-chain", mainnetRootChain, "RootChain (proxy) contract address")
+	restBase := flag.String("heimdall-rest", defaultRESTBase, "Heimdall REST API to cross-check against (empty skips the check)")
+	height := flag.Int64("height", -1, "Estimate when this Bor block will be checkpointed to L1")
+	borRPC := flag.String("rpc", defaultBorRPC, "Polygon (Bor) JSON-RPC endpoint, used with -height")
+	avgSecs := flag.Float64("avg", 0, "Bor average block time in seconds for -height (default: measured over the last 40k blocks)")
+	sample := flag.Int64("sample", 10, "Recent checkpoints whose cadence drives the -height estimate")
+	history := flag.Bool("history", false, "Summarise every checkpoint Heimdall has acknowledged (Heimdall v2 REST, paginated)")
+	pageSize := flag.Int("page-size", 1000, "Checkpoints requested per page with -history; the server may cap it lower")
+	flag.Parse()
+
+	if *l1RPC == "" {
+		failf("-l1-rpc is required")
+	}
+	ctx := context.Background()
+	client := &http.Client{Timeout: httpTimeout}
+
+	// 1) The default contract only exists on Ethereum mainnet
+	var chainHex string
+	if err := ethrpc.Call(ctx, client, *l1RPC, "eth_chainId", []interface{}{}, &chainHex); err != nil {
+		failf("get L1 chain id: %v", err)
+	}
+	chainID, err := ethrpc.HexToUint64(chainHex)
+	if err != nil {
+		failf("parse L1 chain id: %v", err)
+	}
+	if strings.EqualFold(*rootChain, mainnetRootChain) && chainID != 1 {
+		failf("-l1-rpc serves chain id %d; pass the RootChain address for that network with -root-chain", chainID)
+	}
+
+	// 2) Read the latest checkpoint straight from L1
+	l1, err := latestL1Checkpoint(ctx, client, *l1RPC, *rootChain)
+	if err != nil {
+		failf("read RootChain %s: %v", *rootChain, err)
+	}
+	fmt.Printf("RootChain     : %s (L1 chain id %d)\n", *rootChain, chainID)
+	fmt.Printf("Checkpoint    : %s (header block %s)\n", human.Commas(l1.Number), human.Commas(l1.Number*maxDeposits))
+	fmt.Printf("Bor blocks    : %s → %s\n", human.Commas(l1.StartBlock), human.Commas(l1.EndBlock))
+	fmt.Printf("Submitted     : %s (%s ago)\n", l1.CreatedAt.Format(time.RFC3339), time.Since(l1.CreatedAt).Round(time.Second))
+	fmt.Printf("Proposer      : %s\n", l1.Proposer)
+	fmt.Printf("Root hash     : %s\n", l1.Root)
+	fmt.Printf("\nLast checkpointed Bor block on L1: %s\n", human.Commas(l1.EndBlock))
+
+	if *restBase != "" {
+		crossCheck(ctx, client, *restBase, l1)
+	}
+	if *history {
+		if *restBase == "" {
+			failf("-history needs -heimdall-rest")
+		}
+		if *pageSize < 1 {
+			failf("-page-size must be at least 1")
+		}
+		checkpointHistory(ctx, client, *restBase, *pageSize)
+	}
+	if *height >= 0 {
+		if *sample < 2 {
+			failf("-sample must be at least 2")
+		}
+		estimateCheckpoint(ctx, client, *l1RPC, *rootChain, *borRPC, l1, *height, *avgSecs, *sample)
+	}
+}
+
+// crossCheck compares the latest L1 checkpoint with what Heimdall has
+// acknowledged.
+func crossCheck(ctx context.Context, client *http.Client, restBase string, l1 l1Checkpoint) {
+	ack, err := heimdallCheckpointCount(ctx, client, restBase)
+	if err != nil {
+		failf("heimdall checkpoint count: %v", err)
+	}
+	hc, err := heimdallCheckpointByNumber(ctx, client, restBase, min(ack, l1.Number))
+	if err != nil {
+		failf("heimdall checkpoint: %v", err)
+	}
+	fmt.Printf("\nHeimdall      : %s acknowledged, checkpoint %s ends at Bor block %s\n", human.Commas(ack), human.Commas(hc.Number), human.Commas(hc.EndBlock))
+	switch {
+	case hc.Number == l1.Number && hc.EndBlock != l1.EndBlock:
+		failf("checkpoint %d ends at Bor block %d on L1 but %d on Heimdall; the Heimdall API is forked or serving another network", l1.Number, l1.EndBlock, hc.EndBlock)
+	case ack < l1.Number:
+		fmt.Printf("Cross-check   : Heimdall has not acknowledged the latest %d L1 checkpoint(s) yet; the API may be lagging\n", l1.Number-ack)
+	case ack > l1.Number:
+		fmt.Printf("Cross-check   : Heimdall acknowledged %d checkpoint(s) beyond L1; -l1-rpc may be lagging or -root-chain is for another network\n", ack-l1.Number)
+	default:
+		fmt.Println("Cross-check   : L1 and Heimdall agree")
+	}
+}
+
+// checkpointHistory walks Heimdall's whole checkpoint list page by page and
+// summarises how often checkpoints landed and how many Bor blocks each
+// covered. It fails rather than report on a partial list: the page count
+// must add up to the total the first page announced and to the ack count.
+func checkpointHistory(ctx context.Context, client *http.Client, restBase string, pageSize int) {
+	type checkpoint struct {
+		ID         json.Number `json:"id"`
+		StartBlock json.Number `json:"start_block"`
+		EndBlock   json.Number `json:"end_block"`
+		Timestamp  json.Number `json:"timestamp"`
+	}
+	list, total, pages, err := getAllPages[checkpoint](ctx, client, restBase+"/checkpoints/list", "checkpoint_list", pageSize)
+	if err != nil {
+		failf("heimdall checkpoint list: %v", err)
+	}
+	ack, err := heimdallCheckpointCount(ctx, client, restBase)
+	if err != nil {
+		failf("heimdall checkpoint count: %v", err)
+	}
+	switch {
+	case total > 0 && int64(len(list)) != total:
+		failf("heimdall announced %d checkpoints but %d page(s) held %d; the list was truncated", total, pages, len(list))
+	case int64(len(list)) < ack:
+		failf("heimdall acknowledged %d checkpoints but %d page(s) held only %d; the list was truncated", ack, pages, len(list))
+	}
+	if len(list) < 2 {
+		failf("heimdall lists %d checkpoint(s); need at least 2 for a history", len(list))
+	}
+
+	cps := make([]heimdallCheckpoint, 0, len(list))
+	var blocks []int64
+	var gaps int
+	for i, c := range list {
+		id, err1 := c.ID.Int64()
+		start, err2 := c.StartBlock.Int64()
+		end, err3 := c.EndBlock.Int64()
+		sec, err4 := c.Timestamp.Int64()
+		if err := errors.Join(err1, err2, err3, err4); err != nil {
+			failf("checkpoint at list position %d: %v", i, err)
+		}
+		cps = append(cps, heimdallCheckpoint{Number: id, EndBlock: end, Time: time.Unix(sec, 0).UTC()})
+		blocks = append(blocks, end-start+1)
+		if i > 0 && start != cps[i-1].EndBlock+1 {
+			gaps++
+		}
+	}
+	var intervals []float64
+	for i := 1; i < len(cps); i++ {
+		intervals = append(intervals, cps[i].Time.Sub(cps[i-1].Time).Seconds())
+	}
+	sort.Float64s(intervals)
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+	var sumBlocks int64
+	for _, b := range blocks {
+		sumBlocks += b
+	}
+	first, last := cps[0], cps[len(cps)-1]
+	span := last.Time.Sub(first.Time)
+
+	fmt.Printf("\nHeimdall checkpoint history (read in %s page(s)):\n", human.Commas(int64(pages)))
+	fmt.Printf("Checkpoints   : %s (#%s → #%s)\n", human.Commas(int64(len(cps))), human.Commas(first.Number), human.Commas(last.Number))
+	fmt.Printf("Period        : %s → %s (%s)\n", first.Time.Format(time.RFC3339), last.Time.Format(time.RFC3339), span.Round(time.Second))
+	fmt.Printf("Interval      : mean %s, median %s, p95 %s, max %s\n",
+		secsDuration(span.Seconds()/float64(len(intervals))), secsDuration(percentile(intervals, 0.5)),
+		secsDuration(percentile(intervals, 0.95)), secsDuration(intervals[len(intervals)-1]))
+	fmt.Printf("Bor blocks    : %s covered, mean %.1f, min %s, max %s per checkpoint\n",
+		human.Commas(sumBlocks), float64(sumBlocks)/float64(len(blocks)), human.Commas(blocks[0]), human.Commas(blocks[len(blocks)-1]))
+	if gaps > 0 {
+		fmt.Printf("Continuity    : %d checkpoint(s) do not start right after the previous one ended\n", gaps)
+	}
+}
+
+// percentile reads the p-th quantile from sorted by nearest rank.
+func percentile(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+func secsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Second)
+}
+
+// estimateCheckpoint predicts when Bor block height lands on L1. Over the
+// last sample checkpoints it measures how often checkpoints are submitted,
+// how many Bor blocks each covers and how long a block waits from its
+// production to its checkpoint's submission. The block is expected in the
+// checkpoint that first covers it at that cadence, and never before it has
+// been produced and waited the shortest latency observed.
+func estimateCheckpoint(ctx context.Context, client *http.Client, l1RPC, contract, borRPC string, last l1Checkpoint, height int64, avgSecs float64, sample int64) {
+	fmt.Printf("\nCheckpoint ETA for Bor block %s:\n", human.Commas(height))
+	if height <= last.EndBlock {
+		cp, err := findL1Checkpoint(ctx, client, l1RPC, contract, last, height)
+		if err != nil {
+			failf("find checkpoint of block %d: %v", height, err)
+		}
+		fmt.Printf("  status      : already checkpointed in checkpoint %s (Bor blocks %s → %s)\n", human.Commas(cp.Number), human.Commas(cp.StartBlock), human.Commas(cp.EndBlock))
+		fmt.Printf("  landed      : %s\n", cp.CreatedAt.Format(time.RFC3339))
+		return
+	}
+	if last.Number <= sample {
+		failf("only %d checkpoints on L1, need more than -sample=%d", last.Number, sample)
+	}
+
+	// Cadence of the last sample checkpoints
+	cps := []l1Checkpoint{last}
+	for n := last.Number - 1; n >= last.Number-sample; n-- {
+		cp, err := l1CheckpointByNumber(ctx, client, l1RPC, contract, n)
+		if err != nil {
+			failf("read checkpoint %d: %v", n, err)
+		}
+		cps = append(cps, cp)
+	}
+	minGap, maxGap := time.Duration(math.MaxInt64), time.Duration(0)
+	for i := 0; i+1 < len(cps); i++ {
+		gap := cps[i].CreatedAt.Sub(cps[i+1].CreatedAt)
+		minGap, maxGap = min(minGap, gap), max(maxGap, gap)
+	}
+	oldest := cps[len(cps)-1]
+	interval := last.CreatedAt.Sub(oldest.CreatedAt) / time.Duration(sample)
+	perCheckpoint := float64(last.EndBlock-oldest.EndBlock) / float64(sample)
+
+	// Latency from a checkpoint's last block to its submission
+	minLatency := time.Duration(math.MaxInt64)
+	for _, cp := range cps[:len(cps)-1] {
+		ts, err := borBlockTime(ctx, client, borRPC, cp.EndBlock)
+		if err != nil {
+			failf("get Bor block %d: %v", cp.EndBlock, err)
+		}
+		minLatency = min(minLatency, cp.CreatedAt.Sub(ts))
+	}
+
+	// When the block itself is produced
+	head, err := borHead(ctx, client, borRPC)
+	if err != nil {
+		failf("get Bor head: %v", err)
+	}
+	headTime, err := borBlockTime(ctx, client, borRPC, head)
+	if err != nil {
+		failf("get Bor block %d: %v", head, err)
+	}
+	produced := headTime
+	if height <= head {
+		if produced, err = borBlockTime(ctx, client, borRPC, height); err != nil {
+			failf("get Bor block %d: %v", height, err)
+		}
+	} else {
+		if avgSecs <= 0 {
+			from := max(head-40000, 1)
+			fromTime, err := borBlockTime(ctx, client, borRPC, from)
+			if err != nil {
+				failf("get Bor block %d: %v", from, err)
+			}
+			avgSecs = headTime.Sub(fromTime).Seconds() / float64(head-from)
+		}
+		produced = headTime.Add(blocktime.Span(height-head, avgSecs))
+	}
+
+	needed := int64(math.Ceil(float64(height-last.EndBlock) / perCheckpoint))
+	floor := produced.Add(max(minLatency, 0))
+	eta := maxTime(last.CreatedAt.Add(time.Duration(needed)*interval), floor)
+	earliest := maxTime(last.CreatedAt.Add(time.Duration(needed)*minGap), floor)
+	latest := maxTime(last.CreatedAt.Add(time.Duration(needed)*maxGap), floor)
+
+	if height <= head {
+		fmt.Printf("  produced    : %s (block exists)\n", produced.Format(time.RFC3339))
+	} else {
+		fmt.Printf("  produced    : ~%s (Bor head %s, avg %.6f s)\n", produced.Format(time.RFC3339), human.Commas(head), avgSecs)
+	}
+	fmt.Printf("  cadence     : a checkpoint every %s (%s – %s) covering ~%.0f Bor blocks, over the last %d\n",
+		interval.Round(time.Second), minGap.Round(time.Second), maxGap.Round(time.Second), perCheckpoint, sample)
+	fmt.Printf("  min latency : %s from a block to its checkpoint on L1\n", minLatency.Round(time.Second))
+	fmt.Printf("  checkpoint  : ~%s (%d after the latest)\n", human.Commas(last.Number+needed), needed)
+	if wait := time.Until(eta); wait >= 0 {
+		fmt.Printf("  lands on L1 : ~%s (in %s)\n", eta.Format(time.RFC3339), wait.Round(time.Minute))
+	} else {
+		fmt.Printf("  lands on L1 : overdue since ~%s; the next checkpoint should cover it\n", eta.Format(time.RFC3339))
+	}
+	fmt.Printf("  window      : %s – %s\n", earliest.Format(time.RFC3339), latest.Format(time.RFC3339))
+}
+
+// findL1Checkpoint binary-searches the RootChain header blocks for the
+// checkpoint covering Bor block height.
+func findL1Checkpoint(ctx context.Context, client *http.Client, rpcURL, contract string, last l1Checkpoint, height int64) (l1Checkpoint, error) {
+	lo, hi := int64(1), last.Number
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		cp, err := l1CheckpointByNumber(ctx, client, rpcURL, contract, mid)
+		if err != nil {
+			return l1Checkpoint{}, err
+		}
+		if cp.EndBlock >= height {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	if lo == last.Number {
+		return last, nil
+	}
+	return l1CheckpointByNumber(ctx, client, rpcURL, contract, lo)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// latestL1Checkpoint reads currentHeaderBlock, getLastChildBlock and the
+// header block they point at from the RootChain contract.
+func latestL1Checkpoint(ctx context.Context, client *http.Client, rpcURL, contract string) (l1Checkpoint, error) {
+	words, err := ethCall(ctx, client, rpcURL, contract, selCurrentHeaderBlock)
+	if err != nil {
+		return l1Checkpoint{}, fmt.Errorf("currentHeaderBlock: %w", err)
+	}
+	// currentHeaderBlock is the id the next checkpoint will get
+	next := words[0]
+	if next.Cmp(big.NewInt(maxDeposits)) < 0 {
+		return l1Checkpoint{}, errors.New("no checkpoints submitted yet")
+	}
+	number := new(big.Int).Div(next, big.NewInt(maxDeposits)).Int64() - 1
+	cp, err := l1CheckpointByNumber(ctx, client, rpcURL, contract, number)
+	if err != nil {
+		return l1Checkpoint{}, err
+	}
+
+	words, err = ethCall(ctx, client, rpcURL, contract, selGetLastChildBlock)
+	if err != nil {
+		return l1Checkpoint{}, fmt.Errorf("getLastChildBlock: %w", err)
+	}
+	if last := words[0].Int64(); last != cp.EndBlock {
+		return l1Checkpoint{}, fmt.Errorf("getLastChildBlock is %d but checkpoint %d ends at %d; a checkpoint landed between the calls, rerun", last, number, cp.EndBlock)
+	}
+	return cp, nil
+}
+
+// l1CheckpointByNumber reads checkpoint number from the RootChain header
+// blocks.
+func l1CheckpointByNumber(ctx context.Context, client *http.Client, rpcURL, contract string, number int64) (l1Checkpoint, error) {
+	headerID := number * maxDeposits
+	words, err := ethCall(ctx, client, rpcURL, contract, selHeaderBlocks+fmt.Sprintf("%064x", headerID))
+	if err != nil {
+		return l1Checkpoint{}, fmt.Errorf("headerBlocks(%d): %w", headerID, err)
+	}
+	if len(words) < 5 {
+		return l1Checkpoint{}, fmt.Errorf("headerBlocks(%d) returned %d words, want 5", headerID, len(words))
+	}
+	if words[3].Sign() == 0 {
+		return l1Checkpoint{}, fmt.Errorf("checkpoint %d is not on L1", number)
+	}
+	return l1Checkpoint{
+		Number:     number,
+		Root:       fmt.Sprintf("0x%064x", words[0]),
+		StartBlock: words[1].Int64(),
+		EndBlock:   words[2].Int64(),
+		CreatedAt:  time.Unix(words[3].Int64(), 0).UTC(),
+		Proposer:   fmt.Sprintf("0x%040x", words[4]),
+	}, nil
+}
+
+// ethCall calls a view function and splits the ABI-encoded result into
+// 32-byte words.
+func ethCall(ctx context.Context, client *http.Client, rpcURL, to, data string) ([]*big.Int, error) {
+	var out string
+	call := map[string]string{"to": to, "data": data}
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_call", []interface{}{call, "latest"}, &out); err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(strings.TrimPrefix(out, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("decode result: %w", err)
+	}
+	if len(raw) == 0 || len(raw)%32 != 0 {
+		return nil, fmt.Errorf("unexpected %d-byte result (is %s a RootChain contract?)", len(raw), to)
+	}
+	words := make([]*big.Int, len(raw)/32)
+	for i := range words {
+		words[i] = new(big.Int).SetBytes(raw[32*i : 32*i+32])
+	}
+	return words, nil
+}
+
+// heimdallCheckpointCount returns how many checkpoints Heimdall has
+// acknowledged. Both the v1 ({"result": ...}) and v2 response shapes are
+// accepted.
+func heimdallCheckpointCount(ctx context.Context, client *http.Client, base string) (int64, error) {
+	var resp struct {
+		AckCount json.Number `json:"ack_count"`
+		Result   struct {
+			Result json.Number `json:"result"`
+		} `json:"result"`
+	}
+	if err := getJSON(ctx, client, base+"/checkpoints/count", &resp); err != nil {
+		return 0, err
+	}
+	n := resp.AckCount
+	if n == "" {
+		n = resp.Result.Result
+	}
+	return n.Int64()
+}
+
+func heimdallCheckpointByNumber(ctx context.Context, client *http.Client, base string, number int64) (heimdallCheckpoint, error) {
+	type checkpoint struct {
+		EndBlock  json.Number `json:"end_block"`
+		Timestamp json.Number `json:"timestamp"`
+	}
+	var resp struct {
+		Checkpoint checkpoint `json:"checkpoint"`
+		Result     checkpoint `json:"result"`
+	}
+	if err := getJSON(ctx, client, fmt.Sprintf("%s/checkpoints/%d", base, number), &resp); err != nil {
+		return heimdallCheckpoint{}, err
+	}
+	cp := resp.Checkpoint
+	if cp.EndBlock == "" {
+		cp = resp.Result
+	}
+	end, err := cp.EndBlock.Int64()
+	if err != nil {
+		return heimdallCheckpoint{}, fmt.Errorf("checkpoint %d end block: %w", number, err)
+	}
+	sec, _ := cp.Timestamp.Int64()
+	return heimdallCheckpoint{Number: number, EndBlock: end, Time: time.Unix(sec, 0).UTC()}, nil
+}
+
+// getAllPages collects every item of a Cosmos gRPC-gateway list endpoint
+// (Heimdall v2) under field, following pagination.next_key until the
+// server stops returning one. Gateways cap pagination.limit at their own
+// maximum, so a single request would otherwise stop silently at the first
+// page. It also returns pagination.total from the first page (0 when the
+// server does not count) and how many pages were read.
+func getAllPages[T any](ctx context.Context, client *http.Client, endpoint, field string, limit int) ([]T, int64, int, error) {
+	var all []T
+	var total int64
+	seen := map[string]bool{}
+	key := ""
+	for page := 1; page <= maxPages; page++ {
+		q := url.Values{}
+		q.Set("pagination.limit", fmt.Sprint(limit))
+		if key == "" {
+			q.Set("pagination.count_total", "true")
+		} else {
+			q.Set("pagination.key", key)
+		}
+		var resp map[string]json.RawMessage
+		if err := getJSON(ctx, client, endpoint+"?"+q.Encode(), &resp); err != nil {
+			return nil, 0, page, err
+		}
+		raw, ok := resp[field]
+		if !ok {
+			return nil, 0, page, fmt.Errorf("%s: no %q in the response; is this a Heimdall v2 REST API?", endpoint, field)
+		}
+		var items []T
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, 0, page, fmt.Errorf("%s page %d: %w", endpoint, page, err)
+		}
+		all = append(all, items...)
+
+		var p struct {
+			NextKey *string     `json:"next_key"`
+			Total   json.Number `json:"total"`
+		}
+		if rp, ok := resp["pagination"]; ok {
+			if err := json.Unmarshal(rp, &p); err != nil {
+				return nil, 0, page, fmt.Errorf("%s page %d pagination: %w", endpoint, page, err)
+			}
+		}
+		if page == 1 && p.Total != "" {
+			total, _ = p.Total.Int64()
+		}
+		if p.NextKey == nil || *p.NextKey == "" {
+			return all, total, page, nil
+		}
+		if seen[*p.NextKey] {
+			return nil, 0, page, fmt.Errorf("%s page %d: next_key %q repeats an earlier page", endpoint, page, *p.NextKey)
+		}
+		seen[*p.NextKey] = true
+		key = *p.NextKey
+	}
+	return nil, 0, maxPages, fmt.Errorf("%s: still paging after %d pages", endpoint, maxPages)
+}
+
+func borHead(ctx context.Context, client *http.Client, rpcURL string) (int64, error) {
+	var hex string
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_blockNumber", []interface{}{}, &hex); err != nil {
+		return 0, err
+	}
+	h, err := ethrpc.HexToUint64(hex)
+	return int64(h), err
+}
+
+func borBlockTime(ctx context.Context, client *http.Client, rpcURL string, height int64) (time.Time, error) {
+	var b *struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_getBlockByNumber", []interface{}{fmt.Sprintf("0x%x", height), false}, &b); err != nil {
+		return time.Time{}, err
+	}
+	if b == nil || b.Timestamp == "" {
+		return time.Time{}, fmt.Errorf("empty block/timestamp for height %d", height)
+	}
+	ts, err := ethrpc.HexToUint64(b.Timestamp)
+	return time.Unix(int64(ts), 0).UTC(), err
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(client, req, out)
+}
+
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d for %s", resp.StatusCode, req.URL)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+func failf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", a...)
+	os.Exit(1)
+}
@@ -0,0 +1,248 @@
+package checkpointstatus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the status end to end through its
+// flags and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("CHECKPOINT_STATUS_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// The test chain: Bor block h is at genesis + h seconds, and checkpoint n
+// covers Bor blocks (n-1)*1000 → n*1000-1 and lands on L1 at genesis +
+// n*1000 + 300s, so every checkpoint comes 1000s after the previous one and
+// 301s after its last block. Fifty checkpoints are on L1.
+const (
+	genesisTime = 1_700_000_000
+	checkpoints = 50
+)
+
+func at(seconds int64) time.Time { return time.Unix(genesisTime+seconds, 0).UTC() }
+
+func cpStart(n int64) int64       { return (n - 1) * 1000 }
+func cpEnd(n int64) int64         { return n*1000 - 1 }
+func cpCreated(n int64) time.Time { return at(n*1000 + 300) }
+func word(v int64) string         { return fmt.Sprintf("%064x", v) }
+func hexTime(t time.Time) string  { return fmt.Sprintf("0x%x", t.Unix()) }
+
+type rpcReq struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params []any           `json:"params"`
+}
+
+func rpcBody(r *http.Request) rpcReq {
+	var req rpcReq
+	json.NewDecoder(r.Body).Decode(&req)
+	return req
+}
+
+func reply(w http.ResponseWriter, req rpcReq, result any) {
+	json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result})
+}
+
+// l1Node is an Ethereum endpoint with the RootChain contract at
+// mainnetRootChain.
+type l1Node struct{ chainID uint64 }
+
+func (n l1Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := rpcBody(r)
+	switch req.Method {
+	case "eth_chainId":
+		reply(w, req, fmt.Sprintf("0x%x", n.chainID))
+	case "eth_call":
+		call := req.Params[0].(map[string]any)
+		data := call["data"].(string)
+		switch {
+		case !strings.EqualFold(call["to"].(string), mainnetRootChain):
+			reply(w, req, "0x")
+		case data == selCurrentHeaderBlock:
+			reply(w, req, "0x"+word((checkpoints+1)*maxDeposits))
+		case data == selGetLastChildBlock:
+			reply(w, req, "0x"+word(cpEnd(checkpoints)))
+		case strings.HasPrefix(data, selHeaderBlocks):
+			id, _ := new(big.Int).SetString(data[len(selHeaderBlocks):], 16)
+			num := id.Int64() / maxDeposits
+			if num < 1 || num > checkpoints {
+				reply(w, req, "0x"+strings.Repeat(word(0), 5))
+				return
+			}
+			reply(w, req, "0x"+word(num)+word(cpStart(num))+word(cpEnd(num))+word(cpCreated(num).Unix())+word(0xbeef))
+		}
+	}
+}
+
+// borNode is the Bor endpoint, with its head at 50,500.
+type borNode struct{}
+
+func (borNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := rpcBody(r)
+	switch req.Method {
+	case "eth_blockNumber":
+		reply(w, req, "0xc544")
+	case "eth_getBlockByNumber":
+		h, _ := strconv.ParseInt(strings.TrimPrefix(req.Params[0].(string), "0x"), 16, 64)
+		reply(w, req, map[string]string{"timestamp": hexTime(at(h))})
+	}
+}
+
+// heimdallNode is the Heimdall v2 REST API. ack is its ack count; fork
+// moves the end of every checkpoint; drop leaves the last page out of the
+// list.
+type heimdallNode struct {
+	ack        int64
+	fork, drop bool
+}
+
+func (n heimdallNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch p := r.URL.Path; {
+	case p == "/checkpoints/count":
+		fmt.Fprintf(w, `{"ack_count":"%d"}`, n.ack)
+	case p == "/checkpoints/list":
+		q := r.URL.Query()
+		limit, _ := strconv.ParseInt(q.Get("pagination.limit"), 10, 64)
+		from, _ := strconv.ParseInt(q.Get("pagination.key"), 10, 64)
+		from = max(from, 1)
+		var items []string
+		for c := from; c < from+limit && c <= n.ack; c++ {
+			items = append(items, fmt.Sprintf(`{"id":"%d","start_block":"%d","end_block":"%d","timestamp":"%d"}`, c, cpStart(c), cpEnd(c), cpCreated(c).Unix()))
+		}
+		next := ""
+		if from+limit <= n.ack && !(n.drop && from+2*limit > n.ack) {
+			next = strconv.FormatInt(from+limit, 10)
+		}
+		fmt.Fprintf(w, `{"checkpoint_list":[%s],"pagination":{"next_key":%q,"total":"%d"}}`, strings.Join(items, ","), next, n.ack)
+	case strings.HasPrefix(p, "/checkpoints/"):
+		num, _ := strconv.ParseInt(strings.TrimPrefix(p, "/checkpoints/"), 10, 64)
+		end := cpEnd(num)
+		if n.fork {
+			end += 7
+		}
+		fmt.Fprintf(w, `{"checkpoint":{"end_block":"%d","timestamp":"%d"}}`, end, cpCreated(num).Unix())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newServer(t *testing.T, h http.Handler) string {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs checkpoint_status.go with args and returns its stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "CHECKPOINT_STATUS_RUN_MAIN=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+func TestStatus(t *testing.T) {
+	l1 := newServer(t, l1Node{chainID: 1})
+	bor := newServer(t, borNode{})
+	heimdall := newServer(t, heimdallNode{ack: checkpoints})
+
+	// Block 50,800 isn't produced yet: at 1s a block it comes 300s after
+	// the head, needs one checkpoint past #50 and lands with it at 51,300s,
+	// well after its 301s latency
+	stdout, stderr, err := run(t, "-l1-rpc="+l1, "-heimdall-rest="+heimdall, "-rpc="+bor, "-height=50800", "-history", "-page-size=20")
+	if err != nil {
+		t.Fatalf("status: %v\n%s", err, stderr)
+	}
+	for _, s := range []string{
+		"RootChain     : " + mainnetRootChain + " (L1 chain id 1)",
+		"Checkpoint    : 50 (header block 500,000)",
+		"Bor blocks    : 49,000 → 49,999",
+		"Submitted     : " + cpCreated(50).Format(time.RFC3339),
+		"Proposer      : 0x000000000000000000000000000000000000beef",
+		"Heimdall      : 50 acknowledged, checkpoint 50 ends at Bor block 49,999",
+		"Cross-check   : L1 and Heimdall agree",
+		"Heimdall checkpoint history (read in 3 page(s)):",
+		"Checkpoints   : 50 (#1 → #50)",
+		"Interval      : mean 16m40s, median 16m40s, p95 16m40s, max 16m40s",
+		"Bor blocks    : 50,000 covered, mean 1000.0, min 1,000, max 1,000 per checkpoint",
+		"produced    : ~" + at(50800).Format(time.RFC3339) + " (Bor head 50,500, avg 1.000000 s)",
+		"cadence     : a checkpoint every 16m40s (16m40s – 16m40s) covering ~1000 Bor blocks, over the last 10",
+		"min latency : 5m1s",
+		"checkpoint  : ~51 (1 after the latest)",
+		"lands on L1 : overdue since ~" + at(51300).Format(time.RFC3339),
+	} {
+		if !strings.Contains(stdout, s) {
+			t.Errorf("stdout lacks %q:\n%s", s, stdout)
+		}
+	}
+	if strings.Contains(stdout, "Continuity") {
+		t.Errorf("contiguous checkpoints reported as gapped:\n%s", stdout)
+	}
+
+	// A block already on L1 is found by binary search over the header blocks
+	stdout, stderr, err = run(t, "-l1-rpc="+l1, "-heimdall-rest=", "-height=12345")
+	if err != nil {
+		t.Fatalf("checkpointed block: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "already checkpointed in checkpoint 13 (Bor blocks 12,000 → 12,999)") || !strings.Contains(stdout, "landed      : "+cpCreated(13).Format(time.RFC3339)) {
+		t.Errorf("stdout:\n%s", stdout)
+	}
+	if strings.Contains(stdout, "Heimdall") {
+		t.Errorf("cross-checked with -heimdall-rest empty:\n%s", stdout)
+	}
+
+	// A Heimdall two checkpoints behind is only a lagging API
+	stdout, _, err = run(t, "-l1-rpc="+l1, "-heimdall-rest="+newServer(t, heimdallNode{ack: 48}))
+	if err != nil || !strings.Contains(stdout, "Heimdall has not acknowledged the latest 2 L1 checkpoint(s) yet") {
+		t.Errorf("lagging Heimdall: %v\n%s", err, stdout)
+	}
+}
+
+func TestStatusFailures(t *testing.T) {
+	l1 := newServer(t, l1Node{chainID: 1})
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "-l1-rpc is required"},
+		{[]string{"-l1-rpc=" + newServer(t, l1Node{chainID: 11155111})}, "-l1-rpc serves chain id 11155111; pass the RootChain address"},
+		{[]string{"-l1-rpc=" + l1, "-root-chain=0x0000000000000000000000000000000000000001"}, "unexpected 0-byte result (is 0x0000000000000000000000000000000000000001 a RootChain contract?)"},
+		{[]string{"-l1-rpc=" + l1, "-heimdall-rest=" + newServer(t, heimdallNode{ack: checkpoints, fork: true})}, "checkpoint 50 ends at Bor block 49999 on L1 but 50006 on Heimdall"},
+		{[]string{"-l1-rpc=" + l1, "-heimdall-rest=" + newServer(t, heimdallNode{ack: checkpoints, drop: true}), "-history", "-page-size=20"}, "heimdall announced 50 checkpoints but 2 page(s) held 40; the list was truncated"},
+		{[]string{"-l1-rpc=" + l1, "-heimdall-rest=", "-history"}, "-history needs -heimdall-rest"},
+		{[]string{"-l1-rpc=" + l1, "-heimdall-rest=", "-height=60000", "-sample=1"}, "-sample must be at least 2"},
+	}
+	for _, tt := range tests {
+		if _, stderr, err := run(t, tt.args...); err == nil || !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: %v\n%s", tt.args, err, stderr)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for p, want := range map[float64]float64{0: 1, 0.5: 5, 0.95: 10, 1: 10} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("percentile(%v) = %v, want %v", p, got, want)
+		}
+	}
+}
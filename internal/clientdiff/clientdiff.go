@@ -0,0 +1,360 @@
+// Package clientdiff is client_diff.go: it compares the blocks that several
+// RPC endpoints return at the same heights.
+package clientdiff
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+	"github.com/pratikspatil024/chain-utils/pkg/fetch"
+	"github.com/pratikspatil024/chain-utils/pkg/human"
+	"github.com/pratikspatil024/chain-utils/pkg/retry"
+)
+
+const (
+	defaultBorRPC = "https://polygon-rpc.com"
+	httpTimeout   = 20 * time.Second
+
+	// reorgSafetyDepth keeps the compared heights below the unsettled tip,
+	// where endpoints legitimately disagree for a few blocks.
+	reorgSafetyDepth = 64
+
+	// defaultRetryBudget is -retry-budget's default: enough to ride out a
+	// few dropped requests, not a flapping endpoint.
+	defaultRetryBudget = 20
+
+	// fetchConcurrency bounds the block requests in flight at once, across
+	// all endpoints.
+	fetchConcurrency = 4
+
+	// defaultFields are the header fields the estimates depend on, plus the
+	// ones that identify which fork an endpoint follows.
+	defaultFields = "hash,parentHash,timestamp,miner,difficulty,extraData,stateRoot,transactionsRoot,receiptsRoot,gasUsed,baseFeePerGas"
+)
+
+// endpoint is one RPC under comparison, with the client it reports.
+type endpoint struct {
+	URL       string
+	Client    string
+	ChainID   uint64
+	Head      int64
+	Finalized int64 // -1 when the endpoint lacks the "finalized" tag
+}
+
+// discrepancy is one field of one block on which the endpoints disagree.
+type discrepancy struct {
+	Height int64
+	Field  string
+	Values []string // one per endpoint, in -rpc order
+}
+
+// retries is the run's retry budget, shared by every request.
+var retries = retry.NewBudget(defaultRetryBudget, nil)
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	rpcList := flag.String("rpc", "", "Comma-separated Bor JSON-RPC endpoints to compare, ideally backed by different clients (at least 2)")
+	heightsStr := flag.String("heights", "", "Comma-separated block heights to compare (default: -lookbacks below the common head)")
+	lookbacksStr := flag.String("lookbacks", "0,40000,280000,560000,1120000", "Distances below the common head to compare when -heights is empty (the calculators' lookbacks)")
+	fieldsStr := flag.String("fields", defaultFields, "Comma-separated block fields to compare")
+	maxFinalizedSpread := flag.Int64("max-finalized-spread", 64, "Blocks the endpoints' finalized tags may differ by before it is reported")
+	retryBudget := flag.Int("retry-budget", defaultRetryBudget, "Retries the whole run may spend across all requests before failing fast (0 never retries)")
+	flag.Parse()
+
+	if *retryBudget < 0 {
+		failf("-retry-budget must not be negative")
+	}
+	retries = retry.NewBudget(*retryBudget, nil)
+
+	var urls []string
+	for _, u := range strings.Split(*rpcList, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) < 2 {
+		failf("-rpc needs at least 2 endpoints")
+	}
+	var fields []string
+	for _, f := range strings.Split(*fieldsStr, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		failf("-fields is empty")
+	}
+	if *maxFinalizedSpread < 0 {
+		failf("-max-finalized-spread must not be negative")
+	}
+	ctx := context.Background()
+	client := &http.Client{Timeout: httpTimeout}
+
+	// 1) Identify each endpoint; they must serve the same chain to be comparable
+	eps := make([]endpoint, len(urls))
+	for i, u := range urls {
+		ep, err := describe(ctx, client, u)
+		if err != nil {
+			failf("%s: %v", u, err)
+		}
+		eps[i] = ep
+	}
+	for _, ep := range eps[1:] {
+		if ep.ChainID != eps[0].ChainID {
+			failf("%s serves chain id %d but %s serves %d", ep.URL, ep.ChainID, eps[0].URL, eps[0].ChainID)
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tEndpoint\tClient\tHead\tFinalized")
+	commonHead := eps[0].Head
+	for i, ep := range eps {
+		fin := "no tag"
+		if ep.Finalized >= 0 {
+			fin = human.Commas(ep.Finalized)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", i+1, ep.URL, ep.Client, human.Commas(ep.Head), fin)
+		commonHead = min(commonHead, ep.Head)
+	}
+	tw.Flush()
+	fmt.Printf("\nChain id      : %d\n", eps[0].ChainID)
+
+	// 2) Pick the heights every endpoint has and that can no longer reorg
+	var heights []int64
+	if *heightsStr != "" {
+		for _, s := range strings.Split(*heightsStr, ",") {
+			h, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err != nil || h < 0 {
+				failf("invalid height %q in -heights", s)
+			}
+			if h > commonHead {
+				failf("height %d is above the lowest endpoint head %d", h, commonHead)
+			}
+			heights = append(heights, h)
+		}
+	} else {
+		top := commonHead - reorgSafetyDepth
+		// Defaults that reach past a young chain's genesis are skipped,
+		// lookbacks asked for explicitly must all be compared
+		lookbacksSet := false
+		flag.Visit(func(f *flag.Flag) { lookbacksSet = lookbacksSet || f.Name == "lookbacks" })
+		for _, s := range strings.Split(*lookbacksStr, ",") {
+			lb, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err != nil || lb < 0 {
+				failf("invalid lookback %q in -lookbacks", s)
+			}
+			if top-lb >= 0 {
+				heights = append(heights, top-lb)
+			} else if lookbacksSet {
+				failf("lookback %d reaches past genesis: the compared head is %d (%d below the lowest endpoint head), so the longest possible lookback is %d", lb, top, reorgSafetyDepth, max(top, 0))
+			}
+		}
+		// The finalized block the lowest endpoint agrees on
+		if f := minFinalized(eps); f >= 0 {
+			heights = append(heights, f)
+		}
+	}
+	if len(heights) == 0 {
+		failf("no heights to compare")
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	heights = dedupe(heights)
+	fmt.Printf("Heights       : %s\n", joinHeights(heights))
+	fmt.Printf("Fields        : %s\n\n", strings.Join(fields, ", "))
+
+	// 3) Fetch every height from every endpoint, then diff the requested
+	// fields height by height
+	fetched := make([][]map[string]json.RawMessage, len(heights))
+	g := fetch.NewGroup(ctx, fetchConcurrency)
+	for k, h := range heights {
+		fetched[k] = make([]map[string]json.RawMessage, len(eps))
+		for i, ep := range eps {
+			g.Go(func(ctx context.Context) (err error) {
+				if fetched[k][i], err = blockFields(ctx, client, ep.URL, h); err != nil {
+					return fmt.Errorf("%s: block %d: %w", ep.URL, h, err)
+				}
+				return nil
+			})
+		}
+	}
+	if err := g.Wait(); err != nil {
+		failf("%v", err)
+	}
+	var diffs []discrepancy
+	for k, h := range heights {
+		blocks := fetched[k]
+		for _, f := range fields {
+			vals := make([]string, len(eps))
+			same := true
+			for i, b := range blocks {
+				vals[i] = fieldValue(b, f)
+				if vals[i] != vals[0] {
+					same = false
+				}
+			}
+			if !same {
+				diffs = append(diffs, discrepancy{Height: h, Field: f, Values: vals})
+			}
+		}
+	}
+
+	spread := finalizedSpread(eps)
+	if spread > *maxFinalizedSpread {
+		fmt.Printf("Finalized tags differ by %s blocks (max %s); estimates anchored on \"finalized\" depend on the endpoint\n\n", human.Commas(spread), human.Commas(*maxFinalizedSpread))
+	}
+	if len(diffs) == 0 {
+		fmt.Printf("No discrepancies in %d fields across %d blocks.\n", len(fields), len(heights))
+		if spread > *maxFinalizedSpread {
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Printf("Discrepancies : %d\n", len(diffs))
+	tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := []string{"Height", "Field"}
+	for i := range eps {
+		header = append(header, fmt.Sprintf("#%d", i+1))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, d := range diffs {
+		fmt.Fprintln(tw, strings.Join(append([]string{human.Commas(d.Height), d.Field}, d.Values...), "\t"))
+	}
+	tw.Flush()
+	os.Exit(1)
+}
+
+// describe reads the client version, chain id, head and finalized block of
+// one endpoint.
+func describe(ctx context.Context, client *http.Client, rpcURL string) (endpoint, error) {
+	ep := endpoint{URL: rpcURL, Finalized: -1}
+	if err := ethrpc.Call(ctx, client, rpcURL, "web3_clientVersion", []interface{}{}, &ep.Client, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+		// Some providers hide it; the comparison still works without
+		ep.Client = "unknown"
+	}
+	var hex string
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_chainId", []interface{}{}, &hex, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+		return ep, fmt.Errorf("get chain id: %w", err)
+	}
+	id, err := ethrpc.HexToUint64(hex)
+	if err != nil {
+		return ep, fmt.Errorf("parse chain id: %w", err)
+	}
+	ep.ChainID = id
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_blockNumber", []interface{}{}, &hex, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+		return ep, fmt.Errorf("get head: %w", err)
+	}
+	head, err := ethrpc.HexToUint64(hex)
+	if err != nil {
+		return ep, fmt.Errorf("parse head: %w", err)
+	}
+	ep.Head = int64(head)
+	var fin *struct {
+		Number string `json:"number"`
+	}
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_getBlockByNumber", []interface{}{"finalized", false}, &fin, ethrpc.WithRetryGate(retries.Spend)); err == nil && fin != nil {
+		if f, err := ethrpc.HexToUint64(fin.Number); err == nil {
+			ep.Finalized = int64(f)
+		}
+	}
+	return ep, nil
+}
+
+// blockFields returns the raw JSON fields of a block header so that fields
+// one client omits or encodes differently show up instead of decoding to
+// the same zero value.
+func blockFields(ctx context.Context, client *http.Client, rpcURL string, height int64) (map[string]json.RawMessage, error) {
+	var b map[string]json.RawMessage
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_getBlockByNumber", []interface{}{fmt.Sprintf("0x%x", height), false}, &b, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, fmt.Errorf("block not found")
+	}
+	return b, nil
+}
+
+// fieldValue renders a field for comparison. Hex quantities are compared by
+// value, since clients differ in leading zeros and letter case without
+// disagreeing about the block.
+func fieldValue(b map[string]json.RawMessage, field string) string {
+	raw, ok := b[field]
+	if !ok {
+		return "(missing)"
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return string(raw)
+	}
+	if strings.HasPrefix(s, "0x") && len(s) <= 2+16 {
+		if v, err := ethrpc.HexToUint64(s); err == nil {
+			return strconv.FormatUint(v, 10)
+		}
+	}
+	return strings.ToLower(s)
+}
+
+func minFinalized(eps []endpoint) int64 {
+	f := int64(-1)
+	for _, ep := range eps {
+		if ep.Finalized >= 0 && (f < 0 || ep.Finalized < f) {
+			f = ep.Finalized
+		}
+	}
+	return f
+}
+
+// finalizedSpread is how far apart the endpoints' finalized tags are. An
+// endpoint without the tag counts as 0 so it is always reported.
+func finalizedSpread(eps []endpoint) int64 {
+	lo, hi := eps[0].Finalized, eps[0].Finalized
+	for _, ep := range eps[1:] {
+		lo, hi = min(lo, ep.Finalized), max(hi, ep.Finalized)
+	}
+	if lo < 0 {
+		return hi + 1
+	}
+	return hi - lo
+}
+
+func dedupe(hs []int64) []int64 {
+	out := hs[:0]
+	for i, h := range hs {
+		if i == 0 || h != hs[i-1] {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+func joinHeights(hs []int64) string {
+	parts := make([]string, len(hs))
+	for i, h := range hs {
+		parts[i] = human.Commas(h)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+func failf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", a...)
+	os.Exit(1)
+}
@@ -0,0 +1,204 @@
+package clientdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the diff end to end through its flags
+// and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("CLIENT_DIFF_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// node is one endpoint of a chain whose blocks are derived from their
+// height. forkAt gives the block a different state root from that height
+// on; padded encodes gasUsed with leading zeros, as some clients do.
+type node struct {
+	client          string
+	chainID         uint64
+	head, finalized int64 // finalized -1 for an endpoint without the tag
+	forkAt          int64
+	padded          bool
+	failures        int // requests answered 503 before the endpoint recovers
+
+	mu sync.Mutex
+}
+
+func (n *node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	if n.failures > 0 {
+		n.failures--
+		n.mu.Unlock()
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+		return
+	}
+	n.mu.Unlock()
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params []any           `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "web3_clientVersion":
+		if n.client == "" {
+			resp["error"] = map[string]any{"code": -32601, "message": "method not found"}
+		} else {
+			resp["result"] = n.client
+		}
+	case "eth_chainId":
+		resp["result"] = fmt.Sprintf("0x%x", n.chainID)
+	case "eth_blockNumber":
+		resp["result"] = fmt.Sprintf("0x%x", n.head)
+	case "eth_getBlockByNumber":
+		tag := req.Params[0].(string)
+		if tag == "finalized" {
+			if n.finalized < 0 {
+				resp["error"] = map[string]any{"code": -32602, "message": "invalid block number"}
+			} else {
+				resp["result"] = map[string]string{"number": fmt.Sprintf("0x%x", n.finalized)}
+			}
+			break
+		}
+		h, _ := strconv.ParseInt(strings.TrimPrefix(tag, "0x"), 16, 64)
+		stateRoot := fmt.Sprintf("0x%064x", h)
+		if n.forkAt > 0 && h >= n.forkAt {
+			stateRoot = fmt.Sprintf("0x%064x", h+1)
+		}
+		gasUsed := fmt.Sprintf("0x%x", h%7)
+		if n.padded {
+			gasUsed = fmt.Sprintf("0x%04X", h%7)
+		}
+		resp["result"] = map[string]string{"hash": fmt.Sprintf("0x%064x", h), "stateRoot": stateRoot, "gasUsed": gasUsed}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func newServer(t *testing.T, h http.Handler) string {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs client_diff.go with args and returns its stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "CLIENT_DIFF_RUN_MAIN=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+func TestDiff(t *testing.T) {
+	bor := &node{client: "bor/v2.0.0", chainID: 137, head: 1000, finalized: 990}
+	erigon := &node{client: "erigon/3.0.0", chainID: 137, head: 1010, finalized: 980, padded: true}
+	forked := &node{chainID: 137, head: 1005, finalized: 900, forkAt: 900}
+	urls := []string{newServer(t, bor), newServer(t, erigon), newServer(t, forked)}
+
+	// The common head is 1000, so lookbacks 0 and 100 are 936 and 836,
+	// plus the lowest finalized block, 900. Erigon's padded gasUsed is the
+	// same number; the fork's state roots from 900 on are not.
+	stdout, stderr, err := run(t, "-rpc="+strings.Join(urls, ","), "-lookbacks=0,100", "-fields=hash,stateRoot,gasUsed,miner")
+	if err == nil {
+		t.Error("exited 0 with discrepancies")
+	}
+	for _, r := range []string{
+		`1\s+` + regexp.QuoteMeta(urls[0]) + `\s+bor/v2\.0\.0\s+1,000\s+990`,
+		`3\s+` + regexp.QuoteMeta(urls[2]) + `\s+unknown\s+1,005\s+900`,
+		`Chain id      : 137`,
+		`Heights       : 836, 900, 936`,
+		`Finalized tags differ by 90 blocks \(max 64\)`,
+		`Discrepancies : 2`,
+		`900\s+stateRoot\s+0x0+384\s+0x0+384\s+0x0+385`,
+		`936\s+stateRoot\s+0x0+3a8\s+0x0+3a8\s+0x0+3a9`,
+	} {
+		if !regexp.MustCompile(r).MatchString(stdout) {
+			t.Errorf("no line %q:\n%s", r, stdout)
+		}
+	}
+	// miner is missing everywhere alike, so it is no discrepancy
+	if strings.Contains(stdout, "gasUsed  ") || strings.Contains(stdout, "miner  ") {
+		t.Errorf("reported a field the endpoints agree on:\n%s%s", stdout, stderr)
+	}
+
+	// Agreeing endpoints, fetched through a few dropped requests
+	flaky := &node{client: "bor/v2.0.0", chainID: 137, head: 1000, finalized: 990, failures: 2}
+	stdout, stderr, err = run(t, "-rpc="+urls[0]+","+newServer(t, flaky), "-heights=10,500,10")
+	if err != nil {
+		t.Fatalf("agreeing endpoints: %v\n%s%s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "Heights       : 10, 500") || !strings.Contains(stdout, "No discrepancies in 11 fields across 2 blocks.") {
+		t.Errorf("stdout:\n%s", stdout)
+	}
+	// Same with no retries left: a missing client version is shrugged
+	// off, but the chain id it can't get fails the run
+	flaky.failures = 2
+	if _, stderr, err := run(t, "-rpc="+urls[0]+","+newServer(t, flaky), "-heights=10", "-retry-budget=0"); err == nil || !strings.Contains(stderr, "get chain id") || !strings.Contains(stderr, "HTTP 503") {
+		t.Errorf("-retry-budget=0: %v\n%s", err, stderr)
+	}
+}
+
+func TestDiffInput(t *testing.T) {
+	a := newServer(t, &node{chainID: 137, head: 1000, finalized: 990})
+	b := newServer(t, &node{chainID: 80002, head: 1000, finalized: 990})
+	young := newServer(t, &node{chainID: 137, head: 100, finalized: 90})
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-rpc=" + a}, "-rpc needs at least 2 endpoints"},
+		{[]string{"-rpc=" + a + "," + a, "-fields= "}, "-fields is empty"},
+		{[]string{"-rpc=" + a + "," + a, "-retry-budget=-1"}, "-retry-budget must not be negative"},
+		{[]string{"-rpc=" + a + "," + b}, "serves chain id 80002 but"},
+		{[]string{"-rpc=" + a + "," + young, "-heights=500"}, "height 500 is above the lowest endpoint head 100"},
+		{[]string{"-rpc=" + a + "," + a, "-heights=x"}, `invalid height "x"`},
+		// The head less the reorg depth is 36, so a 40-block lookback
+		// asked for is refused rather than quietly dropped
+		{[]string{"-rpc=" + a + "," + young, "-lookbacks=0,40"}, "lookback 40 reaches past genesis: the compared head is 36"},
+	}
+	for _, tt := range tests {
+		if _, stderr, err := run(t, tt.args...); err == nil || !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: %v\n%s", tt.args, err, stderr)
+		}
+	}
+}
+
+func TestFieldValue(t *testing.T) {
+	b := map[string]json.RawMessage{
+		"gasUsed":   json.RawMessage(`"0x00FF"`),
+		"hash":      json.RawMessage(`"0xABCDEF0123456789ABCDEF0123456789"`),
+		"uncles":    json.RawMessage(`[]`),
+		"extraData": json.RawMessage(`"0xDEAD"`),
+	}
+	for field, want := range map[string]string{
+		"gasUsed":   "255",
+		"hash":      "0xabcdef0123456789abcdef0123456789",
+		"uncles":    "[]",
+		"extraData": "57005",
+		"miner":     "(missing)",
+	} {
+		if got := fieldValue(b, field); got != want {
+			t.Errorf("fieldValue(%s) = %q, want %q", field, got, want)
+		}
+	}
+}
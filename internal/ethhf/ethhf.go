@@ -0,0 +1,505 @@
+// Package ethhf is eth_hf_slot_calculator.go: it predicts the Ethereum slot
+// and epoch of a hardfork time.
+package ethhf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+	"github.com/pratikspatil024/chain-utils/pkg/human"
+)
+
+const (
+	defaultRPC     = "https://ethereum-rpc.publicnode.com"
+	httpTimeout    = 20 * time.Second
+	secondsPerSlot = 12
+	slotsPerEpoch  = 32
+
+	// defaultMaxHorizon bounds how far -target may lie from now; forks are
+	// scheduled months, not decades, ahead.
+	defaultMaxHorizon = 2 * 365 * 24 * time.Hour
+)
+
+// beaconNetwork is what the slot schedule of a post-merge network is derived
+// from. Slot s starts at Genesis + 12*s. Events are the network's scheduled
+// upgrades, which a planned Polygon activation should not coincide with.
+type beaconNetwork struct {
+	ChainID uint64
+	Genesis int64
+	Events  []l1Event
+}
+
+// l1Event is a notable L1 moment, starting with the first slot of Epoch.
+type l1Event struct {
+	Name  string
+	Epoch int64
+}
+
+var networks = map[string]beaconNetwork{
+	"mainnet": {ChainID: 1, Genesis: 1606824023, Events: []l1Event{
+		{"Capella", 194048}, {"Deneb", 269568}, {"Electra", 364032}, {"Fulu", 411392}, {"BPO1", 412672}, {"BPO2", 419072},
+	}},
+	"sepolia": {ChainID: 11155111, Genesis: 1655733600, Events: []l1Event{
+		{"Capella", 56832}, {"Deneb", 132608}, {"Electra", 222464}, {"Fulu", 272640},
+	}},
+	"holesky": {ChainID: 17000, Genesis: 1695902400, Events: []l1Event{
+		{"Capella", 256}, {"Deneb", 29696}, {"Electra", 115968}, {"Fulu", 165120},
+	}},
+	"hoodi": {ChainID: 560048, Genesis: 1742213400, Events: []l1Event{
+		{"Electra", 2048}, {"Fulu", 50688},
+	}},
+}
+
+type block struct {
+	Number    string `json:"number"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	rpcURL := flag.String("rpc", defaultRPC, "Ethereum execution-layer JSON-RPC endpoint")
+	targetStr := flag.String("target", "2025-12-03T21:49:11Z", "Target time in RFC3339 or RFC3339Nano (UTC)")
+	network := flag.String("network", "mainnet", "Beacon network whose slot schedule applies: mainnet, sepolia, holesky or hoodi")
+	genesis := flag.Int64("genesis", 0, "Beacon genesis time in unix seconds (default: the -network's)")
+	sampleSize := flag.Int("sample", 1800, "Recent blocks used for missed-slot statistics (1800 is about 6h)")
+	batch := flag.Int("batch", 100, "Blocks per JSON-RPC batch request while sampling")
+	confidence := flag.Float64("confidence", 0.9, "Probability covered by the predicted height range (0 < p < 1)")
+	beaconURL := flag.String("beacon", "", "Beacon node API (e.g. https://ethereum-beacon-api.publicnode.com) whose genesis, spec and fork schedule anchor the calculation")
+	window := flag.Duration("window", 6*time.Hour, "Half-width of the planned activation window around -target checked for collisions with L1 events")
+	maxHorizon := flag.Duration("max-horizon", defaultMaxHorizon, "Reject targets further than this from now, most often a mistyped year (0 disables the check)")
+	flag.Parse()
+
+	net, ok := networks[*network]
+	if !ok {
+		failf("unknown -network %q (use mainnet, sepolia, holesky or hoodi)", *network)
+	}
+	if *genesis > 0 {
+		net.Genesis = *genesis
+	}
+	if *sampleSize < 1 || *batch < 1 {
+		failf("-sample and -batch must be positive")
+	}
+	if *confidence <= 0 || *confidence >= 1 {
+		failf("-confidence must be between 0 and 1, got %v", *confidence)
+	}
+	if *window < 0 {
+		failf("-window must not be negative")
+	}
+	target, err := parseTarget(*targetStr)
+	if err != nil {
+		failf("parse target time: %v", err)
+	}
+	if err := checkHorizon(target, time.Now(), *maxHorizon); err != nil {
+		failf("%v", err)
+	}
+
+	ctx := context.Background()
+	client := &http.Client{Timeout: httpTimeout}
+
+	// 0) A beacon node is authoritative for the schedule and its forks
+	var beaconHead int64 = -1
+	if *beaconURL != "" {
+		b, err := getBeaconSchedule(ctx, client, strings.TrimSuffix(*beaconURL, "/"))
+		if err != nil {
+			failf("beacon API: %v", err)
+		}
+		if *genesis == 0 && b.Genesis != net.Genesis {
+			failf("beacon genesis %s differs from -network=%s's %s; pick the matching -network or pass -genesis", time.Unix(b.Genesis, 0).UTC().Format(time.RFC3339), *network, time.Unix(net.Genesis, 0).UTC().Format(time.RFC3339))
+		}
+		net.Genesis = b.Genesis
+		net.Events = mergeEvents(net.Events, b.Forks)
+		beaconHead = b.HeadSlot
+	}
+	if target.Unix() < net.Genesis {
+		failf("target %s is before the beacon genesis (%s)", target.Format(time.RFC3339), time.Unix(net.Genesis, 0).UTC().Format(time.RFC3339))
+	}
+
+	// 1) Make sure the endpoint serves the network the schedule is for
+	var chainHex string
+	if err := ethrpc.Call(ctx, client, *rpcURL, "eth_chainId", []interface{}{}, &chainHex); err != nil {
+		failf("get chain id: %v", err)
+	}
+	chainID, err := ethrpc.HexToUint64(chainHex)
+	if err != nil {
+		failf("parse chain id: %v", err)
+	}
+	if *genesis == 0 && chainID != net.ChainID {
+		failf("endpoint serves chain id %d, but -network=%s is chain id %d", chainID, *network, net.ChainID)
+	}
+
+	// 2) Fetch the head and the blocks of the sample
+	head, err := getLatestBlockNumber(ctx, client, *rpcURL)
+	if err != nil {
+		failf("get latest block number: %v", err)
+	}
+	n := uint64(*sampleSize)
+	if n > head {
+		n = head
+	}
+	heights := make([]uint64, 0, n+1)
+	for h := head - n; h <= head; h++ {
+		heights = append(heights, h)
+	}
+	stamps := make([]int64, 0, len(heights))
+	for i := 0; i < len(heights); i += *batch {
+		got, err := getBlockTimestamps(ctx, client, *rpcURL, heights[i:min(i+*batch, len(heights))])
+		if err != nil {
+			failf("sample blocks: %v", err)
+		}
+		stamps = append(stamps, got...)
+	}
+
+	// 3) Every post-merge block sits in exactly one slot
+	slots := make([]int64, len(stamps))
+	for i, ts := range stamps {
+		if (ts-net.Genesis)%secondsPerSlot != 0 || ts < net.Genesis {
+			failf("block %d (timestamp %d) is not on the %ds slot grid from genesis %d; check -network or -genesis, or the sample reaches before the merge", heights[i], ts, secondsPerSlot, net.Genesis)
+		}
+		slots[i] = (ts - net.Genesis) / secondsPerSlot
+	}
+	headSlot := slots[len(slots)-1]
+	headTime := time.Unix(stamps[len(stamps)-1], 0).UTC()
+
+	// 4) Missed-slot statistics over the sample
+	spanned := headSlot - slots[0]
+	missed, longest := int64(0), int64(0)
+	for i := 1; i < len(slots); i++ {
+		gap := slots[i] - slots[i-1] - 1
+		missed += gap
+		longest = max(longest, gap)
+	}
+	produceRate := 1.0
+	if spanned > 0 {
+		produceRate = float64(len(slots)-1) / float64(spanned)
+	}
+
+	// 5) Target slot and epoch come straight from the fixed schedule
+	targetSlot := (target.Unix() - net.Genesis) / secondsPerSlot
+	slotStart := slotTime(net, targetSlot)
+	epoch := targetSlot / slotsPerEpoch
+	epochStart := slotTime(net, epoch*slotsPerEpoch)
+
+	// 6) Blocks expected in the slots between head and target: each slot is
+	// produced with the sampled probability, so the count is binomial
+	deltaSlots := targetSlot - headSlot
+	expected := float64(deltaSlots) * produceRate
+	z := math.Sqrt2 * math.Erfinv(*confidence)
+	margin := z * math.Sqrt(math.Max(float64(deltaSlots), 0)*produceRate*(1-produceRate))
+	predicted := int64(head) + int64(math.Round(expected))
+	low := int64(head) + int64(math.Floor(expected-margin))
+	high := int64(head) + int64(math.Ceil(expected+margin))
+
+	fmt.Printf("Network       : %s (chain id %d, genesis %s)\n", *network, chainID, time.Unix(net.Genesis, 0).UTC().Format(time.RFC3339))
+	fmt.Printf("Current block : %s — slot %s, epoch %s — %s (UTC)\n", human.CommasUint(head), human.Commas(headSlot), human.Commas(headSlot/slotsPerEpoch), headTime.Format(time.RFC3339))
+	fmt.Printf("Target time   : %s (UTC)\n", target.Format(time.RFC3339))
+
+	fmt.Printf("\nTarget slot   : %s (starts %s", human.Commas(targetSlot), slotStart.Format(time.RFC3339))
+	if into := target.Sub(slotStart); into > 0 {
+		fmt.Printf(", target is %s into it", into)
+	}
+	fmt.Println(")")
+	fmt.Printf("Target epoch  : %s (slot %d of %d, epoch starts %s)\n", human.Commas(epoch), targetSlot%slotsPerEpoch, slotsPerEpoch, epochStart.Format(time.RFC3339))
+	fmt.Printf("Next epoch    : %s at %s\n", human.Commas(epoch+1), slotTime(net, (epoch+1)*slotsPerEpoch).Format(time.RFC3339))
+	if beaconHead >= 0 {
+		fmt.Printf("Beacon head   : slot %s (%d behind the execution head's slot)\n", human.Commas(beaconHead), headSlot-beaconHead)
+	}
+
+	// 5b) L1 events inside the planned activation window
+	fmt.Printf("\nL1 events within ±%s of target:\n", *window)
+	collisions := 0
+	var nearest *l1Event
+	for i, ev := range net.Events {
+		at := slotTime(net, ev.Epoch*slotsPerEpoch)
+		off := at.Sub(target)
+		if off.Abs() <= *window {
+			fmt.Printf("  COLLISION   : %s at epoch %s, %s (%s from target)\n", ev.Name, human.Commas(ev.Epoch), at.Format(time.RFC3339), signedDHMS(off))
+			collisions++
+		}
+		if nearest == nil || off.Abs() < slotTime(net, nearest.Epoch*slotsPerEpoch).Sub(target).Abs() {
+			nearest = &net.Events[i]
+		}
+	}
+	switch {
+	case collisions > 0:
+	case nearest != nil:
+		at := slotTime(net, nearest.Epoch*slotsPerEpoch)
+		fmt.Printf("  none (nearest: %s at epoch %s, %s, %s from target)\n", nearest.Name, human.Commas(nearest.Epoch), at.Format(time.RFC3339), signedDHMS(at.Sub(target)))
+	default:
+		fmt.Printf("  none known for this network\n")
+	}
+
+	fmt.Printf("\nSample        : %s blocks over %s slots\n", human.CommasUint(uint64(len(slots)-1)), human.Commas(spanned))
+	fmt.Printf("Missed slots  : %s (%.3f%%, longest run %d)\n", human.Commas(missed), 100*(1-produceRate), longest)
+	fmt.Printf("Avg block     : %.6f s\n", secondsPerSlot/produceRate)
+
+	if deltaSlots <= 0 {
+		fmt.Printf("\nTarget slot is not after the head slot; nothing to predict.\n")
+		return
+	}
+	fmt.Printf("\nΔslots        : %s (%s)\n", human.Commas(deltaSlots), human.DHMS(time.Duration(deltaSlots*secondsPerSlot)*time.Second))
+	fmt.Printf("Predicted block at target:\n")
+	fmt.Printf("  height      : %s\n", human.Commas(predicted))
+	fmt.Printf("  %.0f%% range   : %s – %s\n", 100**confidence, human.Commas(low), human.Commas(high))
+}
+
+// beaconSchedule is what a beacon node reports about its network.
+type beaconSchedule struct {
+	Genesis  int64
+	HeadSlot int64
+	Forks    []l1Event
+}
+
+// getBeaconSchedule reads the genesis time, checks the slot timing of the
+// spec, and lists the scheduled forks and the head slot from the beacon API.
+func getBeaconSchedule(ctx context.Context, client *http.Client, base string) (beaconSchedule, error) {
+	var out beaconSchedule
+	var gen struct {
+		Data struct {
+			GenesisTime string `json:"genesis_time"`
+		} `json:"data"`
+	}
+	if err := getJSON(ctx, client, base+"/eth/v1/beacon/genesis", &gen); err != nil {
+		return out, fmt.Errorf("genesis: %w", err)
+	}
+	g, err := strconv.ParseInt(gen.Data.GenesisTime, 10, 64)
+	if err != nil {
+		return out, fmt.Errorf("parse genesis time %q: %w", gen.Data.GenesisTime, err)
+	}
+	out.Genesis = g
+
+	var spec struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := getJSON(ctx, client, base+"/eth/v1/config/spec", &spec); err != nil {
+		return out, fmt.Errorf("spec: %w", err)
+	}
+	for key, want := range map[string]string{"SECONDS_PER_SLOT": strconv.Itoa(secondsPerSlot), "SLOTS_PER_EPOCH": strconv.Itoa(slotsPerEpoch)} {
+		if got := fmt.Sprint(spec.Data[key]); got != want {
+			return out, fmt.Errorf("spec %s is %s, this calculator assumes %s", key, got, want)
+		}
+	}
+
+	var sched struct {
+		Data []struct {
+			CurrentVersion string `json:"current_version"`
+			Epoch          string `json:"epoch"`
+		} `json:"data"`
+	}
+	if err := getJSON(ctx, client, base+"/eth/v1/config/fork_schedule", &sched); err != nil {
+		return out, fmt.Errorf("fork schedule: %w", err)
+	}
+	for _, f := range sched.Data {
+		// Unscheduled forks carry FAR_FUTURE_EPOCH, which overflows int64
+		e, err := strconv.ParseInt(f.Epoch, 10, 64)
+		if err != nil || e == 0 {
+			continue
+		}
+		out.Forks = append(out.Forks, l1Event{Name: "fork " + f.CurrentVersion, Epoch: e})
+	}
+
+	var head struct {
+		Data struct {
+			Header struct {
+				Message struct {
+					Slot string `json:"slot"`
+				} `json:"message"`
+			} `json:"header"`
+		} `json:"data"`
+	}
+	if err := getJSON(ctx, client, base+"/eth/v1/beacon/headers/head", &head); err != nil {
+		return out, fmt.Errorf("head header: %w", err)
+	}
+	if out.HeadSlot, err = strconv.ParseInt(head.Data.Header.Message.Slot, 10, 64); err != nil {
+		return out, fmt.Errorf("parse head slot: %w", err)
+	}
+	return out, nil
+}
+
+// mergeEvents adds the beacon's forks to the known events. A fork at an
+// epoch that is already known keeps the known, named event.
+func mergeEvents(known, forks []l1Event) []l1Event {
+	out := append([]l1Event(nil), known...)
+	seen := make(map[int64]bool, len(known))
+	for _, ev := range known {
+		seen[ev.Epoch] = true
+	}
+	for _, f := range forks {
+		if !seen[f.Epoch] {
+			out = append(out, f)
+			seen[f.Epoch] = true
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Epoch < out[j].Epoch })
+	return out
+}
+
+// signedDHMS is human.DHMS with an explicit sign.
+func signedDHMS(d time.Duration) string {
+	if d < 0 {
+		return human.DHMS(d)
+	}
+	return "+" + human.DHMS(d)
+}
+
+// slotTime returns the start of slot s.
+func slotTime(net beaconNetwork, s int64) time.Time {
+	return time.Unix(net.Genesis+s*secondsPerSlot, 0).UTC()
+}
+
+func parseTarget(s string) (time.Time, error) {
+	// RFC3339Nano also accepts times without fractional seconds
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s))
+	var pe *time.ParseError
+	switch {
+	case errors.As(err, &pe) && pe.Message != "":
+		// Well formed but out of range, e.g. a +25:00 offset or day 32
+		return time.Time{}, fmt.Errorf("invalid time %q%s", clip(s), pe.Message)
+	case err != nil:
+		if alt := suggestTime(s); alt != "" {
+			return time.Time{}, fmt.Errorf("unsupported time format %q; did you mean %s? (use RFC3339/RFC3339Nano)", clip(s), alt)
+		}
+		return time.Time{}, fmt.Errorf("unsupported time format %q (use RFC3339/RFC3339Nano, e.g. 2025-10-07T14:00:00Z)", clip(s))
+	}
+	// Durations saturate about 292 years out, which would skew every delta
+	if y := t.UTC().Year(); y < 1970 || y > 2200 {
+		return time.Time{}, fmt.Errorf("time %q is outside the years 1970-2200", clip(s))
+	}
+	return t.UTC(), nil
+}
+
+// suggestTime returns the RFC3339 time a near miss most likely means, e.g.
+// a missing zone, a space for the T or Unix seconds, or "" when s looks
+// like no time. Times without a zone are taken as UTC, as everywhere else.
+func suggestTime(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339Nano)
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case n >= 1e9 && n < 1e10:
+			return time.Unix(n, 0).UTC().Format(time.RFC3339)
+		case n >= 1e12 && n < 1e13:
+			return time.UnixMilli(n).UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return ""
+}
+
+// checkHorizon rejects a target further than limit from now, most often a
+// mistyped year, and suggests the same date in the nearest year that fits.
+func checkHorizon(target, now time.Time, limit time.Duration) error {
+	d := target.Sub(now)
+	if limit <= 0 || d.Abs() <= limit {
+		return nil
+	}
+	msg := fmt.Sprintf("target %s is %.0f days from now, beyond -max-horizon (%.0f days)", target.Format(time.RFC3339), d.Abs().Hours()/24, limit.Hours()/24)
+	alt := target.AddDate(now.Year()-target.Year(), 0, 0)
+	for _, y := range []int{-1, 1} {
+		if c := alt.AddDate(y, 0, 0); c.Sub(now).Abs() < alt.Sub(now).Abs() {
+			alt = c
+		}
+	}
+	if alt.Sub(now) <= limit {
+		msg += fmt.Sprintf("; did you mean -target=%s?", alt.Format(time.RFC3339))
+	}
+	return errors.New(msg + " Raise -max-horizon if the date is right")
+}
+
+func getLatestBlockNumber(ctx context.Context, client *http.Client, rpcURL string) (uint64, error) {
+	var hex string
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_blockNumber", []interface{}{}, &hex); err != nil {
+		return 0, err
+	}
+	return ethrpc.HexToUint64(hex)
+}
+
+// getBlockTimestamps fetches the timestamps of heights in one JSON-RPC batch
+// request, in the order given.
+func getBlockTimestamps(ctx context.Context, client *http.Client, rpcURL string, heights []uint64) ([]int64, error) {
+	c, err := ethrpc.New(rpcURL, ethrpc.WithHTTPClient(client), ethrpc.WithRetries(ethrpc.CallRetries))
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]*block, len(heights))
+	calls := make([]ethrpc.BatchElem, len(heights))
+	for i, h := range heights {
+		calls[i] = ethrpc.BatchElem{Method: "eth_getBlockByNumber", Params: []any{fmt.Sprintf("0x%x", h), false}, Result: &blocks[i]}
+	}
+	if err := c.BatchCall(ctx, calls); err != nil {
+		return nil, fmt.Errorf("batch %d-%d: %w", heights[0], heights[len(heights)-1], err)
+	}
+	out := make([]int64, len(heights))
+	for i, call := range calls {
+		if call.Error != nil {
+			return nil, call.Error
+		}
+		if blocks[i] == nil {
+			return nil, fmt.Errorf("missing block %d in batch response", heights[i])
+		}
+		ts, err := ethrpc.HexToUint64(blocks[i].Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("parse timestamp of block %d: %w", heights[i], err)
+		}
+		out[i] = int64(ts)
+	}
+	return out, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d for %s", resp.StatusCode, url)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+func failf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", a...)
+	os.Exit(1)
+}
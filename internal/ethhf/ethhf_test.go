@@ -0,0 +1,280 @@
+package ethhf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the calculator end to end through its
+// flags and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("ETH_HF_SLOT_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// testGenesis is the beacon genesis of the test chain, passed as -genesis.
+// Every tenth slot is missed, so block h sits in slot h + h/9 and the head,
+// 900,000, in slot 1,000,000 at 2024-04-01T19:33:20Z.
+const testGenesis = 1_700_000_000
+
+func slotOf(h uint64) uint64 { return h + h/9 }
+
+// elNode is an execution-layer JSON-RPC endpoint over the test chain that
+// answers batches as well as single calls.
+type elNode struct {
+	head     uint64
+	pruned   uint64          // blocks below answer as on a pruned node
+	offGrid  map[uint64]bool // blocks whose timestamp is off the slot grid
+	every429 int             // every nth request is rate limited
+
+	mu    sync.Mutex
+	calls int
+}
+
+type rpcReq struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params []any           `json:"params"`
+}
+
+func (n *elNode) answer(req rpcReq) map[string]any {
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "eth_chainId":
+		resp["result"] = "0x1"
+	case "eth_blockNumber":
+		resp["result"] = fmt.Sprintf("0x%x", n.head)
+	case "eth_getBlockByNumber":
+		h, _ := strconv.ParseUint(strings.TrimPrefix(req.Params[0].(string), "0x"), 16, 64)
+		switch {
+		case h > n.head:
+			resp["result"] = nil
+		case h < n.pruned:
+			resp["error"] = map[string]any{"code": -32000, "message": "header not found"}
+		default:
+			ts := testGenesis + 12*slotOf(h)
+			if n.offGrid[h] {
+				ts += 5
+			}
+			resp["result"] = map[string]string{"number": fmt.Sprintf("0x%x", h), "timestamp": fmt.Sprintf("0x%x", ts)}
+		}
+	default:
+		resp["error"] = map[string]any{"code": -32601, "message": "method not found"}
+	}
+	return resp
+}
+
+func (n *elNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if n.every429 > 0 && n.calls%n.every429 == 0 {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+		return
+	}
+	if bytes.HasPrefix(body, []byte("[")) {
+		var reqs []rpcReq
+		json.Unmarshal(body, &reqs)
+		out := make([]map[string]any, len(reqs))
+		// answer in reverse, as a batch may be answered in any order
+		for i, req := range reqs {
+			out[len(reqs)-1-i] = n.answer(req)
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	var req rpcReq
+	json.Unmarshal(body, &req)
+	json.NewEncoder(w).Encode(n.answer(req))
+}
+
+func newELNode(t *testing.T, n *elNode) string {
+	t.Helper()
+	srv := httptest.NewServer(n)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs the calculator on the test chain's schedule and returns its
+// stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	base := []string{"-genesis=" + strconv.Itoa(testGenesis), "-max-horizon=0", "-window=0"}
+	cmd := exec.Command(os.Args[0], append(base, args...)...)
+	cmd.Env = append(os.Environ(), "ETH_HF_SLOT_RUN_MAIN=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// anHourAhead is 300 slots after the head slot.
+const anHourAhead = "2024-04-01T20:33:20Z"
+
+func TestPredict(t *testing.T) {
+	url := newELNode(t, &elNode{head: 900_000})
+	stdout, stderr, err := run(t, "-rpc="+url, "-target="+anHourAhead)
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	// 300 slots at a 90% production rate give 270 blocks, ±8.5 at 90%
+	for _, want := range []string{
+		"Current block : 900,000 — slot 1,000,000, epoch 31,250 — 2024-04-01T19:33:20Z (UTC)",
+		"Target slot   : 1,000,300 (starts 2024-04-01T20:33:20Z)",
+		"Target epoch  : 31,259 (slot 12 of 32, epoch starts 2024-04-01T20:30:56Z)",
+		"Sample        : 1,800 blocks over 2,000 slots",
+		"Missed slots  : 200 (10.000%, longest run 1)",
+		"Avg block     : 13.333333 s",
+		"Δslots        : 300 (0d 1h 0m 0s)",
+		"  height      : 900,270",
+		"  90% range   : 900,261 – 900,279",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestPredictTargetInSlot(t *testing.T) {
+	url := newELNode(t, &elNode{head: 900_000})
+	stdout, stderr, err := run(t, "-rpc="+url, "-target=2024-04-01T20:33:27Z", "-sample=90", "-batch=7")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	for _, want := range []string{"Target slot   : 1,000,300 (starts 2024-04-01T20:33:20Z, target is 7s into it)", "Sample        : 90 blocks over 100 slots", "  height      : 900,270"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestPredictPastTarget(t *testing.T) {
+	url := newELNode(t, &elNode{head: 900_000})
+	stdout, stderr, err := run(t, "-rpc="+url, "-target=2024-04-01T18:33:20Z")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Target slot is not after the head slot; nothing to predict.") || strings.Contains(stdout, "Predicted block") {
+		t.Errorf("a past target should not be predicted:\n%s", stdout)
+	}
+}
+
+func TestPredictRateLimited(t *testing.T) {
+	url := newELNode(t, &elNode{head: 900_000, every429: 4})
+	stdout, stderr, err := run(t, "-rpc="+url, "-target="+anHourAhead, "-sample=180", "-batch=30")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "  height      : 900,270") {
+		t.Errorf("output lacks the prediction:\n%s", stdout)
+	}
+}
+
+func TestPredictBeacon(t *testing.T) {
+	url := newELNode(t, &elNode{head: 900_000})
+	beacon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/eth/v1/beacon/genesis":
+			fmt.Fprintf(w, `{"data":{"genesis_time":"%d"}}`, testGenesis)
+		case "/eth/v1/config/spec":
+			fmt.Fprint(w, `{"data":{"SECONDS_PER_SLOT":"12","SLOTS_PER_EPOCH":"32"}}`)
+		case "/eth/v1/config/fork_schedule":
+			fmt.Fprint(w, `{"data":[{"current_version":"0x00000000","epoch":"0"},{"current_version":"0x05000000","epoch":"31259"},{"current_version":"0x06000000","epoch":"18446744073709551615"}]}`)
+		case "/eth/v1/beacon/headers/head":
+			fmt.Fprint(w, `{"data":{"header":{"message":{"slot":"999998"}}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer beacon.Close()
+	stdout, stderr, err := run(t, "-rpc="+url, "-beacon="+beacon.URL, "-target="+anHourAhead, "-window=1h")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	for _, want := range []string{
+		"Beacon head   : slot 999,998 (2 behind the execution head's slot)",
+		"  COLLISION   : fork 0x05000000 at epoch 31,259, 2024-04-01T20:30:56Z (-0d 0h 2m 24s from target)",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestPredictFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		node *elNode
+		args []string
+		want string
+	}{
+		{"pruned", &elNode{head: 900_000, pruned: 899_000}, nil, "sample blocks: rpc eth_getBlockByNumber: rpc error -32000: header not found"},
+		{"off the slot grid", &elNode{head: 900_000, offGrid: map[uint64]bool{899_999: true}}, nil, "block 899999 (timestamp 1711999981) is not on the 12s slot grid"},
+		{"wrong network", &elNode{head: 900_000}, []string{"-genesis=0", "-network=sepolia"}, "endpoint serves chain id 1, but -network=sepolia is chain id 11155111"},
+		{"bad confidence", &elNode{head: 900_000}, []string{"-confidence=0"}, "-confidence must be between 0 and 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := newELNode(t, tt.node)
+			_, stderr, err := run(t, append([]string{"-rpc=" + url, "-target=" + anHourAhead}, tt.args...)...)
+			if err == nil || !strings.Contains(stderr, tt.want) {
+				t.Errorf("run error = %v, want %q in:\n%s", err, tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{"2025-12-03T21:49:11Z", "2025-12-03T21:49:11Z", ""},
+		{" 2025-12-03T22:49:11.5+01:00 ", "2025-12-03T21:49:11.5Z", ""},
+		{"2025-12-03 21:49:11", "", "did you mean 2025-12-03T21:49:11Z?"},
+		{"1764798551", "", "did you mean 2025-12-03T21:49:11Z?"},
+		{"2025-12-32T00:00:00Z", "", "invalid time"},
+		{"2300-01-01T00:00:00Z", "", "outside the years 1970-2200"},
+		{"soon", "", "unsupported time format"},
+	}
+	for _, tt := range tests {
+		got, err := parseTarget(tt.in)
+		switch {
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseTarget(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+			}
+		case err != nil || got.Format(time.RFC3339Nano) != tt.want:
+			t.Errorf("parseTarget(%q) = %v, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestMergeEvents(t *testing.T) {
+	known := []l1Event{{"Deneb", 269568}, {"Electra", 364032}}
+	got := mergeEvents(known, []l1Event{{"fork 0x05000000", 364032}, {"fork 0x06000000", 411392}, {"fork 0x03000000", 194048}})
+	want := []l1Event{{"fork 0x03000000", 194048}, {"Deneb", 269568}, {"Electra", 364032}, {"fork 0x06000000", 411392}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("mergeEvents = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,280 @@
+// Package finalitycheck is finality_check.go: it checks the finalized block
+// of each Bor endpoint against the latest Heimdall milestone.
+package finalitycheck
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+	"github.com/pratikspatil024/chain-utils/pkg/human"
+)
+
+const (
+	defaultBorRPC   = "https://polygon-rpc.com"
+	defaultRESTBase = "https://heimdall-api.polygon.technology"
+	httpTimeout     = 20 * time.Second
+)
+
+type block struct {
+	Number string `json:"number"`
+	Hash   string `json:"hash"`
+}
+
+// milestone is the latest Heimdall milestone: the Bor range it finalizes and
+// the hash of its last block.
+type milestone struct {
+	ID         string
+	StartBlock int64
+	EndBlock   int64
+	Hash       string
+	Time       time.Time
+}
+
+// endpointCheck is what one Bor endpoint reports about the milestone.
+type endpointCheck struct {
+	RPC       string
+	ChainID   uint64
+	Finalized int64 // -1 when the endpoint lacks the "finalized" tag
+	Status    string
+	Detail    string
+	Err       error
+}
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	rpcList := flag.String("rpc", defaultBorRPC, "Comma-separated Polygon (Bor) JSON-RPC endpoints to verify")
+	restBase := flag.String("heimdall-rest", defaultRESTBase, "Heimdall REST API the latest milestone is read from")
+	maxLag := flag.Int64("max-lag", 64, "Blocks the finalized tag may trail the milestone end before the endpoint is flagged as lagging")
+	flag.Parse()
+
+	var rpcs []string
+	for _, u := range strings.Split(*rpcList, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			rpcs = append(rpcs, u)
+		}
+	}
+	if len(rpcs) == 0 {
+		failf("-rpc is empty")
+	}
+	if *restBase == "" {
+		failf("-heimdall-rest is required")
+	}
+	if *maxLag < 0 {
+		failf("-max-lag must not be negative")
+	}
+	ctx := context.Background()
+	client := &http.Client{Timeout: httpTimeout}
+
+	// 1) The milestone is the reference every endpoint is checked against
+	m, err := latestMilestone(ctx, client, strings.TrimRight(*restBase, "/"))
+	if err != nil {
+		failf("latest milestone: %v", err)
+	}
+	fmt.Printf("Milestone     : %s\n", m.ID)
+	fmt.Printf("Bor blocks    : %s → %s\n", human.Commas(m.StartBlock), human.Commas(m.EndBlock))
+	fmt.Printf("End hash      : %s\n", m.Hash)
+	if !m.Time.IsZero() {
+		fmt.Printf("Created       : %s (%s ago)\n", m.Time.Format(time.RFC3339), time.Since(m.Time).Round(time.Second))
+	}
+	fmt.Println()
+
+	// 2) Compare each endpoint's finalized tag and its block at the milestone end
+	checks := make([]endpointCheck, len(rpcs))
+	for i, u := range rpcs {
+		checks[i] = checkEndpoint(ctx, client, u, m, *maxLag)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Endpoint\tChain\tFinalized\tvs milestone\tStatus")
+	for _, c := range checks {
+		if c.Err != nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\terror\n", c.RPC)
+			continue
+		}
+		fin, diff := "no tag", "-"
+		if c.Finalized >= 0 {
+			fin = human.Commas(c.Finalized)
+			diff = fmt.Sprintf("%+d", c.Finalized-m.EndBlock)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", c.RPC, c.ChainID, fin, diff, c.Status)
+	}
+	tw.Flush()
+
+	flagged := false
+	for _, c := range checks {
+		switch {
+		case c.Err != nil:
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", c.RPC, c.Err)
+			flagged = true
+		case c.Status != "ok":
+			fmt.Fprintf(os.Stderr, "%s: %s: %s\n", c.Status, c.RPC, c.Detail)
+			flagged = true
+		}
+	}
+	if flagged {
+		os.Exit(1)
+	}
+}
+
+// checkEndpoint classifies one endpoint. A different hash at the milestone
+// end block means the endpoint is on another fork, which outranks any lag.
+// A finalized tag past the milestone end is also treated as divergence:
+// Bor only finalizes what a milestone has voted on.
+func checkEndpoint(ctx context.Context, client *http.Client, rpcURL string, m milestone, maxLag int64) endpointCheck {
+	c := endpointCheck{RPC: rpcURL, Finalized: -1}
+	var chainHex string
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_chainId", []interface{}{}, &chainHex); err != nil {
+		c.Err = fmt.Errorf("get chain id: %w", err)
+		return c
+	}
+	if c.ChainID, c.Err = ethrpc.HexToUint64(chainHex); c.Err != nil {
+		return c
+	}
+
+	var atEnd *block
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_getBlockByNumber", []interface{}{fmt.Sprintf("0x%x", m.EndBlock), false}, &atEnd); err != nil {
+		c.Err = fmt.Errorf("get block %d: %w", m.EndBlock, err)
+		return c
+	}
+	var fin *block
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_getBlockByNumber", []interface{}{"finalized", false}, &fin); err == nil && fin != nil {
+		h, err := ethrpc.HexToUint64(fin.Number)
+		if err != nil {
+			c.Err = fmt.Errorf("parse finalized number: %w", err)
+			return c
+		}
+		c.Finalized = int64(h)
+	}
+
+	switch {
+	case atEnd == nil:
+		c.Status = "lagging"
+		c.Detail = fmt.Sprintf("does not have milestone end block %d yet", m.EndBlock)
+	case !strings.EqualFold(atEnd.Hash, m.Hash):
+		c.Status = "diverged"
+		c.Detail = fmt.Sprintf("block %d is %s, milestone says %s", m.EndBlock, atEnd.Hash, m.Hash)
+	case c.Finalized < 0:
+		c.Status = "no-tag"
+		c.Detail = "the \"finalized\" tag is not supported"
+	case c.Finalized > m.EndBlock:
+		c.Status = "diverged"
+		c.Detail = fmt.Sprintf("finalized block %d is past the latest milestone end %d", c.Finalized, m.EndBlock)
+	case m.EndBlock-c.Finalized > maxLag:
+		c.Status = "lagging"
+		c.Detail = fmt.Sprintf("finalized block %d trails the milestone end %d by %d blocks (max %d)", c.Finalized, m.EndBlock, m.EndBlock-c.Finalized, maxLag)
+	default:
+		c.Status = "ok"
+	}
+	return c
+}
+
+// latestMilestone reads /milestones/latest. Heimdall v1 wraps it in
+// "result" with a hex hash and numeric fields, v2 in "milestone" with a
+// base64 hash and string fields.
+func latestMilestone(ctx context.Context, client *http.Client, restBase string) (milestone, error) {
+	type raw struct {
+		MilestoneID string      `json:"milestone_id"`
+		StartBlock  json.Number `json:"start_block"`
+		EndBlock    json.Number `json:"end_block"`
+		Hash        string      `json:"hash"`
+		Timestamp   json.Number `json:"timestamp"`
+	}
+	var resp struct {
+		Milestone *raw `json:"milestone"`
+		Result    *raw `json:"result"`
+	}
+	if err := getJSON(ctx, client, restBase+"/milestones/latest", &resp); err != nil {
+		return milestone{}, err
+	}
+	r := resp.Milestone
+	if r == nil {
+		r = resp.Result
+	}
+	if r == nil || r.EndBlock == "" || r.Hash == "" {
+		return milestone{}, fmt.Errorf("no milestone in response from %s", restBase)
+	}
+	var m milestone
+	var err error
+	if m.StartBlock, err = r.StartBlock.Int64(); err != nil {
+		return m, fmt.Errorf("parse start_block: %w", err)
+	}
+	if m.EndBlock, err = r.EndBlock.Int64(); err != nil {
+		return m, fmt.Errorf("parse end_block: %w", err)
+	}
+	if m.Hash, err = normalizeHash(r.Hash); err != nil {
+		return m, fmt.Errorf("parse hash: %w", err)
+	}
+	if ts, err := r.Timestamp.Int64(); err == nil && ts > 0 {
+		m.Time = time.Unix(ts, 0).UTC()
+	}
+	m.ID = r.MilestoneID
+	if m.ID == "" {
+		m.ID = "(no id)"
+	}
+	return m, nil
+}
+
+// normalizeHash returns a 0x-prefixed lowercase hex hash from either hex or
+// base64 input.
+func normalizeHash(s string) (string, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return strings.ToLower(s), nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	if len(b) != 32 {
+		return "", fmt.Errorf("hash is %d bytes, want 32", len(b))
+	}
+	return "0x" + hex.EncodeToString(b), nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(client, req, out)
+}
+
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d for %s", resp.StatusCode, req.URL)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+func failf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", a...)
+	os.Exit(1)
+}
@@ -0,0 +1,197 @@
+package finalitycheck
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the check end to end through its flags
+// and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("FINALITY_CHECK_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// milestoneHash is the hash of block 1000, the end of the test milestone.
+var milestoneHash = "0x" + strings.Repeat("ab", 32)
+
+// borNode is a Bor endpoint holding blocks up to head, with the hash of
+// block 1000 set to hash and the "finalized" tag at finalized (-1 for an
+// endpoint without the tag).
+type borNode struct {
+	head, finalized int64
+	hash            string
+}
+
+func (n borNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params []any           `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "eth_chainId":
+		resp["result"] = "0x89"
+	case "eth_getBlockByNumber":
+		tag := req.Params[0].(string)
+		h := n.finalized
+		if tag == "finalized" {
+			if h < 0 {
+				resp["error"] = map[string]any{"code": -32602, "message": "invalid block number"}
+				break
+			}
+		} else {
+			h, _ = strconv.ParseInt(strings.TrimPrefix(tag, "0x"), 16, 64)
+		}
+		if h > n.head {
+			resp["result"] = nil
+			break
+		}
+		hash := fmt.Sprintf("0x%064x", h)
+		if h == 1000 {
+			hash = n.hash
+		}
+		resp["result"] = map[string]string{"number": fmt.Sprintf("0x%x", h), "hash": hash}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// heimdallNode serves /milestones/latest for Bor blocks 990 → 1000 in the
+// v2 shape (base64 hash, string numbers), or the v1 one when v1 is set.
+func heimdallNode(v1 bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/milestones/latest" {
+			http.NotFound(w, r)
+			return
+		}
+		if v1 {
+			fmt.Fprintf(w, `{"height":"1","result":{"start_block":990,"end_block":1000,"hash":%q,"timestamp":1700000000,"milestone_id":"m-1"}}`, "0x"+strings.ToUpper(milestoneHash[2:]))
+			return
+		}
+		raw, _ := hex.DecodeString(milestoneHash[2:])
+		fmt.Fprintf(w, `{"milestone":{"milestone_id":"m-2","start_block":"990","end_block":"1000","hash":%q,"timestamp":"1700000000"}}`, base64.StdEncoding.EncodeToString(raw))
+	})
+}
+
+func newServer(t *testing.T, h http.Handler) string {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs finality_check.go with args and returns its stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "FINALITY_CHECK_RUN_MAIN=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+func TestFinalityCheck(t *testing.T) {
+	heimdall := newServer(t, heimdallNode(false))
+	endpoints := []struct {
+		name         string
+		node         http.Handler
+		row, verdict string
+	}{
+		{"ok", borNode{head: 1010, finalized: 990, hash: milestoneHash}, `137\s+990\s+-10\s+ok`, ""},
+		{"behind", borNode{head: 999, finalized: 980, hash: milestoneHash}, `137\s+980\s+-20\s+lagging`, "does not have milestone end block 1000 yet"},
+		{"fork", borNode{head: 1010, finalized: 1000, hash: "0x" + strings.Repeat("cd", 32)}, `137\s+1,000\s+\+0\s+diverged`, "block 1000 is 0xcdcd"},
+		{"slow", borNode{head: 1010, finalized: 900, hash: milestoneHash}, `137\s+900\s+-100\s+lagging`, "finalized block 900 trails the milestone end 1000 by 100 blocks (max 64)"},
+		{"old", borNode{head: 1010, finalized: -1, hash: milestoneHash}, `137\s+no tag\s+-\s+no-tag`, `the "finalized" tag is not supported`},
+		{"ahead", borNode{head: 1010, finalized: 1005, hash: milestoneHash}, `137\s+1,005\s+\+5\s+diverged`, "finalized block 1005 is past the latest milestone end 1000"},
+		{"down", http.NotFoundHandler(), `-\s+-\s+-\s+error`, "get chain id"},
+	}
+	var urls []string
+	for _, e := range endpoints {
+		urls = append(urls, newServer(t, e.node))
+	}
+
+	stdout, stderr, err := run(t, "-rpc="+strings.Join(urls, ","), "-heimdall-rest="+heimdall)
+	if err == nil {
+		t.Error("exited 0 with endpoints flagged")
+	}
+	for _, s := range []string{"Milestone     : m-2", "Bor blocks    : 990 → 1,000", "End hash      : " + milestoneHash, "Created       : 2023-11-14T22:13:20Z"} {
+		if !strings.Contains(stdout, s) {
+			t.Errorf("stdout lacks %q:\n%s", s, stdout)
+		}
+	}
+	for i, e := range endpoints {
+		if !regexp.MustCompile(regexp.QuoteMeta(urls[i]) + `\s+` + e.row).MatchString(stdout) {
+			t.Errorf("%s: no row %q:\n%s", e.name, e.row, stdout)
+		}
+		if e.verdict == "" {
+			if strings.Contains(stderr, urls[i]) {
+				t.Errorf("%s: flagged:\n%s", e.name, stderr)
+			}
+		} else if !strings.Contains(stderr, urls[i]+": "+e.verdict) {
+			t.Errorf("%s: stderr lacks %q:\n%s", e.name, e.verdict, stderr)
+		}
+	}
+
+	// Heimdall v1 answers with an uppercase hex hash in "result"
+	stdout, stderr, err = run(t, "-rpc="+urls[0], "-heimdall-rest="+newServer(t, heimdallNode(true)))
+	if err != nil || !strings.Contains(stdout, "Milestone     : m-1") || !strings.Contains(stdout, "End hash      : "+milestoneHash) {
+		t.Errorf("v1 milestone: %v\n%s%s", err, stdout, stderr)
+	}
+
+	// -max-lag widens what counts as in step
+	if _, stderr, err := run(t, "-rpc="+urls[3], "-heimdall-rest="+heimdall, "-max-lag=100"); err != nil {
+		t.Errorf("-max-lag=100: %v\n%s", err, stderr)
+	}
+}
+
+func TestFinalityCheckInput(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-rpc= , "}, "-rpc is empty"},
+		{[]string{"-rpc=http://x", "-heimdall-rest="}, "-heimdall-rest is required"},
+		{[]string{"-rpc=http://x", "-max-lag=-1"}, "-max-lag must not be negative"},
+		{[]string{"-rpc=http://x", "-heimdall-rest=" + newServer(t, http.NotFoundHandler())}, "latest milestone: HTTP 404"},
+	}
+	for _, tt := range tests {
+		if _, stderr, err := run(t, tt.args...); err == nil || !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: %v\n%s", tt.args, err, stderr)
+		}
+	}
+}
+
+func TestNormalizeHash(t *testing.T) {
+	raw := bytes.Repeat([]byte{0xab}, 32)
+	for in, want := range map[string]string{
+		"0xABAB" + strings.Repeat("ab", 30):    milestoneHash,
+		base64.StdEncoding.EncodeToString(raw): milestoneHash,
+	} {
+		if got, err := normalizeHash(in); err != nil || got != want {
+			t.Errorf("normalizeHash(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"not base64!", base64.StdEncoding.EncodeToString(raw[:20])} {
+		if _, err := normalizeHash(bad); err == nil {
+			t.Errorf("normalizeHash(%q) accepted", bad)
+		}
+	}
+}
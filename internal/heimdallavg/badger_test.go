@@ -0,0 +1,7 @@
+//go:build badger
+
+package heimdallavg
+
+import "testing"
+
+func TestBadgerCache(t *testing.T) { testDatabaseCache(t, "badger") }
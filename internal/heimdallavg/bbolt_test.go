@@ -0,0 +1,7 @@
+//go:build bbolt
+
+package heimdallavg
+
+import "testing"
+
+func TestBoltCache(t *testing.T) { testDatabaseCache(t, "bbolt") }
@@ -0,0 +1,1228 @@
+// Package heimdallavg is heimdall_average_blocktime_calculator.go: it
+// measures the average Heimdall block time over lookbacks, windows and
+// ranges.
+package heimdallavg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/fixtures"
+	"github.com/pratikspatil024/chain-utils/pkg/blockstore"
+	"github.com/pratikspatil024/chain-utils/pkg/fetch"
+)
+
+const (
+	defaultBase = "https://tendermint-api.polygon.technology"
+
+	// defaultConcurrency is -concurrency's default, which bounds the block
+	// requests in flight at once.
+	defaultConcurrency = 4
+)
+
+type statusResp struct {
+	Result struct {
+		NodeInfo struct {
+			Network string `json:"network"`
+		} `json:"node_info"`
+		SyncInfo struct {
+			LatestBlockHeight string `json:"latest_block_height"`
+			LatestBlockTime   string `json:"latest_block_time"`
+			EarliestBlockH    string `json:"earliest_block_height"`
+		} `json:"sync_info"`
+	} `json:"result"`
+}
+
+type blockResp struct {
+	Result struct {
+		BlockID struct {
+			Hash string `json:"hash"`
+		} `json:"block_id"`
+		Block struct {
+			Header struct {
+				Height string `json:"height"`
+				Time   string `json:"time"`
+			} `json:"header"`
+		} `json:"block"`
+	} `json:"result"`
+}
+
+// headers caches block headers across runs; nil disables caching.
+var headers *blockCache
+
+// memo dedupes identical /block lookups within one run; see getJSON.
+var memo = newRPCMemo()
+
+// links turns referenced heights into explorer URLs; zero prints none.
+var links explorerURLs
+
+// offline is set by -local-only: every answer comes from headers and any
+// network access is an error.
+var offline bool
+
+// strictJSON is set by -strict; see checkTendermint.
+var strictJSON bool
+
+// csvMode is set by -format=csv: the report is collected in csvRows and
+// written as CSV instead of printed.
+var (
+	csvMode bool
+	csvRows []avgRow
+)
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	base := flag.String("base", defaultBase, "Base URL for the Tendermint RPC-compatible API")
+	timeout := flag.Duration("timeout", 15*time.Second, "HTTP request timeout")
+	windowsStr := flag.String("windows", "", "Comma-separated wall-clock windows (e.g. 24h,7d,30d) used instead of fixed block lookbacks")
+	fromHeight := flag.Int64("from-height", -1, "First anchor height for an exact two-anchor average")
+	toHeight := flag.Int64("to-height", -1, "Second anchor height (default: latest block)")
+	fromTime := flag.String("from-time", "", "First anchor time (RFC3339); resolved to the first block at or after it")
+	toTime := flag.String("to-time", "", "Second anchor time (RFC3339); default: latest block")
+	asOfHeight := flag.Int64("as-of-height", -1, "Pin the report to this block instead of the latest one (reproducible output)")
+	asOfTime := flag.String("as-of-time", "", "Pin the report to the last block at or before this time (RFC3339)")
+	watch := flag.Duration("watch", 0, "Recompute the report every interval (e.g. 30s) until interrupted")
+	cacheDir := flag.String("cache-dir", defaultCacheDir(), "Directory for the local cache of block headers (empty disables it)")
+	maxMB := flag.Int64("cache-max-mb", 0, "Shrink the cache file to this many megabytes, keeping the newest heights (0 means unlimited)")
+	cacheBackend := flag.String("cache-backend", "file", "Header cache backend: file (persisted under -cache-dir), sqlite (one database for every network), bbolt or badger (key-value stores), postgres (a server a team shares, see -store), memory (this process only, e.g. with -watch) or none")
+	storeDSN := flag.String("store", "", "Database of a database -cache-backend: a path, or a postgres:// URL, which implies -cache-backend=postgres (default: blocks.<backend> under -cache-dir)")
+	maxHeadAge := flag.Duration("max-head-age", time.Minute, "Flag the head block when its timestamp is further than this from the local clock (0 disables)")
+	strictTime := flag.Bool("strict-time", false, "Fail instead of warning when block timestamps are implausible")
+	localOnly := flag.Bool("local-only", false, "Answer purely from the synced store under -cache-dir, without network access; fails when a needed height is missing")
+	localNetwork := flag.String("local-network", "", "Network id of the store read by -local-only (e.g. heimdallv2-137), when -cache-dir holds several")
+	explorer := flag.String("explorer", "mintscan", "Explorer linked for referenced blocks: mintscan, a URL template with %d, or empty for none")
+	replayPath := flag.String("replay", "", "Answer from a recorded dataset instead of the network: builtin:mainnet, builtin:amoy or a fixture file")
+	network := flag.String("network", "mainnet", "Network the -explorer links point at")
+	format := flag.String("format", "text", "Output format: text, or csv with one row per lookback, window or anchor pair")
+	outPath := flag.String("out", "", "Write the CSV rows to this file instead of stdout (implies -format=csv)")
+	concurrency := flag.Int("concurrency", defaultConcurrency, "Block requests in flight at once; each is retried on its own")
+	strict := flag.Bool("strict", false, "Reject Tendermint responses with unexpected envelope fields, or a missing or malformed height or time, instead of decoding what is there")
+	flag.Parse()
+	strictJSON = *strict
+
+	if *outPath != "" && !flagSet("format") {
+		*format = "csv"
+	}
+	switch {
+	case *format != "text" && *format != "csv":
+		failf("unknown -format %q (use text or csv)", *format)
+	case *outPath != "" && *format != "csv":
+		failf("-out writes CSV and cannot be combined with -format=text")
+	case *format == "csv" && *watch > 0:
+		failf("-format=csv writes one report and cannot be combined with -watch")
+	}
+	csvMode = *format == "csv"
+	if *concurrency < 1 {
+		failf("-concurrency must be at least 1")
+	}
+
+	windows, err := parseWindows(*windowsStr)
+	if err != nil {
+		failf("parse windows: %v", err)
+	}
+	var replayer http.RoundTripper
+	if *replayPath != "" {
+		if *localOnly {
+			failf("-replay cannot be combined with -local-only")
+		}
+		fix, err := fixtures.Load(*replayPath)
+		if err == nil {
+			replayer, err = fixtures.NewTendermint(fix)
+		}
+		if err != nil {
+			failf("-replay: %v", err)
+		}
+		// Live explorer pages would show unrelated blocks
+		if !flagSet("explorer") {
+			*explorer = ""
+		}
+		// Replayed headers must not end up in the stored cache of the live chain
+		if *cacheBackend != "none" {
+			*cacheBackend = "memory"
+		}
+		fmt.Fprintln(os.Stderr, fix.Banner(*replayPath))
+	}
+	if links, err = resolveExplorer(*explorer, *network); err != nil {
+		failf("%v", err)
+	}
+
+	httpc := &http.Client{Timeout: *timeout, Transport: replayer}
+
+	// -store postgres://... names its backend by itself
+	if b := blockstore.BackendOf(*storeDSN); b != "" && *cacheBackend != b {
+		if *cacheBackend != "file" {
+			failf("-store is a %s URL, but -cache-backend is %s", b, *cacheBackend)
+		}
+		*cacheBackend = b
+	}
+	database := false
+	switch *cacheBackend {
+	case "file", "memory", "none":
+	default:
+		if !slices.Contains(blockstore.Known(), *cacheBackend) {
+			failf("unknown -cache-backend %q (use file, %s, memory or none)", *cacheBackend, strings.Join(blockstore.Known(), ", "))
+		}
+		if err := blockstore.Available(*cacheBackend); err != nil {
+			failf("-cache-backend: %v", err)
+		}
+		database = true
+		if *storeDSN == "" && blockstore.Server(*cacheBackend) {
+			failf("-store is required with -cache-backend=%s", *cacheBackend)
+		}
+		if *storeDSN == "" && *cacheDir != "" {
+			*storeDSN = blockstore.DefaultPath(*cacheDir, *cacheBackend)
+		}
+	}
+	if *localOnly {
+		var err error
+		switch {
+		case database && *localNetwork == "":
+			err = fmt.Errorf("-local-network is required with -cache-backend=%s", *cacheBackend)
+		case database:
+			headers, err = loadStoreCache(*cacheBackend, *storeDSN, "heimdall-"+*localNetwork)
+		default:
+			var path string
+			if path, err = localStorePath(*cacheDir, "heimdall", *localNetwork); err == nil {
+				headers, err = loadBlockCache(path)
+			}
+		}
+		if err != nil {
+			failf("-local-only: %v", err)
+		}
+		offline = true
+	}
+	if *cacheBackend == "memory" && !offline {
+		headers = newBlockCache(nil)
+	}
+	if (*cacheBackend == "file" && *cacheDir != "" || database && *storeDSN != "") && !offline {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		var sr statusResp
+		err := getJSON(ctx, httpc, *base+"/status", &sr)
+		cancel()
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "warning: cache disabled: %v\n", err)
+		case sr.Result.NodeInfo.Network == "":
+			fmt.Fprintf(os.Stderr, "warning: cache disabled: /status reports no network\n")
+		default:
+			name := "heimdall-" + sr.Result.NodeInfo.Network
+			if database {
+				headers, err = openStoreCache(*cacheBackend, *storeDSN, name)
+			} else {
+				headers, err = openBlockCache(filepath.Join(*cacheDir, name+".jsonl"), *maxMB<<20)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: cache disabled: %v\n", err)
+			}
+		}
+	}
+	defer headers.close()
+
+	run := func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, *timeout)
+		defer cancel()
+		memo.reset()
+
+		latestHeight, latestTime, earliestHeight, err := getLatest(ctx, httpc, *base)
+		if err != nil {
+			return fmt.Errorf("get latest: %w", err)
+		}
+		latestHeight, latestTime, err = resolveAsOf(ctx, httpc, *base, latestHeight, latestTime, earliestHeight, *asOfHeight, *asOfTime)
+		if err != nil {
+			return err
+		}
+
+		// Two explicit anchors replace the lookback report entirely
+		if *fromHeight >= 0 || *fromTime != "" {
+			return runAnchors(ctx, httpc, *base, latestHeight, latestTime, earliestHeight, *fromHeight, *toHeight, *fromTime, *toTime)
+		}
+
+		lookbacks := []int64{10_000, 100_000, 1_000_000, 1_500_000}
+		if len(windows) > 0 {
+			lookbacks = nil
+		}
+		// Fetch every lookback first so the timestamps can be checked
+		// against each other before any average is printed
+		samples := map[int64]time.Time{latestHeight: latestTime}
+		fetchErrs := make(map[int64]error)
+		var mu sync.Mutex
+		g := fetch.NewGroup(ctx, *concurrency)
+		for _, lb := range lookbacks {
+			if target := latestHeight - lb; target >= earliestHeight {
+				g.Go(func(ctx context.Context) error {
+					t, err := getBlockTime(ctx, httpc, *base, target)
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						fetchErrs[target] = err
+					} else {
+						samples[target] = t
+					}
+					return nil
+				})
+			}
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		headAge := *maxHeadAge
+		if offline || *asOfHeight >= 0 || *asOfTime != "" {
+			// A stored or pinned head is old by design
+			headAge = 0
+		}
+		if err := flagImplausible(checkTimestamps(latestHeight, samples, headAge), *strictTime); err != nil {
+			return err
+		}
+
+		// In CSV mode the notes that would sit between rows go to stderr
+		note := func(format string, a ...any) {
+			if csvMode {
+				fmt.Fprintf(os.Stderr, "warning: "+strings.Join(strings.Fields(format), " ")+"\n", a...)
+				return
+			}
+			fmt.Printf(format+"\n", a...)
+		}
+		if !csvMode {
+			fmt.Printf("Current block: %d at %s (earliest available: %d)\n",
+				latestHeight, latestTime.Format(time.RFC3339Nano), earliestHeight)
+			printLink(latestHeight)
+			fmt.Println()
+		}
+
+		for _, lb := range lookbacks {
+			target := latestHeight - lb
+			if target < earliestHeight {
+				note("Δ%-9d SKIP  target height %d < earliest available %d", lb, target, earliestHeight)
+				continue
+			}
+			if err := fetchErrs[target]; err != nil {
+				note("Δ%-9d ERROR fetching height %d: %v", lb, target, err)
+				continue
+			}
+			t0 := samples[target]
+			elapsed := latestTime.Sub(t0)                 // total elapsed
+			avgSeconds := elapsed.Seconds() / float64(lb) // average seconds per block
+			if csvMode {
+				csvRows = append(csvRows, avgRow{Lookback: strconv.FormatInt(lb, 10), From: target, To: latestHeight, Elapsed: elapsed.Seconds(), Avg: avgSeconds})
+				continue
+			}
+
+			fmt.Printf("Δ%-9d from height %-10d to %-10d\n", lb, target, latestHeight)
+			printLink(target)
+			fmt.Printf("  elapsed    : %s\n", formatElapsed(elapsed))
+			fmt.Printf("  avg block  : %.6f s/block  (%.3f ms)\n", avgSeconds, avgSeconds*1000.0)
+			printThroughput(avgSeconds)
+			fmt.Println()
+		}
+
+		for _, w := range windows {
+			label := w.label
+			start := latestTime.Add(-w.d)
+			target, t0, err := findBlockAtOrAfter(ctx, httpc, *base, start, earliestHeight, latestHeight)
+			if err != nil {
+				note("%-10s ERROR searching window start: %v", label, err)
+				continue
+			}
+			if target == earliestHeight && t0.After(start) {
+				note("%-10s NOTE  window starts before earliest available %d, truncated", label, earliestHeight)
+			}
+			blocks := latestHeight - target
+			if blocks <= 0 {
+				note("%-10s SKIP  no block between window start and head", label)
+				continue
+			}
+			elapsed := latestTime.Sub(t0)
+			avgSeconds := elapsed.Seconds() / float64(blocks)
+			if csvMode {
+				csvRows = append(csvRows, avgRow{Lookback: label, From: target, To: latestHeight, Elapsed: elapsed.Seconds(), Avg: avgSeconds})
+				continue
+			}
+
+			fmt.Printf("%-10s from height %-10d to %-10d (%d blocks)\n", label, target, latestHeight, blocks)
+			printLink(target)
+			fmt.Printf("  elapsed    : %s\n", formatElapsed(elapsed))
+			fmt.Printf("  avg block  : %.6f s/block  (%.3f ms)\n", avgSeconds, avgSeconds*1000.0)
+			printThroughput(avgSeconds)
+			fmt.Println()
+		}
+		return nil
+	}
+
+	if err := runWatch(*watch, run); err != nil {
+		failf("%v", err)
+	}
+	if csvMode {
+		if err := writeCSV(*outPath, csvRows); err != nil {
+			failf("write CSV: %v", err)
+		}
+	}
+}
+
+// avgRow is one row of -format=csv: the average over the blocks from From
+// to To. Lookback is the block count, or the window (e.g. 7d) it came from.
+type avgRow struct {
+	Lookback string
+	From, To int64
+	Elapsed  float64 // seconds
+	Avg      float64
+}
+
+// writeCSV writes rows under a header line to path, or to stdout when path
+// is empty. A file is replaced whole, so an archive never holds half a
+// report.
+func writeCSV(path string, rows []avgRow) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"lookback", "from_height", "to_height", "elapsed_seconds", "avg_block_time"})
+	for _, r := range rows {
+		w.Write([]string{r.Lookback, strconv.FormatInt(r.From, 10), strconv.FormatInt(r.To, 10), strconv.FormatFloat(r.Elapsed, 'f', 3, 64), strconv.FormatFloat(r.Avg, 'f', 6, 64)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if path == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// checkTimestamps reports what a healthy endpoint never returns: a head
+// block further than maxAge from the local clock (0 skips this), or sampled
+// block times that do not increase with height.
+func checkTimestamps(head int64, samples map[int64]time.Time, maxAge time.Duration) error {
+	var problems []string
+	if t, ok := samples[head]; ok && maxAge > 0 {
+		switch age := time.Since(t); {
+		case age < -maxAge:
+			problems = append(problems, fmt.Sprintf("head block %d is %s in the future", head, (-age).Round(time.Second)))
+		case age > maxAge:
+			problems = append(problems, fmt.Sprintf("head block %d is %s old", head, age.Round(time.Second)))
+		}
+	}
+	heights := make([]int64, 0, len(samples))
+	for h := range samples {
+		heights = append(heights, h)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	for i := 1; i < len(heights); i++ {
+		lo, hi := heights[i-1], heights[i]
+		if !samples[hi].After(samples[lo]) {
+			problems = append(problems, fmt.Sprintf("block %d (%s) is not later than block %d (%s)", hi, samples[hi].UTC().Format(time.RFC3339Nano), lo, samples[lo].UTC().Format(time.RFC3339Nano)))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// flagImplausible warns loudly about implausible timestamps, or returns
+// them as the error when strict.
+func flagImplausible(err error, strict bool) error {
+	if err == nil {
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("implausible block timestamps: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "WARNING: implausible block timestamps: %v\n", err)
+	fmt.Fprintf(os.Stderr, "WARNING: the endpoint or the local clock is wrong and the numbers below may be too; -strict-time makes this an error\n")
+	return nil
+}
+
+// runWatch calls run once, or with a positive interval keeps calling it on
+// that interval until interrupted. Failures inside the loop are reported and
+// retried on the next tick instead of exiting.
+func runWatch(interval time.Duration, run func(context.Context) error) error {
+	if interval <= 0 {
+		return run(context.Background())
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		fmt.Printf("=== %s ===\n", time.Now().UTC().Format(time.RFC3339))
+		if err := run(ctx); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+		fmt.Println()
+	}
+}
+
+// printLink prints the explorer link of height below the line naming it.
+func printLink(height int64) {
+	if u := links.url(height, false); u != "" {
+		fmt.Printf("  explorer   : %s\n", u)
+	}
+}
+
+// printThroughput prints the blocks/hour and blocks/day equivalent of an
+// average block time, the figure fork docs and capacity plans usually quote.
+func printThroughput(avgSeconds float64) {
+	fmt.Printf("  throughput : %.1f blocks/h  (%.0f blocks/day)\n", 3600/avgSeconds, 86400/avgSeconds)
+}
+
+// resolveAsOf pins the head used by the report to -as-of-height or to the
+// last block at or before -as-of-time, so reruns produce identical output.
+func resolveAsOf(ctx context.Context, c *http.Client, base string, latest int64, latestTime time.Time, earliest, asOfHeight int64, asOfTime string) (int64, time.Time, error) {
+	switch {
+	case asOfHeight >= 0 && asOfTime != "":
+		return 0, time.Time{}, errors.New("-as-of-height and -as-of-time are mutually exclusive")
+	case asOfHeight >= 0:
+		if asOfHeight < earliest || asOfHeight > latest {
+			return 0, time.Time{}, fmt.Errorf("-as-of-height %d outside available range [%d, %d]", asOfHeight, earliest, latest)
+		}
+		t, err := getBlockTime(ctx, c, base, asOfHeight)
+		if err != nil {
+			return 0, time.Time{}, fmt.Errorf("fetch block %d: %w", asOfHeight, err)
+		}
+		return asOfHeight, t, nil
+	case asOfTime != "":
+		t, err := time.Parse(time.RFC3339Nano, asOfTime)
+		if err != nil {
+			return 0, time.Time{}, fmt.Errorf("parse -as-of-time: %w", err)
+		}
+		if !latestTime.After(t) {
+			return 0, time.Time{}, fmt.Errorf("-as-of-time %s is not before the latest block %d", asOfTime, latest)
+		}
+		// first block strictly after t, then step back one
+		h, ht, err := findBlockAtOrAfter(ctx, c, base, t.Add(time.Nanosecond), earliest, latest)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		if h == earliest && ht.After(t) {
+			return 0, time.Time{}, fmt.Errorf("-as-of-time %s is before the earliest available block %d", asOfTime, earliest)
+		}
+		if !ht.After(t) {
+			return h, ht, nil
+		}
+		prev, err := getBlockTime(ctx, c, base, h-1)
+		if err != nil {
+			return 0, time.Time{}, fmt.Errorf("fetch block %d: %w", h-1, err)
+		}
+		return h - 1, prev, nil
+	default:
+		return latest, latestTime, nil
+	}
+}
+
+// runAnchors prints the exact average between two explicit blocks, given
+// either as heights or as times resolved by binary search.
+func runAnchors(ctx context.Context, c *http.Client, base string, latest int64, latestTime time.Time, earliest, fromH, toH int64, fromT, toT string) error {
+	resolve := func(name string, h int64, ts string) (int64, time.Time, error) {
+		switch {
+		case h >= 0 && ts != "":
+			return 0, time.Time{}, fmt.Errorf("-%s-height and -%s-time are mutually exclusive", name, name)
+		case h >= 0:
+			if h < earliest || h > latest {
+				return 0, time.Time{}, fmt.Errorf("-%s-height %d outside available range [%d, %d]", name, h, earliest, latest)
+			}
+			t, err := getBlockTime(ctx, c, base, h)
+			if err != nil {
+				return 0, time.Time{}, fmt.Errorf("fetch block %d: %w", h, err)
+			}
+			return h, t, nil
+		case ts != "":
+			t, err := time.Parse(time.RFC3339Nano, ts)
+			if err != nil {
+				return 0, time.Time{}, fmt.Errorf("parse -%s-time: %w", name, err)
+			}
+			return findBlockAtOrAfter(ctx, c, base, t, earliest, latest)
+		default:
+			return latest, latestTime, nil
+		}
+	}
+
+	a, aTime, err := resolve("from", fromH, fromT)
+	if err != nil {
+		return err
+	}
+	b, bTime, err := resolve("to", toH, toT)
+	if err != nil {
+		return err
+	}
+	if a == b {
+		return fmt.Errorf("anchors resolve to the same block %d", a)
+	}
+	if a > b {
+		a, aTime, b, bTime = b, bTime, a, aTime
+	}
+
+	elapsed := bTime.Sub(aTime)
+	avgSeconds := elapsed.Seconds() / float64(b-a)
+
+	if csvMode {
+		csvRows = append(csvRows, avgRow{Lookback: strconv.FormatInt(b-a, 10), From: a, To: b, Elapsed: elapsed.Seconds(), Avg: avgSeconds})
+		return nil
+	}
+	fmt.Printf("From block: %d at %s\n", a, aTime.Format(time.RFC3339Nano))
+	printLink(a)
+	fmt.Printf("To block  : %d at %s\n", b, bTime.Format(time.RFC3339Nano))
+	printLink(b)
+	fmt.Println()
+	fmt.Printf("  blocks     : %d\n", b-a)
+	fmt.Printf("  elapsed    : %s (%.3f s)\n", formatElapsed(elapsed), elapsed.Seconds())
+	fmt.Printf("  avg block  : %.6f s/block  (%.3f ms)\n", avgSeconds, avgSeconds*1000.0)
+	printThroughput(avgSeconds)
+	return nil
+}
+
+// window is one -windows entry: its length, and the label it was given
+// as, which the report echoes rather than a normalized form.
+type window struct {
+	label string
+	d     time.Duration
+}
+
+// parseWindows parses a comma-separated list of durations. On top of
+// time.ParseDuration units it accepts "d" (days) and "w" (weeks).
+func parseWindows(s string) ([]window, error) {
+	var out []window
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var d time.Duration
+		switch {
+		case strings.HasSuffix(part, "d") || strings.HasSuffix(part, "w"):
+			n, err := strconv.ParseFloat(part[:len(part)-1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid window %q", part)
+			}
+			unit := 24 * time.Hour
+			if strings.HasSuffix(part, "w") {
+				unit *= 7
+			}
+			d = time.Duration(n * float64(unit))
+		default:
+			var err error
+			if d, err = time.ParseDuration(part); err != nil {
+				return nil, fmt.Errorf("invalid window %q", part)
+			}
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("window %q must be positive", part)
+		}
+		out = append(out, window{label: part, d: d})
+	}
+	return out, nil
+}
+
+// findBlockAtOrAfter binary-searches [lo, hi] for the first block whose
+// header time is not before t. hi is returned if no earlier block qualifies.
+func findBlockAtOrAfter(ctx context.Context, c *http.Client, base string, t time.Time, lo, hi int64) (int64, time.Time, error) {
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		midTime, err := getBlockTime(ctx, c, base, mid)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		if !midTime.Before(t) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	bt, err := getBlockTime(ctx, c, base, lo)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return lo, bt, nil
+}
+
+func formatElapsed(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	mins := d / time.Minute
+	d -= mins * time.Minute
+	secs := d / time.Second
+
+	return fmt.Sprintf("%dd %dh %dm %ds", days, hours, mins, secs)
+}
+
+// explorerURLs are the block page templates of an explorer on one network.
+// Countdown, when set, is used for heights not produced yet.
+type explorerURLs struct {
+	Block     string
+	Countdown string
+}
+
+// blockExplorers maps an -explorer preset to its templates per network.
+var blockExplorers = map[string]map[string]explorerURLs{
+	"mintscan": {
+		"mainnet": {Block: "https://www.mintscan.io/polygon/block/%d"},
+	},
+}
+
+// resolveExplorer turns -explorer into templates for network. The flag is a
+// preset name, a URL template with one %d for the height, or empty for no
+// links.
+func resolveExplorer(name, network string) (explorerURLs, error) {
+	switch {
+	case name == "":
+		return explorerURLs{}, nil
+	case strings.Count(name, "%d") == 1:
+		return explorerURLs{Block: name}, nil
+	}
+	byNetwork, ok := blockExplorers[name]
+	if !ok {
+		return explorerURLs{}, fmt.Errorf("unknown -explorer %q (use mintscan or a URL template with %%d)", name)
+	}
+	u, ok := byNetwork[network]
+	if !ok {
+		return explorerURLs{}, fmt.Errorf("-explorer %s has no links for network %q", name, network)
+	}
+	return u, nil
+}
+
+// url links height, or returns "" when links are disabled.
+func (e explorerURLs) url(height int64, future bool) string {
+	if future && e.Countdown != "" {
+		return fmt.Sprintf(e.Countdown, height)
+	}
+	if e.Block == "" {
+		return ""
+	}
+	return fmt.Sprintf(e.Block, height)
+}
+
+func getLatest(ctx context.Context, c *http.Client, base string) (height int64, t time.Time, earliest int64, err error) {
+	if offline {
+		height, earliest = headers.highest(), headers.lowest()
+		b, _ := headers.get(height)
+		return height, b.Time, earliest, nil
+	}
+	u := base + "/status"
+	var sr statusResp
+	if err = getJSON(ctx, c, u, &sr); err != nil {
+		return
+	}
+	h, err1 := strconv.ParseInt(sr.Result.SyncInfo.LatestBlockHeight, 10, 64)
+	if err1 != nil {
+		err = fmt.Errorf("parse latest height: %w", err1)
+		return
+	}
+	earliest, err1 = strconv.ParseInt(sr.Result.SyncInfo.EarliestBlockH, 10, 64)
+	if err1 != nil {
+		err = fmt.Errorf("parse earliest height: %w", err1)
+		return
+	}
+	t, err1 = parseBlockTime(sr.Result.SyncInfo.LatestBlockTime)
+	if err1 != nil {
+		err = fmt.Errorf("parse latest time: %w", err1)
+		return
+	}
+	height = h
+	return
+}
+
+func getBlockTime(ctx context.Context, c *http.Client, base string, height int64) (time.Time, error) {
+	if b, ok := headers.get(height); ok {
+		return b.Time, nil
+	}
+	if offline {
+		return time.Time{}, fmt.Errorf("block %d is not in the local store; fetch it with block_history.go sync -chain=heimdall -from=%d", height, height)
+	}
+	u := fmt.Sprintf("%s/block?height=%d", base, height)
+	var br blockResp
+	if err := getJSON(ctx, c, u, &br); err != nil {
+		return time.Time{}, err
+	}
+	t, err := parseBlockTime(br.Result.Block.Header.Time)
+	if err != nil {
+		return time.Time{}, err
+	}
+	headers.put(cachedBlock{Height: height, Hash: br.Result.BlockID.Hash, Time: t})
+	return t, nil
+}
+
+// blockCache keeps (height, hash, time) of fetched blocks, persisted to an
+// append-only JSON-lines file per network when f is set, so repeated runs
+// and binary searches don't refetch history. Tendermint blocks are final once
+// committed, so every fetched block is cached without expiry. A nil
+// *blockCache is a valid, disabled cache. With db set, blocks are persisted
+// to that database backend instead of a file.
+type blockCache struct {
+	mu      sync.Mutex
+	f       *os.File
+	db      blockstore.Store
+	entries map[int64]cachedBlock
+}
+
+type cachedBlock struct {
+	Height int64     `json:"height"`
+	Hash   string    `json:"hash,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+func defaultCacheDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".chain-utils", "cache")
+}
+
+func newBlockCache(f *os.File) *blockCache {
+	return &blockCache{f: f, entries: make(map[int64]cachedBlock)}
+}
+
+func openBlockCache(path string, maxBytes int64) (*blockCache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	c := newBlockCache(f)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var b cachedBlock
+		if json.Unmarshal(sc.Bytes(), &b) == nil {
+			c.entries[b.Height] = b
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return c, err
+	}
+	if maxBytes > 0 {
+		if err := c.shrink(path, maxBytes); err != nil {
+			c.close()
+			return nil, fmt.Errorf("shrink %s: %w", path, err)
+		}
+	}
+	return c, nil
+}
+
+// shrink rewrites the cache file to at most maxBytes when it has grown past
+// that, keeping the newest heights: old history is the cheapest to refetch
+// and the least likely to be asked for again.
+func (c *blockCache) shrink(path string, maxBytes int64) error {
+	st, err := c.f.Stat()
+	if err != nil || st.Size() <= maxBytes {
+		return err
+	}
+	heights := make([]int64, 0, len(c.entries))
+	for h := range c.entries {
+		heights = append(heights, h)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] > heights[j] })
+	var lines [][]byte
+	var size int64
+	for _, h := range heights {
+		line, _ := json.Marshal(c.entries[h])
+		if size+int64(len(line))+1 > maxBytes {
+			delete(c.entries, h)
+			continue
+		}
+		size += int64(len(line)) + 1
+		lines = append(lines, line)
+	}
+	var buf bytes.Buffer
+	for i := len(lines) - 1; i >= 0; i-- {
+		buf.Write(lines[i])
+		buf.WriteByte('\n')
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	c.f.Close()
+	c.f, err = os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o644)
+	return err
+}
+
+// openStoreCache opens the cache of network (e.g. heimdall-heimdallv2-137)
+// in the database backend at dsn, loading every block it holds.
+func openStoreCache(backend, dsn, network string) (*blockCache, error) {
+	db, err := blockstore.Open(backend, dsn, network)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := db.Load(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("load %s: %w", network, err)
+	}
+	c := newBlockCache(nil)
+	c.db = db
+	for _, b := range blocks {
+		c.entries[b.Height] = cachedBlock{Height: b.Height, Hash: b.Hash, Time: b.Time}
+	}
+	return c, nil
+}
+
+// loadStoreCache reads network's blocks from the database backend at dsn,
+// for -local-only runs; the database is closed again once they are read.
+func loadStoreCache(backend, dsn, network string) (*blockCache, error) {
+	c, err := openStoreCache(backend, dsn, network)
+	if err != nil {
+		return nil, err
+	}
+	c.db.Close()
+	c.db = nil
+	if len(c.entries) == 0 {
+		return nil, fmt.Errorf("%s holds no %s blocks", blockstore.Redact(dsn), network)
+	}
+	return c, nil
+}
+
+// loadBlockCache reads a store file without opening it for writing, for
+// -local-only runs on read-only or air-gapped hosts.
+func loadBlockCache(path string) (*blockCache, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := newBlockCache(nil)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		var b cachedBlock
+		if json.Unmarshal(sc.Bytes(), &b) == nil {
+			c.entries[b.Height] = b
+		}
+	}
+	if len(c.entries) == 0 {
+		return nil, fmt.Errorf("%s holds no blocks", path)
+	}
+	return c, sc.Err()
+}
+
+// localStorePath picks the store read by -local-only: the named network, or
+// the only one of this chain under dir.
+func localStorePath(dir, chain, network string) (string, error) {
+	if network != "" {
+		return filepath.Join(dir, chain+"-"+network+".jsonl"), nil
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, chain+"-*.jsonl"))
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no %s store in %s; sync one with block_history.go sync", chain, dir)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("several %s stores in %s; pick one with -local-network", chain, dir)
+	}
+}
+
+// highest returns the highest stored height.
+func (c *blockCache) highest() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var hi int64
+	for h := range c.entries {
+		hi = max(hi, h)
+	}
+	return hi
+}
+
+// lowest returns the lowest stored height.
+func (c *blockCache) lowest() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lo := int64(-1)
+	for h := range c.entries {
+		if lo < 0 || h < lo {
+			lo = h
+		}
+	}
+	return lo
+}
+
+func (c *blockCache) get(h int64) (cachedBlock, bool) {
+	if c == nil {
+		return cachedBlock{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.entries[h]
+	return b, ok
+}
+
+func (c *blockCache) put(b cachedBlock) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[b.Height]; ok {
+		return
+	}
+	c.entries[b.Height] = b
+	if c.db != nil {
+		if err := c.db.Add(context.Background(), []blockstore.Block{{Height: b.Height, Hash: b.Hash, Time: b.Time}}); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: write cache: %v\n", err)
+		}
+		return
+	}
+	if c.f == nil {
+		return
+	}
+	line, _ := json.Marshal(b)
+	if _, err := c.f.Write(append(line, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: write cache: %v\n", err)
+	}
+}
+
+func (c *blockCache) close() {
+	if c == nil {
+		return
+	}
+	if c.f != nil {
+		c.f.Close()
+	}
+	if c.db != nil {
+		c.db.Close()
+	}
+}
+
+// rpcMemo remembers /block?height= responses within a single run, so a block
+// is only fetched once per run even with the header cache disabled. It is
+// reset at the start of every run, so -watch still sees new data.
+type rpcMemo struct {
+	mu        sync.Mutex
+	responses map[string][]byte
+}
+
+func newRPCMemo() *rpcMemo {
+	return &rpcMemo{responses: make(map[string][]byte)}
+}
+
+func (m *rpcMemo) reset() {
+	m.mu.Lock()
+	m.responses = make(map[string][]byte)
+	m.mu.Unlock()
+}
+
+func (m *rpcMemo) get(url string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.responses[url]
+	return b, ok
+}
+
+func (m *rpcMemo) put(url string, body []byte) {
+	if !strings.Contains(url, "/block?height=") {
+		return
+	}
+	m.mu.Lock()
+	m.responses[url] = body
+	m.mu.Unlock()
+}
+
+func getJSON(ctx context.Context, c *http.Client, url string, out any) error {
+	if offline {
+		return fmt.Errorf("GET %s: network access disabled by -local-only", url)
+	}
+	if body, ok := memo.get(url); ok {
+		return json.Unmarshal(body, out)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d for %s", resp.StatusCode, url)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := checkTendermint(url, body); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return err
+	}
+	memo.put(url, body)
+	return nil
+}
+
+// flagSet reports whether the named flag was passed on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// parseBlockTime parses a Tendermint block time. Pruned or half-synced
+// nodes answer with an empty or zero time rather than an error, which
+// would otherwise surface as a nonsensical average.
+func parseBlockTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, errors.New("empty block time")
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("block time %q is not RFC3339", clip(s))
+	}
+	if t.UTC().Year() < 2000 {
+		return time.Time{}, fmt.Errorf("block time %q predates the chain; the node may have pruned the block", clip(s))
+	}
+	return t.UTC(), nil
+}
+
+// checkTendermint validates a /status or /block response when -strict is
+// set: the envelope may hold nothing beyond jsonrpc, id, result and error,
+// and the result must carry the height and time the calculations read, so
+// a provider's schema drift fails loudly instead of decoding to zero
+// values. A block must also be the one that was asked for.
+func checkTendermint(url string, body []byte) error {
+	if !strictJSON {
+		return nil
+	}
+	var header string
+	switch {
+	case strings.Contains(url, "/status"):
+		header = "sync_info"
+	case strings.Contains(url, "/block?"):
+		header = "block.header"
+	default:
+		return nil
+	}
+	var env struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Result  json.RawMessage `json:"result"`
+		Error   json.RawMessage `json:"error"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&env); err != nil {
+		return fmt.Errorf("strict: %s: %w", url, err)
+	}
+	var result map[string]any
+	if err := json.Unmarshal(env.Result, &result); err != nil || result == nil {
+		return fmt.Errorf("strict: %s: result is %s, want an object", url, clip(string(env.Result)))
+	}
+	if a, b, ok := foldedKeys(result); ok {
+		return fmt.Errorf("strict: %s: result has both %q and %q, which decode alike", url, clip(a), clip(b))
+	}
+	if header == "block.header" && result["block"] == nil && result["block_meta"] != nil {
+		// Tendermint before 0.34 answers with block_meta
+		header = "block_meta.header"
+	}
+	heightKey, timeKey := header+".height", header+".time"
+	if header == "sync_info" {
+		heightKey, timeKey = "sync_info.latest_block_height", "sync_info.latest_block_time"
+	}
+	height, ok := lookupString(result, heightKey)
+	if !ok {
+		return fmt.Errorf("strict: %s: result has no string %s", url, heightKey)
+	}
+	h, err := strconv.ParseInt(height, 10, 64)
+	if err != nil {
+		return fmt.Errorf("strict: %s: %s %q is not a height", url, heightKey, clip(height))
+	}
+	ts, ok := lookupString(result, timeKey)
+	if !ok {
+		return fmt.Errorf("strict: %s: result has no string %s", url, timeKey)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+		return fmt.Errorf("strict: %s: %s %q is not RFC3339", url, timeKey, clip(ts))
+	}
+	if _, want, found := strings.Cut(url, "height="); found && want != strconv.FormatInt(h, 10) {
+		return fmt.Errorf("strict: %s: asked for block %s, got block %d", url, want, h)
+	}
+	return nil
+}
+
+// lookupString follows a dotted path of object keys to a string.
+func lookupString(v map[string]any, path string) (string, bool) {
+	keys := strings.Split(path, ".")
+	for _, k := range keys[:len(keys)-1] {
+		if v, _ = v[k].(map[string]any); v == nil {
+			return "", false
+		}
+	}
+	s, ok := v[keys[len(keys)-1]].(string)
+	return s, ok
+}
+
+// foldedKeys returns two keys of one object anywhere in v that differ only
+// in case. encoding/json fills a struct field from either, so the strict
+// lookups could check one while the decode reads the other.
+func foldedKeys(v any) (string, string, bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		seen := make(map[string]string, len(v))
+		for k, child := range v {
+			// the folding encoding/json matches field names by
+			fold := strings.ToLower(strings.ToUpper(k))
+			if prev, ok := seen[fold]; ok {
+				return min(prev, k), max(prev, k), true
+			}
+			seen[fold] = k
+			if a, b, ok := foldedKeys(child); ok {
+				return a, b, true
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if a, b, ok := foldedKeys(child); ok {
+				return a, b, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+func failf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", a...)
+	os.Exit(1)
+}
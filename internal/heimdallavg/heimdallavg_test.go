@@ -0,0 +1,365 @@
+package heimdallavg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the calculator end to end through its
+// flags and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("HEIMDALL_AVERAGE_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// genesisTime is block 0 of the test chain. Blocks come every 2s up to
+// height 1,000,000 and every second after it, so the head, 2,000,000, is at
+// 2023-12-19T15:33:20Z.
+const genesisTime = 1_700_000_000
+
+func blockTime(h int64) time.Time {
+	s := int64(genesisTime + 2*h)
+	if h > 1_000_000 {
+		s = genesisTime + 2_000_000 + (h - 1_000_000)
+	}
+	return time.Unix(s, 0).UTC()
+}
+
+// tendermintNode is a Heimdall Tendermint RPC endpoint over the test chain.
+type tendermintNode struct {
+	head     int64
+	earliest int64          // lowest height /status admits to
+	pruned   int64          // blocks below fail although /status lists them
+	bad      map[int64]bool // blocks whose time is not RFC3339
+	every429 int            // every nth request is rate limited
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (n *tendermintNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if n.every429 > 0 && n.calls%n.every429 == 0 {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+		return
+	}
+	switch r.URL.Path {
+	case "/status":
+		fmt.Fprintf(w, `{"result":{"node_info":{"network":"heimdall-test"},"sync_info":{"latest_block_height":"%d","latest_block_time":"%s","earliest_block_height":"%d"}}}`,
+			n.head, n.time(n.head), n.earliest)
+	case "/block":
+		h, _ := strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+		if h < n.pruned || h > n.head {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error":{"code":-32603,"message":"Internal error","data":"height %d is not available"}}`, h)
+			return
+		}
+		fmt.Fprintf(w, `{"result":{"block_id":{"hash":"%064X"},"block":{"header":{"height":"%d","time":"%s"}}}}`, h, h, n.time(h))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (n *tendermintNode) time(h int64) string {
+	if n.bad[h] {
+		return "yesterday"
+	}
+	return blockTime(h).Format(time.RFC3339Nano)
+}
+
+func newTendermintNode(t *testing.T, n *tendermintNode) string {
+	t.Helper()
+	srv := httptest.NewServer(n)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs the calculator with args and returns its stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-cache-dir=", "-explorer=", "-max-head-age=0"}, args...)...)
+	cmd.Env = append(os.Environ(), "HEIMDALL_AVERAGE_RUN_MAIN=1", "HOME="+t.TempDir())
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+const healthyCSV = `lookback,from_height,to_height,elapsed_seconds,avg_block_time
+10000,1990000,2000000,10000.000,1.000000
+100000,1900000,2000000,100000.000,1.000000
+1000000,1000000,2000000,1000000.000,1.000000
+1500000,500000,2000000,2000000.000,1.333333
+`
+
+func TestAverages(t *testing.T) {
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1})
+	stdout, stderr, err := run(t, "-base="+url, "-format=csv")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if stdout != healthyCSV {
+		t.Errorf("got\n%s\nwant\n%s", stdout, healthyCSV)
+	}
+}
+
+func TestAveragesText(t *testing.T) {
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1})
+	stdout, stderr, err := run(t, "-base="+url)
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	for _, want := range []string{
+		"Current block: 2000000 at 2023-12-19T15:33:20Z (earliest available: 1)",
+		"Δ1500000   from height 500000     to 2000000",
+		"  elapsed    : 23d 3h 33m 20s",
+		"  avg block  : 1.333333 s/block  (1333.333 ms)",
+		"  throughput : 2700.0 blocks/h  (64800 blocks/day)",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestAveragesRateLimited(t *testing.T) {
+	// /status and the first block go through; the second block request is
+	// rate limited and, without retries, reported in place of its average
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1, every429: 3})
+	stdout, stderr, err := run(t, "-base="+url, "-concurrency=1")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Δ100000    ERROR fetching height 1900000: HTTP 429") {
+		t.Errorf("output does not report the rate-limited block:\n%s", stdout)
+	}
+	if !strings.Contains(stdout, "Δ10000     from height 1990000") {
+		t.Errorf("output lacks the lookback that was served:\n%s", stdout)
+	}
+}
+
+func TestAveragesPruned(t *testing.T) {
+	// A node that reports its pruning point has the deep lookbacks skipped
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1_200_000})
+	stdout, stderr, err := run(t, "-base="+url, "-format=csv")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if want := strings.Join(strings.SplitAfter(healthyCSV, "\n")[:3], ""); stdout != want {
+		t.Errorf("got\n%s\nwant\n%s", stdout, want)
+	}
+	for _, want := range []string{"target height 1000000 < earliest available 1200000", "target height 500000 < earliest available 1200000"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("stderr lacks %q:\n%s", want, stderr)
+		}
+	}
+
+	// One that does not fails the deep requests instead
+	url = newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1, pruned: 1_200_000})
+	stdout, stderr, err = run(t, "-base="+url, "-format=csv")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if strings.Contains(stdout, "500000,2000000") || !strings.Contains(stderr, "ERROR fetching height 500000: HTTP 500") {
+		t.Errorf("the pruned block should be reported, not averaged:\nstdout:\n%s\nstderr:\n%s", stdout, stderr)
+	}
+}
+
+func TestAveragesMalformed(t *testing.T) {
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1, bad: map[int64]bool{1_900_000: true}})
+	stdout, stderr, err := run(t, "-base="+url, "-format=csv")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if strings.Contains(stdout, "1900000") || !strings.Contains(stderr, `block time "yesterday" is not RFC3339`) {
+		t.Errorf("the malformed block should be reported, not averaged:\nstdout:\n%s\nstderr:\n%s", stdout, stderr)
+	}
+
+	url = newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1, bad: map[int64]bool{2_000_000: true}})
+	if _, stderr, err := run(t, "-base="+url, "-strict"); err == nil || !strings.Contains(stderr, `strict: `+url+`/status: sync_info.latest_block_time "yesterday" is not RFC3339`) {
+		t.Errorf("run -strict error = %v, want the malformed head rejected:\n%s", err, stderr)
+	}
+}
+
+func TestWindows(t *testing.T) {
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1})
+	stdout, stderr, err := run(t, "-base="+url, "-format=csv", "-windows=1d,20d")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	// 20 days reaches 728,000s into the 2s blocks: 364,000 of them, plus the
+	// 1,000,000 1s blocks since
+	want := "lookback,from_height,to_height,elapsed_seconds,avg_block_time\n1d,1913600,2000000,86400.000,1.000000\n20d,636000,2000000,1728000.000,1.266862\n"
+	if stdout != want {
+		t.Errorf("got\n%s\nwant\n%s", stdout, want)
+	}
+
+	// a window is labelled as it was passed, not normalized to days
+	stdout, stderr, err = run(t, "-base="+url, "-format=csv", "-windows=24h,1440m")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	want = "lookback,from_height,to_height,elapsed_seconds,avg_block_time\n24h,1913600,2000000,86400.000,1.000000\n1440m,1913600,2000000,86400.000,1.000000\n"
+	if stdout != want {
+		t.Errorf("got\n%s\nwant\n%s", stdout, want)
+	}
+}
+
+func TestAnchors(t *testing.T) {
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1})
+	stdout, stderr, err := run(t, "-base="+url, "-format=csv", "-from-height=999000", "-to-height=1001000")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if want := "2000,999000,1001000,3000.000,1.500000"; !strings.Contains(stdout, want) {
+		t.Errorf("got\n%s\nwant the row %s", stdout, want)
+	}
+
+	at := blockTime(1_500_000).Add(500 * time.Millisecond).Format(time.RFC3339Nano)
+	stdout, stderr, err = run(t, "-base="+url, "-format=csv", "-from-time="+at)
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if want := "499999,1500001,2000000,499999.000,1.000000"; !strings.Contains(stdout, want) {
+		t.Errorf("got\n%s\nwant the first block after -from-time as anchor: %s", stdout, want)
+	}
+}
+
+func TestAsOf(t *testing.T) {
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1})
+	for _, arg := range []string{"-as-of-height=1500000", "-as-of-time=" + blockTime(1_500_000).Add(500*time.Millisecond).Format(time.RFC3339Nano)} {
+		stdout, stderr, err := run(t, "-base="+url, "-format=csv", arg)
+		if err != nil {
+			t.Fatalf("run %s: %v\n%s", arg, err, stderr)
+		}
+		if want := "10000,1490000,1500000,10000.000,1.000000"; !strings.Contains(stdout, want) {
+			t.Errorf("%s: got\n%s\nwant the report pinned to block 1500000", arg, stdout)
+		}
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []window
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"24h, 7d,2w", []window{{"24h", 24 * time.Hour}, {"7d", 7 * 24 * time.Hour}, {"2w", 14 * 24 * time.Hour}}, false},
+		{"1.5d", []window{{"1.5d", 36 * time.Hour}}, false},
+		{"0d", nil, true},
+		{"-1h", nil, true},
+		{"soon", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseWindows(tt.in)
+		if (err != nil) != tt.wantErr || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseWindows(%q) = %v, %v, want %v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseBlockTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{"2023-12-19T15:33:20.123456789Z", "2023-12-19T15:33:20.123456789Z", ""},
+		{"2023-12-19T17:33:20+02:00", "2023-12-19T15:33:20Z", ""},
+		{"", "", "empty"},
+		{"yesterday", "", "not RFC3339"},
+		{"0001-01-01T00:00:00Z", "", "pruned"},
+	}
+	for _, tt := range tests {
+		got, err := parseBlockTime(tt.in)
+		switch {
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseBlockTime(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+			}
+		case err != nil || got.Format(time.RFC3339Nano) != tt.want:
+			t.Errorf("parseBlockTime(%q) = %v, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatElapsed(t *testing.T) {
+	if got := formatElapsed(-(26*time.Hour + 61*time.Second)); got != "1d 2h 1m 1s" {
+		t.Errorf("formatElapsed = %q, want 1d 2h 1m 1s", got)
+	}
+}
+
+// FuzzParseBlockTime checks that a block time either yields a UTC time no
+// earlier than 2000, which reads back as itself, or fails.
+func FuzzParseBlockTime(f *testing.F) {
+	for _, s := range []string{"2023-12-19T15:33:20Z", "2023-12-19T15:33:20.123456789Z", "2023-12-19T16:33:20+01:00", "2000-01-01T00:30:00+01:00", "0001-01-01T00:00:00Z", "yesterday", ""} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		got, err := parseBlockTime(s)
+		if err != nil {
+			return
+		}
+		if got.Location() != time.UTC || got.Year() < 2000 {
+			t.Errorf("parseBlockTime(%q) = %v", s, got)
+		}
+		if back, err := parseBlockTime(got.Format(time.RFC3339Nano)); err != nil || !back.Equal(got) {
+			t.Errorf("parseBlockTime(%q) = %v, which reads back as %v, %v", s, got, back, err)
+		}
+	})
+}
+
+// FuzzCheckTendermint feeds arbitrary /block answers to the -strict check.
+// Nothing may panic, and an answer it accepts must decode to the block
+// asked for, at the time it checked.
+func FuzzCheckTendermint(f *testing.F) {
+	for _, s := range []string{
+		`{"jsonrpc":"2.0","id":-1,"result":{"block_id":{"hash":"AB"},"block":{"header":{"height":"5","time":"2023-12-19T15:33:20Z"}}}}`,
+		`{"result":{"block_meta":{"header":{"height":"5","time":"2023-12-19T15:33:20Z"}}}}`,
+		`{"result":{"block":{"header":{"height":"6","time":"2023-12-19T15:33:20Z"}}}}`,
+		`{"result":{"block":{"header":{"height":"5","time":"2023-12-19T15:33:20Z"}},"Block":{"header":{"height":"6","time":"yesterday"}}}}`,
+		`{"result":{"block":{"header":{"height":5,"time":"2023-12-19T15:33:20Z"}}}}`,
+		`{"result":null,"error":{"code":-32603}}`,
+		`{"result":{},"extra":1}`,
+		`<html>502 Bad Gateway</html>`,
+	} {
+		f.Add([]byte(s))
+	}
+	strictJSON = true
+	f.Fuzz(func(t *testing.T, body []byte) {
+		if err := checkTendermint("http://node/block?height=5", body); err != nil {
+			return
+		}
+		var br blockResp
+		if err := json.Unmarshal(body, &br); err != nil {
+			t.Fatalf("accepted %s, which does not decode: %v", body, err)
+		}
+		var raw struct {
+			Result map[string]map[string]map[string]any `json:"result"`
+		}
+		if json.Unmarshal(body, &raw) != nil || raw.Result["block"] == nil {
+			return // block_meta, which blockResp does not read
+		}
+		h := br.Result.Block.Header
+		if h.Height != "5" || h.Time != raw.Result["block"]["header"]["time"] {
+			t.Errorf("accepted %s, which decodes to block %q at %q", body, h.Height, h.Time)
+		}
+	})
+}
@@ -0,0 +1,7 @@
+//go:build sqlite
+
+package heimdallavg
+
+import "testing"
+
+func TestSQLiteCache(t *testing.T) { testDatabaseCache(t, "sqlite") }
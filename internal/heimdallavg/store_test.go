@@ -0,0 +1,37 @@
+//go:build sqlite || bbolt || badger
+
+package heimdallavg
+
+import (
+	"strings"
+	"testing"
+)
+
+// testDatabaseCache runs against a database backend twice, then offline.
+func testDatabaseCache(t *testing.T, backend string) {
+	node := &tendermintNode{head: 2_000_000, earliest: 1}
+	url := newTendermintNode(t, node)
+	dir := t.TempDir()
+	args := []string{"-base=" + url, "-cache-dir=" + dir, "-cache-backend=" + backend, "-format=csv"}
+
+	if stdout, stderr, err := run(t, args...); err != nil || stdout != healthyCSV {
+		t.Fatalf("first run: %v\n%s%s", err, stdout, stderr)
+	}
+	first := node.calls
+
+	// Heimdall blocks are final once committed, so the rerun reads every
+	// lookback block from the database and only asks for the head
+	stdout, stderr, err := run(t, args...)
+	if err != nil || stdout != healthyCSV {
+		t.Fatalf("second run: %v\n%s%s", err, stdout, stderr)
+	}
+	if n := node.calls - first; n >= first || n > 3 {
+		t.Errorf("second run made %d requests, the first %d", n, first)
+	}
+
+	// -local-only answers from the database without the endpoint
+	stdout, stderr, err = run(t, "-base=http://127.0.0.1:1", "-cache-dir="+dir, "-cache-backend="+backend, "-local-only", "-local-network=heimdall-test", "-format=csv", "-from-height=1000000", "-to-height=1900000")
+	if err != nil || !strings.Contains(stdout, "1000000,1900000,900000.000,1.000000") {
+		t.Errorf("-local-only: %v\n%s%s", err, stdout, stderr)
+	}
+}
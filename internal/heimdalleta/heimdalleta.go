@@ -0,0 +1,593 @@
+// Package heimdalleta is heimdall_block_time_estimator.go: it estimates when
+// a Heimdall height will be produced.
+package heimdalleta
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/blocktime"
+	"github.com/pratikspatil024/chain-utils/fixtures"
+	"github.com/pratikspatil024/chain-utils/pkg/fetch"
+	"github.com/pratikspatil024/chain-utils/pkg/ledger"
+)
+
+const (
+	// the last -lookback blocks are split into sampleWindows windows whose
+	// averages give the spread used for the arrival window
+	sampleWindows = 10
+
+	// fetchConcurrency bounds the block requests in flight at once
+	fetchConcurrency = 4
+)
+
+// tendermintAPIs are the Heimdall Tendermint APIs -network selects.
+var tendermintAPIs = map[string]string{
+	"mainnet": "https://tendermint-api.polygon.technology",
+	"amoy":    "https://tendermint-api-amoy.polygon.technology",
+}
+
+// heimdallNetworks maps the network id a node reports in /status to the
+// -network name it belongs to.
+var heimdallNetworks = map[string]string{
+	"heimdall-137":     "mainnet",
+	"heimdallv2-137":   "mainnet",
+	"heimdall-80002":   "amoy",
+	"heimdallv2-80002": "amoy",
+}
+
+type arrivalReport struct {
+	TargetHeight    int     `json:"target_height"`
+	TargetURL       string  `json:"target_url,omitempty"`
+	CurrentHeight   int     `json:"current_height"`
+	CurrentTime     string  `json:"current_time"`
+	BlocksLeft      int     `json:"blocks_left"`
+	AvgBlockTime    float64 `json:"avg_block_time_seconds"`
+	StdDevBlockTime float64 `json:"stddev_block_time_seconds"`
+	EstimatedTime   string  `json:"estimated_time"`
+	Confidence      float64 `json:"confidence"`
+	Earliest        string  `json:"earliest"`
+	Latest          string  `json:"latest"`
+	Statement       string  `json:"statement"`
+}
+
+// fetchStatus reads the latest committed height from Tendermint's /status,
+// and the network id the node reports, which may be empty.
+func fetchStatus(ctx context.Context, client *http.Client, base string) (int, string, error) {
+	var result struct {
+		Result struct {
+			NodeInfo struct {
+				Network string `json:"network"`
+			} `json:"node_info"`
+			SyncInfo struct {
+				LatestBlockHeight string `json:"latest_block_height"`
+			} `json:"sync_info"`
+		} `json:"result"`
+	}
+	if err := getJSON(ctx, client, base+"/status", &result); err != nil {
+		return 0, "", fmt.Errorf("get status: %w", err)
+	}
+	h, err := strconv.Atoi(result.Result.SyncInfo.LatestBlockHeight)
+	if err != nil {
+		return 0, "", fmt.Errorf("parse latest height: %w", err)
+	}
+	return h, result.Result.NodeInfo.Network, nil
+}
+
+// fetchBlockTime reads the time of block height. Tendermint 0.34 and
+// CometBFT answer with result.block; older nodes with result.block_meta.
+func fetchBlockTime(ctx context.Context, client *http.Client, base string, height int) (time.Time, error) {
+	type header struct {
+		Header struct {
+			Time string `json:"time"`
+		} `json:"header"`
+	}
+	var result struct {
+		Result struct {
+			Block     header `json:"block"`
+			BlockMeta header `json:"block_meta"`
+		} `json:"result"`
+	}
+	if err := getJSON(ctx, client, fmt.Sprintf("%s/block?height=%d", base, height), &result); err != nil {
+		return time.Time{}, fmt.Errorf("get block %d: %w", height, err)
+	}
+	ts := result.Result.Block.Header.Time
+	if ts == "" {
+		ts = result.Result.BlockMeta.Header.Time
+	}
+	t, err := parseBlockTime(ts)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("block %d: %w", height, err)
+	}
+	return t, nil
+}
+
+// getJSON fetches url into out. The request is bound to ctx, so an
+// interrupted -watch aborts it instead of waiting for the server.
+func getJSON(ctx context.Context, client *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d for %s", resp.StatusCode, req.URL)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := checkTendermint(url, body); err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+// strictJSON is set by -strict; see checkTendermint.
+var strictJSON bool
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	targetBlock := flag.Int("height", 0, "Heimdall height whose arrival is estimated (required)")
+	flag.IntVar(targetBlock, "target", 0, "Alias of -height")
+	network := flag.String("network", "amoy", "Heimdall network: mainnet or amoy (with -base, default: the network the endpoint reports)")
+	base := flag.String("base", "", "Tendermint API (default: the -network preset)")
+	lookback := flag.Int("lookback", 2000, "Blocks below the head the average and its spread are sampled over")
+	confidence := flag.Float64("confidence", 0.9, "Probability covered by the arrival window (0 < p < 1)")
+	format := flag.String("format", "text", "Output format: text or json")
+	asOfHeight := flag.Int("as-of-height", -1, "Pin the estimate to this height instead of the latest one (reproducible output)")
+	watch := flag.Duration("watch", 0, "Recompute the estimate every interval (e.g. 1m) until interrupted")
+	ledgerPath := flag.String("ledger", ledger.DefaultPath(), "Prediction ledger each unpinned estimate is appended to: a JSON-lines file, or a postgres:// URL shared by a team (empty disables it)")
+	explorer := flag.String("explorer", "", "Block URL template with one %d the target height is linked with (empty for none)")
+	timeout := flag.Duration("timeout", 15*time.Second, "HTTP request timeout")
+	strict := flag.Bool("strict", false, "Reject Tendermint responses with unexpected envelope fields, or a missing or malformed height or time, instead of decoding what is there")
+	replayPath := flag.String("replay", "", "Answer from a recorded dataset instead of the network: builtin:mainnet, builtin:amoy or a fixture file")
+	flag.Parse()
+	strictJSON = *strict
+	failJSON = *format == "json"
+
+	if *format != "text" && *format != "json" {
+		failf("unknown -format %q (use text or json)", *format)
+	}
+	if flagSet("height") && flagSet("target") {
+		failf("-target is an alias of -height; pass one of them")
+	}
+	if *targetBlock < 1 {
+		failf("-height is required: pass the Heimdall height whose arrival is estimated")
+	}
+	if *confidence <= 0 || *confidence >= 1 {
+		failf("confidence must be between 0 and 1, got %v", *confidence)
+	}
+	if *explorer != "" && strings.Count(*explorer, "%d") != 1 {
+		failf("-explorer must contain exactly one %%d, got %q", *explorer)
+	}
+
+	var replayer http.RoundTripper
+	if *replayPath != "" {
+		fix, err := fixtures.Load(*replayPath)
+		if err == nil {
+			replayer, err = fixtures.NewTendermint(fix)
+		}
+		if err != nil {
+			failf("-replay: %v", err)
+		}
+		// Replayed estimates say nothing about the live chain
+		*ledgerPath = ""
+		fmt.Fprintln(os.Stderr, fix.Banner(*replayPath))
+	}
+
+	if *base == "" {
+		var ok bool
+		if *base, ok = tendermintAPIs[*network]; !ok {
+			failf("unknown -network %q (use mainnet or amoy, or pass -base)", *network)
+		}
+	}
+	*base = strings.TrimRight(*base, "/")
+	if *lookback < 2*sampleWindows {
+		failf("-lookback must be at least %d blocks", 2*sampleWindows)
+	}
+	windowSize := *lookback / sampleWindows
+	failEndpoint = *base
+
+	client := &http.Client{Timeout: *timeout, Transport: replayer}
+	run := func(ctx context.Context) error {
+		h1, nodeNetwork, err := fetchStatus(ctx, client, *base)
+		if err != nil {
+			return err
+		}
+		// The ledger and the report name the network the endpoint serves,
+		// not the -network default
+		if name, ok := heimdallNetworks[nodeNetwork]; ok && name != *network {
+			if flagSet("network") {
+				return fmt.Errorf("%s serves %s (%s), but -network=%s", *base, name, nodeNetwork, *network)
+			}
+			*network = name
+		} else if !ok && nodeNetwork != "" && !flagSet("network") {
+			*network = nodeNetwork
+		}
+		if *asOfHeight >= 0 {
+			if *asOfHeight > h1 {
+				return fmt.Errorf("as-of-height %d is beyond the latest height %d", *asOfHeight, h1)
+			}
+			h1 = *asOfHeight
+		}
+
+		sampled := sampleWindows * windowSize
+		if h1-sampled < 1 {
+			return fmt.Errorf("-lookback %d reaches below height 1 from %d", *lookback, h1)
+		}
+
+		// times[i] is the block time at h1 - i*windowSize
+		times := make([]time.Time, sampleWindows+1)
+		g := fetch.NewGroup(ctx, fetchConcurrency)
+		for i := range times {
+			g.Go(func(ctx context.Context) (err error) {
+				times[i], err = fetchBlockTime(ctx, client, *base, h1-i*windowSize)
+				return err
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		t1 := times[0]
+
+		// Compute average block time over the whole sample, and the spread of
+		// the per-window averages around it
+		avgBlockTime := t1.Sub(times[sampleWindows]).Seconds() / float64(sampled)
+		var sumSq float64
+		for i := 0; i < sampleWindows; i++ {
+			w := times[i].Sub(times[i+1]).Seconds() / float64(windowSize)
+			sumSq += (w - avgBlockTime) * (w - avgBlockTime)
+		}
+		// A window average of n blocks has variance sigma^2/n, so scale back up
+		// to a per-block standard deviation
+		stdDev := math.Sqrt(sumSq/float64(sampleWindows-1)) * math.Sqrt(float64(windowSize))
+
+		blocksLeft := *targetBlock - h1
+		estimatedTime := t1.Add(blocktime.Span(int64(blocksLeft), avgBlockTime))
+
+		// Arrival time is a sum of blocksLeft intervals, so its spread grows with
+		// the square root of the distance
+		z := math.Sqrt2 * math.Erfinv(*confidence)
+		margin := time.Duration(z * stdDev * math.Sqrt(math.Max(float64(blocksLeft), 0)) * float64(time.Second))
+		earliest, latest := estimatedTime.Add(-margin), estimatedTime.Add(margin)
+
+		report := arrivalReport{
+			TargetHeight:    *targetBlock,
+			CurrentHeight:   h1,
+			CurrentTime:     t1.Format(time.RFC3339Nano),
+			BlocksLeft:      blocksLeft,
+			AvgBlockTime:    avgBlockTime,
+			StdDevBlockTime: stdDev,
+			EstimatedTime:   estimatedTime.Format(time.RFC3339Nano),
+			Confidence:      *confidence,
+			Earliest:        earliest.Format(time.RFC3339),
+			Latest:          latest.Format(time.RFC3339),
+			Statement:       arrivalStatement(*confidence, earliest, latest),
+		}
+		if *explorer != "" {
+			report.TargetURL = fmt.Sprintf(*explorer, *targetBlock)
+		}
+		if blocksLeft <= 0 {
+			report.Statement = fmt.Sprintf("height %d already reached", *targetBlock)
+		}
+
+		// Record the estimate and settle earlier ones that are now verifiable
+		if *asOfHeight < 0 && *ledgerPath != "" && blocksLeft > 0 {
+			e := ledger.Entry{
+				RecordedAt:    time.Now().UTC(),
+				Network:       *network,
+				Chain:         "heimdall",
+				Estimator:     "recent-mean",
+				TargetHeight:  int64(*targetBlock),
+				PredictedTime: estimatedTime.UTC(),
+				Inputs:        &ledger.Inputs{HeadHeight: int64(h1), HeadTime: t1, AvgBlockTime: avgBlockTime},
+			}
+			blockTime := func(h int64) (time.Time, error) { return fetchBlockTime(ctx, client, *base, int(h)) }
+			if err := ledger.Record(*ledgerPath, e, int64(h1), blockTime); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: record prediction: %v\n", err)
+			}
+		}
+
+		switch *format {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				return err
+			}
+		case "text":
+			fmt.Printf("Target height (%s): %d\n", *network, *targetBlock)
+			if report.TargetURL != "" {
+				fmt.Println("Explorer:", report.TargetURL)
+			}
+			fmt.Println("Current height:", h1)
+			fmt.Printf("Average block time of last %d blocks: %.2f seconds (σ %.2f)\n", sampled, avgBlockTime, stdDev)
+			fmt.Println("Estimated arrival:", report.EstimatedTime)
+			fmt.Println(report.Statement)
+		default:
+			return fmt.Errorf("unknown format %q (use text or json)", *format)
+		}
+		return nil
+	}
+
+	if err := runWatch(*watch, run); err != nil {
+		failf("%v", err)
+	}
+}
+
+// runWatch calls run once, or with a positive interval keeps calling it on
+// that interval until interrupted. Failures inside the loop are reported and
+// retried on the next tick instead of exiting.
+func runWatch(interval time.Duration, run func(context.Context) error) error {
+	if interval <= 0 {
+		return run(context.Background())
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		fmt.Printf("=== %s ===\n", time.Now().UTC().Format(time.RFC3339))
+		if err := run(ctx); err != nil && ctx.Err() == nil {
+			printFailure(err, err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+		fmt.Println()
+	}
+}
+
+// arrivalStatement renders e.g. "90% probability of arrival between 13:40
+// and 15:05 UTC on Oct 7".
+func arrivalStatement(confidence float64, earliest, latest time.Time) string {
+	earliest, latest = earliest.UTC(), latest.UTC()
+	pct := strconv.FormatFloat(confidence*100, 'f', -1, 64)
+	if earliest.YearDay() == latest.YearDay() && earliest.Year() == latest.Year() {
+		return fmt.Sprintf("%s%% probability of arrival between %s and %s UTC on %s",
+			pct, earliest.Format("15:04"), latest.Format("15:04"), earliest.Format("Jan 2"))
+	}
+	return fmt.Sprintf("%s%% probability of arrival between %s UTC on %s and %s UTC on %s",
+		pct, earliest.Format("15:04"), earliest.Format("Jan 2"), latest.Format("15:04"), latest.Format("Jan 2"))
+}
+
+// parseBlockTime parses a Tendermint block time. Pruned or half-synced
+// nodes answer with an empty or zero time rather than an error, which
+// would otherwise surface as a nonsensical average.
+func parseBlockTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, errors.New("empty block time")
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("block time %q is not RFC3339", clip(s))
+	}
+	if t.UTC().Year() < 2000 {
+		return time.Time{}, fmt.Errorf("block time %q predates the chain; the node may have pruned the block", clip(s))
+	}
+	return t.UTC(), nil
+}
+
+// checkTendermint validates a /status or /block response when -strict is
+// set: the envelope may hold nothing beyond jsonrpc, id, result and error,
+// and the result must carry the height and time the calculations read, so
+// a provider's schema drift fails loudly instead of decoding to zero
+// values. A block must also be the one that was asked for.
+func checkTendermint(url string, body []byte) error {
+	if !strictJSON {
+		return nil
+	}
+	var header string
+	switch {
+	case strings.Contains(url, "/status"):
+		header = "sync_info"
+	case strings.Contains(url, "/block?"):
+		header = "block.header"
+	default:
+		return nil
+	}
+	var env struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Result  json.RawMessage `json:"result"`
+		Error   json.RawMessage `json:"error"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&env); err != nil {
+		return fmt.Errorf("strict: %s: %w", url, err)
+	}
+	var result map[string]any
+	if err := json.Unmarshal(env.Result, &result); err != nil || result == nil {
+		return fmt.Errorf("strict: %s: result is %s, want an object", url, clip(string(env.Result)))
+	}
+	if a, b, ok := foldedKeys(result); ok {
+		return fmt.Errorf("strict: %s: result has both %q and %q, which decode alike", url, clip(a), clip(b))
+	}
+	if header == "block.header" && result["block"] == nil && result["block_meta"] != nil {
+		// Tendermint before 0.34 answers with block_meta
+		header = "block_meta.header"
+	}
+	heightKey, timeKey := header+".height", header+".time"
+	if header == "sync_info" {
+		heightKey, timeKey = "sync_info.latest_block_height", "sync_info.latest_block_time"
+	}
+	height, ok := lookupString(result, heightKey)
+	if !ok {
+		return fmt.Errorf("strict: %s: result has no string %s", url, heightKey)
+	}
+	h, err := strconv.ParseInt(height, 10, 64)
+	if err != nil {
+		return fmt.Errorf("strict: %s: %s %q is not a height", url, heightKey, clip(height))
+	}
+	ts, ok := lookupString(result, timeKey)
+	if !ok {
+		return fmt.Errorf("strict: %s: result has no string %s", url, timeKey)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+		return fmt.Errorf("strict: %s: %s %q is not RFC3339", url, timeKey, clip(ts))
+	}
+	if _, want, found := strings.Cut(url, "height="); found && want != strconv.FormatInt(h, 10) {
+		return fmt.Errorf("strict: %s: asked for block %s, got block %d", url, want, h)
+	}
+	return nil
+}
+
+// lookupString follows a dotted path of object keys to a string.
+func lookupString(v map[string]any, path string) (string, bool) {
+	keys := strings.Split(path, ".")
+	for _, k := range keys[:len(keys)-1] {
+		if v, _ = v[k].(map[string]any); v == nil {
+			return "", false
+		}
+	}
+	s, ok := v[keys[len(keys)-1]].(string)
+	return s, ok
+}
+
+// foldedKeys returns two keys of one object anywhere in v that differ only
+// in case. encoding/json fills a struct field from either, so the strict
+// lookups could check one while the decode reads the other.
+func foldedKeys(v any) (string, string, bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		seen := make(map[string]string, len(v))
+		for k, child := range v {
+			// the folding encoding/json matches field names by
+			fold := strings.ToLower(strings.ToUpper(k))
+			if prev, ok := seen[fold]; ok {
+				return min(prev, k), max(prev, k), true
+			}
+			seen[fold] = k
+			if a, b, ok := foldedKeys(child); ok {
+				return a, b, true
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if a, b, ok := foldedKeys(child); ok {
+				return a, b, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+// failJSON is set by -format=json: failures are then printed on stdout as
+// a JSON failure, for orchestration, instead of as text on stderr.
+var failJSON bool
+
+// failEndpoint is the endpoint the run talks to. It is set once requests
+// start, so a failure without one is an input error.
+var failEndpoint string
+
+// failure describes an error for machines: a stable code, its category,
+// the endpoint involved and whether rerunning the same command may succeed.
+type failure struct {
+	Code      string `json:"code"`
+	Category  string `json:"category"` // input, network, provider, data or runtime
+	Message   string `json:"message"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	Retryable bool   `json:"retryable"`
+}
+
+// newFailure classifies err, whose text is msg, met talking to endpoint.
+// Most errors reach here flattened into text, so the text is matched too.
+func newFailure(err error, msg, endpoint string) failure {
+	f := failure{Message: msg, Endpoint: endpoint}
+	var ne net.Error
+	lower := strings.ToLower(msg)
+	has := func(subs ...string) bool {
+		for _, s := range subs {
+			if strings.Contains(lower, s) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case endpoint == "":
+		f.Code, f.Category = "invalid_input", "input"
+	case has("retry budget exhausted"):
+		f.Code, f.Category, f.Retryable = "retry_budget_exhausted", "network", true
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout(), has("timeout", "deadline exceeded"):
+		f.Code, f.Category, f.Retryable = "timeout", "network", true
+	case has("http 429", "too many requests", "rate limit"):
+		f.Code, f.Category, f.Retryable = "rate_limited", "provider", true
+	case has("http 5"):
+		f.Code, f.Category, f.Retryable = "server_error", "provider", true
+	case has("http 4"):
+		f.Code, f.Category = "request_rejected", "provider"
+	case has("implausible"):
+		// A stale head or a lagging node usually catches up
+		f.Code, f.Category, f.Retryable = "implausible_data", "data", true
+	case has("strict:", "invalid character", "cannot unmarshal", "unexpected end of json"):
+		f.Code, f.Category = "malformed_response", "provider"
+	case errors.As(err, &ne), has("connection refused", "connection reset", "no such host", "eof"):
+		f.Code, f.Category, f.Retryable = "unreachable", "network", true
+	default:
+		f.Code, f.Category = "failed", "runtime"
+	}
+	return f
+}
+
+// printFailure reports a failure of the run: as JSON on stdout under
+// -format=json, otherwise as text on stderr.
+func printFailure(err error, msg string) {
+	if !failJSON {
+		fmt.Fprintf(os.Stderr, "error: %s\n", msg)
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(struct {
+		Error failure `json:"error"`
+	}{newFailure(err, msg, failEndpoint)})
+}
+
+// flagSet reports whether the named flag was passed on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+func failf(format string, a ...any) {
+	// The last error among the arguments is the one to classify
+	var err error
+	for _, v := range a {
+		if e, ok := v.(error); ok {
+			err = e
+		}
+	}
+	printFailure(err, fmt.Sprintf(format, a...))
+	os.Exit(1)
+}
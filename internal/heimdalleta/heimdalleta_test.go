@@ -0,0 +1,266 @@
+package heimdalleta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the estimator end to end through its
+// flags and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("HEIMDALL_ESTIMATOR_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// genesisTime is block 0 of the test chain. Blocks come every 2s up to
+// height 1,000,000 and every second after it, so the head, 2,000,000, is at
+// 2023-12-19T15:33:20Z.
+const genesisTime = 1_700_000_000
+
+func blockTime(h int64) time.Time {
+	s := int64(genesisTime + 2*h)
+	if h > 1_000_000 {
+		s = genesisTime + 2_000_000 + (h - 1_000_000)
+	}
+	return time.Unix(s, 0).UTC()
+}
+
+// tendermintNode is a Heimdall Tendermint RPC endpoint over the test chain.
+type tendermintNode struct {
+	head     int64
+	pruned   int64          // blocks below fail as on a pruned node
+	bad      map[int64]bool // blocks whose time is not RFC3339
+	meta     bool           // answer /block as Tendermint before 0.34 did
+	network  string         // node_info.network in /status, if any
+	every429 int            // every nth request is rate limited
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (n *tendermintNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if n.every429 > 0 && n.calls%n.every429 == 0 {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+		return
+	}
+	switch r.URL.Path {
+	case "/status":
+		fmt.Fprintf(w, `{"result":{"node_info":{"network":%q},"sync_info":{"latest_block_height":"%d","latest_block_time":"%s"}}}`, n.network, n.head, blockTime(n.head).Format(time.RFC3339Nano))
+	case "/block":
+		h, _ := strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+		if h < n.pruned || h > n.head {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error":{"code":-32603,"message":"Internal error","data":"height %d is not available"}}`, h)
+			return
+		}
+		ts := blockTime(h).Format(time.RFC3339Nano)
+		if n.bad[h] {
+			ts = "yesterday"
+		}
+		key := "block"
+		if n.meta {
+			key = "block_meta"
+		}
+		fmt.Fprintf(w, `{"result":{%q:{"header":{"height":"%d","time":"%s"}}}}`, key, h, ts)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTendermintNode(t *testing.T, n *tendermintNode) string {
+	t.Helper()
+	srv := httptest.NewServer(n)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs the estimator with args and returns its stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-ledger="}, args...)...)
+	cmd.Env = append(os.Environ(), "HEIMDALL_ESTIMATOR_RUN_MAIN=1", "HOME="+t.TempDir())
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// estimate runs the estimator with -format=json and decodes its report.
+func estimate(t *testing.T, args ...string) arrivalReport {
+	t.Helper()
+	stdout, stderr, err := run(t, append([]string{"-format=json"}, args...)...)
+	if err != nil {
+		t.Fatalf("run: %v\n%s%s", err, stdout, stderr)
+	}
+	var r arrivalReport
+	if err := json.Unmarshal([]byte(stdout), &r); err != nil {
+		t.Fatalf("decode report: %v\n%s", err, stdout)
+	}
+	return r
+}
+
+func TestEstimate(t *testing.T) {
+	for _, meta := range []bool{false, true} {
+		url := newTendermintNode(t, &tendermintNode{head: 2_000_000, meta: meta})
+		r := estimate(t, "-base="+url, "-height=2003600")
+		want := arrivalReport{
+			TargetHeight:  2_003_600,
+			CurrentHeight: 2_000_000,
+			CurrentTime:   "2023-12-19T15:33:20Z",
+			BlocksLeft:    3600,
+			AvgBlockTime:  1,
+			EstimatedTime: "2023-12-19T16:33:20Z",
+			Confidence:    0.9,
+			Earliest:      "2023-12-19T16:33:20Z",
+			Latest:        "2023-12-19T16:33:20Z",
+			Statement:     "90% probability of arrival between 16:33 and 16:33 UTC on Dec 19",
+		}
+		if r != want {
+			t.Errorf("block_meta %v: report = %+v, want %+v", meta, r, want)
+		}
+	}
+}
+
+func TestEstimateSpread(t *testing.T) {
+	// Pinned 100 blocks past the switch from 2s to 1s blocks, the newest of
+	// the ten 200-block windows averages 1.5s and the other nine 2s
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000})
+	r := estimate(t, "-base="+url, "-as-of-height=1000100", "-height=1001100")
+	if r.AvgBlockTime != 1.95 || math.Abs(r.StdDevBlockTime-math.Sqrt(5)) > 1e-9 {
+		t.Errorf("avg %v σ %v, want 1.95 and √5", r.AvgBlockTime, r.StdDevBlockTime)
+	}
+	// 1,000 blocks at 1.95s from 01:48:20, give or take 1.645·√5·√1000s
+	if r.EstimatedTime != "2023-12-08T02:20:50Z" || r.Earliest != "2023-12-08T02:18:53Z" || r.Latest != "2023-12-08T02:22:46Z" {
+		t.Errorf("report = %+v, want arrival at 02:20:50 between 02:18:53 and 02:22:46", r)
+	}
+	if r.Statement != "90% probability of arrival between 02:18 and 02:22 UTC on Dec 8" {
+		t.Errorf("statement = %q", r.Statement)
+	}
+}
+
+func TestEstimateReached(t *testing.T) {
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000})
+	r := estimate(t, "-base="+url, "-height=1999000")
+	if r.BlocksLeft != -1000 || r.Statement != "height 1999000 already reached" {
+		t.Errorf("report = %+v, want the target reported as reached", r)
+	}
+}
+
+func TestEstimateText(t *testing.T) {
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000})
+	stdout, stderr, err := run(t, "-base="+url, "-height=2003600", "-explorer=https://example.com/block/%d")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	want := `Target height (amoy): 2003600
+Explorer: https://example.com/block/2003600
+Current height: 2000000
+Average block time of last 2000 blocks: 1.00 seconds (σ 0.00)
+Estimated arrival: 2023-12-19T16:33:20Z
+90% probability of arrival between 16:33 and 16:33 UTC on Dec 19
+`
+	if stdout != want {
+		t.Errorf("got\n%s\nwant\n%s", stdout, want)
+	}
+}
+
+func TestEstimateNetwork(t *testing.T) {
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000, network: "heimdallv2-137"})
+	ledger := filepath.Join(t.TempDir(), "predictions.jsonl")
+	stdout, stderr, err := run(t, "-base="+url, "-height=2003600", "-ledger="+ledger)
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if !strings.HasPrefix(stdout, "Target height (mainnet): 2003600\n") {
+		t.Errorf("report does not name the endpoint's network:\n%s", stdout)
+	}
+	if b, err := os.ReadFile(ledger); err != nil || !strings.Contains(string(b), `"network":"mainnet"`) {
+		t.Errorf("ledger = %s, %v, want the estimate recorded for mainnet", b, err)
+	}
+
+	_, stderr, err = run(t, "-base="+url, "-height=2003600", "-network=amoy")
+	if err == nil || !strings.Contains(stderr, "serves mainnet (heimdallv2-137), but -network=amoy") {
+		t.Errorf("run error = %v, want the mismatched -network caught:\n%s", err, stderr)
+	}
+
+	_, stderr, err = run(t, "-base="+url)
+	if err == nil || !strings.Contains(stderr, "-height is required") {
+		t.Errorf("run error = %v, want -height required:\n%s", err, stderr)
+	}
+}
+
+func TestEstimateFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		node      *tendermintNode
+		args      []string
+		code      string
+		retryable bool
+		message   string
+	}{
+		{"rate limited", &tendermintNode{head: 2_000_000, every429: 2}, nil, "rate_limited", true, "HTTP 429"},
+		{"pruned", &tendermintNode{head: 2_000_000, pruned: 1_998_001}, nil, "server_error", true, "get block 1998000: HTTP 500"},
+		{"malformed", &tendermintNode{head: 2_000_000, bad: map[int64]bool{1_999_800: true}}, nil, "failed", false, `block 1999800: block time "yesterday" is not RFC3339`},
+		{"malformed with -strict", &tendermintNode{head: 2_000_000, bad: map[int64]bool{1_999_800: true}}, []string{"-strict"}, "malformed_response", false, `block.header.time "yesterday" is not RFC3339`},
+		{"lookback below genesis", &tendermintNode{head: 1000}, nil, "failed", false, "-lookback 2000 reaches below height 1 from 1000"},
+		{"bad confidence", &tendermintNode{head: 2_000_000}, []string{"-confidence=1"}, "invalid_input", false, "confidence must be between 0 and 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := newTendermintNode(t, tt.node)
+			stdout, _, err := run(t, append([]string{"-base=" + url, "-format=json", "-height=2003600"}, tt.args...)...)
+			if err == nil {
+				t.Fatalf("run succeeded:\n%s", stdout)
+			}
+			var got struct {
+				Error failure `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+				t.Fatalf("decode failure: %v\n%s", err, stdout)
+			}
+			if got.Error.Code != tt.code || got.Error.Retryable != tt.retryable || !strings.Contains(got.Error.Message, tt.message) {
+				t.Errorf("failure = %+v, want code %s (retryable %v) with %q", got.Error, tt.code, tt.retryable, tt.message)
+			}
+		})
+	}
+}
+
+func TestArrivalStatement(t *testing.T) {
+	at := func(s string) time.Time {
+		t, _ := time.Parse(time.RFC3339, s)
+		return t
+	}
+	tests := []struct {
+		confidence       float64
+		earliest, latest string
+		want             string
+	}{
+		{0.9, "2025-10-07T13:40:00Z", "2025-10-07T15:05:59Z", "90% probability of arrival between 13:40 and 15:05 UTC on Oct 7"},
+		{0.95, "2025-10-07T23:50:00Z", "2025-10-08T00:10:00Z", "95% probability of arrival between 23:50 UTC on Oct 7 and 00:10 UTC on Oct 8"},
+		{0.999, "2025-10-07T13:40:00+02:00", "2025-10-07T15:00:00+02:00", "99.9% probability of arrival between 11:40 and 13:00 UTC on Oct 7"},
+	}
+	for _, tt := range tests {
+		if got := arrivalStatement(tt.confidence, at(tt.earliest), at(tt.latest)); got != tt.want {
+			t.Errorf("arrivalStatement(%v, %s, %s) = %q, want %q", tt.confidence, tt.earliest, tt.latest, got, tt.want)
+		}
+	}
+}
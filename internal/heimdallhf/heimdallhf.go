@@ -0,0 +1,899 @@
+// Package heimdallhf is heimdall_hf_block_calculator.go: it predicts the
+// Heimdall block a hardfork time lands on.
+package heimdallhf
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/blocktime"
+	"github.com/pratikspatil024/chain-utils/fixtures"
+	"github.com/pratikspatil024/chain-utils/pkg/fetch"
+	"github.com/pratikspatil024/chain-utils/pkg/ledger"
+)
+
+const (
+	toolName    = "heimdall_hf_block_calculator.go"
+	defaultBase = "https://tendermint-api.polygon.technology"
+
+	// defaultLookback is about a week of blocks at 1.3 s, the window the
+	// block time is measured over when -avg is not given
+	defaultLookback = 465000
+
+	// sampleConcurrency bounds the -sample block requests in flight at once
+	sampleConcurrency = 8
+)
+
+type statusResp struct {
+	Result struct {
+		SyncInfo struct {
+			LatestBlockHeight string `json:"latest_block_height"`
+			LatestBlockTime   string `json:"latest_block_time"`
+			EarliestBlockH    string `json:"earliest_block_height"`
+		} `json:"sync_info"`
+	} `json:"result"`
+}
+
+type blockResp struct {
+	Result struct {
+		Block struct {
+			Header struct {
+				Height string `json:"height"`
+				Time   string `json:"time"`
+			} `json:"header"`
+		} `json:"block"`
+	} `json:"result"`
+}
+
+// strictJSON is set by -strict; see checkTendermint.
+var strictJSON bool
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	base := flag.String("base", defaultBase, "Base URL for the Tendermint RPC-compatible API")
+	timeout := flag.Duration("timeout", 15*time.Second, "HTTP request timeout")
+	maxHeadAge := flag.Duration("max-head-age", time.Minute, "Warn when the head block is older (or further in the future) than this")
+	rounding := flag.String("rounding", "floor", "Rounding of the estimated block count: nearest, floor, ceil or trunc")
+	strictTime := flag.Bool("strict-time", false, "Fail instead of warning when the head block timestamp is implausible")
+	ntpServer := flag.String("ntp", "", "Optional NTP server (e.g. pool.ntp.org) used to correct the local clock for the skew check")
+	asOfHeight := flag.Int64("as-of-height", -1, "Pin the report to this block instead of the latest one (reproducible output)")
+	asOfTime := flag.String("as-of-time", "", "Pin the report to the last block at or before this time (RFC3339)")
+	watch := flag.Duration("watch", 0, "Recompute the prediction every interval (e.g. 30s) until interrupted")
+	ledgerPath := flag.String("ledger", ledger.DefaultPath(), "Prediction ledger each unpinned prediction is appended to: a JSON-lines file, or a postgres:// URL shared by a team (empty disables it)")
+	network := flag.String("network", "mainnet", "Network name recorded in the ledger")
+	snapshotPath := flag.String("snapshot", "", "Write the report, the raw API responses and the tool version and flags to this .tar.gz for later audit")
+	explorer := flag.String("explorer", "mintscan", "Explorer linked for the current and predicted blocks: mintscan, a URL template with %d, or empty for none")
+	replayPath := flag.String("replay", "", "Answer from a recorded dataset instead of the network: builtin:mainnet, builtin:amoy or a fixture file")
+	strict := flag.Bool("strict", false, "Reject Tendermint responses with unexpected envelope fields, or a missing or malformed height or time, instead of decoding what is there")
+	targetStr := flag.String("target", "2025-09-16T14:00:00.00000000Z", "Target time in RFC3339 or RFC3339Nano (UTC); a time the chain has passed is looked up instead of predicted")
+	avgBlockTime := flag.Float64("avg", 0, "Average block time in seconds (e.g. 1.30), overriding the one measured over -lookback")
+	sample := flag.Int64("sample", 200, "Recent block intervals whose spread and average give the P5/P95 height range around the prediction (0 disables it)")
+	lookback := flag.Int64("lookback", defaultLookback, "Blocks below the head the average block time is measured over when -avg is not given (default about a week)")
+	pastOK := flag.Bool("past-ok", false, "For a target before the head, binary-search the block that was current at that time instead of stopping (implied by -target)")
+	flag.Parse()
+	strictJSON = *strict
+
+	var replayer http.RoundTripper
+	if *replayPath != "" {
+		fix, err := fixtures.Load(*replayPath)
+		if err == nil {
+			replayer, err = fixtures.NewTendermint(fix)
+		}
+		if err != nil {
+			failf("-replay: %v", err)
+		}
+		// Live explorer pages would show unrelated blocks
+		if !flagSet("explorer") {
+			*explorer = ""
+		}
+		// Replayed predictions say nothing about the live chain
+		*ledgerPath = ""
+		fmt.Fprintln(os.Stderr, fix.Banner(*replayPath))
+	}
+
+	targetTime, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(*targetStr))
+	if err != nil {
+		failf("unsupported -target %q (use RFC3339/RFC3339Nano, e.g. 2025-09-16T14:00:00Z)", clip(*targetStr))
+	}
+	if flagSet("avg") && (math.IsNaN(*avgBlockTime) || math.IsInf(*avgBlockTime, 0) || *avgBlockTime <= 0) {
+		failf("-avg must be a positive number of seconds per block, got %v", *avgBlockTime)
+	}
+	if *lookback < 1 {
+		failf("-lookback must be a positive number of blocks")
+	}
+	if *sample < 0 {
+		failf("-sample must not be negative")
+	}
+	if _, err := blocktime.Rounding(*rounding).Round(new(big.Rat)); err != nil {
+		failf("-rounding: %v", err)
+	}
+	// The guard is for the default target going stale; a -target someone
+	// typed in the past asks which block that was
+	*pastOK = *pastOK || flagSet("target")
+
+	links, err := resolveExplorer(*explorer, *network)
+	if err != nil {
+		failf("%v", err)
+	}
+
+	if *snapshotPath != "" && *watch > 0 {
+		failf("-snapshot records a single run and cannot be combined with -watch")
+	}
+	if *snapshotPath != "" {
+		if recorder, err = startSnapshot(); err != nil {
+			failf("start snapshot: %v", err)
+		}
+	}
+
+	httpc := &http.Client{Timeout: *timeout, Transport: replayer}
+
+	run := func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, *timeout)
+		defer cancel()
+
+		// Get current height + time
+		latestHeight, latestTime, earliestHeight, err := getLatest(ctx, httpc, *base)
+		if err != nil {
+			return fmt.Errorf("get latest: %w", err)
+		}
+		pinned := *asOfHeight >= 0 || *asOfTime != ""
+		latestHeight, latestTime, err = resolveAsOf(ctx, httpc, *base, latestHeight, latestTime, earliestHeight, *asOfHeight, *asOfTime)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Current block: %d at %s\n",
+			latestHeight, latestTime.Format(time.RFC3339Nano))
+		if u := links.url(latestHeight, false); u != "" {
+			fmt.Printf("  explorer: %s\n", u)
+		}
+		fmt.Println()
+		if !pinned {
+			// A pinned head is old by design
+			if err := flagImplausible(checkClockSkew(latestTime, *maxHeadAge, *ntpServer), *strictTime); err != nil {
+				return err
+			}
+		}
+
+		// --- FUTURE BLOCK CALCULATION ---
+		delta := targetTime.Sub(latestTime)
+		if delta < 0 && !*pastOK {
+			fmt.Printf("Target time %s is in the past relative to latest block (pass -past-ok to find the block current then).\n", targetTime.Format(time.RFC3339))
+			return nil
+		}
+		if delta < 0 {
+			return reportPast(ctx, httpc, *base, targetTime, earliestHeight, latestHeight, links)
+		}
+
+		// Without -avg, the block time is measured over -lookback
+		avg, estimator := *avgBlockTime, "fixed-avg"
+		var sampled int64
+		if !flagSet("avg") {
+			if avg, sampled, err = measureBlockTime(ctx, httpc, *base, latestHeight, latestTime, earliestHeight, *lookback); err != nil {
+				return err
+			}
+			estimator = "recent-mean"
+		}
+
+		blocksExact, blocksRounded, err := blocktime.Blocks(delta, avg, blocktime.Rounding(*rounding))
+		if err != nil {
+			return fmt.Errorf("estimate blocks: %w", err)
+		}
+		blocksToAdd := blocksRounded.Int64()
+		predicted := latestHeight + blocksToAdd
+
+		fmt.Println("Future block prediction:")
+		fmt.Printf("  target time     : %s\n", targetTime.Format(time.RFC3339))
+		if sampled > 0 {
+			fmt.Printf("  avg block time  : %.6f s (measured over the last %d blocks)\n", avg, sampled)
+		} else {
+			fmt.Printf("  avg block time  : %.2f s\n", avg)
+		}
+		fmt.Printf("  time delta      : %dd %dh %dm %ds\n", int(delta.Hours())/24, int(delta.Hours())%24, int(delta.Minutes())%60, int(delta.Seconds())%60)
+		fmt.Printf("  blocks to add   : %d (rounded %s from %s)\n", blocksToAdd, *rounding, blocksExact.FloatString(3))
+		fmt.Printf("  predicted height: %d\n", predicted)
+		if u := links.url(predicted, predicted > latestHeight); u != "" {
+			fmt.Printf("  explorer        : %s\n", u)
+		}
+		if *sample > 0 {
+			recent, stdDev, intervals, err := intervalSpread(ctx, httpc, *base, latestHeight, latestTime, earliestHeight, *sample)
+			if err != nil {
+				return err
+			}
+			// The block count over delta has a standard deviation of
+			// sigma*sqrt(delta/avg^3) when block times are independent.
+			// That is only jitter, so the heights the recent and the
+			// lookback averages give apart are added in quadrature.
+			z := math.Sqrt2 * math.Erfinv(0.9)
+			jitter := z * stdDev * math.Sqrt(delta.Seconds()/(avg*avg*avg))
+			var drift float64
+			if recent > 0 {
+				drift = math.Abs(delta.Seconds()/recent - delta.Seconds()/avg)
+			}
+			margin := int64(math.Ceil(math.Hypot(jitter, drift)))
+			fmt.Printf("  P5/P50/P95      : %d / %d / %d (σ %.3f s over the last %d block intervals averaging %.3f s, ±%d blocks from that average)\n", predicted-margin, predicted, predicted+margin, stdDev, intervals, recent, int64(math.Ceil(drift)))
+		}
+
+		// Record the prediction and settle earlier ones that are now verifiable
+		if !pinned && *ledgerPath != "" {
+			e := ledger.Entry{
+				RecordedAt:    time.Now().UTC(),
+				Network:       *network,
+				Chain:         "heimdall",
+				Estimator:     estimator,
+				TargetHeight:  predicted,
+				PredictedTime: targetTime.UTC(),
+				Inputs:        &ledger.Inputs{HeadHeight: latestHeight, HeadTime: latestTime, AvgBlockTime: avg, Rounding: *rounding},
+			}
+			blockTime := func(h int64) (time.Time, error) { return getBlockTime(ctx, httpc, *base, h) }
+			if err := ledger.Record(*ledgerPath, e, latestHeight, blockTime); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: record prediction: %v\n", err)
+			}
+		}
+		return nil
+	}
+
+	err = runWatch(*watch, run)
+	if recorder != nil {
+		if serr := recorder.write(*snapshotPath, err); serr != nil {
+			failf("write snapshot: %v", serr)
+		}
+		fmt.Fprintf(os.Stderr, "snapshot written to %s\n", *snapshotPath)
+	}
+	if err != nil {
+		failf("%v", err)
+	}
+}
+
+// runWatch calls run once, or with a positive interval keeps calling it on
+// that interval until interrupted. Failures inside the loop are reported and
+// retried on the next tick instead of exiting.
+func runWatch(interval time.Duration, run func(context.Context) error) error {
+	if interval <= 0 {
+		return run(context.Background())
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		fmt.Printf("=== %s ===\n", time.Now().UTC().Format(time.RFC3339))
+		if err := run(ctx); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+		fmt.Println()
+	}
+}
+
+// checkClockSkew compares the head block time against the local clock (or an
+// NTP-corrected clock when ntpServer is set) and returns an error when they
+// are further than maxAge apart.
+func checkClockSkew(head time.Time, maxAge time.Duration, ntpServer string) error {
+	now := time.Now()
+	if ntpServer != "" {
+		offset, err := ntpOffset(ntpServer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: ntp query to %s failed: %v (using local clock)\n", ntpServer, err)
+		} else {
+			if offset.Abs() > time.Second {
+				fmt.Fprintf(os.Stderr, "warning: local clock is off by %s according to %s\n", offset.Round(time.Millisecond), ntpServer)
+			}
+			now = now.Add(offset)
+		}
+	}
+	age := now.Sub(head)
+	switch {
+	case age < -maxAge:
+		return fmt.Errorf("head block timestamp is %s in the future; the endpoint or the local clock is wrong", (-age).Round(time.Second))
+	case age > maxAge:
+		return fmt.Errorf("head block is %s old; the endpoint may be lagging and predictions will be off", age.Round(time.Second))
+	}
+	return nil
+}
+
+// flagImplausible warns loudly about an implausible head timestamp, or
+// returns it as the error when strict.
+func flagImplausible(err error, strict bool) error {
+	if err == nil {
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("implausible block timestamp: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "WARNING: implausible block timestamp: %v\n", err)
+	fmt.Fprintf(os.Stderr, "WARNING: the prediction below may be wrong; -strict-time makes this an error\n")
+	return nil
+}
+
+// ntpOffset performs a single SNTP query and returns how far the local clock
+// is behind the server.
+func ntpOffset(server string) (time.Duration, error) {
+	server = ntpAddr(server)
+	conn, err := net.DialTimeout("udp", server, 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return 0, err
+	}
+
+	req := make([]byte, 48)
+	req[0] = 0x1B // LI=0, VN=3, Mode=3 (client)
+	t1 := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 48)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return 0, err
+	}
+	t4 := time.Now()
+
+	// A kiss-o'-death packet has stratum 0 and no usable time, and a reply
+	// from anything but a server, or without a transmit timestamp, is not
+	// an answer to this query.
+	if mode := resp[0] & 0x7; mode != 4 {
+		return 0, fmt.Errorf("reply has mode %d, want 4 (server)", mode)
+	}
+	if resp[1] == 0 {
+		return 0, fmt.Errorf("kiss-o'-death reply (stratum 0, code %q)", resp[12:16])
+	}
+	if binary.BigEndian.Uint64(resp[40:]) == 0 {
+		return 0, fmt.Errorf("reply has no transmit timestamp")
+	}
+
+	t2 := ntpTime(binary.BigEndian.Uint32(resp[32:]), binary.BigEndian.Uint32(resp[36:]))
+	t3 := ntpTime(binary.BigEndian.Uint32(resp[40:]), binary.BigEndian.Uint32(resp[44:]))
+	return (t2.Sub(t1) + t3.Sub(t4)) / 2, nil
+}
+
+// ntpAddr adds the NTP port to a server given without one, which may be an
+// IPv6 address such as ::1 or [::1].
+func ntpAddr(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), "123")
+}
+
+func ntpTime(sec, frac uint32) time.Time {
+	const ntpEpochOffset = 2208988800 // seconds between 1900 and 1970
+	nsec := (int64(frac) * 1e9) >> 32
+	return time.Unix(int64(sec)-ntpEpochOffset, nsec)
+}
+
+// explorerURLs are the block page templates of an explorer on one network.
+// Countdown, when set, is used for heights not produced yet.
+type explorerURLs struct {
+	Block     string
+	Countdown string
+}
+
+// blockExplorers maps an -explorer preset to its templates per network.
+var blockExplorers = map[string]map[string]explorerURLs{
+	"mintscan": {
+		"mainnet": {Block: "https://www.mintscan.io/polygon/block/%d"},
+	},
+}
+
+// resolveExplorer turns -explorer into templates for network. The flag is a
+// preset name, a URL template with one %d for the height, or empty for no
+// links.
+func resolveExplorer(name, network string) (explorerURLs, error) {
+	switch {
+	case name == "":
+		return explorerURLs{}, nil
+	case strings.Count(name, "%d") == 1:
+		return explorerURLs{Block: name}, nil
+	}
+	byNetwork, ok := blockExplorers[name]
+	if !ok {
+		return explorerURLs{}, fmt.Errorf("unknown -explorer %q (use mintscan or a URL template with %%d)", name)
+	}
+	u, ok := byNetwork[network]
+	if !ok {
+		return explorerURLs{}, fmt.Errorf("-explorer %s has no links for network %q", name, network)
+	}
+	return u, nil
+}
+
+// url links height, or returns "" when links are disabled.
+func (e explorerURLs) url(height int64, future bool) string {
+	if future && e.Countdown != "" {
+		return fmt.Sprintf(e.Countdown, height)
+	}
+	if e.Block == "" {
+		return ""
+	}
+	return fmt.Sprintf(e.Block, height)
+}
+
+func getLatest(ctx context.Context, c *http.Client, base string) (height int64, t time.Time, earliest int64, err error) {
+	u := base + "/status"
+	var sr statusResp
+	if err = getJSON(ctx, c, u, &sr); err != nil {
+		return
+	}
+	h, err1 := strconv.ParseInt(sr.Result.SyncInfo.LatestBlockHeight, 10, 64)
+	if err1 != nil {
+		err = fmt.Errorf("parse latest height: %w", err1)
+		return
+	}
+	earliest, err1 = strconv.ParseInt(sr.Result.SyncInfo.EarliestBlockH, 10, 64)
+	if err1 != nil {
+		err = fmt.Errorf("parse earliest height: %w", err1)
+		return
+	}
+	t, err1 = parseBlockTime(sr.Result.SyncInfo.LatestBlockTime)
+	if err1 != nil {
+		err = fmt.Errorf("parse latest time: %w", err1)
+		return
+	}
+	height = h
+	return
+}
+
+// resolveAsOf pins the head used by the report to -as-of-height or to the
+// last block at or before -as-of-time, so reruns produce identical output.
+func resolveAsOf(ctx context.Context, c *http.Client, base string, latest int64, latestTime time.Time, earliest, asOfHeight int64, asOfTime string) (int64, time.Time, error) {
+	switch {
+	case asOfHeight >= 0 && asOfTime != "":
+		return 0, time.Time{}, errors.New("-as-of-height and -as-of-time are mutually exclusive")
+	case asOfHeight >= 0:
+		if asOfHeight < earliest || asOfHeight > latest {
+			return 0, time.Time{}, fmt.Errorf("-as-of-height %d outside available range [%d, %d]", asOfHeight, earliest, latest)
+		}
+		t, err := getBlockTime(ctx, c, base, asOfHeight)
+		if err != nil {
+			return 0, time.Time{}, fmt.Errorf("fetch block %d: %w", asOfHeight, err)
+		}
+		return asOfHeight, t, nil
+	case asOfTime != "":
+		t, err := time.Parse(time.RFC3339Nano, asOfTime)
+		if err != nil {
+			return 0, time.Time{}, fmt.Errorf("parse -as-of-time: %w", err)
+		}
+		if !latestTime.After(t) {
+			return 0, time.Time{}, fmt.Errorf("-as-of-time %s is not before the latest block %d", asOfTime, latest)
+		}
+		h, ht, err := findBlockAtOrBefore(ctx, c, base, t, earliest, latest)
+		if err != nil {
+			return 0, time.Time{}, fmt.Errorf("-as-of-time: %w", err)
+		}
+		return h, ht, nil
+	default:
+		return latest, latestTime, nil
+	}
+}
+
+// findBlockAtOrBefore binary-searches [earliest, latest] for the last block
+// whose header time is not after t, i.e. the block that was current at t.
+func findBlockAtOrBefore(ctx context.Context, c *http.Client, base string, t time.Time, earliest, latest int64) (int64, time.Time, error) {
+	// first block strictly after t, then step back one
+	h, ht, err := findBlockAtOrAfter(ctx, c, base, t.Add(time.Nanosecond), earliest, latest)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if h == earliest && ht.After(t) {
+		return 0, time.Time{}, fmt.Errorf("%s is before the earliest available block %d", t.Format(time.RFC3339Nano), earliest)
+	}
+	if !ht.After(t) {
+		return h, ht, nil
+	}
+	prev, err := getBlockTime(ctx, c, base, h-1)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("fetch block %d: %w", h-1, err)
+	}
+	return h - 1, prev, nil
+}
+
+// reportPast prints the block that was current at a target before the head,
+// and the block that followed it, for -past-ok. Nothing is predicted, so the
+// ledger is left alone.
+func reportPast(ctx context.Context, c *http.Client, base string, target time.Time, earliest, latest int64, links explorerURLs) error {
+	h, ht, err := findBlockAtOrBefore(ctx, c, base, target, earliest, latest)
+	if err != nil {
+		return fmt.Errorf("find block at target: %w", err)
+	}
+	fmt.Println("Historical block lookup:")
+	fmt.Printf("  target time     : %s\n", target.Format(time.RFC3339))
+	fmt.Printf("  current block   : %d at %s (%s before target)\n", h, ht.Format(time.RFC3339Nano), target.Sub(ht))
+	if u := links.url(h, false); u != "" {
+		fmt.Printf("  explorer        : %s\n", u)
+	}
+	if h < latest {
+		nt, err := getBlockTime(ctx, c, base, h+1)
+		if err != nil {
+			return fmt.Errorf("fetch block %d: %w", h+1, err)
+		}
+		fmt.Printf("  next block      : %d at %s (%s after target)\n", h+1, nt.Format(time.RFC3339Nano), nt.Sub(target))
+	}
+	return nil
+}
+
+// findBlockAtOrAfter binary-searches [lo, hi] for the first block whose
+// header time is not before t. hi is returned if no earlier block qualifies.
+func findBlockAtOrAfter(ctx context.Context, c *http.Client, base string, t time.Time, lo, hi int64) (int64, time.Time, error) {
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		midTime, err := getBlockTime(ctx, c, base, mid)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		if !midTime.Before(t) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	bt, err := getBlockTime(ctx, c, base, lo)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return lo, bt, nil
+}
+
+// intervalSpread returns the mean and standard deviation of the last n block
+// intervals up to the head, or as far back as the node keeps, and how many
+// intervals they were taken over.
+func intervalSpread(ctx context.Context, c *http.Client, base string, head int64, headTime time.Time, earliest, n int64) (float64, float64, int64, error) {
+	n = min(n, head-max(earliest, 1))
+	if n < 2 {
+		return 0, 0, max(n, 0), nil
+	}
+	times := make([]time.Time, n+1)
+	times[0] = headTime
+	g := fetch.NewGroup(ctx, sampleConcurrency)
+	for i := int64(1); i <= n; i++ {
+		g.Go(func(ctx context.Context) (err error) {
+			times[i], err = getBlockTime(ctx, c, base, head-i)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return 0, 0, 0, fmt.Errorf("sample block intervals: %w", err)
+	}
+	mean := headTime.Sub(times[n]).Seconds() / float64(n)
+	var sumSq float64
+	for i := int64(0); i < n; i++ {
+		d := times[i].Sub(times[i+1]).Seconds() - mean
+		sumSq += d * d
+	}
+	return mean, math.Sqrt(sumSq / float64(n-1)), n, nil
+}
+
+// measureBlockTime returns the average block time over the last lookback
+// blocks up to the head, or as far back as the node keeps, and the number of
+// blocks it was measured over.
+func measureBlockTime(ctx context.Context, c *http.Client, base string, head int64, headTime time.Time, earliest, lookback int64) (float64, int64, error) {
+	from := max(head-lookback, earliest, 1)
+	if from >= head {
+		return 0, 0, errors.New("no blocks below the head to measure the block time over; pass -avg")
+	}
+	fromTime, err := getBlockTime(ctx, c, base, from)
+	if err != nil {
+		return 0, 0, fmt.Errorf("get block %d: %w", from, err)
+	}
+	if !headTime.After(fromTime) {
+		return 0, 0, fmt.Errorf("implausible block times: block %d (%s) is not older than head %d (%s)", from, fromTime.Format(time.RFC3339Nano), head, headTime.Format(time.RFC3339Nano))
+	}
+	return headTime.Sub(fromTime).Seconds() / float64(head-from), head - from, nil
+}
+
+func getBlockTime(ctx context.Context, c *http.Client, base string, height int64) (time.Time, error) {
+	u := fmt.Sprintf("%s/block?height=%d", base, height)
+	var br blockResp
+	if err := getJSON(ctx, c, u, &br); err != nil {
+		return time.Time{}, err
+	}
+	t, err := parseBlockTime(br.Result.Block.Header.Time)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t, nil
+}
+
+func getJSON(ctx context.Context, c *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d for %s", resp.StatusCode, url)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	recorder.record("GET "+url, body)
+	if err := checkTendermint(url, body); err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+// auditSnapshot captures what a single run printed and every upstream
+// response it was computed from, so -snapshot archives can be audited later.
+type auditSnapshot struct {
+	mu        sync.Mutex
+	started   time.Time
+	exchanges []exchange
+	stdout    *os.File
+	pipe      *os.File
+	done      chan struct{}
+	report    bytes.Buffer
+}
+
+type exchange struct {
+	At       time.Time       `json:"at"`
+	Request  string          `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// recorder is set while a -snapshot run is captured; nil records nothing.
+var recorder *auditSnapshot
+
+// startSnapshot tees stdout into the snapshot until write is called.
+func startSnapshot() (*auditSnapshot, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	s := &auditSnapshot{started: time.Now().UTC(), stdout: os.Stdout, pipe: w, done: make(chan struct{})}
+	os.Stdout = w
+	go func() {
+		io.Copy(io.MultiWriter(s.stdout, &s.report), r)
+		close(s.done)
+	}()
+	return s, nil
+}
+
+func (s *auditSnapshot) record(request string, response []byte) {
+	if s == nil {
+		return
+	}
+	raw := json.RawMessage(bytes.Clone(response))
+	if !json.Valid(raw) {
+		raw, _ = json.Marshal(string(response))
+	}
+	s.mu.Lock()
+	s.exchanges = append(s.exchanges, exchange{At: time.Now().UTC(), Request: request, Response: raw})
+	s.mu.Unlock()
+}
+
+// write restores stdout and stores the report, the raw responses and the
+// tool version and configuration in a gzipped tarball at path.
+func (s *auditSnapshot) write(path string, runErr error) error {
+	os.Stdout = s.stdout
+	s.pipe.Close()
+	<-s.done
+
+	flags := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) { flags[f.Name] = f.Value.String() })
+	meta := map[string]any{
+		"tool":        toolName,
+		"go_version":  runtime.Version(),
+		"args":        os.Args[1:],
+		"flags":       flags,
+		"started_at":  s.started,
+		"finished_at": time.Now().UTC(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		meta["version"] = bi.Main.Version
+		for _, kv := range bi.Settings {
+			if kv.Key == "vcs.revision" {
+				meta["revision"] = kv.Value
+			}
+		}
+	}
+	if runErr != nil {
+		meta["error"] = runErr.Error()
+	}
+	metaJSON, _ := json.MarshalIndent(meta, "", "  ")
+	s.mu.Lock()
+	respJSON, _ := json.MarshalIndent(s.exchanges, "", "  ")
+	s.mu.Unlock()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{"report.txt", s.report.Bytes()},
+		{"responses.json", respJSON},
+		{"meta.json", metaJSON},
+	} {
+		hdr := &tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.data)), ModTime: s.started.Truncate(time.Second)}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// flagSet reports whether the named flag was passed on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// parseBlockTime parses a Tendermint block time. Pruned or half-synced
+// nodes answer with an empty or zero time rather than an error, which
+// would otherwise surface as a nonsensical average.
+func parseBlockTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, errors.New("empty block time")
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("block time %q is not RFC3339", clip(s))
+	}
+	if t.UTC().Year() < 2000 {
+		return time.Time{}, fmt.Errorf("block time %q predates the chain; the node may have pruned the block", clip(s))
+	}
+	return t.UTC(), nil
+}
+
+// checkTendermint validates a /status or /block response when -strict is
+// set: the envelope may hold nothing beyond jsonrpc, id, result and error,
+// and the result must carry the height and time the calculations read, so
+// a provider's schema drift fails loudly instead of decoding to zero
+// values. A block must also be the one that was asked for.
+func checkTendermint(url string, body []byte) error {
+	if !strictJSON {
+		return nil
+	}
+	var header string
+	switch {
+	case strings.Contains(url, "/status"):
+		header = "sync_info"
+	case strings.Contains(url, "/block?"):
+		header = "block.header"
+	default:
+		return nil
+	}
+	var env struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Result  json.RawMessage `json:"result"`
+		Error   json.RawMessage `json:"error"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&env); err != nil {
+		return fmt.Errorf("strict: %s: %w", url, err)
+	}
+	var result map[string]any
+	if err := json.Unmarshal(env.Result, &result); err != nil || result == nil {
+		return fmt.Errorf("strict: %s: result is %s, want an object", url, clip(string(env.Result)))
+	}
+	if a, b, ok := foldedKeys(result); ok {
+		return fmt.Errorf("strict: %s: result has both %q and %q, which decode alike", url, clip(a), clip(b))
+	}
+	if header == "block.header" && result["block"] == nil && result["block_meta"] != nil {
+		// Tendermint before 0.34 answers with block_meta
+		header = "block_meta.header"
+	}
+	heightKey, timeKey := header+".height", header+".time"
+	if header == "sync_info" {
+		heightKey, timeKey = "sync_info.latest_block_height", "sync_info.latest_block_time"
+	}
+	height, ok := lookupString(result, heightKey)
+	if !ok {
+		return fmt.Errorf("strict: %s: result has no string %s", url, heightKey)
+	}
+	h, err := strconv.ParseInt(height, 10, 64)
+	if err != nil {
+		return fmt.Errorf("strict: %s: %s %q is not a height", url, heightKey, clip(height))
+	}
+	ts, ok := lookupString(result, timeKey)
+	if !ok {
+		return fmt.Errorf("strict: %s: result has no string %s", url, timeKey)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+		return fmt.Errorf("strict: %s: %s %q is not RFC3339", url, timeKey, clip(ts))
+	}
+	if _, want, found := strings.Cut(url, "height="); found && want != strconv.FormatInt(h, 10) {
+		return fmt.Errorf("strict: %s: asked for block %s, got block %d", url, want, h)
+	}
+	return nil
+}
+
+// lookupString follows a dotted path of object keys to a string.
+func lookupString(v map[string]any, path string) (string, bool) {
+	keys := strings.Split(path, ".")
+	for _, k := range keys[:len(keys)-1] {
+		if v, _ = v[k].(map[string]any); v == nil {
+			return "", false
+		}
+	}
+	s, ok := v[keys[len(keys)-1]].(string)
+	return s, ok
+}
+
+// foldedKeys returns two keys of one object anywhere in v that differ only
+// in case. encoding/json fills a struct field from either, so the strict
+// lookups could check one while the decode reads the other.
+func foldedKeys(v any) (string, string, bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		seen := make(map[string]string, len(v))
+		for k, child := range v {
+			// the folding encoding/json matches field names by
+			fold := strings.ToLower(strings.ToUpper(k))
+			if prev, ok := seen[fold]; ok {
+				return min(prev, k), max(prev, k), true
+			}
+			seen[fold] = k
+			if a, b, ok := foldedKeys(child); ok {
+				return a, b, true
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if a, b, ok := foldedKeys(child); ok {
+				return a, b, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+func failf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", a...)
+	os.Exit(1)
+}
@@ -0,0 +1,315 @@
+package heimdallhf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the calculator end to end through its
+// flags and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("HEIMDALL_HF_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// genesisTime is block 0 of the test chain. Blocks come every 2s up to
+// height 1,000,000 and every second after it, so the head, 2,000,000, is at
+// 2023-12-19T15:33:20Z.
+const genesisTime = 1_700_000_000
+
+func blockTime(h int64) time.Time {
+	s := int64(genesisTime + 2*h)
+	if h > 1_000_000 {
+		s = genesisTime + 2_000_000 + (h - 1_000_000)
+	}
+	return time.Unix(s, 0).UTC()
+}
+
+// tendermintNode is a Heimdall Tendermint RPC endpoint over the test chain.
+type tendermintNode struct {
+	head     int64
+	earliest int64          // lowest height /status admits to
+	pruned   int64          // blocks below fail although /status lists them
+	bad      map[int64]bool // blocks whose time is not RFC3339
+	jitter   bool           // odd blocks come half a second late
+	every429 int            // every nth request is rate limited
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (n *tendermintNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if n.every429 > 0 && n.calls%n.every429 == 0 {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+		return
+	}
+	switch r.URL.Path {
+	case "/status":
+		fmt.Fprintf(w, `{"result":{"node_info":{"network":"heimdall-test"},"sync_info":{"latest_block_height":"%d","latest_block_time":"%s","earliest_block_height":"%d"}}}`,
+			n.head, n.time(n.head), n.earliest)
+	case "/block":
+		h, _ := strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+		if h < n.pruned || h > n.head {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error":{"code":-32603,"message":"Internal error","data":"height %d is not available"}}`, h)
+			return
+		}
+		fmt.Fprintf(w, `{"result":{"block_id":{"hash":"%064X"},"block":{"header":{"height":"%d","time":"%s"}}}}`, h, h, n.time(h))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (n *tendermintNode) time(h int64) string {
+	if n.bad[h] {
+		return "yesterday"
+	}
+	t := blockTime(h)
+	if n.jitter && h%2 == 1 {
+		t = t.Add(500 * time.Millisecond)
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func newTendermintNode(t *testing.T, n *tendermintNode) string {
+	t.Helper()
+	srv := httptest.NewServer(n)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs the calculator pinned to the test chain's head and returns its
+// stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	base := []string{"-as-of-height=2000000", "-ledger=", "-explorer=", "-sample=0"}
+	cmd := exec.Command(os.Args[0], append(base, args...)...)
+	cmd.Env = append(os.Environ(), "HEIMDALL_HF_RUN_MAIN=1", "HOME="+t.TempDir())
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// predicted returns the height the report predicts.
+func predicted(t *testing.T, stdout string) string {
+	t.Helper()
+	for _, line := range strings.Split(stdout, "\n") {
+		if h, ok := strings.CutPrefix(strings.TrimSpace(line), "predicted height: "); ok {
+			return h
+		}
+	}
+	t.Fatalf("no predicted height in:\n%s", stdout)
+	return ""
+}
+
+// anHourAhead is an hour after the test chain's head.
+const anHourAhead = "2023-12-19T16:33:20Z"
+
+func TestPredict(t *testing.T) {
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1})
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"measured over the default lookback", []string{"-target=" + anHourAhead}, "2003600"},
+		// the lookback reaches into the 2s blocks: 1,500,000 blocks in
+		// 2,000,000s average 1.333333s
+		{"measured over a longer lookback", []string{"-target=" + anHourAhead, "-lookback=1500000"}, "2002700"},
+		{"fixed average", []string{"-target=" + anHourAhead, "-avg=1.5"}, "2002400"},
+		// 22.575s at 2.15s a block is exactly 10.5 blocks
+		{"half block floors", []string{"-target=2023-12-19T15:33:42.575Z", "-avg=2.15"}, "2000010"},
+		{"half block rounds up", []string{"-target=2023-12-19T15:33:42.575Z", "-avg=2.15", "-rounding=nearest"}, "2000011"},
+		{"half block ceils", []string{"-target=2023-12-19T15:33:42.575Z", "-avg=2.15", "-rounding=ceil"}, "2000011"},
+		{"half block truncates", []string{"-target=2023-12-19T15:33:42.575Z", "-avg=2.15", "-rounding=trunc"}, "2000010"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := run(t, append([]string{"-base=" + url}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("run: %v\n%s", err, stderr)
+			}
+			if got := predicted(t, stdout); got != tt.want {
+				t.Errorf("predicted %s, want %s:\n%s", got, tt.want, stdout)
+			}
+		})
+	}
+}
+
+func TestPredictReport(t *testing.T) {
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1, jitter: true})
+	stdout, stderr, err := run(t, "-base="+url, "-target="+anHourAhead, "-sample=200")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	// Intervals alternate between 1.5s and 0.5s: σ is 0.5 over the 200
+	// intervals, which spreads an hour's 3,600 blocks by 50 either way
+	for _, want := range []string{
+		"Current block: 2000000 at 2023-12-19T15:33:20Z",
+		"  avg block time  : 1.000000 s (measured over the last 465000 blocks)",
+		"  time delta      : 0d 1h 0m 0s",
+		"  blocks to add   : 3600 (rounded floor from 3600.000)",
+		"  P5/P50/P95      : 2003550 / 2003600 / 2003650 (σ 0.501 s over the last 200 block intervals averaging 1.000 s, ±0 blocks from that average)",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestPredictPastTarget(t *testing.T) {
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1})
+	target := blockTime(1_500_000).Add(500 * time.Millisecond).Format(time.RFC3339Nano)
+	stdout, stderr, err := run(t, "-base="+url, "-target="+target)
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	for _, want := range []string{
+		"  current block   : 1500000 at 2023-12-13T20:40:00Z (500ms before target)",
+		"  next block      : 1500001 at 2023-12-13T20:40:01Z (500ms after target)",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestPredictPruned(t *testing.T) {
+	// A node that reports its pruning point has the lookback clamped to it
+	url := newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1_800_000})
+	stdout, stderr, err := run(t, "-base="+url, "-target="+anHourAhead, "-lookback=1500000")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "measured over the last 200000 blocks") || predicted(t, stdout) != "2003600" {
+		t.Errorf("the lookback should stop at the earliest block:\n%s", stdout)
+	}
+
+	// One that does not fails the run
+	url = newTendermintNode(t, &tendermintNode{head: 2_000_000, earliest: 1, pruned: 1_800_000})
+	if _, stderr, err := run(t, "-base="+url, "-target="+anHourAhead); err == nil || !strings.Contains(stderr, "get block 1535000: HTTP 500") {
+		t.Errorf("run error = %v, want the pruned block named:\n%s", err, stderr)
+	}
+}
+
+func TestPredictFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		node *tendermintNode
+		args []string
+		want string
+	}{
+		// without retries the first rate-limited request ends the run
+		{"rate limited", &tendermintNode{head: 2_000_000, earliest: 1, every429: 2}, nil, "HTTP 429"},
+		{"malformed head", &tendermintNode{head: 2_000_000, earliest: 1, bad: map[int64]bool{2_000_000: true}}, nil, `get latest: parse latest time: block time "yesterday" is not RFC3339`},
+		{"malformed head with -strict", &tendermintNode{head: 2_000_000, earliest: 1, bad: map[int64]bool{2_000_000: true}}, []string{"-strict"}, `sync_info.latest_block_time "yesterday" is not RFC3339`},
+		// every request is rate limited, so the flag must be checked first
+		{"bad rounding", &tendermintNode{head: 2_000_000, earliest: 1, every429: 1}, []string{"-rounding=up"}, `unknown rounding mode "up"`},
+		{"bad average", &tendermintNode{head: 2_000_000, earliest: 1}, []string{"-avg=-1"}, "-avg must be a positive number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := newTendermintNode(t, tt.node)
+			_, stderr, err := run(t, append([]string{"-base=" + url, "-target=" + anHourAhead}, tt.args...)...)
+			if err == nil || !strings.Contains(stderr, tt.want) {
+				t.Errorf("run error = %v, want %q in:\n%s", err, tt.want, stderr)
+			}
+		})
+	}
+}
+
+// ntpReply answers one SNTP query on a local UDP socket with a reply from a
+// server whose clock is 10s ahead, after edit changes it, and returns the
+// socket's address.
+func ntpReply(t *testing.T, network, addr string, edit func(resp []byte)) string {
+	t.Helper()
+	conn, err := net.ListenPacket(network, addr)
+	if err != nil {
+		t.Skipf("listen %s: %v", addr, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		req := make([]byte, 48)
+		_, from, err := conn.ReadFrom(req)
+		if err != nil {
+			return
+		}
+		resp := make([]byte, 48)
+		resp[0], resp[1] = 0x24, 2 // LI=0, VN=4, Mode=4 (server), stratum 2
+		now := time.Now().Add(10 * time.Second)
+		sec := uint32(now.Unix() + 2208988800)
+		frac := uint32((uint64(now.Nanosecond()) << 32) / 1e9)
+		for _, off := range []int{32, 40} {
+			binary.BigEndian.PutUint32(resp[off:], sec)
+			binary.BigEndian.PutUint32(resp[off+4:], frac)
+		}
+		edit(resp)
+		conn.WriteTo(resp, from)
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestNTPOffset(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		addr    string
+		edit    func(resp []byte)
+		wantErr string
+	}{
+		{"ipv4", "udp4", "127.0.0.1:0", func([]byte) {}, ""},
+		{"ipv6", "udp6", "[::1]:0", func([]byte) {}, ""},
+		{"kiss-o'-death", "udp4", "127.0.0.1:0", func(resp []byte) { resp[1] = 0; copy(resp[12:], "RATE") }, `kiss-o'-death reply (stratum 0, code "RATE")`},
+		{"client mode", "udp4", "127.0.0.1:0", func(resp []byte) { resp[0] = 0x23 }, "reply has mode 3, want 4 (server)"},
+		{"no transmit timestamp", "udp4", "127.0.0.1:0", func(resp []byte) { clear(resp[40:]) }, "reply has no transmit timestamp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, err := ntpOffset(ntpReply(t, tt.network, tt.addr, tt.edit))
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ntpOffset error = %v, want %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Errorf("ntpOffset: %v", err)
+			case offset < 9*time.Second || offset > 11*time.Second:
+				t.Errorf("ntpOffset = %v, want about 10s", offset)
+			}
+		})
+	}
+}
+
+func TestNTPAddr(t *testing.T) {
+	for in, want := range map[string]string{
+		"pool.ntp.org":       "pool.ntp.org:123",
+		"pool.ntp.org:1123":  "pool.ntp.org:1123",
+		"192.0.2.1":          "192.0.2.1:123",
+		"2001:db8::1":        "[2001:db8::1]:123",
+		"[2001:db8::1]":      "[2001:db8::1]:123",
+		"[2001:db8::1]:1123": "[2001:db8::1]:1123",
+	} {
+		if got := ntpAddr(in); got != want {
+			t.Errorf("ntpAddr(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+// Package networkcompare is network_compare.go: it compares block times and
+// heads across Polygon networks side by side.
+package networkcompare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/blocktime"
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+	"github.com/pratikspatil024/chain-utils/pkg/human"
+)
+
+const (
+	httpTimeout = 20 * time.Second
+)
+
+// network holds the endpoints of one Polygon PoS network: Bor JSON-RPC and
+// Heimdall's Tendermint API.
+type network struct {
+	Name string
+	RPC  string
+	Base string
+}
+
+var presets = map[string]network{
+	"mainnet": {Name: "mainnet", RPC: "https://polygon-rpc.com", Base: "https://tendermint-api.polygon.technology"},
+	"amoy":    {Name: "amoy", RPC: "https://rpc-amoy.polygon.technology", Base: "https://tendermint-api-amoy.polygon.technology"},
+}
+
+type block struct {
+	Number    string `json:"number"`
+	Timestamp string `json:"timestamp"`
+}
+
+type statusResp struct {
+	Result struct {
+		SyncInfo struct {
+			LatestBlockHeight string `json:"latest_block_height"`
+			LatestBlockTime   string `json:"latest_block_time"`
+		} `json:"sync_info"`
+	} `json:"result"`
+}
+
+type blockResp struct {
+	Result struct {
+		Block struct {
+			Header struct {
+				Time string `json:"time"`
+			} `json:"header"`
+		} `json:"block"`
+	} `json:"result"`
+}
+
+// column is everything the comparison table shows for one network. A
+// failed measurement leaves its error in place of the value.
+type column struct {
+	ChainID       uint64
+	BorHead       int64
+	BorHeadTime   time.Time
+	BorAvg        float64
+	Finalized     int64
+	FinalizedTime time.Time
+	HeimdallHead  int64
+	HeimdallTime  time.Time
+	HeimdallAvg   float64
+	BorErr, HmErr error
+	FinalizedErr  error
+	HFHeight      int64
+	HasHF         bool
+}
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	networksStr := flag.String("networks", "mainnet,amoy", "Comma-separated networks to compare (mainnet, amoy)")
+	borLookback := flag.Int64("bor-lookback", 40000, "Bor blocks the average block time is measured over")
+	hmLookback := flag.Int64("heimdall-lookback", 10000, "Heimdall blocks the average block time is measured over")
+	targetStr := flag.String("target", "", "Target time in RFC3339 (UTC); adds the predicted Bor and Heimdall heights at it")
+	hfStr := flag.String("hf-heights", "", "Bor hardfork heights per network (e.g. mainnet=80000000,amoy=28000000); adds their predicted arrival")
+	mainnetRPC := flag.String("mainnet-rpc", presets["mainnet"].RPC, "Bor JSON-RPC endpoint for mainnet")
+	mainnetBase := flag.String("mainnet-base", presets["mainnet"].Base, "Heimdall Tendermint API for mainnet")
+	amoyRPC := flag.String("amoy-rpc", presets["amoy"].RPC, "Bor JSON-RPC endpoint for amoy")
+	amoyBase := flag.String("amoy-base", presets["amoy"].Base, "Heimdall Tendermint API for amoy")
+	flag.Parse()
+
+	presets["mainnet"] = network{Name: "mainnet", RPC: *mainnetRPC, Base: *mainnetBase}
+	presets["amoy"] = network{Name: "amoy", RPC: *amoyRPC, Base: *amoyBase}
+
+	var nets []network
+	for _, name := range strings.Split(*networksStr, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		n, ok := presets[name]
+		if !ok {
+			failf("unknown network %q (use mainnet or amoy)", name)
+		}
+		nets = append(nets, n)
+	}
+	if len(nets) == 0 {
+		failf("-networks is empty")
+	}
+	if *borLookback < 1 || *hmLookback < 1 {
+		failf("-bor-lookback and -heimdall-lookback must be positive")
+	}
+	var target time.Time
+	if *targetStr != "" {
+		var err error
+		if target, err = parseTarget(*targetStr); err != nil {
+			failf("parse target time: %v", err)
+		}
+	}
+	hf, err := parseHFHeights(*hfStr)
+	if err != nil {
+		failf("parse -hf-heights: %v", err)
+	}
+
+	ctx := context.Background()
+	client := &http.Client{Timeout: httpTimeout}
+
+	cols := make([]column, len(nets))
+	for i, n := range nets {
+		cols[i] = measure(ctx, client, n, *borLookback, *hmLookback)
+		cols[i].HFHeight, cols[i].HasHF = hf[n.Name]
+	}
+
+	// One row per metric, one column per network
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	row := func(label string, cell func(c column) string) {
+		cells := []string{label}
+		for _, c := range cols {
+			cells = append(cells, cell(c))
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	borCell := func(f func(c column) string) func(c column) string {
+		return func(c column) string {
+			if c.BorErr != nil {
+				return "error"
+			}
+			return f(c)
+		}
+	}
+	hmCell := func(f func(c column) string) func(c column) string {
+		return func(c column) string {
+			if c.HmErr != nil {
+				return "error"
+			}
+			return f(c)
+		}
+	}
+
+	if !target.IsZero() {
+		fmt.Printf("Target time: %s (UTC)\n\n", target.Format(time.RFC3339))
+	}
+	header := []string{"Metric"}
+	for _, n := range nets {
+		header = append(header, n.Name)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	row("Bor chain id", borCell(func(c column) string { return strconv.FormatUint(c.ChainID, 10) }))
+	row("Bor height", borCell(func(c column) string { return human.Commas(c.BorHead) }))
+	row("Bor head time", borCell(func(c column) string { return c.BorHeadTime.Format(time.RFC3339) }))
+	row(fmt.Sprintf("Bor avg (last %s)", human.Commas(*borLookback)), borCell(func(c column) string { return fmt.Sprintf("%.6f s", c.BorAvg) }))
+	row("Bor finalized", borCell(func(c column) string {
+		if c.FinalizedErr != nil {
+			return "unavailable"
+		}
+		return human.Commas(c.Finalized)
+	}))
+	row("Bor finality lag", borCell(func(c column) string {
+		if c.FinalizedErr != nil {
+			return "unavailable"
+		}
+		return fmt.Sprintf("%s blocks, %s", human.Commas(c.BorHead-c.Finalized), c.BorHeadTime.Sub(c.FinalizedTime))
+	}))
+	row("Heimdall height", hmCell(func(c column) string { return human.Commas(c.HeimdallHead) }))
+	row("Heimdall head time", hmCell(func(c column) string { return c.HeimdallTime.Format(time.RFC3339) }))
+	row(fmt.Sprintf("Heimdall avg (last %s)", human.Commas(*hmLookback)), hmCell(func(c column) string { return fmt.Sprintf("%.6f s", c.HeimdallAvg) }))
+	if !target.IsZero() {
+		row("Bor height at target", borCell(func(c column) string {
+			_, blocks, err := blocktime.Blocks(target.Sub(c.BorHeadTime), c.BorAvg, blocktime.Nearest)
+			if err != nil {
+				return "-"
+			}
+			return human.Commas(c.BorHead + blocks.Int64())
+		}))
+		row("Heimdall height at target", hmCell(func(c column) string {
+			_, blocks, err := blocktime.Blocks(target.Sub(c.HeimdallTime), c.HeimdallAvg, blocktime.Floor)
+			if err != nil {
+				return "-"
+			}
+			return human.Commas(c.HeimdallHead + blocks.Int64())
+		}))
+	}
+	if len(hf) > 0 {
+		row("Bor HF height", func(c column) string {
+			if !c.HasHF {
+				return "-"
+			}
+			return human.Commas(c.HFHeight)
+		})
+		row("Bor HF arrival", borCell(func(c column) string {
+			if !c.HasHF {
+				return "-"
+			}
+			if c.HFHeight <= c.BorHead {
+				return "reached"
+			}
+			eta := c.BorHeadTime.Add(blocktime.Span(c.HFHeight-c.BorHead, c.BorAvg))
+			return fmt.Sprintf("%s (in %s)", eta.Format(time.RFC3339), human.DHMS(time.Until(eta)))
+		}))
+	}
+	tw.Flush()
+
+	failed := false
+	for i, c := range cols {
+		for _, err := range []error{c.BorErr, c.HmErr} {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %s: %v\n", nets[i].Name, err)
+				failed = true
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// measure fills the column of one network. Bor and Heimdall fail
+// independently so one bad endpoint doesn't blank the whole table.
+func measure(ctx context.Context, client *http.Client, n network, borLookback, hmLookback int64) column {
+	var c column
+	c.BorErr = func() error {
+		var hex string
+		if err := ethrpc.Call(ctx, client, n.RPC, "eth_chainId", []interface{}{}, &hex); err != nil {
+			return fmt.Errorf("get chain id: %w", err)
+		}
+		id, err := ethrpc.HexToUint64(hex)
+		if err != nil {
+			return fmt.Errorf("parse chain id: %w", err)
+		}
+		c.ChainID = id
+		head, headTime, err := getBorBlock(ctx, client, n.RPC, "latest")
+		if err != nil {
+			return fmt.Errorf("get latest block: %w", err)
+		}
+		c.BorHead, c.BorHeadTime = head, headTime
+		from := max(head-borLookback, 0)
+		_, fromTime, err := getBorBlock(ctx, client, n.RPC, fmt.Sprintf("0x%x", from))
+		if err != nil {
+			return fmt.Errorf("get block %d: %w", from, err)
+		}
+		if head == from || !headTime.After(fromTime) {
+			return errors.New("not enough history for an average")
+		}
+		c.BorAvg = headTime.Sub(fromTime).Seconds() / float64(head-from)
+		c.Finalized, c.FinalizedTime, c.FinalizedErr = getBorBlock(ctx, client, n.RPC, "finalized")
+		return nil
+	}()
+
+	c.HmErr = func() error {
+		var sr statusResp
+		if err := getJSON(ctx, client, n.Base+"/status", &sr); err != nil {
+			return fmt.Errorf("status: %w", err)
+		}
+		h, err := strconv.ParseInt(sr.Result.SyncInfo.LatestBlockHeight, 10, 64)
+		if err != nil {
+			return fmt.Errorf("parse latest height: %w", err)
+		}
+		t, err := time.Parse(time.RFC3339Nano, sr.Result.SyncInfo.LatestBlockTime)
+		if err != nil {
+			return fmt.Errorf("parse latest time: %w", err)
+		}
+		c.HeimdallHead, c.HeimdallTime = h, t.UTC()
+		from := max(h-hmLookback, 1)
+		var br blockResp
+		if err := getJSON(ctx, client, fmt.Sprintf("%s/block?height=%d", n.Base, from), &br); err != nil {
+			return fmt.Errorf("get block %d: %w", from, err)
+		}
+		fromTime, err := time.Parse(time.RFC3339Nano, br.Result.Block.Header.Time)
+		if err != nil {
+			return fmt.Errorf("parse time of block %d: %w", from, err)
+		}
+		if h == from || !t.After(fromTime) {
+			return errors.New("not enough history for an average")
+		}
+		c.HeimdallAvg = t.Sub(fromTime).Seconds() / float64(h-from)
+		return nil
+	}()
+	return c
+}
+
+// parseHFHeights parses "mainnet=80000000,amoy=28000000".
+func parseHFHeights(s string) (map[string]int64, error) {
+	out := make(map[string]int64)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, h, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not network=height", part)
+		}
+		height, err := strconv.ParseInt(strings.TrimSpace(h), 10, 64)
+		if err != nil || height < 0 {
+			return nil, fmt.Errorf("invalid height in %q", part)
+		}
+		out[strings.TrimSpace(name)] = height
+	}
+	return out, nil
+}
+
+// getBorBlock returns the height and time of the block at tag, which is a
+// hex height or a tag such as "latest" or "finalized".
+func getBorBlock(ctx context.Context, client *http.Client, rpcURL, tag string) (int64, time.Time, error) {
+	var b *block
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_getBlockByNumber", []interface{}{tag, false}, &b); err != nil {
+		return 0, time.Time{}, err
+	}
+	if b == nil || b.Number == "" || b.Timestamp == "" {
+		return 0, time.Time{}, fmt.Errorf("empty block/timestamp for %s", tag)
+	}
+	h, err := ethrpc.HexToUint64(b.Number)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	ts, err := ethrpc.HexToUint64(b.Timestamp)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return int64(h), time.Unix(int64(ts), 0).UTC(), nil
+}
+
+func parseTarget(s string) (time.Time, error) {
+	// RFC3339Nano also accepts times without fractional seconds
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s))
+	var pe *time.ParseError
+	switch {
+	case errors.As(err, &pe) && pe.Message != "":
+		// Well formed but out of range, e.g. a +25:00 offset or day 32
+		return time.Time{}, fmt.Errorf("invalid time %q%s", clip(s), pe.Message)
+	case err != nil:
+		if alt := suggestTime(s); alt != "" {
+			return time.Time{}, fmt.Errorf("unsupported time format %q; did you mean %s? (use RFC3339/RFC3339Nano)", clip(s), alt)
+		}
+		return time.Time{}, fmt.Errorf("unsupported time format %q (use RFC3339/RFC3339Nano, e.g. 2025-10-07T14:00:00Z)", clip(s))
+	}
+	// Durations saturate about 292 years out, which would skew every delta
+	if y := t.UTC().Year(); y < 1970 || y > 2200 {
+		return time.Time{}, fmt.Errorf("time %q is outside the years 1970-2200", clip(s))
+	}
+	return t.UTC(), nil
+}
+
+// suggestTime returns the RFC3339 time a near miss most likely means, e.g.
+// a missing zone, a space for the T or Unix seconds, or "" when s looks
+// like no time. Times without a zone are taken as UTC, as everywhere else.
+func suggestTime(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339Nano)
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case n >= 1e9 && n < 1e10:
+			return time.Unix(n, 0).UTC().Format(time.RFC3339)
+		case n >= 1e12 && n < 1e13:
+			return time.UnixMilli(n).UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return ""
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(client, req, out)
+}
+
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d for %s", resp.StatusCode, req.URL)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+func failf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", a...)
+	os.Exit(1)
+}
@@ -0,0 +1,173 @@
+package networkcompare
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the comparison end to end through its
+// flags and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("NETWORK_COMPARE_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// genesisTime is block 0 of every test chain.
+const genesisTime = 1_700_000_000
+
+func at(seconds int64) time.Time { return time.Unix(genesisTime+seconds, 0).UTC() }
+
+// borNode is a Bor endpoint whose block h is at genesis + h*spacing, with
+// the "finalized" tag finalizedLag blocks behind head (0 for an endpoint
+// without the tag).
+type borNode struct {
+	chainID       uint64
+	head, spacing int64
+	finalizedLag  int64
+}
+
+func (n borNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params []any           `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "eth_chainId":
+		resp["result"] = fmt.Sprintf("0x%x", n.chainID)
+	case "eth_getBlockByNumber":
+		var h int64
+		switch tag := req.Params[0].(string); tag {
+		case "latest":
+			h = n.head
+		case "finalized":
+			if n.finalizedLag == 0 {
+				resp["error"] = map[string]any{"code": -32602, "message": "invalid block number"}
+				json.NewEncoder(w).Encode(resp)
+				return
+			}
+			h = n.head - n.finalizedLag
+		default:
+			h, _ = strconv.ParseInt(strings.TrimPrefix(tag, "0x"), 16, 64)
+		}
+		resp["result"] = map[string]string{"number": fmt.Sprintf("0x%x", h), "timestamp": fmt.Sprintf("0x%x", at(h*n.spacing).Unix())}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// heimdallNode is a Tendermint API with a block every second up to head.
+type heimdallNode struct{ head int64 }
+
+func (n heimdallNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/status":
+		fmt.Fprintf(w, `{"result":{"sync_info":{"latest_block_height":"%d","latest_block_time":%q}}}`, n.head, at(n.head).Format(time.RFC3339Nano))
+	case "/block":
+		h, _ := strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+		fmt.Fprintf(w, `{"result":{"block":{"header":{"time":%q}}}}`, at(h).Format(time.RFC3339Nano))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newServer(t *testing.T, h http.Handler) string {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs network_compare.go with args and returns its stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "NETWORK_COMPARE_RUN_MAIN=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+func TestCompare(t *testing.T) {
+	// Mainnet Bor has 2s blocks up to 1,000,000 (at 2,000,000s) and
+	// finalizes 100 blocks behind; amoy Bor has 1s blocks up to 100,000
+	// and no finalized tag, and amoy's Heimdall is down
+	mainnetRPC := newServer(t, borNode{chainID: 137, head: 1_000_000, spacing: 2, finalizedLag: 100})
+	mainnetBase := newServer(t, heimdallNode{head: 500_000})
+	amoyRPC := newServer(t, borNode{chainID: 80002, head: 100_000, spacing: 1})
+	amoyBase := newServer(t, http.NotFoundHandler())
+
+	// 200s past mainnet's Bor head is 100 more 2s blocks there; amoy's
+	// head is 1,900,200s earlier, so 1,900,200 more 1s blocks
+	target := at(2_000_200).Format(time.RFC3339)
+	stdout, stderr, err := run(t, "-mainnet-rpc="+mainnetRPC, "-mainnet-base="+mainnetBase, "-amoy-rpc="+amoyRPC, "-amoy-base="+amoyBase,
+		"-bor-lookback=1000", "-heimdall-lookback=500", "-target="+target, "-hf-heights=mainnet=999000,amoy=200000")
+	if err == nil {
+		t.Error("exited 0 with amoy's Heimdall down")
+	}
+	rows := []string{
+		`Target time: ` + target,
+		`Metric\s+mainnet\s+amoy`,
+		`Bor chain id\s+137\s+80002`,
+		`Bor height\s+1,000,000\s+100,000`,
+		`Bor avg \(last 1,000\)\s+2\.000000 s\s+1\.000000 s`,
+		`Bor finalized\s+999,900\s+unavailable`,
+		`Bor finality lag\s+100 blocks, 3m20s\s+unavailable`,
+		`Heimdall height\s+500,000\s+error`,
+		`Heimdall avg \(last 500\)\s+1\.000000 s\s+error`,
+		`Bor height at target\s+1,000,100\s+2,000,200`,
+		// Heimdall's head is 1,500,200s before the target
+		`Heimdall height at target\s+2,000,200\s+error`,
+		`Bor HF height\s+999,000\s+200,000`,
+		// Amoy's 100,000 blocks to go at 1s land 100,000s after its head
+		`Bor HF arrival\s+reached\s+` + regexp.QuoteMeta(at(200_000).Format(time.RFC3339)) + ` \(in -`,
+	}
+	for _, r := range rows {
+		if !regexp.MustCompile(r).MatchString(stdout) {
+			t.Errorf("no row %q:\n%s", r, stdout)
+		}
+	}
+	if !strings.Contains(stderr, "error: amoy: status: HTTP 404") || strings.Contains(stderr, "mainnet") {
+		t.Errorf("stderr:\n%s", stderr)
+	}
+
+	// One network alone, with nothing failing
+	if _, stderr, err := run(t, "-networks=mainnet", "-mainnet-rpc="+mainnetRPC, "-mainnet-base="+mainnetBase); err != nil {
+		t.Errorf("mainnet: %v\n%s", err, stderr)
+	}
+}
+
+func TestCompareInput(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-networks=mainnet,mumbai"}, `unknown network "mumbai"`},
+		{[]string{"-networks= ,"}, "-networks is empty"},
+		{[]string{"-bor-lookback=0"}, "must be positive"},
+		{[]string{"-target=2025-01-01"}, "did you mean 2025-01-01T00:00:00Z?"},
+		{[]string{"-hf-heights=mainnet"}, `"mainnet" is not network=height`},
+		{[]string{"-hf-heights=mainnet=-5"}, `invalid height in "mainnet=-5"`},
+	}
+	for _, tt := range tests {
+		if _, stderr, err := run(t, tt.args...); err == nil || !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: %v\n%s", tt.args, err, stderr)
+		}
+	}
+}
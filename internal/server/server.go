@@ -0,0 +1,3305 @@
+// Package server is chain_utils_server.go: it serves the calculators over
+// HTTP, with metrics, alerts and a dashboard.
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/blocktime"
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+	"github.com/pratikspatil024/chain-utils/pkg/fetch"
+	"github.com/pratikspatil024/chain-utils/pkg/ledger"
+)
+
+const (
+	defaultRPC      = "https://polygon-rpc.com"
+	defaultBase     = "https://tendermint-api.polygon.technology"
+	defaultRESTBase = "https://heimdall-api.polygon.technology"
+
+	// fetchConcurrency bounds the block requests one API request has in
+	// flight at once.
+	fetchConcurrency = 4
+)
+
+// chain is the minimal view of a block source the endpoints need.
+type chain interface {
+	Name() string
+	Endpoint() string
+	Head(ctx context.Context) (int64, time.Time, error)
+	BlockTime(ctx context.Context, height int64) (time.Time, error)
+}
+
+type server struct {
+	// mu guards live, which a config reload swaps for a new one. It is only
+	// held to read or swap the pointer, never across upstream requests.
+	mu   sync.RWMutex
+	live *liveConfig
+
+	network          string
+	defaultLookbacks map[string][]int64
+	metrics          *metrics
+	conditions       *conditionTracker
+	lastAdvance      map[string]headAdvance
+	health           *healthState
+	dashboard        *dashboard
+	stream           *streamBroker
+	exporters        []metricsExporter
+	scheduler        *predictionScheduler // set by scheduleLoop once an interval is configured
+	rescheduled      chan struct{}        // wakes scheduleLoop when a reload changes the interval
+	webhook          string
+	httpc            *http.Client
+}
+
+// liveConfig is everything a config reload replaces. A reload builds a new
+// one, so a refresh or request in flight finishes with the one it started
+// with; the alerters that keep state across reloads are carried over.
+type liveConfig struct {
+	chains      map[string]chain
+	links       map[string]explorerURLs
+	rest        *heimdallREST
+	targets     []etaTarget
+	notifiers   []notifier
+	countdown   *countdownAlerter
+	divergence  divergenceConfig
+	baselines   map[string]baselineConfig
+	halt        haltConfig
+	finality    finalityConfig
+	checkpoints checkpointStallConfig
+	lag         map[string]lagConfig
+	incidents   *incidentManager
+	digest      *emailDigest
+	every       time.Duration // re-estimation interval; 0 when not scheduled
+}
+
+// view is the server under one liveConfig. Everything that reads reloadable
+// settings runs on a view, so it needs no lock.
+type view struct {
+	*server
+	*liveConfig
+}
+
+// view returns the server under its current config.
+func (s *server) view() view {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return view{s, s.live}
+}
+
+// etaTarget is tracked by the background refresher, given on the command line
+// as kind:value. Kinds are bor and heimdall (block heights), checkpoint (a
+// Heimdall checkpoint number) and proposal (a Heimdall governance proposal
+// id, tracked until its voting period ends). The kind is kept in chain.
+type etaTarget struct {
+	chain  string
+	height int64
+}
+
+func (t etaTarget) String() string { return fmt.Sprintf("%s:%d", t.chain, t.height) }
+
+type averageEntry struct {
+	Lookback       int64   `json:"lookback"`
+	FromHeight     int64   `json:"from_height"`
+	FromTime       string  `json:"from_time"`
+	FromURL        string  `json:"from_url,omitempty"`
+	ToHeight       int64   `json:"to_height"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	AvgBlockTime   float64 `json:"avg_block_time_seconds"`
+	BlocksPerHour  float64 `json:"blocks_per_hour"`
+	Error          string  `json:"error,omitempty"`
+}
+
+type avgReport struct {
+	Chain         string         `json:"chain"`
+	CurrentHeight int64          `json:"current_height"`
+	CurrentTime   string         `json:"current_time"`
+	CurrentURL    string         `json:"current_url,omitempty"`
+	Averages      []averageEntry `json:"averages"`
+}
+
+type predictReport struct {
+	Chain           string  `json:"chain"`
+	CurrentHeight   int64   `json:"current_height"`
+	CurrentTime     string  `json:"current_time"`
+	CurrentURL      string  `json:"current_url,omitempty"`
+	TargetTime      string  `json:"target_time"`
+	AvgBlockTime    float64 `json:"avg_block_time_seconds"`
+	AvgSource       string  `json:"avg_source"`
+	DeltaSeconds    float64 `json:"delta_seconds"`
+	BlocksExact     string  `json:"blocks_exact"`
+	PredictedHeight int64   `json:"predicted_height"`
+	PredictedURL    string  `json:"predicted_url,omitempty"`
+}
+
+type etaReport struct {
+	Chain         string  `json:"chain"`
+	CurrentHeight int64   `json:"current_height"`
+	CurrentTime   string  `json:"current_time"`
+	CurrentURL    string  `json:"current_url,omitempty"`
+	TargetHeight  int64   `json:"target_height"`
+	TargetURL     string  `json:"target_url,omitempty"`
+	BlocksLeft    int64   `json:"blocks_left"`
+	Reached       bool    `json:"reached"`
+	AvgBlockTime  float64 `json:"avg_block_time_seconds,omitempty"`
+	AvgSource     string  `json:"avg_source"`
+	ETA           string  `json:"eta"`
+	ETASeconds    float64 `json:"eta_seconds"`
+}
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	listen := flag.String("listen", ":8080", "Address to serve the HTTP API on")
+	rpcURL := flag.String("rpc", defaultRPC, "Polygon (Bor) JSON-RPC endpoint")
+	base := flag.String("base", defaultBase, "Base URL for the Heimdall Tendermint RPC-compatible API")
+	restBase := flag.String("heimdall-rest", defaultRESTBase, "Heimdall REST API, used by checkpoint and proposal targets")
+	timeout := flag.Duration("timeout", 20*time.Second, "HTTP request timeout towards upstream endpoints")
+	targetsStr := flag.String("targets", "", "Comma-separated targets exported as ETA metrics: bor:<height>, heimdall:<height>, checkpoint:<number>, proposal:<id>")
+	refresh := flag.Duration("refresh", 30*time.Second, "How often the metrics are recomputed")
+	network := flag.String("network", "mainnet", "Network name attached to every exported metric")
+	metricsPrefix := flag.String("metrics-prefix", "chainutils", "Prefix for exported metric names")
+	slackWebhook := flag.String("slack-webhook", "", "Slack incoming-webhook URL for countdown alerts")
+	alertThresholds := flag.String("alert-thresholds", "7d,24h,1h,0", "Comma-separated ETA thresholds that trigger a countdown alert (0 = activation reached); drop an entry to disable it")
+	alertTemplate := flag.String("alert-template", defaultAlertTemplate, "text/template for countdown alert messages")
+	configPath := flag.String("config", "", "Optional JSON config file (targets, endpoints, notification channels); re-read on SIGHUP")
+	every := flag.Duration("every", 0, "Re-estimate every -targets entry at this interval and append it to -ledger (0 disables)")
+	ledgerPath := flag.String("ledger", ledger.DefaultPath(), "Prediction ledger written by -every: a JSON-lines file, or a postgres:// URL shared by a team")
+	minMove := flag.Duration("notify-min-move", 15*time.Minute, "With -every, notify only when a target's ETA moved by more than this")
+	webhook := flag.String("webhook", "", "URL that receives the full JSON report (POST) after every refresh")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "On SIGTERM/SIGINT, how long to wait for in-flight requests before exiting")
+	drainDelay := flag.Duration("drain-delay", 5*time.Second, "On SIGTERM/SIGINT, how long /readyz reports draining before the listener closes")
+	statsdAddr := flag.String("statsd", "", "Push metrics after every refresh to this StatsD/DogStatsD address (host:port, UDP)")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "Push metrics after every refresh to this OTLP/HTTP collector (e.g. http://localhost:4318)")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	logFile := flag.String("log-file", "", "Write logs to this file instead of stderr, rotating it by size")
+	logMaxSize := flag.Int64("log-max-size", 100, "With -log-file, rotate once the file reaches this many MB")
+	logRotateEvery := flag.Duration("log-rotate-every", 0, "With -log-file, also rotate after this long (e.g. 24h; 0 = size only)")
+	logBackups := flag.Int("log-backups", 5, "With -log-file, how many rotated files (name.1 ... name.N) to keep")
+	readyMaxAge := flag.Duration("ready-max-age", 2*time.Minute, "Maximum age of the last successful refresh and of the chain head for /readyz to report ready")
+	flag.Parse()
+
+	if err := setupLogging(*logFormat, *logFile, *logMaxSize<<20, *logRotateEvery, *logBackups); err != nil {
+		log.Fatalf("logging: %v", err)
+	}
+
+	tmpl, err := template.New("alert").Parse(*alertTemplate)
+	if err != nil {
+		log.Fatalf("parse alert template: %v", err)
+	}
+
+	httpc := &http.Client{Timeout: *timeout}
+	m := newMetrics(*metricsPrefix)
+	srv := &server{
+		network: *network,
+		metrics: m,
+		defaultLookbacks: map[string][]int64{
+			"bor":      {40_000, 280_000, 560_000, 1_120_000},
+			"heimdall": {10_000, 100_000, 1_000_000, 1_500_000},
+		},
+		webhook:     *webhook,
+		httpc:       httpc,
+		conditions:  newConditionTracker(),
+		lastAdvance: make(map[string]headAdvance),
+		health:      newHealthState(*refresh+*timeout, *readyMaxAge),
+		dashboard:   newDashboard(120),
+		stream:      newStreamBroker(),
+		rescheduled: make(chan struct{}, 1),
+	}
+	if *statsdAddr != "" {
+		e, err := newStatsdExporter(*statsdAddr)
+		if err != nil {
+			log.Fatalf("statsd: %v", err)
+		}
+		srv.exporters = append(srv.exporters, e)
+	}
+	if *otlpEndpoint != "" {
+		srv.exporters = append(srv.exporters, &otlpExporter{client: httpc, endpoint: strings.TrimSuffix(*otlpEndpoint, "/") + "/v1/metrics", start: time.Now()})
+	}
+
+	// apply (re)builds everything -config can change. Flags provide the
+	// defaults; alert state such as fired thresholds and open incidents is
+	// kept across reloads.
+	apply := func() error {
+		var cfg serverConfig
+		if *configPath != "" {
+			if cfg, err = loadConfig(*configPath); err != nil {
+				return err
+			}
+		}
+		if *slackWebhook != "" {
+			cfg.Notifiers.Slack = &webhookConfig{Webhook: *slackWebhook}
+		}
+		targetsSpec := *targetsStr
+		if len(cfg.Targets) > 0 {
+			targetsSpec = strings.Join(cfg.Targets, ",")
+		}
+		targets, err := parseTargets(targetsSpec)
+		if err != nil {
+			return fmt.Errorf("parse targets: %w", err)
+		}
+		thresholdsSpec := *alertThresholds
+		if cfg.AlertThresholds != nil {
+			thresholdsSpec = *cfg.AlertThresholds
+		}
+		thresholds, err := parseDurations(thresholdsSpec)
+		if err != nil {
+			return fmt.Errorf("parse alert thresholds: %w", err)
+		}
+		interval := *every
+		if cfg.Every != nil {
+			if interval, err = time.ParseDuration(*cfg.Every); err != nil || interval < 0 {
+				return fmt.Errorf("every: invalid interval %q", *cfg.Every)
+			}
+		}
+		if interval > 0 && len(targets) == 0 {
+			return errors.New("-every needs -targets")
+		}
+		borURL, heimdallBase := *rpcURL, *base
+		if cfg.Endpoints.Bor != "" {
+			borURL = cfg.Endpoints.Bor
+		}
+		if cfg.Endpoints.Heimdall != "" {
+			heimdallBase = cfg.Endpoints.Heimdall
+		}
+		restURL := *restBase
+		if cfg.Endpoints.HeimdallREST != "" {
+			restURL = cfg.Endpoints.HeimdallREST
+		}
+
+		links := make(map[string]explorerURLs)
+		for name, preset := range defaultExplorers {
+			if u, err := resolveExplorer(preset, *network); err == nil {
+				links[name] = u
+			}
+		}
+		for name, spec := range cfg.Explorers {
+			if links[name], err = resolveExplorer(spec, *network); err != nil {
+				return fmt.Errorf("explorer for %s: %w", name, err)
+			}
+		}
+
+		live := &liveConfig{
+			chains: map[string]chain{
+				"bor":      &instrumentedChain{chain: &borChain{client: httpc, rpcURL: borURL}, metrics: m, network: *network},
+				"heimdall": &instrumentedChain{chain: &heimdallChain{client: httpc, base: heimdallBase}, metrics: m, network: *network},
+			},
+			links:       links,
+			targets:     targets,
+			rest:        &heimdallREST{client: httpc, base: restURL},
+			notifiers:   buildNotifiers(cfg, httpc),
+			divergence:  cfg.Divergence,
+			baselines:   cfg.Baselines,
+			halt:        cfg.Halt,
+			finality:    cfg.Finality,
+			checkpoints: cfg.Checkpoints,
+			lag:         cfg.Lag,
+			every:       interval,
+		}
+		old := srv.view().liveConfig
+		if old == nil {
+			live.countdown = newCountdownAlerter(thresholds, tmpl)
+			live.incidents = newIncidentManager(cfg.Incidents, buildIncidentSinks(cfg.Incidents, httpc))
+		} else {
+			live.countdown = old.countdown
+			live.countdown.setThresholds(thresholds)
+			live.incidents = old.incidents
+			live.incidents.reconfigure(cfg.Incidents, buildIncidentSinks(cfg.Incidents, httpc))
+		}
+		if cfg.Email != nil {
+			if old != nil && old.digest != nil {
+				live.digest = old.digest
+				live.digest.setConfig(*cfg.Email)
+			} else {
+				live.digest = newEmailDigest(*cfg.Email)
+			}
+		}
+		srv.conditions.setPolicy(cfg.Alerting)
+
+		srv.mu.Lock()
+		srv.live = live
+		srv.mu.Unlock()
+		if old != nil && old.every != interval {
+			select {
+			case srv.rescheduled <- struct{}{}:
+			default:
+			}
+		}
+		log.Printf("config applied (bor: %s, heimdall: %s, %d targets)", borURL, heimdallBase, len(targets))
+		return nil
+	}
+	if err := apply(); err != nil {
+		log.Fatalf("load config: %v", err)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := apply(); err != nil {
+				log.Printf("reload config: %v (keeping the previous one)", err)
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	for _, name := range []string{"bor", "heimdall"} {
+		mux.HandleFunc("/v1/"+name+"/avg", srv.handle(name, view.avg))
+		mux.HandleFunc("/v1/"+name+"/predict", srv.handle(name, view.predict))
+		mux.HandleFunc("/v1/"+name+"/eta", srv.handle(name, view.eta))
+	}
+	mux.HandleFunc("/", srv.dashboard.servePage)
+	mux.HandleFunc("/v1/dashboard", srv.dashboard.serveData)
+	mux.HandleFunc("/v1/stream", srv.stream.serve)
+	mux.HandleFunc("/healthz", srv.health.serveLive)
+	mux.HandleFunc("/readyz", srv.health.serveReady)
+	mux.HandleFunc("/startupz", srv.health.serveStartup)
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.writeTo(w)
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go srv.refreshLoop(ctx, *refresh)
+	go srv.scheduleLoop(ctx, *ledgerPath, *minMove)
+
+	hs := &http.Server{Addr: *listen, Handler: mux}
+	hs.RegisterOnShutdown(srv.stream.close)
+	errc := make(chan error, 1)
+	go func() { errc <- hs.ListenAndServe() }()
+	log.Printf("serving on %s", *listen)
+
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	// Fail readiness first so load balancers stop routing here, then stop
+	// accepting connections and let in-flight requests finish.
+	log.Printf("shutting down: draining for %s", *drainDelay)
+	srv.health.drain()
+	time.Sleep(*drainDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := hs.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	log.Printf("stopped")
+}
+
+// explorerURLs are the block page templates of an explorer on one network.
+// Countdown, when set, is used for heights not produced yet.
+type explorerURLs struct {
+	Block     string
+	Countdown string
+}
+
+// blockExplorers maps an explorer preset to its templates per network.
+var blockExplorers = map[string]map[string]explorerURLs{
+	"polygonscan": {
+		"mainnet": {Block: "https://polygonscan.com/block/%d", Countdown: "https://polygonscan.com/block/countdown/%d"},
+		"amoy":    {Block: "https://amoy.polygonscan.com/block/%d", Countdown: "https://amoy.polygonscan.com/block/countdown/%d"},
+	},
+	"oklink": {
+		"mainnet": {Block: "https://www.oklink.com/polygon/block/%d"},
+		"amoy":    {Block: "https://www.oklink.com/amoy/block/%d"},
+	},
+	"mintscan": {
+		"mainnet": {Block: "https://www.mintscan.io/polygon/block/%d"},
+	},
+}
+
+// defaultExplorers is linked per chain unless the config names another
+// explorer. A network the preset has no links for gets none.
+var defaultExplorers = map[string]string{"bor": "polygonscan", "heimdall": "mintscan"}
+
+// resolveExplorer turns an explorers config entry into templates for
+// network. The entry is a preset name, a URL template with one %d for the
+// height, or empty for no links.
+func resolveExplorer(name, network string) (explorerURLs, error) {
+	switch {
+	case name == "":
+		return explorerURLs{}, nil
+	case strings.Count(name, "%d") == 1:
+		return explorerURLs{Block: name}, nil
+	}
+	byNetwork, ok := blockExplorers[name]
+	if !ok {
+		return explorerURLs{}, fmt.Errorf("unknown explorer %q (use polygonscan, oklink, mintscan or a URL template with %%d)", name)
+	}
+	u, ok := byNetwork[network]
+	if !ok {
+		return explorerURLs{}, fmt.Errorf("explorer %s has no links for network %q", name, network)
+	}
+	return u, nil
+}
+
+// url links height, or returns "" when links are disabled.
+func (e explorerURLs) url(height int64, future bool) string {
+	if future && e.Countdown != "" {
+		return fmt.Sprintf(e.Countdown, height)
+	}
+	if e.Block == "" {
+		return ""
+	}
+	return fmt.Sprintf(e.Block, height)
+}
+
+// badRequest marks errors caused by the caller's query rather than upstream.
+type badRequest struct{ error }
+
+func (s *server) handle(name string, fn func(v view, ctx context.Context, c chain, links explorerURLs, q map[string][]string) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		v := s.view()
+		out, err := fn(v, r.Context(), v.chains[name], v.links[name], r.URL.Query())
+		if err != nil {
+			status := http.StatusBadGateway
+			var br badRequest
+			if errors.As(err, &br) {
+				status = http.StatusBadRequest
+			}
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("write response: %v", err)
+	}
+}
+
+func (s view) avg(ctx context.Context, c chain, links explorerURLs, q map[string][]string) (any, error) {
+	lookbacks := s.defaultLookbacks[c.Name()]
+	if v := first(q, "lookbacks"); v != "" {
+		var err error
+		if lookbacks, err = parseLookbacks(v); err != nil {
+			return nil, badRequest{err}
+		}
+	}
+
+	n, nTime, err := c.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get head: %w", err)
+	}
+	rep := avgReport{Chain: c.Name(), CurrentHeight: n, CurrentTime: nTime.Format(time.RFC3339Nano), CurrentURL: links.url(n, false)}
+	rep.Averages = make([]averageEntry, len(lookbacks))
+	g := fetch.NewGroup(ctx, fetchConcurrency)
+	for i, lb := range lookbacks {
+		e := &rep.Averages[i]
+		*e = averageEntry{Lookback: lb, FromHeight: n - lb, ToHeight: n}
+		if e.FromHeight < 0 {
+			e.Error = fmt.Sprintf("lookback exceeds chain height; the longest possible is %d", n)
+			continue
+		}
+		g.Go(func(ctx context.Context) error {
+			t0, err := c.BlockTime(ctx, e.FromHeight)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				e.Error = err.Error()
+				return nil
+			}
+			elapsed := nTime.Sub(t0).Seconds()
+			e.FromTime = t0.Format(time.RFC3339Nano)
+			e.FromURL = links.url(e.FromHeight, false)
+			e.ElapsedSeconds = elapsed
+			e.AvgBlockTime = elapsed / float64(lb)
+			e.BlocksPerHour = 3600 / e.AvgBlockTime
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+func (s view) predict(ctx context.Context, c chain, links explorerURLs, q map[string][]string) (any, error) {
+	target, err := parseTime(first(q, "target"))
+	if err != nil {
+		return nil, badRequest{fmt.Errorf("target: %w", err)}
+	}
+	n, nTime, err := c.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get head: %w", err)
+	}
+	avg, source, err := s.averageFor(ctx, c, q, n, nTime)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := target.Sub(nTime)
+	exact, rounded, err := blocktime.Blocks(delta, avg, blocktime.Nearest)
+	if err != nil {
+		return nil, badRequest{err}
+	}
+	predicted := n + rounded.Int64()
+	if predicted < 0 {
+		predicted = 0
+	}
+	return predictReport{
+		Chain:           c.Name(),
+		CurrentHeight:   n,
+		CurrentTime:     nTime.Format(time.RFC3339Nano),
+		CurrentURL:      links.url(n, false),
+		TargetTime:      target.Format(time.RFC3339Nano),
+		AvgBlockTime:    avg,
+		AvgSource:       source,
+		DeltaSeconds:    delta.Seconds(),
+		BlocksExact:     exact.FloatString(3),
+		PredictedHeight: predicted,
+		PredictedURL:    links.url(predicted, predicted > n),
+	}, nil
+}
+
+func (s view) eta(ctx context.Context, c chain, links explorerURLs, q map[string][]string) (any, error) {
+	height, err := strconv.ParseInt(first(q, "height"), 10, 64)
+	if err != nil || height < 0 {
+		return nil, badRequest{fmt.Errorf("height must be a non-negative block number, got %q", first(q, "height"))}
+	}
+	n, nTime, err := c.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get head: %w", err)
+	}
+	if height <= n {
+		// Produced already: report when, rather than extrapolating back
+		at, err := c.BlockTime(ctx, height)
+		if err != nil {
+			return nil, fmt.Errorf("fetch block %d: %w", height, err)
+		}
+		return etaReport{
+			Chain:         c.Name(),
+			CurrentHeight: n,
+			CurrentTime:   nTime.Format(time.RFC3339Nano),
+			CurrentURL:    links.url(n, false),
+			TargetHeight:  height,
+			TargetURL:     links.url(height, false),
+			Reached:       true,
+			AvgSource:     "block timestamp",
+			ETA:           at.Format(time.RFC3339),
+			ETASeconds:    at.Sub(nTime).Seconds(),
+		}, nil
+	}
+	avg, source, err := s.averageFor(ctx, c, q, n, nTime)
+	if err != nil {
+		return nil, err
+	}
+
+	left := height - n
+	in := blocktime.Span(left, avg)
+	return etaReport{
+		Chain:         c.Name(),
+		CurrentHeight: n,
+		CurrentTime:   nTime.Format(time.RFC3339Nano),
+		CurrentURL:    links.url(n, false),
+		TargetHeight:  height,
+		TargetURL:     links.url(height, height > n),
+		BlocksLeft:    left,
+		AvgBlockTime:  avg,
+		AvgSource:     source,
+		ETA:           nTime.Add(in).Format(time.RFC3339),
+		ETASeconds:    in.Seconds(),
+	}, nil
+}
+
+// averageFor returns the ?avg= override, or the average over the chain's
+// shortest default lookback.
+func (s view) averageFor(ctx context.Context, c chain, q map[string][]string, n int64, nTime time.Time) (float64, string, error) {
+	if v := first(q, "avg"); v != "" {
+		avg, err := strconv.ParseFloat(v, 64)
+		if err != nil || avg <= 0 {
+			return 0, "", badRequest{fmt.Errorf("avg must be a positive number, got %q", v)}
+		}
+		return avg, "query", nil
+	}
+	lb := s.defaultLookbacks[c.Name()][0]
+	if lb > n {
+		lb = n
+	}
+	t0, err := c.BlockTime(ctx, n-lb)
+	if err != nil {
+		return 0, "", fmt.Errorf("fetch block %d: %w", n-lb, err)
+	}
+	return nTime.Sub(t0).Seconds() / float64(lb), fmt.Sprintf("last %d blocks", lb), nil
+}
+
+// refreshLoop recomputes the exported gauges every interval.
+func (s *server) refreshLoop(ctx context.Context, interval time.Duration) {
+	for {
+		s.view().refresh(ctx)
+		s.pushMetrics(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s view) refresh(ctx context.Context) {
+	s.health.tick()
+	names := make([]string, 0, len(s.chains))
+	for name := range s.chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	etas := make(map[string]time.Time)
+	report := refreshReport{Network: s.network, ComputedAt: time.Now().UTC(), Chains: make(map[string]avgReport)}
+	for _, name := range names {
+		c := s.chains[name]
+		out, err := s.avg(ctx, c, s.links[name], nil)
+		if err != nil {
+			log.Printf("refresh %s: %v", name, err)
+			s.health.record(name, 0, time.Time{}, err)
+			continue
+		}
+		rep := out.(avgReport)
+		nTime, _ := time.Parse(time.RFC3339Nano, rep.CurrentTime)
+		s.health.record(name, rep.CurrentHeight, nTime, nil)
+		report.Chains[name] = rep
+		labels := metricLabels(s.network, c)
+		s.metrics.setGauge("head_height", "Latest observed block height.", rep.CurrentHeight, labels...)
+		s.metrics.setGauge("head_timestamp_seconds", "Unix timestamp of the latest observed block.", float64(nTime.Unix()), labels...)
+		s.metrics.setGauge("head_age_seconds", "Seconds between the latest block timestamp and the wall clock.", time.Since(nTime).Seconds(), labels...)
+
+		// ETAs use the shortest lookback that could be computed
+		var shortest float64
+		for _, e := range rep.Averages {
+			if e.Error != "" {
+				continue
+			}
+			if shortest == 0 {
+				shortest = e.AvgBlockTime
+			}
+			s.metrics.setGauge("avg_block_time_seconds", "Average block time over the trailing window of blocks.", e.AvgBlockTime,
+				append(labels, "estimator", estimatorLookbackMean, "window", strconv.FormatInt(e.Lookback, 10))...)
+		}
+
+		critical := false
+		for _, t := range s.targets {
+			if t.chain != name || shortest == 0 {
+				continue
+			}
+			in := blocktime.Span(max(t.height-rep.CurrentHeight, 0), shortest)
+			s.metrics.setGauge("target_eta_seconds", "Estimated seconds until the target height is reached.", in.Seconds(),
+				append(labels, "estimator", estimatorLookbackMean, "target", t.String())...)
+			if msg := s.countdown.check(t, rep.CurrentHeight, t.height-rep.CurrentHeight, nTime, in); msg != "" {
+				s.notify(ctx, msg)
+			}
+			etas[t.String()] = nTime.Add(in)
+			report.Targets = append(report.Targets, etaReport{
+				Chain:         name,
+				CurrentHeight: rep.CurrentHeight,
+				CurrentTime:   rep.CurrentTime,
+				TargetHeight:  t.height,
+				BlocksLeft:    t.height - rep.CurrentHeight,
+				Reached:       t.height <= rep.CurrentHeight,
+				AvgBlockTime:  shortest,
+				AvgSource:     "shortest lookback",
+				ETA:           etas[t.String()].Format(time.RFC3339),
+				ETASeconds:    in.Seconds(),
+			})
+			if s.incidents.inCriticalWindow(in) {
+				critical = true
+			}
+		}
+		if len(s.targets) == 0 || s.incidents.criticalWindow() == 0 {
+			critical = true
+		}
+		s.incidents.observe(ctx, name, rep.CurrentHeight, shortest, critical)
+		s.checkBaseline(ctx, name, rep.Averages)
+		s.checkHalt(ctx, name, rep.CurrentHeight)
+	}
+
+	if s.digest != nil && len(etas) > 0 {
+		s.digest.update(etas)
+	}
+	for _, t := range s.targets {
+		if t.chain != "checkpoint" && t.chain != "proposal" {
+			continue
+		}
+		rep, err := s.milestoneETA(ctx, t)
+		if err != nil {
+			log.Printf("refresh %s: %v", t, err)
+			continue
+		}
+		eta, _ := time.Parse(time.RFC3339, rep.ETA)
+		now, _ := time.Parse(time.RFC3339Nano, rep.CurrentTime)
+		s.metrics.setGauge("target_eta_seconds", "Estimated seconds until the target height is reached.", rep.ETASeconds,
+			"network", s.network, "chain", "heimdall", "endpoint", endpointLabel(s.rest.base), "estimator", rep.AvgSource, "target", t.String())
+		if msg := s.countdown.check(t, rep.CurrentHeight, rep.BlocksLeft, now, eta.Sub(now)); msg != "" {
+			s.notify(ctx, msg)
+		}
+		etas[t.String()] = eta
+		report.Targets = append(report.Targets, rep)
+	}
+
+	s.checkDivergence(ctx)
+	s.checkLag(ctx)
+	s.checkFinality(ctx)
+	if bor, ok := report.Chains["bor"]; ok {
+		s.checkCheckpoints(ctx, bor.CurrentHeight)
+	}
+
+	s.dashboard.record(report)
+	for _, name := range sortedKeys(report.Chains) {
+		rep := report.Chains[name]
+		s.stream.publish("head", name, map[string]any{"chain": name, "height": rep.CurrentHeight, "time": rep.CurrentTime})
+	}
+	for _, t := range report.Targets {
+		s.stream.publish("eta", etaTarget{chain: t.Chain, height: t.TargetHeight}.String(), t)
+	}
+
+	if s.webhook != "" && len(report.Chains) > 0 {
+		if err := postJSON(ctx, s.httpc, s.webhook, report); err != nil {
+			log.Printf("post report to webhook: %v", err)
+		}
+	}
+}
+
+// refreshReport is the payload -webhook receives after every refresh.
+type refreshReport struct {
+	Network    string               `json:"network"`
+	ComputedAt time.Time            `json:"computed_at"`
+	Chains     map[string]avgReport `json:"chains"`
+	Targets    []etaReport          `json:"targets,omitempty"`
+}
+
+// ---- Checkpoint and proposal targets ----
+
+const (
+	estimatorCheckpointCadence = "checkpoint-cadence"
+	estimatorVotingEnd         = "proposal-voting-end"
+
+	// checkpointSample is how many recent checkpoints set the cadence.
+	checkpointSample = 10
+)
+
+// heimdallREST reads checkpoints and governance proposals from the Heimdall
+// REST API. Both the v1 ({"result": ...}) and v2 response shapes are accepted.
+type heimdallREST struct {
+	client *http.Client
+	base   string
+}
+
+func (h *heimdallREST) checkpointCount(ctx context.Context) (int64, error) {
+	var resp struct {
+		AckCount json.Number `json:"ack_count"`
+		Result   struct {
+			Result json.Number `json:"result"`
+		} `json:"result"`
+	}
+	if err := getJSON(ctx, h.client, h.base+"/checkpoints/count", &resp); err != nil {
+		return 0, err
+	}
+	n := resp.AckCount
+	if n == "" {
+		n = resp.Result.Result
+	}
+	return n.Int64()
+}
+
+type checkpointInfo struct {
+	EndBlock int64
+	Time     time.Time
+}
+
+func (h *heimdallREST) checkpoint(ctx context.Context, number int64) (checkpointInfo, error) {
+	type checkpoint struct {
+		EndBlock  json.Number `json:"end_block"`
+		Timestamp json.Number `json:"timestamp"`
+	}
+	var resp struct {
+		Checkpoint checkpoint `json:"checkpoint"`
+		Result     checkpoint `json:"result"`
+	}
+	if err := getJSON(ctx, h.client, fmt.Sprintf("%s/checkpoints/%d", h.base, number), &resp); err != nil {
+		return checkpointInfo{}, err
+	}
+	cp := resp.Checkpoint
+	if cp.Timestamp == "" {
+		cp = resp.Result
+	}
+	sec, err := cp.Timestamp.Int64()
+	if err != nil {
+		return checkpointInfo{}, fmt.Errorf("checkpoint %d timestamp: %w", number, err)
+	}
+	end, _ := cp.EndBlock.Int64()
+	return checkpointInfo{EndBlock: end, Time: time.Unix(sec, 0).UTC()}, nil
+}
+
+func (h *heimdallREST) checkpointTime(ctx context.Context, number int64) (time.Time, error) {
+	cp, err := h.checkpoint(ctx, number)
+	return cp.Time, err
+}
+
+func (h *heimdallREST) votingEnd(ctx context.Context, id int64) (time.Time, error) {
+	type proposal struct {
+		VotingEndTime string `json:"voting_end_time"`
+	}
+	var resp struct {
+		Proposal proposal `json:"proposal"`
+		Result   proposal `json:"result"`
+	}
+	if err := getJSON(ctx, h.client, fmt.Sprintf("%s/cosmos/gov/v1/proposals/%d", h.base, id), &resp); err != nil {
+		if err := getJSON(ctx, h.client, fmt.Sprintf("%s/gov/proposals/%d", h.base, id), &resp); err != nil {
+			return time.Time{}, err
+		}
+	}
+	end := resp.Proposal.VotingEndTime
+	if end == "" {
+		end = resp.Result.VotingEndTime
+	}
+	if end == "" {
+		return time.Time{}, fmt.Errorf("proposal %d has no voting end time (still in deposit period?)", id)
+	}
+	return time.Parse(time.RFC3339Nano, end)
+}
+
+// milestoneETA estimates a checkpoint or proposal target. Checkpoint ETAs
+// extrapolate the cadence of the last checkpointSample checkpoints; a
+// proposal's ETA is the end of its voting period, with BlocksLeft 1 until
+// then and 0 afterwards.
+func (s view) milestoneETA(ctx context.Context, t etaTarget) (etaReport, error) {
+	now := time.Now().UTC()
+	switch t.chain {
+	case "checkpoint":
+		n, err := s.rest.checkpointCount(ctx)
+		if err != nil {
+			return etaReport{}, fmt.Errorf("checkpoint count: %w", err)
+		}
+		if n <= checkpointSample {
+			return etaReport{}, fmt.Errorf("only %d checkpoints, need more than %d", n, checkpointSample)
+		}
+		last, err := s.rest.checkpointTime(ctx, n)
+		if err != nil {
+			return etaReport{}, err
+		}
+		prev, err := s.rest.checkpointTime(ctx, n-checkpointSample)
+		if err != nil {
+			return etaReport{}, err
+		}
+		interval := last.Sub(prev).Seconds() / checkpointSample
+		left := t.height - n
+		eta := last.Add(blocktime.Span(max(left, 0), interval))
+		return etaReport{
+			Chain:         t.chain,
+			CurrentHeight: n,
+			CurrentTime:   now.Format(time.RFC3339Nano),
+			TargetHeight:  t.height,
+			BlocksLeft:    left,
+			Reached:       left <= 0,
+			AvgBlockTime:  interval,
+			AvgSource:     estimatorCheckpointCadence,
+			ETA:           eta.Format(time.RFC3339),
+			ETASeconds:    max(eta.Sub(now).Seconds(), 0),
+		}, nil
+	case "proposal":
+		end, err := s.rest.votingEnd(ctx, t.height)
+		if err != nil {
+			return etaReport{}, err
+		}
+		var left int64
+		if now.Before(end) {
+			left = 1
+		}
+		return etaReport{
+			Chain:        t.chain,
+			CurrentTime:  now.Format(time.RFC3339Nano),
+			TargetHeight: t.height,
+			BlocksLeft:   left,
+			Reached:      left == 0,
+			AvgSource:    estimatorVotingEnd,
+			ETA:          end.UTC().Format(time.RFC3339),
+			ETASeconds:   max(end.Sub(now).Seconds(), 0),
+		}, nil
+	}
+	return etaReport{}, fmt.Errorf("unsupported target kind %q", t.chain)
+}
+
+// ---- Scheduled re-estimation ----
+
+// predictionScheduler appends a prediction per target to the ledger on every
+// run and only notifies when the ETA moved by more than minMove since the
+// last announced one.
+type predictionScheduler struct {
+	ledger    string
+	minMove   time.Duration
+	announced map[string]time.Time // by target; seeded from the ledger
+}
+
+func newPredictionScheduler(path string, minMove time.Duration) *predictionScheduler {
+	p := &predictionScheduler{ledger: path, minMove: minMove, announced: make(map[string]time.Time)}
+	entries, err := ledger.Read(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("read ledger: %v", err)
+	}
+	for _, e := range entries {
+		p.announced[etaTarget{chain: e.Chain, height: e.TargetHeight}.String()] = e.PredictedTime
+	}
+	return p
+}
+
+// scheduleLoop re-estimates the targets at the interval of the current
+// config. It idles while there is none, until a reload sets one.
+func (s *server) scheduleLoop(ctx context.Context, ledgerPath string, minMove time.Duration) {
+	for {
+		var next <-chan time.Time
+		if v := s.view(); v.every > 0 {
+			if s.scheduler == nil {
+				s.scheduler = newPredictionScheduler(ledgerPath, minMove)
+			}
+			v.reestimate(ctx)
+			next = time.After(v.every)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-next:
+		case <-s.rescheduled:
+		}
+	}
+}
+
+// reestimate recomputes every target, records the predictions and fills in
+// the actual arrival time of targets that have been reached.
+func (s view) reestimate(ctx context.Context) {
+	p := s.scheduler
+	var fresh []ledger.Entry
+	reached := make(map[string]time.Time)
+	for _, t := range s.targets {
+		var rep etaReport
+		c, isChain := s.chains[t.chain]
+		if isChain {
+			out, err := s.eta(ctx, c, s.links[t.chain], map[string][]string{"height": {strconv.FormatInt(t.height, 10)}})
+			if err != nil {
+				log.Printf("re-estimate %s: %v", t, err)
+				continue
+			}
+			rep = out.(etaReport)
+		} else {
+			var err error
+			if rep, err = s.milestoneETA(ctx, t); err != nil {
+				log.Printf("re-estimate %s: %v", t, err)
+				continue
+			}
+		}
+		estimator := rep.AvgSource
+		if isChain {
+			estimator = estimatorLookbackMean
+		}
+		if rep.Reached {
+			at, _ := time.Parse(time.RFC3339, rep.ETA)
+			reached[t.String()] = at
+			continue
+		}
+		s.stream.publish("reestimate", t.String(), rep)
+		predicted, _ := time.Parse(time.RFC3339, rep.ETA)
+		headTime, _ := time.Parse(time.RFC3339, rep.CurrentTime)
+		fresh = append(fresh, ledger.Entry{
+			RecordedAt:    time.Now().UTC(),
+			Network:       s.network,
+			Chain:         t.chain,
+			Estimator:     estimator,
+			TargetHeight:  t.height,
+			PredictedTime: predicted,
+			Inputs:        &ledger.Inputs{HeadHeight: rep.CurrentHeight, HeadTime: headTime, AvgBlockTime: rep.AvgBlockTime},
+		})
+
+		prev, ok := p.announced[t.String()]
+		switch {
+		case !ok:
+			s.notify(ctx, fmt.Sprintf("%s estimated at %s (%s away)", t, predicted.Format(time.RFC1123), formatThreshold(time.Until(predicted).Round(time.Minute))))
+		case absDuration(predicted.Sub(prev)) > p.minMove:
+			s.notify(ctx, fmt.Sprintf("%s estimate moved %+.0fm to %s", t, predicted.Sub(prev).Minutes(), predicted.Format(time.RFC1123)))
+		default:
+			continue
+		}
+		p.announced[t.String()] = predicted
+	}
+
+	if err := p.update(s.network, fresh, reached); err != nil {
+		log.Printf("write ledger: %v", err)
+	}
+}
+
+// update appends a realized line for each pending target that has been
+// reached, then the fresh entries.
+func (p *predictionScheduler) update(network string, fresh []ledger.Entry, reached map[string]time.Time) error {
+	entries, err := ledger.Read(p.ledger)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var lines []any
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		k := etaTarget{chain: e.Chain, height: e.TargetHeight}.String()
+		at, ok := reached[k]
+		if !ok || e.ActualTime != nil || e.Network != network || seen[k] {
+			continue
+		}
+		seen[k] = true
+		lines = append(lines, ledger.Actual{RecordedAt: time.Now().UTC(), Network: network, Chain: e.Chain, TargetHeight: e.TargetHeight, ActualTime: at.UTC(), Realized: true})
+	}
+	for _, e := range fresh {
+		lines = append(lines, e)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return ledger.Append(p.ledger, lines...)
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// ---- Logging ----
+
+// setupLogging points the standard logger at stderr or a rotating file and,
+// for -log-format=json, routes it through slog so every line becomes one JSON
+// object with time, level and msg.
+func setupLogging(format, path string, maxSize int64, maxAge time.Duration, backups int) error {
+	var w io.Writer = os.Stderr
+	if path != "" {
+		f, err := newRotatingFile(path, maxSize, maxAge, backups)
+		if err != nil {
+			return err
+		}
+		w = f
+	}
+	switch format {
+	case "text":
+		log.SetOutput(w)
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(w, nil)))
+	default:
+		return fmt.Errorf("unknown log format %q (use text or json)", format)
+	}
+	return nil
+}
+
+// rotatingFile is an io.Writer that renames path to path.1 (shifting older
+// backups up to path.N) once it grows past maxSize or, with maxAge set, once
+// it was opened more than maxAge ago.
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	backups  int
+	f        *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func newRotatingFile(path string, maxSize int64, maxAge time.Duration, backups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, backups: backups}
+	return r, r.open()
+}
+
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size, r.openedAt = f, st.Size(), time.Now()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	full := r.maxSize > 0 && r.size+int64(len(p)) > r.maxSize
+	old := r.maxAge > 0 && time.Since(r.openedAt) >= r.maxAge
+	if (full || old) && r.size > 0 {
+		if err := r.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "rotate %s: %v\n", r.path, err)
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate moves the file aside and starts a new one. When a backup cannot be
+// moved it still reopens path, appending, so logging carries on in the file
+// that failed to rotate.
+func (r *rotatingFile) rotate() error {
+	r.f.Close()
+	if err := r.shift(); err != nil {
+		return errors.Join(err, r.open())
+	}
+	return r.open()
+}
+
+// shift renames path to path.1, path.1 to path.2 and so on, dropping the
+// oldest backup, or removes path when no backups are kept.
+func (r *rotatingFile) shift() error {
+	if r.backups == 0 {
+		return os.Remove(r.path)
+	}
+	backup := func(i int) string { return fmt.Sprintf("%s.%d", r.path, i) }
+	if err := os.Remove(backup(r.backups)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for i := r.backups - 1; i >= 1; i-- {
+		if err := os.Rename(backup(i), backup(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(r.path, backup(1))
+}
+
+// ---- Metric push exporters ----
+
+// metricsExporter pushes the current metric values to a backend that does
+// not scrape /metrics.
+type metricsExporter interface {
+	Name() string
+	Export(ctx context.Context, points []metricPoint) error
+}
+
+func (s *server) pushMetrics(ctx context.Context) {
+	if len(s.exporters) == 0 {
+		return
+	}
+	points := s.metrics.snapshot()
+	for _, e := range s.exporters {
+		if err := e.Export(ctx, points); err != nil {
+			log.Printf("export metrics to %s: %v", e.Name(), err)
+		}
+	}
+}
+
+// statsdExporter writes DogStatsD lines (name:value|g|#k:v,...) over UDP.
+// Counters are sent as the increment since the previous push.
+type statsdExporter struct {
+	conn net.Conn
+	prev map[string]float64
+}
+
+func newStatsdExporter(addr string) (*statsdExporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdExporter{conn: conn, prev: make(map[string]float64)}, nil
+}
+
+func (e *statsdExporter) Name() string { return "statsd" }
+
+func (e *statsdExporter) Export(ctx context.Context, points []metricPoint) error {
+	// Keep datagrams under a typical MTU
+	var buf bytes.Buffer
+	flush := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		_, err := e.conn.Write(buf.Bytes())
+		buf.Reset()
+		return err
+	}
+	for _, p := range points {
+		var tags []string
+		for i := 0; i+1 < len(p.Labels); i += 2 {
+			tags = append(tags, p.Labels[i]+":"+p.Labels[i+1])
+		}
+		value, typ := p.Value, "g"
+		if p.Kind == "counter" {
+			key := p.Name + labelString(p.Labels)
+			value, typ = p.Value-e.prev[key], "c"
+			e.prev[key] = p.Value
+			if value == 0 {
+				continue
+			}
+		}
+		line := fmt.Sprintf("%s:%s|%s", p.Name, strconv.FormatFloat(value, 'f', -1, 64), typ)
+		if len(tags) > 0 {
+			line += "|#" + strings.Join(tags, ",")
+		}
+		if buf.Len()+len(line)+1 > 1400 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	return flush()
+}
+
+// otlpExporter posts metrics to an OTLP/HTTP collector using the JSON
+// encoding of the OTLP metrics protocol.
+type otlpExporter struct {
+	client   *http.Client
+	endpoint string
+	start    time.Time // when the counters started, so collectors can detect a restart
+}
+
+func (e *otlpExporter) Name() string { return "otlp" }
+
+type otlpAttr struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsDouble          float64    `json:"asDouble"`
+}
+
+func (e *otlpExporter) Export(ctx context.Context, points []metricPoint) error {
+	attr := func(k, v string) otlpAttr {
+		a := otlpAttr{Key: k}
+		a.Value.StringValue = v
+		return a
+	}
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	start := strconv.FormatInt(e.start.UnixNano(), 10)
+
+	type dataPoints struct {
+		DataPoints             []otlpDataPoint `json:"dataPoints"`
+		AggregationTemporality int             `json:"aggregationTemporality,omitempty"`
+		IsMonotonic            bool            `json:"isMonotonic,omitempty"`
+	}
+	type otlpMetric struct {
+		Name        string      `json:"name"`
+		Description string      `json:"description,omitempty"`
+		Gauge       *dataPoints `json:"gauge,omitempty"`
+		Sum         *dataPoints `json:"sum,omitempty"`
+	}
+	var ms []*otlpMetric
+	byName := make(map[string]*otlpMetric)
+	for _, p := range points {
+		m, ok := byName[p.Name]
+		if !ok {
+			m = &otlpMetric{Name: p.Name, Description: p.Help}
+			if p.Kind == "counter" {
+				m.Sum = &dataPoints{AggregationTemporality: 2, IsMonotonic: true} // cumulative
+			} else {
+				m.Gauge = &dataPoints{}
+			}
+			byName[p.Name] = m
+			ms = append(ms, m)
+		}
+		dp := otlpDataPoint{TimeUnixNano: now, AsDouble: p.Value}
+		for i := 0; i+1 < len(p.Labels); i += 2 {
+			dp.Attributes = append(dp.Attributes, attr(p.Labels[i], p.Labels[i+1]))
+		}
+		if m.Sum != nil {
+			dp.StartTimeUnixNano = start
+			m.Sum.DataPoints = append(m.Sum.DataPoints, dp)
+		} else {
+			m.Gauge.DataPoints = append(m.Gauge.DataPoints, dp)
+		}
+	}
+
+	body := map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource": map[string]any{"attributes": []otlpAttr{attr("service.name", "chain-utils")}},
+			"scopeMetrics": []any{map[string]any{
+				"scope":   map[string]string{"name": "chain-utils"},
+				"metrics": ms,
+			}},
+		}},
+	}
+	return postJSON(ctx, e.client, e.endpoint, body)
+}
+
+// ---- Dashboard ----
+
+// dashboard keeps the latest refresh report plus a short history per chain and
+// target for the sparklines on the HTML page.
+type dashboard struct {
+	mu      sync.Mutex
+	size    int
+	last    refreshReport
+	heights map[string][]sample
+	avgs    map[string][]sample
+	etas    map[string][]sample // ETA as unix seconds
+}
+
+type sample struct {
+	T int64   `json:"t"`
+	V float64 `json:"v"`
+}
+
+type dashboardData struct {
+	refreshReport
+	Heights map[string][]sample `json:"heights"`
+	Avgs    map[string][]sample `json:"avgs"`
+	ETAs    map[string][]sample `json:"etas"`
+}
+
+func newDashboard(size int) *dashboard {
+	return &dashboard{size: size, heights: make(map[string][]sample), avgs: make(map[string][]sample), etas: make(map[string][]sample)}
+}
+
+func (d *dashboard) record(r refreshReport) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.last = r
+	now := r.ComputedAt.Unix()
+	push := func(m map[string][]sample, k string, v float64) {
+		m[k] = append(m[k], sample{T: now, V: v})
+		if len(m[k]) > d.size {
+			m[k] = m[k][len(m[k])-d.size:]
+		}
+	}
+	for name, rep := range r.Chains {
+		push(d.heights, name, float64(rep.CurrentHeight))
+		for _, e := range rep.Averages {
+			if e.Error == "" {
+				push(d.avgs, name, e.AvgBlockTime)
+				break
+			}
+		}
+	}
+	for _, t := range r.Targets {
+		eta, err := time.Parse(time.RFC3339, t.ETA)
+		if err == nil {
+			push(d.etas, etaTarget{chain: t.Chain, height: t.TargetHeight}.String(), float64(eta.Unix()))
+		}
+	}
+}
+
+func (d *dashboard) serveData(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	out := dashboardData{refreshReport: d.last, Heights: d.heights, Avgs: d.avgs, ETAs: d.etas}
+	b, err := json.Marshal(out)
+	d.mu.Unlock()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (d *dashboard) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, dashboardHTML)
+}
+
+// dashboardHTML polls /v1/dashboard and ticks the countdowns locally every
+// second between refreshes. It has no external dependencies so it also
+// works on locked-down networks.
+const dashboardHTML = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>chain-utils</title>
+<style>
+body { font-family: system-ui, sans-serif; background: #111; color: #eee; margin: 2em; }
+h1 { font-size: 1.2em; color: #aaa; }
+.grid { display: flex; flex-wrap: wrap; gap: 1em; }
+.card { background: #1c1c1c; border-radius: 8px; padding: 1em 1.5em; min-width: 18em; }
+.label { color: #999; font-size: .85em; }
+.big { font-size: 2.2em; font-variant-numeric: tabular-nums; }
+.mid { font-size: 1.2em; font-variant-numeric: tabular-nums; }
+svg { display: block; margin-top: .5em; }
+polyline { fill: none; stroke: #6cf; stroke-width: 1.5; }
+</style>
+</head>
+<body>
+<h1 id="title">chain-utils</h1>
+<div class="grid" id="targets"></div>
+<h1>Chains</h1>
+<div class="grid" id="chains"></div>
+<script>
+let data = null;
+
+function spark(points) {
+  if (!points || points.length < 2) return "";
+  const w = 240, h = 40;
+  const vs = points.map(p => p.v), ts = points.map(p => p.t);
+  const lo = Math.min(...vs), hi = Math.max(...vs), t0 = ts[0], t1 = ts[ts.length - 1];
+  const xy = points.map(p => [
+    (t1 === t0 ? 0 : (p.t - t0) / (t1 - t0) * w).toFixed(1),
+    (hi === lo ? h / 2 : h - (p.v - lo) / (hi - lo) * h).toFixed(1)
+  ].join(",")).join(" ");
+  return '<svg width="' + w + '" height="' + h + '"><polyline points="' + xy + '"/></svg>';
+}
+
+function countdown(eta) {
+  let s = Math.max(0, Math.floor((new Date(eta) - Date.now()) / 1000));
+  const d = Math.floor(s / 86400); s %= 86400;
+  const hh = String(Math.floor(s / 3600)).padStart(2, "0"); s %= 3600;
+  const mm = String(Math.floor(s / 60)).padStart(2, "0");
+  const ss = String(s % 60).padStart(2, "0");
+  return (d > 0 ? d + "d " : "") + hh + ":" + mm + ":" + ss;
+}
+
+function render() {
+  if (!data) return;
+  document.getElementById("title").textContent = "chain-utils · " + data.network + " · updated " + new Date(data.computed_at).toLocaleTimeString();
+  document.getElementById("targets").innerHTML = (data.targets || []).map(t => {
+    const key = t.chain + ":" + t.target_height;
+    return '<div class="card"><div class="label">' + key + '</div>' +
+      '<div class="big">' + (t.blocks_left > 0 ? countdown(t.eta) : "reached") + '</div>' +
+      '<div class="label">ETA ' + new Date(t.eta).toUTCString() + ' · ' + t.blocks_left.toLocaleString() + ' blocks left</div>' +
+      spark(data.etas[key]) + '<div class="label">ETA trend</div></div>';
+  }).join("");
+  document.getElementById("chains").innerHTML = Object.keys(data.chains || {}).sort().map(name => {
+    const c = data.chains[name];
+    const avgs = (c.averages || []).filter(a => !a.error).map(a =>
+      '<div>' + a.lookback.toLocaleString() + ' blocks: <span class="mid">' + a.avg_block_time_seconds.toFixed(4) + 's</span></div>').join("");
+    return '<div class="card"><div class="label">' + name + ' head</div>' +
+      '<div class="big">' + c.current_height.toLocaleString() + '</div>' +
+      '<div class="label">' + new Date(c.current_time).toUTCString() + '</div>' + spark(data.heights[name]) +
+      '<div class="label" style="margin-top:.8em">rolling averages</div>' + avgs +
+      spark(data.avgs[name]) + '<div class="label">shortest-window average trend</div></div>';
+  }).join("");
+}
+
+async function poll() {
+  try {
+    const r = await fetch("v1/dashboard");
+    if (r.ok) data = await r.json();
+  } catch (e) {}
+  render();
+}
+
+poll();
+setInterval(poll, 10000);
+setInterval(render, 1000);
+</script>
+</body>
+</html>
+`
+
+// ---- Event stream ----
+
+// streamBroker fans estimate updates out to /v1/stream subscribers as
+// Server-Sent Events. An event is only published when its payload differs
+// from the previous one with the same key, so a refresh that saw no new
+// block stays silent. New subscribers first receive the latest event of
+// every key.
+type streamBroker struct {
+	mu   sync.Mutex
+	subs map[chan []byte]struct{}
+	last map[string][]byte
+	done chan struct{} // closed on shutdown to end open streams
+}
+
+func newStreamBroker() *streamBroker {
+	return &streamBroker{subs: make(map[chan []byte]struct{}), last: make(map[string][]byte), done: make(chan struct{})}
+}
+
+func (b *streamBroker) close() { close(b.done) }
+
+func (b *streamBroker) publish(event, key string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("stream: encode %s: %v", event, err)
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msg := []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", event, data))
+	if bytes.Equal(b.last[event+"/"+key], msg) {
+		return
+	}
+	b.last[event+"/"+key] = msg
+	for ch := range b.subs {
+		select {
+		case ch <- msg:
+		default: // slow subscriber; drop rather than block refreshes
+		}
+	}
+}
+
+func (b *streamBroker) serve(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming unsupported"})
+		return
+	}
+	ch := make(chan []byte, 64)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	var backlog [][]byte
+	for _, k := range sortedKeys(b.last) {
+		backlog = append(backlog, b.last[k])
+	}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	io.WriteString(w, ": connected\n\n")
+	for _, msg := range backlog {
+		w.Write(msg)
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-b.done:
+			return
+		case msg := <-ch:
+			w.Write(msg)
+			flusher.Flush()
+		case <-keepalive.C:
+			io.WriteString(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// ---- Health ----
+
+// healthState backs /healthz, /readyz and /startupz. Liveness only checks
+// that the refresh loop is still turning; readiness also needs every chain's
+// upstream to have answered recently with a head that is not stale, and fails
+// while draining on shutdown. Startup passes once every chain has been
+// fetched at least once.
+type healthState struct {
+	mu       sync.Mutex
+	draining bool
+	started  time.Time
+	lastTick time.Time
+	stuck    time.Duration // refresh loop considered wedged after this
+	maxAge   time.Duration
+	chains   map[string]*chainHealth
+}
+
+type chainHealth struct {
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error,omitempty"`
+	Height      int64     `json:"height"`
+	HeadTime    time.Time `json:"head_time"`
+}
+
+type healthReport struct {
+	Status  string                  `json:"status"`
+	Uptime  string                  `json:"uptime"`
+	Reasons []string                `json:"reasons,omitempty"`
+	Chains  map[string]*chainHealth `json:"chains,omitempty"`
+}
+
+func newHealthState(stuck, maxAge time.Duration) *healthState {
+	now := time.Now()
+	return &healthState{started: now, lastTick: now, stuck: 2 * stuck, maxAge: maxAge, chains: make(map[string]*chainHealth)}
+}
+
+func (h *healthState) tick() {
+	h.mu.Lock()
+	h.lastTick = time.Now()
+	h.mu.Unlock()
+}
+
+func (h *healthState) record(name string, height int64, headTime time.Time, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.chains[name]
+	if !ok {
+		c = &chainHealth{}
+		h.chains[name] = c
+	}
+	if err != nil {
+		c.LastError = err.Error()
+		return
+	}
+	c.LastSuccess, c.LastError, c.Height, c.HeadTime = time.Now(), "", height, headTime
+}
+
+func (h *healthState) drain() {
+	h.mu.Lock()
+	h.draining = true
+	h.mu.Unlock()
+}
+
+func (h *healthState) serveStartup(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	rep := healthReport{Status: "ok", Uptime: time.Since(h.started).Round(time.Second).String()}
+	if len(h.chains) == 0 {
+		rep.Reasons = append(rep.Reasons, "no refresh has completed yet")
+	}
+	for _, name := range sortedKeys(h.chains) {
+		if h.chains[name].LastSuccess.IsZero() {
+			rep.Reasons = append(rep.Reasons, fmt.Sprintf("%s: no chain data fetched yet: %s", name, h.chains[name].LastError))
+		}
+	}
+	h.mu.Unlock()
+	h.write(w, rep)
+}
+
+func (h *healthState) serveLive(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	rep := healthReport{Status: "ok", Uptime: time.Since(h.started).Round(time.Second).String()}
+	if since := time.Since(h.lastTick); since > h.stuck {
+		rep.Reasons = append(rep.Reasons, fmt.Sprintf("refresh loop has not run for %s", since.Round(time.Second)))
+	}
+	h.mu.Unlock()
+	h.write(w, rep)
+}
+
+func (h *healthState) serveReady(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	rep := healthReport{Status: "ok", Uptime: time.Since(h.started).Round(time.Second).String(), Chains: make(map[string]*chainHealth)}
+	if h.draining {
+		rep.Reasons = append(rep.Reasons, "draining for shutdown")
+	}
+	if len(h.chains) == 0 {
+		rep.Reasons = append(rep.Reasons, "no refresh has completed yet")
+	}
+	for _, name := range sortedKeys(h.chains) {
+		c := *h.chains[name]
+		rep.Chains[name] = &c
+		switch {
+		case c.LastSuccess.IsZero():
+			rep.Reasons = append(rep.Reasons, fmt.Sprintf("%s: upstream unreachable: %s", name, c.LastError))
+		case time.Since(c.LastSuccess) > h.maxAge:
+			rep.Reasons = append(rep.Reasons, fmt.Sprintf("%s: last successful refresh %s ago: %s", name, time.Since(c.LastSuccess).Round(time.Second), c.LastError))
+		case time.Since(c.HeadTime) > h.maxAge:
+			rep.Reasons = append(rep.Reasons, fmt.Sprintf("%s: head %d is %s old", name, c.Height, time.Since(c.HeadTime).Round(time.Second)))
+		}
+	}
+	h.mu.Unlock()
+	h.write(w, rep)
+}
+
+func (h *healthState) write(w http.ResponseWriter, rep healthReport) {
+	status := http.StatusOK
+	if len(rep.Reasons) > 0 {
+		rep.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, rep)
+}
+
+// parseDurations parses a comma-separated list of non-negative durations. On
+// top of time.ParseDuration units it accepts "d" (days) and a bare "0".
+func parseDurations(s string) ([]time.Duration, error) {
+	var out []time.Duration
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var d time.Duration
+		if strings.HasSuffix(part, "d") {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(part, "d"), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration %q", part)
+			}
+			d = time.Duration(n * float64(24*time.Hour))
+		} else {
+			var err error
+			if d, err = time.ParseDuration(part); err != nil {
+				return nil, fmt.Errorf("invalid duration %q", part)
+			}
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("duration %q must not be negative", part)
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+func parseTargets(s string) ([]etaTarget, error) {
+	var out []etaTarget
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, h, ok := strings.Cut(part, ":")
+		if !ok || (name != "bor" && name != "heimdall" && name != "checkpoint" && name != "proposal") {
+			return nil, fmt.Errorf("invalid target %q (use bor:<height>, heimdall:<height>, checkpoint:<number> or proposal:<id>)", part)
+		}
+		height, err := strconv.ParseInt(h, 10, 64)
+		if err != nil || height <= 0 {
+			return nil, fmt.Errorf("invalid target value in %q", part)
+		}
+		out = append(out, etaTarget{chain: name, height: height})
+	}
+	return out, nil
+}
+
+func first(q map[string][]string, key string) string {
+	if v := q[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func parseLookbacks(s string) ([]int64, error) {
+	var out []int64
+	for _, part := range strings.Split(s, ",") {
+		lb, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || lb <= 0 {
+			return nil, fmt.Errorf("invalid lookback %q (want a positive block count, e.g. 10000)", part)
+		}
+		out = append(out, lb)
+	}
+	return out, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	if alt := suggestTime(s); alt != "" {
+		return time.Time{}, fmt.Errorf("unsupported time format %q; did you mean %s? (use RFC3339)", s, alt)
+	}
+	return time.Time{}, fmt.Errorf("unsupported time format %q (use RFC3339, e.g. 2025-10-07T14:00:00Z)", s)
+}
+
+// suggestTime returns the RFC3339 time a near miss most likely means, e.g.
+// a missing zone, a space for the T or Unix seconds, or "" when s looks
+// like no time. Times without a zone are taken as UTC, as everywhere else.
+func suggestTime(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339Nano)
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case n >= 1e9 && n < 1e10:
+			return time.Unix(n, 0).UTC().Format(time.RFC3339)
+		case n >= 1e12 && n < 1e13:
+			return time.UnixMilli(n).UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return ""
+}
+
+// ---- Metrics ----
+
+// estimatorLookbackMean labels values derived from the mean block time over
+// a trailing block lookback.
+const estimatorLookbackMean = "lookback-mean"
+
+// metricLabels returns the labels every per-chain series carries, so several
+// networks and endpoints can share one dashboard.
+func metricLabels(network string, c chain) []string {
+	return []string{"network", network, "chain", c.Name(), "endpoint", endpointLabel(c.Endpoint())}
+}
+
+// endpointLabel reduces an endpoint URL to its host so API keys embedded in
+// paths or query strings don't leak into metric labels.
+func endpointLabel(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Host
+}
+
+// metrics is a minimal Prometheus registry: gauges and counters keyed by
+// metric name and rendered label set, written in the text exposition format.
+// Names are registered without the prefix, which is added on output.
+type metrics struct {
+	prefix string
+	mu     sync.Mutex
+	help   map[string]string
+	kinds  map[string]string
+	series map[string]map[string]float64
+	labels map[string][]string // by name + label string, for push exporters
+}
+
+func newMetrics(prefix string) *metrics {
+	return &metrics{
+		prefix: prefix,
+		help:   make(map[string]string),
+		kinds:  make(map[string]string),
+		series: make(map[string]map[string]float64),
+		labels: make(map[string][]string),
+	}
+}
+
+func (m *metrics) setGauge(name, help string, v any, labels ...string) {
+	m.update(name, help, "gauge", labels, func(float64) float64 { return toFloat(v) })
+}
+
+func (m *metrics) incCounter(name, help string, labels ...string) {
+	m.update(name, help, "counter", labels, func(old float64) float64 { return old + 1 })
+}
+
+func (m *metrics) update(name, help, kind string, labels []string, fn func(float64) float64) {
+	key := labelString(labels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.series[name]; !ok {
+		m.series[name] = make(map[string]float64)
+		m.help[name] = help
+		m.kinds[name] = kind
+	}
+	m.series[name][key] = fn(m.series[name][key])
+	m.labels[name+key] = append([]string(nil), labels...)
+}
+
+// metricPoint is one series as handed to push exporters.
+type metricPoint struct {
+	Name   string // prefixed
+	Help   string
+	Kind   string // gauge or counter
+	Labels []string
+	Value  float64
+}
+
+func (m *metrics) snapshot() []metricPoint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []metricPoint
+	for _, name := range sortedKeys(m.series) {
+		full := name
+		if m.prefix != "" {
+			full = m.prefix + "_" + name
+		}
+		for _, key := range sortedKeys(m.series[name]) {
+			out = append(out, metricPoint{Name: full, Help: m.help[name], Kind: m.kinds[name], Labels: m.labels[name+key], Value: m.series[name][key]})
+		}
+	}
+	return out
+}
+
+func (m *metrics) writeTo(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.series))
+	for name := range m.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		full := name
+		if m.prefix != "" {
+			full = m.prefix + "_" + name
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", full, m.help[name], full, m.kinds[name])
+		keys := make([]string, 0, len(m.series[name]))
+		for k := range m.series[name] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s%s %s\n", full, k, strconv.FormatFloat(m.series[name][k], 'g', -1, 64))
+		}
+	}
+}
+
+// labelString renders key/value pairs as {k1="v1",k2="v2"}.
+func labelString(kv []string) string {
+	if len(kv) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", kv[i], labelEscaper.Replace(kv[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// labelEscaper escapes a label value the way the Prometheus text format
+// does: only backslash, double quote and newline; everything else, UTF-8
+// included, is written as is.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func toFloat(v any) float64 {
+	switch x := v.(type) {
+	case float64:
+		return x
+	case int64:
+		return float64(x)
+	case int:
+		return float64(x)
+	default:
+		panic(fmt.Sprintf("unsupported metric value %T", v))
+	}
+}
+
+// instrumentedChain counts upstream failures per chain and operation.
+type instrumentedChain struct {
+	chain
+	metrics *metrics
+	network string
+}
+
+func (c *instrumentedChain) Head(ctx context.Context) (int64, time.Time, error) {
+	n, t, err := c.chain.Head(ctx)
+	if err != nil {
+		c.metrics.incCounter("rpc_errors_total", "Failed upstream requests.", append(metricLabels(c.network, c), "op", "head")...)
+	}
+	return n, t, err
+}
+
+func (c *instrumentedChain) BlockTime(ctx context.Context, height int64) (time.Time, error) {
+	t, err := c.chain.BlockTime(ctx, height)
+	if err != nil {
+		c.metrics.incCounter("rpc_errors_total", "Failed upstream requests.", append(metricLabels(c.network, c), "op", "block")...)
+	}
+	return t, err
+}
+
+// ---- Alerts ----
+
+const defaultAlertTemplate = `{{.Target}}: {{.Label}}, ETA {{.ETA}} ({{.BlocksLeft}} blocks left, head {{.CurrentHeight}})`
+
+// notifier delivers a rendered alert message to one channel.
+type notifier interface {
+	Name() string
+	Notify(ctx context.Context, msg string) error
+}
+
+// alertData is what alert templates are rendered with.
+type alertData struct {
+	Target        string
+	Label         string
+	Threshold     time.Duration
+	ETA           string
+	BlocksLeft    int64
+	CurrentHeight int64
+}
+
+// countdownAlerter fires once per target and threshold when the ETA drops
+// below it. Threshold 0 means the target height was reached.
+type countdownAlerter struct {
+	thresholds []time.Duration // descending
+	tmpl       *template.Template
+
+	mu    sync.Mutex
+	fired map[string]map[time.Duration]bool
+}
+
+func newCountdownAlerter(thresholds []time.Duration, tmpl *template.Template) *countdownAlerter {
+	sorted := append([]time.Duration(nil), thresholds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	return &countdownAlerter{thresholds: sorted, tmpl: tmpl, fired: make(map[string]map[time.Duration]bool)}
+}
+
+// setThresholds replaces the thresholds; thresholds that already fired for a
+// target stay fired.
+func (a *countdownAlerter) setThresholds(thresholds []time.Duration) {
+	sorted := append([]time.Duration(nil), thresholds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	a.mu.Lock()
+	a.thresholds = sorted
+	a.mu.Unlock()
+}
+
+// check returns the alert message to send for t, or "" when no new
+// threshold was crossed.
+func (a *countdownAlerter) check(t etaTarget, head, left int64, headTime time.Time, eta time.Duration) string {
+	if left <= 0 {
+		eta = 0
+	}
+
+	// Only the tightest crossed threshold is announced; looser ones crossed
+	// at the same time (e.g. on startup close to the target) are skipped.
+	a.mu.Lock()
+	fired := a.fired[t.String()]
+	if fired == nil {
+		fired = make(map[time.Duration]bool)
+		a.fired[t.String()] = fired
+	}
+	// A threshold looser than one that already fired, as a reload can add,
+	// was passed long ago: it is marked without being announced.
+	tightest := time.Duration(-1)
+	for th := range fired {
+		if tightest < 0 || th < tightest {
+			tightest = th
+		}
+	}
+	var crossed []time.Duration
+	for _, th := range a.thresholds {
+		reached := eta <= th
+		if th == 0 {
+			reached = left <= 0
+		}
+		if reached && !fired[th] {
+			fired[th] = true
+			if tightest < 0 || th < tightest {
+				crossed = append(crossed, th)
+			}
+		}
+	}
+	a.mu.Unlock()
+	if len(crossed) == 0 {
+		return ""
+	}
+
+	th := crossed[len(crossed)-1]
+	label := "activation reached"
+	if th > 0 {
+		label = "T-" + formatThreshold(th)
+	}
+	var b strings.Builder
+	err := a.tmpl.Execute(&b, alertData{
+		Target:        t.String(),
+		Label:         label,
+		Threshold:     th,
+		ETA:           headTime.Add(eta).UTC().Format(time.RFC3339),
+		BlocksLeft:    left,
+		CurrentHeight: head,
+	})
+	if err != nil {
+		log.Printf("render alert for %s: %v", t, err)
+		return ""
+	}
+	return b.String()
+}
+
+// notify sends msg to every configured notification channel.
+func (s view) notify(ctx context.Context, msg string) {
+	if s.conditions.duplicate(msg) {
+		log.Printf("alert suppressed (duplicate): %s", msg)
+		return
+	}
+	log.Printf("alert: %s", msg)
+	for _, n := range s.notifiers {
+		if err := n.Notify(ctx, msg); err != nil {
+			log.Printf("notify %s: %v", n.Name(), err)
+		}
+	}
+}
+
+// conditionTracker remembers which alert conditions are active so that each
+// one is announced when it starts and when it clears, not on every refresh.
+// An alertPolicy adds hysteresis (a state must hold for several consecutive
+// checks before it is announced) and a cooldown after a resolve, during which
+// the same condition is not announced again.
+type conditionTracker struct {
+	mu     sync.Mutex
+	policy alertingConfig
+	states map[string]*conditionState
+	sent   map[string]time.Time // message -> last sent, for deduplication
+}
+
+type conditionState struct {
+	active     bool // as last announced
+	streak     int  // consecutive checks disagreeing with active
+	resolvedAt time.Time
+}
+
+// alertingConfig tunes alert noise. Rules override the defaults for condition
+// keys starting with the rule name (e.g. "baseline/bor", "lag/", "halt/").
+type alertingConfig struct {
+	alertPolicy
+	// DedupWindow drops a message identical to one sent within the window.
+	DedupWindow duration               `json:"dedup_window"`
+	Rules       map[string]alertPolicy `json:"rules,omitempty"`
+}
+
+type alertPolicy struct {
+	FireAfter    int      `json:"fire_after,omitempty"`    // consecutive checks; default 1
+	ResolveAfter int      `json:"resolve_after,omitempty"` // consecutive checks; default 1
+	Cooldown     duration `json:"cooldown"`
+}
+
+func newConditionTracker() *conditionTracker {
+	return &conditionTracker{states: make(map[string]*conditionState), sent: make(map[string]time.Time)}
+}
+
+func (c *conditionTracker) setPolicy(p alertingConfig) {
+	c.mu.Lock()
+	c.policy = p
+	c.mu.Unlock()
+}
+
+// policyFor returns the rule with the longest name prefixing key, falling
+// back to the defaults for unset fields.
+func (c *conditionTracker) policyFor(key string) alertPolicy {
+	p, best := c.policy.alertPolicy, -1
+	for name, r := range c.policy.Rules {
+		if strings.HasPrefix(key, name) && len(name) > best {
+			best = len(name)
+			if r.FireAfter > 0 {
+				p.FireAfter = r.FireAfter
+			}
+			if r.ResolveAfter > 0 {
+				p.ResolveAfter = r.ResolveAfter
+			}
+			if r.Cooldown.Duration > 0 {
+				p.Cooldown = r.Cooldown
+			}
+		}
+	}
+	return p
+}
+
+// set records one check of key and reports whether its announced state
+// changed.
+func (c *conditionTracker) set(key string, active bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.states[key]
+	if !ok {
+		st = &conditionState{}
+		c.states[key] = st
+	}
+	if active == st.active {
+		st.streak = 0
+		return false
+	}
+	st.streak++
+	p := c.policyFor(key)
+	need := max(p.ResolveAfter, 1)
+	if active {
+		need = max(p.FireAfter, 1)
+	}
+	if st.streak < need {
+		return false
+	}
+	if active && p.Cooldown.Duration > 0 && !st.resolvedAt.IsZero() && time.Since(st.resolvedAt) < p.Cooldown.Duration {
+		return false // flapping; stay quiet until the cooldown has passed
+	}
+	st.active, st.streak = active, 0
+	if !active {
+		st.resolvedAt = time.Now()
+	}
+	return true
+}
+
+// duplicate reports whether msg was already sent within the dedup window and
+// otherwise records it as sent now.
+func (c *conditionTracker) duplicate(msg string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := c.policy.DedupWindow.Duration
+	if w <= 0 {
+		return false
+	}
+	now := time.Now()
+	for m, at := range c.sent {
+		if now.Sub(at) >= w {
+			delete(c.sent, m)
+		}
+	}
+	if _, ok := c.sent[msg]; ok {
+		return true
+	}
+	c.sent[msg] = now
+	return false
+}
+
+// condition notifies on transitions of key: firing when it becomes active
+// and resolved when it clears.
+func (s view) condition(ctx context.Context, key string, active bool, firing, resolved string) {
+	if !s.conditions.set(key, active) {
+		return
+	}
+	if active {
+		s.notify(ctx, firing)
+	} else {
+		s.notify(ctx, resolved)
+	}
+}
+
+// formatThreshold renders 7d, 24h, 1h style labels; whole days are only
+// used from two days up, matching how countdowns are usually announced.
+func formatThreshold(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour && d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	default:
+		return d.String()
+	}
+}
+
+// serverConfig is the -config file. Flags given on the command line take
+// precedence over the corresponding file entries.
+type serverConfig struct {
+	Notifiers struct {
+		Slack    *webhookConfig  `json:"slack,omitempty"`
+		Discord  *webhookConfig  `json:"discord,omitempty"`
+		Telegram *telegramConfig `json:"telegram,omitempty"`
+	} `json:"notifiers"`
+	Incidents  incidentConfig   `json:"incidents"`
+	Email      *emailConfig     `json:"email,omitempty"`
+	Divergence divergenceConfig `json:"divergence"`
+	// Targets, Endpoints, AlertThresholds and Every override the matching
+	// flags.
+	Targets   []string `json:"targets,omitempty"`
+	Endpoints struct {
+		Bor          string `json:"bor,omitempty"`
+		Heimdall     string `json:"heimdall,omitempty"`
+		HeimdallREST string `json:"heimdall_rest,omitempty"`
+	} `json:"endpoints"`
+	// Explorers maps a chain name to the explorer its blocks link to: a
+	// preset (polygonscan, oklink, mintscan), a URL template with %d, or ""
+	// for no links. Defaults are polygonscan for bor and mintscan for heimdall.
+	Explorers       map[string]string     `json:"explorers,omitempty"`
+	AlertThresholds *string               `json:"alert_thresholds,omitempty"`
+	Every           *string               `json:"every,omitempty"`
+	Halt            haltConfig            `json:"halt"`
+	Alerting        alertingConfig        `json:"alerting"`
+	Finality        finalityConfig        `json:"finality"`
+	Checkpoints     checkpointStallConfig `json:"checkpoints"`
+	Lag             map[string]lagConfig  `json:"lag,omitempty"`
+	// Baselines maps a chain name to its expected block time.
+	Baselines map[string]baselineConfig `json:"baselines,omitempty"`
+}
+
+// baselineConfig is the block time a published fork schedule assumes, in
+// seconds, and how far the rolling average may drift from it.
+type baselineConfig struct {
+	Seconds   float64 `json:"seconds"`
+	Tolerance float64 `json:"tolerance"`
+	// Lookback selects the rolling window; zero uses the shortest one.
+	Lookback int64 `json:"lookback,omitempty"`
+}
+
+// divergenceConfig lists extra endpoints that are cross-checked against each
+// other on every refresh.
+type divergenceConfig struct {
+	BorEndpoints      []string `json:"bor_endpoints,omitempty"`
+	HeimdallEndpoints []string `json:"heimdall_endpoints,omitempty"`
+	MaxHeightGap      int64    `json:"max_height_gap"` // default 10
+}
+
+// emailConfig sends a digest of target ETAs every Interval, or earlier when
+// any ETA drifted by more than MinDrift since the last email.
+type emailConfig struct {
+	SMTPAddr string   `json:"smtp_addr"` // host:port
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Interval duration `json:"interval"`  // default 24h
+	MinDrift duration `json:"min_drift"` // zero disables early digests
+}
+
+// incidentConfig controls when incidents are opened on the paging sinks.
+type incidentConfig struct {
+	PagerDuty *pagerDutyConfig `json:"pagerduty,omitempty"`
+	Opsgenie  *opsgenieConfig  `json:"opsgenie,omitempty"`
+	// StallAfter opens an incident when the head height has not moved for
+	// this long. Zero disables stall detection.
+	StallAfter duration `json:"stall_after"`
+	// AvgBlockTime bounds the shortest-lookback average per chain.
+	AvgBlockTime map[string]bounds `json:"avg_block_time,omitempty"`
+	// CriticalWindow restricts incidents to when a target's ETA is within
+	// this window. Zero means always.
+	CriticalWindow duration `json:"critical_window"`
+}
+
+type bounds struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+type pagerDutyConfig struct {
+	RoutingKey string `json:"routing_key"`
+	APIBase    string `json:"api_base,omitempty"` // default https://events.pagerduty.com
+}
+
+type opsgenieConfig struct {
+	APIKey  string `json:"api_key"`
+	APIBase string `json:"api_base,omitempty"` // default https://api.opsgenie.com
+}
+
+// duration is a time.Duration that reads "90s"-style strings from JSON.
+type duration struct{ time.Duration }
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"90s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) { return json.Marshal(d.String()) }
+
+type webhookConfig struct {
+	Webhook string `json:"webhook"`
+}
+
+type telegramConfig struct {
+	BotToken string `json:"bot_token"`
+	ChatID   string `json:"chat_id"`
+	APIBase  string `json:"api_base,omitempty"` // default https://api.telegram.org
+}
+
+func loadConfig(path string) (serverConfig, error) {
+	var cfg serverConfig
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if t := cfg.Notifiers.Telegram; t != nil && (t.BotToken == "" || t.ChatID == "") {
+		return cfg, fmt.Errorf("%s: telegram needs bot_token and chat_id", path)
+	}
+	if e := cfg.Email; e != nil && (e.SMTPAddr == "" || e.From == "" || len(e.To) == 0) {
+		return cfg, fmt.Errorf("%s: email needs smtp_addr, from and to", path)
+	}
+	for name, l := range cfg.Lag {
+		if name != "bor" && name != "heimdall" {
+			return cfg, fmt.Errorf("%s: lag for unknown chain %q", path, name)
+		}
+		if l.Node == "" || l.Reference == "" {
+			return cfg, fmt.Errorf("%s: lag for %s needs node and reference", path, name)
+		}
+	}
+	for name := range cfg.Explorers {
+		if name != "bor" && name != "heimdall" {
+			return cfg, fmt.Errorf("%s: explorer for unknown chain %q", path, name)
+		}
+	}
+	for name, b := range cfg.Baselines {
+		if name != "bor" && name != "heimdall" {
+			return cfg, fmt.Errorf("%s: baseline for unknown chain %q", path, name)
+		}
+		if b.Seconds <= 0 || b.Tolerance < 0 {
+			return cfg, fmt.Errorf("%s: baseline for %s needs seconds > 0 and tolerance >= 0", path, name)
+		}
+	}
+	return cfg, nil
+}
+
+func buildNotifiers(cfg serverConfig, c *http.Client) []notifier {
+	var out []notifier
+	if n := cfg.Notifiers.Slack; n != nil && n.Webhook != "" {
+		out = append(out, &slackNotifier{client: c, webhook: n.Webhook})
+	}
+	if n := cfg.Notifiers.Discord; n != nil && n.Webhook != "" {
+		out = append(out, &discordNotifier{client: c, webhook: n.Webhook})
+	}
+	if n := cfg.Notifiers.Telegram; n != nil && n.BotToken != "" && n.ChatID != "" {
+		apiBase := n.APIBase
+		if apiBase == "" {
+			apiBase = "https://api.telegram.org"
+		}
+		out = append(out, &telegramNotifier{client: c, apiBase: apiBase, botToken: n.BotToken, chatID: n.ChatID})
+	}
+	return out
+}
+
+type slackNotifier struct {
+	client  *http.Client
+	webhook string
+}
+
+func (n *slackNotifier) Name() string { return "slack" }
+
+func (n *slackNotifier) Notify(ctx context.Context, msg string) error {
+	return postJSON(ctx, n.client, n.webhook, map[string]string{"text": msg})
+}
+
+type discordNotifier struct {
+	client  *http.Client
+	webhook string
+}
+
+func (n *discordNotifier) Name() string { return "discord" }
+
+func (n *discordNotifier) Notify(ctx context.Context, msg string) error {
+	// Discord rejects messages over 2000 characters; cut on a rune so the
+	// message stays valid UTF-8
+	if r := []rune(msg); len(r) > 2000 {
+		msg = string(r[:1997]) + "..."
+	}
+	return postJSON(ctx, n.client, n.webhook, map[string]string{"content": msg})
+}
+
+type telegramNotifier struct {
+	client   *http.Client
+	apiBase  string
+	botToken string
+	chatID   string
+}
+
+func (n *telegramNotifier) Name() string { return "telegram" }
+
+func (n *telegramNotifier) Notify(ctx context.Context, msg string) error {
+	u := fmt.Sprintf("%s/bot%s/sendMessage", n.apiBase, n.botToken)
+	return postJSON(ctx, n.client, u, map[string]string{"chat_id": n.chatID, "text": msg})
+}
+
+func postJSON(ctx context.Context, c *http.Client, url string, body any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d from %s", resp.StatusCode, req.URL.Host)
+	}
+	return nil
+}
+
+// ---- Chain halt ----
+
+// haltConfig alerts when a chain's head height has not advanced for After,
+// and escalates once the stall lasts EscalateAfter: the escalation is sent to
+// the chat channels again and opens an incident on the configured incident
+// sinks.
+type haltConfig struct {
+	After         duration `json:"after"`
+	EscalateAfter duration `json:"escalate_after"`
+}
+
+type headAdvance struct {
+	height int64
+	at     time.Time
+}
+
+// checkHalt is called from refresh, which serializes access to lastAdvance.
+func (s view) checkHalt(ctx context.Context, chain string, head int64) {
+	if s.halt.After.Duration <= 0 {
+		return
+	}
+	now := time.Now()
+	last, ok := s.lastAdvance[chain]
+	if !ok || head != last.height {
+		last = headAdvance{height: head, at: now}
+		s.lastAdvance[chain] = last
+	}
+	stalled := now.Sub(last.at)
+
+	s.condition(ctx, "halt/"+chain, stalled >= s.halt.After.Duration,
+		fmt.Sprintf("%s: no new block for %s (stuck at height %d)", chain, stalled.Round(time.Second), head),
+		fmt.Sprintf("%s producing blocks again (head %d)", chain, head))
+
+	if esc := s.halt.EscalateAfter.Duration; esc > 0 {
+		escalated := stalled >= esc
+		summary := fmt.Sprintf("%s halted for %s at height %d", chain, stalled.Round(time.Second), head)
+		s.condition(ctx, "halt/"+chain+"/escalated", escalated,
+			"ESCALATION: "+summary,
+			fmt.Sprintf("%s halt escalation cleared (head %d)", chain, head))
+		s.incidents.set(ctx, "chain-utils/"+chain+"/halt", escalated, summary)
+	}
+}
+
+// ---- Finality stall ----
+
+// finalityConfig alerts when the latest Heimdall milestone or the Bor
+// "finalized" block has not advanced for StallAfter.
+type finalityConfig struct {
+	StallAfter duration `json:"stall_after"`
+}
+
+func (h *heimdallREST) latestMilestone(ctx context.Context) (int64, error) {
+	type milestone struct {
+		EndBlock json.Number `json:"end_block"`
+	}
+	var resp struct {
+		Milestone milestone `json:"milestone"`
+		Result    milestone `json:"result"`
+	}
+	if err := getJSON(ctx, h.client, h.base+"/milestones/latest", &resp); err != nil {
+		return 0, err
+	}
+	end := resp.Milestone.EndBlock
+	if end == "" {
+		end = resp.Result.EndBlock
+	}
+	return end.Int64()
+}
+
+// checkFinality is called from refresh, which serializes access to
+// lastAdvance.
+func (s view) checkFinality(ctx context.Context) {
+	if s.finality.StallAfter.Duration <= 0 {
+		return
+	}
+	heights := make(map[string]int64)
+	if n, err := s.rest.latestMilestone(ctx); err != nil {
+		log.Printf("finality: latest milestone: %v", err)
+	} else {
+		heights["milestone"] = n
+		s.metrics.setGauge("milestone_end_block", "Bor block the latest Heimdall milestone ends at.", n,
+			"network", s.network, "chain", "heimdall", "endpoint", endpointLabel(s.rest.base))
+	}
+	if c, ok := s.chains["bor"].(*instrumentedChain); ok {
+		if b, ok := c.chain.(*borChain); ok {
+			if blk, err := b.blockByTag(ctx, "finalized"); err != nil {
+				log.Printf("finality: bor finalized block: %v", err)
+			} else if n, err := ethrpc.HexToUint64(blk.Number); err == nil {
+				heights["bor-finalized"] = int64(n)
+				s.metrics.setGauge("finalized_height", "Latest block with the finalized tag.", int64(n), metricLabels(s.network, c)...)
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, what := range sortedKeys(heights) {
+		h := heights[what]
+		last, ok := s.lastAdvance[what]
+		if !ok || h != last.height {
+			last = headAdvance{height: h, at: now}
+			s.lastAdvance[what] = last
+		}
+		stalled := now.Sub(last.at)
+		s.condition(ctx, "finality/"+what, stalled >= s.finality.StallAfter.Duration,
+			fmt.Sprintf("finality stall: %s has not advanced for %s (stuck at block %d)", what, stalled.Round(time.Second), h),
+			fmt.Sprintf("finality resumed: %s advanced to block %d", what, h))
+	}
+}
+
+// ---- Checkpoint stall ----
+
+// checkpointStallConfig alerts when the time since the last checkpoint
+// exceeds StallMultiple times the average interval of the previous Sample
+// checkpoints.
+type checkpointStallConfig struct {
+	StallMultiple float64 `json:"stall_multiple"`
+	Sample        int64   `json:"sample"` // default 10
+}
+
+func (s view) checkCheckpoints(ctx context.Context, borHead int64) {
+	cfg := s.checkpoints
+	if cfg.StallMultiple <= 0 {
+		return
+	}
+	sample := cfg.Sample
+	if sample <= 0 {
+		sample = checkpointSample
+	}
+	n, err := s.rest.checkpointCount(ctx)
+	if err != nil {
+		log.Printf("checkpoint stall: count: %v", err)
+		return
+	}
+	if n <= sample {
+		return
+	}
+	last, err := s.rest.checkpoint(ctx, n)
+	if err != nil {
+		log.Printf("checkpoint stall: %v", err)
+		return
+	}
+	prev, err := s.rest.checkpointTime(ctx, n-sample)
+	if err != nil {
+		log.Printf("checkpoint stall: %v", err)
+		return
+	}
+	interval := last.Time.Sub(prev) / time.Duration(sample)
+	since := time.Since(last.Time)
+	backlog := borHead - last.EndBlock
+	labels := []string{"network", s.network, "chain", "heimdall", "endpoint", endpointLabel(s.rest.base)}
+	s.metrics.setGauge("checkpoint_age_seconds", "Seconds since the latest checkpoint.", since.Seconds(), labels...)
+	s.metrics.setGauge("checkpoint_backlog_blocks", "Bor blocks not yet covered by a checkpoint.", backlog, labels...)
+
+	limit := time.Duration(cfg.StallMultiple * float64(interval))
+	s.condition(ctx, "checkpoint/stall", since > limit,
+		fmt.Sprintf("checkpoint stall: no checkpoint for %s (%.1fx the %s average of the last %d); checkpoint %d ended at Bor block %d, %d Bor blocks unclaimed",
+			since.Round(time.Second), since.Seconds()/interval.Seconds(), interval.Round(time.Second), sample, n, last.EndBlock, backlog),
+		fmt.Sprintf("checkpoints resumed: checkpoint %d, %d Bor blocks unclaimed", n, backlog))
+}
+
+// ---- Baseline deviation ----
+
+// checkBaseline alerts when the rolling average of chain leaves the
+// configured baseline ± tolerance, and again once it is back inside.
+func (s view) checkBaseline(ctx context.Context, chain string, averages []averageEntry) {
+	b, ok := s.baselines[chain]
+	if !ok {
+		return
+	}
+	var avg float64
+	var window int64
+	for _, e := range averages {
+		if e.Error != "" || (b.Lookback != 0 && e.Lookback != b.Lookback) {
+			continue
+		}
+		avg, window = e.AvgBlockTime, e.Lookback
+		break
+	}
+	if avg == 0 {
+		return
+	}
+	dev := avg - b.Seconds
+	s.condition(ctx, "baseline/"+chain, math.Abs(dev) > b.Tolerance,
+		fmt.Sprintf("%s average block time %.4fs over %d blocks is %+.4fs off the %.4fs baseline (tolerance ±%.4fs); the published fork schedule no longer holds",
+			chain, avg, window, dev, b.Seconds, b.Tolerance),
+		fmt.Sprintf("%s average block time %.4fs over %d blocks is back within ±%.4fs of the %.4fs baseline",
+			chain, avg, window, b.Tolerance, b.Seconds))
+}
+
+// ---- Node lag ----
+
+// lagConfig compares an operator's own node against a reference endpoint.
+type lagConfig struct {
+	Node      string `json:"node"`
+	Reference string `json:"reference"`
+	MaxLag    int64  `json:"max_lag"` // blocks; default 5
+}
+
+// checkLag exports how far each configured node is behind its reference and
+// alerts while the gap exceeds MaxLag.
+func (s view) checkLag(ctx context.Context) {
+	httpc := &http.Client{Timeout: 20 * time.Second}
+	for _, name := range sortedKeys(s.lag) {
+		cfg := s.lag[name]
+		maxLag := cfg.MaxLag
+		if maxLag <= 0 {
+			maxLag = 5
+		}
+		head := func(ep string) (int64, error) {
+			if name == "bor" {
+				return (&borChain{client: httpc, rpcURL: ep}).headNumber(ctx)
+			}
+			n, _, err := (&heimdallChain{client: httpc, base: ep}).Head(ctx)
+			return n, err
+		}
+		node, err := head(cfg.Node)
+		if err != nil {
+			log.Printf("lag: %s node %s: %v", name, endpointLabel(cfg.Node), err)
+			s.condition(ctx, "lag/"+name+"/unreachable", true,
+				fmt.Sprintf("%s node %s is unreachable: %v", name, endpointLabel(cfg.Node), err),
+				"")
+			continue
+		}
+		s.condition(ctx, "lag/"+name+"/unreachable", false, "",
+			fmt.Sprintf("%s node %s is reachable again", name, endpointLabel(cfg.Node)))
+		ref, err := head(cfg.Reference)
+		if err != nil {
+			log.Printf("lag: %s reference %s: %v", name, endpointLabel(cfg.Reference), err)
+			continue
+		}
+		gap := ref - node
+		s.metrics.setGauge("node_lag_blocks", "Blocks the operator's node is behind the reference endpoint.", gap,
+			"network", s.network, "chain", name, "endpoint", endpointLabel(cfg.Node), "reference", endpointLabel(cfg.Reference))
+		s.condition(ctx, "lag/"+name, gap > maxLag,
+			fmt.Sprintf("%s node %s is %d blocks behind %s (node %d, reference %d, max %d)",
+				name, endpointLabel(cfg.Node), gap, endpointLabel(cfg.Reference), node, ref, maxLag),
+			fmt.Sprintf("%s node %s caught up with %s (node %d, reference %d)",
+				name, endpointLabel(cfg.Node), endpointLabel(cfg.Reference), node, ref))
+	}
+}
+
+// ---- Provider divergence ----
+
+// checkDivergence alerts when the configured providers of a chain report
+// heads further apart than MaxHeightGap, or (Bor) when they disagree on the
+// hash of the lowest finalized block they all have.
+func (s view) checkDivergence(ctx context.Context) {
+	gap := s.divergence.MaxHeightGap
+	if gap <= 0 {
+		gap = 10
+	}
+	httpc := &http.Client{Timeout: 20 * time.Second}
+
+	if eps := s.divergence.BorEndpoints; len(eps) > 1 {
+		heights := make(map[string]int64)
+		finalized := make(map[string]int64)
+		for _, ep := range eps {
+			b := &borChain{client: httpc, rpcURL: ep}
+			n, err := b.headNumber(ctx)
+			if err != nil {
+				log.Printf("divergence: bor %s: %v", endpointLabel(ep), err)
+				continue
+			}
+			heights[ep] = n
+			if f, err := b.blockByTag(ctx, "finalized"); err == nil {
+				if fn, err := ethrpc.HexToUint64(f.Number); err == nil {
+					finalized[ep] = int64(fn)
+				}
+			}
+		}
+		s.reportHeightGap(ctx, "bor", heights, gap)
+
+		// Compare hashes at the lowest finalized height every provider has
+		if len(finalized) > 1 {
+			low := int64(math.MaxInt64)
+			for _, f := range finalized {
+				low = min(low, f)
+			}
+			hashes := make(map[string]string)
+			for ep := range finalized {
+				blk, err := (&borChain{client: httpc, rpcURL: ep}).blockByTag(ctx, fmt.Sprintf("0x%x", low))
+				if err == nil && blk != nil {
+					hashes[ep] = blk.Hash
+				}
+			}
+			var detail []string
+			distinct := make(map[string]bool)
+			for _, ep := range sortedKeys(hashes) {
+				distinct[hashes[ep]] = true
+				detail = append(detail, fmt.Sprintf("%s=%s", endpointLabel(ep), shortHash(hashes[ep])))
+			}
+			s.condition(ctx, "divergence/bor/finalized", len(distinct) > 1,
+				fmt.Sprintf("bor providers disagree on finalized block %d: %s", low, strings.Join(detail, ", ")),
+				fmt.Sprintf("bor providers agree on finalized blocks again (checked %d)", low))
+		}
+	}
+
+	if eps := s.divergence.HeimdallEndpoints; len(eps) > 1 {
+		heights := make(map[string]int64)
+		for _, ep := range eps {
+			n, _, err := (&heimdallChain{client: httpc, base: ep}).Head(ctx)
+			if err != nil {
+				log.Printf("divergence: heimdall %s: %v", endpointLabel(ep), err)
+				continue
+			}
+			heights[ep] = n
+		}
+		s.reportHeightGap(ctx, "heimdall", heights, gap)
+	}
+}
+
+func (s view) reportHeightGap(ctx context.Context, chain string, heights map[string]int64, gap int64) {
+	if len(heights) < 2 {
+		return
+	}
+	lo, hi := int64(math.MaxInt64), int64(math.MinInt64)
+	var detail []string
+	for _, ep := range sortedKeys(heights) {
+		lo, hi = min(lo, heights[ep]), max(hi, heights[ep])
+		detail = append(detail, fmt.Sprintf("%s=%d", endpointLabel(ep), heights[ep]))
+	}
+	s.condition(ctx, "divergence/"+chain+"/height", hi-lo > gap,
+		fmt.Sprintf("%s providers diverge by %d blocks (max %d): %s", chain, hi-lo, gap, strings.Join(detail, ", ")),
+		fmt.Sprintf("%s providers back within %d blocks: %s", chain, gap, strings.Join(detail, ", ")))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
+
+// ---- Email digest ----
+
+type emailDigest struct {
+	mu       sync.Mutex
+	cfg      emailConfig
+	lastSent time.Time
+	lastETA  map[string]time.Time
+}
+
+func newEmailDigest(cfg emailConfig) *emailDigest {
+	if cfg.Interval.Duration <= 0 {
+		cfg.Interval.Duration = 24 * time.Hour
+	}
+	return &emailDigest{cfg: cfg, lastETA: make(map[string]time.Time)}
+}
+
+// setConfig replaces the config on a reload; the last digest sent and its
+// ETAs are kept.
+func (d *emailDigest) setConfig(cfg emailConfig) {
+	cfg = newEmailDigest(cfg).cfg
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cfg = cfg
+}
+
+// update sends a digest when the interval has elapsed or an ETA moved by at
+// least MinDrift since the previous one.
+func (d *emailDigest) update(etas map[string]time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	due := time.Since(d.lastSent) >= d.cfg.Interval.Duration
+	if !due && d.cfg.MinDrift.Duration > 0 {
+		for k, eta := range etas {
+			if prev, ok := d.lastETA[k]; ok && eta.Sub(prev).Abs() >= d.cfg.MinDrift.Duration {
+				due = true
+				break
+			}
+		}
+	}
+	if !due {
+		return
+	}
+
+	keys := make([]string, 0, len(etas))
+	for k := range etas {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var body strings.Builder
+	body.WriteString("Predicted activation times:\r\n\r\n")
+	for _, k := range keys {
+		drift := "first digest"
+		if prev, ok := d.lastETA[k]; ok {
+			drift = fmt.Sprintf("%+.0f min since last digest", etas[k].Sub(prev).Minutes())
+		}
+		fmt.Fprintf(&body, "  %-24s %s  (%s)\r\n", k, etas[k].UTC().Format(time.RFC3339), drift)
+	}
+
+	if err := d.send("chain-utils: fork ETA digest", body.String()); err != nil {
+		log.Printf("email digest: %v", err)
+		return
+	}
+	d.lastSent = time.Now()
+	for k, eta := range etas {
+		d.lastETA[k] = eta
+	}
+}
+
+func (d *emailDigest) send(subject, body string) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", d.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(d.cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(body)
+
+	var auth smtp.Auth
+	if d.cfg.Username != "" {
+		host, _, _ := strings.Cut(d.cfg.SMTPAddr, ":")
+		auth = smtp.PlainAuth("", d.cfg.Username, d.cfg.Password, host)
+	}
+	return smtp.SendMail(d.cfg.SMTPAddr, auth, d.cfg.From, d.cfg.To, []byte(msg.String()))
+}
+
+// ---- Incidents ----
+
+// incidentSink opens and resolves incidents keyed by a stable dedup key.
+type incidentSink interface {
+	Name() string
+	Trigger(ctx context.Context, key, summary string) error
+	Resolve(ctx context.Context, key string) error
+}
+
+// incidentManager turns per-refresh observations into trigger/resolve
+// transitions, so each condition opens at most one incident.
+type incidentManager struct {
+	mu         sync.Mutex
+	cfg        incidentConfig
+	sinks      []incidentSink
+	open       map[string]bool
+	lastHeight map[string]int64
+	lastChange map[string]time.Time
+}
+
+func newIncidentManager(cfg incidentConfig, sinks []incidentSink) *incidentManager {
+	return &incidentManager{
+		cfg:        cfg,
+		sinks:      sinks,
+		open:       make(map[string]bool),
+		lastHeight: make(map[string]int64),
+		lastChange: make(map[string]time.Time),
+	}
+}
+
+// reconfigure replaces the config and sinks on a reload; open incidents
+// stay open.
+func (m *incidentManager) reconfigure(cfg incidentConfig, sinks []incidentSink) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg, m.sinks = cfg, sinks
+}
+
+func (m *incidentManager) criticalWindow() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cfg.CriticalWindow.Duration
+}
+
+func (m *incidentManager) inCriticalWindow(eta time.Duration) bool {
+	w := m.criticalWindow()
+	return w > 0 && eta <= w
+}
+
+func (m *incidentManager) observe(ctx context.Context, chain string, head int64, avg float64, critical bool) {
+	m.mu.Lock()
+	now := time.Now()
+	if head != m.lastHeight[chain] {
+		m.lastHeight[chain] = head
+		m.lastChange[chain] = now
+	}
+	stalledFor := now.Sub(m.lastChange[chain])
+	cfg := m.cfg
+	m.mu.Unlock()
+
+	stallKey := "chain-utils/" + chain + "/stall"
+	stalled := cfg.StallAfter.Duration > 0 && stalledFor >= cfg.StallAfter.Duration
+	m.set(ctx, stallKey, stalled && critical,
+		fmt.Sprintf("%s block production stalled at height %d for %s", chain, head, stalledFor.Round(time.Second)))
+
+	devKey := "chain-utils/" + chain + "/avg-block-time"
+	b, ok := cfg.AvgBlockTime[chain]
+	deviates := ok && avg > 0 && ((b.Min > 0 && avg < b.Min) || (b.Max > 0 && avg > b.Max))
+	m.set(ctx, devKey, deviates && critical,
+		fmt.Sprintf("%s average block time %.3fs outside [%.3f, %.3f]", chain, avg, b.Min, b.Max))
+}
+
+// set triggers key when active and not yet open, and resolves it once the
+// condition clears.
+func (m *incidentManager) set(ctx context.Context, key string, active bool, summary string) {
+	m.mu.Lock()
+	wasOpen := m.open[key]
+	m.open[key] = active
+	sinks := m.sinks
+	m.mu.Unlock()
+
+	switch {
+	case active && !wasOpen:
+		log.Printf("incident open: %s", summary)
+		for _, s := range sinks {
+			if err := s.Trigger(ctx, key, summary); err != nil {
+				log.Printf("incident %s: trigger %s: %v", s.Name(), key, err)
+			}
+		}
+	case !active && wasOpen:
+		log.Printf("incident resolved: %s", key)
+		for _, s := range sinks {
+			if err := s.Resolve(ctx, key); err != nil {
+				log.Printf("incident %s: resolve %s: %v", s.Name(), key, err)
+			}
+		}
+	}
+}
+
+func buildIncidentSinks(cfg incidentConfig, c *http.Client) []incidentSink {
+	var out []incidentSink
+	if p := cfg.PagerDuty; p != nil && p.RoutingKey != "" {
+		base := p.APIBase
+		if base == "" {
+			base = "https://events.pagerduty.com"
+		}
+		out = append(out, &pagerDutySink{client: c, apiBase: base, routingKey: p.RoutingKey})
+	}
+	if o := cfg.Opsgenie; o != nil && o.APIKey != "" {
+		base := o.APIBase
+		if base == "" {
+			base = "https://api.opsgenie.com"
+		}
+		out = append(out, &opsgenieSink{client: c, apiBase: base, apiKey: o.APIKey})
+	}
+	return out
+}
+
+// pagerDutySink uses the Events API v2.
+type pagerDutySink struct {
+	client     *http.Client
+	apiBase    string
+	routingKey string
+}
+
+func (p *pagerDutySink) Name() string { return "pagerduty" }
+
+func (p *pagerDutySink) Trigger(ctx context.Context, key, summary string) error {
+	return postJSON(ctx, p.client, p.apiBase+"/v2/enqueue", map[string]any{
+		"routing_key":  p.routingKey,
+		"event_action": "trigger",
+		"dedup_key":    key,
+		"payload": map[string]string{
+			"summary":  summary,
+			"source":   "chain-utils",
+			"severity": "critical",
+		},
+	})
+}
+
+func (p *pagerDutySink) Resolve(ctx context.Context, key string) error {
+	return postJSON(ctx, p.client, p.apiBase+"/v2/enqueue", map[string]any{
+		"routing_key":  p.routingKey,
+		"event_action": "resolve",
+		"dedup_key":    key,
+	})
+}
+
+// opsgenieSink uses the Alert API with the dedup key as alias.
+type opsgenieSink struct {
+	client  *http.Client
+	apiBase string
+	apiKey  string
+}
+
+func (o *opsgenieSink) Name() string { return "opsgenie" }
+
+func (o *opsgenieSink) Trigger(ctx context.Context, key, summary string) error {
+	return o.post(ctx, "/v2/alerts", map[string]string{
+		"message":  summary,
+		"alias":    key,
+		"source":   "chain-utils",
+		"priority": "P1",
+	})
+}
+
+func (o *opsgenieSink) Resolve(ctx context.Context, key string) error {
+	return o.post(ctx, "/v2/alerts/"+url.PathEscape(key)+"/close?identifierType=alias", map[string]string{
+		"source": "chain-utils",
+	})
+}
+
+func (o *opsgenieSink) post(ctx context.Context, path string, body any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.apiBase+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+o.apiKey)
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d from %s", resp.StatusCode, req.URL.Host)
+	}
+	return nil
+}
+
+// ---- Bor (JSON-RPC) ----
+
+type block struct {
+	Number    string `json:"number"`
+	Hash      string `json:"hash"`
+	Timestamp string `json:"timestamp"`
+}
+
+type borChain struct {
+	client *http.Client
+	rpcURL string
+}
+
+func (b *borChain) Name() string { return "bor" }
+
+func (b *borChain) Endpoint() string { return b.rpcURL }
+
+func (b *borChain) Head(ctx context.Context) (int64, time.Time, error) {
+	n, err := b.headNumber(ctx)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	t, err := b.BlockTime(ctx, n)
+	return n, t, err
+}
+
+func (b *borChain) headNumber(ctx context.Context) (int64, error) {
+	var hex string
+	if err := ethrpc.Call(ctx, b.client, b.rpcURL, "eth_blockNumber", []interface{}{}, &hex); err != nil {
+		return 0, err
+	}
+	n, err := ethrpc.HexToUint64(hex)
+	return int64(n), err
+}
+
+// blockByTag fetches a block by hex height or tag ("latest", "finalized").
+func (b *borChain) blockByTag(ctx context.Context, tag string) (*block, error) {
+	var respBlock *block
+	if err := ethrpc.Call(ctx, b.client, b.rpcURL, "eth_getBlockByNumber", []interface{}{tag, false}, &respBlock); err != nil {
+		return nil, err
+	}
+	if respBlock == nil {
+		return nil, fmt.Errorf("no block for %s", tag)
+	}
+	return respBlock, nil
+}
+
+func (b *borChain) BlockTime(ctx context.Context, height int64) (time.Time, error) {
+	params := []interface{}{fmt.Sprintf("0x%x", height), false}
+	var respBlock *block
+	if err := ethrpc.Call(ctx, b.client, b.rpcURL, "eth_getBlockByNumber", params, &respBlock); err != nil {
+		return time.Time{}, err
+	}
+	if respBlock == nil || respBlock.Timestamp == "" {
+		return time.Time{}, fmt.Errorf("empty block/timestamp for height %d", height)
+	}
+	ts, err := ethrpc.HexToUint64(respBlock.Timestamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(ts), 0).UTC(), nil
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+// ---- Heimdall (Tendermint API) ----
+
+type statusResp struct {
+	Result struct {
+		SyncInfo struct {
+			LatestBlockHeight string `json:"latest_block_height"`
+			LatestBlockTime   string `json:"latest_block_time"`
+			EarliestBlockH    string `json:"earliest_block_height"`
+		} `json:"sync_info"`
+	} `json:"result"`
+}
+
+type blockResp struct {
+	Result struct {
+		Block struct {
+			Header struct {
+				Height string `json:"height"`
+				Time   string `json:"time"`
+			} `json:"header"`
+		} `json:"block"`
+	} `json:"result"`
+}
+
+type heimdallChain struct {
+	client *http.Client
+	base   string
+}
+
+func (h *heimdallChain) Name() string { return "heimdall" }
+
+func (h *heimdallChain) Endpoint() string { return h.base }
+
+func (h *heimdallChain) Head(ctx context.Context) (int64, time.Time, error) {
+	var sr statusResp
+	if err := getJSON(ctx, h.client, h.base+"/status", &sr); err != nil {
+		return 0, time.Time{}, err
+	}
+	n, err := strconv.ParseInt(sr.Result.SyncInfo.LatestBlockHeight, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("parse latest height: %w", err)
+	}
+	t, err := time.Parse(time.RFC3339Nano, sr.Result.SyncInfo.LatestBlockTime)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("parse latest time: %w", err)
+	}
+	return n, t, nil
+}
+
+func (h *heimdallChain) BlockTime(ctx context.Context, height int64) (time.Time, error) {
+	var br blockResp
+	if err := getJSON(ctx, h.client, fmt.Sprintf("%s/block?height=%d", h.base, height), &br); err != nil {
+		return time.Time{}, err
+	}
+	ts := br.Result.Block.Header.Time
+	if ts == "" {
+		return time.Time{}, errors.New("empty block time")
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse block time: %w", err)
+	}
+	return t, nil
+}
+
+func getJSON(ctx context.Context, c *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d for %s", resp.StatusCode, url)
+	}
+	dec := json.NewDecoder(resp.Body)
+	return dec.Decode(out)
+}
@@ -0,0 +1,753 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/pkg/ledger"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so TestServe drives the server end to end through its flags.
+func TestMain(m *testing.M) {
+	if os.Getenv("CHAIN_UTILS_SERVER_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// Both test chains end at a head produced when the node starts, Bor blocks
+// coming every 2s and Heimdall blocks every second below it.
+const (
+	borHead      = 5_000_000
+	heimdallHead = 3_000_000
+)
+
+// borNode is a Bor JSON-RPC endpoint over the test chain.
+type borNode struct {
+	head time.Time
+}
+
+func (n *borNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params []any           `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var result any
+	switch req.Method {
+	case "eth_blockNumber":
+		result = fmt.Sprintf("0x%x", borHead)
+	case "eth_getBlockByNumber":
+		tag, _ := req.Params[0].(string)
+		h := int64(borHead)
+		if v, err := strconv.ParseInt(strings.TrimPrefix(tag, "0x"), 16, 64); err == nil {
+			h = v
+		}
+		ts := n.head.Add(-time.Duration(borHead-h) * 2 * time.Second)
+		result = map[string]string{"number": fmt.Sprintf("0x%x", h), "hash": fmt.Sprintf("0x%064x", h), "timestamp": fmt.Sprintf("0x%x", ts.Unix())}
+	default:
+		result = nil
+	}
+	json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result})
+}
+
+// heimdallNode is a Heimdall Tendermint RPC endpoint over the test chain.
+type heimdallNode struct {
+	head time.Time
+}
+
+func (n *heimdallNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	at := func(h int64) string {
+		return n.head.Add(-time.Duration(heimdallHead-h) * time.Second).UTC().Format(time.RFC3339Nano)
+	}
+	switch r.URL.Path {
+	case "/status":
+		fmt.Fprintf(w, `{"result":{"sync_info":{"latest_block_height":"%d","latest_block_time":"%s","earliest_block_height":"1"}}}`, heimdallHead, at(heimdallHead))
+	case "/block":
+		h, _ := strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+		fmt.Fprintf(w, `{"result":{"block":{"header":{"height":"%d","time":"%s"}}}}`, h, at(h))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// recorder is an HTTP endpoint that keeps the bodies POSTed to it.
+type recorder struct {
+	mu     sync.Mutex
+	bodies [][]byte
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	rec.mu.Lock()
+	rec.bodies = append(rec.bodies, b)
+	rec.mu.Unlock()
+}
+
+func (rec *recorder) all() [][]byte {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return slices.Clone(rec.bodies)
+}
+
+func newServer(t *testing.T, h http.Handler) string {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// eventually polls cond until it holds or the deadline passes.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// freeAddr returns a loopback address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func get(t *testing.T, url string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		return 0, nil
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, b
+}
+
+// slackTexts returns the texts of the messages the Slack mock received.
+func slackTexts(rec *recorder) []string {
+	var out []string
+	for _, b := range rec.all() {
+		var m struct{ Text string }
+		json.Unmarshal(b, &m)
+		out = append(out, m.Text)
+	}
+	return out
+}
+
+func writeConfig(t *testing.T, path string, cfg map[string]any) {
+	t.Helper()
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	start := time.Now()
+	borURL := newServer(t, &borNode{head: start})
+	heimdallURL := newServer(t, &heimdallNode{head: start})
+	slack := &recorder{}
+	slackURL := newServer(t, slack)
+	otlp := &recorder{}
+	otlpURL := newServer(t, otlp)
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	ledgerPath := filepath.Join(dir, "predictions.jsonl")
+	// 100 blocks at 2s are 200s away, inside the 1h threshold
+	writeConfig(t, configPath, map[string]any{
+		"targets":   []string{fmt.Sprintf("bor:%d", borHead+100)},
+		"notifiers": map[string]any{"slack": map[string]string{"webhook": slackURL}},
+	})
+
+	addr := freeAddr(t)
+	cmd := exec.Command(os.Args[0],
+		"-listen="+addr, "-rpc="+borURL, "-base="+heimdallURL, "-heimdall-rest="+heimdallURL,
+		"-config="+configPath, "-refresh=1s", "-every=1s", "-ledger="+ledgerPath,
+		"-otlp-endpoint="+otlpURL, "-drain-delay=0", "-shutdown-timeout=5s")
+	cmd.Env = append(os.Environ(), "CHAIN_UTILS_SERVER_RUN_MAIN=1", "HOME="+dir)
+	var stderr syncBuffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	t.Cleanup(func() {
+		if cmd.ProcessState == nil {
+			cmd.Process.Kill()
+			<-exited
+		}
+	})
+	base := "http://" + addr
+
+	eventually(t, "/readyz", func() bool {
+		code, _ := get(t, base+"/readyz")
+		return code == http.StatusOK
+	})
+
+	t.Run("average", func(t *testing.T) {
+		code, body := get(t, base+"/v1/bor/avg?lookbacks=1000")
+		if code != http.StatusOK {
+			t.Fatalf("status %d: %s", code, body)
+		}
+		var rep avgReport
+		if err := json.Unmarshal(body, &rep); err != nil {
+			t.Fatal(err)
+		}
+		if rep.CurrentHeight != borHead || len(rep.Averages) != 1 || rep.Averages[0].AvgBlockTime != 2 {
+			t.Errorf("got %+v, want head %d averaging 2s", rep, borHead)
+		}
+		if code, _ := get(t, base+"/v1/bor/avg?lookbacks=x"); code != http.StatusBadRequest {
+			t.Errorf("bad lookbacks: status %d, want 400", code)
+		}
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		_, body := get(t, base+"/metrics")
+		for _, want := range []string{
+			fmt.Sprintf(`chainutils_head_height{network="mainnet",chain="bor",endpoint="%s"} 5e+06`, strings.TrimPrefix(borURL, "http://")),
+			`chainutils_avg_block_time_seconds{network="mainnet",chain="heimdall"`,
+			fmt.Sprintf(`target="bor:%d"} 200`, borHead+100),
+		} {
+			if !bytes.Contains(body, []byte(want)) {
+				t.Errorf("/metrics lacks %s:\n%s", want, body)
+			}
+		}
+	})
+
+	t.Run("countdown alert", func(t *testing.T) {
+		want := fmt.Sprintf("bor:%d: T-1h,", borHead+100)
+		eventually(t, "the T-1h alert", func() bool {
+			return slices.ContainsFunc(slackTexts(slack), func(s string) bool { return strings.HasPrefix(s, want) })
+		})
+		// Looser thresholds crossed at the same time are not announced, and
+		// later refreshes don't repeat the alert
+		time.Sleep(1500 * time.Millisecond)
+		for _, s := range slackTexts(slack) {
+			if strings.Contains(s, "T-24h") || strings.Contains(s, "T-7d") {
+				t.Errorf("loose threshold announced: %q", s)
+			}
+		}
+		n := 0
+		for _, s := range slackTexts(slack) {
+			if strings.HasPrefix(s, want) {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Errorf("T-1h alert sent %d times, want once", n)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		resp, err := http.Get(base + "/v1/stream")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("Content-Type %q", ct)
+		}
+		// The backlog replays the latest event of every key
+		events := make(map[string]string)
+		sc := bufio.NewScanner(resp.Body)
+		var event string
+		for sc.Scan() && len(events) < 3 {
+			line := sc.Text()
+			if e, ok := strings.CutPrefix(line, "event: "); ok {
+				event = e
+			}
+			if d, ok := strings.CutPrefix(line, "data: "); ok {
+				var v struct {
+					Chain  string `json:"chain"`
+					Height int64  `json:"height"`
+				}
+				json.Unmarshal([]byte(d), &v)
+				events[event+"/"+v.Chain] = strconv.FormatInt(v.Height, 10)
+			}
+		}
+		want := map[string]string{"head/bor": strconv.Itoa(borHead), "head/heimdall": strconv.Itoa(heimdallHead), "eta/bor": "0"}
+		for k, v := range want {
+			if k == "eta/bor" {
+				if _, ok := events[k]; !ok {
+					t.Errorf("no %s event in %v", k, events)
+				}
+				continue
+			}
+			if events[k] != v {
+				t.Errorf("%s = %q, want %q (events %v)", k, events[k], v, events)
+			}
+		}
+	})
+
+	t.Run("ledger", func(t *testing.T) {
+		eventually(t, "a ledger entry", func() bool {
+			entries, err := ledger.Read(ledgerPath)
+			return err == nil && len(entries) > 0
+		})
+		entries, _ := ledger.Read(ledgerPath)
+		e := entries[0]
+		if e.Chain != "bor" || e.TargetHeight != borHead+100 || e.Inputs == nil || e.Inputs.AvgBlockTime != 2 {
+			t.Errorf("entry %+v", e)
+		}
+		if d := e.PredictedTime.Sub(start.Add(200 * time.Second)); d < -2*time.Second || d > 2*time.Second {
+			t.Errorf("predicted %s, want about %s", e.PredictedTime, start.Add(200*time.Second))
+		}
+	})
+
+	t.Run("otlp", func(t *testing.T) {
+		eventually(t, "an OTLP push", func() bool { return len(otlp.all()) > 0 })
+		if !bytes.Contains(otlp.all()[0], []byte(`"name":"chainutils_head_height"`)) {
+			t.Errorf("push lacks head_height: %s", otlp.all()[0])
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		// A broken file is reported and the running config kept
+		os.WriteFile(configPath, []byte("{"), 0o644)
+		cmd.Process.Signal(syscall.SIGHUP)
+		eventually(t, "the rejected reload", func() bool { return strings.Contains(stderr.String(), "keeping the previous one") })
+
+		// 10,000 blocks are 20,000s away: inside 24h but not 1h
+		writeConfig(t, configPath, map[string]any{
+			"targets":   []string{fmt.Sprintf("bor:%d", borHead+10_000)},
+			"notifiers": map[string]any{"slack": map[string]string{"webhook": slackURL}},
+		})
+		cmd.Process.Signal(syscall.SIGHUP)
+		want := fmt.Sprintf("bor:%d: T-24h,", borHead+10_000)
+		eventually(t, "the reloaded target's alert", func() bool {
+			return slices.ContainsFunc(slackTexts(slack), func(s string) bool { return strings.HasPrefix(s, want) })
+		})
+		_, body := get(t, base+"/metrics")
+		if !bytes.Contains(body, []byte(fmt.Sprintf(`target="bor:%d"} 20000`, borHead+10_000))) {
+			t.Errorf("/metrics lacks the reloaded target:\n%s", body)
+		}
+	})
+
+	cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Errorf("exit: %v\n%s", err, stderr.String())
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatalf("no exit after SIGTERM\n%s", stderr.String())
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to read while the process writes it.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func TestConditionHysteresis(t *testing.T) {
+	c := newConditionTracker()
+	c.setPolicy(alertingConfig{
+		alertPolicy: alertPolicy{FireAfter: 2, ResolveAfter: 3},
+		Rules:       map[string]alertPolicy{"halt/": {FireAfter: 1, Cooldown: duration{time.Hour}}},
+	})
+	checks := []struct {
+		active bool
+		want   bool
+	}{
+		{true, false}, // one bad check is not enough
+		{false, false},
+		{true, false},
+		{true, true}, // the second in a row fires
+		{true, false},
+		{false, false},
+		{false, false},
+		{false, true}, // the third good check resolves
+		{false, false},
+	}
+	for i, ch := range checks {
+		if got := c.set("baseline/bor", ch.active); got != ch.want {
+			t.Errorf("check %d (active %v): changed = %v, want %v", i, ch.active, got, ch.want)
+		}
+	}
+
+	// The halt rule fires at once, resolves after the default three checks
+	// and then stays quiet for an hour
+	if !c.set("halt/bor", true) {
+		t.Error("halt did not fire on the first check")
+	}
+	if c.set("halt/bor", false) || c.set("halt/bor", false) || !c.set("halt/bor", false) {
+		t.Error("halt did not resolve on the third check")
+	}
+	if c.set("halt/bor", true) {
+		t.Error("halt fired again within its cooldown")
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	c := newConditionTracker()
+	if c.duplicate("a") || c.duplicate("a") {
+		t.Error("messages deduplicated without a window")
+	}
+	c.setPolicy(alertingConfig{DedupWindow: duration{time.Hour}})
+	if c.duplicate("b") {
+		t.Error("first message reported as duplicate")
+	}
+	if !c.duplicate("b") {
+		t.Error("repeat within the window not reported")
+	}
+	if c.duplicate("c") {
+		t.Error("other message reported as duplicate")
+	}
+}
+
+func TestCountdownAlerter(t *testing.T) {
+	tmpl := template.Must(template.New("alert").Parse(defaultAlertTemplate))
+	a := newCountdownAlerter([]time.Duration{time.Hour, 7 * 24 * time.Hour, 0, 24 * time.Hour}, tmpl)
+	target := etaTarget{chain: "bor", height: 1000}
+	head := time.Date(2025, 10, 7, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		left int64
+		eta  time.Duration
+		want string
+	}{
+		{500, 10 * 24 * time.Hour, ""},
+		// Crossing 7d and 24h at once only announces the tighter one
+		{400, 20 * time.Hour, "bor:1000: T-24h, ETA 2025-10-08T08:00:00Z (400 blocks left, head 600)"},
+		{300, 10 * time.Hour, ""},
+		{10, 30 * time.Minute, "bor:1000: T-1h, ETA 2025-10-07T12:30:00Z (10 blocks left, head 990)"},
+		// A slower estimate moving back above 1h does not re-arm it
+		{9, 2 * time.Hour, ""},
+		{5, 10 * time.Second, ""},
+		{0, 0, "bor:1000: activation reached, ETA 2025-10-07T12:00:00Z (0 blocks left, head 1000)"},
+		{-5, 0, ""},
+	}
+	for i, s := range steps {
+		if got := a.check(target, target.height-s.left, s.left, head, s.eta); got != s.want {
+			t.Errorf("step %d: got %q, want %q", i, got, s.want)
+		}
+	}
+
+	// Thresholds already fired stay fired when a reload replaces them, and
+	// a looser one it adds is not announced for a target already past it
+	a.setThresholds([]time.Duration{48 * time.Hour, time.Hour})
+	if got := a.check(target, 1000, 0, head, 0); got != "" {
+		t.Errorf("after reload: got %q, want nothing", got)
+	}
+	other := etaTarget{chain: "heimdall", height: 50}
+	if got := a.check(other, 0, 50, head, 30*time.Hour); !strings.Contains(got, "T-2d") {
+		t.Errorf("new threshold: got %q, want T-2d", got)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "server.log")
+	r, err := newRotatingFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{"": "dddddddd\n", ".1": "cccccccc\n", ".2": "bbbbbbbb\n"} {
+		b, err := os.ReadFile(path + name)
+		if err != nil || string(b) != want {
+			t.Errorf("%s = %q, %v; want %q", path+name, b, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a third backup was kept: %v", err)
+	}
+}
+
+func TestRotatingFileFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.log")
+	r, err := newRotatingFile(path, 10, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A non-empty directory where the backup goes makes every rotation fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "busy"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("write after a failed rotation: %v", err)
+		}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || string(b) != "aaaaaaaa\nbbbbbbbb\ncccccccc\n" {
+		t.Errorf("log = %q, %v; want every line kept in place", b, err)
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	r, err := newRotatingFile(path, 0, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("old\n"))
+	r.openedAt = r.openedAt.Add(-2 * time.Hour)
+	r.Write([]byte("new\n"))
+	if b, _ := os.ReadFile(path + ".1"); string(b) != "old\n" {
+		t.Errorf("backup = %q, want the line written before the rotation", b)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "new\n" {
+		t.Errorf("log = %q, want the line written after the rotation", b)
+	}
+}
+
+func TestStatsdExporter(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	e, err := newStatsdExporter(pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newMetrics("chainutils")
+	m.setGauge("head_height", "", int64(100), "chain", "bor")
+	m.incCounter("rpc_errors_total", "", "chain", "bor")
+	m.incCounter("rpc_errors_total", "", "chain", "bor")
+
+	read := func() string {
+		pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 2048)
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+	if err := e.Export(context.Background(), m.snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	want := "chainutils_head_height:100|g|#chain:bor\nchainutils_rpc_errors_total:2|c|#chain:bor"
+	if got := read(); got != want {
+		t.Errorf("first push:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Counters are sent as the increment since the last push, and skipped
+	// when they did not move
+	m.setGauge("head_height", "", int64(101), "chain", "bor")
+	e.Export(context.Background(), m.snapshot())
+	if got, want := read(), "chainutils_head_height:101|g|#chain:bor"; got != want {
+		t.Errorf("second push: %q, want %q", got, want)
+	}
+	m.incCounter("rpc_errors_total", "", "chain", "bor")
+	e.Export(context.Background(), m.snapshot())
+	if got := read(); !strings.HasSuffix(got, "chainutils_rpc_errors_total:1|c|#chain:bor") {
+		t.Errorf("third push: %q, want an increment of 1", got)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	rec := &recorder{}
+	e := &otlpExporter{client: http.DefaultClient, endpoint: newServer(t, rec) + "/v1/metrics", start: time.Now().Add(-time.Hour)}
+	m := newMetrics("chainutils")
+	m.setGauge("head_height", "Latest observed block height.", int64(100), "chain", "bor")
+	m.incCounter("rpc_errors_total", "Failed upstream requests.", "chain", "bor")
+	for range 2 {
+		if err := e.Export(context.Background(), m.snapshot()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type point struct {
+		Attributes []struct {
+			Key   string `json:"key"`
+			Value struct {
+				StringValue string `json:"stringValue"`
+			} `json:"value"`
+		} `json:"attributes"`
+		StartTimeUnixNano string  `json:"startTimeUnixNano"`
+		TimeUnixNano      string  `json:"timeUnixNano"`
+		AsDouble          float64 `json:"asDouble"`
+	}
+	type points struct {
+		DataPoints             []point `json:"dataPoints"`
+		AggregationTemporality int     `json:"aggregationTemporality"`
+		IsMonotonic            bool    `json:"isMonotonic"`
+	}
+	var starts []string
+	for _, body := range rec.all() {
+		var req struct {
+			ResourceMetrics []struct {
+				ScopeMetrics []struct {
+					Metrics []struct {
+						Name  string  `json:"name"`
+						Gauge *points `json:"gauge"`
+						Sum   *points `json:"sum"`
+					} `json:"metrics"`
+				} `json:"scopeMetrics"`
+			} `json:"resourceMetrics"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatal(err)
+		}
+		ms := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+		if len(ms) != 2 || ms[0].Name != "chainutils_head_height" || ms[1].Name != "chainutils_rpc_errors_total" {
+			t.Fatalf("metrics %s", body)
+		}
+		gauge, sum := ms[0].Gauge, ms[1].Sum
+		if gauge == nil || gauge.DataPoints[0].AsDouble != 100 || gauge.DataPoints[0].StartTimeUnixNano != "" {
+			t.Errorf("gauge %+v", gauge)
+		}
+		if a := gauge.DataPoints[0].Attributes; len(a) != 1 || a[0].Key != "chain" || a[0].Value.StringValue != "bor" {
+			t.Errorf("gauge attributes %+v", a)
+		}
+		if sum == nil || !sum.IsMonotonic || sum.AggregationTemporality != 2 || sum.DataPoints[0].AsDouble != 1 {
+			t.Errorf("sum %+v", sum)
+		}
+		starts = append(starts, sum.DataPoints[0].StartTimeUnixNano)
+	}
+	// Cumulative sums keep the start of the process, not of the push
+	want := strconv.FormatInt(e.start.UnixNano(), 10)
+	if len(starts) != 2 || starts[0] != want || starts[1] != want {
+		t.Errorf("start times %v, want %s on every push", starts, want)
+	}
+}
+
+func TestStreamBroker(t *testing.T) {
+	b := newStreamBroker()
+	b.publish("head", "bor", map[string]int{"height": 1})
+	srv := httptest.NewServer(http.HandlerFunc(b.serve))
+	defer srv.Close()
+	defer b.close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := make(chan string, 64)
+	go func() {
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			if l := sc.Text(); strings.HasPrefix(l, "data: ") {
+				lines <- l
+			}
+		}
+		close(lines)
+	}()
+	next := func() string {
+		select {
+		case l := <-lines:
+			return l
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+			return ""
+		}
+	}
+	if got := next(); got != `data: {"height":1}` {
+		t.Errorf("backlog %q", got)
+	}
+	// An unchanged payload is not sent again
+	b.publish("head", "bor", map[string]int{"height": 1})
+	b.publish("head", "bor", map[string]int{"height": 2})
+	if got := next(); got != `data: {"height":2}` {
+		t.Errorf("update %q, want height 2 without a repeat of 1", got)
+	}
+}
+
+func TestSchedulerUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "predictions.jsonl")
+	at := time.Date(2025, 10, 7, 14, 0, 0, 0, time.UTC)
+	if err := ledger.Append(path,
+		ledger.Entry{Network: "mainnet", Chain: "bor", TargetHeight: 100, PredictedTime: at},
+		ledger.Entry{Network: "mainnet", Chain: "bor", TargetHeight: 100, PredictedTime: at.Add(time.Minute)},
+		ledger.Entry{Network: "amoy", Chain: "bor", TargetHeight: 100, PredictedTime: at},
+		ledger.Entry{Network: "mainnet", Chain: "bor", TargetHeight: 200, PredictedTime: at},
+	); err != nil {
+		t.Fatal(err)
+	}
+	p := newPredictionScheduler(path, 15*time.Minute)
+	if got := p.announced["bor:200"]; !got.Equal(at) {
+		t.Errorf("announced bor:200 = %s, want the ledger's %s", got, at)
+	}
+
+	fresh := []ledger.Entry{{Network: "mainnet", Chain: "bor", TargetHeight: 200, PredictedTime: at.Add(time.Hour)}}
+	arrived := at.Add(2 * time.Minute)
+	if err := p.update("mainnet", fresh, map[string]time.Time{"bor:100": arrived}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ledger.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("%d entries, want 5: %+v", len(entries), entries)
+	}
+	// The arrival is stamped on both of mainnet's bor:100 predictions, not
+	// on amoy's or on other targets
+	for i, e := range entries {
+		stamped := e.ActualTime != nil && e.ActualTime.Equal(arrived)
+		if want := e.Network == "mainnet" && e.TargetHeight == 100; stamped != want {
+			t.Errorf("entry %d (%s %s:%d): actual %v, want stamped %v", i, e.Network, e.Chain, e.TargetHeight, e.ActualTime, want)
+		}
+	}
+	if e := entries[4]; e.TargetHeight != 200 || !e.PredictedTime.Equal(at.Add(time.Hour)) {
+		t.Errorf("fresh entry %+v", e)
+	}
+
+	// A second update finds the target realized and writes no new line
+	before, _ := os.ReadFile(path)
+	if err := p.update("mainnet", nil, map[string]time.Time{"bor:100": arrived}); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Errorf("second update rewrote the ledger:\n%s", after)
+	}
+}
@@ -0,0 +1,386 @@
+// Package snapshotat is snapshot_at.go: it reconciles the Bor and Heimdall
+// blocks current at one instant.
+package snapshotat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+	"github.com/pratikspatil024/chain-utils/pkg/human"
+)
+
+const (
+	httpTimeout = 20 * time.Second
+)
+
+// endpoints are the three layers of one Polygon PoS network: Bor JSON-RPC,
+// Heimdall's Tendermint API and the Ethereum JSON-RPC it checkpoints to.
+type endpoints struct {
+	Bor      string
+	Heimdall string
+	L1       string
+}
+
+var presets = map[string]endpoints{
+	"mainnet": {Bor: "https://polygon-rpc.com", Heimdall: "https://tendermint-api.polygon.technology", L1: "https://ethereum-rpc.publicnode.com"},
+	"amoy":    {Bor: "https://rpc-amoy.polygon.technology", Heimdall: "https://tendermint-api-amoy.polygon.technology", L1: "https://ethereum-sepolia-rpc.publicnode.com"},
+}
+
+type block struct {
+	Number    string `json:"number"`
+	Timestamp string `json:"timestamp"`
+}
+
+type statusResp struct {
+	Result struct {
+		SyncInfo struct {
+			LatestBlockHeight string `json:"latest_block_height"`
+			EarliestBlockH    string `json:"earliest_block_height"`
+		} `json:"sync_info"`
+	} `json:"result"`
+}
+
+type blockResp struct {
+	Result struct {
+		Block struct {
+			Header struct {
+				Time string `json:"time"`
+			} `json:"header"`
+		} `json:"block"`
+	} `json:"result"`
+}
+
+// chain is what the search needs from one layer: the range of heights the
+// endpoint serves and the time of any block in it.
+type chain struct {
+	Name   string
+	Bounds func(ctx context.Context) (lo, hi int64, err error)
+	TimeAt func(ctx context.Context, h int64) (time.Time, error)
+}
+
+// match is the block of one layer closest to the target, with the pair of
+// blocks that bracket the target.
+type match struct {
+	Layer  string    `json:"layer"`
+	Height int64     `json:"height"`
+	Time   time.Time `json:"time"`
+	Offset float64   `json:"offset_seconds"` // block time minus target
+	Before int64     `json:"at_or_before"`
+	After  int64     `json:"after"` // -1 when Before is the head
+	Err    error     `json:"-"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	timeStr := flag.String("time", "", "Instant to reconcile, in RFC3339 or RFC3339Nano (UTC); required")
+	network := flag.String("network", "mainnet", "Endpoint presets: mainnet or amoy")
+	borRPC := flag.String("rpc", "", "Bor JSON-RPC endpoint (default: the -network preset; \"-\" skips Bor)")
+	heimdallBase := flag.String("heimdall-base", "", "Heimdall Tendermint API (default: the -network preset; \"-\" skips Heimdall)")
+	l1RPC := flag.String("l1-rpc", "", "Ethereum JSON-RPC endpoint (default: the -network preset; \"-\" skips Ethereum)")
+	asJSON := flag.Bool("json", false, "Print the snapshot as JSON")
+	flag.Parse()
+
+	if *timeStr == "" {
+		failf("-time is required")
+	}
+	target, err := parseTarget(*timeStr)
+	if err != nil {
+		failf("parse -time: %v", err)
+	}
+	if target.After(time.Now()) {
+		failf("-time %s is in the future", target.Format(time.RFC3339))
+	}
+	p, ok := presets[*network]
+	if !ok {
+		failf("unknown network %q (use mainnet or amoy)", *network)
+	}
+	pick := func(flagVal, preset string) string {
+		switch flagVal {
+		case "":
+			return preset
+		case "-":
+			return ""
+		}
+		return flagVal
+	}
+
+	ctx := context.Background()
+	client := &http.Client{Timeout: httpTimeout}
+	var chains []chain
+	if u := pick(*borRPC, p.Bor); u != "" {
+		chains = append(chains, evmChain(client, "bor", u))
+	}
+	if u := pick(*heimdallBase, p.Heimdall); u != "" {
+		chains = append(chains, heimdallChain(client, strings.TrimRight(u, "/")))
+	}
+	if u := pick(*l1RPC, p.L1); u != "" {
+		chains = append(chains, evmChain(client, "ethereum", u))
+	}
+	if len(chains) == 0 {
+		failf("every layer is skipped")
+	}
+
+	matches := make([]match, len(chains))
+	for i, c := range chains {
+		matches[i] = closest(ctx, c, target)
+		if matches[i].Err != nil {
+			matches[i].Error = matches[i].Err.Error()
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(map[string]any{"time": target, "network": *network, "blocks": matches}); err != nil {
+			failf("encode: %v", err)
+		}
+	} else {
+		fmt.Printf("Target time   : %s (UTC)\n\n", target.Format(time.RFC3339Nano))
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "Layer\tBlock\tBlock time\tOffset\tBracket")
+		for _, m := range matches {
+			if m.Err != nil {
+				fmt.Fprintf(tw, "%s\terror\t-\t-\t-\n", m.Layer)
+				continue
+			}
+			bracket := human.Commas(m.Before) + " – head"
+			if m.After >= 0 {
+				bracket = human.Commas(m.Before) + " – " + human.Commas(m.After)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%+.3fs\t%s\n", m.Layer, human.Commas(m.Height), m.Time.Format(time.RFC3339Nano), m.Offset, bracket)
+		}
+		tw.Flush()
+	}
+
+	failed := false
+	for _, m := range matches {
+		if m.Err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", m.Layer, m.Err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// closest binary searches c for the last block at or before target, then
+// picks whichever of it and the next block is nearer. Block times only
+// ever grow with height, which is all the search relies on.
+func closest(ctx context.Context, c chain, target time.Time) match {
+	m := match{Layer: c.Name, After: -1}
+	lo, hi, err := c.Bounds(ctx)
+	if err != nil {
+		m.Err = err
+		return m
+	}
+	loTime, err := c.TimeAt(ctx, lo)
+	if err != nil {
+		m.Err = fmt.Errorf("block %d: %w", lo, err)
+		return m
+	}
+	if target.Before(loTime) {
+		m.Err = fmt.Errorf("target is before the earliest available block %d (%s)", lo, loTime.Format(time.RFC3339))
+		return m
+	}
+	hiTime, err := c.TimeAt(ctx, hi)
+	if err != nil {
+		m.Err = fmt.Errorf("block %d: %w", hi, err)
+		return m
+	}
+	if !target.Before(hiTime) {
+		m.Height, m.Time, m.Before = hi, hiTime, hi
+		m.Offset = hiTime.Sub(target).Seconds()
+		return m
+	}
+
+	// Invariant: time(lo) <= target < time(hi)
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		t, err := c.TimeAt(ctx, mid)
+		if err != nil {
+			m.Err = fmt.Errorf("block %d: %w", mid, err)
+			return m
+		}
+		if t.After(target) {
+			hi, hiTime = mid, t
+		} else {
+			lo, loTime = mid, t
+		}
+	}
+	m.Before, m.After = lo, hi
+	if target.Sub(loTime) <= hiTime.Sub(target) {
+		m.Height, m.Time = lo, loTime
+	} else {
+		m.Height, m.Time = hi, hiTime
+	}
+	m.Offset = m.Time.Sub(target).Seconds()
+	return m
+}
+
+// evmChain searches an Ethereum-style JSON-RPC endpoint (Bor or L1).
+func evmChain(client *http.Client, name, rpcURL string) chain {
+	return chain{
+		Name: name,
+		Bounds: func(ctx context.Context) (int64, int64, error) {
+			var hex string
+			if err := ethrpc.Call(ctx, client, rpcURL, "eth_blockNumber", []interface{}{}, &hex); err != nil {
+				return 0, 0, fmt.Errorf("get head: %w", err)
+			}
+			head, err := ethrpc.HexToUint64(hex)
+			if err != nil {
+				return 0, 0, fmt.Errorf("parse head: %w", err)
+			}
+			return 0, int64(head), nil
+		},
+		TimeAt: func(ctx context.Context, h int64) (time.Time, error) {
+			var b *block
+			if err := ethrpc.Call(ctx, client, rpcURL, "eth_getBlockByNumber", []interface{}{fmt.Sprintf("0x%x", h), false}, &b); err != nil {
+				return time.Time{}, err
+			}
+			if b == nil || b.Timestamp == "" {
+				return time.Time{}, fmt.Errorf("empty block/timestamp for height %d", h)
+			}
+			ts, err := ethrpc.HexToUint64(b.Timestamp)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(int64(ts), 0).UTC(), nil
+		},
+	}
+}
+
+// heimdallChain searches the Tendermint API, starting at the earliest
+// height the node still has since Heimdall nodes are commonly pruned.
+func heimdallChain(client *http.Client, base string) chain {
+	return chain{
+		Name: "heimdall",
+		Bounds: func(ctx context.Context) (int64, int64, error) {
+			var sr statusResp
+			if err := getJSON(ctx, client, base+"/status", &sr); err != nil {
+				return 0, 0, fmt.Errorf("status: %w", err)
+			}
+			hi, err := strconv.ParseInt(sr.Result.SyncInfo.LatestBlockHeight, 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("parse latest height: %w", err)
+			}
+			lo := int64(1)
+			if e, err := strconv.ParseInt(sr.Result.SyncInfo.EarliestBlockH, 10, 64); err == nil && e > lo {
+				lo = e
+			}
+			return lo, hi, nil
+		},
+		TimeAt: func(ctx context.Context, h int64) (time.Time, error) {
+			var br blockResp
+			if err := getJSON(ctx, client, fmt.Sprintf("%s/block?height=%d", base, h), &br); err != nil {
+				return time.Time{}, err
+			}
+			t, err := time.Parse(time.RFC3339Nano, br.Result.Block.Header.Time)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("parse time of block %d: %w", h, err)
+			}
+			return t.UTC(), nil
+		},
+	}
+}
+
+func parseTarget(s string) (time.Time, error) {
+	// RFC3339Nano also accepts times without fractional seconds
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s))
+	var pe *time.ParseError
+	switch {
+	case errors.As(err, &pe) && pe.Message != "":
+		// Well formed but out of range, e.g. a +25:00 offset or day 32
+		return time.Time{}, fmt.Errorf("invalid time %q%s", clip(s), pe.Message)
+	case err != nil:
+		if alt := suggestTime(s); alt != "" {
+			return time.Time{}, fmt.Errorf("unsupported time format %q; did you mean %s? (use RFC3339/RFC3339Nano)", clip(s), alt)
+		}
+		return time.Time{}, fmt.Errorf("unsupported time format %q (use RFC3339/RFC3339Nano, e.g. 2025-10-07T14:00:00Z)", clip(s))
+	}
+	// Durations saturate about 292 years out, which would skew every delta
+	if y := t.UTC().Year(); y < 1970 || y > 2200 {
+		return time.Time{}, fmt.Errorf("time %q is outside the years 1970-2200", clip(s))
+	}
+	return t.UTC(), nil
+}
+
+// suggestTime returns the RFC3339 time a near miss most likely means, e.g.
+// a missing zone, a space for the T or Unix seconds, or "" when s looks
+// like no time. Times without a zone are taken as UTC, as everywhere else.
+func suggestTime(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339Nano)
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case n >= 1e9 && n < 1e10:
+			return time.Unix(n, 0).UTC().Format(time.RFC3339)
+		case n >= 1e12 && n < 1e13:
+			return time.UnixMilli(n).UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return ""
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(client, req, out)
+}
+
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d for %s", resp.StatusCode, req.URL)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+func failf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", a...)
+	os.Exit(1)
+}
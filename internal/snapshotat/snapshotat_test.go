@@ -0,0 +1,179 @@
+package snapshotat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the snapshot end to end through its
+// flags and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("SNAPSHOT_AT_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// genesisTime is block 0 of every test chain. Bor blocks come every 2s,
+// Heimdall blocks every second and Ethereum blocks every 12s.
+const genesisTime = 1_700_000_000
+
+// evmNode is a JSON-RPC endpoint whose block h is at genesis + h*spacing.
+type evmNode struct {
+	head    int64
+	spacing int64
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (n *evmNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	n.calls++
+	n.mu.Unlock()
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params []any           `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "eth_blockNumber":
+		resp["result"] = fmt.Sprintf("0x%x", n.head)
+	case "eth_getBlockByNumber":
+		h, _ := strconv.ParseInt(strings.TrimPrefix(req.Params[0].(string), "0x"), 16, 64)
+		resp["result"] = map[string]string{"number": fmt.Sprintf("0x%x", h), "timestamp": fmt.Sprintf("0x%x", genesisTime+h*n.spacing)}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// heimdallNode is a Tendermint API pruned below earliest, with a block
+// every second.
+type heimdallNode struct{ head, earliest int64 }
+
+func (n heimdallNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/status":
+		fmt.Fprintf(w, `{"result":{"sync_info":{"latest_block_height":"%d","earliest_block_height":"%d"}}}`, n.head, n.earliest)
+	case "/block":
+		h, _ := strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+		if h < n.earliest {
+			http.Error(w, "pruned", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, `{"result":{"block":{"header":{"time":%q}}}}`, time.Unix(genesisTime+h, 0).UTC().Format(time.RFC3339Nano))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newServer(t *testing.T, h http.Handler) string {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs snapshot_at.go with args and returns its stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "SNAPSHOT_AT_RUN_MAIN=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+func at(seconds int64) string { return time.Unix(genesisTime+seconds, 0).UTC().Format(time.RFC3339) }
+
+func TestSnapshot(t *testing.T) {
+	bor := &evmNode{head: 1_000_000, spacing: 2}
+	l1 := &evmNode{head: 200_000, spacing: 12}
+	borURL, l1URL := newServer(t, bor), newServer(t, l1)
+	heimdallURL := newServer(t, heimdallNode{head: 2_000_000, earliest: 100})
+
+	// At genesis + 1001s Bor blocks 500 and 501 are 1s either side, and
+	// the tie goes to the earlier one; Heimdall block 1001 is exact; L1
+	// block 83 (996s) is nearer than 84 (1008s)
+	stdout, stderr, err := run(t, "-time="+at(1001), "-rpc="+borURL, "-heimdall-base="+heimdallURL, "-l1-rpc="+l1URL, "-json")
+	if err != nil {
+		t.Fatalf("snapshot: %v\n%s", err, stderr)
+	}
+	var snap struct {
+		Network string
+		Blocks  []match
+	}
+	if err := json.Unmarshal([]byte(stdout), &snap); err != nil {
+		t.Fatalf("%v\n%s", err, stdout)
+	}
+	want := []match{
+		{Layer: "bor", Height: 500, Offset: -1, Before: 500, After: 501},
+		{Layer: "heimdall", Height: 1001, Offset: 0, Before: 1001, After: 1002},
+		{Layer: "ethereum", Height: 83, Offset: -5, Before: 83, After: 84},
+	}
+	if len(snap.Blocks) != len(want) {
+		t.Fatalf("blocks %+v", snap.Blocks)
+	}
+	for i, w := range want {
+		g := snap.Blocks[i]
+		if g.Layer != w.Layer || g.Height != w.Height || g.Offset != w.Offset || g.Before != w.Before || g.After != w.After || g.Error != "" {
+			t.Errorf("%s = %+v, want %+v", w.Layer, g, w)
+		}
+	}
+	// A binary search over a million blocks takes about 20 lookups
+	if bor.calls > 25 {
+		t.Errorf("bor search made %d calls", bor.calls)
+	}
+
+	// Past the head the head is the match, with no block after it; before
+	// a pruned node's earliest block is an error for that layer only
+	stdout, stderr, err = run(t, "-time="+at(50), "-rpc="+newServer(t, &evmNode{head: 20, spacing: 2}), "-heimdall-base="+heimdallURL, "-l1-rpc=-")
+	if err == nil {
+		t.Error("exited 0 with a layer failing")
+	}
+	if !regexp.MustCompile(`bor\s+20\s+` + regexp.QuoteMeta(at(40)) + `\s+-10\.000s\s+20 – head`).MatchString(stdout) {
+		t.Errorf("no head row for bor:\n%s", stdout)
+	}
+	if !regexp.MustCompile(`heimdall\s+error`).MatchString(stdout) || !strings.Contains(stderr, "error: heimdall: target is before the earliest available block 100") {
+		t.Errorf("no pruned error for heimdall:\n%s%s", stdout, stderr)
+	}
+	if strings.Contains(stdout, "ethereum") {
+		t.Errorf("skipped layer printed:\n%s", stdout)
+	}
+}
+
+func TestSnapshotInput(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "-time is required"},
+		{[]string{"-time=2025-01-01 12:00:00"}, "did you mean 2025-01-01T12:00:00Z?"},
+		{[]string{"-time=1700000000"}, "did you mean 2023-11-14T22:13:20Z?"},
+		{[]string{"-time=2025-01-32T00:00:00Z"}, "invalid time"},
+		{[]string{"-time=1900-01-01T00:00:00Z"}, "outside the years 1970-2200"},
+		{[]string{"-time=2199-01-01T00:00:00Z"}, "is in the future"},
+		{[]string{"-time=2024-01-01T00:00:00Z", "-network=mumbai"}, `unknown network "mumbai"`},
+		{[]string{"-time=2024-01-01T00:00:00Z", "-rpc=-", "-heimdall-base=-", "-l1-rpc=-"}, "every layer is skipped"},
+	}
+	for _, tt := range tests {
+		if _, stderr, err := run(t, tt.args...); err == nil || !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: %v\n%s", tt.args, err, stderr)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+// Package zkevmavg is zkevm_blocktime_calculator.go: it measures the average
+// Polygon zkEVM block time.
+package zkevmavg
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+	"github.com/pratikspatil024/chain-utils/pkg/fetch"
+	"github.com/pratikspatil024/chain-utils/pkg/human"
+	"github.com/pratikspatil024/chain-utils/pkg/retry"
+)
+
+const (
+	defaultRPC  = "https://zkevm-rpc.com"
+	httpTimeout = 20 * time.Second
+
+	// defaultRetryBudget is -retry-budget's default: enough to ride out a
+	// few dropped requests, not a flapping endpoint.
+	defaultRetryBudget = 20
+
+	// fetchConcurrency bounds the block requests in flight at once.
+	fetchConcurrency = 4
+
+	// defaultMaxHorizon bounds how far -target may lie from now.
+	// avgPlausibleFactor bounds how far -avg may stray from the measured
+	// average.
+	defaultMaxHorizon  = 2 * 365 * 24 * time.Hour
+	avgPlausibleFactor = 10.0
+)
+
+type block struct {
+	Number    string `json:"number"`
+	Timestamp string `json:"timestamp"`
+}
+
+type batch struct {
+	Number    string `json:"number"`
+	Timestamp string `json:"timestamp"`
+}
+
+// batchProgress is where the three zkEVM batch stages stand: trusted
+// batches are closed by the sequencer, virtual batches are sequenced on L1
+// and verified batches have a validity proof on L1.
+type batchProgress struct {
+	Trusted, Virtual, Verified       uint64
+	TrustedAt, VirtualAt, VerifiedAt time.Time
+	Interval                         time.Duration
+	BlocksPerBatch                   float64
+	SampleFrom                       uint64
+}
+
+// retries is the run's retry budget, shared by every request.
+var retries = retry.NewBudget(defaultRetryBudget, nil)
+
+// Main runs the script on os.Args and exits the process on failure.
+func Main() {
+	rpcURL := flag.String("rpc", defaultRPC, "Polygon zkEVM JSON-RPC endpoint")
+	lookbacksStr := flag.String("lookbacks", "10000,100000,1000000", "Comma-separated L2 block lookbacks to average over")
+	sampleBatches := flag.Uint64("batches", 100, "Recent trusted batches whose cadence drives the batch estimates")
+	targetStr := flag.String("target", "", "Target time in RFC3339 or RFC3339Nano (UTC); predicts the L2 height and batch numbers at it")
+	avg := flag.Float64("avg", 0, "L2 average block time in seconds for -target (default: the first lookback's average)")
+	retryBudget := flag.Int("retry-budget", defaultRetryBudget, "Retries the whole run may spend across all requests before failing fast (0 never retries)")
+	maxHorizon := flag.Duration("max-horizon", defaultMaxHorizon, "Reject a -target further than this from now, most often a mistyped year (0 disables the check)")
+	flag.Parse()
+
+	if *retryBudget < 0 {
+		failf("-retry-budget must not be negative")
+	}
+	retries = retry.NewBudget(*retryBudget, nil)
+
+	lookbacks, err := parseLookbacks(*lookbacksStr)
+	if err != nil {
+		failf("parse -lookbacks: %v", err)
+	}
+	if *sampleBatches < 1 {
+		failf("-batches must be positive")
+	}
+	var target time.Time
+	if *targetStr != "" {
+		if target, err = parseTarget(*targetStr); err != nil {
+			failf("parse target time: %v", err)
+		}
+		if err := checkHorizon(target, time.Now(), *maxHorizon); err != nil {
+			failf("%v", err)
+		}
+	}
+	if flagSet("avg") {
+		if err := checkAvg(*avg, 0, ""); err != nil {
+			failf("%v", err)
+		}
+	}
+
+	ctx := context.Background()
+	client := &http.Client{Timeout: httpTimeout}
+
+	// 1) Latest L2 block
+	head, err := getLatestBlockNumber(ctx, client, *rpcURL)
+	if err != nil {
+		failf("get latest block number: %v", err)
+	}
+	headTime, err := getBlockTime(ctx, client, *rpcURL, head)
+	if err != nil {
+		failf("get block %d: %v", head, err)
+	}
+	fmt.Printf("Current block : %s — %s (UTC)\n", human.CommasUint(head), headTime.Format(time.RFC3339))
+	// Lookbacks asked for explicitly must all be measurable; the defaults
+	// just skip what a young chain (e.g. a devnet) cannot cover
+	if flagSet("lookbacks") {
+		if err := checkLookbacks(lookbacks, head); err != nil {
+			failf("%v", err)
+		}
+	}
+
+	// 2) Average block time over each lookback
+	fromTimes := make([]time.Time, len(lookbacks))
+	g := fetch.NewGroup(ctx, fetchConcurrency)
+	for i, lb := range lookbacks {
+		if lb < head {
+			g.Go(func(ctx context.Context) (err error) {
+				if fromTimes[i], err = getBlockTime(ctx, client, *rpcURL, head-lb); err != nil {
+					return fmt.Errorf("get block %d: %w", head-lb, err)
+				}
+				return nil
+			})
+		}
+	}
+	if err := g.Wait(); err != nil {
+		failf("%v", err)
+	}
+	firstAvg := 0.0
+	for i, lb := range lookbacks {
+		if lb >= head {
+			fmt.Printf("\nLookback %s blocks: beyond genesis, skipped\n", human.CommasUint(lb))
+			continue
+		}
+		from, fromTime := head-lb, fromTimes[i]
+		elapsed := headTime.Sub(fromTime)
+		avgSecs := elapsed.Seconds() / float64(lb)
+		if i == 0 {
+			firstAvg = avgSecs
+		}
+		fmt.Printf("\nLookback %s blocks (from %s at %s):\n", human.CommasUint(lb), human.CommasUint(from), fromTime.Format(time.RFC3339))
+		fmt.Printf("  elapsed   : %s\n", human.DHMS(elapsed))
+		fmt.Printf("  avg block : %.6f s\n", avgSecs)
+		if avgSecs > 0 {
+			fmt.Printf("  blocks/h  : %.1f\n", 3600/avgSecs)
+		}
+	}
+
+	// 3) Batch progression
+	bp, err := getBatchProgress(ctx, client, *rpcURL, *sampleBatches)
+	if err != nil {
+		failf("batch progression: %v", err)
+	}
+	fmt.Printf("\nBatches (cadence over %s batches from %s):\n", human.CommasUint(bp.Trusted-bp.SampleFrom), human.CommasUint(bp.SampleFrom))
+	fmt.Printf("  trusted   : %s — %s\n", human.CommasUint(bp.Trusted), bp.TrustedAt.Format(time.RFC3339))
+	fmt.Printf("  virtual   : %s — %s (%s behind, %s)\n", human.CommasUint(bp.Virtual), bp.VirtualAt.Format(time.RFC3339), human.CommasUint(bp.Trusted-bp.Virtual), human.DHMS(bp.TrustedAt.Sub(bp.VirtualAt)))
+	fmt.Printf("  verified  : %s — %s (%s behind, %s)\n", human.CommasUint(bp.Verified), bp.VerifiedAt.Format(time.RFC3339), human.CommasUint(bp.Trusted-bp.Verified), human.DHMS(bp.TrustedAt.Sub(bp.VerifiedAt)))
+	fmt.Printf("  interval  : %s per batch, ~%.1f blocks each\n", bp.Interval.Round(time.Millisecond), bp.BlocksPerBatch)
+
+	if target.IsZero() {
+		return
+	}
+
+	// 4) Express the target against both block height and batch number
+	if !flagSet("avg") {
+		*avg = firstAvg
+	} else if err := checkAvg(*avg, firstAvg, "the first lookback's measured average"); err != nil {
+		failf("%v", err)
+	}
+	if *avg <= 0 {
+		failf("no lookback average to predict with; pass -avg")
+	}
+	delta := target.Sub(headTime)
+	fmt.Printf("\nTarget time   : %s (UTC)\n", target.Format(time.RFC3339))
+	if delta <= 0 {
+		fmt.Printf("Target is not after the head block; nothing to predict.\n")
+		return
+	}
+	blocks := int64(math.Round(delta.Seconds() / *avg))
+	batches := int64(math.Round(float64(delta) / float64(bp.Interval)))
+	fmt.Printf("Δt            : %s\n", human.DHMS(delta))
+	fmt.Printf("Predicted at target:\n")
+	fmt.Printf("  L2 height      : %s (avg %.6f s)\n", human.Commas(int64(head)+blocks), *avg)
+	fmt.Printf("  trusted batch  : %s\n", human.Commas(int64(bp.Trusted)+batches))
+	fmt.Printf("  virtualized by : %s (at the current %s lag)\n", target.Add(bp.TrustedAt.Sub(bp.VirtualAt)).Format(time.RFC3339), human.DHMS(bp.TrustedAt.Sub(bp.VirtualAt)))
+	fmt.Printf("  verified by    : %s (at the current %s lag)\n", target.Add(bp.TrustedAt.Sub(bp.VerifiedAt)).Format(time.RFC3339), human.DHMS(bp.TrustedAt.Sub(bp.VerifiedAt)))
+}
+
+// getBatchProgress reads the trusted, virtual and verified batch numbers and
+// measures the trusted batch cadence over the last sample batches.
+func getBatchProgress(ctx context.Context, client *http.Client, rpcURL string, sample uint64) (batchProgress, error) {
+	var bp batchProgress
+	for _, s := range []struct {
+		method string
+		out    *uint64
+	}{
+		{"zkevm_batchNumber", &bp.Trusted},
+		{"zkevm_virtualBatchNumber", &bp.Virtual},
+		{"zkevm_verifiedBatchNumber", &bp.Verified},
+	} {
+		var hex string
+		if err := ethrpc.Call(ctx, client, rpcURL, s.method, []interface{}{}, &hex, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+			return bp, fmt.Errorf("%s: %w", s.method, err)
+		}
+		n, err := ethrpc.HexToUint64(hex)
+		if err != nil {
+			return bp, fmt.Errorf("%s: %w", s.method, err)
+		}
+		*s.out = n
+	}
+	if bp.Trusted < 2 {
+		return bp, errors.New("not enough batches to measure a cadence")
+	}
+	bp.SampleFrom = bp.Trusted - min(sample, bp.Trusted-1)
+
+	var err error
+	if bp.TrustedAt, err = getBatchTime(ctx, client, rpcURL, bp.Trusted); err != nil {
+		return bp, err
+	}
+	if bp.VirtualAt, err = getBatchTime(ctx, client, rpcURL, bp.Virtual); err != nil {
+		return bp, err
+	}
+	if bp.VerifiedAt, err = getBatchTime(ctx, client, rpcURL, bp.Verified); err != nil {
+		return bp, err
+	}
+	fromAt, err := getBatchTime(ctx, client, rpcURL, bp.SampleFrom)
+	if err != nil {
+		return bp, err
+	}
+	bp.Interval = bp.TrustedAt.Sub(fromAt) / time.Duration(bp.Trusted-bp.SampleFrom)
+	if bp.Interval <= 0 {
+		return bp, fmt.Errorf("batches %d and %d carry the same timestamp", bp.SampleFrom, bp.Trusted)
+	}
+
+	// Blocks per batch from the first block of each end of the sample
+	fromBlock, err := getBatchFirstBlock(ctx, client, rpcURL, bp.SampleFrom)
+	if err != nil {
+		return bp, err
+	}
+	toBlock, err := getBatchFirstBlock(ctx, client, rpcURL, bp.Trusted)
+	if err != nil {
+		return bp, err
+	}
+	bp.BlocksPerBatch = float64(toBlock-fromBlock) / float64(bp.Trusted-bp.SampleFrom)
+	return bp, nil
+}
+
+func getBatchTime(ctx context.Context, client *http.Client, rpcURL string, number uint64) (time.Time, error) {
+	var b *batch
+	if err := ethrpc.Call(ctx, client, rpcURL, "zkevm_getBatchByNumber", []interface{}{fmt.Sprintf("0x%x", number), false}, &b, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+		return time.Time{}, fmt.Errorf("get batch %d: %w", number, err)
+	}
+	if b == nil || b.Timestamp == "" {
+		return time.Time{}, fmt.Errorf("empty batch/timestamp for batch %d", number)
+	}
+	ts, err := ethrpc.HexToUint64(b.Timestamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse timestamp of batch %d: %w", number, err)
+	}
+	return time.Unix(int64(ts), 0).UTC(), nil
+}
+
+// getBatchFirstBlock returns the first L2 block of a batch. The batch API
+// lists block hashes, so the height comes from the first block's header.
+func getBatchFirstBlock(ctx context.Context, client *http.Client, rpcURL string, number uint64) (uint64, error) {
+	var b *struct {
+		Blocks []string `json:"blocks"`
+	}
+	if err := ethrpc.Call(ctx, client, rpcURL, "zkevm_getBatchByNumber", []interface{}{fmt.Sprintf("0x%x", number), false}, &b, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+		return 0, fmt.Errorf("get batch %d: %w", number, err)
+	}
+	if b == nil || len(b.Blocks) == 0 {
+		return 0, fmt.Errorf("batch %d has no blocks", number)
+	}
+	var blk *block
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_getBlockByHash", []interface{}{b.Blocks[0], false}, &blk, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+		return 0, fmt.Errorf("get first block of batch %d: %w", number, err)
+	}
+	if blk == nil || blk.Number == "" {
+		return 0, fmt.Errorf("empty first block of batch %d", number)
+	}
+	return ethrpc.HexToUint64(blk.Number)
+}
+
+func parseLookbacks(s string) ([]uint64, error) {
+	var out []uint64
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid lookback %q (want a positive block count, e.g. 10000)", part)
+		}
+		out = append(out, n)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no lookbacks given")
+	}
+	return out, nil
+}
+
+// checkLookbacks rejects lookbacks that reach past genesis at head, naming
+// the longest one the chain allows and a -lookbacks list that would run.
+func checkLookbacks(lookbacks []uint64, head uint64) error {
+	var long, fit []string
+	seen := map[uint64]bool{}
+	for _, lb := range lookbacks {
+		if lb >= head {
+			long = append(long, strconv.FormatUint(lb, 10))
+			lb = head - 1
+		}
+		if lb > 0 && !seen[lb] {
+			seen[lb] = true
+			fit = append(fit, strconv.FormatUint(lb, 10))
+		}
+	}
+	if len(long) == 0 {
+		return nil
+	}
+	what := "lookback " + long[0] + " reaches"
+	if len(long) > 1 {
+		what = "lookbacks " + strings.Join(long, ", ") + " reach"
+	}
+	if len(fit) == 0 {
+		return fmt.Errorf("%s past genesis: the chain is only at block %d", what, head)
+	}
+	return fmt.Errorf("%s past genesis: the chain is at block %d, so the longest possible lookback is %d; try -lookbacks=%s", what, head, head-1, strings.Join(fit, ","))
+}
+
+func parseTarget(s string) (time.Time, error) {
+	// RFC3339Nano also accepts times without fractional seconds
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s))
+	var pe *time.ParseError
+	switch {
+	case errors.As(err, &pe) && pe.Message != "":
+		// Well formed but out of range, e.g. a +25:00 offset or day 32
+		return time.Time{}, fmt.Errorf("invalid time %q%s", clip(s), pe.Message)
+	case err != nil:
+		if alt := suggestTime(s); alt != "" {
+			return time.Time{}, fmt.Errorf("unsupported time format %q; did you mean %s? (use RFC3339/RFC3339Nano)", clip(s), alt)
+		}
+		return time.Time{}, fmt.Errorf("unsupported time format %q (use RFC3339/RFC3339Nano, e.g. 2025-10-07T14:00:00Z)", clip(s))
+	}
+	// Durations saturate about 292 years out, which would skew every delta
+	if y := t.UTC().Year(); y < 1970 || y > 2200 {
+		return time.Time{}, fmt.Errorf("time %q is outside the years 1970-2200", clip(s))
+	}
+	return t.UTC(), nil
+}
+
+// suggestTime returns the RFC3339 time a near miss most likely means, e.g.
+// a missing zone, a space for the T or Unix seconds, or "" when s looks
+// like no time. Times without a zone are taken as UTC, as everywhere else.
+func suggestTime(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339Nano)
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case n >= 1e9 && n < 1e10:
+			return time.Unix(n, 0).UTC().Format(time.RFC3339)
+		case n >= 1e12 && n < 1e13:
+			return time.UnixMilli(n).UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return ""
+}
+
+// checkHorizon rejects a target further than limit from now, most often a
+// mistyped year, and suggests the same date in the nearest year that fits.
+func checkHorizon(target, now time.Time, limit time.Duration) error {
+	d := target.Sub(now)
+	if limit <= 0 || d.Abs() <= limit {
+		return nil
+	}
+	msg := fmt.Sprintf("target %s is %.0f days from now, beyond -max-horizon (%.0f days)", target.Format(time.RFC3339), d.Abs().Hours()/24, limit.Hours()/24)
+	alt := target.AddDate(now.Year()-target.Year(), 0, 0)
+	for _, y := range []int{-1, 1} {
+		if c := alt.AddDate(y, 0, 0); c.Sub(now).Abs() < alt.Sub(now).Abs() {
+			alt = c
+		}
+	}
+	if alt.Sub(now) <= limit {
+		msg += fmt.Sprintf("; did you mean -target=%s?", alt.Format(time.RFC3339))
+	}
+	return errors.New(msg + " Raise -max-horizon if the date is right")
+}
+
+// checkAvg rejects an -avg that is not a positive number of seconds, or is
+// more than avgPlausibleFactor off ref (what, e.g. "Polygon PoS's nominal
+// block time"), so a value in milliseconds or a typo fails with the likely
+// intended value instead of predicting a height orders of magnitude off.
+func checkAvg(avg, ref float64, what string) error {
+	if math.IsNaN(avg) || math.IsInf(avg, 0) || avg <= 0 {
+		if ref > 0 {
+			return fmt.Errorf("-avg must be a positive number of seconds per block, got %v; %s is %gs, e.g. -avg=%g", avg, what, ref, ref)
+		}
+		return fmt.Errorf("-avg must be a positive number of seconds per block, got %v", avg)
+	}
+	plausible := func(v float64) bool { return v >= ref/avgPlausibleFactor && v <= ref*avgPlausibleFactor }
+	if ref <= 0 || plausible(avg) {
+		return nil
+	}
+	if plausible(avg / 1000) {
+		return fmt.Errorf("-avg=%v is over %gx %s of %gs and looks like milliseconds; did you mean -avg=%g?", avg, avgPlausibleFactor, what, ref, avg/1000)
+	}
+	return fmt.Errorf("-avg=%v is more than %gx off %s of %gs; check the units, or pass e.g. -avg=%g", avg, avgPlausibleFactor, what, ref, ref)
+}
+
+// flagSet reports whether the named flag was passed on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+func getLatestBlockNumber(ctx context.Context, client *http.Client, rpcURL string) (uint64, error) {
+	var hex string
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_blockNumber", []interface{}{}, &hex, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+		return 0, err
+	}
+	return ethrpc.HexToUint64(hex)
+}
+
+func getBlockTime(ctx context.Context, client *http.Client, rpcURL string, height uint64) (time.Time, error) {
+	var b *block
+	if err := ethrpc.Call(ctx, client, rpcURL, "eth_getBlockByNumber", []interface{}{fmt.Sprintf("0x%x", height), false}, &b, ethrpc.WithRetryGate(retries.Spend)); err != nil {
+		return time.Time{}, err
+	}
+	if b == nil || b.Timestamp == "" {
+		return time.Time{}, fmt.Errorf("empty block/timestamp for height %d", height)
+	}
+	ts, err := ethrpc.HexToUint64(b.Timestamp)
+	return time.Unix(int64(ts), 0).UTC(), err
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
+
+func failf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", a...)
+	os.Exit(1)
+}
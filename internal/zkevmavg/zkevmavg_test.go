@@ -0,0 +1,261 @@
+package zkevmavg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain runs main instead of the tests when the binary re-executes
+// itself, so the tests below drive the calculator end to end through its
+// flags and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("ZKEVM_RUN_MAIN") != "" {
+		Main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// genesisTime is block 0 of the test chain. Blocks come every 3s up to
+// height 1,000,000 and every 2s after it, so the head, 2,000,000, is at
+// 2024-01-11T19:06:40Z. Batch b holds blocks 30b to 30b+29 and closes a
+// minute after batch b-1; the trusted batch, 66,000, closes at the head.
+const genesisTime = 1_700_000_000
+
+func blockTime(h uint64) uint64 {
+	if h <= 1_000_000 {
+		return genesisTime + 3*h
+	}
+	return genesisTime + 3_000_000 + 2*(h-1_000_000)
+}
+
+func batchTime(b uint64) uint64 { return blockTime(2_000_000) - 60*(66_000-b) }
+
+// zkevmNode is a zkEVM JSON-RPC endpoint over the test chain.
+type zkevmNode struct {
+	head     uint64
+	pruned   uint64          // blocks below answer as on a pruned node
+	bad      map[uint64]bool // batches whose timestamp is not hex
+	every429 int             // every nth request is rate limited
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (n *zkevmNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params []any           `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if n.every429 > 0 && n.calls%n.every429 == 0 {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+		return
+	}
+	param := func() uint64 {
+		v, _ := strconv.ParseUint(strings.TrimPrefix(req.Params[0].(string), "0x"), 16, 64)
+		return v
+	}
+	block := func(h uint64) any {
+		return map[string]string{"number": fmt.Sprintf("0x%x", h), "timestamp": fmt.Sprintf("0x%x", blockTime(h))}
+	}
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "eth_blockNumber":
+		resp["result"] = fmt.Sprintf("0x%x", n.head)
+	case "eth_getBlockByNumber":
+		if h := param(); h < n.pruned {
+			resp["error"] = map[string]any{"code": -32000, "message": "header not found"}
+		} else {
+			resp["result"] = block(h)
+		}
+	case "eth_getBlockByHash":
+		resp["result"] = block(param())
+	case "zkevm_batchNumber":
+		resp["result"] = "0x101d0" // 66,000
+	case "zkevm_virtualBatchNumber":
+		resp["result"] = "0x101c6" // 65,990
+	case "zkevm_verifiedBatchNumber":
+		resp["result"] = "0x1016c" // 65,900
+	case "zkevm_getBatchByNumber":
+		b := param()
+		ts := fmt.Sprintf("0x%x", batchTime(b))
+		if n.bad[b] {
+			ts = "soon"
+		}
+		// block hashes carry the height, which eth_getBlockByHash reads back
+		resp["result"] = map[string]any{"number": fmt.Sprintf("0x%x", b), "timestamp": ts, "blocks": []string{fmt.Sprintf("0x%064x", 30*b)}}
+	default:
+		resp["error"] = map[string]any{"code": -32601, "message": "method not found"}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func newZkevmNode(t *testing.T, n *zkevmNode) string {
+	t.Helper()
+	srv := httptest.NewServer(n)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// run runs the calculator with args and returns its stdout and stderr.
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-max-horizon=0"}, args...)...)
+	cmd.Env = append(os.Environ(), "ZKEVM_RUN_MAIN=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+const healthyReport = `Current block : 2,000,000 — 2024-01-11T19:06:40Z (UTC)
+
+Lookback 10,000 blocks (from 1,990,000 at 2024-01-11T13:33:20Z):
+  elapsed   : 0d 5h 33m 20s
+  avg block : 2.000000 s
+  blocks/h  : 1800.0
+
+Lookback 1,500,000 blocks (from 500,000 at 2023-12-02T06:53:20Z):
+  elapsed   : 40d 12h 13m 20s
+  avg block : 2.333333 s
+  blocks/h  : 1542.9
+
+Batches (cadence over 100 batches from 65,900):
+  trusted   : 66,000 — 2024-01-11T19:06:40Z
+  virtual   : 65,990 — 2024-01-11T18:56:40Z (10 behind, 0d 0h 10m 0s)
+  verified  : 65,900 — 2024-01-11T17:26:40Z (100 behind, 0d 1h 40m 0s)
+  interval  : 1m0s per batch, ~30.0 blocks each
+
+Target time   : 2024-01-11T20:06:40Z (UTC)
+Δt            : 0d 1h 0m 0s
+Predicted at target:
+  L2 height      : 2,001,800 (avg 2.000000 s)
+  trusted batch  : 66,060
+  virtualized by : 2024-01-11T20:16:40Z (at the current 0d 0h 10m 0s lag)
+  verified by    : 2024-01-11T21:46:40Z (at the current 0d 1h 40m 0s lag)
+`
+
+func TestReport(t *testing.T) {
+	url := newZkevmNode(t, &zkevmNode{head: 2_000_000})
+	stdout, stderr, err := run(t, "-rpc="+url, "-lookbacks=10000,1500000", "-target=2024-01-11T20:06:40Z")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if stdout != healthyReport {
+		t.Errorf("got\n%s\nwant\n%s", stdout, healthyReport)
+	}
+}
+
+func TestReportRateLimited(t *testing.T) {
+	url := newZkevmNode(t, &zkevmNode{head: 2_000_000, every429: 4})
+	stdout, stderr, err := run(t, "-rpc="+url, "-lookbacks=10000,1500000", "-target=2024-01-11T20:06:40Z")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if stdout != healthyReport {
+		t.Errorf("got\n%s\nwant\n%s", stdout, healthyReport)
+	}
+
+	url = newZkevmNode(t, &zkevmNode{head: 2_000_000, every429: 2})
+	_, stderr, err = run(t, "-rpc="+url, "-retry-budget=1")
+	if err == nil || !strings.Contains(stderr, "retry budget exhausted: 1 retries spent, failures seen: 2 rate limited") {
+		t.Errorf("run error = %v, want the spent budget reported:\n%s", err, stderr)
+	}
+}
+
+func TestReportAvg(t *testing.T) {
+	url := newZkevmNode(t, &zkevmNode{head: 2_000_000})
+	stdout, stderr, err := run(t, "-rpc="+url, "-lookbacks=1500000", "-target=2024-01-11T20:06:40Z")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	// The first lookback's 2.333333s drives the prediction: 3,600s is 1,543
+	// blocks
+	if !strings.Contains(stdout, "  L2 height      : 2,001,543 (avg 2.333333 s)") {
+		t.Errorf("output lacks the prediction at the measured average:\n%s", stdout)
+	}
+
+	stdout, stderr, err = run(t, "-rpc="+url, "-lookbacks=10000", "-target=2024-01-11T20:06:40Z", "-avg=2.5")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "  L2 height      : 2,001,440 (avg 2.500000 s)") {
+		t.Errorf("output lacks the prediction at -avg:\n%s", stdout)
+	}
+
+	_, stderr, err = run(t, "-rpc="+url, "-lookbacks=10000", "-target=2024-01-11T20:06:40Z", "-avg=2000")
+	if err == nil || !strings.Contains(stderr, "looks like milliseconds; did you mean -avg=2?") {
+		t.Errorf("run error = %v, want -avg in milliseconds caught:\n%s", err, stderr)
+	}
+}
+
+func TestReportFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		node *zkevmNode
+		args []string
+		want string
+	}{
+		{"pruned", &zkevmNode{head: 2_000_000, pruned: 1_000_001}, nil, "get block 1000000: rpc eth_getBlockByNumber: rpc error -32000: header not found"},
+		{"malformed batch", &zkevmNode{head: 2_000_000, bad: map[uint64]bool{65_990: true}}, nil, "batch progression: parse timestamp of batch 65990"},
+		{"lookback past genesis", &zkevmNode{head: 50_000}, []string{"-lookbacks=10000,100000"}, "lookback 100000 reaches past genesis: the chain is at block 50000, so the longest possible lookback is 49999; try -lookbacks=10000,49999"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := newZkevmNode(t, tt.node)
+			_, stderr, err := run(t, append([]string{"-rpc=" + url}, tt.args...)...)
+			if err == nil || !strings.Contains(stderr, tt.want) {
+				t.Errorf("run error = %v, want %q in:\n%s", err, tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestParseLookbacks(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []uint64
+		wantErr bool
+	}{
+		{"10000, 100000,", []uint64{10000, 100000}, false},
+		{"", nil, true},
+		{"0", nil, true},
+		{"1e4", nil, true},
+		{"-5", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseLookbacks(tt.in)
+		if (err != nil) != tt.wantErr || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseLookbacks(%q) = %v, %v, want %v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckHorizon(t *testing.T) {
+	now := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	if err := checkHorizon(now.AddDate(1, 0, 0), now, defaultMaxHorizon); err != nil {
+		t.Errorf("a year ahead: %v", err)
+	}
+	err := checkHorizon(time.Date(2052, 11, 4, 14, 0, 0, 0, time.UTC), now, defaultMaxHorizon)
+	if err == nil || !strings.Contains(err.Error(), "did you mean -target=2025-11-04T14:00:00Z?") {
+		t.Errorf("mistyped year: error = %v, want the nearest fitting year suggested", err)
+	}
+}
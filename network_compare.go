@@ -0,0 +1,12 @@
+//go:build ignore
+
+// go run network_compare.go
+// go run network_compare.go -networks=mainnet,amoy -target="2025-12-03T21:49:11Z"
+// go run network_compare.go -hf-heights="mainnet=80000000,amoy=28000000"
+// go run network_compare.go -amoy-rpc="$AMOY_RPC" -bor-lookback=280000 -heimdall-lookback=100000
+
+package main
+
+import "github.com/pratikspatil024/chain-utils/internal/networkcompare"
+
+func main() { networkcompare.Main() }
@@ -0,0 +1,149 @@
+//go:build badger
+
+package blockstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func init() {
+	Register("badger", openBadger)
+}
+
+// badgerStore keeps a network in one badger directory under two key
+// prefixes: network+"\x00f" for finalized blocks, which never expire, and
+// network+"\x00r" for near-head blocks, written with badger's own TTL.
+type badgerStore struct {
+	db            *badger.DB
+	final, recent []byte
+}
+
+// badgerBatch caps the blocks Add writes per transaction, well below
+// badger's transaction size limit.
+const badgerBatch = 1000
+
+// openBadger opens the badger directory at dir, creating it when it is
+// missing. Badger locks the directory to one process. Its tables are sized
+// for a header cache rather than badger's defaults, and it logs nothing.
+func openBadger(dir, network string) (Store, error) {
+	opts := badger.DefaultOptions(dir).
+		WithLogger(nil).
+		WithMemTableSize(8 << 20).
+		WithValueLogFileSize(64 << 20).
+		WithBlockCacheSize(16 << 20)
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &badgerStore{db: db, final: []byte(network + "\x00f"), recent: []byte(network + "\x00r")}, nil
+}
+
+func (s *badgerStore) key(prefix []byte, h int64) []byte {
+	return append(append([]byte(nil), prefix...), heightKey(h)...)
+}
+
+// scan calls fn with every key and value under prefix.
+func (s *badgerStore) scan(prefix []byte, fn func(k, v []byte) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix, PrefetchValues: true, PrefetchSize: 100})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := fn(item.Key(), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *badgerStore) Load(ctx context.Context) ([]Block, error) {
+	var blocks []Block
+	err := s.scan(s.final, func(k, v []byte) error {
+		r, err := decodeKV(k, v)
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, r.Block)
+		return nil
+	})
+	return blocks, err
+}
+
+func (s *badgerStore) Add(ctx context.Context, blocks []Block) error {
+	for len(blocks) > 0 {
+		n := min(len(blocks), badgerBatch)
+		err := s.db.Update(func(txn *badger.Txn) error {
+			for _, b := range blocks[:n] {
+				k := s.key(s.final, b.Height)
+				_, err := txn.Get(k)
+				if err == nil {
+					continue
+				}
+				if !errors.Is(err, badger.ErrKeyNotFound) {
+					return err
+				}
+				if err := txn.Set(k, encodeKV(b, time.Time{})); err != nil {
+					return fmt.Errorf("height %d: %w", b.Height, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		blocks = blocks[n:]
+	}
+	return nil
+}
+
+// LoadRecent relies on badger to hide expired keys, and compares the
+// stored expiry too, which is finer than badger's whole seconds.
+func (s *badgerStore) LoadRecent(ctx context.Context) ([]Recent, error) {
+	var recent []Recent
+	now := time.Now()
+	err := s.scan(s.recent, func(k, v []byte) error {
+		if r, err := decodeKV(k, v); err == nil && now.Before(r.Expires) {
+			recent = append(recent, r)
+		}
+		return nil
+	})
+	return recent, err
+}
+
+func (s *badgerStore) PutRecent(ctx context.Context, r Recent) error {
+	ttl := time.Until(r.Expires)
+	if ttl <= 0 {
+		return s.DropRecent(ctx, []int64{r.Height})
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(s.key(s.recent, r.Height), encodeKV(r.Block, r.Expires)).WithTTL(ttl))
+	})
+}
+
+func (s *badgerStore) DropRecent(ctx context.Context, heights []int64) error {
+	if len(heights) == 0 {
+		return nil
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		for _, h := range heights {
+			if err := txn.Delete(s.key(s.recent, h)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *badgerStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,15 @@
+//go:build badger
+
+package blockstore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBadger(t *testing.T) {
+	dir := DefaultPath(filepath.Join(t.TempDir(), "cache"), "badger")
+	open := func(network string) (Store, error) { return Open("badger", dir, network) }
+	testStore(t, open)
+	testExpiring(t, open)
+}
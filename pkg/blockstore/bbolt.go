@@ -0,0 +1,144 @@
+//go:build bbolt
+
+package blockstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func init() {
+	Register("bbolt", openBolt)
+}
+
+// boltStore keeps a network in two buckets of one bbolt file, both keyed by
+// height: its finalized blocks under the network's name and its near-head
+// blocks under name+"/recent". bbolt has no TTLs, so each near-head block
+// stores its expiry and LoadRecent purges the expired ones.
+type boltStore struct {
+	db            *bolt.DB
+	final, recent []byte
+}
+
+// openBolt opens the bbolt file at path, creating it when it is missing.
+// bbolt locks the file to one process, so a second one gives up after a
+// second rather than hanging behind a -watch run.
+func openBolt(path, network string) (Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s is in use by another process", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &boltStore{db: db, final: []byte(network), recent: []byte(network + "/recent")}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{s.final, s.recent} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *boltStore) Load(ctx context.Context) ([]Block, error) {
+	var blocks []Block
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.final).ForEach(func(k, v []byte) error {
+			r, err := decodeKV(k, v)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, r.Block)
+			return nil
+		})
+	})
+	return blocks, err
+}
+
+func (s *boltStore) Add(ctx context.Context, blocks []Block) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(s.final)
+		for _, b := range blocks {
+			k := heightKey(b.Height)
+			if bk.Get(k) != nil {
+				continue
+			}
+			if err := bk.Put(k, encodeKV(b, time.Time{})); err != nil {
+				return fmt.Errorf("height %d: %w", b.Height, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) LoadRecent(ctx context.Context) ([]Recent, error) {
+	var recent []Recent
+	now := time.Now()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(s.recent)
+		var expired [][]byte
+		err := bk.ForEach(func(k, v []byte) error {
+			r, err := decodeKV(k, v)
+			if err != nil || !now.Before(r.Expires) {
+				expired = append(expired, k)
+				return nil
+			}
+			recent = append(recent, r)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := bk.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return recent, err
+}
+
+func (s *boltStore) PutRecent(ctx context.Context, r Recent) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.recent).Put(heightKey(r.Height), encodeKV(r.Block, r.Expires))
+	})
+}
+
+func (s *boltStore) DropRecent(ctx context.Context, heights []int64) error {
+	if len(heights) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(s.recent)
+		for _, h := range heights {
+			if err := bk.Delete(heightKey(h)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
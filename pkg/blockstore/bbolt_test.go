@@ -0,0 +1,27 @@
+//go:build bbolt
+
+package blockstore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBolt(t *testing.T) {
+	path := DefaultPath(filepath.Join(t.TempDir(), "cache"), "bbolt")
+	open := func(network string) (Store, error) { return Open("bbolt", path, network) }
+	testStore(t, open)
+	testExpiring(t, open)
+}
+
+func TestBoltLocked(t *testing.T) {
+	path := DefaultPath(t.TempDir(), "bbolt")
+	st, err := Open("bbolt", path, "bor-137")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if _, err := Open("bbolt", path, "bor-137"); err == nil || err.Error() != path+" is in use by another process" {
+		t.Errorf("second Open = %v", err)
+	}
+}
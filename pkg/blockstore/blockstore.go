@@ -0,0 +1,190 @@
+// Package blockstore is the database side of the block header store the
+// average calculators cache finalized blocks in and block_history.go syncs
+// into. The default store is a JSON-lines file per network, which the
+// scripts read and write themselves; this package holds the backends that
+// keep the same (height, hash, time) rows in a database instead:
+//
+//	st, err := blockstore.Open("sqlite", blockstore.DefaultPath(cacheDir, "sqlite"), "bor-137")
+//	if err != nil { ... }
+//	defer st.Close()
+//	blocks, err := st.Load(ctx)
+//	err = st.Add(ctx, []blockstore.Block{{Height: 1, Hash: "0x..", Time: t}})
+//
+// Each backend needs a third-party driver, so it is only compiled in with
+// its build tag, e.g. go build -tags sqlite. A build without the tag still
+// knows the backend's name and says which tag it needs.
+package blockstore
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Block is one stored block header. Proposer is only known for Heimdall
+// blocks that sync recorded.
+type Block struct {
+	Height   int64
+	Hash     string
+	Time     time.Time
+	Proposer string
+}
+
+// Store holds the finalized blocks of one network, named as the file store
+// names it: "bor-137", "heimdall-heimdallv2-137". Several processes may use
+// a SQL store at the same time; bbolt and badger lock their database to the
+// process that opened it.
+type Store interface {
+	// Load returns every stored block, in no particular order.
+	Load(ctx context.Context) ([]Block, error)
+	// Add stores blocks in one transaction. A height already stored keeps
+	// its first block: finalized blocks never change.
+	Add(ctx context.Context, blocks []Block) error
+	Close() error
+}
+
+// Recent is a block above the finalized height, which may still reorg,
+// kept until Expires.
+type Recent struct {
+	Block
+	Expires time.Time
+}
+
+// Expiring is a Store that also keeps near-head blocks with a time to live,
+// so a rerun within it can reuse them. The key-value backends implement it;
+// the SQL ones keep finalized blocks only.
+type Expiring interface {
+	Store
+	// LoadRecent returns the near-head blocks that have not expired.
+	LoadRecent(ctx context.Context) ([]Recent, error)
+	// PutRecent keeps r until r.Expires, replacing any block kept at its
+	// height.
+	PutRecent(ctx context.Context, r Recent) error
+	// DropRecent forgets the near-head blocks at heights, once they reorged
+	// or fell below the finalized height.
+	DropRecent(ctx context.Context, heights []int64) error
+}
+
+// Opener opens the store of network at dsn: a file or directory path for
+// an embedded database, a connection URL for a server.
+type Opener func(dsn, network string) (Store, error)
+
+// tags are the backends this module has, by the build tag that compiles
+// each in, so a build without one can say how to get it.
+var tags = map[string]string{
+	"sqlite":   "sqlite",
+	"bbolt":    "bbolt",
+	"badger":   "badger",
+	"postgres": "postgres",
+}
+
+// servers are the backends whose DSN is a connection URL rather than a
+// path under the cache directory.
+var servers = map[string]bool{"postgres": true}
+
+// schemes map the URL schemes of server DSNs to their backend, so a DSN
+// like postgres://host/db names its backend by itself.
+var schemes = map[string]string{"postgres": "postgres", "postgresql": "postgres"}
+
+var (
+	mu       sync.Mutex
+	backends = make(map[string]Opener)
+)
+
+// Register makes a backend available to Open under name. The backends of
+// this package register themselves; Register panics on a duplicate name.
+func Register(name string, open Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := backends[name]; dup {
+		panic("blockstore: Register called twice for " + name)
+	}
+	backends[name] = open
+}
+
+// Known returns the backends of this module, compiled in or not, sorted.
+func Known() []string {
+	names := make([]string, 0, len(tags))
+	for n := range tags {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Available returns nil when the backend called name is compiled in, else
+// an error saying which build tag it needs, or that there is no such
+// backend.
+func Available(name string) error {
+	mu.Lock()
+	_, ok := backends[name]
+	mu.Unlock()
+	switch {
+	case ok:
+		return nil
+	case tags[name] != "":
+		return fmt.Errorf("this build has no %s backend; rebuild with -tags %s", name, tags[name])
+	default:
+		return fmt.Errorf("unknown block store backend %q", name)
+	}
+}
+
+// Names returns the backends compiled into this build, sorted.
+func Names() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := make([]string, 0, len(backends))
+	for n := range backends {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the store of network with the backend called name.
+func Open(name, dsn, network string) (Store, error) {
+	if err := Available(name); err != nil {
+		return nil, err
+	}
+	mu.Lock()
+	open := backends[name]
+	mu.Unlock()
+	return open(dsn, network)
+}
+
+// Server reports whether the backend called name connects to a database
+// server, which has no DefaultPath.
+func Server(name string) bool {
+	return servers[name]
+}
+
+// BackendOf returns the backend a DSN's URL scheme names, e.g. "postgres"
+// for postgres://user@host/db, or "" for a path.
+func BackendOf(dsn string) string {
+	scheme, _, ok := strings.Cut(dsn, "://")
+	if !ok {
+		return ""
+	}
+	return schemes[strings.ToLower(scheme)]
+}
+
+// Redact returns dsn fit for logs: a URL without its password, a path
+// as it is.
+func Redact(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return dsn
+}
+
+// DefaultPath is where an embedded backend keeps its database under the
+// cache directory dir when no DSN names one, e.g. dir/blocks.sqlite. Every
+// network shares it, keyed by network.
+func DefaultPath(dir, name string) string {
+	return filepath.Join(dir, "blocks."+name)
+}
@@ -0,0 +1,170 @@
+package blockstore
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpen(t *testing.T) {
+	if _, err := Open("leveldb", "x", "bor-137"); err == nil || err.Error() != `unknown block store backend "leveldb"` {
+		t.Errorf("Open(leveldb) = %v", err)
+	}
+	for _, name := range Known() {
+		err := Available(name)
+		compiled := slices.Contains(Names(), name)
+		if compiled != (err == nil) || !compiled && !strings.Contains(err.Error(), "rebuild with -tags "+tags[name]) {
+			t.Errorf("Available(%s) = %v with %v compiled in", name, err, Names())
+		}
+	}
+}
+
+func TestDSN(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"postgres://chain:secret@db/chain":     "postgres",
+		"POSTGRESQL://db/chain":                "postgres",
+		"/var/cache/chain-utils/blocks.sqlite": "",
+		"mysql://db/chain":                     "",
+	} {
+		if got := BackendOf(dsn); got != want {
+			t.Errorf("BackendOf(%s) = %q, want %q", dsn, got, want)
+		}
+	}
+	if got := Redact("postgres://chain:secret@db/chain?sslmode=require"); got != "postgres://chain:xxxxx@db/chain?sslmode=require" {
+		t.Errorf("Redact = %s", got)
+	}
+	if got := dollarBind("INSERT INTO blocks (a, b) VALUES (?, ?)"); got != "INSERT INTO blocks (a, b) VALUES ($1, $2)" {
+		t.Errorf("dollarBind = %s", got)
+	}
+}
+
+// testStore checks the behaviour every backend shares. open opens the
+// store of a network in one database, the same one on every call.
+func testStore(t *testing.T, open func(network string) (Store, error)) {
+	t.Helper()
+	ctx := context.Background()
+	at := time.Date(2025, 10, 7, 14, 0, 0, 123456789, time.UTC)
+	blocks := []Block{
+		{Height: 3, Hash: "0xc", Time: at.Add(4 * time.Second), Proposer: "0xp3"},
+		{Height: 1, Hash: "0xa", Time: at},
+		{Height: 2, Hash: "0xb", Time: at.Add(2 * time.Second)},
+	}
+
+	st, err := open("heimdall-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := st.Load(ctx); err != nil || len(got) != 0 {
+		t.Fatalf("new store Load = %v, %v", got, err)
+	}
+	if err := st.Add(ctx, blocks); err != nil {
+		t.Fatal(err)
+	}
+	// A finalized height keeps its first block
+	if err := st.Add(ctx, []Block{{Height: 2, Hash: "0xother", Time: at}, {Height: 4, Hash: "0xd", Time: at.Add(6 * time.Second)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Add(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopened, the store holds what was added; another network in the
+	// same database holds nothing of it
+	st, err = open("heimdall-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := st.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Height < got[j].Height })
+	want := append([]Block{blocks[1], blocks[2], blocks[0]}, Block{Height: 4, Hash: "0xd", Time: at.Add(6 * time.Second)})
+	if len(got) != len(want) {
+		t.Fatalf("Load = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Height != want[i].Height || got[i].Hash != want[i].Hash || !got[i].Time.Equal(want[i].Time) || got[i].Proposer != want[i].Proposer {
+			t.Errorf("block %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// bbolt and badger lock the database to one handle
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	other, err := open("bor-137")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if got, err := other.Load(ctx); err != nil || len(got) != 0 {
+		t.Errorf("other network Load = %v, %v", got, err)
+	}
+}
+
+// testExpiring checks the near-head blocks of a backend with TTLs.
+func testExpiring(t *testing.T, open func(network string) (Store, error)) {
+	t.Helper()
+	ctx := context.Background()
+	at := time.Date(2025, 10, 7, 14, 0, 0, 0, time.UTC)
+	st, err := open("bor-137")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv, ok := st.(Expiring)
+	if !ok {
+		t.Fatalf("%T keeps no near-head blocks", st)
+	}
+	now := time.Now()
+	for _, r := range []Recent{
+		{Block: Block{Height: 10, Hash: "0xa", Time: at}, Expires: now.Add(time.Hour)},
+		{Block: Block{Height: 11, Hash: "0xb", Time: at.Add(2 * time.Second)}, Expires: now.Add(time.Hour)},
+		{Block: Block{Height: 12, Hash: "0xc", Time: at.Add(4 * time.Second)}, Expires: now.Add(time.Hour)},
+		{Block: Block{Height: 13, Hash: "0xd", Time: at.Add(6 * time.Second)}, Expires: now.Add(200 * time.Millisecond)},
+		// A reorg replaces the block kept at a height
+		{Block: Block{Height: 11, Hash: "0xb2", Time: at.Add(2 * time.Second)}, Expires: now.Add(time.Hour)},
+	} {
+		if err := kv.PutRecent(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := kv.DropRecent(ctx, []int64{12}); err != nil {
+		t.Fatal(err)
+	}
+	// Near-head blocks are not finalized ones
+	if got, err := kv.Load(ctx); err != nil || len(got) != 0 {
+		t.Errorf("Load = %v, %v", got, err)
+	}
+	if err := kv.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Until(now.Add(300 * time.Millisecond)))
+	st, err = open("bor-137")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	got, err := st.(Expiring).LoadRecent(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Height < got[j].Height })
+	var hashes []string
+	for _, r := range got {
+		hashes = append(hashes, r.Hash)
+		if !r.Time.Equal(at.Add(time.Duration(r.Height-10)*2*time.Second)) || !r.Expires.Equal(now.Add(time.Hour)) {
+			t.Errorf("recent %d = %+v", r.Height, r)
+		}
+	}
+	if want := []string{"0xa", "0xb2"}; !slices.Equal(hashes, want) {
+		t.Errorf("LoadRecent hashes = %v, want %v", hashes, want)
+	}
+}
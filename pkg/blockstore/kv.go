@@ -0,0 +1,42 @@
+package blockstore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+)
+
+// kvValue is how the key-value backends store a block under its height
+// key. Expires is only set on near-head blocks.
+type kvValue struct {
+	Hash      string `json:"hash,omitempty"`
+	TimeNS    int64  `json:"time_ns"`
+	Proposer  string `json:"proposer,omitempty"`
+	ExpiresNS int64  `json:"expires_ns,omitempty"`
+}
+
+// heightKey is a height as 8 big-endian bytes, so keys sort by height.
+func heightKey(h int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(h))
+}
+
+func encodeKV(b Block, expires time.Time) []byte {
+	v := kvValue{Hash: b.Hash, TimeNS: b.Time.UnixNano(), Proposer: b.Proposer}
+	if !expires.IsZero() {
+		v.ExpiresNS = expires.UnixNano()
+	}
+	data, _ := json.Marshal(v)
+	return data
+}
+
+func decodeKV(key, data []byte) (Recent, error) {
+	var v kvValue
+	if err := json.Unmarshal(data, &v); err != nil {
+		return Recent{}, err
+	}
+	r := Recent{Block: Block{Height: int64(binary.BigEndian.Uint64(key[len(key)-8:])), Hash: v.Hash, Time: time.Unix(0, v.TimeNS).UTC(), Proposer: v.Proposer}}
+	if v.ExpiresNS != 0 {
+		r.Expires = time.Unix(0, v.ExpiresNS)
+	}
+	return r, nil
+}
@@ -0,0 +1,48 @@
+//go:build postgres
+
+package blockstore
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+// testPostgres returns the DSN of a scratch schema in the database that
+// CHAIN_UTILS_TEST_POSTGRES names, e.g. postgres://postgres@localhost/test,
+// and drops the schema after the test. Without it the test is skipped.
+func testPostgres(t *testing.T) string {
+	t.Helper()
+	dsn := os.Getenv("CHAIN_UTILS_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("CHAIN_UTILS_TEST_POSTGRES is not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("chain_utils_test_%d", time.Now().UnixNano())
+	if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		db.Close()
+	})
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func TestPostgres(t *testing.T) {
+	dsn := testPostgres(t)
+	testStore(t, func(network string) (Store, error) { return Open("postgres", dsn, network) })
+}
@@ -0,0 +1,103 @@
+package blockstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqlStore is a Store in the blocks table of a SQL database, shared by
+// every network and keyed by (network, height). Times are kept as unix
+// nanoseconds, which hold Bor's whole seconds and Heimdall's fractions
+// alike.
+type sqlStore struct {
+	db      *sql.DB
+	network string
+	// bind rewrites the ? placeholders of a query for the driver
+	bind func(query string) string
+}
+
+const sqlSchema = `CREATE TABLE IF NOT EXISTS blocks (
+	network  TEXT NOT NULL,
+	height   BIGINT NOT NULL,
+	hash     TEXT NOT NULL DEFAULT '',
+	time_ns  BIGINT NOT NULL,
+	proposer TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (network, height)
+)`
+
+// openSQL returns the store of network in db, creating the blocks table
+// when it is missing. bind is nil for drivers that take ? placeholders.
+func openSQL(db *sql.DB, network string, bind func(string) string) (*sqlStore, error) {
+	if bind == nil {
+		bind = func(q string) string { return q }
+	}
+	if _, err := db.Exec(sqlSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create blocks table: %w", err)
+	}
+	return &sqlStore{db: db, network: network, bind: bind}, nil
+}
+
+// dollarBind numbers the ? placeholders of query as $1, $2, ... for
+// drivers, like Postgres's, that take those instead.
+func dollarBind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		fmt.Fprintf(&b, "$%d", n)
+	}
+	return b.String()
+}
+
+func (s *sqlStore) Load(ctx context.Context) ([]Block, error) {
+	rows, err := s.db.QueryContext(ctx, s.bind(`SELECT height, hash, time_ns, proposer FROM blocks WHERE network = ?`), s.network)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var blocks []Block
+	for rows.Next() {
+		var b Block
+		var ns int64
+		if err := rows.Scan(&b.Height, &b.Hash, &ns, &b.Proposer); err != nil {
+			return nil, err
+		}
+		b.Time = time.Unix(0, ns).UTC()
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
+
+func (s *sqlStore) Add(ctx context.Context, blocks []Block) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, s.bind(`INSERT INTO blocks (network, height, hash, time_ns, proposer) VALUES (?, ?, ?, ?, ?) ON CONFLICT (network, height) DO NOTHING`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, b := range blocks {
+		if _, err := stmt.ExecContext(ctx, s.network, b.Height, b.Hash, b.Time.UnixNano(), b.Proposer); err != nil {
+			return fmt.Errorf("height %d: %w", b.Height, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,31 @@
+//go:build sqlite
+
+package blockstore
+
+import (
+	"database/sql"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	Register("sqlite", openSQLite)
+}
+
+// openSQLite opens the SQLite database file at path, creating it when it
+// is missing. The database is in WAL mode and waits out other processes'
+// locks, so a sync and the calculators can share it.
+func openSQLite(path, network string) (Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	q := url.Values{"_pragma": {"busy_timeout(10000)", "journal_mode(WAL)", "synchronous(NORMAL)"}}
+	db, err := sql.Open("sqlite", "file:"+path+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	return openSQL(db, network, nil)
+}
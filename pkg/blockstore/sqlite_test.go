@@ -0,0 +1,13 @@
+//go:build sqlite
+
+package blockstore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLite(t *testing.T) {
+	path := DefaultPath(filepath.Join(t.TempDir(), "cache"), "sqlite")
+	testStore(t, func(network string) (Store, error) { return Open("sqlite", path, network) })
+}
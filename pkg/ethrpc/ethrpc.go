@@ -0,0 +1,517 @@
+// Package ethrpc is the JSON-RPC client the scripts call through, and that
+// tools and services calling Bor or another EVM chain can use too:
+//
+//	c, err := ethrpc.New("https://polygon-rpc.com", ethrpc.WithRetries(5))
+//	if err != nil { ... }
+//	head, err := c.BlockNumber(ctx)
+//	h, err := c.HeaderByNumber(ctx, head-1000)
+//	fmt.Println(h.Number, h.Time)
+//
+// Calls are retried on transport failures, HTTP 429 and 5xx answers and
+// undecodable bodies, with a backoff that grows linearly per attempt, as in
+// the scripts. Errors the node returns in the JSON-RPC envelope are not
+// retried: asking again gets the same answer.
+//
+// The scripts call through it too, with Call, each adding what its flags
+// need: a retry budget shared by the run (WithRetryGate), -strict decoding
+// (WithStrict) and -snapshot recording (WithObserver).
+package ethrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for New.
+const (
+	DefaultTimeout = 20 * time.Second
+	DefaultRetries = 3
+	DefaultBackoff = 600 * time.Millisecond
+
+	// CallRetries is how often Call retries: the scripts make three
+	// attempts in all.
+	CallRetries = 2
+)
+
+// Client calls one JSON-RPC endpoint. It is safe for concurrent use.
+type Client struct {
+	url     string
+	http    *http.Client
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	header  http.Header
+	gate    func(err error) error
+	strict  bool
+	observe func(request, response []byte)
+	id      atomic.Int64
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithTimeout bounds each HTTP request. The default is DefaultTimeout. It
+// does not apply to a client passed with WithHTTPClient, which keeps its
+// own.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.timeout = d }
+}
+
+// WithRetries sets how many times a failed call is retried, 0 for none.
+// The default is DefaultRetries.
+func WithRetries(n int) Option {
+	return func(c *Client) { c.retries = n }
+}
+
+// WithBackoff sets the wait before the first retry; the nth retry waits n
+// times as long. The default is DefaultBackoff.
+func WithBackoff(d time.Duration) Option {
+	return func(c *Client) { c.backoff = d }
+}
+
+// WithHTTPClient sends requests with hc, e.g. one with a custom transport.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithHeader adds a header to every request, e.g. a provider's API key.
+func WithHeader(key, value string) Option {
+	return func(c *Client) { c.header.Add(key, value) }
+}
+
+// WithRetryGate calls gate before each retry with the error that caused it.
+// A non-nil return ends the call with that error instead, e.g. when a retry
+// budget shared by several clients is spent.
+func WithRetryGate(gate func(err error) error) Option {
+	return func(c *Client) { c.gate = gate }
+}
+
+// WithStrict rejects answers a lenient decode would let through. The
+// envelope may hold only jsonrpc ("2.0"), id, result and error, and an error
+// only code, message and data. The results of eth_blockNumber and
+// eth_chainId must be hex quantities, and a block from eth_getBlockByNumber
+// must have hex number and timestamp fields and be the block asked for.
+// Failures are not retried.
+func WithStrict() Option {
+	return func(c *Client) { c.strict = true }
+}
+
+// WithObserver calls observe with the body of every request sent and of the
+// answer read, e.g. to record a run.
+func WithObserver(observe func(request, response []byte)) Option {
+	return func(c *Client) { c.observe = observe }
+}
+
+// New returns a Client for the endpoint at url.
+func New(url string, opts ...Option) (*Client, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("ethrpc: endpoint %q is not an http(s) URL", url)
+	}
+	c := &Client{url: url, timeout: DefaultTimeout, retries: DefaultRetries, backoff: DefaultBackoff, header: make(http.Header)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.retries < 0 || c.backoff < 0 || c.timeout < 0 {
+		return nil, errors.New("ethrpc: negative retries, backoff or timeout")
+	}
+	if c.http == nil {
+		c.http = &http.Client{Timeout: c.timeout}
+	}
+	return c, nil
+}
+
+// Error is an error the node returned in the JSON-RPC envelope.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// HTTPError is a non-2xx answer from the endpoint.
+type HTTPError struct {
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP %d", e.StatusCode)
+}
+
+type request struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+	ID      int64  `json:"id"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// StrictError is an answer WithStrict rejected.
+type StrictError struct {
+	Method string
+	Reason string
+}
+
+func (e *StrictError) Error() string {
+	return fmt.Sprintf("strict: %s: %s", e.Method, e.Reason)
+}
+
+// Call invokes method with params and decodes the result into out, which
+// may be nil to discard it.
+func (c *Client) Call(ctx context.Context, out any, method string, params ...any) error {
+	if params == nil {
+		params = []any{}
+	}
+	body, err := json.Marshal(request{JSONRPC: "2.0", Method: method, Params: params, ID: c.id.Add(1)})
+	if err != nil {
+		return fmt.Errorf("rpc %s: %w", method, err)
+	}
+	var resp response
+	if err := c.send(ctx, method, body, func(raw []byte) error {
+		resp = response{}
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			return err
+		}
+		if c.strict {
+			return checkStrict(method, params, raw, resp)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("rpc %s: %w", method, resp.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, out); err != nil {
+		return fmt.Errorf("rpc %s: decode result: %w", method, err)
+	}
+	return nil
+}
+
+// Call invokes method with params on the endpoint at url, sending through
+// hc, and decodes the result into out. It is for callers that talk to
+// endpoints named at run time rather than keeping a Client each: the
+// scripts call every endpoint through it. Calls make CallRetries retries;
+// opts are applied after that and can change it.
+func Call(ctx context.Context, hc *http.Client, url, method string, params []any, out any, opts ...Option) error {
+	c, err := New(url, append([]Option{WithHTTPClient(hc), WithRetries(CallRetries)}, opts...)...)
+	if err != nil {
+		return err
+	}
+	return c.Call(ctx, out, method, params...)
+}
+
+// BatchElem is one call of a batch.
+type BatchElem struct {
+	Method string
+	Params []any
+	// Result receives the decoded result; nil discards it.
+	Result any
+	// Error is set when the node answered this call with an error or the
+	// result could not be decoded.
+	Error error
+}
+
+// BatchCall sends elems as one JSON-RPC batch request and fills in each
+// element's Result or Error. The returned error is for the batch as a
+// whole: a request that failed after retries, or an answer missing calls.
+func (c *Client) BatchCall(ctx context.Context, elems []BatchElem) error {
+	if len(elems) == 0 {
+		return nil
+	}
+	reqs := make([]request, len(elems))
+	first := c.id.Add(int64(len(elems))) - int64(len(elems)) + 1
+	for i, e := range elems {
+		params := e.Params
+		if params == nil {
+			params = []any{}
+		}
+		reqs[i] = request{JSONRPC: "2.0", Method: e.Method, Params: params, ID: first + int64(i)}
+	}
+	body, err := json.Marshal(reqs)
+	if err != nil {
+		return fmt.Errorf("rpc batch: %w", err)
+	}
+	var resps []response
+	if err := c.send(ctx, "batch", body, func(raw []byte) error {
+		resps = nil
+		return json.Unmarshal(raw, &resps)
+	}); err != nil {
+		return err
+	}
+	answered := make([]bool, len(elems))
+	seen := 0
+	for _, r := range resps {
+		var id int64
+		if json.Unmarshal(r.ID, &id) != nil || id < first || id >= first+int64(len(elems)) {
+			return fmt.Errorf("rpc batch: answer with unknown id %s", clip(string(r.ID)))
+		}
+		if answered[id-first] {
+			return fmt.Errorf("rpc batch: two answers with id %d", id)
+		}
+		answered[id-first] = true
+		e := &elems[id-first]
+		seen++
+		switch {
+		case r.Error != nil:
+			e.Error = fmt.Errorf("rpc %s: %w", e.Method, r.Error)
+		case e.Result != nil:
+			if err := json.Unmarshal(r.Result, e.Result); err != nil {
+				e.Error = fmt.Errorf("rpc %s: decode result: %w", e.Method, err)
+			}
+		}
+	}
+	if seen != len(elems) {
+		return fmt.Errorf("rpc batch: %d answers for %d calls", seen, len(elems))
+	}
+	return nil
+}
+
+// send posts body, retrying as the package doc describes, and hands the
+// answer to decode; a decode error counts as an undecodable body unless it
+// is a StrictError.
+func (c *Client) send(ctx context.Context, method string, body []byte, decode func(raw []byte) error) error {
+	var lastErr error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			if c.gate != nil {
+				if err := c.gate(lastErr); err != nil {
+					return err
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.backoff * time.Duration(attempt)):
+			}
+		}
+		raw, err := c.post(ctx, body)
+		if err == nil {
+			err = decode(raw)
+		}
+		if lastErr = err; lastErr == nil {
+			return nil
+		}
+		var se *StrictError
+		if errors.As(lastErr, &se) {
+			return lastErr
+		}
+		if !retryable(lastErr) || ctx.Err() != nil {
+			return fmt.Errorf("rpc %s: %w", method, lastErr)
+		}
+	}
+	return fmt.Errorf("rpc %s failed after %d attempts: %w", method, c.retries+1, lastErr)
+}
+
+func (c *Client) post(ctx context.Context, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if c.observe != nil {
+		c.observe(body, raw)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &HTTPError{StatusCode: resp.StatusCode}
+	}
+	return raw, nil
+}
+
+// checkStrict applies WithStrict to the answer raw, already decoded into
+// resp, of a call of method with params.
+func checkStrict(method string, params []any, raw []byte, resp response) error {
+	var env struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Result  json.RawMessage `json:"result"`
+		Error   *Error          `json:"error"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&env); err != nil {
+		return &StrictError{method, "response: " + err.Error()}
+	}
+	if resp.JSONRPC != "2.0" {
+		return &StrictError{method, fmt.Sprintf("response has jsonrpc %q, want %q", clip(resp.JSONRPC), "2.0")}
+	}
+	if resp.Error != nil {
+		return nil
+	}
+	switch method {
+	case "eth_blockNumber", "eth_chainId":
+		if _, err := hexField(resp.Result); err != nil {
+			return &StrictError{method, err.Error()}
+		}
+	case "eth_getBlockByNumber":
+		if string(resp.Result) == "null" {
+			return nil
+		}
+		var b map[string]json.RawMessage
+		if err := json.Unmarshal(resp.Result, &b); err != nil {
+			return &StrictError{method, fmt.Sprintf("block is %s, want an object", clip(string(resp.Result)))}
+		}
+		for _, f := range []string{"number", "timestamp"} {
+			v, ok := b[f]
+			if !ok {
+				return &StrictError{method, fmt.Sprintf("block has no %q field", f)}
+			}
+			if _, err := hexField(v); err != nil {
+				return &StrictError{method, fmt.Sprintf("block %q: %v", f, err)}
+			}
+		}
+		if len(params) > 0 {
+			if tag, ok := params[0].(string); ok && strings.HasPrefix(tag, "0x") {
+				want, _ := HexToUint64(tag)
+				if got, _ := hexField(b["number"]); got != want {
+					return &StrictError{method, fmt.Sprintf("asked for block %d, got block %d", want, got)}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hexField parses a JSON string holding a hex quantity.
+func hexField(raw json.RawMessage) (uint64, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, fmt.Errorf("%s is not a string", clip(string(raw)))
+	}
+	return HexToUint64(s)
+}
+
+// retryable reports whether a failed request may succeed when sent again:
+// anything but a 4xx answer other than 429.
+func retryable(err error) bool {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he.StatusCode == http.StatusTooManyRequests || he.StatusCode >= 500
+	}
+	return true
+}
+
+// Header is the part of a block the calculators read.
+type Header struct {
+	Number     uint64
+	Hash       string
+	ParentHash string
+	Time       time.Time
+}
+
+// BlockNumber returns the height of the latest block.
+func (c *Client) BlockNumber(ctx context.Context) (uint64, error) {
+	var hex string
+	if err := c.Call(ctx, &hex, "eth_blockNumber"); err != nil {
+		return 0, err
+	}
+	return HexToUint64(hex)
+}
+
+// ChainID returns the endpoint's EIP-155 chain id.
+func (c *Client) ChainID(ctx context.Context) (uint64, error) {
+	var hex string
+	if err := c.Call(ctx, &hex, "eth_chainId"); err != nil {
+		return 0, err
+	}
+	return HexToUint64(hex)
+}
+
+// HeaderByNumber returns the header of block n.
+func (c *Client) HeaderByNumber(ctx context.Context, n uint64) (Header, error) {
+	return c.HeaderByTag(ctx, fmt.Sprintf("0x%x", n))
+}
+
+// HeaderByTag returns the header of the block a tag names: "latest",
+// "finalized", "safe", or a hex height.
+func (c *Client) HeaderByTag(ctx context.Context, tag string) (Header, error) {
+	var b *struct {
+		Number     string `json:"number"`
+		Hash       string `json:"hash"`
+		ParentHash string `json:"parentHash"`
+		Timestamp  string `json:"timestamp"`
+	}
+	if err := c.Call(ctx, &b, "eth_getBlockByNumber", tag, false); err != nil {
+		return Header{}, err
+	}
+	if b == nil {
+		return Header{}, fmt.Errorf("no block %s", tag)
+	}
+	n, err := HexToUint64(b.Number)
+	if err != nil {
+		return Header{}, fmt.Errorf("block %s number: %w", tag, err)
+	}
+	ts, err := HexToUint64(b.Timestamp)
+	if err != nil {
+		return Header{}, fmt.Errorf("block %s timestamp: %w", tag, err)
+	}
+	// past int64 the time would wrap to before 1970
+	if ts > math.MaxInt64 {
+		return Header{}, fmt.Errorf("block %s timestamp %d out of range", tag, ts)
+	}
+	return Header{Number: n, Hash: b.Hash, ParentHash: b.ParentHash, Time: time.Unix(int64(ts), 0).UTC()}, nil
+}
+
+// HexToUint64 decodes a JSON-RPC quantity such as "0x1b4".
+func HexToUint64(h string) (uint64, error) {
+	if strings.HasPrefix(h, "0x") || strings.HasPrefix(h, "0X") {
+		h = h[2:]
+	}
+	if h == "" {
+		return 0, errors.New("empty hex string")
+	}
+	// big.Int would take a sign, which no quantity carries
+	if h[0] == '+' || h[0] == '-' {
+		return 0, fmt.Errorf("invalid hex %q", clip(h))
+	}
+	bi := new(big.Int)
+	if _, ok := bi.SetString(h, 16); !ok {
+		return 0, fmt.Errorf("invalid hex %q", clip(h))
+	}
+	if !bi.IsUint64() {
+		return 0, fmt.Errorf("hex %q out of uint64 range", clip(h))
+	}
+	return bi.Uint64(), nil
+}
+
+// clip shortens s for error messages, as a misbehaving provider can return
+// a page of HTML where a short field was expected.
+func clip(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:80] + "…"
+}
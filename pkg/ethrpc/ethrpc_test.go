@@ -0,0 +1,477 @@
+package ethrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// node answers each request with the next of answers (the last repeats),
+// counting the requests it gets. An answer of a number is sent as that HTTP
+// status with an empty body.
+func node(t *testing.T, answers ...any) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1)) - 1
+		a := answers[min(n, len(answers)-1)]
+		if code, ok := a.(int); ok {
+			w.WriteHeader(code)
+			return
+		}
+		fmt.Fprint(w, a)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func newClient(t *testing.T, url string, opts ...Option) *Client {
+	t.Helper()
+	c, err := New(url, append([]Option{WithBackoff(time.Millisecond)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+const block = `{"jsonrpc":"2.0","id":1,"result":{"number":"0xf4240","hash":"0xaa","parentHash":"0xbb","timestamp":"0x6956b620"}}`
+
+func TestHeaderByNumber(t *testing.T) {
+	srv, _ := node(t, block)
+	h, err := newClient(t, srv.URL).HeaderByNumber(context.Background(), 1_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Header{Number: 1_000_000, Hash: "0xaa", ParentHash: "0xbb", Time: time.Date(2026, 1, 1, 18, 0, 0, 0, time.UTC)}
+	if h != want {
+		t.Errorf("HeaderByNumber = %+v, want %+v", h, want)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		answers []any
+		calls   int64
+		wantErr string
+	}{
+		{"rate limited then ok", []any{http.StatusTooManyRequests, block}, 2, ""},
+		{"5xx then ok", []any{http.StatusBadGateway, http.StatusServiceUnavailable, block}, 3, ""},
+		{"truncated body then ok", []any{`{"jsonrpc":"2.0","id":1,"res`, block}, 2, ""},
+		{"rate limited throughout", []any{http.StatusTooManyRequests}, 4, "failed after 4 attempts: HTTP 429"},
+		{"4xx is final", []any{http.StatusUnauthorized}, 1, "HTTP 401"},
+		{"node error is final", []any{`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"header not found"}}`}, 1, "header not found"},
+		{"missing block", []any{`{"jsonrpc":"2.0","id":1,"result":null}`}, 1, "no block 0xf4240"},
+		{"bad timestamp", []any{`{"jsonrpc":"2.0","id":1,"result":{"number":"0x1","timestamp":"0x-1"}}`}, 1, "timestamp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := node(t, tt.answers...)
+			_, err := newClient(t, srv.URL).HeaderByNumber(context.Background(), 1_000_000)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("HeaderByNumber: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("HeaderByNumber error = %v, want one containing %q", err, tt.wantErr)
+			}
+			if calls.Load() != tt.calls {
+				t.Errorf("made %d requests, want %d", calls.Load(), tt.calls)
+			}
+		})
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	srv, _ := node(t, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}`)
+	err := newClient(t, srv.URL).Call(context.Background(), nil, "eth_foo")
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32601 {
+		t.Errorf("Call error = %v, want an *Error with code -32601", err)
+	}
+
+	srv, _ = node(t, http.StatusForbidden)
+	err = newClient(t, srv.URL).Call(context.Background(), nil, "eth_foo")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusForbidden {
+		t.Errorf("Call error = %v, want an *HTTPError with status 403", err)
+	}
+}
+
+func TestRetryGate(t *testing.T) {
+	srv, calls := node(t, http.StatusTooManyRequests)
+	spent := errors.New("retry budget spent")
+	var seen []error
+	c := newClient(t, srv.URL, WithRetryGate(func(err error) error {
+		seen = append(seen, err)
+		if len(seen) == 2 {
+			return spent
+		}
+		return nil
+	}))
+	if err := c.Call(context.Background(), nil, "eth_blockNumber"); !errors.Is(err, spent) {
+		t.Fatalf("Call error = %v, want the gate's", err)
+	}
+	var he *HTTPError
+	if calls.Load() != 2 || len(seen) != 2 || !errors.As(seen[0], &he) {
+		t.Errorf("made %d requests and asked the gate %d times (%v), want 2 and 2 with the HTTP errors", calls.Load(), len(seen), seen)
+	}
+}
+
+func TestCall(t *testing.T) {
+	srv, calls := node(t, http.StatusBadGateway, `{"jsonrpc":"2.0","id":1,"result":"0x89"}`)
+	var id string
+	if err := Call(context.Background(), http.DefaultClient, srv.URL, "eth_chainId", nil, &id, WithBackoff(time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if id != "0x89" || calls.Load() != 2 {
+		t.Errorf("Call = %q after %d requests, want 0x89 after 2", id, calls.Load())
+	}
+
+	srv, calls = node(t, http.StatusBadGateway)
+	err := Call(context.Background(), http.DefaultClient, srv.URL, "eth_chainId", nil, &id, WithBackoff(time.Millisecond))
+	if err == nil || calls.Load() != CallRetries+1 {
+		t.Errorf("Call error = %v after %d requests, want a failure after %d", err, calls.Load(), CallRetries+1)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		name, method string
+		params       []any
+		answer       string
+		wantErr      string
+	}{
+		{"valid block", "eth_getBlockByNumber", []any{"0xf4240", false}, block, ""},
+		{"extra envelope field", "eth_blockNumber", nil, `{"jsonrpc":"2.0","id":1,"result":"0x1","extra":1}`, "unknown field"},
+		{"wrong version", "eth_blockNumber", nil, `{"jsonrpc":"1.0","id":1,"result":"0x1"}`, "jsonrpc"},
+		{"decimal height", "eth_blockNumber", nil, `{"jsonrpc":"2.0","id":1,"result":1}`, "not a string"},
+		{"block without timestamp", "eth_getBlockByNumber", []any{"latest", false}, `{"jsonrpc":"2.0","id":1,"result":{"number":"0x1"}}`, `no "timestamp" field`},
+		{"other block", "eth_getBlockByNumber", []any{"0xf4241", false}, block, "asked for block 1000001, got block 1000000"},
+		{"null block", "eth_getBlockByNumber", []any{"0xf4241", false}, `{"jsonrpc":"2.0","id":1,"result":null}`, ""},
+		{"node error with data", "eth_call", nil, `{"jsonrpc":"2.0","id":1,"error":{"code":3,"message":"reverted","data":"0x08c379a0"}}`, "reverted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := node(t, tt.answer)
+			var out json.RawMessage
+			err := newClient(t, srv.URL, WithStrict()).Call(context.Background(), &out, tt.method, tt.params...)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Call: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Call error = %v, want one containing %q", err, tt.wantErr)
+			}
+			if calls.Load() != 1 {
+				t.Errorf("made %d requests, want 1: strict failures are not retried", calls.Load())
+			}
+		})
+	}
+}
+
+func TestObserver(t *testing.T) {
+	srv, _ := node(t, http.StatusBadGateway, `{"jsonrpc":"2.0","id":1,"result":"0x10"}`)
+	var seen []string
+	c := newClient(t, srv.URL, WithObserver(func(req, resp []byte) {
+		seen = append(seen, string(req)+" -> "+string(resp))
+	}))
+	n, err := c.BlockNumber(context.Background())
+	if err != nil || n != 16 {
+		t.Fatalf("BlockNumber = %d, %v, want 16", n, err)
+	}
+	want := []string{
+		`{"jsonrpc":"2.0","method":"eth_blockNumber","params":[],"id":1} -> `,
+		`{"jsonrpc":"2.0","method":"eth_blockNumber","params":[],"id":1} -> {"jsonrpc":"2.0","id":1,"result":"0x10"}`,
+	}
+	if strings.Join(seen, "\n") != strings.Join(want, "\n") {
+		t.Errorf("observed\n%s\nwant\n%s", strings.Join(seen, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestHeader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"0x89"}`)
+	}))
+	defer srv.Close()
+	id, err := newClient(t, srv.URL, WithHeader("X-Api-Key", "secret")).ChainID(context.Background())
+	if err != nil || id != 137 {
+		t.Fatalf("ChainID = %d, %v, want 137", id, err)
+	}
+}
+
+func TestBatchCall(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []request
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// answers come back in any order, as the spec allows
+		var out []string
+		for i := len(reqs) - 1; i >= 0; i-- {
+			q := reqs[i]
+			if q.Params[0] == "0x3" {
+				out = append(out, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"error":{"code":-32000,"message":"header not found"}}`, q.ID))
+				continue
+			}
+			out = append(out, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":{"number":"%s"}}`, q.ID, q.Params[0]))
+		}
+		fmt.Fprint(w, "["+strings.Join(out, ",")+"]")
+	}))
+	defer srv.Close()
+
+	c := newClient(t, srv.URL)
+	type blk struct{ Number string }
+	blocks := make([]*blk, 3)
+	calls := make([]BatchElem, 3)
+	for i := range calls {
+		calls[i] = BatchElem{Method: "eth_getBlockByNumber", Params: []any{fmt.Sprintf("0x%x", i+1), false}, Result: &blocks[i]}
+	}
+	if err := c.BatchCall(context.Background(), calls); err != nil {
+		t.Fatal(err)
+	}
+	if blocks[0].Number != "0x1" || blocks[1].Number != "0x2" || blocks[2] != nil {
+		t.Errorf("batch results = %v, %v, %v, want 0x1, 0x2 and none", blocks[0], blocks[1], blocks[2])
+	}
+	var rpcErr *Error
+	if calls[0].Error != nil || calls[1].Error != nil || !errors.As(calls[2].Error, &rpcErr) {
+		t.Errorf("batch errors = %v, %v, %v, want only the third", calls[0].Error, calls[1].Error, calls[2].Error)
+	}
+}
+
+func TestBatchCallMissingAnswer(t *testing.T) {
+	srv, _ := node(t, `[{"jsonrpc":"2.0","id":1,"result":"0x1"}]`)
+	calls := []BatchElem{{Method: "eth_blockNumber"}, {Method: "eth_chainId"}}
+	if err := newClient(t, srv.URL).BatchCall(context.Background(), calls); err == nil || !strings.Contains(err.Error(), "1 answers for 2 calls") {
+		t.Fatalf("BatchCall error = %v, want the missing answer reported", err)
+	}
+}
+
+func TestHexToUint64(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint64
+		wantErr bool
+	}{
+		{"0x0", 0, false},
+		{"0x1b4", 436, false},
+		{"0X1B4", 436, false},
+		{"1b4", 436, false},
+		{"0xffffffffffffffff", 1<<64 - 1, false},
+		{"0x10000000000000000", 0, true},
+		{"", 0, true},
+		{"0x", 0, true},
+		{"0x-1", 0, true},
+		{"0x+1", 0, true},
+		{"0xzz", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := HexToUint64(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("HexToUint64(%q) = %d, %v, want %d (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, tt := range []struct {
+		url  string
+		opts []Option
+	}{
+		{"polygon-rpc.com", nil},
+		{"wss://polygon-rpc.com", nil},
+		{"https://polygon-rpc.com", []Option{WithRetries(-1)}},
+		{"https://polygon-rpc.com", []Option{WithBackoff(-time.Second)}},
+	} {
+		if _, err := New(tt.url, tt.opts...); err == nil {
+			t.Errorf("New(%q) succeeded, want an error", tt.url)
+		}
+	}
+}
+
+// FuzzHexToUint64 checks that any string either parses to the quantity its
+// hex digits spell or fails with an error that quotes at most a clip of it.
+func FuzzHexToUint64(f *testing.F) {
+	for _, s := range []string{"0x0", "0x1b4", "0X1B4", "1b4", "0xffffffffffffffff", "0x10000000000000000", "", "0x", "0x-1", "0x+1", "0x_1", "0x1_0", " 0x1", "0x" + strings.Repeat("f", 100)} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		n, err := HexToUint64(s)
+		if err != nil {
+			// 80 bytes, each at most \xff once quoted
+			if len(err.Error()) > 4*80+60 {
+				t.Errorf("HexToUint64(%q) error is %d bytes long", s, len(err.Error()))
+			}
+			return
+		}
+		digits := strings.TrimLeft(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"), "0")
+		if !strings.EqualFold(digits, strings.TrimLeft(fmt.Sprintf("%x", n), "0")) {
+			t.Errorf("HexToUint64(%q) = %d, which is 0x%x", s, n, n)
+		}
+	})
+}
+
+// answerTransport answers every request with body, without a network.
+type answerTransport []byte
+
+func (a answerTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(string(a))), Header: make(http.Header)}, nil
+}
+
+// FuzzHeaderByNumber feeds arbitrary answers to a block request. Nothing
+// may panic, a decoded header is never from before 1970, and an answer
+// WithStrict accepts must decode to the same header without it, for the
+// block asked for.
+func FuzzHeaderByNumber(f *testing.F) {
+	for _, s := range []string{
+		block,
+		`{"jsonrpc":"2.0","id":1,"result":null}`,
+		`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"header not found"}}`,
+		`{"jsonrpc":"2.0","id":1,"result":{"number":"0xf4240","timestamp":"0xffffffffffffffff"}}`,
+		`{"jsonrpc":"2.0","id":1,"result":{"number":"0xf4240","timestamp":1767290400}}`,
+		`{"jsonrpc":"2.0","id":1,"result":{"number":"0xf4240","timestamp":"0x6956b620"},"extra":1}`,
+		`{"jsonrpc":"1.0","id":1,"result":{}}`,
+		`[]`,
+		`<html>502 Bad Gateway</html>`,
+		``,
+	} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		hc := &http.Client{Transport: answerTransport(body)}
+		lenient, err := New("http://node", WithHTTPClient(hc), WithRetries(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		strict, _ := New("http://node", WithHTTPClient(hc), WithRetries(0), WithStrict())
+		ctx := context.Background()
+		h, err := lenient.HeaderByNumber(ctx, 1_000_000)
+		hs, serr := strict.HeaderByNumber(ctx, 1_000_000)
+		if err == nil && h.Time.Unix() < 0 {
+			t.Errorf("header time %v from %s", h.Time, body)
+		}
+		if serr != nil {
+			return
+		}
+		if err != nil || h != hs {
+			t.Errorf("strict decode gave %+v, lenient %+v, %v", hs, h, err)
+		}
+		if hs.Number != 1_000_000 {
+			t.Errorf("strict decode accepted block %d for block 1000000", hs.Number)
+		}
+	})
+}
+
+// FuzzBatchCall feeds arbitrary answers to a batch. Nothing may panic, and
+// a batch that succeeds has every call answered, with a result or an error.
+func FuzzBatchCall(f *testing.F) {
+	for _, s := range []string{
+		`[{"jsonrpc":"2.0","id":2,"result":"0x2"},{"jsonrpc":"2.0","id":1,"result":"0x1"}]`,
+		`[{"jsonrpc":"2.0","id":1,"result":"0x1"},{"jsonrpc":"2.0","id":2,"error":{"code":-32000,"message":"pruned"}}]`,
+		`[{"jsonrpc":"2.0","id":1,"result":"0x1"}]`,
+		`[{"jsonrpc":"2.0","id":1,"result":"0x1"},{"jsonrpc":"2.0","id":1,"result":"0x1"}]`,
+		`[{"jsonrpc":"2.0","id":"1","result":"0x1"},{"jsonrpc":"2.0","id":2,"result":2}]`,
+		`{"jsonrpc":"2.0","id":1,"result":"0x1"}`,
+		`null`,
+	} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		c, err := New("http://node", WithHTTPClient(&http.Client{Transport: answerTransport(body)}), WithRetries(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := make([]json.RawMessage, 2)
+		calls := []BatchElem{{Method: "eth_blockNumber", Result: &results[0]}, {Method: "eth_blockNumber", Result: &results[1]}}
+		if err := c.BatchCall(context.Background(), calls); err != nil {
+			return
+		}
+		for i, call := range calls {
+			if call.Error == nil && len(results[i]) == 0 {
+				t.Errorf("call %d left unanswered by %s", i+1, body)
+			}
+		}
+	})
+}
+
+func BenchmarkHexToUint64(b *testing.B) {
+	for range b.N {
+		if _, err := HexToUint64("0x6956b620"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkHeaderByNumber measures a block request and its decode, with the
+// answer served from memory so no network time is counted.
+func BenchmarkHeaderByNumber(b *testing.B) {
+	c, err := New("http://node", WithHTTPClient(&http.Client{Transport: answerTransport(block)}))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := c.HeaderByNumber(context.Background(), 1_000_000); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// batchTransport answers every call of a batch with the same block.
+type batchTransport struct{}
+
+func (batchTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var reqs []struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, req := range reqs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, `{"jsonrpc":"2.0","id":%d,"result":{"number":"0xf4240","hash":"0xaa","parentHash":"0xbb","timestamp":"0x6956b620"}}`, req.ID)
+	}
+	buf.WriteByte(']')
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(&buf), Header: make(http.Header)}, nil
+}
+
+// BenchmarkBatchCall measures a 100-block batch, the unit the scripts
+// sample history in, including the in-memory node's share.
+func BenchmarkBatchCall(b *testing.B) {
+	c, err := New("http://node", WithHTTPClient(&http.Client{Transport: batchTransport{}}))
+	if err != nil {
+		b.Fatal(err)
+	}
+	type header struct {
+		Number    string `json:"number"`
+		Timestamp string `json:"timestamp"`
+	}
+	headers := make([]header, 100)
+	calls := make([]BatchElem, len(headers))
+	b.ReportAllocs()
+	for range b.N {
+		for i := range calls {
+			calls[i] = BatchElem{Method: "eth_getBlockByNumber", Params: []any{fmt.Sprintf("0x%x", 1_000_000-i), false}, Result: &headers[i]}
+		}
+		if err := c.BatchCall(context.Background(), calls); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
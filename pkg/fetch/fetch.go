@@ -0,0 +1,80 @@
+// Package fetch bounds how many requests a tool has in flight against one
+// endpoint, and stops the rest as soon as one fails:
+//
+//	g := fetch.NewGroup(ctx, 4)
+//	for i, h := range heights {
+//		g.Go(func(ctx context.Context) (err error) {
+//			times[i], err = getBlockTime(ctx, h)
+//			return err
+//		})
+//	}
+//	if err := g.Wait(); err != nil { ... }
+//
+// It is errgroup with SetLimit, kept here so the scripts and the binary need
+// no dependency for it.
+package fetch
+
+import (
+	"context"
+	"sync"
+)
+
+// Group runs fetches with at most limit in flight. The first error cancels
+// the group's context, so queued fetches are skipped and running ones abort,
+// and Wait returns that error. Fetches whose failures are not fatal record
+// them and return nil.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	sem    chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+// NewGroup returns a Group running at most limit fetches at once (at least
+// one), under a context derived from ctx.
+func NewGroup(ctx context.Context, limit int) *Group {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{ctx: ctx, cancel: cancel, sem: make(chan struct{}, max(limit, 1))}
+}
+
+// Go runs fetch once fewer than limit fetches are running. It blocks until
+// then, and drops fetch if the group has already failed.
+func (g *Group) Go(fetch func(ctx context.Context) error) {
+	select {
+	case g.sem <- struct{}{}:
+		// A failed fetch cancels before it frees its slot, so the group
+		// may have failed while this one waited for it
+		if err := g.ctx.Err(); err != nil {
+			<-g.sem
+			g.fail(err)
+			return
+		}
+	case <-g.ctx.Done():
+		g.fail(g.ctx.Err())
+		return
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() { <-g.sem }()
+		if err := fetch(g.ctx); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+func (g *Group) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
+
+// Wait waits for every fetch and returns the first error.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
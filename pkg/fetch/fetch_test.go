@@ -0,0 +1,75 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupLimit(t *testing.T) {
+	g := NewGroup(context.Background(), 3)
+	var running, peak, done atomic.Int64
+	for range 20 {
+		g.Go(func(ctx context.Context) error {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+			done.Add(1)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatalf("Wait = %v", err)
+	}
+	if done.Load() != 20 || peak.Load() > 3 {
+		t.Errorf("ran %d fetches with up to %d at once, want 20 with at most 3", done.Load(), peak.Load())
+	}
+}
+
+func TestGroupFirstErrorCancels(t *testing.T) {
+	g := NewGroup(context.Background(), 2)
+	boom := errors.New("boom")
+	var started atomic.Int64
+	g.Go(func(ctx context.Context) error {
+		started.Add(1)
+		return boom
+	})
+	g.Go(func(ctx context.Context) error {
+		started.Add(1)
+		<-ctx.Done() // a running fetch sees the failure
+		return ctx.Err()
+	})
+	for range 10 {
+		g.Go(func(ctx context.Context) error {
+			started.Add(1)
+			return nil
+		})
+	}
+	if err := g.Wait(); !errors.Is(err, boom) {
+		t.Errorf("Wait = %v, want the first error", err)
+	}
+	if n := started.Load(); n != 2 {
+		t.Errorf("%d fetches started, want the queued ones dropped after the failure", n)
+	}
+}
+
+func TestGroupParentCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	g := NewGroup(ctx, 0)
+	g.Go(func(ctx context.Context) error {
+		t.Error("fetch ran under a canceled context")
+		return nil
+	})
+	if err := g.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait = %v, want context.Canceled", err)
+	}
+}
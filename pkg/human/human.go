@@ -0,0 +1,48 @@
+// Package human is the number and duration formatting the scripts print
+// with, so every report renders heights and spans the same way.
+package human
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// CommasUint renders u with thousands separators, e.g. 78,000,000.
+func CommasUint(u uint64) string {
+	s := strconv.FormatUint(u, 10)
+	n := len(s)
+	if n <= 3 {
+		return s
+	}
+	b := make([]byte, 0, n+(n-1)/3)
+	pre := n % 3
+	if pre == 0 {
+		pre = 3
+	}
+	b = append(b, s[:pre]...)
+	for i := pre; i < n; i += 3 {
+		b = append(b, ',')
+		b = append(b, s[i:i+3]...)
+	}
+	return string(b)
+}
+
+// Commas is CommasUint for a signed value.
+func Commas(v int64) string {
+	if v < 0 {
+		return "-" + CommasUint(uint64(-v))
+	}
+	return CommasUint(uint64(v))
+}
+
+// DHMS renders d in whole days, hours, minutes and seconds, e.g.
+// "1d 2h 3m 4s", with a leading "-" when d is negative.
+func DHMS(d time.Duration) string {
+	prefix := ""
+	if d < 0 {
+		prefix, d = "-", -d
+	}
+	totalSec := int64(d / time.Second)
+	return fmt.Sprintf("%s%dd %dh %dm %ds", prefix, totalSec/86400, totalSec%86400/3600, totalSec%3600/60, totalSec%60)
+}
@@ -0,0 +1,44 @@
+package human
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCommas(t *testing.T) {
+	for _, tc := range []struct {
+		in   int64
+		want string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1000, "1,000"},
+		{78000000, "78,000,000"},
+		{-1234567, "-1,234,567"},
+		{math.MaxInt64, "9,223,372,036,854,775,807"},
+	} {
+		if got := Commas(tc.in); got != tc.want {
+			t.Errorf("Commas(%d) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+	if got := CommasUint(math.MaxUint64); got != "18,446,744,073,709,551,615" {
+		t.Errorf("CommasUint(MaxUint64) = %q", got)
+	}
+}
+
+func TestDHMS(t *testing.T) {
+	for _, tc := range []struct {
+		in   time.Duration
+		want string
+	}{
+		{0, "0d 0h 0m 0s"},
+		{59*time.Second + 900*time.Millisecond, "0d 0h 0m 59s"},
+		{26*time.Hour + 3*time.Minute + 4*time.Second, "1d 2h 3m 4s"},
+		{-90 * time.Second, "-0d 0h 1m 30s"},
+	} {
+		if got := DHMS(tc.in); got != tc.want {
+			t.Errorf("DHMS(%v) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
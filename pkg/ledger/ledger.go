@@ -0,0 +1,219 @@
+// Package ledger is the prediction ledger: a JSON-lines file the hf
+// calculators, the Heimdall estimator and chain_utils_server.go append
+// their predictions to, and prediction_accuracy_report.go scores once the
+// target blocks exist.
+//
+//	e := ledger.Entry{RecordedAt: now, Network: "mainnet", Chain: "bor", ...}
+//	err := ledger.Record(ledger.DefaultPath(), e, head, blockTime)
+//	entries, err := ledger.Read(ledger.DefaultPath())
+//
+// The file is only appended to, never rewritten, so runs recording at the
+// same time cannot lose each other's lines. A postgres:// URL in place of
+// the path keeps the same lines in a Postgres table instead, so a team can
+// share one ledger; that needs a build with -tags postgres.
+package ledger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Entry is one prediction of the ledger. ActualTime is filled in once the
+// target block exists.
+type Entry struct {
+	RecordedAt    time.Time  `json:"recorded_at"`
+	Network       string     `json:"network"`
+	Chain         string     `json:"chain"`
+	Estimator     string     `json:"estimator"`
+	TargetHeight  int64      `json:"target_height"`
+	PredictedTime time.Time  `json:"predicted_time"`
+	ActualTime    *time.Time `json:"actual_time,omitempty"`
+	Inputs        *Inputs    `json:"inputs,omitempty"`
+	// Realized marks an Actual line; Read folds it away.
+	Realized bool `json:"realized,omitempty"`
+}
+
+// Actual is a ledger line that stamps ActualTime on every earlier
+// prediction of its network, chain and target height.
+type Actual struct {
+	RecordedAt   time.Time `json:"recorded_at"`
+	Network      string    `json:"network"`
+	Chain        string    `json:"chain"`
+	TargetHeight int64     `json:"target_height"`
+	ActualTime   time.Time `json:"actual_time"`
+	Realized     bool      `json:"realized"`
+}
+
+// Inputs records what a prediction was computed from.
+type Inputs struct {
+	HeadHeight   int64     `json:"head_height"`
+	HeadTime     time.Time `json:"head_time"`
+	AvgBlockTime float64   `json:"avg_block_time_seconds"`
+	Rounding     string    `json:"rounding,omitempty"`
+}
+
+// lineDB keeps the ledger lines in a database, in the order appended.
+type lineDB interface {
+	// append stores lines, each one JSON value, in one transaction.
+	append(lines [][]byte) error
+	lines() ([][]byte, error)
+	close() error
+}
+
+// openDB opens the database ledger at a postgres:// URL. It is set by
+// postgres.go, which is only compiled in with -tags postgres.
+var openDB func(url string) (lineDB, error)
+
+// isURL reports whether path names a database ledger rather than a file.
+func isURL(path string) bool {
+	scheme, _, ok := strings.Cut(path, "://")
+	return ok && (scheme == "postgres" || scheme == "postgresql")
+}
+
+func dial(url string) (lineDB, error) {
+	if openDB == nil {
+		return nil, fmt.Errorf("this build has no postgres ledger; rebuild with -tags postgres")
+	}
+	return openDB(url)
+}
+
+// DefaultPath is ~/.chain-utils/predictions.jsonl, or predictions.jsonl in
+// the working directory when there is no home directory.
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "predictions.jsonl"
+	}
+	return filepath.Join(home, ".chain-utils", "predictions.jsonl")
+}
+
+// Record appends e to the ledger at path, after an Actual line for each
+// pending target of the same network and chain at or below head. A target
+// block blockTime cannot fetch stays pending for the next run.
+func Record(path string, e Entry, head int64, blockTime func(int64) (time.Time, error)) error {
+	entries, err := Read(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var lines []any
+	seen := make(map[int64]bool)
+	for _, p := range entries {
+		if p.ActualTime != nil || p.Network != e.Network || p.Chain != e.Chain || p.TargetHeight > head || seen[p.TargetHeight] {
+			continue
+		}
+		seen[p.TargetHeight] = true
+		at, err := blockTime(p.TargetHeight)
+		if err != nil {
+			continue
+		}
+		lines = append(lines, Actual{RecordedAt: e.RecordedAt, Network: e.Network, Chain: e.Chain, TargetHeight: p.TargetHeight, ActualTime: at.UTC(), Realized: true})
+	}
+	return Append(path, append(lines, e)...)
+}
+
+// Append appends lines, each an Entry or an Actual, to the ledger at path
+// in a single write, so the lines of runs recording at the same time never
+// interleave or overwrite each other.
+func Append(path string, lines ...any) error {
+	if isURL(path) {
+		rows := make([][]byte, len(lines))
+		for i, l := range lines {
+			row, err := json.Marshal(l)
+			if err != nil {
+				return err
+			}
+			rows[i] = row
+		}
+		db, err := dial(path)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+		return db.append(rows)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, l := range lines {
+		if err := enc.Encode(l); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read reads the ledger at path, with the actual times of Actual lines
+// stamped on the predictions they realize.
+func Read(path string) ([]Entry, error) {
+	if isURL(path) {
+		db, err := dial(path)
+		if err != nil {
+			return nil, err
+		}
+		defer db.close()
+		rows, err := db.lines()
+		if err != nil {
+			return nil, err
+		}
+		return parse(bytes.NewReader(bytes.Join(rows, []byte("\n"))))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parse(f)
+}
+
+// parse reads ledger lines from r.
+func parse(r io.Reader) ([]Entry, error) {
+	type target struct {
+		network, chain string
+		height         int64
+	}
+	var entries []Entry
+	actual := make(map[target]time.Time)
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if e.Realized {
+			if e.ActualTime == nil {
+				return nil, fmt.Errorf("line %d: realized line without actual_time", line)
+			}
+			actual[target{e.Network, e.Chain, e.TargetHeight}] = *e.ActualTime
+			continue
+		}
+		entries = append(entries, e)
+	}
+	for i, e := range entries {
+		if at, ok := actual[target{e.Network, e.Chain, e.TargetHeight}]; ok && e.ActualTime == nil {
+			entries[i].ActualTime = &at
+		}
+	}
+	return entries, sc.Err()
+}
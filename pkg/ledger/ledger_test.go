@@ -0,0 +1,102 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func blockTime(h int64) time.Time {
+	return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(h) * time.Second)
+}
+
+func pending(chain string, h int64) Entry {
+	return Entry{Network: "mainnet", Chain: chain, Estimator: "lookback-mean", TargetHeight: h, PredictedTime: blockTime(h)}
+}
+
+func TestRecord(t *testing.T) {
+	testRecord(t, filepath.Join(t.TempDir(), "predictions.jsonl"))
+}
+
+// testRecord records into the empty ledger at path, sequentially and from
+// concurrent runs.
+func testRecord(t *testing.T, path string) {
+	if err := Append(path, pending("heimdall", 100), pending("bor", 100), pending("heimdall", 200), pending("heimdall", 5000)); err != nil {
+		t.Fatal(err)
+	}
+	// Block 200 fails to fetch: it stays pending rather than failing the run
+	lookup := func(h int64) (time.Time, error) {
+		if h == 200 {
+			return time.Time{}, errors.New("HTTP 500")
+		}
+		return blockTime(h).Add(time.Minute), nil
+	}
+	if err := Record(path, pending("heimdall", 6000), 1000, lookup); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		actual := "pending"
+		if e.ActualTime != nil {
+			actual = e.ActualTime.Sub(e.PredictedTime).String()
+		}
+		got = append(got, fmt.Sprintf("%s %d %s", e.Chain, e.TargetHeight, actual))
+	}
+	want := "[heimdall 100 1m0s bor 100 pending heimdall 200 pending heimdall 5000 pending heimdall 6000 pending]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("ledger = %v, want %s", got, want)
+	}
+
+	// Runs recording at once keep every line
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := Record(path, pending("heimdall", int64(7000+i)), 1000, lookup); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if entries, err = Read(path); err != nil || len(entries) != 25 {
+		t.Errorf("ledger holds %d predictions, %v, want 25", len(entries), err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name, ledger, want string
+	}{
+		{"bad line", "{\"network\":\"mainnet\"}\nnot json\n", "line 2:"},
+		{"realized without time", `{"network":"mainnet","chain":"bor","target_height":5,"realized":true}` + "\n", "line 1: realized line without actual_time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "predictions.jsonl")
+			if err := os.WriteFile(path, []byte(tt.ledger), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Read(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Read error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := Read(filepath.Join(t.TempDir(), "missing.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("Read of a missing ledger = %v, want a not-exist error", err)
+	}
+	if openDB == nil {
+		if _, err := Read("postgres://chain@db/chain"); err == nil || !strings.Contains(err.Error(), "rebuild with -tags postgres") {
+			t.Errorf("Read of a postgres ledger = %v, want the build tag", err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+//go:build postgres
+
+package ledger
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func init() {
+	openDB = openPostgres
+}
+
+// pgLedger keeps the ledger in the ledger table of a Postgres database, a
+// row per line, so the team's predictions can be queried in SQL too:
+// SELECT line->>'estimator', count(*) FROM ledger GROUP BY 1.
+type pgLedger struct {
+	db *sql.DB
+}
+
+const pgSchema = `CREATE TABLE IF NOT EXISTS ledger (
+	id   BIGSERIAL PRIMARY KEY,
+	line JSONB NOT NULL
+)`
+
+func openPostgres(url string) (lineDB, error) {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(pgSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create ledger table: %w", err)
+	}
+	return &pgLedger{db: db}, nil
+}
+
+func (l *pgLedger) append(lines [][]byte) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, line := range lines {
+		if _, err := tx.Exec(`INSERT INTO ledger (line) VALUES ($1)`, string(line)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (l *pgLedger) lines() ([][]byte, error) {
+	rows, err := l.db.Query(`SELECT line::text FROM ledger ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var lines [][]byte
+	for rows.Next() {
+		var line []byte
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+func (l *pgLedger) close() error {
+	return l.db.Close()
+}
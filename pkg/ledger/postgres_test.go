@@ -0,0 +1,39 @@
+//go:build postgres
+
+package ledger
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestPostgres records into a scratch schema of the database that
+// CHAIN_UTILS_TEST_POSTGRES names, e.g. postgres://postgres@localhost/test.
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("CHAIN_UTILS_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("CHAIN_UTILS_TEST_POSTGRES is not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	schema := fmt.Sprintf("chain_utils_test_%d", time.Now().UnixNano())
+	if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP SCHEMA " + schema + " CASCADE")
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	testRecord(t, u.String())
+}
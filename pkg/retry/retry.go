@@ -0,0 +1,111 @@
+// Package retry is the retry budget the scripts' -retry-budget sets: one
+// pool of retries shared by every call of a run.
+//
+//	retries := retry.NewBudget(20, nil)
+//	err := ethrpc.Call(ctx, hc, url, "eth_blockNumber", nil, &head, ethrpc.WithRetryGate(retries.Spend))
+//
+// Without it a flapping endpoint multiplies: every call retries it on its
+// own. Once the budget is spent, calls fail at their next retry with a
+// tally of what went wrong.
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+)
+
+// ErrExhausted is wrapped by the error of a call that found the budget
+// spent.
+var ErrExhausted = errors.New("retry budget exhausted")
+
+// Budget caps the retries a whole run may spend across all of its
+// concurrent calls. It is safe for concurrent use.
+type Budget struct {
+	mu     sync.Mutex
+	left   int
+	spent  int
+	counts map[string]int
+	free   func(err error) bool
+}
+
+// NewBudget returns a budget of n retries. Retries after an error free
+// reports true for are counted in the tally but not taken from the budget;
+// free may be nil.
+func NewBudget(n int, free func(err error) bool) *Budget {
+	return &Budget{left: n, counts: make(map[string]int), free: free}
+}
+
+// Spend takes one retry for a call that just failed with err, or returns
+// an error wrapping ErrExhausted when none are left. Its signature fits
+// ethrpc.WithRetryGate.
+func (b *Budget) Spend(err error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.counts[Category(err)]++
+	if b.free != nil && b.free(err) {
+		return nil
+	}
+	if b.left <= 0 {
+		return fmt.Errorf("%w: %d retries spent, failures seen: %s; last error: %v", ErrExhausted, b.spent, b.summary(), err)
+	}
+	b.left--
+	b.spent++
+	return nil
+}
+
+// summary lists the failures seen by category, most frequent first, e.g.
+// "14 timeout, 6 HTTP 5xx".
+func (b *Budget) summary() string {
+	cats := make([]string, 0, len(b.counts))
+	for c := range b.counts {
+		cats = append(cats, c)
+	}
+	sort.Slice(cats, func(i, j int) bool {
+		if b.counts[cats[i]] != b.counts[cats[j]] {
+			return b.counts[cats[i]] > b.counts[cats[j]]
+		}
+		return cats[i] < cats[j]
+	})
+	parts := make([]string, len(cats))
+	for i, c := range cats {
+		parts[i] = fmt.Sprintf("%d %s", b.counts[c], c)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Category buckets a failed call for the budget's tally: "timeout", "rate
+// limited", "HTTP 5xx", "HTTP 4xx", "malformed response", "connection" or
+// "rpc error".
+func Category(err error) string {
+	var (
+		ne net.Error
+		se *json.SyntaxError
+		te *json.UnmarshalTypeError
+		he *ethrpc.HTTPError
+	)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return "timeout"
+	case errors.As(err, &he) && he.StatusCode == http.StatusTooManyRequests:
+		return "rate limited"
+	case errors.As(err, &he) && he.StatusCode >= 500:
+		return "HTTP 5xx"
+	case errors.As(err, &he):
+		return "HTTP 4xx"
+	case errors.As(err, &se), errors.As(err, &te), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return "malformed response"
+	case errors.As(err, &ne):
+		return "connection"
+	}
+	return "rpc error"
+}
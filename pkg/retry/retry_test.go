@@ -0,0 +1,90 @@
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pratikspatil024/chain-utils/pkg/ethrpc"
+)
+
+func TestSpend(t *testing.T) {
+	b := NewBudget(2, nil)
+	for range 2 {
+		if err := b.Spend(&ethrpc.HTTPError{StatusCode: 502}); err != nil {
+			t.Fatalf("Spend with retries left = %v", err)
+		}
+	}
+	err := b.Spend(context.DeadlineExceeded)
+	if !errors.Is(err, ErrExhausted) {
+		t.Fatalf("Spend of a spent budget = %v, want ErrExhausted", err)
+	}
+	want := "retry budget exhausted: 2 retries spent, failures seen: 2 HTTP 5xx, 1 timeout; last error: context deadline exceeded"
+	if err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
+
+func TestSpendFree(t *testing.T) {
+	rateLimited := func(err error) bool { return Category(err) == "rate limited" }
+	b := NewBudget(0, rateLimited)
+	for range 5 {
+		if err := b.Spend(&ethrpc.HTTPError{StatusCode: 429}); err != nil {
+			t.Fatalf("Spend after a free error = %v", err)
+		}
+	}
+	err := b.Spend(&ethrpc.HTTPError{StatusCode: 500})
+	if err == nil || !strings.Contains(err.Error(), "0 retries spent, failures seen: 5 rate limited, 1 HTTP 5xx") {
+		t.Errorf("Spend = %v, want the free retries tallied but not spent", err)
+	}
+}
+
+func TestSpendConcurrent(t *testing.T) {
+	b := NewBudget(50, nil)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		denied int
+	)
+	for range 80 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b.Spend(errors.New("boom")) != nil {
+				mu.Lock()
+				denied++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if denied != 30 {
+		t.Errorf("%d of 80 retries denied from a budget of 50, want 30", denied)
+	}
+}
+
+func TestCategory(t *testing.T) {
+	bad := json.Unmarshal([]byte("{"), &struct{}{})
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{context.DeadlineExceeded, "timeout"},
+		{fmt.Errorf("rpc eth_blockNumber: %w", &ethrpc.HTTPError{StatusCode: 429}), "rate limited"},
+		{fmt.Errorf("%w for https://example.org", &ethrpc.HTTPError{StatusCode: 503}), "HTTP 5xx"},
+		{&ethrpc.HTTPError{StatusCode: 404}, "HTTP 4xx"},
+		{bad, "malformed response"},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "connection"},
+		{&ethrpc.Error{Code: -32000, Message: "header not found"}, "rpc error"},
+	}
+	for _, tt := range tests {
+		if got := Category(tt.err); got != tt.want {
+			t.Errorf("Category(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
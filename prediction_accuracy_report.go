@@ -0,0 +1,10 @@
+//go:build ignore
+
+// go run prediction_accuracy_report.go
+// go run prediction_accuracy_report.go -ledger="$HOME/.chain-utils/predictions.jsonl" -format=json
+
+package main
+
+import "github.com/pratikspatil024/chain-utils/internal/accuracy"
+
+func main() { accuracy.Main() }
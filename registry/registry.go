@@ -0,0 +1,11 @@
+// Package registry embeds registry.json, the chain registry and Bor
+// hardfork table the Bor calculators start from, so one binary works on an
+// air-gapped machine.
+package registry
+
+import _ "embed"
+
+// JSON is the embedded registry.json.
+//
+//go:embed registry.json
+var JSON []byte
@@ -0,0 +1,11 @@
+//go:build ignore
+
+// go run snapshot_at.go -time="2025-10-07T14:00:00Z"
+// go run snapshot_at.go -time="2025-10-07T14:00:00Z" -network=amoy
+// go run snapshot_at.go -time="2025-10-07T14:00:00Z" -l1-rpc="" -json
+
+package main
+
+import "github.com/pratikspatil024/chain-utils/internal/snapshotat"
+
+func main() { snapshotat.Main() }
@@ -0,0 +1,11 @@
+//go:build ignore
+
+// go run zkevm_blocktime_calculator.go
+// go run zkevm_blocktime_calculator.go -target="2025-12-03T21:49:11Z"
+// go run zkevm_blocktime_calculator.go -rpc="https://rpc.cardona.zkevm-rpc.com" -lookbacks=5000,50000 -batches=200
+
+package main
+
+import "github.com/pratikspatil024/chain-utils/internal/zkevmavg"
+
+func main() { zkevmavg.Main() }